@@ -357,3 +357,317 @@ pub mod legacy {
         }
     }
 }
+
+pub mod gateway_api {
+    use super::*;
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    #[serde(rename_all = "camelCase")]
+    pub struct BackendRef {
+        pub group: Option<String>,
+        pub kind: Option<String>,
+        pub name: String,
+        pub namespace: Option<String>,
+        pub port: Option<i32>,
+        pub weight: Option<i32>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct HTTPPathMatch {
+        #[serde(rename = "type")]
+        pub type_: Option<String>,
+        pub value: Option<String>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct HTTPRouteMatch {
+        pub path: Option<HTTPPathMatch>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    #[serde(rename_all = "camelCase")]
+    pub struct HTTPRouteRule {
+        pub matches: Option<Vec<HTTPRouteMatch>>,
+        pub backend_refs: Option<Vec<BackendRef>>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct GRPCMethodMatch {
+        #[serde(rename = "type")]
+        pub type_: Option<String>,
+        pub service: Option<String>,
+        pub method: Option<String>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct GRPCRouteMatch {
+        pub method: Option<GRPCMethodMatch>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    #[serde(rename_all = "camelCase")]
+    pub struct GRPCRouteRule {
+        pub matches: Option<Vec<GRPCRouteMatch>>,
+        pub backend_refs: Option<Vec<BackendRef>>,
+    }
+
+    pub mod v1 {
+        use super::*;
+
+        #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+        #[kube(
+            group = "gateway.networking.k8s.io",
+            version = "v1",
+            kind = "HTTPRoute",
+            namespaced
+        )]
+        #[serde(rename_all = "camelCase")]
+        pub struct HTTPRouteSpec {
+            pub hostnames: Option<Vec<String>>,
+            pub rules: Option<Vec<HTTPRouteRule>>,
+        }
+
+        impl Trimmable for HTTPRoute {
+            fn trim(mut self) -> Self {
+                let name = if let Some(name) = self.metadata.name.as_ref() {
+                    name
+                } else {
+                    ""
+                };
+                let mut resource = Self::new(name, self.spec);
+                resource.metadata = ObjectMeta {
+                    uid: self.metadata.uid.take(),
+                    name: self.metadata.name.take(),
+                    namespace: self.metadata.namespace.take(),
+                    ..Default::default()
+                };
+                resource
+            }
+        }
+
+        #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+        #[kube(
+            group = "gateway.networking.k8s.io",
+            version = "v1",
+            kind = "GRPCRoute",
+            namespaced
+        )]
+        #[serde(rename_all = "camelCase")]
+        pub struct GRPCRouteSpec {
+            pub hostnames: Option<Vec<String>>,
+            pub rules: Option<Vec<GRPCRouteRule>>,
+        }
+
+        impl Trimmable for GRPCRoute {
+            fn trim(mut self) -> Self {
+                let name = if let Some(name) = self.metadata.name.as_ref() {
+                    name
+                } else {
+                    ""
+                };
+                let mut resource = Self::new(name, self.spec);
+                resource.metadata = ObjectMeta {
+                    uid: self.metadata.uid.take(),
+                    name: self.metadata.name.take(),
+                    namespace: self.metadata.namespace.take(),
+                    ..Default::default()
+                };
+                resource
+            }
+        }
+    }
+
+    pub mod v1beta1 {
+        use super::*;
+
+        #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+        #[kube(
+            group = "gateway.networking.k8s.io",
+            version = "v1beta1",
+            kind = "HTTPRoute",
+            namespaced
+        )]
+        #[serde(rename_all = "camelCase")]
+        pub struct HTTPRouteSpec {
+            pub hostnames: Option<Vec<String>>,
+            pub rules: Option<Vec<HTTPRouteRule>>,
+        }
+
+        impl Trimmable for HTTPRoute {
+            fn trim(mut self) -> Self {
+                let name = if let Some(name) = self.metadata.name.as_ref() {
+                    name
+                } else {
+                    ""
+                };
+                let mut resource = Self::new(name, self.spec);
+                resource.metadata = ObjectMeta {
+                    uid: self.metadata.uid.take(),
+                    name: self.metadata.name.take(),
+                    namespace: self.metadata.namespace.take(),
+                    ..Default::default()
+                };
+                resource
+            }
+        }
+    }
+
+    pub mod v1alpha2 {
+        use super::*;
+
+        #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+        #[kube(
+            group = "gateway.networking.k8s.io",
+            version = "v1alpha2",
+            kind = "GRPCRoute",
+            namespaced
+        )]
+        #[serde(rename_all = "camelCase")]
+        pub struct GRPCRouteSpec {
+            pub hostnames: Option<Vec<String>>,
+            pub rules: Option<Vec<GRPCRouteRule>>,
+        }
+
+        impl Trimmable for GRPCRoute {
+            fn trim(mut self) -> Self {
+                let name = if let Some(name) = self.metadata.name.as_ref() {
+                    name
+                } else {
+                    ""
+                };
+                let mut resource = Self::new(name, self.spec);
+                resource.metadata = ObjectMeta {
+                    uid: self.metadata.uid.take(),
+                    name: self.metadata.name.take(),
+                    namespace: self.metadata.namespace.take(),
+                    ..Default::default()
+                };
+                resource
+            }
+        }
+    }
+}
+
+pub mod istio {
+    use super::*;
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct StringMatch {
+        pub exact: Option<String>,
+        pub prefix: Option<String>,
+        pub regex: Option<String>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct HTTPMatchRequest {
+        pub uri: Option<StringMatch>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct PortSelector {
+        pub number: Option<u32>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct Destination {
+        pub host: String,
+        pub subset: Option<String>,
+        pub port: Option<PortSelector>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct RouteDestination {
+        pub destination: Destination,
+        pub weight: Option<i32>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct HTTPRoute {
+        #[serde(rename = "match")]
+        pub match_: Option<Vec<HTTPMatchRequest>>,
+        pub route: Option<Vec<RouteDestination>>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct TCPRoute {
+        pub route: Option<Vec<RouteDestination>>,
+    }
+
+    #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    #[kube(
+        group = "networking.istio.io",
+        version = "v1beta1",
+        kind = "VirtualService",
+        namespaced
+    )]
+    #[serde(rename_all = "camelCase")]
+    pub struct VirtualServiceSpec {
+        pub hosts: Option<Vec<String>>,
+        pub gateways: Option<Vec<String>>,
+        pub http: Option<Vec<HTTPRoute>>,
+        pub tls: Option<Vec<TCPRoute>>,
+        pub tcp: Option<Vec<TCPRoute>>,
+    }
+
+    impl Trimmable for VirtualService {
+        fn trim(mut self) -> Self {
+            let name = if let Some(name) = self.metadata.name.as_ref() {
+                name
+            } else {
+                ""
+            };
+            let mut resource = Self::new(name, self.spec);
+            resource.metadata = ObjectMeta {
+                uid: self.metadata.uid.take(),
+                name: self.metadata.name.take(),
+                namespace: self.metadata.namespace.take(),
+                ..Default::default()
+            };
+            resource
+        }
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct Port {
+        pub number: Option<u32>,
+        pub protocol: Option<String>,
+        pub name: Option<String>,
+    }
+
+    #[derive(Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    pub struct Server {
+        pub port: Option<Port>,
+        pub hosts: Option<Vec<String>>,
+    }
+
+    #[derive(CustomResource, Clone, Debug, Serialize, Deserialize, JsonSchema)]
+    #[kube(
+        group = "networking.istio.io",
+        version = "v1beta1",
+        kind = "Gateway",
+        namespaced
+    )]
+    #[serde(rename_all = "camelCase")]
+    pub struct GatewaySpec {
+        pub selector: Option<BTreeMap<String, String>>,
+        pub servers: Option<Vec<Server>>,
+    }
+
+    impl Trimmable for Gateway {
+        fn trim(mut self) -> Self {
+            let name = if let Some(name) = self.metadata.name.as_ref() {
+                name
+            } else {
+                ""
+            };
+            let mut resource = Self::new(name, self.spec);
+            resource.metadata = ObjectMeta {
+                uid: self.metadata.uid.take(),
+                name: self.metadata.name.take(),
+                namespace: self.metadata.namespace.take(),
+                ..Default::default()
+            };
+            resource
+        }
+    }
+}
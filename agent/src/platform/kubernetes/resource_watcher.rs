@@ -31,6 +31,7 @@ use futures::StreamExt;
 use k8s_openapi::{
     api::{
         apps::v1::{DaemonSet, Deployment, ReplicaSet, ReplicaSetSpec, StatefulSet},
+        batch::v1::{CronJob, Job},
         core::v1::{
             ConfigMap, Container, ContainerStatus, Namespace, Node, NodeCondition, NodeSpec,
             NodeStatus, Pod, PodSpec, PodStatus, ReplicationController, Service, ServiceStatus,
@@ -59,6 +60,8 @@ use tokio::{
 
 use super::crd::{
     calico::IpPool,
+    gateway_api,
+    istio::{Gateway as IstioGateway, VirtualService},
     kruise::{CloneSet, StatefulSet as KruiseStatefulSet},
     legacy,
     opengauss::OpenGaussCluster,
@@ -210,6 +213,14 @@ pub enum GenericResourceWatcher {
     DaemonSet(ResourceWatcher<DaemonSet>),
     ReplicationController(ResourceWatcher<ReplicationController>),
     ReplicaSet(ResourceWatcher<ReplicaSet>),
+    Job(ResourceWatcher<Job>),
+    CronJob(ResourceWatcher<CronJob>),
+    V1HTTPRoute(ResourceWatcher<gateway_api::v1::HTTPRoute>),
+    V1Beta1HTTPRoute(ResourceWatcher<gateway_api::v1beta1::HTTPRoute>),
+    V1GRPCRoute(ResourceWatcher<gateway_api::v1::GRPCRoute>),
+    V1Alpha2GRPCRoute(ResourceWatcher<gateway_api::v1alpha2::GRPCRoute>),
+    VirtualService(ResourceWatcher<VirtualService>),
+    IstioGateway(ResourceWatcher<IstioGateway>),
     V1Ingress(ResourceWatcher<networking::v1::Ingress>),
     V1Beta1Ingress(ResourceWatcher<legacy::networking::Ingress>),
     ExtV1Beta1Ingress(ResourceWatcher<legacy::extensions::Ingress>),
@@ -586,6 +597,79 @@ pub fn supported_resources() -> Vec<Resource> {
             selected_gv: SelectedGv::None,
             field_selector: String::new(),
         },
+        Resource {
+            name: "jobs",
+            pb_name: "*v1.Job",
+            group_versions: vec![GroupVersion {
+                group: "batch",
+                version: "v1",
+            }],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
+        Resource {
+            name: "cronjobs",
+            pb_name: "*v1.CronJob",
+            group_versions: vec![GroupVersion {
+                group: "batch",
+                version: "v1",
+            }],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
+        Resource {
+            name: "httproutes",
+            pb_name: "*v1.HTTPRoute",
+            group_versions: vec![
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1",
+                },
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1beta1",
+                },
+            ],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
+        Resource {
+            name: "grpcroutes",
+            pb_name: "*v1.GRPCRoute",
+            group_versions: vec![
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1",
+                },
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1alpha2",
+                },
+            ],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
+        Resource {
+            name: "virtualservices",
+            pb_name: "*v1beta1.VirtualService",
+            group_versions: vec![GroupVersion {
+                group: "networking.istio.io",
+                version: "v1beta1",
+            }],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
+        // gateways of istio, gateways of gateway api are not watched
+        Resource {
+            name: "gateways",
+            pb_name: "*v1beta1.Gateway",
+            group_versions: vec![GroupVersion {
+                group: "networking.istio.io",
+                version: "v1beta1",
+            }],
+            selected_gv: SelectedGv::None,
+            field_selector: String::new(),
+        },
     ]
 }
 
@@ -1282,6 +1366,29 @@ impl Trimmable for StatefulSet {
     }
 }
 
+// job status is kept for the start/completion time and succeeded/failed counts of each run
+impl Trimmable for Job {
+    fn trim(mut self) -> Self {
+        self.metadata.managed_fields = None;
+        Job {
+            metadata: self.metadata,
+            spec: self.spec,
+            status: self.status,
+        }
+    }
+}
+
+impl Trimmable for CronJob {
+    fn trim(mut self) -> Self {
+        self.metadata.managed_fields = None;
+        CronJob {
+            metadata: self.metadata,
+            spec: self.spec,
+            ..Default::default()
+        }
+    }
+}
+
 impl Trimmable for Deployment {
     fn trim(mut self) -> Self {
         self.metadata.managed_fields = None;
@@ -1560,6 +1667,83 @@ impl ResourceWatcherFactory {
             "opengaussclusters" => GenericResourceWatcher::OpenGaussCluster(
                 self.new_namespace_resource(resource, stats_collector, namespace, config),
             ),
+            "jobs" => GenericResourceWatcher::Job(self.new_namespace_resource(
+                resource,
+                stats_collector,
+                namespace,
+                config,
+            )),
+            "cronjobs" => GenericResourceWatcher::CronJob(self.new_namespace_resource(
+                resource,
+                stats_collector,
+                namespace,
+                config,
+            )),
+            "httproutes" => match resource.selected_gv.unwrap() {
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1",
+                } => GenericResourceWatcher::V1HTTPRoute(self.new_namespace_resource(
+                    resource,
+                    stats_collector,
+                    namespace,
+                    config,
+                )),
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1beta1",
+                } => GenericResourceWatcher::V1Beta1HTTPRoute(self.new_namespace_resource(
+                    resource,
+                    stats_collector,
+                    namespace,
+                    config,
+                )),
+                _ => {
+                    warn!(
+                        "unsupported resource {} group version {}",
+                        resource.name,
+                        resource.selected_gv.unwrap()
+                    );
+                    return None;
+                }
+            },
+            "grpcroutes" => match resource.selected_gv.unwrap() {
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1",
+                } => GenericResourceWatcher::V1GRPCRoute(self.new_namespace_resource(
+                    resource,
+                    stats_collector,
+                    namespace,
+                    config,
+                )),
+                GroupVersion {
+                    group: "gateway.networking.k8s.io",
+                    version: "v1alpha2",
+                } => GenericResourceWatcher::V1Alpha2GRPCRoute(self.new_namespace_resource(
+                    resource,
+                    stats_collector,
+                    namespace,
+                    config,
+                )),
+                _ => {
+                    warn!(
+                        "unsupported resource {} group version {}",
+                        resource.name,
+                        resource.selected_gv.unwrap()
+                    );
+                    return None;
+                }
+            },
+            "virtualservices" => GenericResourceWatcher::VirtualService(
+                self.new_namespace_resource(resource, stats_collector, namespace, config),
+            ),
+            "gateways" => GenericResourceWatcher::IstioGateway(self.new_namespace_resource(
+                resource,
+                stats_collector,
+                namespace,
+                config,
+            )),
             _ => {
                 warn!("unsupported resource {}", resource.name);
                 return None;
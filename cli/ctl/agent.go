@@ -127,6 +127,8 @@ deepflow-ctl agent rebalance --type=analyzer`,
 	agent.AddCommand(update)
 	agent.AddCommand(updateExample)
 	agent.AddCommand(rebalanceCmd)
+	agent.AddCommand(registerAgentExecCommand())
+	agent.AddCommand(registerAgentRolloutCommand())
 	return agent
 }
 
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deepflowio/deepflow/cli/ctl/common"
+	"github.com/deepflowio/deepflow/cli/ctl/common/table"
+)
+
+func registerAgentExecCommand() *cobra.Command {
+	var group, selector, output string
+	var params []string
+	var concurrency, cmdTimeout int
+	var wait time.Duration
+	exec := &cobra.Command{
+		Use:   "exec <cmd>",
+		Short: "run an allow-listed command on a group of agents",
+		Example: "deepflow-ctl agent exec --group default ping -p addr=10.1.1.1\n" +
+			"deepflow-ctl agent exec --selector 'region=r1,name=node-*' --concurrency 20 ps\n" +
+			"deepflow-ctl agent exec history\n" +
+			"deepflow-ctl agent exec history 12",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "must specify one command.\nExample: %s\n", cmd.Example)
+				return
+			}
+			if group == "" && selector == "" {
+				fmt.Fprintf(os.Stderr, "must specify --group or --selector.\nExample: %s\n", cmd.Example)
+				return
+			}
+			paramMap := map[string]interface{}{}
+			for _, p := range params {
+				kv := strings.SplitN(p, "=", 2)
+				if len(kv) != 2 || kv[0] == "" {
+					fmt.Fprintf(os.Stderr, "invalid param(%s), key=value is expected\n", p)
+					return
+				}
+				paramMap[kv[0]] = kv[1]
+			}
+			execAgentCMD(cmd, map[string]interface{}{
+				"CMD":         args[0],
+				"PARAMS":      paramMap,
+				"AGENT_GROUP": group,
+				"SELECTOR":    selector,
+				"CONCURRENCY": concurrency,
+				"TIMEOUT":     cmdTimeout,
+			}, wait, output)
+		},
+	}
+	exec.Flags().StringVarP(&group, "group", "g", "", "agent group name or lcuuid")
+	exec.Flags().StringVarP(&selector, "selector", "l", "", "agent selector, e.g. 'region=r1,os!=windows,name=node-*', "+
+		"keys: name, group, region, az, os, arch, type, state, team_id, revision, ctrl_ip, controller_ip")
+	exec.Flags().StringArrayVarP(&params, "param", "p", nil, "command param in key=value format, can be repeated")
+	exec.Flags().IntVarP(&concurrency, "concurrency", "c", 0, "agents running the command at the same time, server default if 0")
+	exec.Flags().IntVarP(&cmdTimeout, "cmd-timeout", "", 0, "timeout of each agent in seconds, server default if 0")
+	exec.Flags().DurationVarP(&wait, "wait", "", 10*time.Minute, "max time to wait for all agents")
+	exec.Flags().StringVarP(&output, "output", "o", "", "output format, yaml or table (default)")
+
+	var historyCMD, historyOutput string
+	var historyLimit int
+	history := &cobra.Command{
+		Use:   "history [id]",
+		Short: "list audit records of agent command executions, or show the results of one",
+		Example: "deepflow-ctl agent exec history --cmd ping\n" +
+			"deepflow-ctl agent exec history 12 -o yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				getAgentCMDAudit(cmd, args[0], historyOutput)
+				return
+			}
+			listAgentCMDAudits(cmd, historyCMD, historyLimit, historyOutput)
+		},
+	}
+	history.Flags().StringVarP(&historyCMD, "cmd", "", "", "filter by command")
+	history.Flags().IntVarP(&historyLimit, "limit", "", 20, "max records to list")
+	history.Flags().StringVarP(&historyOutput, "output", "o", "", "output format, yaml or table (default)")
+
+	exec.AddCommand(history)
+	return exec
+}
+
+func execAgentCMD(cmd *cobra.Command, body map[string]interface{}, wait time.Duration, output string) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agents/cmd/run", server.IP, server.Port)
+	response, err := common.CURLPerform("POST", url, body, "",
+		[]common.HTTPOption{common.WithTimeout(wait), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data := response.Get("DATA")
+	if output == "yaml" {
+		dataJson, _ := data.MarshalJSON()
+		dataYaml, _ := yaml.JSONToYAML(dataJson)
+		fmt.Print(string(dataYaml))
+		return
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"AGENT_ID", "AGENT_NAME", "STATUS", "DURATION", "ERROR"})
+	tableItems := [][]string{}
+	results := data.Get("RESULTS")
+	for i := range results.MustArray() {
+		result := results.GetIndex(i)
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(result.Get("AGENT_ID").MustInt()),
+			result.Get("AGENT_NAME").MustString(),
+			result.Get("STATUS").MustString(),
+			(time.Duration(result.Get("DURATION").MustInt64()) * time.Millisecond).String(),
+			firstLine(result.Get("ERROR").MustString()),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+	for i := range results.MustArray() {
+		result := results.GetIndex(i)
+		if content := result.Get("OUTPUT").MustString(); content != "" {
+			fmt.Printf("\n==== %s (%s) ====\n%s\n", result.Get("AGENT_NAME").MustString(), result.Get("STATUS").MustString(), content)
+		}
+	}
+	fmt.Printf("\naudit id: %d, agents: %d, success: %d, failed: %d\n", data.Get("AUDIT_ID").MustInt(),
+		data.Get("AGENT_NUM").MustInt(), data.Get("SUCCESS_NUM").MustInt(), data.Get("FAILED_NUM").MustInt())
+}
+
+func listAgentCMDAudits(cmd *cobra.Command, cmdName string, limit int, output string) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agent-cmd-audits?limit=%d", server.IP, server.Port, limit)
+	if cmdName != "" {
+		url += fmt.Sprintf("&cmd=%s", cmdName)
+	}
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if output == "yaml" {
+		dataJson, _ := response.Get("DATA").MarshalJSON()
+		dataYaml, _ := yaml.JSONToYAML(dataJson)
+		fmt.Print(string(dataYaml))
+		return
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"ID", "STARTED_AT", "USER_ID", "CMD", "PARAMS", "TARGET", "STATUS", "AGENT_NUM", "SUCCESS_NUM", "FAILED_NUM"})
+	tableItems := [][]string{}
+	for i := range response.Get("DATA").MustArray() {
+		audit := response.Get("DATA").GetIndex(i)
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(audit.Get("ID").MustInt()),
+			audit.Get("STARTED_AT").MustString(),
+			strconv.Itoa(audit.Get("USER_ID").MustInt()),
+			audit.Get("CMD").MustString(),
+			audit.Get("PARAMS").MustString(),
+			audit.Get("TARGET").MustString(),
+			audit.Get("STATUS").MustString(),
+			strconv.Itoa(audit.Get("AGENT_NUM").MustInt()),
+			strconv.Itoa(audit.Get("SUCCESS_NUM").MustInt()),
+			strconv.Itoa(audit.Get("FAILED_NUM").MustInt()),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func getAgentCMDAudit(cmd *cobra.Command, id string, output string) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agent-cmd-audits/%s", server.IP, server.Port, id)
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data := response.Get("DATA")
+	if output == "yaml" {
+		dataJson, _ := data.MarshalJSON()
+		dataYaml, _ := yaml.JSONToYAML(dataJson)
+		fmt.Print(string(dataYaml))
+		return
+	}
+
+	fmt.Printf("id: %d\ncmd: %s\nparams: %s\ntarget: %s\nuser id: %d\nstarted at: %s\nended at: %s\n\n",
+		data.Get("ID").MustInt(), data.Get("CMD").MustString(), data.Get("PARAMS").MustString(), data.Get("TARGET").MustString(),
+		data.Get("USER_ID").MustInt(), data.Get("STARTED_AT").MustString(), data.Get("ENDED_AT").MustString())
+	if status := data.Get("STATUS").MustString(); status != "" && status != "COMPLETED" {
+		fmt.Printf("status: %s\nreason: %s\n", status, data.Get("REASON").MustString())
+		return
+	}
+	t := table.New()
+	t.SetHeader([]string{"AGENT_ID", "AGENT_NAME", "STATUS", "DURATION", "ERROR", "OUTPUT"})
+	tableItems := [][]string{}
+	var results []struct {
+		AgentID   int    `json:"AGENT_ID"`
+		AgentName string `json:"AGENT_NAME"`
+		Status    string `json:"STATUS"`
+		Error     string `json:"ERROR"`
+		Output    string `json:"OUTPUT"`
+		Truncated bool   `json:"TRUNCATED"`
+		Duration  int64  `json:"DURATION"`
+	}
+	if err := json.Unmarshal([]byte(data.Get("RESULTS").MustString()), &results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	for _, result := range results {
+		out := firstLine(result.Output)
+		if result.Truncated || strings.Contains(result.Output, "\n") {
+			out += " ..."
+		}
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(result.AgentID),
+			result.AgentName,
+			result.Status,
+			(time.Duration(result.Duration) * time.Millisecond).String(),
+			firstLine(result.Error),
+			out,
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deepflowio/deepflow/cli/ctl/common"
+	"github.com/deepflowio/deepflow/cli/ctl/common/table"
+)
+
+func registerAgentRolloutCommand() *cobra.Command {
+	rollout := &cobra.Command{
+		Use:   "rollout",
+		Short: "upgrade the agents of an agent group in waves, with health gates and automatic pause or rollback",
+		Example: "deepflow-ctl agent rollout create --group default --image-name deepflow-agent-v7.1 --waves 1,10%,50%\n" +
+			"deepflow-ctl agent rollout status\n" +
+			"deepflow-ctl agent rollout status 3\n" +
+			"deepflow-ctl agent rollout pause 3\n" +
+			"deepflow-ctl agent rollout resume 3\n" +
+			"deepflow-ctl agent rollout abort 3 --rollback",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("please run with 'create | status | pause | resume | abort'.\nExample: %s\n", cmd.Example)
+		},
+	}
+
+	var group, imageName, waves string
+	var waveTimeout, soakTime, maxFailures int
+	var autoRollback bool
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "create an upgrade rollout of an agent group",
+		Example: "deepflow-ctl agent rollout create --group default --image-name deepflow-agent-v7.1\n" +
+			"deepflow-ctl agent rollout create --group default --image-name deepflow-agent-v7.1 --waves 2,25%,100% --max-failures 1 --auto-rollback",
+		Run: func(cmd *cobra.Command, args []string) {
+			if group == "" || imageName == "" {
+				fmt.Fprintf(os.Stderr, "must specify --group and --image-name.\nExample: %s\n", cmd.Example)
+				return
+			}
+			createAgentRollout(cmd, map[string]interface{}{
+				"AGENT_GROUP":   group,
+				"IMAGE_NAME":    imageName,
+				"WAVES":         waves,
+				"WAVE_TIMEOUT":  waveTimeout,
+				"SOAK_TIME":     soakTime,
+				"MAX_FAILURES":  maxFailures,
+				"AUTO_ROLLBACK": autoRollback,
+			})
+		},
+	}
+	create.Flags().StringVarP(&group, "group", "g", "", "agent group name, lcuuid or short uuid")
+	create.Flags().StringVarP(&imageName, "image-name", "", "", "agent image name in the agent repo")
+	create.Flags().StringVarP(&waves, "waves", "", "", "cumulative agent count or percentage upgraded after each wave, "+
+		"the first wave is the canary, server default 1,10%,50%,100% if empty")
+	create.Flags().IntVarP(&waveTimeout, "wave-timeout", "", 0, "seconds for the agents of a wave to be healthy, server default 600 if 0")
+	create.Flags().IntVarP(&soakTime, "soak-time", "", 0, "seconds to wait after all agents of a wave are healthy, server default 300 if 0")
+	create.Flags().IntVarP(&maxFailures, "max-failures", "", 0, "failed agents allowed before the rollout is paused or rolled back")
+	create.Flags().BoolVarP(&autoRollback, "auto-rollback", "", false, "roll back instead of pausing when max failures is exceeded")
+
+	var statusGroup, statusState, output string
+	status := &cobra.Command{
+		Use:   "status [id]",
+		Short: "list upgrade rollouts, or show the agents of one",
+		Example: "deepflow-ctl agent rollout status --group default --state RUNNING\n" +
+			"deepflow-ctl agent rollout status 3 -o yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				getAgentRollout(cmd, args[0], output)
+				return
+			}
+			listAgentRollouts(cmd, statusGroup, statusState, output)
+		},
+	}
+	status.Flags().StringVarP(&statusGroup, "group", "g", "", "filter by agent group name, lcuuid or short uuid")
+	status.Flags().StringVarP(&statusState, "state", "", "", "filter by state, RUNNING, PAUSED, COMPLETED, ABORTED, ROLLING_BACK or ROLLED_BACK")
+	status.Flags().StringVarP(&output, "output", "o", "", "output format, yaml or table (default)")
+
+	pause := &cobra.Command{
+		Use:     "pause <id>",
+		Short:   "pause a running upgrade rollout, the dispatched upgrades are not canceled",
+		Example: "deepflow-ctl agent rollout pause 3",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "must specify one rollout id.\nExample: %s\n", cmd.Example)
+				return
+			}
+			operateAgentRollout(cmd, args[0], "pause", nil)
+		},
+	}
+
+	resume := &cobra.Command{
+		Use:     "resume <id>",
+		Short:   "resume a paused upgrade rollout from the current wave, the failed agents are upgraded again",
+		Example: "deepflow-ctl agent rollout resume 3",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "must specify one rollout id.\nExample: %s\n", cmd.Example)
+				return
+			}
+			operateAgentRollout(cmd, args[0], "resume", nil)
+		},
+	}
+
+	var rollback bool
+	abort := &cobra.Command{
+		Use:   "abort <id>",
+		Short: "abort an upgrade rollout and cancel the unfinished upgrades",
+		Example: "deepflow-ctl agent rollout abort 3\n" +
+			"deepflow-ctl agent rollout abort 3 --rollback",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "must specify one rollout id.\nExample: %s\n", cmd.Example)
+				return
+			}
+			operateAgentRollout(cmd, args[0], "abort", map[string]interface{}{"ROLLBACK": rollback})
+		},
+	}
+	abort.Flags().BoolVarP(&rollback, "rollback", "", false, "roll back the upgraded agents to their previous revision")
+
+	rollout.AddCommand(create)
+	rollout.AddCommand(status)
+	rollout.AddCommand(pause)
+	rollout.AddCommand(resume)
+	rollout.AddCommand(abort)
+	return rollout
+}
+
+func createAgentRollout(cmd *cobra.Command, body map[string]interface{}) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agent-rollouts", server.IP, server.Port)
+	response, err := common.CURLPerform("POST", url, body, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	printAgentRollout(response.Get("DATA"))
+}
+
+func operateAgentRollout(cmd *cobra.Command, id, operation string, body map[string]interface{}) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agent-rollouts/%s/%s", server.IP, server.Port, id, operation)
+	response, err := common.CURLPerform("POST", url, body, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	printAgentRollout(response.Get("DATA"))
+}
+
+func listAgentRollouts(cmd *cobra.Command, group, state, output string) {
+	server := common.GetServerInfo(cmd)
+	query := url.Values{}
+	if group != "" {
+		query.Set("agent_group", group)
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	url := fmt.Sprintf("http://%s:%d/v1/agent-rollouts", server.IP, server.Port)
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if output == "yaml" {
+		dataJson, _ := response.Get("DATA").MarshalJSON()
+		dataYaml, _ := yaml.JSONToYAML(dataJson)
+		fmt.Print(string(dataYaml))
+		return
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"ID", "AGENT_GROUP", "IMAGE_NAME", "WAVES", "CURRENT_WAVE", "STATE", "UPDATED_AT", "MESSAGE"})
+	tableItems := [][]string{}
+	for i := range response.Get("DATA").MustArray() {
+		rollout := response.Get("DATA").GetIndex(i)
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(rollout.Get("ID").MustInt()),
+			rollout.Get("VTAP_GROUP_LCUUID").MustString(),
+			rollout.Get("IMAGE_NAME").MustString(),
+			rollout.Get("WAVES").MustString(),
+			strconv.Itoa(rollout.Get("CURRENT_WAVE").MustInt() + 1),
+			rollout.Get("STATE").MustString(),
+			rollout.Get("UPDATED_AT").MustString(),
+			firstLine(rollout.Get("MESSAGE").MustString()),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func getAgentRollout(cmd *cobra.Command, id string, output string) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/agent-rollouts/%s", server.IP, server.Port, id)
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data := response.Get("DATA")
+	if output == "yaml" {
+		dataJson, _ := data.MarshalJSON()
+		dataYaml, _ := yaml.JSONToYAML(dataJson)
+		fmt.Print(string(dataYaml))
+		return
+	}
+	printAgentRollout(data)
+}
+
+func printAgentRollout(data *simplejson.Json) {
+	fmt.Printf("id: %d\nagent group: %s\nimage name: %s\nexpected revision: %s\nwaves: %s\ncurrent wave: %d\n"+
+		"wave timeout: %ds\nsoak time: %ds\nmax failures: %d\nauto rollback: %t\nstate: %s\nmessage: %s\nupdated at: %s\n\n",
+		data.Get("ID").MustInt(), data.Get("VTAP_GROUP_LCUUID").MustString(), data.Get("IMAGE_NAME").MustString(),
+		data.Get("EXPECTED_REVISION").MustString(), data.Get("WAVES").MustString(), data.Get("CURRENT_WAVE").MustInt()+1,
+		data.Get("WAVE_TIMEOUT").MustInt(), data.Get("SOAK_TIME").MustInt(), data.Get("MAX_FAILURES").MustInt(),
+		data.Get("AUTO_ROLLBACK").MustInt() != 0, data.Get("STATE").MustString(), data.Get("MESSAGE").MustString(),
+		data.Get("UPDATED_AT").MustString())
+
+	var agents []struct {
+		ID               int    `json:"ID"`
+		Name             string `json:"NAME"`
+		Wave             int    `json:"WAVE"`
+		PreviousRevision string `json:"PREVIOUS_REVISION"`
+		Status           string `json:"STATUS"`
+		Error            string `json:"ERROR"`
+	}
+	if err := json.Unmarshal([]byte(data.Get("AGENTS").MustString()), &agents); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	t := table.New()
+	t.SetHeader([]string{"AGENT_ID", "AGENT_NAME", "WAVE", "PREVIOUS_REVISION", "STATUS", "ERROR"})
+	tableItems := [][]string{}
+	for _, agent := range agents {
+		wave := strconv.Itoa(agent.Wave + 1)
+		if agent.Status == "SKIPPED" {
+			wave = "-"
+		}
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(agent.ID),
+			agent.Name,
+			wave,
+			agent.PreviousRevision,
+			agent.Status,
+			firstLine(agent.Error),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
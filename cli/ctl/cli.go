@@ -44,7 +44,10 @@ func Execute(version string) {
 	root.PersistentFlags().Uint32P("svc-port", "", 20417, "deepflow-server service http port")
 	root.PersistentFlags().Uint32P("org-id", "", common.DEFAULT_ORG_ID, "organization id")
 	root.PersistentFlags().DurationP("timeout", "", time.Second*30, "deepflow-ctl timeout")
+	root.PersistentFlags().StringP("token", "", os.Getenv(common.ENV_API_TOKEN), "api token of deepflow-server, defaults to env "+common.ENV_API_TOKEN)
 	root.ParseFlags(os.Args[1:])
+	token, _ := root.PersistentFlags().GetString("token")
+	common.SetAPIToken(token)
 
 	// support output version
 	if outputVersion {
@@ -66,8 +69,10 @@ func Execute(version string) {
 	root.AddCommand(RegisterServerCommand())
 	root.AddCommand(RegisterRepoCommand())
 	root.AddCommand(RegisterPluginCommand())
+	root.AddCommand(RegisterTokenCommand())
 	root.AddCommand(RegisterPrometheusCommand())
 	root.AddCommand(RegisterPromQLCommand())
+	root.AddCommand(RegisterPcapCommand())
 	root.AddCommand(AgentCheckRegisterCommand())
 
 	cmd.RegisterIngesterCommand(root)
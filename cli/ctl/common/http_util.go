@@ -36,10 +36,30 @@ import (
 )
 
 const (
-	HEADER_KEY_X_ORG_ID = "X-Org-Id"
-	DEFAULT_ORG_ID      = 1
+	HEADER_KEY_X_ORG_ID      = "X-Org-Id"
+	HEADER_KEY_AUTHORIZATION = "Authorization"
+	// set by the querier if the downloaded pcapng is cut off by its limits
+	HEADER_KEY_X_PCAP_TRUNCATED = "X-Pcap-Truncated"
+	DEFAULT_ORG_ID              = 1
+
+	ENV_API_TOKEN = "DEEPFLOW_API_TOKEN"
 )
 
+// apiToken is sent as the bearer token of every request when the server enables api-auth
+var apiToken string
+
+func SetAPIToken(token string) {
+	apiToken = strings.TrimSpace(token)
+}
+
+func setUserHeader(req *http.Request) {
+	req.Header.Set("X-User-Id", "1")
+	req.Header.Set("X-User-Type", "1")
+	if apiToken != "" {
+		req.Header.Set(HEADER_KEY_AUTHORIZATION, "Bearer "+apiToken)
+	}
+}
+
 // Filter query string parameters
 type Filter map[string]interface{}
 
@@ -91,8 +111,7 @@ func CURLPerform(method string, url string, body map[string]interface{}, strBody
 	}
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", "application/json, text/plain")
-	req.Header.Set("X-User-Id", "1")
-	req.Header.Set("X-User-Type", "1")
+	setUserHeader(req)
 
 	return parseResponse(req, cfg)
 }
@@ -143,8 +162,7 @@ func CURLPostFormData(url, contentType string, body *bytes.Buffer, opts ...HTTPO
 	}
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", "application/json, text/plain")
-	req.Header.Set("X-User-Id", "1")
-	req.Header.Set("X-User-Type", "1")
+	setUserHeader(req)
 	req.Close = true
 
 	return parseResponse(req, cfg)
@@ -171,8 +189,7 @@ func CURLResponseRawJson(method string, url string, opts ...HTTPOption) (*simple
 		req.Header.Set(HEADER_KEY_X_ORG_ID, strconv.Itoa(cfg.ORGID))
 	}
 	req.Header.Set("Accept", "application/json, text/plain")
-	req.Header.Set("X-User-Id", "1")
-	req.Header.Set("X-User-Type", "1")
+	setUserHeader(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -198,6 +215,33 @@ func CURLResponseRawJson(method string, url string, opts ...HTTPOption) (*simple
 	return response, nil
 }
 
+// CURLStream sends a json request and returns the response for the caller to read, the timeout is only for the
+// response header, so that a large body is not cut off. The caller must close the response body.
+func CURLStream(method string, url string, body []byte, opts ...HTTPOption) (*http.Response, error) {
+	cfg := &HTTPConf{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ORGID != 0 {
+		req.Header.Set(HEADER_KEY_X_ORG_ID, strconv.Itoa(cfg.ORGID))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setUserHeader(req)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.Timeout
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("curl (%s) failed, (%v)", url, err))
+	}
+	return resp, nil
+}
+
 type Server struct {
 	IP      string
 	Port    uint32
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	simplejson "github.com/bitly/go-simplejson"
+	"github.com/spf13/cobra"
+
+	"github.com/deepflowio/deepflow/cli/ctl/common"
+)
+
+type pcapDownloadArgs struct {
+	FlowIDs    []uint64 `json:"flow_ids,omitempty"`
+	IP0        string   `json:"ip_0,omitempty"`
+	IP1        string   `json:"ip_1,omitempty"`
+	ClientPort uint16   `json:"client_port,omitempty"`
+	ServerPort uint16   `json:"server_port,omitempty"`
+	Protocol   uint8    `json:"protocol,omitempty"`
+	TimeStart  int64    `json:"time_start,omitempty"`
+	TimeEnd    int64    `json:"time_end,omitempty"`
+}
+
+func RegisterPcapCommand() *cobra.Command {
+	pcap := &cobra.Command{
+		Use:   "pcap",
+		Short: "pcap operation commands",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("please run with 'download'.\n")
+		},
+	}
+	pcap.PersistentFlags().Uint32P("querier-port", "", 30416, "deepflow-server querier node port")
+
+	var flowIDs []string
+	var downloadArgs pcapDownloadArgs
+	var output string
+	download := &cobra.Command{
+		Use:   "download",
+		Short: "download stored packets as a pcapng file",
+		Example: "deepflow-ctl pcap download --flow-ids 1234567,7654321 -o flows.pcapng\n" +
+			"deepflow-ctl pcap download --ip-0 10.1.1.1 --ip-1 10.1.1.2 --server-port 80 --protocol 6 --since 30m",
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, id := range flowIDs {
+				flowID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "invalid flow id %s\n", id)
+					return
+				}
+				downloadArgs.FlowIDs = append(downloadArgs.FlowIDs, flowID)
+			}
+			if len(downloadArgs.FlowIDs) == 0 && downloadArgs.IP0 == "" && downloadArgs.IP1 == "" {
+				fmt.Fprintln(os.Stderr, "please specify --flow-ids or --ip-0/--ip-1")
+				return
+			}
+			// flow ids are queried in the --since window as well, so that the stored packets are not scanned without a time range
+			from, to, err := getQueryTime(cmd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "parse time error: %v\n", err)
+				return
+			}
+			downloadArgs.TimeStart, downloadArgs.TimeEnd = from, to
+			if err := downloadPcap(cmd, &downloadArgs, output); err != nil {
+				fmt.Fprintf(os.Stderr, "pcap download error: %v\n", err)
+			}
+		},
+	}
+	download.Flags().StringSliceVarP(&flowIDs, "flow-ids", "", nil, "flow ids separated by commas")
+	download.Flags().StringVarP(&downloadArgs.IP0, "ip-0", "", "", "client ip, flows in both directions are matched")
+	download.Flags().StringVarP(&downloadArgs.IP1, "ip-1", "", "", "server ip, flows in both directions are matched")
+	download.Flags().Uint16VarP(&downloadArgs.ClientPort, "client-port", "", 0, "client port")
+	download.Flags().Uint16VarP(&downloadArgs.ServerPort, "server-port", "", 0, "server port")
+	download.Flags().Uint8VarP(&downloadArgs.Protocol, "protocol", "", 0, "ip protocol number, e.g.: 6 for TCP, 17 for UDP")
+	download.Flags().String("since", "1h", "download packets since time duration like [5s,1m,5m,1h], default: 1h")
+	download.Flags().String("from", "", "download packets from a specific time(RFC3339), e.g.: 2000-01-01T00:00:00Z")
+	download.Flags().String("to", "", "download packets to a specific time(RFC3339), e.g.: 2000-01-01T00:00:00Z")
+	download.Flags().StringVarP(&output, "output", "o", "", "output file, default: the file name given by server")
+
+	pcap.AddCommand(download)
+	return pcap
+}
+
+func downloadPcap(cmd *cobra.Command, args *pcapDownloadArgs, output string) error {
+	server := common.GetServerInfo(cmd)
+	querierPort, _ := cmd.Flags().GetUint32("querier-port")
+	url := fmt.Sprintf("http://%s:%d/v1/pcap/download", server.IP, querierPort)
+	body, _ := json.Marshal(args)
+	resp, err := common.CURLStream("POST", url, body, common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBytes, _ := io.ReadAll(resp.Body)
+		if response, err := simplejson.NewJson(respBytes); err == nil {
+			return errors.New(response.Get("DESCRIPTION").MustString())
+		}
+		return fmt.Errorf("curl (%s) failed, (%v)", url, string(respBytes))
+	}
+
+	if output == "" {
+		output = "deepflow.pcapng"
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+			// only the base name given by server is used, so that files outside the current directory are never written
+			if name := filepath.Base(params["filename"]); name != "." && name != "/" && name != ".." {
+				output = name
+			}
+		}
+	}
+
+	// write to a temporary file first, so that an interrupted download does not leave a truncated pcapng
+	tmpOutput := output + ".part"
+	file, err := os.Create(tmpOutput)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpOutput)
+		return fmt.Errorf("download interrupted after %d bytes, (%v)", n, err)
+	}
+	if err := os.Rename(tmpOutput, output); err != nil {
+		return err
+	}
+	fmt.Printf("saved %d bytes to %s\n", n, output)
+	if reason := resp.Header.Get(common.HEADER_KEY_X_PCAP_TRUNCATED); reason != "" {
+		fmt.Fprintf(os.Stderr, "warning: the pcapng file is truncated, %s, narrow the time range or flows to get all the packets\n", reason)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ctl
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deepflowio/deepflow/cli/ctl/common"
+	"github.com/deepflowio/deepflow/cli/ctl/common/jsonparser"
+)
+
+func RegisterTokenCommand() *cobra.Command {
+	token := &cobra.Command{
+		Use:   "token",
+		Short: "api token operation commands",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("please run with 'list | create | delete'.\n")
+		},
+	}
+
+	list := &cobra.Command{
+		Use:     "list",
+		Short:   "list api tokens",
+		Example: "deepflow-ctl token list",
+		Run: func(cmd *cobra.Command, args []string) {
+			listToken(cmd)
+		},
+	}
+
+	var name, role string
+	var expireDays int
+	var allOrgs bool
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "create api token, the token is only printed once",
+		Example: "deepflow-ctl token create --name grafana --role viewer\n" +
+			"deepflow-ctl token create --name ci --role operator --expire-days 90 --org-id 2\n" +
+			"deepflow-ctl token create --name ops --role admin --all-orgs",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := createToken(cmd, name, role, expireDays, allOrgs); err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+	create.Flags().StringVarP(&name, "name", "", "", "name of the token")
+	create.Flags().StringVarP(&role, "role", "", "viewer", "role of the token, the optional value is viewer/operator/admin")
+	create.Flags().IntVarP(&expireDays, "expire-days", "", 0, "the token expires after the days, 0 means never expire")
+	create.Flags().BoolVarP(&allOrgs, "all-orgs", "", false, "the token can access all orgs, only for admin role")
+	create.MarkFlagRequired("name")
+
+	delete := &cobra.Command{
+		Use:     "delete",
+		Short:   "delete api token",
+		Example: "deepflow-ctl token delete <lcuuid>\n(get lcuuid from command `deepflow-ctl token list`)",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := deleteToken(cmd, args); err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+
+	token.AddCommand(list)
+	token.AddCommand(create)
+	token.AddCommand(delete)
+	return token
+}
+
+func listToken(cmd *cobra.Command) {
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/api-tokens/", server.IP, server.Port)
+	response, err := common.CURLPerform("GET", url, nil, "", []common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	data := response.Get("DATA")
+	var (
+		nameMaxSize   = jsonparser.GetTheMaxSizeOfAttr(data, "NAME")
+		prefixMaxSize = jsonparser.GetTheMaxSizeOfAttr(data, "PREFIX")
+		roleMaxSize   = jsonparser.GetTheMaxSizeOfAttr(data, "ROLE")
+	)
+	cmdFormat := "%-*s %-*s %-*s %-6s %-25s %-25s %s\n"
+	fmt.Printf(cmdFormat, nameMaxSize, "NAME", prefixMaxSize, "PREFIX", roleMaxSize, "ROLE", "ORG_ID", "EXPIRED_AT", "LAST_USED_AT", "LCUUID")
+	for i := range data.MustArray() {
+		d := data.GetIndex(i)
+		fmt.Printf(cmdFormat,
+			nameMaxSize, d.Get("NAME").MustString(),
+			prefixMaxSize, d.Get("PREFIX").MustString(),
+			roleMaxSize, d.Get("ROLE").MustString(),
+			fmt.Sprint(d.Get("ORG_ID").MustInt()),
+			d.Get("EXPIRED_AT").MustString("-"),
+			d.Get("LAST_USED_AT").MustString("-"),
+			d.Get("LCUUID").MustString(),
+		)
+	}
+}
+
+func createToken(cmd *cobra.Command, name, role string, expireDays int, allOrgs bool) error {
+	body := map[string]interface{}{
+		"NAME":        name,
+		"ROLE":        role,
+		"EXPIRE_DAYS": expireDays,
+	}
+	if allOrgs {
+		body["ORG_ID"] = 0
+	}
+
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/api-tokens/", server.IP, server.Port)
+	response, err := common.CURLPerform("POST", url, body, "", []common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		return err
+	}
+	data := response.Get("DATA")
+	fmt.Printf("token: %s\n", data.Get("TOKEN").MustString())
+	fmt.Printf("lcuuid: %s\n", data.Get("LCUUID").MustString())
+	fmt.Println("please save the token, it can not be shown again")
+	return nil
+}
+
+func deleteToken(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("must specify lcuuid\nExample: %s", cmd.Example)
+	} else if len(args) > 1 {
+		return fmt.Errorf("must specify one lcuuid\nExample: %s", cmd.Example)
+	}
+
+	server := common.GetServerInfo(cmd)
+	url := fmt.Sprintf("http://%s:%d/v1/api-tokens/%s/", server.IP, server.Port, args[0])
+	_, err := common.CURLPerform("DELETE", url, nil, "", []common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	return err
+}
@@ -37,6 +37,12 @@ type Config struct {
 	MaxCPUs             int                 `yaml:"max-cpus"`
 	MonitorPaths        []string            `yaml:"monitor-paths"`
 	FreeOSMemoryManager FreeOSMemoryManager `yaml:"free-os-memory-manager"`
+	PrometheusExporter  PrometheusExporter  `yaml:"prometheus-exporter"`
+}
+
+type PrometheusExporter struct {
+	Enabled    bool `yaml:"enabled"`
+	ListenPort int  `yaml:"listen-port"`
 }
 
 type FreeOSMemoryManager struct {
@@ -67,6 +73,7 @@ func loadConfig(path string) *Config {
 		},
 		MonitorPaths:        []string{"/", "/mnt", "/var/log"},
 		FreeOSMemoryManager: FreeOSMemoryManager{false, DEFAULT_FREE_INTERVAL_SECOND},
+		PrometheusExporter:  PrometheusExporter{false, DEFAULT_PROMETHEUS_EXPORTER_PORT},
 	}
 	configBytes, err := os.ReadFile(path)
 	if err != nil {
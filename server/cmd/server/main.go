@@ -36,6 +36,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/logger"
+	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/mcp"
 	"github.com/deepflowio/deepflow/server/querier/querier"
 
@@ -50,7 +51,8 @@ func execName() string {
 var log = logging.MustGetLogger(execName())
 
 const (
-	PROFILER_PORT = 9526
+	PROFILER_PORT                    = 9526
+	DEFAULT_PROMETHEUS_EXPORTER_PORT = 9527
 )
 
 var flagSet = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -89,6 +91,9 @@ func main() {
 		runtime.SetBlockProfileRate(1)
 		profiler.Start()
 	}
+	if cfg.PrometheusExporter.Enabled {
+		stats.StartPrometheusExporter(fmt.Sprintf(":%d", cfg.PrometheusExporter.ListenPort))
+	}
 
 	if cfg.MaxCPUs > 0 {
 		runtime.GOMAXPROCS(cfg.MaxCPUs)
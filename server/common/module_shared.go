@@ -17,8 +17,10 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/libs/eventapi"
@@ -26,6 +28,7 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/tracetree"
 	logging "github.com/op/go-logging"
+	"github.com/prometheus/common/model"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -34,20 +37,59 @@ var log = logging.MustGetLogger("server_common")
 const QUEUE_SIZE = 1 << 16
 
 type ControllerIngesterShared struct {
-	ResourceEventQueue *queue.OverwriteQueue
-	TraceTreeQueue     *queue.OverwriteQueue
+	ResourceEventQueue *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]
+	TraceTreeQueue     *queue.TypedOverwriteQueue[*tracetree.TraceTree]
+	PrometheusQueue    *queue.TypedOverwriteQueue[*PrometheusWriteRequest]
+
+	prometheusTargetDiscovery atomic.Pointer[PrometheusTargetDiscovery]
+}
+
+// PrometheusWriteRequest is the prometheus samples generated by the server itself, such as the results of recording rules
+// and the samples scraped by the ingester
+type PrometheusWriteRequest struct {
+	OrgID      uint16
+	Compressed []byte // snappy compressed prompb.WriteRequest, same as prometheus remote write
+}
+
+const (
+	PROMETHEUS_TARGET_ROLE_POD     = "pod"
+	PROMETHEUS_TARGET_ROLE_SERVICE = "service"
+)
+
+// PrometheusTargetDiscovery returns the scrape targets of an org discovered from the pod/service inventory of the controller,
+// each target is a label set with __address__ and the __meta_kubernetes_* labels, the same as kubernetes_sd_configs of prometheus
+type PrometheusTargetDiscovery func(orgID uint16, role string) ([]model.LabelSet, error)
+
+var ErrPrometheusTargetDiscoveryNotReady = errors.New("prometheus target discovery of the controller is not ready")
+
+// SetPrometheusTargetDiscovery is called by the controller after its inventory is loaded
+func (s *ControllerIngesterShared) SetPrometheusTargetDiscovery(discovery PrometheusTargetDiscovery) {
+	s.prometheusTargetDiscovery.Store(&discovery)
+}
+
+func (s *ControllerIngesterShared) DiscoverPrometheusTargets(orgID uint16, role string) ([]model.LabelSet, error) {
+	discovery := s.prometheusTargetDiscovery.Load()
+	if discovery == nil {
+		return nil, ErrPrometheusTargetDiscoveryNotReady
+	}
+	return (*discovery)(orgID, role)
 }
 
 func NewControllerIngesterShared() *ControllerIngesterShared {
 	return &ControllerIngesterShared{
-		ResourceEventQueue: queue.NewOverwriteQueue(
+		ResourceEventQueue: queue.NewTypedOverwriteQueue[*eventapi.ResourceEvent](
 			"controller-to-ingester-resource_event", QUEUE_SIZE,
 			queue.OptionFlushIndicator(time.Second*3),
-			queue.OptionRelease(func(p interface{}) { p.(*eventapi.ResourceEvent).Release() })),
-		TraceTreeQueue: queue.NewOverwriteQueue(
+			func(e *eventapi.ResourceEvent) { e.Release() }),
+		TraceTreeQueue: queue.NewTypedOverwriteQueue[*tracetree.TraceTree](
 			"querier-to-ingester-trace_tree", QUEUE_SIZE,
 			queue.OptionFlushIndicator(time.Second*3),
-			queue.OptionRelease(func(p interface{}) { p.(*tracetree.TraceTree).Release() })),
+			func(t *tracetree.TraceTree) { t.Release() }),
+		// the results of recording rules and the scraped samples are not overwritten, the writers wait for the ingester
+		PrometheusQueue: queue.NewTypedOverwriteQueue[*PrometheusWriteRequest](
+			"querier-to-ingester-prometheus", QUEUE_SIZE,
+			queue.OptionFlushIndicator(time.Second*3),
+			queue.OptionOverflow{Policy: queue.OVERFLOW_BLOCK, BlockTimeout: time.Second}),
 	}
 }
 
@@ -67,6 +67,7 @@ type KubernetesGather struct {
 	nodeIPToLcuuid               map[string]string
 	namespaceToLcuuid            map[string]string
 	rsLcuuidToPodGroupLcuuid     map[string]string
+	jobLcuuidToPodGroupLcuuid    map[string]string
 	serviceLcuuidToIngressLcuuid map[string]string
 	k8sEntries                   map[string][][]byte
 	pgLcuuidToPSLcuuids          map[string][]string
@@ -208,6 +209,7 @@ func NewKubernetesGather(db *metadb.DB, domain *metadbmodel.Domain, subDomain *m
 		nodeIPToLcuuid:               map[string]string{},
 		namespaceToLcuuid:            map[string]string{},
 		rsLcuuidToPodGroupLcuuid:     map[string]string{},
+		jobLcuuidToPodGroupLcuuid:    map[string]string{},
 		serviceLcuuidToIngressLcuuid: map[string]string{},
 		k8sEntries:                   map[string][][]byte{},
 		pgLcuuidToPSLcuuids:          map[string][]string{},
@@ -335,6 +337,7 @@ func (k *KubernetesGather) GetKubernetesGatherData() (model.KubernetesGatherReso
 	k.nodeIPToLcuuid = map[string]string{}
 	k.namespaceToLcuuid = map[string]string{}
 	k.rsLcuuidToPodGroupLcuuid = map[string]string{}
+	k.jobLcuuidToPodGroupLcuuid = map[string]string{}
 	k.serviceLcuuidToIngressLcuuid = map[string]string{}
 	k.nsLabelToGroupLcuuids = map[string]mapset.Set{}
 	k.pgLcuuidToPSLcuuids = map[string][]string{}
@@ -410,6 +413,14 @@ func (k *KubernetesGather) GetKubernetesGatherData() (model.KubernetesGatherReso
 	podGroups = append(podGroups, podRCs...)
 	podGroupConfigMapConnections = append(podGroupConfigMapConnections, podRCsConfigMapConnections...)
 
+	podJobs, podJobsConfigMapConnections, err := k.getPodJobs()
+	if err != nil {
+		return model.KubernetesGatherResource{}, err
+	}
+
+	podGroups = append(podGroups, podJobs...)
+	podGroupConfigMapConnections = append(podGroupConfigMapConnections, podJobsConfigMapConnections...)
+
 	replicaSets, podRSCs, podRSCsConfigMapConnections, err := k.getReplicaSetsAndReplicaSetControllers()
 	if err != nil {
 		return model.KubernetesGatherResource{}, err
@@ -22,9 +22,11 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
+	mapset "github.com/deckarep/golang-set"
 	. "github.com/smartystreets/goconvey/convey"
 
 	cloudconfig "github.com/deepflowio/deepflow/server/controller/cloud/config"
@@ -119,3 +121,128 @@ func TestKubernetes(t *testing.T) {
 		})
 	})
 }
+
+func TestGetRouteIngresses(t *testing.T) {
+	Convey("TestGetRouteIngresses", t, func() {
+		var entries map[string][]json.RawMessage
+		routeJsonData, _ := os.ReadFile("./testfiles/gateway-routes.json")
+		json.Unmarshal(routeJsonData, &entries)
+		k8sEntries := map[string][][]byte{}
+		for key, items := range entries {
+			for _, item := range items {
+				k8sEntries[key] = append(k8sEntries[key], item)
+			}
+		}
+		k8s := &KubernetesGather{
+			k8sEntries:                   k8sEntries,
+			namespaceToLcuuid:            map[string]string{"default": "ns-default"},
+			serviceLcuuidToIngressLcuuid: map[string]string{},
+			nsServiceNameToService: map[string]map[string]map[string]int{
+				"defaultreviews":     {"svc-reviews": {"http": 9080}},
+				"defaultratings":     {"svc-ratings": {"http": 9080}},
+				"defaultproductpage": {"svc-productpage": {"http": 9080}},
+				"defaultgrpc-echo":   {"svc-grpc-echo": {"grpc": 50051}},
+			},
+		}
+
+		ingresses, ingressRules, ingressRuleBackends, err := k8s.getPodIngresses()
+		So(err, ShouldBeNil)
+		So(len(ingresses), ShouldEqual, 3)
+		So(len(ingressRules), ShouldEqual, 3)
+		So(len(ingressRuleBackends), ShouldEqual, 6)
+
+		protocols := map[string]string{}
+		for _, rule := range ingressRules {
+			protocols[rule.Host] = rule.Protocol
+		}
+		So(protocols, ShouldResemble, map[string]string{"bookinfo.example.com": "HTTP", "": "GRPC", "istio.example.com": "HTTPS"})
+
+		weights := map[string]int{}
+		for _, backend := range ingressRuleBackends {
+			So(backend.Port, ShouldBeGreaterThan, 0)
+			weights[backend.PodServiceLcuuid+backend.Path] = backend.Weight
+		}
+		So(weights, ShouldResemble, map[string]int{
+			"svc-reviews/reviews":         90,
+			"svc-ratings/reviews":         10,
+			"svc-productpage/":            1,
+			"svc-grpc-echo/echo.Echo/Say": 1,
+			"svc-productpage/productpage": 100,
+			"svc-productpage/login":       100,
+		})
+		So(k8s.serviceLcuuidToIngressLcuuid, ShouldContainKey, "svc-grpc-echo")
+	})
+}
+
+func TestGetPodJobs(t *testing.T) {
+	Convey("TestGetPodJobs", t, func() {
+		var entries map[string][]json.RawMessage
+		jobJsonData, _ := os.ReadFile("./testfiles/jobs.json")
+		json.Unmarshal(jobJsonData, &entries)
+		k8sEntries := map[string][][]byte{}
+		for key, items := range entries {
+			for _, item := range items {
+				k8sEntries[key] = append(k8sEntries[key], item)
+			}
+		}
+		newK8s := func(k8sEntries map[string][][]byte) *KubernetesGather {
+			return &KubernetesGather{
+				k8sEntries:                k8sEntries,
+				namespaceToLcuuid:         map[string]string{"default": "ns-default"},
+				nsLabelToGroupLcuuids:     map[string]mapset.Set{},
+				pgLcuuidTopodTargetPorts:  map[string]map[string]int{},
+				jobLcuuidToPodGroupLcuuid: map[string]string{},
+				podGroupLcuuids:           mapset.NewSet(),
+			}
+		}
+		k8s := newK8s(k8sEntries)
+
+		podJobs, _, err := k8s.getPodJobs()
+		So(err, ShouldBeNil)
+		So(len(podJobs), ShouldEqual, 3)
+
+		types := map[string]int{}
+		for _, podJob := range podJobs {
+			types[podJob.Name] = podJob.Type
+		}
+		So(types, ShouldResemble, map[string]int{
+			"backup":  common.POD_GROUP_CRON_JOB,
+			"report":  common.POD_GROUP_CRON_JOB,
+			"migrate": common.POD_GROUP_JOB,
+		})
+
+		backupLcuuid := common.IDGenerateUUID(k8s.orgID, "cronjob-backup-uid")
+		So(k8s.jobLcuuidToPodGroupLcuuid[common.IDGenerateUUID(k8s.orgID, "job-backup-1-uid")], ShouldEqual, backupLcuuid)
+		So(k8s.jobLcuuidToPodGroupLcuuid[common.IDGenerateUUID(k8s.orgID, "job-backup-2-uid")], ShouldEqual, backupLcuuid)
+		So(k8s.jobLcuuidToPodGroupLcuuid, ShouldNotContainKey, common.IDGenerateUUID(k8s.orgID, "job-migrate-uid"))
+		So(k8s.pgLcuuidTopodTargetPorts[backupLcuuid], ShouldResemble, map[string]int{"metrics": 9100})
+
+		for _, podJob := range podJobs {
+			switch podJob.Name {
+			case "backup":
+				So(podJob.Metadata, ShouldContainSubstring, `"jobRuns":[{"name":"backup-28000005"`)
+			case "migrate":
+				So(podJob.PodNum, ShouldEqual, 2)
+				So(podJob.NetworkMode, ShouldEqual, common.POD_GROUP_HOST_NETWORK)
+			}
+		}
+
+		// the job runs are not in the metadata hash
+		var jobs [][]byte
+		for _, job := range k8sEntries["*v1.Job"] {
+			if !strings.Contains(string(job), "job-backup-1-uid") {
+				jobs = append(jobs, job)
+			}
+		}
+		k8sEntries["*v1.Job"] = jobs
+		newPodJobs, _, err := newK8s(k8sEntries).getPodJobs()
+		So(err, ShouldBeNil)
+		for i, podJob := range newPodJobs {
+			So(podJob.Name, ShouldEqual, podJobs[i].Name)
+			So(podJob.MetadataHash, ShouldEqual, podJobs[i].MetadataHash)
+			if podJob.Name == "backup" {
+				So(podJob.Metadata, ShouldNotEqual, podJobs[i].Metadata)
+			}
+		}
+	})
+}
@@ -40,6 +40,7 @@ func (k *KubernetesGather) getPods() (pods []model.Pod, err error) {
 		"StatefulSetPlus":       false,
 		"OpenGaussCluster":      false,
 		"ReplicationController": false,
+		"Job":                   false,
 	}
 	for _, p := range k.k8sEntries["*v1.Pod"] {
 		pData, pErr := simplejson.NewJson(p)
@@ -99,6 +100,9 @@ func (k *KubernetesGather) getPods() (pods []model.Pod, err error) {
 		if gLcuuid, ok := k.rsLcuuidToPodGroupLcuuid[pgLcuuid]; ok {
 			podRSLcuuid = pgLcuuid
 			podGroupLcuuid = gLcuuid
+		} else if gLcuuid, ok := k.jobLcuuidToPodGroupLcuuid[pgLcuuid]; ok {
+			// pods of the jobs created by a cronjob belong to the cronjob
+			podGroupLcuuid = gLcuuid
 		} else {
 			if !k.podGroupLcuuids.Contains(pgLcuuid) {
 				log.Debugf("pod (%s) pod group not found", name, logger.NewORGPrefix(k.orgID))
@@ -44,6 +44,8 @@ func (k *KubernetesGather) getPodGroups() (podGroups []model.PodGroup, podGroupC
 		"daemonset":             common.POD_GROUP_DAEMON_SET,
 		"replicationcontroller": common.POD_GROUP_RC,
 		"cloneset":              common.POD_GROUP_CLONESET,
+		"job":                   common.POD_GROUP_JOB,
+		"cronjob":               common.POD_GROUP_CRON_JOB,
 	}
 	for t, podController := range podControllers {
 		for _, c := range podController {
@@ -248,6 +248,19 @@ func (k *KubernetesGather) getPodIngresses() (ingresses []model.PodIngress, ingr
 			ingressRuleBackends = append(ingressRuleBackends, ingressRuleBackend)
 		}
 	}
+
+	for _, getRouteIngresses := range []func() ([]model.PodIngress, []model.PodIngressRule, []model.PodIngressRuleBackend, error){
+		k.getGatewayRouteIngresses, k.getIstioIngresses,
+	} {
+		routeIngresses, routeIngressRules, routeIngressRuleBackends, routeErr := getRouteIngresses()
+		if routeErr != nil {
+			err = routeErr
+			return
+		}
+		ingresses = append(ingresses, routeIngresses...)
+		ingressRules = append(ingressRules, routeIngressRules...)
+		ingressRuleBackends = append(ingressRuleBackends, routeIngressRuleBackends...)
+	}
 	log.Debug("get ingresses complete", logger.NewORGPrefix(k.orgID))
 	return
 }
@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes_gather
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// gateway api routes, the same route may be served by several api versions
+var gatewayRouteKinds = []struct {
+	entryKey string
+	protocol string
+}{
+	{"*v1.HTTPRoute", "HTTP"},
+	{"*v1beta1.HTTPRoute", "HTTP"},
+	{"*v1.GRPCRoute", "GRPC"},
+	{"*v1alpha2.GRPCRoute", "GRPC"},
+}
+
+var istioVirtualServiceEntryKeys = []string{"*v1.VirtualService", "*v1beta1.VirtualService", "*v1alpha3.VirtualService"}
+
+// gateway api and istio both have a Gateway kind, istio gateways are the ones with spec.servers
+var istioGatewayEntryKeys = []string{"*v1.Gateway", "*v1beta1.Gateway", "*v1alpha3.Gateway"}
+
+type routeIngressInfo struct {
+	uID             string
+	lcuuid          string
+	name            string
+	namespace       string
+	namespaceLcuuid string
+}
+
+func (k *KubernetesGather) getRouteIngressInfo(data *simplejson.Json, resource string) (routeIngressInfo, bool) {
+	metaData, ok := data.CheckGet("metadata")
+	if !ok {
+		log.Infof("%s metadata not found", resource, logger.NewORGPrefix(k.orgID))
+		return routeIngressInfo{}, false
+	}
+	uID := metaData.Get("uid").MustString()
+	if uID == "" {
+		log.Infof("%s uid not found", resource, logger.NewORGPrefix(k.orgID))
+		return routeIngressInfo{}, false
+	}
+	name := metaData.Get("name").MustString()
+	if name == "" {
+		log.Infof("%s (%s) name not found", resource, uID, logger.NewORGPrefix(k.orgID))
+		return routeIngressInfo{}, false
+	}
+	namespace := metaData.Get("namespace").MustString()
+	namespaceLcuuid, ok := k.namespaceToLcuuid[namespace]
+	if !ok {
+		log.Infof("%s (%s) namespace not found", resource, name, logger.NewORGPrefix(k.orgID))
+		return routeIngressInfo{}, false
+	}
+	return routeIngressInfo{
+		uID:             uID,
+		lcuuid:          common.IDGenerateUUID(k.orgID, uID),
+		name:            name,
+		namespace:       namespace,
+		namespaceLcuuid: namespaceLcuuid,
+	}, true
+}
+
+func (k *KubernetesGather) newRouteIngress(info routeIngressInfo) model.PodIngress {
+	return model.PodIngress{
+		Lcuuid:             info.lcuuid,
+		Name:               info.name,
+		PodNamespaceLcuuid: info.namespaceLcuuid,
+		AZLcuuid:           k.azLcuuid,
+		RegionLcuuid:       k.RegionUUID,
+		PodClusterLcuuid:   k.podClusterLcuuid,
+	}
+}
+
+// newRouteIngressRuleBackend associates the backend service with the ingress, port 0 means the only port of the service
+func (k *KubernetesGather) newRouteIngressRuleBackend(info routeIngressInfo, ruleLcuuid, routeIndex, namespace, serviceName string, port, weight int, path string) (model.PodIngressRuleBackend, bool) {
+	service, ok := k.nsServiceNameToService[namespace+serviceName]
+	if !ok {
+		log.Infof("ingress (%s) backend service (%s/%s) not found", info.name, namespace, serviceName, logger.NewORGPrefix(k.orgID))
+		return model.PodIngressRuleBackend{}, false
+	}
+	serviceLcuuid, ports := "", map[string]int{}
+	for key, v := range service {
+		serviceLcuuid = key
+		ports = v
+		break
+	}
+	if ingressLcuuid, ok := k.serviceLcuuidToIngressLcuuid[serviceLcuuid]; ok && ingressLcuuid != info.lcuuid {
+		log.Infof("ingress (%s) is already associated with the service (%s), and ingress (%s) cannot be associated", ingressLcuuid, serviceLcuuid, info.uID, logger.NewORGPrefix(k.orgID))
+	} else {
+		k.serviceLcuuidToIngressLcuuid[serviceLcuuid] = info.lcuuid
+	}
+	if port == 0 && len(ports) == 1 {
+		for _, p := range ports {
+			port = p
+		}
+	}
+	if port == 0 {
+		log.Infof("ingress (%s) backend service (%s) no servicePort", info.uID, serviceName, logger.NewORGPrefix(k.orgID))
+		return model.PodIngressRuleBackend{}, false
+	}
+	// the fields are joined with a separator, so that different backends never share a key, e.g. routes 1 and 11
+	key := strings.Join([]string{ruleLcuuid, routeIndex, namespace, serviceName, strconv.Itoa(port), path}, "_")
+	return model.PodIngressRuleBackend{
+		Lcuuid:               common.GetUUIDByOrgID(k.orgID, key),
+		Path:                 path,
+		Port:                 port,
+		Weight:               weight,
+		PodServiceLcuuid:     serviceLcuuid,
+		PodIngressRuleLcuuid: ruleLcuuid,
+		PodIngressLcuuid:     info.lcuuid,
+	}, true
+}
+
+// getGatewayRouteIngresses converts gateway api HTTPRoute and GRPCRoute to ingresses, a rule is generated for each hostname
+func (k *KubernetesGather) getGatewayRouteIngresses() (ingresses []model.PodIngress, ingressRules []model.PodIngressRule, ingressRuleBackends []model.PodIngressRuleBackend, err error) {
+	uIDs := map[string]bool{}
+	for _, kind := range gatewayRouteKinds {
+		for _, r := range k.k8sEntries[kind.entryKey] {
+			rData, rErr := simplejson.NewJson(r)
+			if rErr != nil {
+				err = rErr
+				log.Errorf("gateway route initialization simplejson error: (%s)", rErr.Error(), logger.NewORGPrefix(k.orgID))
+				return
+			}
+			info, ok := k.getRouteIngressInfo(rData, "gateway route")
+			if !ok || uIDs[info.uID] {
+				continue
+			}
+			uIDs[info.uID] = true
+			ingresses = append(ingresses, k.newRouteIngress(info))
+
+			spec := rData.Get("spec")
+			hostnames := spec.Get("hostnames").MustStringArray()
+			if len(hostnames) == 0 {
+				hostnames = []string{""}
+			}
+			rules := spec.Get("rules")
+			for h, host := range hostnames {
+				ruleLcuuid := common.GetUUIDByOrgID(k.orgID, info.lcuuid+host+"_"+strconv.Itoa(h))
+				ingressRules = append(ingressRules, model.PodIngressRule{
+					Lcuuid:           ruleLcuuid,
+					Host:             host,
+					Protocol:         kind.protocol,
+					PodIngressLcuuid: info.lcuuid,
+				})
+				for index := range rules.MustArray() {
+					rule := rules.GetIndex(index)
+					paths := gatewayRoutePaths(rule, kind.protocol)
+					backendRefs := rule.Get("backendRefs")
+					for b := range backendRefs.MustArray() {
+						backendRef := backendRefs.GetIndex(b)
+						if refKind := backendRef.Get("kind").MustString("Service"); refKind != "Service" {
+							log.Debugf("gateway route (%s) backend kind (%s) not supported", info.name, refKind, logger.NewORGPrefix(k.orgID))
+							continue
+						}
+						namespace := backendRef.Get("namespace").MustString(info.namespace)
+						serviceName := backendRef.Get("name").MustString()
+						port := backendRef.Get("port").MustInt()
+						weight := backendRef.Get("weight").MustInt(1)
+						for _, path := range paths {
+							backend, ok := k.newRouteIngressRuleBackend(info, ruleLcuuid, strconv.Itoa(index), namespace, serviceName, port, weight, path)
+							if !ok {
+								continue
+							}
+							ingressRuleBackends = append(ingressRuleBackends, backend)
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func gatewayRoutePaths(rule *simplejson.Json, protocol string) []string {
+	paths := []string{}
+	matches := rule.Get("matches")
+	for m := range matches.MustArray() {
+		match := matches.GetIndex(m)
+		switch protocol {
+		case "GRPC":
+			method, ok := match.CheckGet("method")
+			if !ok {
+				continue
+			}
+			service := method.Get("service").MustString()
+			if service == "" {
+				continue
+			}
+			paths = append(paths, "/"+service+"/"+method.Get("method").MustString())
+		default:
+			if path := match.Get("path").Get("value").MustString(); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		if protocol == "GRPC" {
+			return []string{""}
+		}
+		// default match of HTTPRoute is prefix "/"
+		return []string{"/"}
+	}
+	return paths
+}
+
+// getIstioGatewayProtocols returns the protocols of istio gateway servers by "namespace/name", the key of the inner map is host
+func (k *KubernetesGather) getIstioGatewayProtocols() map[string]map[string]string {
+	gatewayProtocols := map[string]map[string]string{}
+	for _, entryKey := range istioGatewayEntryKeys {
+		for _, g := range k.k8sEntries[entryKey] {
+			gData, gErr := simplejson.NewJson(g)
+			if gErr != nil {
+				log.Warningf("istio gateway initialization simplejson error: (%s)", gErr.Error(), logger.NewORGPrefix(k.orgID))
+				continue
+			}
+			servers, ok := gData.Get("spec").CheckGet("servers")
+			if !ok {
+				continue
+			}
+			metaData := gData.Get("metadata")
+			key := metaData.Get("namespace").MustString() + "/" + metaData.Get("name").MustString()
+			hostProtocols := map[string]string{}
+			for s := range servers.MustArray() {
+				server := servers.GetIndex(s)
+				protocol := strings.ToUpper(server.Get("port").Get("protocol").MustString())
+				if protocol == "" {
+					continue
+				}
+				for _, host := range server.Get("hosts").MustStringArray() {
+					// host may be in the form of "namespace/host"
+					if i := strings.Index(host, "/"); i >= 0 {
+						host = host[i+1:]
+					}
+					if _, ok := hostProtocols[host]; !ok {
+						hostProtocols[host] = protocol
+					}
+				}
+			}
+			gatewayProtocols[key] = hostProtocols
+		}
+	}
+	return gatewayProtocols
+}
+
+func istioHTTPProtocol(gatewayProtocols map[string]map[string]string, namespace string, gateways []string, host string) string {
+	for _, gateway := range gateways {
+		if !strings.Contains(gateway, "/") {
+			gateway = namespace + "/" + gateway
+		}
+		hostProtocols := gatewayProtocols[gateway]
+		for _, h := range []string{host, "*"} {
+			switch protocol := hostProtocols[h]; protocol {
+			case "HTTP", "HTTPS", "HTTP2", "GRPC":
+				return protocol
+			}
+		}
+	}
+	return "HTTP"
+}
+
+// istioDestination parses the destination host, which may be a short name or the FQDN of a service
+func istioDestination(host, namespace string) (string, string) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 1 {
+		return parts[0], parts[1]
+	}
+	return host, namespace
+}
+
+func istioRoutePaths(route *simplejson.Json) []string {
+	paths := []string{}
+	matches := route.Get("match")
+	for m := range matches.MustArray() {
+		uri := matches.GetIndex(m).Get("uri")
+		for _, matchType := range []string{"exact", "prefix", "regex"} {
+			if path := uri.Get(matchType).MustString(); path != "" {
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return []string{""}
+	}
+	return paths
+}
+
+// getIstioIngresses converts istio VirtualServices bound to gateways to ingresses,
+// a rule is generated for each host and route type (http/tls/tcp)
+func (k *KubernetesGather) getIstioIngresses() (ingresses []model.PodIngress, ingressRules []model.PodIngressRule, ingressRuleBackends []model.PodIngressRuleBackend, err error) {
+	gatewayProtocols := k.getIstioGatewayProtocols()
+	uIDs := map[string]bool{}
+	for _, entryKey := range istioVirtualServiceEntryKeys {
+		for _, v := range k.k8sEntries[entryKey] {
+			vData, vErr := simplejson.NewJson(v)
+			if vErr != nil {
+				err = vErr
+				log.Errorf("virtual service initialization simplejson error: (%s)", vErr.Error(), logger.NewORGPrefix(k.orgID))
+				return
+			}
+			info, ok := k.getRouteIngressInfo(vData, "virtual service")
+			if !ok || uIDs[info.uID] {
+				continue
+			}
+			spec := vData.Get("spec")
+			gateways := []string{}
+			for _, gateway := range spec.Get("gateways").MustStringArray() {
+				if gateway != "mesh" {
+					gateways = append(gateways, gateway)
+				}
+			}
+			if len(gateways) == 0 {
+				log.Debugf("virtual service (%s) is not bound to any gateway", info.name, logger.NewORGPrefix(k.orgID))
+				continue
+			}
+			uIDs[info.uID] = true
+			ingresses = append(ingresses, k.newRouteIngress(info))
+
+			hosts := spec.Get("hosts").MustStringArray()
+			if len(hosts) == 0 {
+				hosts = []string{""}
+			}
+			for _, routeType := range []string{"http", "tls", "tcp"} {
+				routes, ok := spec.CheckGet(routeType)
+				if !ok || len(routes.MustArray()) == 0 {
+					continue
+				}
+				for _, host := range hosts {
+					protocol := strings.ToUpper(routeType)
+					if routeType == "http" {
+						protocol = istioHTTPProtocol(gatewayProtocols, info.namespace, gateways, host)
+					}
+					ruleLcuuid := common.GetUUIDByOrgID(k.orgID, info.lcuuid+host+"_"+routeType)
+					ingressRules = append(ingressRules, model.PodIngressRule{
+						Lcuuid:           ruleLcuuid,
+						Host:             host,
+						Protocol:         protocol,
+						PodIngressLcuuid: info.lcuuid,
+					})
+					for index := range routes.MustArray() {
+						route := routes.GetIndex(index)
+						paths := []string{""}
+						if routeType == "http" {
+							paths = istioRoutePaths(route)
+						}
+						destinations := route.Get("route")
+						for d := range destinations.MustArray() {
+							destination := destinations.GetIndex(d)
+							serviceName, namespace := istioDestination(destination.Get("destination").Get("host").MustString(), info.namespace)
+							port := destination.Get("destination").Get("port").Get("number").MustInt()
+							// weight is optional when there is only one destination
+							weight := destination.Get("weight").MustInt()
+							if weight == 0 && len(destinations.MustArray()) == 1 {
+								weight = 100
+							}
+							for _, path := range paths {
+								backend, ok := k.newRouteIngressRuleBackend(info, ruleLcuuid, strconv.Itoa(index), namespace, serviceName, port, weight, path)
+								if !ok {
+									continue
+								}
+								ingressRuleBackends = append(ingressRuleBackends, backend)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
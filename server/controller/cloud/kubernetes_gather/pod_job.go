@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes_gather
+
+import (
+	"sort"
+
+	"github.com/bitly/go-simplejson"
+	mapset "github.com/deckarep/golang-set"
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// the latest job runs kept in the metadata of a cronjob pod group
+const cronJobRunsMax = 10
+
+type jobRun struct {
+	Name           string `json:"name"`
+	UID            string `json:"uid"`
+	StartTime      string `json:"startTime,omitempty"`
+	CompletionTime string `json:"completionTime,omitempty"`
+	Active         int    `json:"active"`
+	Succeeded      int    `json:"succeeded"`
+	Failed         int    `json:"failed"`
+}
+
+type jobGroup struct {
+	uID         string
+	name        string
+	namespace   string
+	serviceType int
+	metaData    *simplejson.Json
+	// job spec, the template of pods is in spec.template
+	spec *simplejson.Json
+	runs []jobRun
+}
+
+func newJobRun(metaData, status *simplejson.Json) jobRun {
+	return jobRun{
+		Name:           metaData.Get("name").MustString(),
+		UID:            metaData.Get("uid").MustString(),
+		StartTime:      status.Get("startTime").MustString(),
+		CompletionTime: status.Get("completionTime").MustString(),
+		Active:         status.Get("active").MustInt(),
+		Succeeded:      status.Get("succeeded").MustInt(),
+		Failed:         status.Get("failed").MustInt(),
+	}
+}
+
+// getPodJobs generates pod groups for cronjobs and the jobs not created by cronjobs, each run of a cronjob
+// creates a new job, so the pods of these jobs are gathered to the cronjob to keep a stable pod group
+func (k *KubernetesGather) getPodJobs() (podJobs []model.PodGroup, podGroupConfigMapConnections []model.PodGroupConfigMapConnection, err error) {
+	log.Debug("get jobs starting", logger.NewORGPrefix(k.orgID))
+	groups := []*jobGroup{}
+	cronJobs := map[string]*jobGroup{}
+	for _, c := range k.k8sEntries["*v1.CronJob"] {
+		cData, cErr := simplejson.NewJson(c)
+		if cErr != nil {
+			err = cErr
+			log.Errorf("cronjob initialization simplejson error: (%s)", cErr.Error(), logger.NewORGPrefix(k.orgID))
+			return
+		}
+		metaData, ok := cData.CheckGet("metadata")
+		if !ok {
+			log.Info("cronjob metadata not found", logger.NewORGPrefix(k.orgID))
+			continue
+		}
+		uID := metaData.Get("uid").MustString()
+		if uID == "" {
+			log.Info("cronjob uid not found", logger.NewORGPrefix(k.orgID))
+			continue
+		}
+		group := &jobGroup{
+			uID:         uID,
+			name:        metaData.Get("name").MustString(),
+			namespace:   metaData.Get("namespace").MustString(),
+			serviceType: common.POD_GROUP_CRON_JOB,
+			metaData:    metaData,
+			spec:        cData.GetPath("spec", "jobTemplate", "spec"),
+		}
+		groups = append(groups, group)
+		cronJobs[uID] = group
+	}
+
+	for _, j := range k.k8sEntries["*v1.Job"] {
+		jData, jErr := simplejson.NewJson(j)
+		if jErr != nil {
+			err = jErr
+			log.Errorf("job initialization simplejson error: (%s)", jErr.Error(), logger.NewORGPrefix(k.orgID))
+			return
+		}
+		metaData, ok := jData.CheckGet("metadata")
+		if !ok {
+			log.Info("job metadata not found", logger.NewORGPrefix(k.orgID))
+			continue
+		}
+		uID := metaData.Get("uid").MustString()
+		if uID == "" {
+			log.Info("job uid not found", logger.NewORGPrefix(k.orgID))
+			continue
+		}
+		run := newJobRun(metaData, jData.Get("status"))
+		owner := metaData.Get("ownerReferences").GetIndex(0)
+		if owner.Get("kind").MustString() != "CronJob" || owner.Get("uid").MustString() == "" {
+			groups = append(groups, &jobGroup{
+				uID:         uID,
+				name:        run.Name,
+				namespace:   metaData.Get("namespace").MustString(),
+				serviceType: common.POD_GROUP_JOB,
+				metaData:    metaData,
+				spec:        jData.Get("spec"),
+				runs:        []jobRun{run},
+			})
+			continue
+		}
+
+		cronJobUID := owner.Get("uid").MustString()
+		group, ok := cronJobs[cronJobUID]
+		if !ok {
+			// cronjobs are not watched, the pod group is built from the owner reference and the job template
+			cronJobMetaData := simplejson.New()
+			cronJobMetaData.Set("name", owner.Get("name").MustString())
+			cronJobMetaData.Set("namespace", metaData.Get("namespace").MustString())
+			cronJobMetaData.Set("uid", cronJobUID)
+			group = &jobGroup{
+				uID:         cronJobUID,
+				name:        owner.Get("name").MustString(),
+				namespace:   metaData.Get("namespace").MustString(),
+				serviceType: common.POD_GROUP_CRON_JOB,
+				metaData:    cronJobMetaData,
+				spec:        jData.Get("spec"),
+			}
+			groups = append(groups, group)
+			cronJobs[cronJobUID] = group
+		}
+		group.runs = append(group.runs, run)
+		k.jobLcuuidToPodGroupLcuuid[common.IDGenerateUUID(k.orgID, uID)] = common.IDGenerateUUID(k.orgID, cronJobUID)
+	}
+
+	for _, group := range groups {
+		podJob, connections, ok := k.newJobPodGroup(group)
+		if !ok {
+			continue
+		}
+		podJobs = append(podJobs, podJob)
+		podGroupConfigMapConnections = append(podGroupConfigMapConnections, connections...)
+	}
+	log.Debug("get jobs complete", logger.NewORGPrefix(k.orgID))
+	return
+}
+
+func (k *KubernetesGather) newJobPodGroup(group *jobGroup) (model.PodGroup, []model.PodGroupConfigMapConnection, bool) {
+	if group.name == "" {
+		log.Infof("job (%s) name not found", group.uID, logger.NewORGPrefix(k.orgID))
+		return model.PodGroup{}, nil, false
+	}
+	namespaceLcuuid, ok := k.namespaceToLcuuid[group.namespace]
+	if !ok {
+		log.Infof("job (%s) namespace not found", group.name, logger.NewORGPrefix(k.orgID))
+		return model.PodGroup{}, nil, false
+	}
+	uLcuuid := common.IDGenerateUUID(k.orgID, group.uID)
+	label := "job:" + group.namespace + ":" + group.name
+	if group.serviceType == common.POD_GROUP_CRON_JOB {
+		label = "cronjob:" + group.namespace + ":" + group.name
+	}
+	_, ok = k.nsLabelToGroupLcuuids[group.namespace+label]
+	if ok {
+		k.nsLabelToGroupLcuuids[group.namespace+label].Add(uLcuuid)
+	} else {
+		jobLcuuidsSet := mapset.NewSet()
+		jobLcuuidsSet.Add(uLcuuid)
+		k.nsLabelToGroupLcuuids[group.namespace+label] = jobLcuuidsSet
+	}
+	spec := group.spec
+	labels := spec.GetPath("template", "metadata", "labels").MustMap()
+	for key, v := range labels {
+		vString, ok := v.(string)
+		if !ok {
+			continue
+		}
+		nsLabel := group.namespace + key + "_" + vString
+		_, ok = k.nsLabelToGroupLcuuids[nsLabel]
+		if ok {
+			k.nsLabelToGroupLcuuids[nsLabel].Add(uLcuuid)
+		} else {
+			nsJobLcuuidsSet := mapset.NewSet()
+			nsJobLcuuidsSet.Add(uLcuuid)
+			k.nsLabelToGroupLcuuids[nsLabel] = nsJobLcuuidsSet
+		}
+	}
+	podTargetPorts := map[string]int{}
+	containers := spec.GetPath("template", "spec", "containers")
+	for i := range containers.MustArray() {
+		container := containers.GetIndex(i)
+		cPorts, ok := container.CheckGet("ports")
+		if !ok {
+			continue
+		}
+		for j := range cPorts.MustArray() {
+			cPort := cPorts.GetIndex(j)
+			cPortName, err := cPort.Get("name").String()
+			if err != nil {
+				continue
+			}
+			podTargetPorts[cPortName] = cPort.Get("containerPort").MustInt()
+		}
+	}
+	networkMode := common.POD_GROUP_POD_NETWORK
+	if spec.GetPath("template", "spec", "hostNetwork").MustBool() {
+		networkMode = common.POD_GROUP_HOST_NETWORK
+	}
+
+	// the latest runs are kept in metadata, but not in the metadata hash, otherwise every run of a cronjob is
+	// recorded as a change of the pod group. The runs are saved with the other changes of metadata.
+	metaDataHash := cloudcommon.GenerateMD5Sum(k.simpleJsonMarshal(group.metaData))
+	runs := group.runs
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartTime > runs[j].StartTime })
+	if len(runs) > cronJobRunsMax {
+		runs = runs[:cronJobRunsMax]
+	}
+	group.metaData.Set("jobRuns", runs)
+	metaDataStr := k.simpleJsonMarshal(group.metaData)
+	specStr := k.simpleJsonMarshal(spec)
+	podNum := spec.Get("parallelism").MustInt(1)
+	podGroup := model.PodGroup{
+		Lcuuid:             uLcuuid,
+		Name:               group.name,
+		Metadata:           metaDataStr,
+		MetadataHash:       metaDataHash,
+		Spec:               specStr,
+		SpecHash:           cloudcommon.GenerateMD5Sum(specStr),
+		Label:              k.GetLabel(group.metaData.Get("labels").MustMap()),
+		NetworkMode:        networkMode,
+		Type:               group.serviceType,
+		PodNum:             podNum,
+		PodNamespaceLcuuid: namespaceLcuuid,
+		AZLcuuid:           k.azLcuuid,
+		RegionLcuuid:       k.RegionUUID,
+		PodClusterLcuuid:   k.podClusterLcuuid,
+	}
+	k.podGroupLcuuids.Add(uLcuuid)
+	k.pgLcuuidTopodTargetPorts[uLcuuid] = podTargetPorts
+	return podGroup, k.pgSpecGenerateConnections(group.namespace, group.name, uLcuuid, spec), true
+}
@@ -587,6 +587,7 @@ type PodIngressRuleBackend struct {
 	Lcuuid               string `json:"lcuuid" binding:"required"`
 	Path                 string `json:"path"`
 	Port                 int    `json:"port" binding:"required"`
+	Weight               int    `json:"weight"`
 	PodServiceLcuuid     string `json:"pod_service_lcuuid" binding:"required"`
 	PodIngressRuleLcuuid string `json:"pod_ingress_rule_lcuuid" binding:"required"`
 	PodIngressLcuuid     string `json:"pod_ingress_lcuuid" binding:"required"`
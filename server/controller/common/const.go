@@ -486,6 +486,8 @@ const (
 	VIF_DEVICE_TYPE_POD_GROUP_DAEMON_SET            = 133
 	VIF_DEVICE_TYPE_POD_GROUP_REPLICASET_CONTROLLER = 134
 	VIF_DEVICE_TYPE_POD_GROUP_CLONESET              = 135
+	VIF_DEVICE_TYPE_POD_GROUP_JOB                   = 136
+	VIF_DEVICE_TYPE_POD_GROUP_CRON_JOB              = 137
 	VIF_DEVICE_TYPE_IP                              = 255
 )
 
@@ -496,6 +498,8 @@ var RESOURCE_POD_GROUP_TYPE_MAP = map[int]int{
 	POD_GROUP_DAEMON_SET:            VIF_DEVICE_TYPE_POD_GROUP_DAEMON_SET,
 	POD_GROUP_REPLICASET_CONTROLLER: VIF_DEVICE_TYPE_POD_GROUP_REPLICASET_CONTROLLER,
 	POD_GROUP_CLONESET:              VIF_DEVICE_TYPE_POD_GROUP_CLONESET,
+	POD_GROUP_JOB:                   VIF_DEVICE_TYPE_POD_GROUP_JOB,
+	POD_GROUP_CRON_JOB:              VIF_DEVICE_TYPE_POD_GROUP_CRON_JOB,
 }
 
 const (
@@ -563,6 +567,8 @@ const (
 	DATA_SOURCE_NETWORK        = "flow_metrics.network*"
 	DATA_SOURCE_APPLICATION    = "flow_metrics.application*"
 	DATA_SOURCE_TRAFFIC_POLICY = "flow_metrics.traffic_policy"
+	DATA_SOURCE_PROMETHEUS     = "prometheus.*"
+	DATA_SOURCE_EXT_METRICS    = "ext_metrics.*"
 
 	DATA_SOURCE_STATE_EXCEPTION = 0
 	DATA_SOURCE_STATE_NORMAL    = 1
@@ -609,6 +615,8 @@ const (
 	POD_GROUP_DAEMON_SET            = 4
 	POD_GROUP_REPLICASET_CONTROLLER = 5
 	POD_GROUP_CLONESET              = 6
+	POD_GROUP_JOB                   = 7
+	POD_GROUP_CRON_JOB              = 8
 )
 
 const (
@@ -734,12 +742,16 @@ const (
 	PLUGIN_TYPE_WASM = 1
 	PLUGIN_TYPE_SO   = 2
 	PLUGIN_TYPE_LUA  = 3
+
+	PLUGIN_USER_AGENT  = 1
+	PLUGIN_USER_SERVER = 2
 )
 
 var (
 	PluginTypeName = map[int]string{
 		PLUGIN_TYPE_WASM: "wasm",
 		PLUGIN_TYPE_SO:   "so",
+		PLUGIN_TYPE_LUA:  "lua",
 	}
 )
 
@@ -780,6 +792,7 @@ const (
 
 	USER_TYPE_SUPER_ADMIN = 1
 	USER_TYPE_ADMIN       = 2
+	USER_TYPE_NORMAL      = 3
 	USER_ID_SUPER_ADMIN   = 1
 
 	INGESTER_BODY_ORG_ID = "org-id"
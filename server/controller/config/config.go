@@ -91,6 +91,36 @@ type QuerierJSService struct {
 	Timeout int    `default:"30" yaml:"timeout"`
 }
 
+type AgentFleetCMD struct {
+	AllowedCommands    []string `yaml:"allowed-commands"`
+	DefaultConcurrency int      `default:"10" yaml:"default-concurrency"`
+	MaxConcurrency     int      `default:"64" yaml:"max-concurrency"`
+	MaxAgents          int      `default:"1000" yaml:"max-agents"`
+	AuditOutputLimit   int      `default:"4096" yaml:"audit-output-limit"`
+}
+
+type OIDC struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+	// the JWT must be signed by one of the keys in jwks-file or jwks-url, only RS* and ES* algorithms are supported
+	JWKSFile            string            `yaml:"jwks-file"`
+	JWKSURL             string            `yaml:"jwks-url"`
+	JWKSRefreshInterval int               `default:"300" yaml:"jwks-refresh-interval"` // unit: s
+	Issuer              string            `yaml:"issuer"`
+	Audience            string            `yaml:"audience"`
+	RoleClaim           string            `default:"role" yaml:"role-claim"`
+	OrgClaim            string            `default:"org_id" yaml:"org-claim"`
+	UserIDClaim         string            `default:"user_id" yaml:"user-id-claim"`
+	RoleMapping         map[string]string `yaml:"role-mapping"` // maps the values of role-claim to viewer/operator/admin
+}
+
+type APIAuth struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+	// requests from these networks without the Authorization header still use the X-User-* headers, e.g. the other deepflow components
+	TrustedNetworks []string `yaml:"trusted-networks"`
+	TokenCacheTTL   int      `default:"30" yaml:"token-cache-ttl"` // unit: s
+	OIDC            OIDC     `yaml:"oidc"`
+}
+
 type ControllerConfig struct {
 	LogFile                        string `default:"/var/log/controller.log" yaml:"log-file"`
 	LogLevel                       string `default:"info" yaml:"log-level"`
@@ -114,6 +144,8 @@ type ControllerConfig struct {
 	NoIPOverlapping                bool   `default:"false" yaml:"no-ip-overlapping"`
 	AgentCommandTimeout            int    `default:"30" yaml:"agent-cmd-timeout"`
 
+	APIAuth          APIAuth            `yaml:"api-auth"`
+	AgentFleetCMD    AgentFleetCMD      `yaml:"agent-fleet-cmd"`
 	ACLController    ACLController      `yaml:"acl-controller"`
 	FUser            FUser              `yaml:"fuser"`
 	DFWebService     DFWebService       `yaml:"df-web-service"`
@@ -150,6 +182,9 @@ func (c *Config) Validate() error {
 	if !c.exactlyOneMetadbEnabled() {
 		return fmt.Errorf("only one metadb can be enabled at the same time")
 	}
+	if oidc := c.ControllerConfig.APIAuth.OIDC; c.ControllerConfig.APIAuth.Enabled && oidc.Enabled && oidc.JWKSFile == "" && oidc.JWKSURL == "" {
+		return fmt.Errorf("api-auth.oidc requires jwks-file or jwks-url")
+	}
 	return nil
 }
 
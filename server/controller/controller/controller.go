@@ -186,6 +186,8 @@ func Start(ctx context.Context, revision, configPath, serverLogFile string, shar
 	}()
 
 	router.SetInitStageForHealthChecker("Prometheus init")
+	// the ingester scrapes the targets discovered from the pod/service inventory of trisolaris
+	shared.SetPrometheusTargetDiscovery(prometheus.DiscoverTargets)
 	prometheus := prometheus.GetSingleton()
 	prometheus.SynchronizerCaches.Start(ctx, &cfg.PrometheusCfg)
 	prometheus.Encoders.Init(ctx, cfg.PrometheusCfg)
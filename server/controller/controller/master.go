@@ -82,6 +82,7 @@ func checkAndStartMasterFunctions(
 	// 仅master controller才启动以下goroutine
 	// - tagrecorder
 	// - 控制器和数据节点检查
+	// - 采集器升级发布
 	// - license分配和检查
 	// - resource id manager
 	// - clean deleted/dirty resource data
@@ -96,6 +97,7 @@ func checkAndStartMasterFunctions(
 
 	vtapCheck := vtap.NewVTapCheck(cfg.MonitorCfg, ctx)
 	vtapRebalanceCheck := vtap.NewRebalanceCheck(cfg.MonitorCfg, ctx)
+	upgradeRolloutCheck := vtap.NewUpgradeRolloutCheck(cfg.MonitorCfg, ctx)
 	vtapLicenseAllocation := license.NewVTapLicenseAllocation(cfg.MonitorCfg, ctx)
 	billCheck := bill.NewBillCheck(cfg.BillingMethod, cfg.MonitorCfg, ctx)
 	recorderResource := recorder.GetResource()
@@ -148,6 +150,9 @@ func checkAndStartMasterFunctions(
 				// rebalance vtap check
 				vtapRebalanceCheck.Start(sCtx)
 
+				// agent upgrade rollout
+				upgradeRolloutCheck.Start(sCtx)
+
 				// license分配和检查
 				if cfg.BillingMethod == common.BILLING_METHOD_LICENSE {
 					vtapLicenseAllocation.Start(sCtx)
@@ -178,6 +183,7 @@ func checkAndStartMasterFunctions(
 				// stop controller check
 				// stop analyzer check
 				// stop vtap check
+				// stop agent upgrade rollout
 				// stop vtap license allocation and check
 				// stop domain checker
 				// stop prometheus related
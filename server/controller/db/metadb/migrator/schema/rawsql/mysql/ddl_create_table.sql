@@ -237,6 +237,68 @@ CREATE TABLE IF NOT EXISTS vtap (
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
 TRUNCATE TABLE vtap;
 
+CREATE TABLE IF NOT EXISTS agent_cmd_audit (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    user_type               INTEGER,
+    cmd                     VARCHAR(256) NOT NULL,
+    params                  TEXT,
+    target                  TEXT COMMENT 'agent group or selector of the agents',
+    status                  VARCHAR(16) DEFAULT 'COMPLETED' COMMENT 'COMPLETED, REJECTED or DENIED',
+    reason                  TEXT COMMENT 'why the request is rejected or denied',
+    agent_num               INTEGER DEFAULT 0,
+    success_num             INTEGER DEFAULT 0,
+    failed_num              INTEGER DEFAULT 0,
+    results                 MEDIUMTEXT COMMENT 'status and truncated output of each agent, json',
+    started_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ended_at                DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    INDEX started_at_index(started_at)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE agent_cmd_audit;
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                    VARCHAR(256) NOT NULL,
+    org_id                  INTEGER DEFAULT 1 COMMENT '0 means all orgs, only for admin',
+    role                    VARCHAR(16) NOT NULL COMMENT 'viewer, operator or admin',
+    user_id                 INTEGER,
+    token_hash              CHAR(64) NOT NULL COMMENT 'sha256 of the token',
+    prefix                  VARCHAR(16),
+    expired_at              DATETIME DEFAULT NULL,
+    last_used_at            DATETIME DEFAULT NULL,
+    created_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    UNIQUE INDEX token_hash_index(token_hash)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE api_token;
+
+CREATE TABLE IF NOT EXISTS agent_upgrade_rollout (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    vtap_group_lcuuid       CHAR(64) NOT NULL,
+    image_name              VARCHAR(256) NOT NULL,
+    expected_revision       VARCHAR(256) DEFAULT '',
+    waves                   VARCHAR(256) DEFAULT '' COMMENT 'agent count or percentage of each wave, e.g. 1,10%,50%,100%',
+    current_wave            INTEGER DEFAULT 0,
+    wave_timeout            INTEGER DEFAULT 600 COMMENT 'unit: s',
+    soak_time               INTEGER DEFAULT 300 COMMENT 'unit: s',
+    max_failures            INTEGER DEFAULT 0,
+    auto_rollback           INTEGER DEFAULT 0,
+    state                   VARCHAR(32) NOT NULL COMMENT 'RUNNING, PAUSED, COMPLETED, ABORTED, ROLLING_BACK, ROLLED_BACK',
+    message                 TEXT,
+    agents                  MEDIUMTEXT COMMENT 'wave and upgrade status of each agent, json',
+    wave_started_at         DATETIME DEFAULT NULL,
+    wave_healthy_at         DATETIME DEFAULT NULL,
+    created_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    INDEX vtap_group_lcuuid_index(vtap_group_lcuuid)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE agent_upgrade_rollout;
+
 CREATE TABLE IF NOT EXISTS kubernetes_cluster (
     id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
     cluster_id              VARCHAR(256) NOT NULL ,
@@ -269,6 +331,20 @@ CREATE TABLE IF NOT EXISTS plugin (
 )ENGINE=innodb AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 COMMENT='store plugins for sending to vtap';
 TRUNCATE TABLE plugin;
 
+CREATE TABLE IF NOT EXISTS ingester_quota (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id             INTEGER NOT NULL DEFAULT 0 COMMENT '0 means the whole org',
+    messages_per_second BIGINT DEFAULT 0 COMMENT '0 means no limit',
+    bytes_per_second    BIGINT DEFAULT 0 COMMENT '0 means no limit',
+    action              VARCHAR(16) DEFAULT 'throttle' COMMENT 'throttle or drop',
+    rows_per_day        TEXT COMMENT 'rows limit per day of each datasource, json, e.g. {"flow_log": 100000000}',
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          DATETIME NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lcuuid              CHAR(64) NOT NULL,
+    UNIQUE INDEX team_id_index(team_id)
+)ENGINE=innodb AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 COMMENT='ingestion quotas of the org and its teams, synced to ingesters';
+TRUNCATE TABLE ingester_quota;
+
 -- Analyzers
 CREATE TABLE IF NOT EXISTS analyzer (
     id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
@@ -1051,6 +1127,7 @@ CREATE TABLE IF NOT EXISTS pod_ingress_rule_backend (
     id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
     path                TEXT,
     port                INTEGER,
+    weight              INTEGER DEFAULT 0 COMMENT 'traffic weight of gateway api and istio routes, 0 means unspecified',
     pod_service_id      INTEGER DEFAULT NULL,
     pod_ingress_rule_id INTEGER DEFAULT NULL,
     pod_ingress_id      INTEGER DEFAULT NULL,
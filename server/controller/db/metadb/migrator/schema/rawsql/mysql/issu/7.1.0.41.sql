@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS agent_cmd_audit (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    user_type               INTEGER,
+    cmd                     VARCHAR(256) NOT NULL,
+    params                  TEXT,
+    target                  TEXT COMMENT 'agent group or selector of the agents',
+    agent_num               INTEGER DEFAULT 0,
+    success_num             INTEGER DEFAULT 0,
+    failed_num              INTEGER DEFAULT 0,
+    results                 MEDIUMTEXT COMMENT 'status and truncated output of each agent, json',
+    started_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ended_at                DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    INDEX started_at_index(started_at)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE agent_cmd_audit;
+
+-- Update DB version
+UPDATE db_version SET version='7.1.0.41';
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS api_token (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                    VARCHAR(256) NOT NULL,
+    org_id                  INTEGER DEFAULT 1 COMMENT '0 means all orgs, only for admin',
+    role                    VARCHAR(16) NOT NULL COMMENT 'viewer, operator or admin',
+    user_id                 INTEGER,
+    token_hash              CHAR(64) NOT NULL COMMENT 'sha256 of the token',
+    prefix                  VARCHAR(16),
+    expired_at              DATETIME DEFAULT NULL,
+    last_used_at            DATETIME DEFAULT NULL,
+    created_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    UNIQUE INDEX token_hash_index(token_hash)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE api_token;
+
+-- Update DB version
+UPDATE db_version SET version='7.1.0.42';
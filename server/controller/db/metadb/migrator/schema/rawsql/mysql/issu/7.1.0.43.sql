@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS agent_upgrade_rollout (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    vtap_group_lcuuid       CHAR(64) NOT NULL,
+    image_name              VARCHAR(256) NOT NULL,
+    expected_revision       VARCHAR(256) DEFAULT '',
+    waves                   VARCHAR(256) DEFAULT '' COMMENT 'agent count or percentage of each wave, e.g. 1,10%,50%,100%',
+    current_wave            INTEGER DEFAULT 0,
+    wave_timeout            INTEGER DEFAULT 600 COMMENT 'unit: s',
+    soak_time               INTEGER DEFAULT 300 COMMENT 'unit: s',
+    max_failures            INTEGER DEFAULT 0,
+    auto_rollback           INTEGER DEFAULT 0,
+    state                   VARCHAR(32) NOT NULL COMMENT 'RUNNING, PAUSED, COMPLETED, ABORTED, ROLLING_BACK, ROLLED_BACK',
+    message                 TEXT,
+    agents                  MEDIUMTEXT COMMENT 'wave and upgrade status of each agent, json',
+    wave_started_at         DATETIME DEFAULT NULL,
+    wave_healthy_at         DATETIME DEFAULT NULL,
+    created_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at              DATETIME DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  CHAR(64) NOT NULL,
+    INDEX vtap_group_lcuuid_index(vtap_group_lcuuid)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+TRUNCATE TABLE agent_upgrade_rollout;
+
+-- Update DB version
+UPDATE db_version SET version='7.1.0.43';
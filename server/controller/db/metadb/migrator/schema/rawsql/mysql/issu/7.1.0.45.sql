@@ -0,0 +1,33 @@
+DROP PROCEDURE IF EXISTS AddColumnIfNotExists;
+
+CREATE PROCEDURE AddColumnIfNotExists(
+    IN tableName VARCHAR(255),
+    IN colName VARCHAR(255),
+    IN colType VARCHAR(255),
+    IN afterCol VARCHAR(255)
+)
+BEGIN
+    DECLARE column_count INT;
+
+    SELECT COUNT(*)
+    INTO column_count
+    FROM information_schema.columns
+    WHERE TABLE_SCHEMA = DATABASE()
+    AND TABLE_NAME = tableName
+    AND column_name = colName;
+
+    IF column_count = 0 THEN
+        SET @sql = CONCAT('ALTER TABLE ', tableName, ' ADD COLUMN ', colName, ' ', colType, ' AFTER ', afterCol);
+        PREPARE stmt FROM @sql;
+        EXECUTE stmt;
+        DEALLOCATE PREPARE stmt;
+    END IF;
+END;
+
+CALL AddColumnIfNotExists('agent_cmd_audit', 'status', 'VARCHAR(16) DEFAULT "COMPLETED" COMMENT "COMPLETED, REJECTED or DENIED"', 'target');
+CALL AddColumnIfNotExists('agent_cmd_audit', 'reason', 'TEXT COMMENT "why the request is rejected or denied"', 'status');
+
+DROP PROCEDURE AddColumnIfNotExists;
+
+-- Update DB version
+UPDATE db_version SET version='7.1.0.45';
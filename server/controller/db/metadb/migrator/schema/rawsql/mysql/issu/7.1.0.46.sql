@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS ingester_quota (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    team_id             INTEGER NOT NULL DEFAULT 0 COMMENT '0 means the whole org',
+    messages_per_second BIGINT DEFAULT 0 COMMENT '0 means no limit',
+    bytes_per_second    BIGINT DEFAULT 0 COMMENT '0 means no limit',
+    action              VARCHAR(16) DEFAULT 'throttle' COMMENT 'throttle or drop',
+    rows_per_day        TEXT COMMENT 'rows limit per day of each datasource, json, e.g. {"flow_log": 100000000}',
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          DATETIME NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lcuuid              CHAR(64) NOT NULL,
+    UNIQUE INDEX team_id_index(team_id)
+)ENGINE=innodb AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 COMMENT='ingestion quotas of the org and its teams, synced to ingesters';
+TRUNCATE TABLE ingester_quota;
+
+-- Update DB version
+UPDATE db_version SET version='7.1.0.46';
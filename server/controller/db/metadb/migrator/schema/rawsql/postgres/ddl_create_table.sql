@@ -252,6 +252,80 @@ COMMENT ON COLUMN vtap.enable_features IS 'separated by ,';
 COMMENT ON COLUMN vtap.disable_features IS 'separated by ,';
 COMMENT ON COLUMN vtap.follow_group_features IS 'separated by ,';
 
+CREATE TABLE IF NOT EXISTS agent_cmd_audit (
+    id                      SERIAL PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    user_type               INTEGER,
+    cmd                     VARCHAR(256) NOT NULL,
+    params                  TEXT,
+    target                  TEXT,
+    status                  VARCHAR(16) DEFAULT 'COMPLETED',
+    reason                  TEXT,
+    agent_num               INTEGER DEFAULT 0,
+    success_num             INTEGER DEFAULT 0,
+    failed_num              INTEGER DEFAULT 0,
+    results                 TEXT,
+    started_at              TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ended_at                TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  VARCHAR(64) NOT NULL
+);
+TRUNCATE TABLE agent_cmd_audit;
+CREATE INDEX agent_cmd_audit_started_at_index ON agent_cmd_audit (started_at);
+COMMENT ON COLUMN agent_cmd_audit.target IS 'agent group or selector of the agents';
+COMMENT ON COLUMN agent_cmd_audit.status IS 'COMPLETED, REJECTED or DENIED';
+COMMENT ON COLUMN agent_cmd_audit.reason IS 'why the request is rejected or denied';
+COMMENT ON COLUMN agent_cmd_audit.results IS 'status and truncated output of each agent, json';
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id                      SERIAL PRIMARY KEY,
+    name                    VARCHAR(256) NOT NULL,
+    org_id                  INTEGER DEFAULT 1,
+    role                    VARCHAR(16) NOT NULL,
+    user_id                 INTEGER,
+    token_hash              CHAR(64) NOT NULL,
+    prefix                  VARCHAR(16),
+    expired_at              TIMESTAMP DEFAULT NULL,
+    last_used_at            TIMESTAMP DEFAULT NULL,
+    created_at              TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  VARCHAR(64) NOT NULL
+);
+TRUNCATE TABLE api_token;
+CREATE UNIQUE INDEX api_token_token_hash_index ON api_token (token_hash);
+COMMENT ON COLUMN api_token.org_id IS '0 means all orgs, only for admin';
+COMMENT ON COLUMN api_token.role IS 'viewer, operator or admin';
+COMMENT ON COLUMN api_token.token_hash IS 'sha256 of the token';
+
+CREATE TABLE IF NOT EXISTS agent_upgrade_rollout (
+    id                      SERIAL PRIMARY KEY,
+    team_id                 INTEGER DEFAULT 1,
+    user_id                 INTEGER,
+    vtap_group_lcuuid       VARCHAR(64) NOT NULL,
+    image_name              VARCHAR(256) NOT NULL,
+    expected_revision       VARCHAR(256) DEFAULT '',
+    waves                   VARCHAR(256) DEFAULT '',
+    current_wave            INTEGER DEFAULT 0,
+    wave_timeout            INTEGER DEFAULT 600,
+    soak_time               INTEGER DEFAULT 300,
+    max_failures            INTEGER DEFAULT 0,
+    auto_rollback           INTEGER DEFAULT 0,
+    state                   VARCHAR(32) NOT NULL,
+    message                 TEXT,
+    agents                  TEXT,
+    wave_started_at         TIMESTAMP DEFAULT NULL,
+    wave_healthy_at         TIMESTAMP DEFAULT NULL,
+    created_at              TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at              TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lcuuid                  VARCHAR(64) NOT NULL
+);
+TRUNCATE TABLE agent_upgrade_rollout;
+CREATE INDEX agent_upgrade_rollout_vtap_group_lcuuid_index ON agent_upgrade_rollout (vtap_group_lcuuid);
+COMMENT ON COLUMN agent_upgrade_rollout.waves IS 'agent count or percentage of each wave, e.g. 1,10%,50%,100%';
+COMMENT ON COLUMN agent_upgrade_rollout.wave_timeout IS 'unit: s';
+COMMENT ON COLUMN agent_upgrade_rollout.soak_time IS 'unit: s';
+COMMENT ON COLUMN agent_upgrade_rollout.state IS 'RUNNING, PAUSED, COMPLETED, ABORTED, ROLLING_BACK, ROLLED_BACK';
+COMMENT ON COLUMN agent_upgrade_rollout.agents IS 'wave and upgrade status of each agent, json';
+
 CREATE TABLE IF NOT EXISTS plugin (
     id                  SERIAL PRIMARY KEY,
     name                VARCHAR(256) NOT NULL,
@@ -266,6 +340,26 @@ TRUNCATE TABLE plugin;
 COMMENT ON COLUMN plugin.type IS '1: wasm 2: so 3: lua';
 COMMENT ON COLUMN plugin.user_name IS '1: agent 2: server';
 
+CREATE TABLE IF NOT EXISTS ingester_quota (
+    id                  SERIAL PRIMARY KEY,
+    team_id             INTEGER NOT NULL DEFAULT 0,
+    messages_per_second BIGINT DEFAULT 0,
+    bytes_per_second    BIGINT DEFAULT 0,
+    action              VARCHAR(16) DEFAULT 'throttle',
+    rows_per_day        TEXT,
+    created_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    lcuuid              VARCHAR(64) NOT NULL,
+    UNIQUE (team_id)
+);
+TRUNCATE TABLE ingester_quota;
+COMMENT ON TABLE ingester_quota IS 'ingestion quotas of the org and its teams, synced to ingesters';
+COMMENT ON COLUMN ingester_quota.team_id IS '0 means the whole org';
+COMMENT ON COLUMN ingester_quota.messages_per_second IS '0 means no limit';
+COMMENT ON COLUMN ingester_quota.bytes_per_second IS '0 means no limit';
+COMMENT ON COLUMN ingester_quota.action IS 'throttle or drop';
+COMMENT ON COLUMN ingester_quota.rows_per_day IS 'rows limit per day of each datasource, json, e.g. {"flow_log": 100000000}';
+
 CREATE TABLE IF NOT EXISTS sys_configuration (
     id                  SERIAL PRIMARY KEY,
     param_name          VARCHAR(64) NOT NULL,
@@ -1147,6 +1241,7 @@ CREATE TABLE IF NOT EXISTS pod_ingress_rule_backend (
     id                  SERIAL PRIMARY KEY,
     path                TEXT,
     port                INTEGER,
+    weight              INTEGER DEFAULT 0,
     pod_service_id      INTEGER DEFAULT NULL,
     pod_ingress_rule_id INTEGER DEFAULT NULL,
     pod_ingress_id      INTEGER DEFAULT NULL,
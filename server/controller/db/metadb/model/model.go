@@ -290,6 +290,74 @@ func (LicenseFuncLog) TableName() string {
 	return "license_func_log"
 }
 
+type AgentCMDAudit struct {
+	ID         int       `gorm:"primaryKey;autoIncrement;column:id;type:int;not null" json:"ID"`
+	TeamID     int       `gorm:"column:team_id;type:int;default:1" json:"TEAM_ID"`
+	UserID     int       `gorm:"column:user_id;type:int" json:"USER_ID"`
+	UserType   int       `gorm:"column:user_type;type:int" json:"USER_TYPE"`
+	CMD        string    `gorm:"column:cmd;type:varchar(256);not null" json:"CMD"`
+	Params     string    `gorm:"column:params;type:text" json:"PARAMS"`
+	Target     string    `gorm:"column:target;type:text" json:"TARGET"`                          // agent group or selector of the agents
+	Status     string    `gorm:"column:status;type:varchar(16);default:COMPLETED" json:"STATUS"` // COMPLETED, REJECTED or DENIED
+	Reason     string    `gorm:"column:reason;type:text" json:"REASON"`                          // why the request is rejected or denied
+	AgentNum   int       `gorm:"column:agent_num;type:int;default:0" json:"AGENT_NUM"`
+	SuccessNum int       `gorm:"column:success_num;type:int;default:0" json:"SUCCESS_NUM"`
+	FailedNum  int       `gorm:"column:failed_num;type:int;default:0" json:"FAILED_NUM"`
+	Results    string    `gorm:"column:results;type:mediumtext" json:"RESULTS"` // status and truncated output of each agent, json
+	StartedAt  time.Time `gorm:"column:started_at;type:datetime;default:CURRENT_TIMESTAMP" json:"STARTED_AT"`
+	EndedAt    time.Time `gorm:"column:ended_at;type:datetime;default:CURRENT_TIMESTAMP" json:"ENDED_AT"`
+	Lcuuid     string    `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
+}
+
+func (AgentCMDAudit) TableName() string {
+	return "agent_cmd_audit"
+}
+
+type APIToken struct {
+	ID         int        `gorm:"primaryKey;autoIncrement;column:id;type:int;not null" json:"ID"`
+	Name       string     `gorm:"column:name;type:varchar(256);not null" json:"NAME"`
+	OrgID      int        `gorm:"column:org_id;type:int;default:1" json:"ORG_ID"` // 0 means all orgs, only for admin
+	Role       string     `gorm:"column:role;type:varchar(16);not null" json:"ROLE"`
+	UserID     int        `gorm:"column:user_id;type:int" json:"USER_ID"`
+	TokenHash  string     `gorm:"column:token_hash;type:char(64);not null" json:"-"` // sha256 of the token, the token itself is not stored
+	Prefix     string     `gorm:"column:prefix;type:varchar(16)" json:"PREFIX"`
+	ExpiredAt  *time.Time `gorm:"column:expired_at;type:datetime" json:"EXPIRED_AT"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at;type:datetime" json:"LAST_USED_AT"`
+	CreatedAt  time.Time  `gorm:"column:created_at;type:datetime;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	Lcuuid     string     `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
+}
+
+func (APIToken) TableName() string {
+	return "api_token"
+}
+
+type AgentUpgradeRollout struct {
+	ID               int        `gorm:"primaryKey;autoIncrement;column:id;type:int;not null" json:"ID"`
+	TeamID           int        `gorm:"column:team_id;type:int;default:1" json:"TEAM_ID"`
+	UserID           int        `gorm:"column:user_id;type:int" json:"USER_ID"`
+	VTapGroupLcuuid  string     `gorm:"column:vtap_group_lcuuid;type:char(64);not null" json:"VTAP_GROUP_LCUUID"`
+	ImageName        string     `gorm:"column:image_name;type:varchar(256);not null" json:"IMAGE_NAME"`
+	ExpectedRevision string     `gorm:"column:expected_revision;type:varchar(256);default:''" json:"EXPECTED_REVISION"`
+	Waves            string     `gorm:"column:waves;type:varchar(256);default:''" json:"WAVES"` // agent count or percentage of each wave, e.g. 1,10%,50%,100%
+	CurrentWave      int        `gorm:"column:current_wave;type:int;default:0" json:"CURRENT_WAVE"`
+	WaveTimeout      int        `gorm:"column:wave_timeout;type:int;default:600" json:"WAVE_TIMEOUT"` // unit: s
+	SoakTime         int        `gorm:"column:soak_time;type:int;default:300" json:"SOAK_TIME"`       // unit: s
+	MaxFailures      int        `gorm:"column:max_failures;type:int;default:0" json:"MAX_FAILURES"`
+	AutoRollback     int        `gorm:"column:auto_rollback;type:int;default:0" json:"AUTO_ROLLBACK"`
+	State            string     `gorm:"column:state;type:varchar(32);not null" json:"STATE"`
+	Message          string     `gorm:"column:message;type:text" json:"MESSAGE"`     // reason of the last pause, abort or rollback
+	Agents           string     `gorm:"column:agents;type:mediumtext" json:"AGENTS"` // wave and upgrade status of each agent, json
+	WaveStartedAt    *time.Time `gorm:"column:wave_started_at;type:datetime" json:"WAVE_STARTED_AT"`
+	WaveHealthyAt    *time.Time `gorm:"column:wave_healthy_at;type:datetime" json:"WAVE_HEALTHY_AT"` // all agents of the wave are healthy since
+	CreatedAt        time.Time  `gorm:"column:created_at;type:datetime;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	UpdatedAt        time.Time  `gorm:"column:updated_at;type:datetime;default:CURRENT_TIMESTAMP" json:"UPDATED_AT"`
+	Lcuuid           string     `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
+}
+
+func (AgentUpgradeRollout) TableName() string {
+	return "agent_upgrade_rollout"
+}
+
 type DataSource struct {
 	ID                        int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
 	DisplayName               string    `gorm:"column:display_name;type:char(64);default:''" json:"DISPLAY_NAME"`
@@ -560,6 +628,22 @@ func (MailServer) TableName() string {
 	return "mail_server"
 }
 
+type IngesterQuota struct {
+	ID                int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	TeamID            int       `gorm:"column:team_id;type:int;not null;default:0" json:"TEAM_ID"` // 0 means the whole org
+	MessagesPerSecond int64     `gorm:"column:messages_per_second;type:bigint;default:0" json:"MESSAGES_PER_SECOND"`
+	BytesPerSecond    int64     `gorm:"column:bytes_per_second;type:bigint;default:0" json:"BYTES_PER_SECOND"`
+	Action            string    `gorm:"column:action;type:varchar(16);default:throttle" json:"ACTION"` // throttle or drop
+	RowsPerDay        string    `gorm:"column:rows_per_day;type:text" json:"ROWS_PER_DAY"`             // json, datasource: rows
+	CreatedAt         time.Time `gorm:"column:created_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	UpdatedAt         time.Time `gorm:"column:updated_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"UPDATED_AT"`
+	Lcuuid            string    `gorm:"unique;column:lcuuid;type:char(64)" json:"LCUUID"`
+}
+
+func (IngesterQuota) TableName() string {
+	return "ingester_quota"
+}
+
 type AlarmPolicy struct {
 	ID                 int            `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
 	Name               string         `gorm:"column:name;type:char(128)" json:"NAME"`
@@ -860,6 +860,7 @@ type PodIngressRuleBackend struct {
 	OperatedTime     `gorm:"embedded" mapstructure:",squash"`
 	Path             string `gorm:"column:path;type:text;default:''" json:"PATH" mapstructure:"PATH"`
 	Port             int    `gorm:"column:port;type:int;default:null" json:"PORT" mapstructure:"PORT"`
+	Weight           int    `gorm:"column:weight;type:int;default:0" json:"WEIGHT" mapstructure:"WEIGHT"` // 0 means unspecified
 	PodServiceID     int    `gorm:"column:pod_service_id;type:int;default:null" json:"POD_SERVICE_ID" mapstructure:"POD_SERVICE_ID"`
 	PodIngressRuleID int    `gorm:"column:pod_ingress_rule_id;type:int;default:null" json:"POD_INGRESS_RULE_ID" mapstructure:"POD_INGRESS_RULE_ID"`
 	PodIngressID     int    `gorm:"column:pod_ingress_id;type:int;default:null" json:"POD_INGRESS_ID" mapstructure:"POD_INGRESS_ID"`
@@ -109,3 +109,11 @@ func (s *service) GetUniversalTagNameMaps(ctx context.Context, in *api.Universal
 func (s *service) GetOrgIDs(ctx context.Context, in *api.OrgIDsRequest) (*api.OrgIDsResponse, error) {
 	return s.tsdbEvent.GetOrgIDs(ctx, in)
 }
+
+func (s *service) GetServerPlugins(ctx context.Context, in *api.ServerPluginsRequest) (*api.ServerPluginsResponse, error) {
+	return s.tsdbEvent.GetServerPlugins(ctx, in)
+}
+
+func (s *service) GetIngesterQuotas(ctx context.Context, in *api.IngesterQuotasRequest) (*api.IngesterQuotasResponse, error) {
+	return s.tsdbEvent.GetIngesterQuotas(ctx, in)
+}
@@ -0,0 +1,278 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package auth authenticates the callers of the controller HTTP API by API tokens or OIDC JWTs,
+// and authorizes them by role and org.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+)
+
+var log = logging.MustGetLogger("http.auth")
+
+const (
+	HEADER_KEY_AUTHORIZATION = "Authorization"
+	BEARER_PREFIX            = "bearer "
+
+	// the key of *Identity in gin.Context
+	CONTEXT_KEY_IDENTITY = "auth.identity"
+
+	// token org 0 means the token can access all orgs
+	ALL_ORGS = 0
+
+	AUTH_METHOD_TOKEN = "token"
+	AUTH_METHOD_JWT   = "jwt"
+)
+
+var (
+	defaultTrustedNetworks = []string{"127.0.0.0/8", "::1/128"}
+	// paths which can be accessed without authentication
+	exemptPathPrefixes = []string{"/v1/health/", "/swagger/"}
+
+	errMissingCredential = errors.New("missing Authorization header")
+	errInvalidToken      = errors.New("invalid api token")
+	errTokenExpired      = errors.New("api token is expired")
+)
+
+type Identity struct {
+	Method string
+	Name   string // token name or jwt subject
+	Role   Role
+	OrgID  int
+	UserID int
+}
+
+// UserType is the X-User-Type of the identity, used by the handlers which check the user type
+func (i *Identity) UserType() int {
+	if i.Role == ROLE_ADMIN {
+		if i.OrgID == ALL_ORGS {
+			return common.USER_TYPE_SUPER_ADMIN
+		}
+		return common.USER_TYPE_ADMIN
+	}
+	return common.USER_TYPE_NORMAL
+}
+
+// ResolveOrg returns the org of the request, the X-Org-Id header must be the org of the identity unless it can access all orgs
+func (i *Identity) ResolveOrg(requested string) (int, error) {
+	if requested == "" {
+		if i.OrgID == ALL_ORGS {
+			return common.DEFAULT_ORG_ID, nil
+		}
+		return i.OrgID, nil
+	}
+	orgID, err := strconv.Atoi(requested)
+	if err != nil {
+		return 0, fmt.Errorf("invalid header (%s) value (%s)", common.HEADER_KEY_X_ORG_ID, requested)
+	}
+	if i.OrgID != ALL_ORGS && orgID != i.OrgID {
+		return 0, fmt.Errorf("%s (%s) can not access org (%d)", i.Method, i.Name, orgID)
+	}
+	return orgID, nil
+}
+
+func IsExempt(path string) bool {
+	for _, prefix := range exemptPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator struct {
+	cfg             config.APIAuth
+	trustedNetworks []*net.IPNet
+	tokens          *tokenCache
+	jwks            *jwksLoader
+	now             func() time.Time
+}
+
+func NewAuthenticator(cfg config.APIAuth) (*Authenticator, error) {
+	return newAuthenticator(cfg, metadbTokenStore{})
+}
+
+func newAuthenticator(cfg config.APIAuth, store TokenStore) (*Authenticator, error) {
+	a := &Authenticator{
+		cfg:    cfg,
+		tokens: newTokenCache(store, time.Duration(cfg.TokenCacheTTL)*time.Second),
+		now:    time.Now,
+	}
+	networks := cfg.TrustedNetworks
+	if len(networks) == 0 {
+		networks = defaultTrustedNetworks
+	}
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api-auth trusted network (%s): %s", n, err.Error())
+		}
+		a.trustedNetworks = append(a.trustedNetworks, ipNet)
+	}
+	if cfg.OIDC.Enabled {
+		a.jwks = newJWKSLoader(cfg.OIDC.JWKSFile, cfg.OIDC.JWKSURL, time.Duration(cfg.OIDC.JWKSRefreshInterval)*time.Second)
+	}
+	return a, nil
+}
+
+func (a *Authenticator) Start() {
+	if a.jwks != nil {
+		a.jwks.start()
+	}
+}
+
+func (a *Authenticator) isTrusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.trustedNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns the identity of the request, or nil if the request comes from the trusted networks
+// without the Authorization header, then the X-User-* headers are trusted as before.
+func (a *Authenticator) Authenticate(req *http.Request) (*Identity, error) {
+	credential := strings.TrimSpace(req.Header.Get(HEADER_KEY_AUTHORIZATION))
+	if credential == "" {
+		if a.isTrusted(req.RemoteAddr) {
+			return nil, nil
+		}
+		return nil, errMissingCredential
+	}
+	if len(credential) >= len(BEARER_PREFIX) && strings.EqualFold(credential[:len(BEARER_PREFIX)], BEARER_PREFIX) {
+		credential = strings.TrimSpace(credential[len(BEARER_PREFIX):])
+	}
+
+	if IsAPIToken(credential) {
+		return a.authenticateToken(credential)
+	}
+	if a.jwks != nil {
+		return a.authenticateJWT(credential)
+	}
+	return nil, errInvalidToken
+}
+
+func (a *Authenticator) authenticateToken(credential string) (*Identity, error) {
+	now := a.now()
+	token := a.tokens.get(HashToken(credential), now)
+	if token == nil {
+		return nil, errInvalidToken
+	}
+	if token.ExpiredAt != nil && now.After(*token.ExpiredAt) {
+		return nil, errTokenExpired
+	}
+	role, err := ParseRole(token.Role)
+	if err != nil {
+		return nil, err
+	}
+	if token.OrgID == ALL_ORGS && role != ROLE_ADMIN {
+		return nil, fmt.Errorf("api token (%s) of all orgs must be admin", token.Name)
+	}
+	return &Identity{
+		Method: AUTH_METHOD_TOKEN,
+		Name:   token.Name,
+		Role:   role,
+		OrgID:  token.OrgID,
+		UserID: token.UserID,
+	}, nil
+}
+
+func claimInt(claims map[string]interface{}, name string) (int, bool) {
+	switch v := claims[name].(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return int(i), err == nil
+	case string:
+		i, err := strconv.Atoi(v)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// roleFromClaim maps the role claim, which can be a string or a list of strings such as groups, to the highest role
+func (a *Authenticator) roleFromClaim(claim interface{}) Role {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = append(values, v)
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	role := ROLE_NONE
+	for _, v := range values {
+		if mapped, ok := a.cfg.OIDC.RoleMapping[v]; ok {
+			v = mapped
+		}
+		if r, err := ParseRole(v); err == nil && r > role {
+			role = r
+		}
+	}
+	return role
+}
+
+func (a *Authenticator) authenticateJWT(credential string) (*Identity, error) {
+	oidc := &a.cfg.OIDC
+	claims, err := verifyJWT(credential, a.jwks.keySet.Load(), a.now(), oidc.Issuer, oidc.Audience)
+	if err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	role := a.roleFromClaim(claims[oidc.RoleClaim])
+	if role == ROLE_NONE {
+		return nil, fmt.Errorf("jwt (%s) has no valid role in claim (%s)", subject, oidc.RoleClaim)
+	}
+	orgID, ok := claimInt(claims, oidc.OrgClaim)
+	if !ok {
+		orgID = common.DEFAULT_ORG_ID
+	}
+	if orgID == ALL_ORGS && role != ROLE_ADMIN {
+		return nil, fmt.Errorf("jwt (%s) of all orgs must be admin", subject)
+	}
+	userID, _ := claimInt(claims, oidc.UserIDClaim)
+	return &Identity{
+		Method: AUTH_METHOD_JWT,
+		Name:   subject,
+		Role:   role,
+		OrgID:  orgID,
+		UserID: userID,
+	}, nil
+}
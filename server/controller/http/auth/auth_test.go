@@ -0,0 +1,240 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+)
+
+type mockTokenStore struct {
+	tokens  map[string]*metadbmodel.APIToken
+	queries int
+}
+
+func (s *mockTokenStore) GetByHash(hash string) (*metadbmodel.APIToken, error) {
+	s.queries++
+	if t, ok := s.tokens[hash]; ok {
+		return t, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *mockTokenStore) Touch(id int, usedAt time.Time) {}
+
+func newRequest(remoteAddr, authorization string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/v1/vtaps/", nil)
+	req.RemoteAddr = remoteAddr
+	if authorization != "" {
+		req.Header.Set(HEADER_KEY_AUTHORIZATION, authorization)
+	}
+	return req
+}
+
+func TestRoleAllow(t *testing.T) {
+	tests := []struct {
+		role   Role
+		method string
+		path   string
+		want   bool
+	}{
+		{ROLE_VIEWER, http.MethodGet, "/v1/domains/", true},
+		{ROLE_VIEWER, http.MethodPost, "/v1/domains/", false},
+		{ROLE_OPERATOR, http.MethodPatch, "/v1/domains/x/", true},
+		{ROLE_OPERATOR, http.MethodDelete, "/v1/domains/x/", false},
+		{ROLE_OPERATOR, http.MethodGet, "/v1/api-tokens/", false},
+		{ROLE_ADMIN, http.MethodDelete, "/v1/domains/x/", true},
+		{ROLE_ADMIN, http.MethodPost, "/v1/api-tokens/", true},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allow(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s %s = %v, want %v", tt.role, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	token, prefix, hash, err := GenerateToken()
+	if err != nil || !IsAPIToken(token) || prefix != token[:TOKEN_DISPLAY_LENGTH] || hash != HashToken(token) {
+		t.Fatalf("GenerateToken() = %s, %s, %s, %v", token, prefix, hash, err)
+	}
+	expired, _, expiredHash, _ := GenerateToken()
+	past := time.Now().Add(-time.Hour)
+	store := &mockTokenStore{tokens: map[string]*metadbmodel.APIToken{
+		hash:        {ID: 1, Name: "ci", OrgID: 3, Role: ROLE_NAME_OPERATOR, UserID: 7},
+		expiredHash: {ID: 2, Name: "old", OrgID: 3, Role: ROLE_NAME_ADMIN, ExpiredAt: &past},
+	}}
+	a, err := newAuthenticator(config.APIAuth{TokenCacheTTL: 30}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := a.Authenticate(newRequest("10.1.1.1:1000", "Bearer "+token))
+	if err != nil {
+		t.Fatalf("authenticate token failed: %s", err)
+	}
+	if identity.Role != ROLE_OPERATOR || identity.OrgID != 3 || identity.UserID != 7 || identity.UserType() != common.USER_TYPE_NORMAL {
+		t.Errorf("identity = %+v", identity)
+	}
+	// cached
+	a.Authenticate(newRequest("10.1.1.1:1000", token))
+	if store.queries != 1 {
+		t.Errorf("queried %d times, want 1", store.queries)
+	}
+
+	if _, err := a.Authenticate(newRequest("10.1.1.1:1000", "Bearer "+expired)); err != errTokenExpired {
+		t.Errorf("expired token: %v", err)
+	}
+	if _, err := a.Authenticate(newRequest("10.1.1.1:1000", "Bearer dfk_unknown")); err != errInvalidToken {
+		t.Errorf("unknown token: %v", err)
+	}
+	if _, err := a.Authenticate(newRequest("10.1.1.1:1000", "")); err != errMissingCredential {
+		t.Errorf("missing token: %v", err)
+	}
+	// the legacy headers are trusted from loopback by default
+	if identity, err := a.Authenticate(newRequest("127.0.0.1:1000", "")); identity != nil || err != nil {
+		t.Errorf("trusted request: %+v, %v", identity, err)
+	}
+}
+
+func TestResolveOrg(t *testing.T) {
+	identity := &Identity{Method: AUTH_METHOD_TOKEN, Name: "t", Role: ROLE_VIEWER, OrgID: 3}
+	if org, err := identity.ResolveOrg(""); org != 3 || err != nil {
+		t.Errorf("ResolveOrg('') = %d, %v", org, err)
+	}
+	if _, err := identity.ResolveOrg("4"); err == nil {
+		t.Errorf("access another org should fail")
+	}
+	identity = &Identity{Role: ROLE_ADMIN, OrgID: ALL_ORGS}
+	if org, err := identity.ResolveOrg("4"); org != 4 || err != nil || identity.UserType() != common.USER_TYPE_SUPER_ADMIN {
+		t.Errorf("ResolveOrg('4') of all orgs = %d, %v", org, err)
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + b64(signature)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "e1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.APIAuth{
+		TokenCacheTTL: 30,
+		OIDC: config.OIDC{
+			Enabled:     true,
+			JWKSFile:    jwksFile,
+			Issuer:      "https://idp",
+			Audience:    "deepflow",
+			RoleClaim:   "groups",
+			OrgClaim:    "org_id",
+			UserIDClaim: "user_id",
+			RoleMapping: map[string]string{"sre": ROLE_NAME_OPERATOR, "platform": ROLE_NAME_ADMIN},
+		},
+	}
+	a, err := newAuthenticator(cfg, &mockTokenStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Start()
+
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "alice", "iss": "https://idp", "aud": []string{"deepflow"}, "exp": now + 60, "groups": []string{"dev", "sre"}, "org_id": 2, "user_id": "9"}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	identity, err := a.Authenticate(newRequest("10.1.1.1:1000", "Bearer "+signJWT(t, "RS256", "r1", rsaKey, claims(nil))))
+	if err != nil {
+		t.Fatalf("authenticate jwt failed: %s", err)
+	}
+	if identity.Method != AUTH_METHOD_JWT || identity.Name != "alice" || identity.Role != ROLE_OPERATOR || identity.OrgID != 2 || identity.UserID != 9 {
+		t.Errorf("identity = %+v", identity)
+	}
+	identity, err = a.Authenticate(newRequest("10.1.1.1:1000", "Bearer "+signJWT(t, "ES256", "e1", ecKey, claims(map[string]interface{}{"groups": "platform"}))))
+	if err != nil || identity.Role != ROLE_ADMIN {
+		t.Errorf("es256 jwt: %+v, %v", identity, err)
+	}
+
+	for name, token := range map[string]string{
+		"expired":    signJWT(t, "RS256", "r1", rsaKey, claims(map[string]interface{}{"exp": now - 3600})),
+		"issuer":     signJWT(t, "RS256", "r1", rsaKey, claims(map[string]interface{}{"iss": "https://other"})),
+		"audience":   signJWT(t, "RS256", "r1", rsaKey, claims(map[string]interface{}{"aud": "other"})),
+		"no role":    signJWT(t, "RS256", "r1", rsaKey, claims(map[string]interface{}{"groups": []string{"dev"}})),
+		"bad key":    signJWT(t, "RS256", "r1", otherKey, claims(nil)),
+		"alg":        signJWT(t, "ES256", "r1", ecKey, claims(nil)),
+		"all orgs":   signJWT(t, "RS256", "r1", rsaKey, claims(map[string]interface{}{"org_id": 0})),
+		"malformed":  "a.b",
+		"unknown id": signJWT(t, "RS256", "r2", rsaKey, claims(nil)),
+	} {
+		if identity, err := a.Authenticate(newRequest("10.1.1.1:1000", "Bearer "+token)); err == nil {
+			t.Errorf("%s: authenticate should fail, got %+v", name, identity)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// tolerance of the clock difference between the identity provider and the controller
+	JWT_LEEWAY = time.Minute
+	// the JWKS url response larger than this is rejected
+	JWKS_MAX_SIZE = 1 << 20
+)
+
+var (
+	errJWTMalformed = errors.New("malformed jwt")
+	errJWTSignature = errors.New("invalid jwt signature")
+	errJWTExpired   = errors.New("jwt is expired or not valid yet")
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	keys map[string]crypto.PublicKey
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// parseJWKS parses the signing keys, the keys without kid are indexed by an empty kid
+func parseJWKS(data []byte) (*keySet, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	ks := &keySet{keys: make(map[string]crypto.PublicKey)}
+	for i := range jwks.Keys {
+		k := &jwks.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warningf("skip jwk (%s): %s", k.Kid, err.Error())
+			continue
+		}
+		ks.keys[k.Kid] = key
+	}
+	if len(ks.keys) == 0 {
+		return nil, fmt.Errorf("no valid signing key in jwks")
+	}
+	return ks, nil
+}
+
+// jwksLoader loads the JWKS from a file or an url, and reloads it periodically for key rotation
+type jwksLoader struct {
+	file     string
+	url      string
+	interval time.Duration
+	keySet   atomic.Pointer[keySet]
+}
+
+func newJWKSLoader(file, url string, interval time.Duration) *jwksLoader {
+	return &jwksLoader{file: file, url: url, interval: interval}
+}
+
+func (l *jwksLoader) load() error {
+	var data []byte
+	var err error
+	if l.file != "" {
+		data, err = os.ReadFile(l.file)
+	} else {
+		client := &http.Client{Timeout: 10 * time.Second}
+		var resp *http.Response
+		resp, err = client.Get(l.url)
+		if err == nil {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("get jwks from %s failed, status: %s", l.url, resp.Status)
+			}
+			data, err = io.ReadAll(io.LimitReader(resp.Body, JWKS_MAX_SIZE))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	ks, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	l.keySet.Store(ks)
+	return nil
+}
+
+func (l *jwksLoader) start() {
+	if err := l.load(); err != nil {
+		log.Errorf("load jwks failed: %s", err.Error())
+	}
+	if l.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := l.load(); err != nil {
+				// keep using the keys loaded last time
+				log.Warningf("reload jwks failed: %s", err.Error())
+			}
+		}
+	}()
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg[0] == 'R' && rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+	switch v := claims[name].(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return int64(f), true
+		}
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func audienceMatch(claim interface{}, audience string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyJWT checks the signature, exp, nbf, iss and aud of the compact serialized JWT, and returns its claims
+func verifyJWT(token string, ks *keySet, now time.Time, issuer, audience string) (map[string]interface{}, error) {
+	if ks == nil {
+		return nil, fmt.Errorf("jwks is not loaded")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	signed := []byte(token[:len(parts[0])+1+len(parts[1])])
+	verified := false
+	if key, ok := ks.keys[header.Kid]; ok {
+		verified = verifySignature(header.Alg, key, signed, signature)
+	} else if header.Kid == "" {
+		for _, key := range ks.keys {
+			if verifySignature(header.Alg, key, signed, signature) {
+				verified = true
+				break
+			}
+		}
+	}
+	if !verified {
+		return nil, errJWTSignature
+	}
+
+	claims := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(payloadBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, errJWTMalformed
+	}
+	exp, ok := numericClaim(claims, "exp")
+	if !ok || now.After(time.Unix(exp, 0).Add(JWT_LEEWAY)) {
+		return nil, errJWTExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(JWT_LEEWAY).Before(time.Unix(nbf, 0)) {
+		return nil, errJWTExpired
+	}
+	if issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != issuer {
+			return nil, fmt.Errorf("unexpected jwt issuer (%v)", claims["iss"])
+		}
+	}
+	if audience != "" && !audienceMatch(claims["aud"], audience) {
+		return nil, fmt.Errorf("unexpected jwt audience (%v)", claims["aud"])
+	}
+	return claims, nil
+}
@@ -0,0 +1,89 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type Role int
+
+const (
+	ROLE_NONE Role = iota
+	// viewer can only read
+	ROLE_VIEWER
+	// operator can read and modify, but can not delete resources or manage tokens
+	ROLE_OPERATOR
+	// admin can do everything
+	ROLE_ADMIN
+)
+
+const (
+	ROLE_NAME_VIEWER   = "viewer"
+	ROLE_NAME_OPERATOR = "operator"
+	ROLE_NAME_ADMIN    = "admin"
+)
+
+// paths only admin can access whatever the method is
+var adminOnlyPathPrefixes = []string{
+	"/v1/api-tokens",
+}
+
+func (r Role) String() string {
+	switch r {
+	case ROLE_VIEWER:
+		return ROLE_NAME_VIEWER
+	case ROLE_OPERATOR:
+		return ROLE_NAME_OPERATOR
+	case ROLE_ADMIN:
+		return ROLE_NAME_ADMIN
+	}
+	return "none"
+}
+
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case ROLE_NAME_VIEWER:
+		return ROLE_VIEWER, nil
+	case ROLE_NAME_OPERATOR:
+		return ROLE_OPERATOR, nil
+	case ROLE_NAME_ADMIN:
+		return ROLE_ADMIN, nil
+	}
+	return ROLE_NONE, fmt.Errorf("invalid role (%s), should be one of %s, %s, %s", name, ROLE_NAME_VIEWER, ROLE_NAME_OPERATOR, ROLE_NAME_ADMIN)
+}
+
+// Allow checks whether the role can call the API
+func (r Role) Allow(method, path string) bool {
+	if r == ROLE_ADMIN {
+		return true
+	}
+	for _, prefix := range adminOnlyPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r >= ROLE_VIEWER
+	case http.MethodDelete:
+		return false
+	}
+	return r >= ROLE_OPERATOR
+}
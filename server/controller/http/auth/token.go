@@ -0,0 +1,135 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+)
+
+const (
+	TOKEN_PREFIX       = "dfk_"
+	TOKEN_RANDOM_BYTES = 32
+	// length of the token head stored in plain text, used to identify the token in the list
+	TOKEN_DISPLAY_LENGTH = 12
+	// invalid tokens are not cached any more when the cache is larger than this
+	TOKEN_CACHE_MAX_INVALID = 10000
+)
+
+// GenerateToken returns a new random token, its display prefix and its hash, only the hash and the prefix should be stored.
+func GenerateToken() (token, prefix, hash string, err error) {
+	b := make([]byte, TOKEN_RANDOM_BYTES)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	token = TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(b)
+	return token, token[:TOKEN_DISPLAY_LENGTH], HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIToken(credential string) bool {
+	return strings.HasPrefix(credential, TOKEN_PREFIX)
+}
+
+// TokenStore looks up the API token by its hash
+type TokenStore interface {
+	GetByHash(hash string) (*metadbmodel.APIToken, error)
+	Touch(id int, usedAt time.Time)
+}
+
+// metadbTokenStore stores the tokens of all orgs in the default db
+type metadbTokenStore struct{}
+
+func (metadbTokenStore) GetByHash(hash string) (*metadbmodel.APIToken, error) {
+	var token metadbmodel.APIToken
+	if err := metadb.DefaultDB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (metadbTokenStore) Touch(id int, usedAt time.Time) {
+	if err := metadb.DefaultDB.Model(&metadbmodel.APIToken{}).Where("id = ?", id).Update("last_used_at", usedAt).Error; err != nil {
+		log.Warningf("update last_used_at of api token (%d) failed: %s", id, err.Error())
+	}
+}
+
+type cachedToken struct {
+	token    *metadbmodel.APIToken // nil if the token does not exist
+	cachedAt time.Time
+}
+
+// tokenCache avoids querying the db for every request, a deleted token is still valid until the cache expires
+type tokenCache struct {
+	store TokenStore
+	ttl   time.Duration
+
+	mutex  sync.Mutex
+	tokens map[string]*cachedToken
+}
+
+func newTokenCache(store TokenStore, ttl time.Duration) *tokenCache {
+	return &tokenCache{store: store, ttl: ttl, tokens: make(map[string]*cachedToken)}
+}
+
+func (c *tokenCache) get(hash string, now time.Time) *metadbmodel.APIToken {
+	c.mutex.Lock()
+	cached, ok := c.tokens[hash]
+	c.mutex.Unlock()
+	if ok && now.Sub(cached.cachedAt) < c.ttl {
+		return cached.token
+	}
+
+	token, err := c.store.GetByHash(hash)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			// do not cache the db failure
+			log.Errorf("query api token failed: %s", err.Error())
+			return nil
+		}
+		token = nil
+	} else {
+		c.store.Touch(token.ID, now)
+	}
+	c.mutex.Lock()
+	// drop the expired entries, so that invalid tokens can not grow the cache without limit
+	for h, t := range c.tokens {
+		if now.Sub(t.cachedAt) >= c.ttl {
+			delete(c.tokens, h)
+		}
+	}
+	if token != nil || len(c.tokens) < TOKEN_CACHE_MAX_INVALID {
+		c.tokens[hash] = &cachedToken{token: token, cachedAt: now}
+	}
+	c.mutex.Unlock()
+	return token
+}
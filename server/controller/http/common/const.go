@@ -47,6 +47,9 @@ const (
 	// map to http.StatusServiceUnavailable
 	SERVICE_UNAVAILABLE = "SERVICE_UNAVAILABLE"
 
+	// map to http.StatusUnauthorized
+	UNAUTHORIZED = "UNAUTHORIZED"
+
 	// map to http.StatusForbidden
 	NO_PERMISSIONS                   = "NO_PERMISSIONS"
 	NO_LICENSE_FUNCTION_ASSET_CMDB   = "NO_LICENSE_FUNCTION_ASSET_CMDB"
@@ -80,6 +83,8 @@ var (
 
 		SERVICE_UNAVAILABLE: http.StatusServiceUnavailable,
 
+		UNAUTHORIZED: http.StatusUnauthorized,
+
 		NO_PERMISSIONS:                   http.StatusForbidden,
 		NO_LICENSE_FUNCTION_ASSET_CMDB:   http.StatusForbidden,
 		NO_LICENSE_FUNCTION_LEGACY_PROBE: http.StatusForbidden,
@@ -22,11 +22,53 @@ import (
 
 	"github.com/deepflowio/deepflow/server/controller/common"
 	mcommon "github.com/deepflowio/deepflow/server/controller/db/metadb/common"
+	"github.com/deepflowio/deepflow/server/controller/http/auth"
 	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
 	"github.com/deepflowio/deepflow/server/controller/http/common/response"
 	"github.com/gin-gonic/gin"
 )
 
+// AuthMiddleware authenticates the request by API token or OIDC JWT and checks the role and org of the caller,
+// then overwrites the X-Org-Id, X-User-Type and X-User-Id headers with the identity, so that the handlers
+// keep reading the user info from the headers. Requests from the trusted networks without credential are passed as before.
+func AuthMiddleware(a *auth.Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if auth.IsExempt(ctx.Request.URL.Path) {
+			ctx.Next()
+			return
+		}
+		identity, err := a.Authenticate(ctx.Request)
+		if err != nil {
+			response.JSON(ctx, response.SetOptStatus(httpcommon.UNAUTHORIZED), response.SetError(err))
+			ctx.Abort()
+			return
+		}
+		if identity == nil {
+			ctx.Next()
+			return
+		}
+
+		if !identity.Role.Allow(ctx.Request.Method, ctx.Request.URL.Path) {
+			response.JSON(ctx, response.SetOptStatus(httpcommon.NO_PERMISSIONS),
+				response.SetError(fmt.Errorf("%s (%s) with role %s can not %s %s", identity.Method, identity.Name, identity.Role, ctx.Request.Method, ctx.Request.URL.Path)))
+			ctx.Abort()
+			return
+		}
+		orgID, err := identity.ResolveOrg(ctx.Request.Header.Get(common.HEADER_KEY_X_ORG_ID))
+		if err != nil {
+			response.JSON(ctx, response.SetOptStatus(httpcommon.NO_PERMISSIONS), response.SetError(err))
+			ctx.Abort()
+			return
+		}
+		ctx.Request.Header.Set(common.HEADER_KEY_X_ORG_ID, strconv.Itoa(orgID))
+		ctx.Request.Header.Set(common.HEADER_KEY_X_USER_TYPE, strconv.Itoa(identity.UserType()))
+		ctx.Request.Header.Set(common.HEADER_KEY_X_USER_ID, strconv.Itoa(identity.UserID))
+		ctx.Set(auth.CONTEXT_KEY_IDENTITY, identity)
+
+		ctx.Next()
+	}
+}
+
 func HandleORGIDMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		orgID := mcommon.DEFAULT_ORG_ID
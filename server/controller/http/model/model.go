@@ -85,3 +85,63 @@ type AgentGroupConfigQuery struct {
 type AgentGroupConfigResponse struct {
 	agentconf.MySQLAgentGroupConfiguration
 }
+
+// AgentCMDFleetRun 定义了在一组采集器上执行命令的请求参数
+type AgentCMDFleetRun struct {
+	CMD         string            `json:"CMD" binding:"required"` // 命令，需在允许的命令列表中
+	Params      map[string]string `json:"PARAMS"`                 // 命令参数
+	AgentGroup  string            `json:"AGENT_GROUP"`            // 采集器组名称或 LCUUID
+	Selector    string            `json:"SELECTOR"`               // 采集器属性选择器，如 region=r1,os!=windows,name=node-*
+	Concurrency int               `json:"CONCURRENCY"`            // 同时执行命令的采集器数量
+	Timeout     int               `json:"TIMEOUT"`                // 单个采集器的执行超时时间（秒）
+}
+
+// AgentCMDAgentResult 定义了单个采集器的命令执行结果
+type AgentCMDAgentResult struct {
+	AgentID   int    `json:"AGENT_ID"`
+	AgentName string `json:"AGENT_NAME"`
+	Status    string `json:"STATUS"` // SUCCESS, FAILED, TIMEOUT
+	Error     string `json:"ERROR,omitempty"`
+	Output    string `json:"OUTPUT"`
+	Truncated bool   `json:"TRUNCATED,omitempty"` // 审计记录中的输出是否被截断
+	Duration  int64  `json:"DURATION"`            // 执行耗时（毫秒）
+}
+
+// AgentCMDFleetRunResponse 定义了在一组采集器上执行命令的响应参数
+type AgentCMDFleetRunResponse struct {
+	AuditID    int                   `json:"AUDIT_ID"`
+	AgentNum   int                   `json:"AGENT_NUM"`
+	SuccessNum int                   `json:"SUCCESS_NUM"`
+	FailedNum  int                   `json:"FAILED_NUM"`
+	Results    []AgentCMDAgentResult `json:"RESULTS"`
+}
+
+// AgentCMDAuditQuery 定义了查询采集器命令执行审计记录的请求参数
+type AgentCMDAuditQuery struct {
+	CMD    string `schema:"cmd,omitempty" json:"cmd,omitempty"`         // 命令
+	UserID int    `schema:"user_id,omitempty" json:"user_id,omitempty"` // 执行人 ID
+	Status string `schema:"status,omitempty" json:"status,omitempty"`   // 审计状态：COMPLETED, REJECTED, DENIED
+	Limit  int    `schema:"limit,omitempty" json:"limit,omitempty"`     // 返回的记录数，默认 100
+}
+
+// AgentUpgradeRolloutCreate 定义了创建采集器升级发布的请求参数
+type AgentUpgradeRolloutCreate struct {
+	AgentGroup   string `json:"AGENT_GROUP" binding:"required"` // 采集器组名称、LCUUID 或 SHORT_UUID
+	ImageName    string `json:"IMAGE_NAME" binding:"required"`  // 采集器镜像名称
+	Waves        string `json:"WAVES"`                          // 每批次累计升级的采集器数量或百分比，如 1,10%,50%，默认 1,10%,50%,100%
+	WaveTimeout  int    `json:"WAVE_TIMEOUT"`                   // 单批次采集器恢复健康的超时时间（秒），默认 600
+	SoakTime     int    `json:"SOAK_TIME"`                      // 单批次采集器全部健康后进入下一批次前的观察时间（秒），默认 300
+	MaxFailures  int    `json:"MAX_FAILURES"`                   // 允许失败的采集器数量，超过后暂停或回滚发布
+	AutoRollback bool   `json:"AUTO_ROLLBACK"`                  // 失败数量超限时是否自动回滚
+}
+
+// AgentUpgradeRolloutAbort 定义了终止采集器升级发布的请求参数
+type AgentUpgradeRolloutAbort struct {
+	Rollback bool `json:"ROLLBACK"` // 是否回滚已升级的采集器
+}
+
+// AgentUpgradeRolloutQuery 定义了查询采集器升级发布的请求参数
+type AgentUpgradeRolloutQuery struct {
+	AgentGroup string `schema:"agent_group,omitempty" json:"agent_group,omitempty"` // 采集器组名称、LCUUID 或 SHORT_UUID
+	State      string `schema:"state,omitempty" json:"state,omitempty"`             // 发布状态
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/http/model"
+	routercommon "github.com/deepflowio/deepflow/server/controller/http/router/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service/agent"
+)
+
+type AgentFleetCMD struct {
+	cfg *config.ControllerConfig
+}
+
+func NewAgentFleetCMD(cfg *config.ControllerConfig) *AgentFleetCMD {
+	return &AgentFleetCMD{
+		cfg: cfg,
+	}
+}
+
+func (a *AgentFleetCMD) RegisterTo(e *gin.Engine) {
+	e.POST("/v1/agents/cmd/run", a.run)
+	e.GET("/v1/agent-cmd-audits", a.getAudits)
+	e.GET("/v1/agent-cmd-audits/:id", a.getAudit)
+}
+
+// checkPermission checks whether the user can run the command on a group of agents. As the single agent api does,
+// only super admin and admin can run commands other than probe and profile ones, and the allow list limits the commands
+// further, probe and profile commands are allowed if it is not configured.
+func (a *AgentFleetCMD) checkPermission(userInfo *model.UserInfo, cmd string) error {
+	_, ok1 := profileCommandMap[cmd]
+	_, ok2 := probeCommandMap[cmd]
+	if !userInfo.IsAdmin() && !(ok1 || ok2) {
+		return fmt.Errorf("only super admin and admin can operate command(%s)", cmd)
+	}
+	if len(a.cfg.AgentFleetCMD.AllowedCommands) == 0 {
+		if ok1 || ok2 {
+			return nil
+		}
+		return fmt.Errorf("command(%s) is not allowed to run on multiple agents", cmd)
+	}
+	for _, allowed := range a.cfg.AgentFleetCMD.AllowedCommands {
+		if allowed == cmd {
+			return nil
+		}
+	}
+	return fmt.Errorf("command(%s) is not allowed to run on multiple agents", cmd)
+}
+
+// Run 在一组采集器上执行命令
+// @Summary 在一组采集器上执行命令
+// @Tags AgentCMD
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param payload body model.AgentCMDFleetRun true "参数"
+// @Success 200 {object} model.AgentCMDFleetRunResponse "执行完成"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 403 "权限不足"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agents/cmd/run [post]
+func (a *AgentFleetCMD) run(c *gin.Context) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	if err := routercommon.NewValidators(header).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	var payload model.AgentCMDFleetRun
+	if err := c.BindJSON(&payload); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	fleetCMD := agent.NewFleetCMD(header.GetUserInfo(), a.cfg)
+	if err := a.checkPermission(header.GetUserInfo(), payload.CMD); err != nil {
+		fleetCMD.Deny(&payload, err)
+		response.JSON(c, response.SetOptStatus(common.NO_PERMISSIONS), response.SetError(err))
+		return
+	}
+	data, err := fleetCMD.Run(&payload, c.Request.Header)
+	if err != nil {
+		response.JSON(c, response.SetData(data), response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// GetAudits 获取采集器命令执行审计记录
+// @Summary 获取采集器命令执行审计记录
+// @Tags AgentCMD
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param query query model.AgentCMDAuditQuery true "参数"
+// @Success 200 {object} response.Response "获取成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-cmd-audits [get]
+func (a *AgentFleetCMD) getAudits(c *gin.Context) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	query := routercommon.NewQueryValidator[model.AgentCMDAuditQuery](c.Request.URL.Query())
+	if err := routercommon.NewValidators(header, query).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	data, err := agent.NewFleetCMD(header.GetUserInfo(), a.cfg).GetAudits(query.GetStructData())
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// GetAudit 获取采集器命令执行审计记录详情
+// @Summary 获取采集器命令执行审计记录详情
+// @Tags AgentCMD
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param id path int true "审计记录 ID"
+// @Success 200 {object} response.Response "获取成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-cmd-audits/{id} [get]
+func (a *AgentFleetCMD) getAudit(c *gin.Context) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	if err := routercommon.NewValidators(header).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	data, err := agent.NewFleetCMD(header.GetUserInfo(), a.cfg).GetAudit(id)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.RESOURCE_NOT_FOUND), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/http/model"
+	routercommon "github.com/deepflowio/deepflow/server/controller/http/router/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service/agent"
+)
+
+type AgentUpgradeRollout struct {
+	cfg *config.ControllerConfig
+}
+
+func NewAgentUpgradeRollout(cfg *config.ControllerConfig) *AgentUpgradeRollout {
+	return &AgentUpgradeRollout{
+		cfg: cfg,
+	}
+}
+
+func (a *AgentUpgradeRollout) RegisterTo(e *gin.Engine) {
+	e.POST("/v1/agent-rollouts", a.create)
+	e.GET("/v1/agent-rollouts", a.getRollouts)
+	e.GET("/v1/agent-rollouts/:id", a.getRollout)
+	e.POST("/v1/agent-rollouts/:id/pause", a.pause)
+	e.POST("/v1/agent-rollouts/:id/resume", a.resume)
+	e.POST("/v1/agent-rollouts/:id/abort", a.abort)
+}
+
+// Create 创建采集器升级发布
+// @Summary 创建采集器升级发布，按批次升级采集器组中的采集器
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param payload body model.AgentUpgradeRolloutCreate true "参数"
+// @Success 200 {object} response.Response "创建成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts [post]
+func (a *AgentUpgradeRollout) create(c *gin.Context) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	if err := routercommon.NewValidators(header).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	var payload model.AgentUpgradeRolloutCreate
+	if err := c.BindJSON(&payload); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).Create(&payload)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// GetRollouts 获取采集器升级发布列表
+// @Summary 获取采集器升级发布列表
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param query query model.AgentUpgradeRolloutQuery true "参数"
+// @Success 200 {object} response.Response "获取成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts [get]
+func (a *AgentUpgradeRollout) getRollouts(c *gin.Context) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	query := routercommon.NewQueryValidator[model.AgentUpgradeRolloutQuery](c.Request.URL.Query())
+	if err := routercommon.NewValidators(header, query).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).GetRollouts(query.GetStructData())
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// GetRollout 获取采集器升级发布详情
+// @Summary 获取采集器升级发布详情，包含每个采集器的批次和升级状态
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param id path int true "发布 ID"
+// @Success 200 {object} response.Response "获取成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts/{id} [get]
+func (a *AgentUpgradeRollout) getRollout(c *gin.Context) {
+	header, id, ok := a.validate(c)
+	if !ok {
+		return
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).GetRollout(id)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.RESOURCE_NOT_FOUND), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// Pause 暂停采集器升级发布
+// @Summary 暂停采集器升级发布，已下发的升级不会被取消
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param id path int true "发布 ID"
+// @Success 200 {object} response.Response "暂停成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts/{id}/pause [post]
+func (a *AgentUpgradeRollout) pause(c *gin.Context) {
+	header, id, ok := a.validate(c)
+	if !ok {
+		return
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).Pause(id)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// Resume 恢复采集器升级发布
+// @Summary 从当前批次恢复采集器升级发布，失败的采集器会重新升级
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param id path int true "发布 ID"
+// @Success 200 {object} response.Response "恢复成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts/{id}/resume [post]
+func (a *AgentUpgradeRollout) resume(c *gin.Context) {
+	header, id, ok := a.validate(c)
+	if !ok {
+		return
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).Resume(id)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+// Abort 终止采集器升级发布
+// @Summary 终止采集器升级发布，取消未完成的升级，可选回滚已升级的采集器
+// @Tags AgentUpgradeRollout
+// @Accept json
+// @Produce json
+// @Param X-User-Id header string true "用户 ID"
+// @Param X-User-Type header string true "用户类型"
+// @Param X-Org-Id header string true "组织 ID"
+// @Param id path int true "发布 ID"
+// @Param payload body model.AgentUpgradeRolloutAbort false "参数"
+// @Success 200 {object} response.Response "终止成功"
+// @Failure 400 {object} response.Response "请求参数错误"
+// @Failure 500 "服务器内部错误"
+// @Router /v1/agent-rollouts/{id}/abort [post]
+func (a *AgentUpgradeRollout) abort(c *gin.Context) {
+	header, id, ok := a.validate(c)
+	if !ok {
+		return
+	}
+	var payload model.AgentUpgradeRolloutAbort
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&payload); err != nil {
+			response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+			return
+		}
+	}
+	data, err := agent.NewUpgradeRollout(header.GetUserInfo(), a.cfg).Abort(id, payload.Rollback)
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.SERVER_ERROR), response.SetError(err))
+		return
+	}
+	response.JSON(c, response.SetOptStatus(common.SUCCESS), response.SetData(data))
+}
+
+func (a *AgentUpgradeRollout) validate(c *gin.Context) (*routercommon.HeaderValidator, int, bool) {
+	header := routercommon.NewHeaderValidator(c.Request.Header, a.cfg.FPermit)
+	if err := routercommon.NewValidators(header).Validate(); err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return nil, 0, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+		return nil, 0, false
+	}
+	return header, id, true
+}
@@ -0,0 +1,98 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/election"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	routercommon "github.com/deepflowio/deepflow/server/controller/http/router/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+type APIToken struct {
+	cfg *config.ControllerConfig
+}
+
+func NewAPIToken(cfg *config.ControllerConfig) *APIToken {
+	return &APIToken{cfg: cfg}
+}
+
+func (a *APIToken) RegisterTo(e *gin.Engine) {
+	adminRoutes := e.Group("/v1/api-tokens")
+	adminRoutes.Use(AdminPermissionVerificationMiddleware())
+
+	adminRoutes.GET("/", getAPITokens)
+	adminRoutes.POST("/", createAPIToken(a.cfg))
+	adminRoutes.DELETE("/:lcuuid/", deleteAPIToken(a.cfg))
+}
+
+func getUserFromContext(c *gin.Context) (orgID, userType, userID int) {
+	value, _ := c.Get(common.HEADER_KEY_X_ORG_ID)
+	orgID, _ = value.(int)
+	value, _ = c.Get(common.HEADER_KEY_X_USER_TYPE)
+	userType, _ = value.(int)
+	value, _ = c.Get(common.HEADER_KEY_X_USER_ID)
+	userID, _ = value.(int)
+	return
+}
+
+func getAPITokens(c *gin.Context) {
+	orgID, userType, _ := getUserFromContext(c)
+	data, err := service.GetAPITokens(orgID, userType)
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func createAPIToken(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// tokens are written in the default db, create them on the master controller as the other resources
+		isMasterController, masterControllerIP, _ := election.IsMasterControllerAndReturnIP()
+		if !isMasterController {
+			routercommon.ForwardMasterController(c, masterControllerIP, cfg.ListenPort)
+			return
+		}
+
+		var tokenCreate model.APITokenCreate
+		if err := c.ShouldBindBodyWith(&tokenCreate, binding.JSON); err != nil {
+			response.JSON(c, response.SetOptStatus(httpcommon.INVALID_PARAMETERS), response.SetError(err))
+			return
+		}
+		orgID, userType, userID := getUserFromContext(c)
+		data, err := service.CreateAPIToken(orgID, userType, userID, tokenCreate)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	})
+}
+
+func deleteAPIToken(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		isMasterController, masterControllerIP, _ := election.IsMasterControllerAndReturnIP()
+		if !isMasterController {
+			routercommon.ForwardMasterController(c, masterControllerIP, cfg.ListenPort)
+			return
+		}
+
+		orgID, userType, _ := getUserFromContext(c)
+		data, err := service.DeleteAPIToken(orgID, userType, c.Param("lcuuid"))
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	})
+}
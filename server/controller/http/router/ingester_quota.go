@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+// IngesterQuota manages the ingestion quotas of the org and its teams, the ingesters
+// sync the quotas from the controllers
+type IngesterQuota struct{}
+
+func NewIngesterQuota() *IngesterQuota {
+	return new(IngesterQuota)
+}
+
+func (q *IngesterQuota) RegisterTo(e *gin.Engine) {
+	adminRoutes := e.Group("/v1/ingester-quotas")
+	adminRoutes.Use(AdminPermissionVerificationMiddleware())
+
+	adminRoutes.GET("/", getIngesterQuotas)
+	adminRoutes.POST("/", createIngesterQuota)
+	adminRoutes.PATCH("/:lcuuid/", updateIngesterQuota)
+	adminRoutes.DELETE("/:lcuuid/", deleteIngesterQuota)
+}
+
+func getIngesterQuotas(c *gin.Context) {
+	args := make(map[string]interface{})
+	if value, ok := c.GetQuery("lcuuid"); ok {
+		args["lcuuid"] = value
+	}
+	if value, ok := c.GetQuery("team_id"); ok {
+		args["team_id"] = value
+	}
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.GetIngesterQuotas(dbInfo, args)
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func createIngesterQuota(c *gin.Context) {
+	var quotaCreate model.IngesterQuotaCreate
+	if err := c.ShouldBindBodyWith(&quotaCreate, binding.JSON); err != nil {
+		response.JSON(c, response.SetOptStatus(httpcommon.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.CreateIngesterQuota(dbInfo, quotaCreate)
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func updateIngesterQuota(c *gin.Context) {
+	var quotaUpdate model.IngesterQuotaUpdate
+	if err := c.ShouldBindBodyWith(&quotaUpdate, binding.JSON); err != nil {
+		response.JSON(c, response.SetOptStatus(httpcommon.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.UpdateIngesterQuota(dbInfo, c.Param("lcuuid"), quotaUpdate)
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func deleteIngesterQuota(c *gin.Context) {
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.DeleteIngesterQuota(dbInfo, c.Param("lcuuid"))
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
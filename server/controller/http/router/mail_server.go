@@ -22,6 +22,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
 	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
 	"github.com/deepflowio/deepflow/server/controller/http/common/response"
 	"github.com/deepflowio/deepflow/server/controller/http/service"
@@ -46,7 +47,12 @@ func getMailServer(c *gin.Context) {
 	if value, ok := c.GetQuery("lcuuid"); ok {
 		args["lcuuid"] = value
 	}
-	data, err := service.GetMailServer(args)
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.GetMailServer(dbInfo, args)
 	response.JSON(c, response.SetData(data), response.SetError(err))
 }
 
@@ -61,7 +67,12 @@ func createMailServer(c *gin.Context) {
 		return
 	}
 
-	data, err := service.CreateMailServer(mailCreate)
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.CreateMailServer(dbInfo, mailCreate)
 	response.JSON(c, response.SetData(data), response.SetError(err))
 }
 
@@ -82,7 +93,12 @@ func updateMailServer(c *gin.Context) {
 	c.ShouldBindBodyWith(&patchMap, binding.JSON)
 
 	lcuuid := c.Param("lcuuid")
-	data, err := service.UpdateMailServer(lcuuid, patchMap)
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.UpdateMailServer(dbInfo, lcuuid, patchMap)
 	response.JSON(c, response.SetData(data), response.SetError(err))
 }
 
@@ -90,6 +106,11 @@ func deleteMailServer(c *gin.Context) {
 	var err error
 
 	lcuuid := c.Param("lcuuid")
-	data, err := service.DeleteMailServer(lcuuid)
+	dbInfo, err := metadb.GetDB(httpcommon.GetUserInfo(c).ORGID)
+	if err != nil {
+		response.JSON(c, response.SetError(err))
+		return
+	}
+	data, err := service.DeleteMailServer(dbInfo, lcuuid)
 	response.JSON(c, response.SetData(data), response.SetError(err))
 }
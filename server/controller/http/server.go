@@ -30,6 +30,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/config"
 	"github.com/deepflowio/deepflow/server/controller/genesis"
 	"github.com/deepflowio/deepflow/server/controller/http/appender"
+	"github.com/deepflowio/deepflow/server/controller/http/auth"
 	"github.com/deepflowio/deepflow/server/controller/http/common/registrant"
 	"github.com/deepflowio/deepflow/server/controller/http/router"
 	"github.com/deepflowio/deepflow/server/controller/http/router/agent"
@@ -63,6 +64,14 @@ func NewServer(logFile string, cfg *config.ControllerConfig) *Server {
 	g.Use(gin.Recovery())
 	g.Use(gin.LoggerWithFormatter(logger.GinLogFormat))
 	// set custom middleware
+	if cfg.APIAuth.Enabled {
+		authenticator, err := auth.NewAuthenticator(cfg.APIAuth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authenticator.Start()
+		g.Use(AuthMiddleware(authenticator))
+	}
 	g.Use(HandleORGIDMiddleware())
 
 	appender.SetSwaggerConfig(cfg)
@@ -122,7 +131,9 @@ func (s *Server) appendRegistrant() []registrant.Registrant {
 		router.NewVtapRepo(),
 		router.NewPlugin(),
 		router.NewMail(),
+		router.NewIngesterQuota(),
 		router.NewDatabase(s.controllerConfig),
+		router.NewAPIToken(s.controllerConfig),
 
 		// icon
 		router.NewIcon(s.controllerConfig),
@@ -135,6 +146,8 @@ func (s *Server) appendRegistrant() []registrant.Registrant {
 		agent.NewAgentGroupConfig(s.controllerConfig),
 		agent.NewAgentGroupConfigChangelog(s.controllerConfig),
 		agent.NewAgentCMD(s.controllerConfig),
+		agent.NewAgentFleetCMD(s.controllerConfig),
+		agent.NewAgentUpgradeRollout(s.controllerConfig),
 		vtap.NewAgentCMD(s.controllerConfig), // TODO remove
 	}
 
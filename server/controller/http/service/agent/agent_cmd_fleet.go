@@ -0,0 +1,540 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	grpcapi "github.com/deepflowio/deepflow/message/agent"
+	ctrlcommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/http/auth"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/model"
+	"github.com/deepflowio/deepflow/server/controller/monitor/license"
+)
+
+const (
+	AGENT_CMD_STATUS_SUCCESS = "SUCCESS"
+	AGENT_CMD_STATUS_FAILED  = "FAILED"
+	AGENT_CMD_STATUS_TIMEOUT = "TIMEOUT"
+
+	AGENT_CMD_AUDIT_STATUS_COMPLETED = "COMPLETED"
+	AGENT_CMD_AUDIT_STATUS_REJECTED  = "REJECTED" // invalid request, e.g. no agent is selected
+	AGENT_CMD_AUDIT_STATUS_DENIED    = "DENIED"   // the user has no permission to run the command
+
+	agentCMDAuditDefaultLimit = 100
+)
+
+// FleetCMD runs a remote command on a group of agents and keeps an audit record of every execution.
+type FleetCMD struct {
+	cfg      *config.ControllerConfig
+	userInfo *model.UserInfo
+	// the credentials of the request, which are forwarded to the servers connected by the agents
+	forwardHeader http.Header
+}
+
+func NewFleetCMD(userInfo *model.UserInfo, cfg *config.ControllerConfig) *FleetCMD {
+	return &FleetCMD{
+		cfg:      cfg,
+		userInfo: userInfo,
+	}
+}
+
+// Run runs the command on the agents selected by the request, header is the header of the request, whose credentials
+// are forwarded if the agent is connected to another server.
+func (f *FleetCMD) Run(req *model.AgentCMDFleetRun, header http.Header) (*model.AgentCMDFleetRunResponse, error) {
+	dbInfo, err := metadb.GetDB(f.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	f.forwardHeader = make(http.Header)
+	for key, values := range header {
+		key = http.CanonicalHeaderKey(key)
+		if key == auth.HEADER_KEY_AUTHORIZATION || strings.HasPrefix(key, "X-User-") {
+			f.forwardHeader[key] = values
+		}
+	}
+	agents, err := f.selectAgents(dbInfo, req)
+	if err != nil {
+		log.Warningf("[REMOTE_EXEC] user(id: %d) command(%s) rejected: %s", f.userInfo.ID, req.CMD, err.Error(), dbInfo.LogPrefixORGID)
+		if _, auditErr := f.createAudit(dbInfo, req, AGENT_CMD_AUDIT_STATUS_REJECTED, err.Error(), nil, time.Now()); auditErr != nil {
+			log.Errorf("[REMOTE_EXEC] failed to save audit of command(%s): %s", req.CMD, auditErr.Error(), dbInfo.LogPrefixORGID)
+		}
+		return nil, err
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = f.cfg.AgentFleetCMD.DefaultConcurrency
+	}
+	if concurrency > f.cfg.AgentFleetCMD.MaxConcurrency {
+		concurrency = f.cfg.AgentFleetCMD.MaxConcurrency
+	}
+	timeout := req.Timeout
+	if timeout <= 0 || timeout > f.cfg.AgentCommandTimeout {
+		timeout = f.cfg.AgentCommandTimeout
+	}
+	log.Infof("[REMOTE_EXEC] user(id: %d) run command(%s) on %d agents, agent group: %s, selector: %s, concurrency: %d, timeout: %ds",
+		f.userInfo.ID, req.CMD, len(agents), req.AgentGroup, req.Selector, concurrency, timeout, dbInfo.LogPrefixORGID)
+
+	startedAt := time.Now()
+	results := make([]model.AgentCMDAgentResult, len(agents))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range agents {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = f.runOnAgent(agents[i], req, timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	resp := &model.AgentCMDFleetRunResponse{AgentNum: len(agents), Results: results}
+	for _, result := range results {
+		if result.Status == AGENT_CMD_STATUS_SUCCESS {
+			resp.SuccessNum++
+		} else {
+			resp.FailedNum++
+		}
+	}
+	audit, err := f.createAudit(dbInfo, req, AGENT_CMD_AUDIT_STATUS_COMPLETED, "", resp, startedAt)
+	if err != nil {
+		log.Errorf("[REMOTE_EXEC] failed to save audit of command(%s): %s", req.CMD, err.Error(), dbInfo.LogPrefixORGID)
+		return resp, err
+	}
+	resp.AuditID = audit.ID
+	return resp, nil
+}
+
+// Deny records a request which the user has no permission to run.
+func (f *FleetCMD) Deny(req *model.AgentCMDFleetRun, reason error) {
+	dbInfo, err := metadb.GetDB(f.userInfo.ORGID)
+	if err != nil {
+		log.Errorf("[REMOTE_EXEC] failed to save audit of command(%s): %s", req.CMD, err.Error())
+		return
+	}
+	log.Warningf("[REMOTE_EXEC] user(id: %d, type: %d) command(%s) denied: %s", f.userInfo.ID, f.userInfo.Type, req.CMD, reason.Error(), dbInfo.LogPrefixORGID)
+	if _, err := f.createAudit(dbInfo, req, AGENT_CMD_AUDIT_STATUS_DENIED, reason.Error(), nil, time.Now()); err != nil {
+		log.Errorf("[REMOTE_EXEC] failed to save audit of command(%s): %s", req.CMD, err.Error(), dbInfo.LogPrefixORGID)
+	}
+}
+
+func (f *FleetCMD) selectAgents(dbInfo *metadb.DB, req *model.AgentCMDFleetRun) ([]*metadbmodel.VTap, error) {
+	if req.AgentGroup == "" && req.Selector == "" {
+		return nil, errors.New("agent group or selector is required")
+	}
+	selector, err := ParseAgentSelector(req.Selector)
+	if err != nil {
+		return nil, err
+	}
+	agents, err := f.getAgents(dbInfo, req.AgentGroup, selector)
+	if err != nil {
+		return nil, err
+	}
+	if agents, err = f.filterAgentsByUser(agents); err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, errors.New("no agent matches the agent group and selector")
+	}
+	if len(agents) > f.cfg.AgentFleetCMD.MaxAgents {
+		return nil, fmt.Errorf("%d agents selected, exceeds the limit %d", len(agents), f.cfg.AgentFleetCMD.MaxAgents)
+	}
+	return agents, nil
+}
+
+func (f *FleetCMD) getAgents(dbInfo *metadb.DB, agentGroup string, selector AgentSelector) ([]*metadbmodel.VTap, error) {
+	var agents []*metadbmodel.VTap
+	db := dbInfo.DB
+	if agentGroup != "" {
+		var group *metadbmodel.VTapGroup
+		if err := dbInfo.Where("name = ? OR lcuuid = ? OR short_uuid = ?", agentGroup, agentGroup, agentGroup).First(&group).Error; err != nil {
+			return nil, fmt.Errorf("failed to get agent group(%s), error: %s", agentGroup, err.Error())
+		}
+		db = db.Where("vtap_group_lcuuid = ?", group.Lcuuid)
+	}
+	if err := db.Order("id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	var groupNames map[string]string
+	if selector.needGroupName() {
+		var groups []*metadbmodel.VTapGroup
+		if err := dbInfo.Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		groupNames = make(map[string]string, len(groups))
+		for _, group := range groups {
+			groupNames[group.Lcuuid] = group.Name
+		}
+	}
+	var selected []*metadbmodel.VTap
+	for _, agent := range agents {
+		if selector.Match(agentSelectorAttrs(agent, groupNames)) {
+			selected = append(selected, agent)
+		}
+	}
+	return selected, nil
+}
+
+// filterAgentsByUser keeps the agents of the teams the user can access, in the same way as the agent list api
+func (f *FleetCMD) filterAgentsByUser(agents []*metadbmodel.VTap) ([]*metadbmodel.VTap, error) {
+	if f.userInfo.Type == ctrlcommon.DEFAULT_USER_TYPE && f.userInfo.ID == ctrlcommon.DEFAULT_USER_ID {
+		return agents, nil
+	}
+	userInfo := httpcommon.NewUserInfo(f.userInfo.Type, f.userInfo.ID, f.userInfo.ORGID)
+	unauthorizedTeamIDs, err := httpcommon.GetUnauthorizedTeamIDs(userInfo, &f.cfg.FPermit)
+	if err != nil {
+		return nil, err
+	}
+	var results []*metadbmodel.VTap
+	for _, agent := range agents {
+		if f.cfg.FPermit.Enabled {
+			if _, ok := unauthorizedTeamIDs[agent.TeamID]; !ok {
+				results = append(results, agent)
+			}
+			continue
+		}
+		if agent.TeamID == ctrlcommon.DEFAULT_TEAM_ID {
+			results = append(results, agent)
+		}
+	}
+	return results, nil
+}
+
+func (f *FleetCMD) runOnAgent(agent *metadbmodel.VTap, req *model.AgentCMDFleetRun, timeout int) model.AgentCMDAgentResult {
+	result := model.AgentCMDAgentResult{
+		AgentID:   agent.ID,
+		AgentName: agent.Name,
+	}
+	if agent.State != ctrlcommon.VTAP_STATE_NORMAL {
+		result.Status = AGENT_CMD_STATUS_FAILED
+		result.Error = "agent is not connected"
+		return result
+	}
+	if err := license.GetChecker().CheckAgent(agent, ctrlcommon.AGENT_LICENSE_FUNCTION_LEGACY_PROBE); err != nil {
+		result.Status = AGENT_CMD_STATUS_FAILED
+		result.Error = err.Error()
+		return result
+	}
+
+	params := make([]*grpcapi.Parameter, 0, len(req.Params))
+	for _, key := range sortedKeys(req.Params) {
+		k, v := key, req.Params[key]
+		params = append(params, &grpcapi.Parameter{Key: &k, Value: &v})
+	}
+	agentReq := &grpcapi.RemoteExecRequest{
+		ExecType:     grpcapi.ExecutionType_RUN_COMMAND.Enum(),
+		CommandIdent: &req.CMD,
+		Params:       params,
+	}
+
+	start := time.Now()
+	var content string
+	var err error
+	if GetAgentCMDManager(agent.CtrlIP + "-" + agent.CtrlMac).IsValid() {
+		content, err = RunAgentCMD(timeout, f.userInfo.ORGID, agent.ID, agentReq, req.CMD)
+	} else {
+		content, err = f.forwardToServerConnectedByAgent(agent, agentReq, req.CMD, timeout)
+	}
+	result.Duration = time.Since(start).Milliseconds()
+	result.Output = content
+	if err != nil {
+		result.Status = AGENT_CMD_STATUS_FAILED
+		if time.Since(start) >= time.Duration(timeout)*time.Second {
+			result.Status = AGENT_CMD_STATUS_TIMEOUT
+		}
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = AGENT_CMD_STATUS_SUCCESS
+	return result
+}
+
+// forwardToServerConnectedByAgent runs the command through the single agent api of the server which the agent
+// connects to, the request is forwarded again by that server if the agent has switched to another one.
+func (f *FleetCMD) forwardToServerConnectedByAgent(agent *metadbmodel.VTap, agentReq *grpcapi.RemoteExecRequest, CMD string, timeout int) (string, error) {
+	host := agent.CurControllerIP
+	if host == "" {
+		host = agent.ControllerIP
+	}
+	body, err := json.Marshal(&RemoteExecReq{
+		RemoteExecRequest: grpcapi.RemoteExecRequest{
+			CommandIdent: agentReq.CommandIdent,
+			Params:       agentReq.Params,
+		},
+		OutputFormat: grpcapi.OutputFormat_TEXT.Enum(),
+		CMD:          CMD,
+	})
+	if err != nil {
+		return "", err
+	}
+	cipherKey := string(ctrlcommon.DerivePBKDF2Key(f.userInfo.ID, f.userInfo.ORGID))
+	payload, err := ctrlcommon.AesEncrypt(string(body), cipherKey)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("http://%s:%d/v1/agent/%d/cmd/run", ctrlcommon.GetCURLIP(host), ctrlcommon.GConfig.HTTPNodePort, agent.ID)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(payload))
+	if err != nil {
+		return "", err
+	}
+	for key, values := range f.forwardHeader {
+		req.Header[key] = values
+	}
+	req.Header.Set(ctrlcommon.HEADER_KEY_X_ORG_ID, strconv.Itoa(f.userInfo.ORGID))
+	req.Header.Set(ctrlcommon.HEADER_KEY_X_USER_ID, strconv.Itoa(f.userInfo.ID))
+	req.Header.Set(ctrlcommon.HEADER_KEY_X_USER_TYPE, strconv.Itoa(f.userInfo.Type))
+
+	// leave some time for the forwarding between servers
+	client := &http.Client{Timeout: time.Duration(timeout+5) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Data        string `json:"DATA"`
+		Description string `json:"DESCRIPTION"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response of %s, status: %s", url, resp.Status)
+	}
+	content := ""
+	if result.Data != "" {
+		if content, err = ctrlcommon.AesDecrypt(result.Data, cipherKey); err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return content, fmt.Errorf("%s (status: %s)", result.Description, resp.Status)
+	}
+	return content, nil
+}
+
+// createAudit saves the audit record of a request, resp is nil if the request is rejected or denied.
+func (f *FleetCMD) createAudit(dbInfo *metadb.DB, req *model.AgentCMDFleetRun, status, reason string, resp *model.AgentCMDFleetRunResponse, startedAt time.Time) (*metadbmodel.AgentCMDAudit, error) {
+	if resp == nil {
+		resp = &model.AgentCMDFleetRunResponse{}
+	}
+	limit := f.cfg.AgentFleetCMD.AuditOutputLimit
+	results := make([]model.AgentCMDAgentResult, len(resp.Results))
+	for i, result := range resp.Results {
+		if len(result.Output) > limit {
+			result.Output = strings.ToValidUTF8(result.Output[:limit], "")
+			result.Truncated = true
+		}
+		results[i] = result
+	}
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	paramsBytes, err := json.Marshal(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	if req.AgentGroup != "" {
+		targets = append(targets, "agent_group="+req.AgentGroup)
+	}
+	if req.Selector != "" {
+		targets = append(targets, "selector="+req.Selector)
+	}
+	audit := &metadbmodel.AgentCMDAudit{
+		UserID:     f.userInfo.ID,
+		UserType:   f.userInfo.Type,
+		CMD:        req.CMD,
+		Params:     string(paramsBytes),
+		Target:     strings.Join(targets, ", "),
+		Status:     status,
+		Reason:     reason,
+		AgentNum:   resp.AgentNum,
+		SuccessNum: resp.SuccessNum,
+		FailedNum:  resp.FailedNum,
+		Results:    string(resultsBytes),
+		StartedAt:  startedAt,
+		EndedAt:    time.Now(),
+		Lcuuid:     uuid.New().String(),
+	}
+	if err := dbInfo.Create(audit).Error; err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
+
+func (f *FleetCMD) GetAudits(query *model.AgentCMDAuditQuery) ([]*metadbmodel.AgentCMDAudit, error) {
+	dbInfo, err := metadb.GetDB(f.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	db := dbInfo.DB
+	limit := agentCMDAuditDefaultLimit
+	if query != nil {
+		if query.CMD != "" {
+			db = db.Where("cmd = ?", query.CMD)
+		}
+		if query.UserID != 0 {
+			db = db.Where("user_id = ?", query.UserID)
+		}
+		if query.Status != "" {
+			db = db.Where("status = ?", query.Status)
+		}
+		if query.Limit > 0 {
+			limit = query.Limit
+		}
+	}
+	var audits []*metadbmodel.AgentCMDAudit
+	// results are only returned by the detail api
+	if err := db.Omit("results").Order("id DESC").Limit(limit).Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (f *FleetCMD) GetAudit(id int) (*metadbmodel.AgentCMDAudit, error) {
+	dbInfo, err := metadb.GetDB(f.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	var audit *metadbmodel.AgentCMDAudit
+	if err := dbInfo.Where("id = ?", id).First(&audit).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent command audit(id: %d), error: %s", id, err.Error())
+	}
+	return audit, nil
+}
+
+type agentSelectorTerm struct {
+	key     string
+	value   string
+	negated bool
+}
+
+// AgentSelector selects agents by attributes, the format is the same as kubernetes label selector with equality
+// based requirements, e.g. `region=r1,os!=windows,name=node-*`, values support shell glob patterns.
+type AgentSelector []agentSelectorTerm
+
+var agentSelectorKeys = map[string]struct{}{
+	"name":          {},
+	"group":         {},
+	"region":        {},
+	"az":            {},
+	"os":            {},
+	"arch":          {},
+	"type":          {},
+	"state":         {},
+	"team_id":       {},
+	"revision":      {},
+	"ctrl_ip":       {},
+	"controller_ip": {},
+}
+
+func ParseAgentSelector(s string) (AgentSelector, error) {
+	var selector AgentSelector
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var term agentSelectorTerm
+		if i := strings.Index(item, "!="); i > 0 {
+			term = agentSelectorTerm{key: item[:i], value: item[i+2:], negated: true}
+		} else if i := strings.Index(item, "="); i > 0 {
+			term = agentSelectorTerm{key: item[:i], value: strings.TrimPrefix(item[i+1:], "=")}
+		} else {
+			return nil, fmt.Errorf("invalid selector requirement(%s), key=value or key!=value is expected", item)
+		}
+		term.key, term.value = strings.TrimSpace(term.key), strings.TrimSpace(term.value)
+		if _, ok := agentSelectorKeys[term.key]; !ok {
+			return nil, fmt.Errorf("unsupported selector key(%s)", term.key)
+		}
+		if _, err := path.Match(term.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid selector value(%s), error: %s", term.value, err.Error())
+		}
+		selector = append(selector, term)
+	}
+	return selector, nil
+}
+
+func (s AgentSelector) Match(attrs map[string]string) bool {
+	for _, term := range s {
+		matched, _ := path.Match(term.value, attrs[term.key])
+		if matched == term.negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (s AgentSelector) needGroupName() bool {
+	for _, term := range s {
+		if term.key == "group" {
+			return true
+		}
+	}
+	return false
+}
+
+func agentSelectorAttrs(agent *metadbmodel.VTap, groupNames map[string]string) map[string]string {
+	return map[string]string{
+		"name":          agent.Name,
+		"group":         groupNames[agent.VtapGroupLcuuid],
+		"region":        agent.Region,
+		"az":            agent.AZ,
+		"os":            agent.Os,
+		"arch":          agent.Arch,
+		"type":          strconv.Itoa(agent.Type),
+		"state":         strconv.Itoa(agent.State),
+		"team_id":       strconv.Itoa(agent.TeamID),
+		"revision":      agent.Revision,
+		"ctrl_ip":       agent.CtrlIP,
+		"controller_ip": agent.CurControllerIP,
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
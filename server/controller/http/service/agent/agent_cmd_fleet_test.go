@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAgentSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		wantErr  bool
+		wantLen  int
+	}{
+		{name: "empty selector", selector: "", wantLen: 0},
+		{name: "equality and inequality", selector: "region=r1, os!=windows", wantLen: 2},
+		{name: "double equal sign", selector: "name==node-1", wantLen: 1},
+		{name: "missing operator", selector: "region", wantErr: true},
+		{name: "unsupported key", selector: "label=x", wantErr: true},
+		{name: "invalid pattern", selector: "name=node-[", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseAgentSelector(tt.selector)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, selector, tt.wantLen)
+		})
+	}
+}
+
+func TestAgentSelector_Match(t *testing.T) {
+	attrs := map[string]string{
+		"name":   "node-1",
+		"group":  "default",
+		"region": "r1",
+		"os":     "linux",
+	}
+	tests := []struct {
+		name     string
+		selector string
+		expected bool
+	}{
+		{name: "empty selector matches all", selector: "", expected: true},
+		{name: "equal", selector: "region=r1", expected: true},
+		{name: "not equal", selector: "region=r2", expected: false},
+		{name: "glob", selector: "name=node-*", expected: true},
+		{name: "negated glob", selector: "name!=node-*", expected: false},
+		{name: "negated", selector: "os!=windows", expected: true},
+		{name: "all terms must match", selector: "group=default,os=windows", expected: false},
+		{name: "missing attribute", selector: "arch=x86_64", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseAgentSelector(tt.selector)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, selector.Match(attrs))
+		})
+	}
+}
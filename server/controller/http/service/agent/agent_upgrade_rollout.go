@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	ctrlcommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/model"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
+	"github.com/deepflowio/deepflow/server/controller/monitor/vtap"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+const (
+	upgradeRolloutDefaultWaves       = "1,10%,50%,100%"
+	upgradeRolloutDefaultWaveTimeout = 600
+	upgradeRolloutDefaultSoakTime    = 300
+)
+
+// UpgradeRollout manages the staged upgrades of the agents in an agent group, the rollouts are run by the
+// upgrade rollout check of the master controller. Creating and changing a rollout require the permission to
+// update the agent group.
+type UpgradeRollout struct {
+	cfg      *config.ControllerConfig
+	userInfo *model.UserInfo
+
+	resourceAccess *service.ResourceAccess
+}
+
+func NewUpgradeRollout(userInfo *model.UserInfo, cfg *config.ControllerConfig) *UpgradeRollout {
+	return &UpgradeRollout{
+		cfg:            cfg,
+		userInfo:       userInfo,
+		resourceAccess: service.NewResourceAccess(cfg.FPermit, common.NewUserInfo(userInfo.Type, userInfo.ID, userInfo.ORGID)),
+	}
+}
+
+func (u *UpgradeRollout) Create(req *model.AgentUpgradeRolloutCreate) (*metadbmodel.AgentUpgradeRollout, error) {
+	if req.WaveTimeout < 0 || req.SoakTime < 0 || req.MaxFailures < 0 {
+		return nil, errors.New("wave timeout, soak time and max failures should not be negative")
+	}
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := getAgentGroup(dbInfo, req.AgentGroup)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.resourceAccess.CanUpdateResource(group.TeamID,
+		ctrlcommon.SET_RESOURCE_TYPE_AGENT_GROUP, group.Lcuuid, nil); err != nil {
+		return nil, err
+	}
+	var rollouts []*metadbmodel.AgentUpgradeRollout
+	if err := dbInfo.Select("id", "state").Where("vtap_group_lcuuid = ?", group.Lcuuid).Find(&rollouts).Error; err != nil {
+		return nil, err
+	}
+	for _, rollout := range rollouts {
+		if vtap.IsRolloutActive(rollout.State) {
+			return nil, fmt.Errorf("agent group(%s) has an active rollout(id: %d, state: %s)", group.Name, rollout.ID, rollout.State)
+		}
+	}
+
+	var repo *metadbmodel.VTapRepo
+	if err := dbInfo.Select("name", "rev_count", "commit_id").Where("name = ?", req.ImageName).First(&repo).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent image(%s), error: %s", req.ImageName, err.Error())
+	}
+	if repo.RevCount == "" || repo.CommitID == "" {
+		return nil, fmt.Errorf("revision of agent image(%s) is unknown", req.ImageName)
+	}
+	expectedRevision := repo.RevCount + "-" + repo.CommitID
+
+	var vtaps []*metadbmodel.VTap
+	if err := dbInfo.Select("id", "name", "lcuuid", "revision").Where("vtap_group_lcuuid = ?", group.Lcuuid).Find(&vtaps).Error; err != nil {
+		return nil, err
+	}
+	waves := req.Waves
+	if waves == "" {
+		waves = upgradeRolloutDefaultWaves
+	}
+	agents, waveNum, err := vtap.PlanRolloutAgents(vtaps, expectedRevision, waves)
+	if err != nil {
+		return nil, err
+	}
+	if waveNum == 0 {
+		return nil, fmt.Errorf("no agent in agent group(%s) needs to be upgraded to revision %s", group.Name, expectedRevision)
+	}
+
+	rollout := &metadbmodel.AgentUpgradeRollout{
+		TeamID:           group.TeamID,
+		UserID:           u.userInfo.ID,
+		VTapGroupLcuuid:  group.Lcuuid,
+		ImageName:        req.ImageName,
+		ExpectedRevision: expectedRevision,
+		Waves:            waves,
+		WaveTimeout:      req.WaveTimeout,
+		SoakTime:         req.SoakTime,
+		MaxFailures:      req.MaxFailures,
+		State:            vtap.ROLLOUT_STATE_RUNNING,
+		Agents:           vtap.MarshalRolloutAgents(agents),
+		Lcuuid:           uuid.New().String(),
+	}
+	if rollout.WaveTimeout == 0 {
+		rollout.WaveTimeout = upgradeRolloutDefaultWaveTimeout
+	}
+	if rollout.SoakTime == 0 {
+		rollout.SoakTime = upgradeRolloutDefaultSoakTime
+	}
+	if req.AutoRollback {
+		rollout.AutoRollback = 1
+	}
+	if err := dbInfo.Create(rollout).Error; err != nil {
+		return nil, err
+	}
+	log.Infof("user(id: %d) created agent upgrade rollout(id: %d) of agent group(%s) to image(%s), waves: %s",
+		u.userInfo.ID, rollout.ID, group.Name, req.ImageName, waves, dbInfo.LogPrefixORGID)
+	return rollout, nil
+}
+
+func (u *UpgradeRollout) GetRollouts(query *model.AgentUpgradeRolloutQuery) ([]*metadbmodel.AgentUpgradeRollout, error) {
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	db := dbInfo.DB
+	if query != nil {
+		if query.AgentGroup != "" {
+			group, err := getAgentGroup(dbInfo, query.AgentGroup)
+			if err != nil {
+				return nil, err
+			}
+			db = db.Where("vtap_group_lcuuid = ?", group.Lcuuid)
+		}
+		if query.State != "" {
+			db = db.Where("state = ?", query.State)
+		}
+	}
+	var rollouts []*metadbmodel.AgentUpgradeRollout
+	// agents are only returned by the detail api
+	if err := db.Omit("agents").Order("id DESC").Find(&rollouts).Error; err != nil {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+func (u *UpgradeRollout) GetRollout(id int) (*metadbmodel.AgentUpgradeRollout, error) {
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	return getRollout(dbInfo, id)
+}
+
+func (u *UpgradeRollout) Pause(id int) (*metadbmodel.AgentUpgradeRollout, error) {
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.getUpdatableRollout(dbInfo, id); err != nil {
+		return nil, err
+	}
+	if err := u.transit(dbInfo, id, []string{vtap.ROLLOUT_STATE_RUNNING}, map[string]interface{}{
+		"state":   vtap.ROLLOUT_STATE_PAUSED,
+		"message": fmt.Sprintf("paused by user(id: %d)", u.userInfo.ID),
+	}); err != nil {
+		return nil, err
+	}
+	return getRollout(dbInfo, id)
+}
+
+// Resume continues the paused rollout from the current wave, the failed agents are upgraded again.
+func (u *UpgradeRollout) Resume(id int) (*metadbmodel.AgentUpgradeRollout, error) {
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	rollout, err := u.getUpdatableRollout(dbInfo, id)
+	if err != nil {
+		return nil, err
+	}
+	if rollout.State != vtap.ROLLOUT_STATE_PAUSED {
+		return nil, fmt.Errorf("rollout(id: %d) is %s, only %s rollout can be resumed", id, rollout.State, vtap.ROLLOUT_STATE_PAUSED)
+	}
+	agents, err := vtap.UnmarshalRolloutAgents(rollout.Agents)
+	if err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		if agent.Status == vtap.ROLLOUT_AGENT_FAILED {
+			agent.Status, agent.Error = vtap.ROLLOUT_AGENT_PENDING, ""
+		}
+	}
+	if err := u.transit(dbInfo, id, []string{vtap.ROLLOUT_STATE_PAUSED}, map[string]interface{}{
+		"state":           vtap.ROLLOUT_STATE_RUNNING,
+		"message":         "",
+		"agents":          vtap.MarshalRolloutAgents(agents),
+		"wave_started_at": nil,
+		"wave_healthy_at": nil,
+	}); err != nil {
+		return nil, err
+	}
+	return getRollout(dbInfo, id)
+}
+
+// Abort stops the rollout and cancels the upgrades not finished yet, the upgraded agents are rolled back
+// by the upgrade rollout check if rollback is true. The agents never dispatched are kept PENDING.
+// A rollout stuck in ROLLING_BACK, e.g. the image of the previous revision is deleted, can be aborted
+// without rollback.
+func (u *UpgradeRollout) Abort(id int, rollback bool) (*metadbmodel.AgentUpgradeRollout, error) {
+	dbInfo, err := metadb.GetDB(u.userInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.getUpdatableRollout(dbInfo, id); err != nil {
+		return nil, err
+	}
+	states := []string{vtap.ROLLOUT_STATE_RUNNING, vtap.ROLLOUT_STATE_PAUSED}
+	state, message := vtap.ROLLOUT_STATE_ABORTED, fmt.Sprintf("aborted by user(id: %d)", u.userInfo.ID)
+	if rollback {
+		state, message = vtap.ROLLOUT_STATE_ROLLING_BACK, fmt.Sprintf("rolled back by user(id: %d)", u.userInfo.ID)
+	} else {
+		states = append(states, vtap.ROLLOUT_STATE_ROLLING_BACK)
+	}
+	if err := u.transit(dbInfo, id, states, map[string]interface{}{
+		"state":   state,
+		"message": message,
+	}); err != nil {
+		return nil, err
+	}
+	rollout, err := getRollout(dbInfo, id)
+	if err != nil || rollback {
+		return rollout, err
+	}
+
+	agents, err := vtap.UnmarshalRolloutAgents(rollout.Agents)
+	if err != nil {
+		return nil, err
+	}
+	// the upgrades are sent after the agents are saved as UPGRADING, and the ones of the agents failed by the wave
+	// timeout may still be going on, the upgrades sent by the rollout check meanwhile are canceled by the check
+	for _, agent := range agents {
+		if agent.Status != vtap.ROLLOUT_AGENT_UPGRADING && agent.Status != vtap.ROLLOUT_AGENT_FAILED {
+			continue
+		}
+		if err := refresh.UpgradeVTap(u.userInfo.ORGID, agent.Lcuuid, ""); err != nil {
+			agent.Error = fmt.Sprintf("cancel upgrade failed: %s", err.Error())
+			continue
+		}
+		agent.Status, agent.Error = vtap.ROLLOUT_AGENT_CANCELED, ""
+	}
+	rollout.Agents = vtap.MarshalRolloutAgents(agents)
+	if err := dbInfo.Model(rollout).Updates(map[string]interface{}{"agents": rollout.Agents, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// transit updates the rollout only if it is in one of the states, so that the changes of the upgrade rollout
+// check meanwhile are not overwritten
+func (u *UpgradeRollout) transit(dbInfo *metadb.DB, id int, states []string, updates map[string]interface{}) error {
+	rollout, err := getRollout(dbInfo, id)
+	if err != nil {
+		return err
+	}
+	updates["updated_at"] = time.Now()
+	result := dbInfo.Model(&metadbmodel.AgentUpgradeRollout{}).Where("id = ? AND state IN ?", id, states).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("rollout(id: %d) is %s, expected state: %v", id, rollout.State, states)
+	}
+	log.Infof("user(id: %d) changed agent upgrade rollout(id: %d) state from %s to %s",
+		u.userInfo.ID, id, rollout.State, updates["state"], dbInfo.LogPrefixORGID)
+	return nil
+}
+
+// getUpdatableRollout returns the rollout if the user has the permission to update its agent group
+func (u *UpgradeRollout) getUpdatableRollout(dbInfo *metadb.DB, id int) (*metadbmodel.AgentUpgradeRollout, error) {
+	rollout, err := getRollout(dbInfo, id)
+	if err != nil {
+		return nil, err
+	}
+	teamID := rollout.TeamID
+	var group *metadbmodel.VTapGroup
+	if err := dbInfo.Select("team_id").Where("lcuuid = ?", rollout.VTapGroupLcuuid).First(&group).Error; err == nil {
+		teamID = group.TeamID
+	}
+	if err := u.resourceAccess.CanUpdateResource(teamID,
+		ctrlcommon.SET_RESOURCE_TYPE_AGENT_GROUP, rollout.VTapGroupLcuuid, nil); err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+func getRollout(dbInfo *metadb.DB, id int) (*metadbmodel.AgentUpgradeRollout, error) {
+	var rollout *metadbmodel.AgentUpgradeRollout
+	if err := dbInfo.Where("id = ?", id).First(&rollout).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent upgrade rollout(id: %d), error: %s", id, err.Error())
+	}
+	return rollout, nil
+}
+
+func getAgentGroup(dbInfo *metadb.DB, agentGroup string) (*metadbmodel.VTapGroup, error) {
+	var group *metadbmodel.VTapGroup
+	if err := dbInfo.Where("name = ? OR lcuuid = ? OR short_uuid = ?", agentGroup, agentGroup, agentGroup).First(&group).Error; err != nil {
+		return nil, fmt.Errorf("failed to get agent group(%s), error: %s", agentGroup, err.Error())
+	}
+	return group, nil
+}
@@ -0,0 +1,127 @@
+/**
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/http/auth"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+func apiTokenToModel(t *metadbmodel.APIToken) model.APIToken {
+	return model.APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Role:       t.Role,
+		OrgID:      t.OrgID,
+		UserID:     t.UserID,
+		Prefix:     t.Prefix,
+		ExpiredAt:  t.ExpiredAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+		Lcuuid:     t.Lcuuid,
+	}
+}
+
+// GetAPITokens returns the tokens of the org, super admin gets the tokens of all orgs.
+// All tokens are stored in the default db.
+func GetAPITokens(orgID, userType int) ([]model.APIToken, error) {
+	var tokens []metadbmodel.APIToken
+	db := metadb.DefaultDB.DB
+	if userType != common.USER_TYPE_SUPER_ADMIN {
+		db = db.Where("org_id = ?", orgID)
+	}
+	if err := db.Order("id").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]model.APIToken, 0, len(tokens))
+	for i := range tokens {
+		resp = append(resp, apiTokenToModel(&tokens[i]))
+	}
+	return resp, nil
+}
+
+// CreateAPIToken creates a token, the token is only returned in the response of creation
+func CreateAPIToken(orgID, userType, userID int, tokenCreate model.APITokenCreate) (model.APIToken, error) {
+	role, err := auth.ParseRole(tokenCreate.Role)
+	if err != nil {
+		return model.APIToken{}, response.ServiceError(httpcommon.INVALID_PARAMETERS, err.Error())
+	}
+	tokenOrgID := orgID
+	if tokenCreate.OrgID != nil {
+		tokenOrgID = *tokenCreate.OrgID
+	}
+	if tokenOrgID != orgID && userType != common.USER_TYPE_SUPER_ADMIN {
+		return model.APIToken{}, response.ServiceError(httpcommon.NO_PERMISSIONS, fmt.Sprintf("only super admin can create token of org (%d)", tokenOrgID))
+	}
+	if tokenOrgID == auth.ALL_ORGS && role != auth.ROLE_ADMIN {
+		return model.APIToken{}, response.ServiceError(httpcommon.INVALID_PARAMETERS, "token of all orgs must be admin")
+	}
+
+	token, prefix, hash, err := auth.GenerateToken()
+	if err != nil {
+		return model.APIToken{}, response.ServiceError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	apiToken := metadbmodel.APIToken{
+		Name:      tokenCreate.Name,
+		OrgID:     tokenOrgID,
+		Role:      role.String(),
+		UserID:    userID,
+		TokenHash: hash,
+		Prefix:    prefix,
+		CreatedAt: time.Now(),
+		Lcuuid:    uuid.New().String(),
+	}
+	if tokenCreate.ExpireDays > 0 {
+		expiredAt := apiToken.CreatedAt.Add(time.Duration(tokenCreate.ExpireDays) * 24 * time.Hour)
+		apiToken.ExpiredAt = &expiredAt
+	}
+	if err := metadb.DefaultDB.Create(&apiToken).Error; err != nil {
+		return model.APIToken{}, err
+	}
+	log.Infof("create api token (%s) of org (%d) with role %s by user (%d)", apiToken.Name, apiToken.OrgID, apiToken.Role, userID)
+
+	resp := apiTokenToModel(&apiToken)
+	resp.Token = token
+	return resp, nil
+}
+
+// DeleteAPIToken revokes the token, it may still be accepted until the token cache of each controller expires
+func DeleteAPIToken(orgID, userType int, lcuuid string) (map[string]string, error) {
+	var apiToken metadbmodel.APIToken
+	db := metadb.DefaultDB.Where("lcuuid = ?", lcuuid)
+	if userType != common.USER_TYPE_SUPER_ADMIN {
+		db = db.Where("org_id = ?", orgID)
+	}
+	if err := db.First(&apiToken).Error; err != nil {
+		return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("api token (%s) not found", lcuuid))
+	}
+	if err := metadb.DefaultDB.Delete(&apiToken).Error; err != nil {
+		return nil, err
+	}
+	log.Infof("delete api token (%s) of org (%d)", apiToken.Name, apiToken.OrgID)
+	return map[string]string{"LCUUID": lcuuid}, nil
+}
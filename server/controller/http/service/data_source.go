@@ -234,10 +234,11 @@ func (d *DataSource) GetDataSources(orgID int, filter map[string]interface{}, sp
 				dataSource.DataTableCollection == "deepflow_admin.*" {
 				dataSourceResp.IntervalTime = common.DATA_SOURCE_DEEPFLOW_SYSTEM_INTERVAL
 			}
-			if dataSource.DataTableCollection == "ext_metrics.*" {
+			// the rollups of ext_metrics/prometheus keep their own interval
+			if dataSource.DataTableCollection == "ext_metrics.*" && dataSource.IntervalTime == 0 {
 				dataSourceResp.IntervalTime = specCfg.DataSourceExtMetricsInterval
 			}
-			if dataSource.DataTableCollection == "prometheus.*" {
+			if dataSource.DataTableCollection == "prometheus.*" && dataSource.IntervalTime == 0 {
 				dataSourceResp.IntervalTime = specCfg.DataSourcePrometheusInterval
 			}
 		}
@@ -312,6 +313,10 @@ func (d *DataSource) CreateDataSource(orgID int, dataSourceCreate *model.DataSou
 		)
 	}
 
+	if err := checkRollupDataSource(dataSourceCreate, baseDataSource); err != nil {
+		return model.DataSource{}, err
+	}
+
 	if baseDataSource.SummableMetricsOperator == "Sum" && dataSourceCreate.SummableMetricsOperator != "Sum" {
 		return model.DataSource{}, response.ServiceError(
 			httpcommon.PARAMETER_ILLEGAL,
@@ -717,6 +722,38 @@ func (d *DataSource) CallIngesterAPIDelRP(orgID int, ip string, dataSource metad
 	return err
 }
 
+func isRollupCollection(collection string) bool {
+	return collection == common.DATA_SOURCE_PROMETHEUS || collection == common.DATA_SOURCE_EXT_METRICS
+}
+
+// prometheus.* and ext_metrics.* rollups could only be 1h/1d and aggregated from the raw data_source,
+// the 'Last' operator is only supported by them.
+func checkRollupDataSource(dataSourceCreate *model.DataSourceCreate, baseDataSource metadbmodel.DataSource) error {
+	if !isRollupCollection(dataSourceCreate.DataTableCollection) {
+		if dataSourceCreate.UnSummableMetricsOperator == "Last" {
+			return response.ServiceError(
+				httpcommon.PARAMETER_ILLEGAL,
+				fmt.Sprintf("unsummable_metrics_operator Last only support %s and %s",
+					common.DATA_SOURCE_PROMETHEUS, common.DATA_SOURCE_EXT_METRICS),
+			)
+		}
+		return nil
+	}
+	if dataSourceCreate.IntervalTime != common.INTERVAL_1HOUR && dataSourceCreate.IntervalTime != common.INTERVAL_1DAY {
+		return response.ServiceError(
+			httpcommon.PARAMETER_ILLEGAL,
+			fmt.Sprintf("interval_time of %s should be 1 hour or 1 day", dataSourceCreate.DataTableCollection),
+		)
+	}
+	if baseDataSource.IntervalTime != 0 {
+		return response.ServiceError(
+			httpcommon.PARAMETER_ILLEGAL,
+			fmt.Sprintf("base data_source of %s should be the original data_source", dataSourceCreate.DataTableCollection),
+		)
+	}
+	return nil
+}
+
 func getName(interval_time int, collection string) (string, error) {
 	switch interval_time {
 	case 0:
@@ -581,3 +581,49 @@ END;
 		}
 	}
 }
+
+func TestCheckRollupDataSource(t *testing.T) {
+	rawPrometheus := metadbmodel.DataSource{DataTableCollection: common.DATA_SOURCE_PROMETHEUS, IntervalTime: 0}
+	tests := []struct {
+		name    string
+		create  model.DataSourceCreate
+		base    metadbmodel.DataSource
+		wantErr bool
+	}{
+		{
+			name:   "prometheus 1h rollup",
+			create: model.DataSourceCreate{DataTableCollection: common.DATA_SOURCE_PROMETHEUS, IntervalTime: common.INTERVAL_1HOUR, UnSummableMetricsOperator: "Last"},
+			base:   rawPrometheus,
+		},
+		{
+			name:   "ext_metrics 1d rollup",
+			create: model.DataSourceCreate{DataTableCollection: common.DATA_SOURCE_EXT_METRICS, IntervalTime: common.INTERVAL_1DAY, UnSummableMetricsOperator: "Avg"},
+			base:   metadbmodel.DataSource{DataTableCollection: common.DATA_SOURCE_EXT_METRICS},
+		},
+		{
+			name:    "rollup 1m interval",
+			create:  model.DataSourceCreate{DataTableCollection: common.DATA_SOURCE_PROMETHEUS, IntervalTime: common.INTERVAL_1MINUTE, UnSummableMetricsOperator: "Avg"},
+			base:    rawPrometheus,
+			wantErr: true,
+		},
+		{
+			name:    "rollup based on rollup",
+			create:  model.DataSourceCreate{DataTableCollection: common.DATA_SOURCE_PROMETHEUS, IntervalTime: common.INTERVAL_1DAY, UnSummableMetricsOperator: "Avg"},
+			base:    metadbmodel.DataSource{DataTableCollection: common.DATA_SOURCE_PROMETHEUS, IntervalTime: common.INTERVAL_1HOUR},
+			wantErr: true,
+		},
+		{
+			name:    "flow_metrics last",
+			create:  model.DataSourceCreate{DataTableCollection: common.DATA_SOURCE_NETWORK, IntervalTime: common.INTERVAL_1HOUR, UnSummableMetricsOperator: "Last"},
+			base:    metadbmodel.DataSource{DataTableCollection: common.DATA_SOURCE_NETWORK, IntervalTime: common.INTERVAL_1MINUTE},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRollupDataSource(&tt.create, tt.base); (err != nil) != tt.wantErr {
+				t.Errorf("checkRollupDataSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
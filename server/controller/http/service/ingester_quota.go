@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/libs/quota"
+)
+
+// GetIngesterQuotas returns the quotas of the org, the ingesters sync them periodically by
+// the grpc GetIngesterQuotas
+func GetIngesterQuotas(db *metadb.DB, filter map[string]interface{}) ([]model.IngesterQuota, error) {
+	var quotas []metadbmodel.IngesterQuota
+	Db := db.DB
+	for _, param := range []string{"lcuuid", "team_id"} {
+		if _, ok := filter[param]; ok {
+			Db = Db.Where(fmt.Sprintf("%s = ?", param), filter[param])
+		}
+	}
+	if err := Db.Order("team_id").Find(&quotas).Error; err != nil {
+		return nil, response.ServiceError(httpcommon.SERVER_ERROR, fmt.Sprintf("fail to query ingester quotas, error: %s", err))
+	}
+	resp := make([]model.IngesterQuota, 0, len(quotas))
+	for _, q := range quotas {
+		rowsPerDay := map[string]int64{}
+		if q.RowsPerDay != "" {
+			if err := json.Unmarshal([]byte(q.RowsPerDay), &rowsPerDay); err != nil {
+				log.Warningf("invalid rows_per_day of ingester quota (team %d): %s", q.TeamID, err, db.LogPrefixORGID)
+			}
+		}
+		resp = append(resp, model.IngesterQuota{
+			ID:                q.ID,
+			TeamID:            q.TeamID,
+			MessagesPerSecond: q.MessagesPerSecond,
+			BytesPerSecond:    q.BytesPerSecond,
+			Action:            q.Action,
+			RowsPerDay:        rowsPerDay,
+			UpdatedAt:         q.UpdatedAt.Format(common.GO_BIRTHDAY),
+			Lcuuid:            q.Lcuuid,
+		})
+	}
+	return resp, nil
+}
+
+// validateIngesterQuota checks the quota in the same way as the ingesters, and returns
+// the rows per day in json
+func validateIngesterQuota(orgID int, q *metadbmodel.IngesterQuota, rowsPerDay map[string]int64) (string, error) {
+	if q.TeamID < 0 || int64(q.TeamID) > 0xffffffff {
+		return "", fmt.Errorf("invalid team id %d", q.TeamID)
+	}
+	limit := &quota.Limit{
+		OrgId:             uint16(orgID),
+		TeamId:            uint32(q.TeamID),
+		MessagesPerSecond: q.MessagesPerSecond,
+		BytesPerSecond:    q.BytesPerSecond,
+	}
+	action, err := quota.ParseAction(q.Action)
+	if err != nil {
+		return "", err
+	}
+	limit.Action = action
+	for name, rows := range rowsPerDay {
+		ds, err := quota.ParseDatasource(name)
+		if err != nil {
+			return "", err
+		}
+		limit.RowsPerDay[ds] = rows
+	}
+	if err := limit.Validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(rowsPerDay)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func CreateIngesterQuota(db *metadb.DB, quotaCreate model.IngesterQuotaCreate) (model.IngesterQuota, error) {
+	var quotaFirst metadbmodel.IngesterQuota
+	if err := db.Where("team_id = ?", quotaCreate.TeamID).First(&quotaFirst).Error; err == nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.RESOURCE_ALREADY_EXIST,
+			fmt.Sprintf("ingester quota of team %d already exists", quotaCreate.TeamID))
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.SERVER_ERROR,
+			fmt.Sprintf("fail to query ingester quota of team %d, error: %s", quotaCreate.TeamID, err))
+	}
+
+	q := &metadbmodel.IngesterQuota{
+		TeamID:            quotaCreate.TeamID,
+		MessagesPerSecond: quotaCreate.MessagesPerSecond,
+		BytesPerSecond:    quotaCreate.BytesPerSecond,
+		Action:            quotaCreate.Action,
+		Lcuuid:            uuid.New().String(),
+	}
+	if q.Action == "" {
+		q.Action = quota.ACTION_THROTTLE.String()
+	}
+	rowsPerDay, err := validateIngesterQuota(db.ORGID, q, quotaCreate.RowsPerDay)
+	if err != nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.INVALID_PARAMETERS, err.Error())
+	}
+	q.RowsPerDay = rowsPerDay
+	if err := db.Create(q).Error; err != nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.SERVER_ERROR,
+			fmt.Sprintf("fail to create ingester quota of team %d, error: %s", q.TeamID, err))
+	}
+	log.Infof("create ingester quota of team %d", q.TeamID, db.LogPrefixORGID)
+
+	quotas, err := GetIngesterQuotas(db, map[string]interface{}{"lcuuid": q.Lcuuid})
+	if err != nil || len(quotas) == 0 {
+		return model.IngesterQuota{}, err
+	}
+	return quotas[0], nil
+}
+
+func UpdateIngesterQuota(db *metadb.DB, lcuuid string, quotaUpdate model.IngesterQuotaUpdate) (model.IngesterQuota, error) {
+	var q metadbmodel.IngesterQuota
+	if err := db.Where("lcuuid = ?", lcuuid).First(&q).Error; err != nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("ingester quota (%s) not found", lcuuid))
+	}
+
+	rowsPerDay := map[string]int64{}
+	if quotaUpdate.RowsPerDay != nil {
+		rowsPerDay = quotaUpdate.RowsPerDay
+	} else if q.RowsPerDay != "" {
+		json.Unmarshal([]byte(q.RowsPerDay), &rowsPerDay)
+	}
+	if quotaUpdate.MessagesPerSecond != nil {
+		q.MessagesPerSecond = *quotaUpdate.MessagesPerSecond
+	}
+	if quotaUpdate.BytesPerSecond != nil {
+		q.BytesPerSecond = *quotaUpdate.BytesPerSecond
+	}
+	if quotaUpdate.Action != nil {
+		q.Action = *quotaUpdate.Action
+	}
+	data, err := validateIngesterQuota(db.ORGID, &q, rowsPerDay)
+	if err != nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.INVALID_PARAMETERS, err.Error())
+	}
+	dbUpdateMap := map[string]interface{}{
+		"messages_per_second": q.MessagesPerSecond,
+		"bytes_per_second":    q.BytesPerSecond,
+		"action":              q.Action,
+		"rows_per_day":        data,
+	}
+	if err := db.Model(&q).Updates(dbUpdateMap).Error; err != nil {
+		return model.IngesterQuota{}, response.ServiceError(httpcommon.SERVER_ERROR,
+			fmt.Sprintf("fail to update ingester quota (%s), error: %s", lcuuid, err))
+	}
+	log.Infof("update ingester quota of team %d: %v", q.TeamID, dbUpdateMap, db.LogPrefixORGID)
+
+	quotas, err := GetIngesterQuotas(db, map[string]interface{}{"lcuuid": lcuuid})
+	if err != nil || len(quotas) == 0 {
+		return model.IngesterQuota{}, err
+	}
+	return quotas[0], nil
+}
+
+func DeleteIngesterQuota(db *metadb.DB, lcuuid string) (map[string]string, error) {
+	var q metadbmodel.IngesterQuota
+	if err := db.Where("lcuuid = ?", lcuuid).First(&q).Error; err != nil {
+		return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("ingester quota (%s) not found", lcuuid))
+	}
+	if err := db.Delete(&q).Error; err != nil {
+		return nil, response.ServiceError(httpcommon.SERVER_ERROR,
+			fmt.Sprintf("fail to delete ingester quota (%s), error: %s", lcuuid, err))
+	}
+	log.Infof("delete ingester quota of team %d", q.TeamID, db.LogPrefixORGID)
+	return map[string]string{"LCUUID": lcuuid}, nil
+}
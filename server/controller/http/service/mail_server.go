@@ -29,11 +29,11 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/model"
 )
 
-func GetMailServer(filter map[string]interface{}) (resp []model.MailServer, err error) {
+func GetMailServer(db *metadb.DB, filter map[string]interface{}) (resp []model.MailServer, err error) {
 	var response []model.MailServer
 	var mails []metadbmodel.MailServer
 
-	Db := metadb.DefaultDB.DB
+	Db := db.DB
 	for _, param := range []string{"lcuuid"} {
 		if _, ok := filter[param]; ok {
 			Db = Db.Where(fmt.Sprintf("%s = ?", param), filter[param])
@@ -63,7 +63,7 @@ func GetMailServer(filter map[string]interface{}) (resp []model.MailServer, err
 	return response, nil
 }
 
-func CreateMailServer(mailCreate model.MailServerCreate) (model.MailServer, error) {
+func CreateMailServer(db *metadb.DB, mailCreate model.MailServerCreate) (model.MailServer, error) {
 	mailServer := metadbmodel.MailServer{}
 	mailServer.Status = mailCreate.Status
 	mailServer.Host = mailCreate.Host
@@ -75,18 +75,18 @@ func CreateMailServer(mailCreate model.MailServerCreate) (model.MailServer, erro
 	mailServer.NtlmName = mailCreate.NtlmName
 	mailServer.NtlmPassword = mailCreate.NtlmPassword
 	mailServer.Lcuuid = uuid.New().String()
-	metadb.DefaultDB.Create(&mailServer)
+	db.Create(&mailServer)
 
-	response, err := GetMailServer(map[string]interface{}{"lcuuid": mailServer.Lcuuid})
+	response, err := GetMailServer(db, map[string]interface{}{"lcuuid": mailServer.Lcuuid})
 	return response[0], err
 }
 
-func UpdateMailServer(lcuuid string, mailServerUpdate map[string]interface{}) (model.MailServer, error) {
+func UpdateMailServer(db *metadb.DB, lcuuid string, mailServerUpdate map[string]interface{}) (model.MailServer, error) {
 	var mailServer metadbmodel.MailServer
 	var dbUpdateMap = make(map[string]interface{})
 
 	if lcuuid != "" {
-		if ret := metadb.DefaultDB.Where("lcuuid = ?", lcuuid).First(&mailServer); ret.Error != nil {
+		if ret := db.Where("lcuuid = ?", lcuuid).First(&mailServer); ret.Error != nil {
 			return model.MailServer{}, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("mailServer (%s) not found", lcuuid))
 		}
 	} else {
@@ -103,22 +103,22 @@ func UpdateMailServer(lcuuid string, mailServerUpdate map[string]interface{}) (m
 	if _, ok := mailServerUpdate["USER"]; ok {
 		dbUpdateMap["user_name"] = mailServerUpdate["USER"]
 	}
-	metadb.DefaultDB.Model(&mailServer).Updates(dbUpdateMap)
+	db.Model(&mailServer).Updates(dbUpdateMap)
 
-	response, err := GetMailServer(map[string]interface{}{"lcuuid": mailServer.Lcuuid})
+	response, err := GetMailServer(db, map[string]interface{}{"lcuuid": mailServer.Lcuuid})
 	return response[0], err
 }
 
-func DeleteMailServer(lcuuid string) (map[string]string, error) {
+func DeleteMailServer(db *metadb.DB, lcuuid string) (map[string]string, error) {
 	var mailServer metadbmodel.MailServer
 
-	if ret := metadb.DefaultDB.Where("lcuuid = ?", lcuuid).First(&mailServer); ret.Error != nil {
+	if ret := db.Where("lcuuid = ?", lcuuid).First(&mailServer); ret.Error != nil {
 		return map[string]string{}, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("mail-server (%s) not found", lcuuid))
 	}
 
 	log.Infof("delete mail server (%s)", mailServer.UserName)
 
-	metadb.DefaultDB.Delete(&mailServer)
+	db.Delete(&mailServer)
 	return map[string]string{"LCUUID": lcuuid}, nil
 
 }
@@ -278,13 +278,13 @@ type DataSource struct {
 
 type DataSourceCreate struct {
 	DisplayName               string `json:"DISPLAY_NAME" binding:"required,min=1,max=10"`
-	DataTableCollection       string `json:"DATA_TABLE_COLLECTION" binding:"required,oneof=flow_metrics.network* flow_metrics.application*"`
+	DataTableCollection       string `json:"DATA_TABLE_COLLECTION" binding:"required,oneof=flow_metrics.network* flow_metrics.application* prometheus.* ext_metrics.*"`
 	BaseDataSourceID          int    `json:"BASE_DATA_SOURCE_ID" binding:"required"`
 	IntervalTime              int    `json:"INTERVAL" binding:"required"`
 	RetentionTime             int    `json:"RETENTION_TIME" binding:"required,min=1"`
 	QueryTime                 int    `json:"QUERY_TIME"`
 	SummableMetricsOperator   string `json:"SUMMABLE_METRICS_OPERATOR" binding:"required,oneof=Sum Max Min"`
-	UnSummableMetricsOperator string `json:"UNSUMMABLE_METRICS_OPERATOR" binding:"required,oneof=Avg Max Min"`
+	UnSummableMetricsOperator string `json:"UNSUMMABLE_METRICS_OPERATOR" binding:"required,oneof=Avg Max Min Last"`
 }
 
 type DataSourceUpdate struct {
@@ -864,3 +864,50 @@ type MailServer struct {
 	NtlmPassword string `json:"NTLM_PASSWORD"`
 	Lcuuid       string `json:"LCUUID"`
 }
+
+type IngesterQuotaCreate struct {
+	TeamID            int              `json:"TEAM_ID" binding:"min=0"` // 0 means the whole org
+	MessagesPerSecond int64            `json:"MESSAGES_PER_SECOND" binding:"min=0"`
+	BytesPerSecond    int64            `json:"BYTES_PER_SECOND" binding:"min=0"`
+	Action            string           `json:"ACTION"`       // throttle or drop, defaults to throttle
+	RowsPerDay        map[string]int64 `json:"ROWS_PER_DAY"` // datasource: rows
+}
+
+type IngesterQuotaUpdate struct {
+	MessagesPerSecond *int64           `json:"MESSAGES_PER_SECOND" binding:"omitempty,min=0"`
+	BytesPerSecond    *int64           `json:"BYTES_PER_SECOND" binding:"omitempty,min=0"`
+	Action            *string          `json:"ACTION"`
+	RowsPerDay        map[string]int64 `json:"ROWS_PER_DAY"`
+}
+
+type IngesterQuota struct {
+	ID                int              `json:"ID"`
+	TeamID            int              `json:"TEAM_ID"`
+	MessagesPerSecond int64            `json:"MESSAGES_PER_SECOND"`
+	BytesPerSecond    int64            `json:"BYTES_PER_SECOND"`
+	Action            string           `json:"ACTION"`
+	RowsPerDay        map[string]int64 `json:"ROWS_PER_DAY"`
+	UpdatedAt         string           `json:"UPDATED_AT"`
+	Lcuuid            string           `json:"LCUUID"`
+}
+
+type APITokenCreate struct {
+	Name       string `json:"NAME" binding:"required"`
+	Role       string `json:"ROLE" binding:"required"`     // viewer, operator or admin
+	OrgID      *int   `json:"ORG_ID"`                      // defaults to the org of the request, 0 means all orgs
+	ExpireDays int    `json:"EXPIRE_DAYS" binding:"min=0"` // 0 means never expire
+}
+
+type APIToken struct {
+	ID         int        `json:"ID"`
+	Name       string     `json:"NAME"`
+	Role       string     `json:"ROLE"`
+	OrgID      int        `json:"ORG_ID"`
+	UserID     int        `json:"USER_ID"`
+	Prefix     string     `json:"PREFIX"`
+	Token      string     `json:"TOKEN,omitempty"` // only returned when the token is created
+	ExpiredAt  *time.Time `json:"EXPIRED_AT"`
+	LastUsedAt *time.Time `json:"LAST_USED_AT"`
+	CreatedAt  time.Time  `json:"CREATED_AT"`
+	Lcuuid     string     `json:"LCUUID"`
+}
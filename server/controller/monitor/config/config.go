@@ -27,6 +27,7 @@ type MonitorConfig struct {
 	LicenseCheckInterval        int                           `default:"60" yaml:"license_check_interval"`
 	BillCheckInterval           int                           `default:"3600" yaml:"bill_check_interval"`
 	VTapCheckInterval           int                           `default:"60" yaml:"vtap_check_interval"`
+	UpgradeRolloutCheckInterval int                           `default:"30" yaml:"upgrade_rollout_check_interval"`
 	ExceptionTimeFrame          int                           `default:"3600" yaml:"exception_time_frame"`
 	AutoRebalanceVTap           bool                          `default:"true" yaml:"auto_rebalance_vtap"`
 	RebalanceCheckInterval      int                           `default:"300" yaml:"rebalance_check_interval"` // unit: second
@@ -0,0 +1,566 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/message/agent"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/monitor/config"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+const (
+	ROLLOUT_STATE_RUNNING      = "RUNNING"
+	ROLLOUT_STATE_PAUSED       = "PAUSED"
+	ROLLOUT_STATE_COMPLETED    = "COMPLETED"
+	ROLLOUT_STATE_ABORTED      = "ABORTED"
+	ROLLOUT_STATE_ROLLING_BACK = "ROLLING_BACK"
+	ROLLOUT_STATE_ROLLED_BACK  = "ROLLED_BACK"
+
+	ROLLOUT_AGENT_PENDING     = "PENDING"     // waiting for its wave
+	ROLLOUT_AGENT_UPGRADING   = "UPGRADING"   // the upgrade is dispatched, waiting for the agent to be healthy
+	ROLLOUT_AGENT_HEALTHY     = "HEALTHY"     // running the expected revision without gate exceptions
+	ROLLOUT_AGENT_FAILED      = "FAILED"      // not healthy before the wave timeout
+	ROLLOUT_AGENT_SKIPPED     = "SKIPPED"     // already running the expected revision when the rollout is created
+	ROLLOUT_AGENT_CANCELED    = "CANCELED"    // the upgrade is canceled by abort or rollback
+	ROLLOUT_AGENT_ROLLED_BACK = "ROLLED_BACK" // upgraded to the image of the previous revision
+
+	// the agent exceptions failing the health gate: self check failures, invalid config, circuit breakers and
+	// socket errors, the rate limit exceptions do not mean the agent is unhealthy
+	ROLLOUT_GATE_EXCEPTIONS = int64(agent.Exception_DISK_NOT_ENOUGH) |
+		int64(agent.Exception_MEM_NOT_ENOUGH) |
+		int64(agent.Exception_COREFILE_TOO_MANY) |
+		int64(agent.Exception_INVALID_CONFIGURATION) |
+		int64(agent.Exception_THREAD_THRESHOLD_EXCEEDED) |
+		int64(agent.Exception_PROCESS_THRESHOLD_EXCEEDED) |
+		int64(agent.Exception_FREE_MEM_EXCEEDED) |
+		int64(agent.Exception_CONTROLLER_SOCKET_ERROR) |
+		int64(agent.Exception_ANALYZER_SOCKET_ERROR) |
+		int64(agent.Exception_CGROUPS_CONFIG_ERROR) |
+		int64(agent.Exception_SYSTEM_LOAD_CIRCUIT_BREAKER) |
+		int64(agent.Exception_FREE_DISK_CIRCUIT_BREAKER) |
+		int64(agent.Exception_KERNEL_VERSION_CIRCUIT_BREAKER)
+)
+
+// IsRolloutActive returns whether the rollout may still upgrade agents, only one active rollout is allowed in an agent group
+func IsRolloutActive(state string) bool {
+	return state == ROLLOUT_STATE_RUNNING || state == ROLLOUT_STATE_PAUSED || state == ROLLOUT_STATE_ROLLING_BACK
+}
+
+// RolloutAgent is the status of an agent in a rollout, saved as json in agent_upgrade_rollout.agents
+type RolloutAgent struct {
+	ID               int    `json:"ID"`
+	Name             string `json:"NAME"`
+	Lcuuid           string `json:"LCUUID"`
+	Wave             int    `json:"WAVE"`
+	PreviousRevision string `json:"PREVIOUS_REVISION"`
+	Status           string `json:"STATUS"`
+	Error            string `json:"ERROR,omitempty"`
+}
+
+func UnmarshalRolloutAgents(s string) ([]*RolloutAgent, error) {
+	var agents []*RolloutAgent
+	if s == "" {
+		return agents, nil
+	}
+	if err := json.Unmarshal([]byte(s), &agents); err != nil {
+		return nil, fmt.Errorf("invalid agents of rollout, error: %s", err.Error())
+	}
+	return agents, nil
+}
+
+func MarshalRolloutAgents(agents []*RolloutAgent) string {
+	b, _ := json.Marshal(agents)
+	return string(b)
+}
+
+// ParseRolloutWaves returns the cumulative agent count to be upgraded after each wave. The waves are separated by ',',
+// each one is an agent count or a percentage of agentNum, e.g. `1,10%,50%`, a wave of 100% is added if absent.
+func ParseRolloutWaves(waves string, agentNum int) ([]int, error) {
+	targets := []int{}
+	for _, item := range strings.Split(waves, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var target int
+		if strings.HasSuffix(item, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(item, "%"), 64)
+			if err != nil || percent <= 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid wave(%s), percentage should be in (0%%, 100%%]", item)
+			}
+			target = int(math.Ceil(float64(agentNum) * percent / 100))
+		} else {
+			count, err := strconv.Atoi(item)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid wave(%s), a positive agent count or a percentage is expected", item)
+			}
+			target = count
+		}
+		if target > agentNum {
+			target = agentNum
+		}
+		if len(targets) > 0 && target < targets[len(targets)-1] {
+			return nil, fmt.Errorf("invalid wave(%s), the waves are cumulative and should not decrease", item)
+		}
+		// the waves not upgrading more agents are ignored
+		if target > 0 && (len(targets) == 0 || target > targets[len(targets)-1]) {
+			targets = append(targets, target)
+		}
+	}
+	if agentNum > 0 && (len(targets) == 0 || targets[len(targets)-1] < agentNum) {
+		targets = append(targets, agentNum)
+	}
+	return targets, nil
+}
+
+// PlanRolloutAgents assigns the agents to the waves in the order of id, the first wave is the canary,
+// the agents already running the expected revision are skipped. It returns the agents and the wave count.
+func PlanRolloutAgents(vtaps []*metadbmodel.VTap, expectedRevision string, waves string) ([]*RolloutAgent, int, error) {
+	sort.Slice(vtaps, func(i, j int) bool { return vtaps[i].ID < vtaps[j].ID })
+	var agents, upgrades []*RolloutAgent
+	for _, vtap := range vtaps {
+		agent := &RolloutAgent{
+			ID:               vtap.ID,
+			Name:             vtap.Name,
+			Lcuuid:           vtap.Lcuuid,
+			PreviousRevision: vtap.Revision,
+			Status:           ROLLOUT_AGENT_PENDING,
+		}
+		if vtap.Revision == expectedRevision {
+			agent.Status = ROLLOUT_AGENT_SKIPPED
+		} else {
+			upgrades = append(upgrades, agent)
+		}
+		agents = append(agents, agent)
+	}
+	targets, err := ParseRolloutWaves(waves, len(upgrades))
+	if err != nil {
+		return nil, 0, err
+	}
+	wave := 0
+	for i, agent := range upgrades {
+		for i >= targets[wave] {
+			wave++
+		}
+		agent.Wave = wave
+	}
+	return agents, len(targets), nil
+}
+
+// isRolloutAgentHealthy checks the state, revision and exceptions of the agent, which are written by trisolaris/vtap
+func isRolloutAgentHealthy(vtap *metadbmodel.VTap, expectedRevision string) (bool, string) {
+	if vtap == nil {
+		return false, "agent is deleted"
+	}
+	if vtap.Revision != expectedRevision {
+		return false, fmt.Sprintf("agent is running revision %s", vtap.Revision)
+	}
+	if vtap.State != common.VTAP_STATE_NORMAL {
+		return false, fmt.Sprintf("agent state is %d", vtap.State)
+	}
+	if exceptions := vtap.Exceptions & ROLLOUT_GATE_EXCEPTIONS; exceptions != 0 {
+		return false, fmt.Sprintf("agent exceptions: 0x%x", exceptions)
+	}
+	return true, ""
+}
+
+// rolloutRunner moves a rollout forward, the upgrade and the image lookup are functions so that it can be tested without controllers.
+// The upgrades of a wave are sent by dispatch after the agents are saved as UPGRADING, so that a rollout paused or aborted
+// meanwhile does not upgrade its agents.
+type rolloutRunner struct {
+	rollout    *metadbmodel.AgentUpgradeRollout
+	agents     []*RolloutAgent
+	waveNum    int
+	vtaps      map[int]*metadbmodel.VTap
+	messages   []string
+	dispatches []*RolloutAgent // the agents to be upgraded by dispatch
+	dispatched []*RolloutAgent // the agents whose upgrades are sent by dispatch
+
+	upgrade       func(lcuuid, imageName string) error
+	previousImage func(agent *RolloutAgent) string
+}
+
+func (r *rolloutRunner) logf(format string, a ...interface{}) {
+	r.messages = append(r.messages, fmt.Sprintf(format, a...))
+}
+
+// step runs the rollout once, it returns whether the rollout is changed
+func (r *rolloutRunner) step(now time.Time) bool {
+	switch r.rollout.State {
+	case ROLLOUT_STATE_RUNNING:
+		return r.stepWave(now)
+	case ROLLOUT_STATE_ROLLING_BACK:
+		r.rollback()
+		return true
+	}
+	return false
+}
+
+func (r *rolloutRunner) stepWave(now time.Time) bool {
+	rollout := r.rollout
+	if rollout.CurrentWave >= r.waveNum {
+		rollout.State = ROLLOUT_STATE_COMPLETED
+		return true
+	}
+
+	// start the wave, the upgrades are sent by dispatch
+	if rollout.WaveStartedAt == nil {
+		for _, agent := range r.agents {
+			if agent.Wave != rollout.CurrentWave || agent.Status != ROLLOUT_AGENT_PENDING {
+				continue
+			}
+			agent.Status, agent.Error = ROLLOUT_AGENT_UPGRADING, ""
+			r.dispatches = append(r.dispatches, agent)
+		}
+		rollout.WaveStartedAt, rollout.WaveHealthyAt = &now, nil
+		r.logf("wave %d/%d started", rollout.CurrentWave+1, r.waveNum)
+		return true
+	}
+
+	// health gate of the agents in the wave
+	timeout := now.Sub(*rollout.WaveStartedAt) >= time.Duration(rollout.WaveTimeout)*time.Second
+	upgrading := 0
+	for _, agent := range r.agents {
+		if agent.Wave != rollout.CurrentWave || (agent.Status != ROLLOUT_AGENT_UPGRADING && agent.Status != ROLLOUT_AGENT_HEALTHY) {
+			continue
+		}
+		healthy, reason := isRolloutAgentHealthy(r.vtaps[agent.ID], rollout.ExpectedRevision)
+		if healthy {
+			agent.Status, agent.Error = ROLLOUT_AGENT_HEALTHY, ""
+			continue
+		}
+		if timeout {
+			agent.Status, agent.Error = ROLLOUT_AGENT_FAILED, reason
+			continue
+		}
+		// the soak time restarts if a healthy agent becomes unhealthy
+		agent.Status, agent.Error = ROLLOUT_AGENT_UPGRADING, reason
+		upgrading++
+	}
+	if !r.checkFailures() {
+		return true
+	}
+	if upgrading > 0 {
+		rollout.WaveHealthyAt = nil
+		return true
+	}
+	if rollout.WaveHealthyAt == nil {
+		rollout.WaveHealthyAt = &now
+	}
+	if now.Sub(*rollout.WaveHealthyAt) < time.Duration(rollout.SoakTime)*time.Second {
+		return true
+	}
+	r.logf("wave %d/%d completed", rollout.CurrentWave+1, r.waveNum)
+	rollout.CurrentWave++
+	rollout.WaveStartedAt, rollout.WaveHealthyAt = nil, nil
+	if rollout.CurrentWave >= r.waveNum {
+		rollout.State, rollout.Message = ROLLOUT_STATE_COMPLETED, ""
+	}
+	return true
+}
+
+// dispatch sends the upgrades of the agents saved as UPGRADING by step, it returns whether any agent is changed
+func (r *rolloutRunner) dispatch() bool {
+	if len(r.dispatches) == 0 {
+		return false
+	}
+	for _, agent := range r.dispatches {
+		if err := r.upgrade(agent.Lcuuid, r.rollout.ImageName); err != nil {
+			agent.Status, agent.Error = ROLLOUT_AGENT_FAILED, fmt.Sprintf("dispatch upgrade failed: %s", err.Error())
+			continue
+		}
+		r.dispatched = append(r.dispatched, agent)
+	}
+	r.dispatches = nil
+	r.checkFailures()
+	return true
+}
+
+// cancelDispatched cancels the upgrades sent by dispatch, it is called if the rollout is aborted while the
+// upgrades are being sent
+func (r *rolloutRunner) cancelDispatched() {
+	for _, agent := range r.dispatched {
+		if err := r.upgrade(agent.Lcuuid, ""); err != nil {
+			r.logf("cancel upgrade of agent(%s) failed: %s", agent.Name, err.Error())
+			continue
+		}
+		r.logf("upgrade of agent(%s) is canceled", agent.Name)
+	}
+	r.dispatched = nil
+}
+
+// checkFailures halts the rollout if the failed agents exceed max failures, it returns false if halted. The
+// rollback is done by the next step, as the upgrades are only sent after the state is saved.
+func (r *rolloutRunner) checkFailures() bool {
+	failures := 0
+	for _, agent := range r.agents {
+		if agent.Status == ROLLOUT_AGENT_FAILED {
+			failures++
+		}
+	}
+	if failures <= r.rollout.MaxFailures {
+		return true
+	}
+	message := fmt.Sprintf("%d agents failed in wave %d/%d, exceeds max failures %d", failures, r.rollout.CurrentWave+1, r.waveNum, r.rollout.MaxFailures)
+	if r.rollout.AutoRollback != 0 {
+		r.rollout.State, r.rollout.Message = ROLLOUT_STATE_ROLLING_BACK, message+", rolling back"
+	} else {
+		r.rollout.State, r.rollout.Message = ROLLOUT_STATE_PAUSED, message+", paused"
+	}
+	r.logf("%s", r.rollout.Message)
+	return false
+}
+
+// rollback upgrades the dispatched agents to the image of their previous revision, or cancels the upgrade of the
+// agents still running the previous revision if there is no such image in the repo. The rollout keeps rolling back
+// until all the agents are rolled back or canceled, so the failed ones are retried by the next step.
+func (r *rolloutRunner) rollback() {
+	pending := 0
+	for _, agent := range r.agents {
+		if agent.Status != ROLLOUT_AGENT_UPGRADING && agent.Status != ROLLOUT_AGENT_HEALTHY && agent.Status != ROLLOUT_AGENT_FAILED {
+			continue
+		}
+		vtap := r.vtaps[agent.ID]
+		if vtap == nil {
+			agent.Status, agent.Error = ROLLOUT_AGENT_CANCELED, "agent is deleted"
+			continue
+		}
+		if imageName := r.previousImage(agent); imageName != "" {
+			if err := r.upgrade(agent.Lcuuid, imageName); err != nil {
+				agent.Status, agent.Error = ROLLOUT_AGENT_FAILED, fmt.Sprintf("rollback to %s failed: %s", imageName, err.Error())
+				pending++
+				continue
+			}
+			agent.Status, agent.Error = ROLLOUT_AGENT_ROLLED_BACK, ""
+			continue
+		}
+		// the upgrade completed can not be canceled
+		if vtap.Revision != agent.PreviousRevision {
+			agent.Status, agent.Error = ROLLOUT_AGENT_FAILED, fmt.Sprintf("no image of revision %s in the repo, agent is running revision %s", agent.PreviousRevision, vtap.Revision)
+			pending++
+			continue
+		}
+		if err := r.upgrade(agent.Lcuuid, ""); err != nil {
+			agent.Status, agent.Error = ROLLOUT_AGENT_FAILED, fmt.Sprintf("no image of revision %s in the repo, cancel upgrade failed: %s", agent.PreviousRevision, err.Error())
+			pending++
+			continue
+		}
+		agent.Status, agent.Error = ROLLOUT_AGENT_CANCELED, fmt.Sprintf("no image of revision %s in the repo, the upgrade is canceled", agent.PreviousRevision)
+	}
+	if pending > 0 {
+		r.logf("%d agents are not rolled back, retrying", pending)
+		return
+	}
+	r.rollout.State = ROLLOUT_STATE_ROLLED_BACK
+	r.logf("rolled back")
+}
+
+// UpgradeRolloutCheck runs the agent upgrade rollouts on the master controller
+type UpgradeRolloutCheck struct {
+	vCtx    context.Context
+	vCancel context.CancelFunc
+	cfg     config.MonitorConfig
+}
+
+func NewUpgradeRolloutCheck(cfg config.MonitorConfig, ctx context.Context) *UpgradeRolloutCheck {
+	vCtx, vCancel := context.WithCancel(ctx)
+	return &UpgradeRolloutCheck{
+		vCtx:    vCtx,
+		vCancel: vCancel,
+		cfg:     cfg,
+	}
+}
+
+func (u *UpgradeRolloutCheck) Start(sCtx context.Context) {
+	log.Info("upgrade rollout check start")
+	go func() {
+		ticker := time.NewTicker(time.Duration(u.cfg.UpgradeRolloutCheckInterval) * time.Second)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ticker.C:
+				metadb.DoOnAllDBs(func(db *metadb.DB) error {
+					u.check(db)
+					return nil
+				})
+			case <-sCtx.Done():
+				break LOOP
+			case <-u.vCtx.Done():
+				break LOOP
+			}
+		}
+	}()
+}
+
+func (u *UpgradeRolloutCheck) Stop() {
+	if u.vCancel != nil {
+		u.vCancel()
+	}
+	log.Info("upgrade rollout check stopped")
+}
+
+func (u *UpgradeRolloutCheck) check(db *metadb.DB) {
+	var rollouts []*metadbmodel.AgentUpgradeRollout
+	if err := db.Where("state IN ?", []string{ROLLOUT_STATE_RUNNING, ROLLOUT_STATE_ROLLING_BACK}).Find(&rollouts).Error; err != nil {
+		log.Errorf("get agent upgrade rollouts failed: %s", err.Error(), db.LogPrefixORGID)
+		return
+	}
+	for _, rollout := range rollouts {
+		if err := u.checkRollout(db, rollout); err != nil {
+			log.Errorf("check agent upgrade rollout(id: %d) failed: %s", rollout.ID, err.Error(), db.LogPrefixORGID)
+		}
+	}
+}
+
+func (u *UpgradeRolloutCheck) checkRollout(db *metadb.DB, rollout *metadbmodel.AgentUpgradeRollout) error {
+	agents, err := UnmarshalRolloutAgents(rollout.Agents)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(agents))
+	for _, agent := range agents {
+		ids = append(ids, agent.ID)
+	}
+	var vtaps []*metadbmodel.VTap
+	if err := db.Select("id", "lcuuid", "name", "state", "revision", "exceptions", "arch", "os").Where("id IN ?", ids).Find(&vtaps).Error; err != nil {
+		return err
+	}
+	idToVTap := make(map[int]*metadbmodel.VTap, len(vtaps))
+	for _, vtap := range vtaps {
+		idToVTap[vtap.ID] = vtap
+	}
+	// every wave has agents as the waves are planned by the agents to be upgraded
+	waveNum := 0
+	for _, agent := range agents {
+		if agent.Status != ROLLOUT_AGENT_SKIPPED && agent.Wave+1 > waveNum {
+			waveNum = agent.Wave + 1
+		}
+	}
+
+	runner := &rolloutRunner{
+		rollout: rollout,
+		agents:  agents,
+		waveNum: waveNum,
+		vtaps:   idToVTap,
+		upgrade: func(lcuuid, imageName string) error {
+			return refresh.UpgradeVTap(db.ORGID, lcuuid, imageName)
+		},
+		previousImage: func(agent *RolloutAgent) string {
+			return getImageOfRevision(db, agent.PreviousRevision, idToVTap[agent.ID])
+		},
+	}
+	state := rollout.State
+	if !runner.step(time.Now()) {
+		return nil
+	}
+	// the agents of a new wave are saved as UPGRADING before their upgrades are sent, so that the upgrades are
+	// not sent if the rollout is paused or aborted meanwhile, and are canceled by abort once saved
+	if saved, err := saveRollout(db, runner, state); err != nil || !saved {
+		return err
+	}
+	if !runner.dispatch() {
+		return nil
+	}
+	saved, err := saveRollout(db, runner, state)
+	if err != nil {
+		return err
+	}
+	if saved {
+		return nil
+	}
+	// the rollout is changed by the api while the upgrades are being sent, the agents are saved as UPGRADING, so the
+	// upgrades go on if it is paused and are rolled back by the next check if it is rolling back, but the upgrades
+	// canceled by abort may be sent after that
+	var current metadbmodel.AgentUpgradeRollout
+	if err := db.Select("state").Where("id = ?", rollout.ID).First(&current).Error; err != nil {
+		return err
+	}
+	if current.State != ROLLOUT_STATE_ABORTED {
+		return nil
+	}
+	runner.messages = nil
+	runner.cancelDispatched()
+	for _, message := range runner.messages {
+		log.Infof("agent upgrade rollout(id: %d, image: %s): %s", rollout.ID, rollout.ImageName, message, db.LogPrefixORGID)
+	}
+	return nil
+}
+
+// saveRollout saves the rollout only if its state is not changed by the api, which takes precedence. It returns
+// whether the rollout is saved, and logs the messages of the runner if so.
+func saveRollout(db *metadb.DB, runner *rolloutRunner, state string) (bool, error) {
+	rollout := runner.rollout
+	result := db.Model(&metadbmodel.AgentUpgradeRollout{}).Where("id = ? AND state = ?", rollout.ID, state).Updates(map[string]interface{}{
+		"state":           rollout.State,
+		"message":         rollout.Message,
+		"current_wave":    rollout.CurrentWave,
+		"agents":          MarshalRolloutAgents(runner.agents),
+		"wave_started_at": rollout.WaveStartedAt,
+		"wave_healthy_at": rollout.WaveHealthyAt,
+		"updated_at":      time.Now(),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Infof("agent upgrade rollout(id: %d) state is changed from %s, the check result is discarded", rollout.ID, state, db.LogPrefixORGID)
+		return false, nil
+	}
+	for _, message := range runner.messages {
+		log.Infof("agent upgrade rollout(id: %d, image: %s): %s", rollout.ID, rollout.ImageName, message, db.LogPrefixORGID)
+	}
+	runner.messages = nil
+	return true, nil
+}
+
+// getImageOfRevision returns the image in the repo of the revision, the one of the same arch and os as the agent is preferred
+func getImageOfRevision(db *metadb.DB, revision string, vtap *metadbmodel.VTap) string {
+	if revision == "" {
+		return ""
+	}
+	var repos []*metadbmodel.VTapRepo
+	if err := db.Select("name", "arch", "os", "rev_count", "commit_id").Order("id DESC").Find(&repos).Error; err != nil {
+		log.Errorf("get vtap repos failed: %s", err.Error(), db.LogPrefixORGID)
+		return ""
+	}
+	imageName := ""
+	for _, repo := range repos {
+		if repo.RevCount+"-"+repo.CommitID != revision {
+			continue
+		}
+		if vtap != nil && strings.EqualFold(repo.Arch, vtap.Arch) && strings.EqualFold(repo.OS, vtap.Os) {
+			return repo.Name
+		}
+		if imageName == "" {
+			imageName = repo.Name
+		}
+	}
+	return imageName
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	mysqlmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+)
+
+func TestParseRolloutWaves(t *testing.T) {
+	for _, c := range []struct {
+		waves    string
+		agentNum int
+		expected []int
+		err      bool
+	}{
+		{"1,10%,50%,100%", 100, []int{1, 10, 50, 100}, false},
+		{"1,10%,50%", 5, []int{1, 3, 5}, false},
+		{"1, 2, 10", 4, []int{1, 2, 4}, false},
+		{"", 3, []int{3}, false},
+		{"50%", 0, []int{}, false},
+		{"10,5", 20, nil, true},
+		{"0", 20, nil, true},
+		{"120%", 20, nil, true},
+		{"a", 20, nil, true},
+	} {
+		targets, err := ParseRolloutWaves(c.waves, c.agentNum)
+		if c.err {
+			assert.Error(t, err, c.waves)
+			continue
+		}
+		assert.NoError(t, err, c.waves)
+		assert.Equal(t, c.expected, targets, c.waves)
+	}
+}
+
+func TestPlanRolloutAgents(t *testing.T) {
+	vtaps := []*mysqlmodel.VTap{
+		{ID: 4, Revision: "1-a"},
+		{ID: 1, Revision: "1-a"},
+		{ID: 3, Revision: "2-b"},
+		{ID: 2, Revision: "1-a"},
+		{ID: 5, Revision: "1-a"},
+	}
+	agents, waveNum, err := PlanRolloutAgents(vtaps, "2-b", "1,50%")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, waveNum)
+	expected := map[int]int{1: 0, 2: 1, 4: 2, 5: 2}
+	for i, agent := range agents {
+		assert.Equal(t, i+1, agent.ID)
+		if agent.ID == 3 {
+			assert.Equal(t, ROLLOUT_AGENT_SKIPPED, agent.Status)
+			continue
+		}
+		assert.Equal(t, ROLLOUT_AGENT_PENDING, agent.Status)
+		assert.Equal(t, expected[agent.ID], agent.Wave, agent.ID)
+		assert.Equal(t, "1-a", agent.PreviousRevision)
+	}
+
+	_, waveNum, err = PlanRolloutAgents(vtaps[2:3], "2-b", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, waveNum)
+}
+
+type testRollout struct {
+	runner   *rolloutRunner
+	upgrades map[string]string
+	failed   map[string]bool
+}
+
+func newTestRollout(t *testing.T, agentNum int, waves string) *testRollout {
+	tr := &testRollout{upgrades: make(map[string]string), failed: make(map[string]bool)}
+	var vtaps []*mysqlmodel.VTap
+	idToVTap := make(map[int]*mysqlmodel.VTap)
+	for i := 1; i <= agentNum; i++ {
+		vtap := &mysqlmodel.VTap{ID: i, Lcuuid: string(rune('a' + i - 1)), Revision: "1-a", State: common.VTAP_STATE_NORMAL}
+		vtaps = append(vtaps, vtap)
+		idToVTap[i] = vtap
+	}
+	agents, waveNum, err := PlanRolloutAgents(vtaps, "2-b", waves)
+	assert.NoError(t, err)
+	tr.runner = &rolloutRunner{
+		rollout: &mysqlmodel.AgentUpgradeRollout{
+			ImageName:        "agent-2",
+			ExpectedRevision: "2-b",
+			WaveTimeout:      600,
+			SoakTime:         300,
+			State:            ROLLOUT_STATE_RUNNING,
+		},
+		agents:  agents,
+		waveNum: waveNum,
+		vtaps:   idToVTap,
+		upgrade: func(lcuuid, imageName string) error {
+			if tr.failed[lcuuid] {
+				return errors.New("dispatch failed")
+			}
+			tr.upgrades[lcuuid] = imageName
+			return nil
+		},
+		previousImage: func(agent *RolloutAgent) string {
+			if agent.PreviousRevision == "1-a" {
+				return "agent-1"
+			}
+			return ""
+		},
+	}
+	return tr
+}
+
+// step runs the rollout as the upgrade rollout check does when the rollout is saved
+func (tr *testRollout) step(now time.Time) bool {
+	changed := tr.runner.step(now)
+	tr.runner.dispatch()
+	return changed
+}
+
+// upgraded simulates the agents reporting the revision of the dispatched image
+func (tr *testRollout) upgraded() {
+	for _, vtap := range tr.runner.vtaps {
+		if tr.upgrades[vtap.Lcuuid] == "agent-2" {
+			vtap.Revision = "2-b"
+		}
+	}
+}
+
+func (tr *testRollout) statuses() map[int]string {
+	statuses := make(map[int]string)
+	for _, agent := range tr.runner.agents {
+		statuses[agent.ID] = agent.Status
+	}
+	return statuses
+}
+
+func TestRolloutRunnerWaves(t *testing.T) {
+	tr := newTestRollout(t, 4, "1,50%")
+	rollout := tr.runner.rollout
+	now := time.Now()
+
+	// canary wave
+	assert.True(t, tr.step(now))
+	assert.Equal(t, map[string]string{"a": "agent-2"}, tr.upgrades)
+	assert.Equal(t, ROLLOUT_AGENT_UPGRADING, tr.statuses()[1])
+
+	tr.upgraded()
+	tr.step(now.Add(time.Minute))
+	assert.Equal(t, ROLLOUT_AGENT_HEALTHY, tr.statuses()[1])
+	assert.NotNil(t, rollout.WaveHealthyAt)
+	assert.Equal(t, 0, rollout.CurrentWave)
+
+	// an exception during the soak time restarts it
+	tr.runner.vtaps[1].Exceptions = 1 << 13
+	tr.step(now.Add(2 * time.Minute))
+	assert.Equal(t, ROLLOUT_AGENT_UPGRADING, tr.statuses()[1])
+	assert.Nil(t, rollout.WaveHealthyAt)
+	tr.runner.vtaps[1].Exceptions = 1 << 4 // rate limit does not fail the health gate
+	tr.step(now.Add(3 * time.Minute))
+	assert.Equal(t, ROLLOUT_AGENT_HEALTHY, tr.statuses()[1])
+	tr.step(now.Add(8 * time.Minute))
+	assert.Equal(t, 1, rollout.CurrentWave)
+	assert.Nil(t, rollout.WaveStartedAt)
+
+	// the other waves
+	for i := 0; i < 2; i++ {
+		now = now.Add(10 * time.Minute)
+		tr.step(now)
+		tr.upgraded()
+		tr.step(now.Add(time.Minute))
+		tr.step(now.Add(7 * time.Minute))
+	}
+	assert.Equal(t, ROLLOUT_STATE_COMPLETED, rollout.State)
+	assert.Equal(t, 4, len(tr.upgrades))
+	for _, status := range tr.statuses() {
+		assert.Equal(t, ROLLOUT_AGENT_HEALTHY, status)
+	}
+	assert.False(t, tr.step(now.Add(time.Hour)))
+}
+
+func TestRolloutRunnerPause(t *testing.T) {
+	tr := newTestRollout(t, 4, "2")
+	rollout := tr.runner.rollout
+	now := time.Now()
+
+	tr.step(now)
+	tr.upgraded()
+	tr.runner.vtaps[2].State = common.VTAP_STATE_NOT_CONNECTED
+	tr.step(now.Add(time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_RUNNING, rollout.State)
+	tr.step(now.Add(11 * time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_PAUSED, rollout.State)
+	assert.Equal(t, ROLLOUT_AGENT_HEALTHY, tr.statuses()[1])
+	assert.Equal(t, ROLLOUT_AGENT_FAILED, tr.statuses()[2])
+	assert.Equal(t, ROLLOUT_AGENT_PENDING, tr.statuses()[3])
+	assert.Contains(t, rollout.Message, "paused")
+	assert.False(t, tr.step(now.Add(12*time.Minute)))
+}
+
+func TestRolloutRunnerRollback(t *testing.T) {
+	tr := newTestRollout(t, 4, "2")
+	rollout := tr.runner.rollout
+	rollout.AutoRollback = 1
+	tr.failed["b"] = true
+	now := time.Now()
+
+	// the dispatch failure exceeds max failures immediately, the rollback is done by the next step
+	tr.step(now)
+	assert.Equal(t, ROLLOUT_STATE_ROLLING_BACK, rollout.State)
+	tr.step(now.Add(time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_ROLLING_BACK, rollout.State)
+	assert.Equal(t, "agent-1", tr.upgrades["a"])
+	statuses := tr.statuses()
+	assert.Equal(t, ROLLOUT_AGENT_ROLLED_BACK, statuses[1])
+	assert.Equal(t, ROLLOUT_AGENT_FAILED, statuses[2])
+	assert.Equal(t, ROLLOUT_AGENT_PENDING, statuses[3])
+
+	// the failed rollback is retried
+	delete(tr.failed, "b")
+	tr.step(now.Add(2 * time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_ROLLED_BACK, rollout.State)
+	assert.Equal(t, "agent-1", tr.upgrades["b"])
+	assert.Equal(t, ROLLOUT_AGENT_ROLLED_BACK, tr.statuses()[2])
+
+	// rollback requested by abort without the image of the previous revision
+	tr = newTestRollout(t, 3, "2")
+	tr.runner.previousImage = func(*RolloutAgent) string { return "" }
+	tr.step(now)
+	tr.runner.vtaps[2].Revision = "2-b" // upgraded, can not be canceled
+	tr.runner.rollout.State = ROLLOUT_STATE_ROLLING_BACK
+	tr.step(now.Add(time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_ROLLING_BACK, tr.runner.rollout.State)
+	assert.Equal(t, "", tr.upgrades["a"])
+	assert.Equal(t, "agent-2", tr.upgrades["b"])
+	statuses = tr.statuses()
+	assert.Equal(t, ROLLOUT_AGENT_CANCELED, statuses[1])
+	assert.Equal(t, ROLLOUT_AGENT_FAILED, statuses[2])
+	assert.Contains(t, tr.runner.agents[1].Error, "no image of revision 1-a")
+	assert.Equal(t, ROLLOUT_AGENT_PENDING, statuses[3])
+
+	// the image is uploaded to the repo
+	tr.runner.previousImage = func(*RolloutAgent) string { return "agent-1" }
+	tr.step(now.Add(2 * time.Minute))
+	assert.Equal(t, ROLLOUT_STATE_ROLLED_BACK, tr.runner.rollout.State)
+	assert.Equal(t, "agent-1", tr.upgrades["b"])
+	assert.Equal(t, ROLLOUT_AGENT_CANCELED, tr.statuses()[1])
+}
+
+func TestRolloutRunnerDispatch(t *testing.T) {
+	tr := newTestRollout(t, 2, "1")
+	now := time.Now()
+
+	// the upgrades are not sent until the agents are saved as UPGRADING
+	assert.True(t, tr.runner.step(now))
+	assert.Equal(t, ROLLOUT_AGENT_UPGRADING, tr.statuses()[1])
+	assert.Empty(t, tr.upgrades)
+
+	assert.True(t, tr.runner.dispatch())
+	assert.Equal(t, map[string]string{"a": "agent-2"}, tr.upgrades)
+	assert.False(t, tr.runner.dispatch())
+
+	// the rollout is aborted while the upgrades are being sent
+	tr.runner.cancelDispatched()
+	assert.Equal(t, map[string]string{"a": ""}, tr.upgrades)
+}
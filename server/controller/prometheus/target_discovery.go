@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/util/strutil"
+
+	servercommon "github.com/deepflowio/deepflow/server/common"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris"
+)
+
+// the meta labels are the same as kubernetes_sd_configs of prometheus, except the ones with metaLabelDeepFlowPrefix
+const (
+	metaLabelPrefix         = model.MetaLabelPrefix + "kubernetes_"
+	metaLabelDeepFlowPrefix = model.MetaLabelPrefix + "deepflow_"
+
+	metaLabelNamespace = metaLabelPrefix + "namespace"
+
+	metaLabelPodName              = metaLabelPrefix + "pod_name"
+	metaLabelPodIP                = metaLabelPrefix + "pod_ip"
+	metaLabelPodNodeName          = metaLabelPrefix + "pod_node_name"
+	metaLabelPodHostIP            = metaLabelPrefix + "pod_host_ip"
+	metaLabelPodControllerName    = metaLabelPrefix + "pod_controller_name"
+	metaLabelPodContainerPortName = metaLabelPrefix + "pod_container_port_name"
+	metaLabelPodContainerPort     = metaLabelPrefix + "pod_container_port_number"
+	metaLabelPodContainerProtocol = metaLabelPrefix + "pod_container_port_protocol"
+	metaLabelPodLabel             = metaLabelPrefix + "pod_label_"
+	metaLabelPodLabelPresent      = metaLabelPrefix + "pod_labelpresent_"
+	metaLabelPodAnnotation        = metaLabelPrefix + "pod_annotation_"
+	metaLabelPodAnnotationPresent = metaLabelPrefix + "pod_annotationpresent_"
+
+	metaLabelServiceName              = metaLabelPrefix + "service_name"
+	metaLabelServiceType              = metaLabelPrefix + "service_type"
+	metaLabelServiceClusterIP         = metaLabelPrefix + "service_cluster_ip"
+	metaLabelServicePortName          = metaLabelPrefix + "service_port_name"
+	metaLabelServicePortNumber        = metaLabelPrefix + "service_port_number"
+	metaLabelServicePortProtocol      = metaLabelPrefix + "service_port_protocol"
+	metaLabelServiceLabel             = metaLabelPrefix + "service_label_"
+	metaLabelServiceLabelPresent      = metaLabelPrefix + "service_labelpresent_"
+	metaLabelServiceAnnotation        = metaLabelPrefix + "service_annotation_"
+	metaLabelServiceAnnotationPresent = metaLabelPrefix + "service_annotationpresent_"
+
+	metaLabelPodCluster = metaLabelDeepFlowPrefix + "pod_cluster"
+
+	podStateRunning = 1
+)
+
+var serviceTypeNames = map[int]string{
+	common.POD_SERVICE_TYPE_CLUSTERIP:    "ClusterIP",
+	common.POD_SERVICE_TYPE_NODEPORT:     "NodePort",
+	common.POD_SERVICE_TYPE_LOADBALANCER: "LoadBalancer",
+}
+
+// DiscoverTargets is the servercommon.PrometheusTargetDiscovery of the controller, the targets are generated from
+// the pod/service cache of trisolaris, so that the ingester of every deepflow-server discovers the same targets.
+// For the pods, the ports of their pod groups are used as the container ports, and the pods not running are ignored.
+// For the services, __address__ is the cluster ip instead of the dns name.
+func DiscoverTargets(orgID uint16, role string) ([]model.LabelSet, error) {
+	metaData := trisolaris.GetMetaData(int(orgID))
+	if metaData == nil {
+		return nil, fmt.Errorf("metadata of org %d not found", orgID)
+	}
+	dbData := metaData.GetDBDataCache()
+	if dbData == nil {
+		return nil, fmt.Errorf("db data of org %d not found", orgID)
+	}
+
+	namespaces := make(map[int]string)
+	for _, ns := range dbData.GetPodNSsIDAndName() {
+		namespaces[ns.ID] = ns.Name
+	}
+	clusters := make(map[int]string)
+	for _, cluster := range dbData.GetPodClusters() {
+		clusters[cluster.ID] = cluster.Name
+	}
+
+	switch role {
+	case servercommon.PROMETHEUS_TARGET_ROLE_POD:
+		podIPs := make(map[uint32]string)
+		if platformData := metaData.GetPlatformDataOP(); platformData != nil {
+			for _, podIP := range platformData.GetPodIPs() {
+				if podIP.GetIp() != "" {
+					podIPs[podIP.GetPodId()] = podIP.GetIp()
+				}
+			}
+		}
+		return discoverPods(dbData.GetPods(), podIPs, dbData.GetPodNodes(), dbData.GetPodGroups(), dbData.GetPodGroupPorts(), namespaces, clusters), nil
+	case servercommon.PROMETHEUS_TARGET_ROLE_SERVICE:
+		return discoverServices(dbData.GetPodServices(), dbData.GetPodServicePorts(), namespaces, clusters), nil
+	}
+	return nil, fmt.Errorf("unsupported role '%s'", role)
+}
+
+func discoverPods(pods []*metadbmodel.Pod, podIPs map[uint32]string, podNodes []*metadbmodel.PodNode,
+	podGroups []*metadbmodel.PodGroup, podGroupPorts []*metadbmodel.PodGroupPort,
+	namespaces, clusters map[int]string) []model.LabelSet {
+	nodes := make(map[int]*metadbmodel.PodNode, len(podNodes))
+	for _, node := range podNodes {
+		nodes[node.ID] = node
+	}
+	groups := make(map[int]string, len(podGroups))
+	for _, group := range podGroups {
+		groups[group.ID] = group.Name
+	}
+	groupPorts := make(map[int][]*metadbmodel.PodGroupPort)
+	for _, port := range podGroupPorts {
+		groupPorts[port.PodGroupID] = append(groupPorts[port.PodGroupID], port)
+	}
+
+	targets := []model.LabelSet{}
+	for _, pod := range pods {
+		ip, ok := podIPs[uint32(pod.ID)]
+		if !ok || pod.State != podStateRunning {
+			continue
+		}
+		base := model.LabelSet{
+			metaLabelNamespace:  model.LabelValue(namespaces[pod.PodNamespaceID]),
+			metaLabelPodName:    model.LabelValue(pod.Name),
+			metaLabelPodIP:      model.LabelValue(ip),
+			metaLabelPodCluster: model.LabelValue(clusters[pod.PodClusterID]),
+		}
+		if node, ok := nodes[pod.PodNodeID]; ok {
+			base[metaLabelPodNodeName] = model.LabelValue(node.Name)
+			base[metaLabelPodHostIP] = model.LabelValue(node.IP)
+		}
+		if name, ok := groups[pod.PodGroupID]; ok {
+			base[metaLabelPodControllerName] = model.LabelValue(name)
+		}
+		addKeyValues(base, pod.Label, metaLabelPodLabel, metaLabelPodLabelPresent)
+		addKeyValues(base, pod.Annotation, metaLabelPodAnnotation, metaLabelPodAnnotationPresent)
+
+		// one target for each port like prometheus, or the pod itself if it has no port
+		ports := groupPorts[pod.PodGroupID]
+		if len(ports) == 0 {
+			base[model.AddressLabel] = model.LabelValue(ip)
+			targets = append(targets, base)
+			continue
+		}
+		seen := make(map[int]bool, len(ports))
+		for _, port := range ports {
+			if seen[port.Port] {
+				continue
+			}
+			seen[port.Port] = true
+			target := base.Clone()
+			target[model.AddressLabel] = model.LabelValue(net.JoinHostPort(ip, strconv.Itoa(port.Port)))
+			target[metaLabelPodContainerPortName] = model.LabelValue(port.Name)
+			target[metaLabelPodContainerPort] = model.LabelValue(strconv.Itoa(port.Port))
+			target[metaLabelPodContainerProtocol] = model.LabelValue(port.Protocol)
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func discoverServices(services []*metadbmodel.PodService, servicePorts []*metadbmodel.PodServicePort,
+	namespaces, clusters map[int]string) []model.LabelSet {
+	ports := make(map[int][]*metadbmodel.PodServicePort)
+	for _, port := range servicePorts {
+		ports[port.PodServiceID] = append(ports[port.PodServiceID], port)
+	}
+
+	targets := []model.LabelSet{}
+	for _, service := range services {
+		if service.ServiceClusterIP == "" {
+			continue
+		}
+		base := model.LabelSet{
+			metaLabelNamespace:        model.LabelValue(namespaces[service.PodNamespaceID]),
+			metaLabelServiceName:      model.LabelValue(service.Name),
+			metaLabelServiceType:      model.LabelValue(serviceTypeNames[service.Type]),
+			metaLabelServiceClusterIP: model.LabelValue(service.ServiceClusterIP),
+			metaLabelPodCluster:       model.LabelValue(clusters[service.PodClusterID]),
+		}
+		addKeyValues(base, service.Label, metaLabelServiceLabel, metaLabelServiceLabelPresent)
+		addKeyValues(base, service.Annotation, metaLabelServiceAnnotation, metaLabelServiceAnnotationPresent)
+		for _, port := range ports[service.ID] {
+			target := base.Clone()
+			target[model.AddressLabel] = model.LabelValue(net.JoinHostPort(service.ServiceClusterIP, strconv.Itoa(port.Port)))
+			target[metaLabelServicePortName] = model.LabelValue(port.Name)
+			target[metaLabelServicePortNumber] = model.LabelValue(strconv.Itoa(port.Port))
+			target[metaLabelServicePortProtocol] = model.LabelValue(port.Protocol)
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// addKeyValues adds the labels or annotations stored as 'key1:value1, key2:value2'
+func addKeyValues(ls model.LabelSet, keyValues, prefix, presentPrefix string) {
+	if keyValues == "" {
+		return
+	}
+	for _, kv := range strings.Split(keyValues, ", ") {
+		parts := strings.SplitN(kv, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		name := strutil.SanitizeLabelName(parts[0])
+		ls[model.LabelName(prefix+name)] = model.LabelValue(parts[1])
+		ls[model.LabelName(presentPrefix+name)] = "true"
+	}
+}
@@ -17,6 +17,7 @@
 package diffbase
 
 import (
+	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
 	ctrlrcommon "github.com/deepflowio/deepflow/server/controller/common"
 	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
 )
@@ -27,6 +28,7 @@ func (b *DataSet) AddPodIngressRuleBackend(dbItem *metadbmodel.PodIngressRuleBac
 			Sequence: seq,
 			Lcuuid:   dbItem.Lcuuid,
 		},
+		Weight:          dbItem.Weight,
 		SubDomainLcuuid: dbItem.SubDomain,
 	}
 	b.GetLogFunc()(addDiffBase(ctrlrcommon.RESOURCE_TYPE_POD_INGRESS_RULE_BACKEND_EN, b.PodIngressRuleBackends[dbItem.Lcuuid]), b.metadata.LogPrefixes)
@@ -39,5 +41,11 @@ func (b *DataSet) DeletePodIngressRuleBackend(lcuuid string) {
 
 type PodIngressRuleBackend struct {
 	DiffBase
+	Weight          int    `json:"weight"`
 	SubDomainLcuuid string `json:"sub_domain_lcuuid"`
 }
+
+func (p *PodIngressRuleBackend) Update(cloudItem *cloudmodel.PodIngressRuleBackend) {
+	p.Weight = cloudItem.Weight
+	log.Info(updateDiffBase(ctrlrcommon.RESOURCE_TYPE_POD_INGRESS_RULE_BACKEND_EN, p))
+}
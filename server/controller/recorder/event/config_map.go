@@ -32,7 +32,7 @@ type ConfigMap struct {
 	cfg config.Config
 }
 
-func NewConfigMap(cfg config.Config, q *queue.OverwriteQueue) *ConfigMap {
+func NewConfigMap(cfg config.Config, q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *ConfigMap {
 	mng := &ConfigMap{
 		newManagerComponent(ctrlCommon.RESOURCE_TYPE_CONFIG_MAP_EN, q),
 		newCUDSubscriberComponent(ctrlCommon.RESOURCE_TYPE_CONFIG_MAP_EN, SubTopic(pubsub.TopicResourceUpdatedFull)),
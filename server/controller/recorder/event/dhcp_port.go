@@ -30,7 +30,7 @@ type DHCPPort struct {
 	deviceType int
 }
 
-func NewDHCPPort(q *queue.OverwriteQueue) *DHCPPort {
+func NewDHCPPort(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *DHCPPort {
 	mng := &DHCPPort{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_DHCP_PORT_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_DHCP_PORT_EN),
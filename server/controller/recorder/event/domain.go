@@ -19,6 +19,7 @@ package event
 import (
 	"github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/recorder/pubsub"
+	"github.com/deepflowio/deepflow/server/libs/eventapi"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
@@ -26,7 +27,7 @@ type WholeDomain struct {
 	WholeSubDomain // TODO 依赖反转
 }
 
-func NewWholeDomain(q *queue.OverwriteQueue) *WholeDomain {
+func NewWholeDomain(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *WholeDomain {
 	mng := &WholeDomain{
 		WholeSubDomain{
 			newManagerComponent(common.RESOURCE_TYPE_SUB_DOMAIN_EN, q),
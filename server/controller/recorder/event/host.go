@@ -30,7 +30,7 @@ type Host struct {
 	deviceType int
 }
 
-func NewHost(q *queue.OverwriteQueue) *Host {
+func NewHost(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *Host {
 	mng := &Host{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_HOST_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_HOST_EN),
@@ -32,7 +32,7 @@ type LANIP struct {
 	tool *IPTool
 }
 
-func NewLANIP(q *queue.OverwriteQueue) *LANIP {
+func NewLANIP(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *LANIP {
 	mng := &LANIP{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_LAN_IP_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_LAN_IP_EN),
@@ -30,7 +30,7 @@ type LB struct {
 	deviceType int
 }
 
-func NewLB(q *queue.OverwriteQueue) *LB {
+func NewLB(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *LB {
 	mng := &LB{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_LB_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_LB_EN),
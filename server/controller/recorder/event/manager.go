@@ -30,10 +30,10 @@ import (
 
 type ManagerComponent struct {
 	resourceType string
-	Queue        *queue.OverwriteQueue
+	Queue        *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]
 }
 
-func newManagerComponent(rt string, q *queue.OverwriteQueue) ManagerComponent {
+func newManagerComponent(rt string, q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) ManagerComponent {
 	return ManagerComponent{
 		resourceType: rt,
 		Queue:        q,
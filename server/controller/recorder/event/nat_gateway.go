@@ -30,7 +30,7 @@ type NATGateway struct {
 	deviceType int
 }
 
-func NewNATGateway(q *queue.OverwriteQueue) *NATGateway {
+func NewNATGateway(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *NATGateway {
 	mng := &NATGateway{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_NAT_GATEWAY_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_NAT_GATEWAY_EN),
@@ -42,7 +42,7 @@ type Pod struct {
 	tool       *IPTool
 }
 
-func NewPod(q *queue.OverwriteQueue) *Pod {
+func NewPod(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *Pod {
 	mng := &Pod{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_POD_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_POD_EN, SubTopic(pubsub.TopicResourceUpdatedFull)),
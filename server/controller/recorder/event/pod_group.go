@@ -32,7 +32,7 @@ type PodGroup struct {
 	cfg config.Config
 }
 
-func NewPodGroup(cfg config.Config, q *queue.OverwriteQueue) *PodGroup {
+func NewPodGroup(cfg config.Config, q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *PodGroup {
 	mng := &PodGroup{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_POD_GROUP_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_POD_GROUP_EN, SubTopic(pubsub.TopicResourceUpdatedFull)),
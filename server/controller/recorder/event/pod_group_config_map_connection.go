@@ -29,7 +29,7 @@ type PodGroupConfigMapConnection struct {
 	CUDSubscriberComponent
 }
 
-func NewPodGroupConfigMapConnection(q *queue.OverwriteQueue) *PodGroupConfigMapConnection {
+func NewPodGroupConfigMapConnection(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *PodGroupConfigMapConnection {
 	mng := &PodGroupConfigMapConnection{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_POD_GROUP_CONFIG_MAP_CONNECTION_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_POD_GROUP_CONFIG_MAP_CONNECTION_EN),
@@ -31,7 +31,7 @@ type PodNode struct {
 	tool       *IPTool
 }
 
-func NewPodNode(q *queue.OverwriteQueue) *PodNode {
+func NewPodNode(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *PodNode {
 	mng := &PodNode{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_POD_NODE_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_POD_NODE_EN),
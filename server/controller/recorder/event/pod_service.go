@@ -33,7 +33,7 @@ type PodService struct {
 	deviceType int
 }
 
-func NewPodService(cfg config.Config, q *queue.OverwriteQueue) *PodService {
+func NewPodService(cfg config.Config, q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *PodService {
 	mng := &PodService{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_POD_SERVICE_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_POD_SERVICE_EN, SubTopic(pubsub.TopicResourceUpdatedFull)),
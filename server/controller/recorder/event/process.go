@@ -34,7 +34,7 @@ type Process struct {
 	tool       *IPTool
 }
 
-func NewProcess(q *queue.OverwriteQueue) *Process {
+func NewProcess(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *Process {
 	mng := &Process{
 		newManagerComponent(common.RESOURCE_TYPE_PROCESS_EN, q),
 		newCUDSubscriberComponent(common.RESOURCE_TYPE_PROCESS_EN),
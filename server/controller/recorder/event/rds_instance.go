@@ -30,7 +30,7 @@ type RDSInstance struct {
 	deviceType int
 }
 
-func NewRDSInstance(q *queue.OverwriteQueue) *RDSInstance {
+func NewRDSInstance(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *RDSInstance {
 	mng := &RDSInstance{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_RDS_INSTANCE_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_RDS_INSTANCE_EN),
@@ -30,7 +30,7 @@ type RedisInstance struct {
 	deviceType int
 }
 
-func NewRedisInstance(q *queue.OverwriteQueue) *RedisInstance {
+func NewRedisInstance(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *RedisInstance {
 	mng := &RedisInstance{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_REDIS_INSTANCE_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_REDIS_INSTANCE_EN),
@@ -34,7 +34,7 @@ type WholeSubDomain struct {
 	tool *IPTool
 }
 
-func NewWholeSubDomain(q *queue.OverwriteQueue) *WholeSubDomain {
+func NewWholeSubDomain(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *WholeSubDomain {
 	mng := &WholeSubDomain{
 		newManagerComponent(common.RESOURCE_TYPE_SUB_DOMAIN_EN, q),
 		newChangedSubscriberComponent(pubsub.PubSubTypeWholeSubDomain),
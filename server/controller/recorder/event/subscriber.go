@@ -22,6 +22,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/recorder/event/config"
 	"github.com/deepflowio/deepflow/server/controller/recorder/pubsub"
 	"github.com/deepflowio/deepflow/server/controller/recorder/pubsub/message"
+	"github.com/deepflowio/deepflow/server/libs/eventapi"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
@@ -42,7 +43,7 @@ func GetSubscriberManager() *SubscriberManager {
 	return subscriberManager
 }
 
-func (c *SubscriberManager) Start(cfg config.Config, q *queue.OverwriteQueue) (err error) {
+func (c *SubscriberManager) Start(cfg config.Config, q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) (err error) {
 	log.Info("resource event subscriber manager started")
 	c.cfg = cfg
 	c.subscribers = c.getSubscribers(q)
@@ -52,7 +53,7 @@ func (c *SubscriberManager) Start(cfg config.Config, q *queue.OverwriteQueue) (e
 	return nil
 }
 
-func (c *SubscriberManager) getSubscribers(q *queue.OverwriteQueue) []Subscriber {
+func (c *SubscriberManager) getSubscribers(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) []Subscriber {
 	subscribers := []Subscriber{
 		NewWholeDomain(q),
 		NewWholeSubDomain(q),
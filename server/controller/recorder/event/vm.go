@@ -42,7 +42,7 @@ type VM struct {
 	deviceType int
 }
 
-func NewVM(q *queue.OverwriteQueue) *VM {
+func NewVM(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *VM {
 	mng := &VM{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_VM_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_VM_EN, SubTopic(pubsub.TopicResourceUpdatedFull)),
@@ -30,7 +30,7 @@ type VRouter struct {
 	deviceType int
 }
 
-func NewVRouter(q *queue.OverwriteQueue) *VRouter {
+func NewVRouter(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *VRouter {
 	mng := &VRouter{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_VROUTER_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_VROUTER_EN),
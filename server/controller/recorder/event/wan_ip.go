@@ -32,7 +32,7 @@ type WANIP struct {
 	tool *IPTool
 }
 
-func NewWANIP(q *queue.OverwriteQueue) *WANIP {
+func NewWANIP(q *queue.TypedOverwriteQueue[*eventapi.ResourceEvent]) *WANIP {
 	mng := &WANIP{
 		newManagerComponent(ctrlrcommon.RESOURCE_TYPE_WAN_IP_EN, q),
 		newCUDSubscriberComponent(ctrlrcommon.RESOURCE_TYPE_WAN_IP_EN),
@@ -39,6 +39,7 @@ func (b *PodIngressRuleBackend) OnUpdaterAdded(addedDBItems []*metadbmodel.PodIn
 }
 
 func (b *PodIngressRuleBackend) OnUpdaterUpdated(cloudItem *cloudmodel.PodIngressRuleBackend, diffBase *diffbase.PodIngressRuleBackend) {
+	diffBase.Update(cloudItem)
 }
 
 func (b *PodIngressRuleBackend) OnUpdaterDeleted(lcuuids []string, deletedDBItems []*metadbmodel.PodIngressRuleBackend) {
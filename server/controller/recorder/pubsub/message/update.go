@@ -531,6 +531,7 @@ type UpdatedPodIngressRule struct {
 
 type UpdatedPodIngressRuleBackendFields struct {
 	Key
+	Weight fieldDetail[int]
 }
 type UpdatedPodIngressRuleBackend struct {
 	Fields[UpdatedPodIngressRuleBackendFields]
@@ -103,6 +103,7 @@ func (b *PodIngressRuleBackend) generateDBItemToAdd(cloudItem *cloudmodel.PodIng
 	dbItem := &metadbmodel.PodIngressRuleBackend{
 		Path:             cloudItem.Path,
 		Port:             cloudItem.Port,
+		Weight:           cloudItem.Weight,
 		PodServiceID:     podServiceID,
 		PodIngressID:     podIngressID,
 		PodIngressRuleID: podIngressRuleID,
@@ -113,7 +114,13 @@ func (b *PodIngressRuleBackend) generateDBItemToAdd(cloudItem *cloudmodel.PodIng
 	return dbItem, true
 }
 
-// 保留接口
 func (b *PodIngressRuleBackend) generateUpdateInfo(diffBase *diffbase.PodIngressRuleBackend, cloudItem *cloudmodel.PodIngressRuleBackend) (types.UpdatedFields, map[string]interface{}, bool) {
-	return nil, nil, false
+	structInfo := new(message.UpdatedPodIngressRuleBackendFields)
+	mapInfo := make(map[string]interface{})
+	if diffBase.Weight != cloudItem.Weight {
+		mapInfo["weight"] = cloudItem.Weight
+		structInfo.Weight.Set(diffBase.Weight, cloudItem.Weight)
+	}
+
+	return structInfo, mapInfo, len(mapInfo) > 0
 }
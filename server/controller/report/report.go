@@ -46,6 +46,10 @@ func SetServerInfo(branch string, revCount string, commitID string) {
 	serverCommitID = commitID
 }
 
+func GetServerInfo() (branch string, revCount string, commitID string) {
+	return serverBranch, serverRevCount, serverCommitID
+}
+
 func NewReportServer(db *gorm.DB) *ReportServer {
 	return &ReportServer{
 		db: db,
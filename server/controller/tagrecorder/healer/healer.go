@@ -78,6 +78,8 @@ func NewHealers(md metadata.Platform) *Healers {
 					common.VIF_DEVICE_TYPE_POD_GROUP_REPLICASET_CONTROLLER,
 					common.VIF_DEVICE_TYPE_POD_GROUP_DEPLOYMENT,
 					common.VIF_DEVICE_TYPE_POD_GROUP_STATEFULSET,
+					common.VIF_DEVICE_TYPE_POD_GROUP_JOB,
+					common.VIF_DEVICE_TYPE_POD_GROUP_CRON_JOB,
 				).
 				setFilterSubDomain(true),
 		),
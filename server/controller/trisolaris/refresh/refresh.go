@@ -17,6 +17,7 @@
 package refresh
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -25,6 +26,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
 	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/dbmgr"
 	"github.com/deepflowio/deepflow/server/libs/logger"
@@ -37,6 +39,7 @@ type RefreshOP struct {
 	nodeIP           string
 	localRefreshIPs  []string
 	remoteRefreshIPs []string
+	refreshIPToIP    map[string]string // refresh ip to controller ip, which is the controller ip of the agents
 }
 
 var refreshOP *RefreshOP = nil
@@ -101,6 +104,96 @@ func (r *RefreshOP) refreshCache(orgID int, dataTypes []common.DataChanged, othe
 	}
 }
 
+var (
+	upgradeURLFormat       = "http://%s:%d/v1/upgrade/vtap/%s/"
+	cancelUpgradeURLFormat = "http://%s:%d/v1/cancel-upgrade/vtap/%s/"
+)
+
+// UpgradeVTap sets the upgrade image of the vtap in the caches of all trisolaris, the same as `deepflow-ctl agent-upgrade`,
+// the upgrade is canceled if imageName is empty. It returns an error if the controller of the vtap does not accept the request.
+func UpgradeVTap(orgID int, lcuuid string, imageName string) error {
+	if refreshOP == nil {
+		return errors.New("refresh op is not initialized")
+	}
+	return refreshOP.upgradeVTap(orgID, lcuuid, imageName)
+}
+
+// upgradeVTap sends the upgrade to every trisolaris, as the agent may switch to any of them. Only the controller the
+// agent is connected to must accept the request, the others are warned, e.g. a cancel is rejected by the trisolaris
+// whose cache shows the upgrade as completed.
+func (r *RefreshOP) upgradeVTap(orgID int, lcuuid string, imageName string) error {
+	format, body := upgradeURLFormat, map[string]interface{}{"image_name": imageName}
+	if imageName == "" {
+		format, body = cancelUpgradeURLFormat, map[string]interface{}{}
+	}
+	agentControllerIP, err := getVTapControllerIP(orgID, lcuuid)
+	if err != nil {
+		return err
+	}
+	refreshIPToIP := r.refreshIPToIP
+	var agentControllerErr error
+	succeeded, agentControllerSucceeded := 0, false
+	request := func(refreshIP string, port int) {
+		controllerIP := refreshIPToIP[refreshIP]
+		isAgentController := agentControllerIP != "" && controllerIP == agentControllerIP
+		if err := common.IsTCPActive(refreshIP, port); err != nil {
+			if isAgentController {
+				agentControllerErr = fmt.Errorf("controller(%s) of agent(%s) is unreachable: %s", controllerIP, lcuuid, err)
+				return
+			}
+			log.Warningf("%s:%d unreachable, the upgrade of agent(%s) is not sent to it, err(%s)", refreshIP, port, lcuuid, err, logger.NewORGPrefix(orgID))
+			return
+		}
+		trisolarisURL := fmt.Sprintf(format, common.GetCURLIP(refreshIP), port, lcuuid)
+		if _, err := common.CURLPerform("PATCH", trisolarisURL, body, common.WithORGHeader(strconv.Itoa(orgID))); err != nil {
+			if isAgentController {
+				agentControllerErr = fmt.Errorf("request trisolaris of agent(%s) failed: %s, URL: %s", lcuuid, err, trisolarisURL)
+				return
+			}
+			log.Warningf("request trisolaris failed: %s, URL: %s", err, trisolarisURL, logger.NewORGPrefix(orgID))
+			return
+		}
+		succeeded++
+		if isAgentController {
+			agentControllerSucceeded = true
+		}
+	}
+	for _, controllerIP := range r.localRefreshIPs {
+		request(controllerIP, common.GConfig.HTTPPort)
+	}
+	for _, controllerIP := range r.remoteRefreshIPs {
+		request(controllerIP, common.GConfig.HTTPNodePort)
+	}
+	if agentControllerErr != nil {
+		return agentControllerErr
+	}
+	if agentControllerSucceeded {
+		return nil
+	}
+	// the agent is not connected to any known controller
+	if succeeded == 0 {
+		return errors.New("no trisolaris accepts the request")
+	}
+	log.Warningf("controller(%s) of agent(%s) is unknown, the request is accepted by %d trisolaris", agentControllerIP, lcuuid, succeeded, logger.NewORGPrefix(orgID))
+	return nil
+}
+
+// getVTapControllerIP returns the controller the vtap is connected to, or the one it is assigned to
+func getVTapControllerIP(orgID int, lcuuid string) (string, error) {
+	db, err := metadb.GetDB(orgID)
+	if err != nil {
+		return "", err
+	}
+	var vtap metadbmodel.VTap
+	if err := db.Select("controller_ip", "cur_controller_ip").Where("lcuuid = ?", lcuuid).First(&vtap).Error; err != nil {
+		return "", fmt.Errorf("failed to get agent(%s), error: %s", lcuuid, err)
+	}
+	if vtap.CurControllerIP != "" {
+		return vtap.CurControllerIP, nil
+	}
+	return vtap.ControllerIP, nil
+}
+
 func (r *RefreshOP) generateRefreshIPs() {
 	dbControllers, err := dbmgr.DBMgr[metadbmodel.Controller](r.db).Gets()
 	if err != nil {
@@ -123,16 +216,20 @@ func (r *RefreshOP) generateRefreshIPs() {
 
 	localRefreshIPs := make([]string, 0, len(dbControllers))
 	remoteRefreshIPs := make([]string, 0, len(dbControllers))
+	refreshIPToIP := make(map[string]string, len(dbControllers))
 	for _, controller := range dbControllers {
 		region, ok := controllerIPToRegion[controller.IP]
 		if ok && localRegion == region {
 			localRefreshIPs = append(localRefreshIPs, controller.PodIP)
+			refreshIPToIP[controller.PodIP] = controller.IP
 		} else {
 			remoteRefreshIPs = append(remoteRefreshIPs, controller.IP)
+			refreshIPToIP[controller.IP] = controller.IP
 		}
 	}
 	r.localRefreshIPs = localRefreshIPs
 	r.remoteRefreshIPs = remoteRefreshIPs
+	r.refreshIPToIP = refreshIPToIP
 }
 
 func (r *RefreshOP) TimedRefreshIPs() {
@@ -17,7 +17,9 @@
 package synchronize
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -25,6 +27,8 @@ import (
 
 	api "github.com/deepflowio/deepflow/message/trident"
 	. "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris"
 	. "github.com/deepflowio/deepflow/server/controller/trisolaris/common"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/pushmanager"
@@ -270,3 +274,88 @@ func (e *TSDBEvent) GetUniversalTagNameMaps(ctx context.Context, in *api.Univers
 func (e *TSDBEvent) GetOrgIDs(ctx context.Context, in *api.OrgIDsRequest) (*api.OrgIDsResponse, error) {
 	return trisolaris.GetOrgIDsData(), nil
 }
+
+func (e *TSDBEvent) GetServerPlugins(ctx context.Context, in *api.ServerPluginsRequest) (*api.ServerPluginsResponse, error) {
+	orgID := int(in.GetOrgId())
+	if orgID == 0 {
+		orgID = DEFAULT_ORG_ID
+	}
+	db, err := metadb.GetDB(orgID)
+	if err != nil {
+		log.Errorf("get db failed: %s", err, logger.NewORGPrefix(orgID))
+		return &api.ServerPluginsResponse{}, nil
+	}
+	var plugins []metadbmodel.Plugin
+	if err := db.Where("type = ? AND user_name = ?", in.GetPluginType(), PLUGIN_USER_SERVER).Order("name").Find(&plugins).Error; err != nil {
+		log.Errorf("get server plugins failed: %s", err, logger.NewORGPrefix(orgID))
+		return nil, err
+	}
+	resp := &api.ServerPluginsResponse{
+		Plugins: make([]*api.ServerPlugin, 0, len(plugins)),
+	}
+	var updateTime uint32
+	for _, plugin := range plugins {
+		pluginUpdateTime := uint32(plugin.UpdatedAt.Unix())
+		if pluginUpdateTime > updateTime {
+			updateTime = pluginUpdateTime
+		}
+		resp.Plugins = append(resp.Plugins, &api.ServerPlugin{
+			Name:       proto.String(plugin.Name),
+			UpdateTime: proto.Uint32(pluginUpdateTime),
+			Content:    plugin.Image,
+		})
+	}
+	resp.UpdateTime = proto.Uint32(updateTime)
+	return resp, nil
+}
+
+// GetIngesterQuotas returns the quotas saved by the controller API, an error is returned if
+// the quotas can not be read, so the ingesters keep their current quotas
+func (e *TSDBEvent) GetIngesterQuotas(ctx context.Context, in *api.IngesterQuotasRequest) (*api.IngesterQuotasResponse, error) {
+	orgID := int(in.GetOrgId())
+	if orgID == 0 {
+		orgID = DEFAULT_ORG_ID
+	}
+	db, err := metadb.GetDB(orgID)
+	if err != nil {
+		log.Errorf("get db failed: %s", err, logger.NewORGPrefix(orgID))
+		return nil, err
+	}
+	var quotas []metadbmodel.IngesterQuota
+	if err := db.Order("team_id").Find(&quotas).Error; err != nil {
+		log.Errorf("get ingester quotas failed: %s", err, logger.NewORGPrefix(orgID))
+		return nil, err
+	}
+	resp := &api.IngesterQuotasResponse{
+		Quotas: make([]*api.IngesterQuota, 0, len(quotas)),
+	}
+	for _, q := range quotas {
+		rowsPerDay := map[string]int64{}
+		if q.RowsPerDay != "" {
+			if err := json.Unmarshal([]byte(q.RowsPerDay), &rowsPerDay); err != nil {
+				log.Errorf("invalid rows_per_day of ingester quota (team %d): %s", q.TeamID, err, logger.NewORGPrefix(orgID))
+				return nil, err
+			}
+		}
+		datasources := make([]string, 0, len(rowsPerDay))
+		for datasource := range rowsPerDay {
+			datasources = append(datasources, datasource)
+		}
+		sort.Strings(datasources)
+		quota := &api.IngesterQuota{
+			TeamId:            proto.Uint32(uint32(q.TeamID)),
+			MessagesPerSecond: proto.Int64(q.MessagesPerSecond),
+			BytesPerSecond:    proto.Int64(q.BytesPerSecond),
+			Action:            proto.String(q.Action),
+			RowsPerDay:        make([]*api.IngesterQuotaRowsPerDay, 0, len(datasources)),
+		}
+		for _, datasource := range datasources {
+			quota.RowsPerDay = append(quota.RowsPerDay, &api.IngesterQuotaRowsPerDay{
+				Datasource: proto.String(datasource),
+				Rows:       proto.Int64(rowsPerDay[datasource]),
+			})
+		}
+		resp.Quotas = append(resp.Quotas, quota)
+	}
+	return resp, nil
+}
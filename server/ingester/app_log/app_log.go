@@ -28,7 +28,6 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
-	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 )
@@ -39,10 +38,12 @@ type ApplicationLogger struct {
 	SysLogger   *Logger
 	AgentLogger *Logger
 	AppLogger   *Logger
+	OTelLogger  *Logger
 }
 
 type Logger struct {
 	Config        *config.Config
+	DecodeQueues  *dropletqueue.TypedMultiQueue[*receiver.RecvBuffer]
 	Decoders      []*decoder.Decoder
 	PlatformDatas []*grpc.PlatformInfoTable
 }
@@ -70,6 +71,10 @@ func NewApplicationLogger(
 	if err != nil {
 		return nil, err
 	}
+	otelLogger, err := NewLogger(datatype.MESSAGE_TYPE_OPENTELEMETRY_LOG, config, manager, recv, platformDataManager, ckwriter)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ApplicationLogger{
 		Config:      config,
@@ -77,6 +82,7 @@ func NewApplicationLogger(
 		SysLogger:   sysLogger,
 		AgentLogger: agentLogger,
 		AppLogger:   appLogger,
+		OTelLogger:  otelLogger,
 	}, nil
 }
 
@@ -85,12 +91,14 @@ func (l *ApplicationLogger) Start() {
 	l.SysLogger.Start()
 	l.AgentLogger.Start()
 	l.AppLogger.Start()
+	l.OTelLogger.Start()
 }
 
 func (l *ApplicationLogger) Close() error {
 	l.SysLogger.Close()
 	l.AgentLogger.Close()
 	l.AppLogger.Close()
+	l.OTelLogger.Close()
 	l.Ckwriter.Close()
 	return nil
 }
@@ -105,13 +113,14 @@ func NewLogger(
 ) (*Logger, error) {
 
 	queueCount := config.DecoderQueueCount
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+msgType.String(),
 		config.DecoderQueueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
 	decoders := make([]*decoder.Decoder, queueCount)
@@ -128,15 +137,17 @@ func NewLogger(
 		decoders[i] = decoder.NewDecoder(
 			i,
 			msgType,
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			logWriter,
 			platformDatas[i],
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 	}
 
 	return &Logger{
 		Config:        config,
+		DecodeQueues:  decodeQueues,
 		Decoders:      decoders,
 		PlatformDatas: platformDatas,
 	}, nil
@@ -26,6 +26,7 @@ import (
 
 	json "github.com/bytedance/sonic"
 	logging "github.com/op/go-logging"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
 
 	"github.com/deepflowio/deepflow/server/ingester/app_log/config"
 	"github.com/deepflowio/deepflow/server/ingester/app_log/dbwriter"
@@ -36,6 +37,7 @@ import (
 	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -104,21 +106,23 @@ func StringToSeverity(str string) uint8 {
 }
 
 type Counter struct {
-	InCount    int64 `statsd:"in-count"`
-	OutCount   int64 `statsd:"out-count"`
-	ErrorCount int64 `statsd:"err-count"`
+	InCount        int64 `statsd:"in-count"`
+	OutCount       int64 `statsd:"out-count"`
+	ErrorCount     int64 `statsd:"err-count"`
+	QuotaDropCount int64 `statsd:"quota-drop-count"` // messages dropped by the rows-per-day quotas
 }
 
 type Decoder struct {
 	index             int
 	msgType           datatype.MessageType
 	platformData      *grpc.PlatformInfoTable
-	inQueue           queue.QueueReader
+	inQueue           queue.TypedQueueReader[*receiver.RecvBuffer]
 	logWriter         *dbwriter.AppLogWriter
 	debugEnabled      bool
 	config            *config.Config
 	appLogEntrysCache []AppLogEntry
 	orgId, teamId     uint16
+	quotaRows         *quota.RowCounter
 
 	counter *Counter
 	utils.Closable
@@ -127,7 +131,7 @@ type Decoder struct {
 func NewDecoder(
 	index int,
 	msgType datatype.MessageType,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	logWriter *dbwriter.AppLogWriter,
 	platformData *grpc.PlatformInfoTable,
 	config *config.Config,
@@ -145,6 +149,11 @@ func NewDecoder(
 	}
 }
 
+// SetQuota enables the rows-per-day quotas of application_log
+func (d *Decoder) SetQuota(m *quota.Manager) {
+	d.quotaRows = m.NewRowCounter(quota.APPLICATION_LOG)
+}
+
 func (d *Decoder) GetCounter() interface{} {
 	var counter *Counter
 	counter, d.counter = d.counter, &Counter{}
@@ -156,8 +165,9 @@ func (d *Decoder) Run() {
 	ingestercommon.RegisterCountableForIngester("decoder", d, stats.OptionStatTags{
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": d.msgType.String()})
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	decoder := &codec.SimpleDecoder{}
+	logsData := &logsv1.LogsData{}
 	for {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
@@ -165,9 +175,10 @@ func (d *Decoder) Run() {
 				continue
 			}
 			d.counter.InCount++
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("get application log decode queue data type wrong")
+			recvBytes := buffer[i]
+			if !d.quotaRows.Begin(recvBytes.OrgID, recvBytes.TeamID) {
+				d.counter.QuotaDropCount++
+				receiver.ReleaseRecvBuffer(recvBytes)
 				continue
 			}
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
@@ -177,7 +188,10 @@ func (d *Decoder) Run() {
 				d.handleAppLog(recvBytes.VtapID, decoder)
 			case datatype.MESSAGE_TYPE_SYSLOG, datatype.MESSAGE_TYPE_AGENT_LOG:
 				d.handleAgentLog(recvBytes.VtapID, decoder)
+			case datatype.MESSAGE_TYPE_OPENTELEMETRY_LOG:
+				d.handleOTelLog(recvBytes.VtapID, decoder, logsData)
 			}
+			d.quotaRows.End()
 			receiver.ReleaseRecvBuffer(recvBytes)
 		}
 	}
@@ -302,6 +316,7 @@ func (d *Decoder) WriteAgentLog(agentId uint16, bs []byte) error {
 	s.AttributeValues = append(s.AttributeValues, string(columns[4]))
 
 	d.logWriter.Write(s)
+	d.quotaRows.Add(1)
 	return nil
 }
 
@@ -422,10 +437,18 @@ func (d *Decoder) WriteAppLog(agentId uint16, l *AppLogEntry) error {
 		s.AttributeValues = append(s.AttributeValues, strings.Clone(l.Kubernetes.PodIp), strings.Clone(l.Kubernetes.PodName))
 	}
 
-	podName := l.Kubernetes.PodName
+	d.fillUniversalTag(s, agentId, l.Kubernetes.PodName, l.Kubernetes.PodIp)
+
+	d.logWriter.Write(s)
+	d.quotaRows.Add(1)
+	return nil
+}
+
+// fillUniversalTag fills the universal tags by the pod name or the pod IP, if both are empty, by the agent
+func (d *Decoder) fillUniversalTag(s *dbwriter.ApplicationLogStore, agentId uint16, podName, podIP string) {
 	var ip net.IP
-	if l.Kubernetes.PodIp != "" {
-		ip = net.ParseIP(l.Kubernetes.PodIp)
+	if podIP != "" {
+		ip = net.ParseIP(podIP)
 	}
 	if podName != "" {
 		podInfo := d.platformData.QueryPodInfo(s.OrgId, agentId, podName)
@@ -504,9 +527,6 @@ func (d *Decoder) WriteAppLog(agentId uint16, l *AppLogEntry) error {
 	s.AutoInstanceID, s.AutoInstanceType = ingestercommon.GetAutoInstance(s.PodID, 0, s.PodNodeID, s.L3DeviceID, uint32(s.SubnetID), uint8(s.L3DeviceType), s.L3EpcID)
 	customServiceID := d.platformData.QueryCustomService(s.OrgId, s.L3EpcID, !s.IsIPv4, s.IP4, s.IP6, 0, s.PodClusterID, s.ServiceID, s.PodGroupID, s.L3DeviceID, s.PodID, uint8(s.L3DeviceType), 0)
 	s.AutoServiceID, s.AutoServiceType = ingestercommon.GetAutoService(customServiceID, s.ServiceID, s.PodGroupID, 0, s.PodNodeID, s.L3DeviceID, uint32(s.SubnetID), uint8(s.L3DeviceType), podGroupType, s.L3EpcID)
-
-	d.logWriter.Write(s)
-	return nil
 }
 
 type AppLogEntry struct {
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	v11 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"github.com/deepflowio/deepflow/server/ingester/app_log/dbwriter"
+	ingestercommon "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/libs/codec"
+)
+
+// OTelSeverity converts the OTLP SeverityNumber (1-24) to the severity of application_log,
+// SeverityText is used when SeverityNumber is unspecified.
+func OTelSeverity(number logsv1.SeverityNumber, text string) uint8 {
+	switch {
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return SEVERITY_FATAL
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return SEVERITY_ERROR
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return SEVERITY_WARN
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return SEVERITY_INFO
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_DEBUG:
+		return SEVERITY_DEBUG
+	case number >= logsv1.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return SEVERITY_TRACE
+	}
+	return StringToSeverity(text)
+}
+
+func (d *Decoder) handleOTelLog(agentId uint16, decoder *codec.SimpleDecoder, logsData *logsv1.LogsData) {
+	for !decoder.IsEnd() {
+		logsData.Reset()
+		bytes := decoder.ReadBytes()
+		var err error
+		if len(bytes) > 0 {
+			err = proto.Unmarshal(bytes, logsData)
+		}
+		if decoder.Failed() || err != nil {
+			if d.counter.ErrorCount == 0 {
+				log.Errorf("OpenTelemetry log decode failed, offset=%d len=%d err: %v", decoder.Offset(), len(decoder.Bytes()), err)
+			}
+			d.counter.ErrorCount++
+			return
+		}
+		if d.debugEnabled {
+			log.Debugf("recv agent Id: %d, otel log: %s", agentId, logsData)
+		}
+
+		for _, resourceLogs := range logsData.GetResourceLogs() {
+			resAttributes := resourceLogs.GetResource().GetAttributes()
+			for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+				for _, record := range scopeLogs.GetLogRecords() {
+					d.WriteOTelLog(agentId, record, resAttributes)
+					d.counter.OutCount++
+				}
+			}
+		}
+	}
+}
+
+func (d *Decoder) WriteOTelLog(agentId uint16, record *logsv1.LogRecord, resAttributes []*v11.KeyValue) {
+	s := dbwriter.AcquireApplicationLogStore()
+
+	timestamp := record.GetTimeUnixNano()
+	if timestamp == 0 {
+		timestamp = record.GetObservedTimeUnixNano()
+	}
+	if timestamp == 0 {
+		timestamp = uint64(time.Now().UnixNano())
+	}
+	s.Time = uint32(timestamp / uint64(time.Second))
+	s.Timestamp = int64(timestamp / uint64(time.Microsecond))
+	s.SetId(s.Time, d.platformData.QueryAnalyzerID())
+
+	s.Type = dbwriter.LOG_TYPE_USER
+	s.AgentID = agentId
+	s.OrgId, s.TeamID = d.orgId, d.teamId
+	s.SeverityNumber = OTelSeverity(record.GetSeverityNumber(), record.GetSeverityText())
+	s.Body = ingestercommon.OTelValueString(record.GetBody())
+	if len(record.GetTraceId()) > 0 {
+		s.TraceID = hex.EncodeToString(record.GetTraceId())
+	}
+	if len(record.GetSpanId()) > 0 {
+		s.SpanID = hex.EncodeToString(record.GetSpanId())
+	}
+	s.TraceFlags = record.GetFlags()
+
+	// the numeric attributes of the record are stored as metrics
+	for _, attr := range record.GetAttributes() {
+		if v, ok := ingestercommon.OTelNumberValue(attr.GetValue()); ok {
+			s.MetricsNames = append(s.MetricsNames, attr.GetKey())
+			s.MetricsValues = append(s.MetricsValues, v)
+			continue
+		}
+		s.AttributeNames = append(s.AttributeNames, attr.GetKey())
+		s.AttributeValues = append(s.AttributeValues, ingestercommon.OTelValueString(attr.GetValue()))
+	}
+
+	podName, podIP := "", ""
+	for _, attr := range resAttributes {
+		value := ingestercommon.OTelValueString(attr.GetValue())
+		switch attr.GetKey() {
+		case ingestercommon.OTEL_SERVICE_NAME:
+			s.AppService = value
+		case ingestercommon.OTEL_K8S_POD_NAME:
+			podName = value
+		case ingestercommon.OTEL_K8S_POD_IP, ingestercommon.OTEL_HOST_IP:
+			if podIP == "" {
+				podIP = value
+			}
+		}
+		s.AttributeNames = append(s.AttributeNames, attr.GetKey())
+		s.AttributeValues = append(s.AttributeValues, value)
+	}
+
+	s.L3EpcID = d.platformData.QueryVtapEpc0(s.OrgId, agentId)
+	d.fillUniversalTag(s, agentId, podName, podIP)
+
+	d.logWriter.Write(s)
+	d.quotaRows.Add(1)
+}
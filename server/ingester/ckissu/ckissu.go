@@ -61,6 +61,7 @@ type Issu struct {
 	datasourceInfo     map[string]*DatasourceInfo
 	Connections        common.DBs
 	VersionMaps        []map[string]string
+	doneSteps          []map[string]struct{} // steps already applied in a previous run, loaded from the progress table
 	Addrs              []string
 	username, password string
 	ckdbType           string
@@ -479,6 +480,7 @@ func NewCKIssu(cfg *config.Config) (*Issu, error) {
 		return nil, err
 	}
 	i.VersionMaps = make([]map[string]string, len(i.Connections))
+	i.doneSteps = make([]map[string]struct{}, len(i.Connections))
 	for idx, connect := range i.Connections {
 		m, err := i.getAllTableVersions(connect)
 		if err != nil {
@@ -524,23 +526,11 @@ func (i *Issu) updateTablesForByConity() {
 // the new ReplacingMergeTree(update_time) table.
 func (i *Issu) RunDropAlertEventTableIfNotReplacingMergeTree(connect *sql.DB, orgPrefix string) {
 	db := orgPrefix + "event"
-	const localTable = "alert_event_local"
-	const globalTable = "alert_event"
-
-	sql := fmt.Sprintf(
-		"SELECT engine FROM system.tables WHERE database='%s' AND name='%s'",
-		db, localTable)
-	rows, err := Query(connect, sql)
+	engine, err := getAlertEventEngine(connect, db)
 	if err != nil {
 		log.Warningf("query alert_event engine failed: %s", err)
 		return
 	}
-	var engine string
-	for rows.Next() {
-		if e := rows.Scan(&engine); e != nil {
-			log.Warningf("scan alert_event engine failed: %s", e)
-		}
-	}
 	if engine == "" {
 		// table does not exist yet – nothing to drop
 		return
@@ -550,13 +540,44 @@ func (i *Issu) RunDropAlertEventTableIfNotReplacingMergeTree(connect *sql.DB, or
 		return
 	}
 	log.Infof("alert_event table engine is %q (not ReplacingMergeTree), dropping tables to trigger recreation", engine)
-	for _, tbl := range []string{localTable, globalTable} {
-		dropSQL := fmt.Sprintf("DROP TABLE IF EXISTS %s.`%s`", db, tbl)
+	for _, dropSQL := range dropAlertEventSQLs(db) {
 		log.Info(dropSQL)
 		if _, e := Exec(connect, dropSQL); e != nil {
-			log.Warningf("drop alert_event table %s failed: %s", tbl, e)
+			log.Warningf("drop alert_event table failed: %s", e)
+		}
+	}
+}
+
+const (
+	ALERT_EVENT_LOCAL_TABLE  = "alert_event_local"
+	ALERT_EVENT_GLOBAL_TABLE = "alert_event"
+)
+
+// getAlertEventEngine returns the engine of the alert_event local table, or "" if it does not exist
+func getAlertEventEngine(connect *sql.DB, db string) (string, error) {
+	sql := fmt.Sprintf(
+		"SELECT engine FROM system.tables WHERE database='%s' AND name='%s'",
+		db, ALERT_EVENT_LOCAL_TABLE)
+	rows, err := Query(connect, sql)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var engine string
+	for rows.Next() {
+		if e := rows.Scan(&engine); e != nil {
+			log.Warningf("scan alert_event engine failed: %s", e)
 		}
 	}
+	return engine, nil
+}
+
+func dropAlertEventSQLs(db string) []string {
+	sqls := []string{}
+	for _, tbl := range []string{ALERT_EVENT_LOCAL_TABLE, ALERT_EVENT_GLOBAL_TABLE} {
+		sqls = append(sqls, fmt.Sprintf("DROP TABLE IF EXISTS %s.`%s`", db, tbl))
+	}
+	return sqls
 }
 
 // called in server/ingester/ingester/ingester.go, executed before Start()
@@ -570,14 +591,23 @@ func (i *Issu) RunRecreateTables() error {
 	return nil
 }
 
+// needRecreateTables returns true if the tables of tableRecreates are created before v7.1.4.0
+func (i *Issu) needRecreateTables(idx int) bool {
+	oldVersion, _ := i.getTableVersion(idx, "flow_metrics", "network_map.1m_local")
+	return strings.Compare(oldVersion, "v7.1.4.0") < 0 && oldVersion != ""
+}
+
+func dropTableSQL(db, table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s.\"%s\"", db, table)
+}
+
 func (i *Issu) DropTable(db, table string) {
 	for idx, connect := range i.Connections {
-		oldVersion, _ := i.getTableVersion(idx, "flow_metrics", "network_map.1m_local")
-		if strings.Compare(oldVersion, "v7.1.4.0") >= 0 || oldVersion == "" {
+		if !i.needRecreateTables(idx) {
 			continue
 		}
 
-		sql := fmt.Sprintf("DROP TABLE IF EXISTS %s.\"%s\"", db, table)
+		sql := dropTableSQL(db, table)
 		log.Info("drop table: ", sql)
 		_, err := Exec(connect, sql)
 		if err != nil {
@@ -602,8 +632,7 @@ func (i *Issu) RunRenameTable(ds *datasource.DatasourceManager) error {
 	}
 	i.tableRenames = AllTableRenames
 	for idx, connection := range i.Connections {
-		oldVersion, _ := i.getTableVersion(idx, "flow_log", "l4_flow_log_local")
-		if strings.Compare(oldVersion, "v6.5") >= 0 || oldVersion == "" {
+		if !i.needRenameTables(idx) {
 			continue
 		}
 		for _, tableRename := range i.tableRenames {
@@ -618,10 +647,44 @@ func (i *Issu) RunRenameTable(ds *datasource.DatasourceManager) error {
 	return nil
 }
 
+// needRenameTables returns true if the tables of AllTableRenames are created before v6.5
+func (i *Issu) needRenameTables(idx int) bool {
+	oldVersion, _ := i.getTableVersion(idx, "flow_log", "l4_flow_log_local")
+	return strings.Compare(oldVersion, "v6.5") < 0 && oldVersion != ""
+}
+
+// needRenameTablesV65 returns true if the tables of TableRenames65 are created before v6.5.1
+func (i *Issu) needRenameTablesV65(idx int) bool {
+	oldVersion, _ := i.getTableVersion(idx, "flow_log", "l7_flow_log_local")
+	return strings.Compare(oldVersion, "v6.5.1") < 0
+}
+
+// userDefinedTableRenamesV65 returns the renames of the agg and mv tables of the user defined datasources in v6.5
+func (i *Issu) userDefinedTableRenamesV65(connection *sql.DB) ([]*TableRename, error) {
+	renames := []*TableRename{}
+	for idx, oldTable := range []string{"vtap_flow_port", "vtap_flow_edge_port", "vtap_app_port", "vtap_app_edge_port"} {
+		newTables := []string{"network", "network_map", "application", "application_map"}
+		datasourceInfos, err := i.getUserDefinedDatasourceInfos(connection, "flow_metrics", oldTable)
+		if err != nil {
+			return nil, err
+		}
+		for _, dsInfo := range datasourceInfos {
+			log.Infof("rename datasource: %+v", dsInfo)
+			// rename agg tables
+			renames = append(renames, &TableRename{
+				OldDb:     dsInfo.db,
+				OldTables: []string{dsInfo.name + "_agg", dsInfo.name + "_mv"},
+				NewDb:     ckdb.METRICS_DB,
+				NewTables: []string{strings.Replace(dsInfo.name, oldTable, newTables[idx], 1) + "_agg", strings.Replace(dsInfo.name, oldTable, newTables[idx], 1) + "_mv"},
+			})
+		}
+	}
+	return renames, nil
+}
+
 func (i *Issu) renameTablesV65(ds *datasource.DatasourceManager) error {
 	for index, connection := range i.Connections {
-		oldVersion, _ := i.getTableVersion(index, "flow_log", "l7_flow_log_local")
-		if strings.Compare(oldVersion, "v6.5.1") >= 0 {
+		if !i.needRenameTablesV65(index) {
 			continue
 		}
 
@@ -631,30 +694,28 @@ func (i *Issu) renameTablesV65(ds *datasource.DatasourceManager) error {
 			}
 		}
 
-		for idx, oldTable := range []string{"vtap_flow_port", "vtap_flow_edge_port", "vtap_app_port", "vtap_app_edge_port"} {
-			newTables := []string{"network", "network_map", "application", "application_map"}
-			datasourceInfos, err := i.getUserDefinedDatasourceInfos(connection, "flow_metrics", oldTable)
-			if err != nil {
+		renames, err := i.userDefinedTableRenamesV65(connection)
+		if err != nil {
+			return err
+		}
+		for _, tableRename := range renames {
+			if err := i.renameTable(connection, tableRename); err != nil {
 				return err
 			}
-			for _, dsInfo := range datasourceInfos {
-				log.Infof("rename datasource: %+v", dsInfo)
-				// rename agg tables
-				if err := i.renameTable(connection, &TableRename{
-					OldDb:     dsInfo.db,
-					OldTables: []string{dsInfo.name + "_agg", dsInfo.name + "_mv"},
-					NewDb:     ckdb.METRICS_DB,
-					NewTables: []string{strings.Replace(dsInfo.name, oldTable, newTables[idx], 1) + "_agg", strings.Replace(dsInfo.name, oldTable, newTables[idx], 1) + "_mv"},
-				}); err != nil {
-					return err
-				}
-			}
 		}
 	}
 
 	return nil
 }
 
+func renameTableSQLs(c *TableRename) []string {
+	sqls := []string{fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.NewDb)}
+	for i := range c.OldTables {
+		sqls = append(sqls, fmt.Sprintf("RENAME TABLE %s.\"%s\" to %s.\"%s\"", c.OldDb, c.OldTables[i], c.NewDb, c.NewTables[i]))
+	}
+	return sqls
+}
+
 func (i *Issu) renameTable(connect *sql.DB, c *TableRename) error {
 	for i := range c.OldTables {
 		createDb := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.NewDb)
@@ -684,7 +745,7 @@ func (i *Issu) renameTable(connect *sql.DB, c *TableRename) error {
 	return nil
 }
 
-func (i *Issu) addColumn(connect *sql.DB, c *ColumnAdd) error {
+func addColumnSQL(c *ColumnAdd) string {
 	defaultValue := ""
 	if len(c.DefaultValue) > 0 {
 		defaultValue = fmt.Sprintf("default %s", c.DefaultValue)
@@ -696,9 +757,12 @@ func (i *Issu) addColumn(connect *sql.DB, c *ColumnAdd) error {
 		columnName = c.ColumnName + "__agg"
 		columnType = fmt.Sprintf("AggregateFunction(%s, %s)", c.AggrFunc, c.ColumnType)
 	}
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s %s",
+	return fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s %s",
 		c.Db, c.Table, columnName, columnType, defaultValue)
+}
 
+func (i *Issu) addColumn(connect *sql.DB, c *ColumnAdd) error {
+	sql := addColumnSQL(c)
 	log.Info(sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -717,10 +781,19 @@ func (i *Issu) addColumn(connect *sql.DB, c *ColumnAdd) error {
 	return nil
 }
 
-func (i *Issu) addIndex(connect *sql.DB, c *IndexAdd) error {
+func addIndexSQLs(c *IndexAdd) []string {
 	indexName := c.ColumnName + "_idx"
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` ADD INDEX %s %s TYPE %s GRANULARITY 3",
-		c.Db, c.Table, indexName, c.ColumnName, c.IndexType)
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s.`%s` ADD INDEX %s %s TYPE %s GRANULARITY 3",
+			c.Db, c.Table, indexName, c.ColumnName, c.IndexType),
+		fmt.Sprintf("ALTER TABLE %s.`%s` MATERIALIZE INDEX %s",
+			c.Db, c.Table, indexName),
+	}
+}
+
+func (i *Issu) addIndex(connect *sql.DB, c *IndexAdd) error {
+	sqls := addIndexSQLs(c)
+	sql := sqls[0]
 	log.Info(sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -736,8 +809,7 @@ func (i *Issu) addIndex(connect *sql.DB, c *IndexAdd) error {
 		log.Error(err)
 		return err
 	} else {
-		sql := fmt.Sprintf("ALTER TABLE %s.`%s` MATERIALIZE INDEX %s",
-			c.Db, c.Table, indexName)
+		sql := sqls[1]
 		log.Info(sql)
 		Exec(connect, sql)
 	}
@@ -768,11 +840,29 @@ func (i *Issu) saveDatasourceInfo(connect *sql.DB, db, mvTable string) {
 	}
 }
 
+// local tables are renamed by adding the new column and copying the data to it,
+// other tables use 'RENAME COLUMN' directly
+func renameColumnSQLs(cr *ColumnRename) []string {
+	if strings.HasSuffix(cr.Table, "_local") {
+		return []string{
+			fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s",
+				cr.Db, cr.Table, cr.NewColumnName, cr.OldColumnType),
+			fmt.Sprintf("ALTER TABLE %s.`%s` update %s=%s WHERE 1",
+				cr.Db, cr.Table, cr.NewColumnName, cr.OldColumnName),
+		}
+	}
+	// ALTER TABLE flow_log.l4_flow_log  RENAME COLUMN retan_tx TO retran_tx
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s.`%s` RENAME COLUMN IF EXISTS %s to %s",
+			cr.Db, cr.Table, cr.OldColumnName, cr.NewColumnName),
+	}
+}
+
 // add column and copy data to new column replace rename column
 func (i *Issu) renameColumnWithAddNewColumn(connect *sql.DB, cr *ColumnRename) error {
+	sqls := renameColumnSQLs(cr)
 	// add new column
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s",
-		cr.Db, cr.Table, cr.NewColumnName, cr.OldColumnType)
+	sql := sqls[0]
 	log.Infof("rename add column: %s", sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -790,8 +880,7 @@ func (i *Issu) renameColumnWithAddNewColumn(connect *sql.DB, cr *ColumnRename) e
 	}
 
 	// copy data to new column
-	sql = fmt.Sprintf("ALTER TABLE %s.`%s` update %s=%s WHERE 1",
-		cr.Db, cr.Table, cr.NewColumnName, cr.OldColumnName)
+	sql = sqls[1]
 	log.Info("rename copy column: ", sql)
 	// the returned error value can be ignored
 	Exec(connect, sql)
@@ -839,8 +928,7 @@ func (i *Issu) renameColumn(connect *sql.DB, cr *ColumnRename) error {
 		}
 
 		if cr.DropIndex {
-			sql := fmt.Sprintf("ALTER TABLE %s.`%s` DROP INDEX %s_idx",
-				cr.Db, cr.Table, cr.OldColumnName)
+			sql := dropIndexSQL(cr.Db, cr.Table, cr.OldColumnName)
 			log.Info("drop index: ", sql)
 			_, err := Exec(connect, sql)
 			if err != nil {
@@ -859,9 +947,7 @@ func (i *Issu) renameColumn(connect *sql.DB, cr *ColumnRename) error {
 		return i.renameColumnWithAddNewColumn(connect, cr)
 	}
 
-	// ALTER TABLE flow_log.l4_flow_log  RENAME COLUMN retan_tx TO retran_tx
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` RENAME COLUMN IF EXISTS %s to %s",
-		cr.Db, cr.Table, cr.OldColumnName, cr.NewColumnName)
+	sql := renameColumnSQLs(cr)[0]
 	log.Info("rename column: ", sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -881,10 +967,19 @@ func (i *Issu) renameColumn(connect *sql.DB, cr *ColumnRename) error {
 	return nil
 }
 
+func dropIndexSQL(db, table, columnName string) string {
+	return fmt.Sprintf("ALTER TABLE %s.`%s` DROP INDEX %s_idx", db, table, columnName)
+}
+
+func modColumnSQL(cm *ColumnMod) string {
+	// ALTER TABLE flow_log.l7_flow_log  MODIFY COLUMN span_kind Nullable(UInt8);
+	return fmt.Sprintf("ALTER TABLE %s.`%s` MODIFY COLUMN %s %s",
+		cm.Db, cm.Table, cm.ColumnName, cm.NewColumnType)
+}
+
 func (i *Issu) modColumn(connect *sql.DB, cm *ColumnMod) error {
 	if cm.DropIndex {
-		sql := fmt.Sprintf("ALTER TABLE %s.`%s` DROP INDEX %s_idx",
-			cm.Db, cm.Table, cm.ColumnName)
+		sql := dropIndexSQL(cm.Db, cm.Table, cm.ColumnName)
 		log.Info("drop index: ", sql)
 		_, err := Exec(connect, sql)
 		if err != nil {
@@ -898,9 +993,7 @@ func (i *Issu) modColumn(connect *sql.DB, cm *ColumnMod) error {
 			}
 		}
 	}
-	// ALTER TABLE flow_log.l7_flow_log  MODIFY COLUMN span_kind Nullable(UInt8);
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` MODIFY COLUMN %s %s",
-		cm.Db, cm.Table, cm.ColumnName, cm.NewColumnType)
+	sql := modColumnSQL(cm)
 	log.Info("modify column: ", sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -916,9 +1009,13 @@ func (i *Issu) modColumn(connect *sql.DB, cm *ColumnMod) error {
 	return nil
 }
 
+func dropColumnSQL(cm *ColumnDrop) string {
+	return fmt.Sprintf("ALTER TABLE %s.`%s` DROP COLUMN %s", cm.Db, cm.Table, cm.ColumnName)
+}
+
 func (i *Issu) dropColumn(connect *sql.DB, cm *ColumnDrop) error {
 	// drop index first
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` DROP INDEX %s_idx", cm.Db, cm.Table, cm.ColumnName)
+	sql := dropIndexSQL(cm.Db, cm.Table, cm.ColumnName)
 	log.Info("drop index: ", sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -933,7 +1030,7 @@ func (i *Issu) dropColumn(connect *sql.DB, cm *ColumnDrop) error {
 	}
 
 	// then drop column
-	sql = fmt.Sprintf("ALTER TABLE %s.`%s` DROP COLUMN %s", cm.Db, cm.Table, cm.ColumnName)
+	sql = dropColumnSQL(cm)
 	log.Info("drop column: ", sql)
 	_, err = Exec(connect, sql)
 	if err != nil {
@@ -998,9 +1095,13 @@ func (i *Issu) getTableRawVersion(idx int, db, table string) (string, bool) {
 	return version, exist
 }
 
-func (i *Issu) setTableVersion(connect *sql.DB, db, table string) error {
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` COMMENT COLUMN time '%s'",
+func setTableVersionSQL(db, table string) string {
+	return fmt.Sprintf("ALTER TABLE %s.`%s` COMMENT COLUMN time '%s'",
 		db, table, common.CK_VERSION)
+}
+
+func (i *Issu) setTableVersion(connect *sql.DB, db, table string) error {
+	sql := setTableVersionSQL(db, table)
 	_, err := Exec(connect, sql)
 	if err != nil {
 		if strings.Contains(err.Error(), "doesn't exist") {
@@ -1069,81 +1170,14 @@ func getColumnRenames(columnRenamess []*ColumnRenames) []*ColumnRename {
 	return renames
 }
 
-func (i *Issu) renameColumns(index int, orgIDPrefix string, connect *sql.DB) ([]*ColumnRename, error) {
-	dones := []*ColumnRename{}
-	for _, renameColumn := range i.columnRenames {
-		renameColumn.Db = getOrgDatabase(renameColumn.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, renameColumn.Db, renameColumn.Table)
-		if version == common.CK_VERSION {
-			continue
-		}
-
-		if err := i.renameColumn(connect, renameColumn); err != nil {
-			return dones, err
-		}
-		dones = append(dones, renameColumn)
-	}
-
-	return dones, nil
-}
-
-func (i *Issu) modColumns(index int, orgIDPrefix string, connect *sql.DB) ([]*ColumnMod, error) {
-	dones := []*ColumnMod{}
-	for _, modColumn := range i.columnMods {
-		modColumn.Db = getOrgDatabase(modColumn.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, modColumn.Db, modColumn.Table)
-		if version == common.CK_VERSION {
-			continue
-		}
-		if err := i.modColumn(connect, modColumn); err != nil {
-			return dones, err
-		}
-		dones = append(dones, modColumn)
-	}
-
-	return dones, nil
-}
-
-func (i *Issu) dropColumns(index int, orgIDPrefix string, connect *sql.DB) ([]*ColumnDrop, error) {
-	dones := []*ColumnDrop{}
-	for _, dropColumn := range i.columnDrops {
-		dropColumn.Db = getOrgDatabase(dropColumn.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, dropColumn.Db, dropColumn.Table)
-		if version == common.CK_VERSION {
-			continue
-		}
-		if err := i.dropColumn(connect, dropColumn); err != nil {
-			return dones, err
-		}
-		dones = append(dones, dropColumn)
-	}
-	return dones, nil
-}
-
-func (i *Issu) modTableTTLs(index int, orgIDPrefix string, connect *sql.DB) error {
-	for _, modTTL := range i.modTTLs {
-		modTTL.Db = getOrgDatabase(modTTL.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, modTTL.Db, modTTL.Table)
-		if version == common.CK_VERSION {
-			continue
-		}
-		if err := i.modTTL(connect, modTTL); err != nil {
-			log.Error(err)
-			return err
-		} else {
-			if err := i.setTableVersion(connect, modTTL.Db, modTTL.Table); err != nil {
-				log.Error(err)
-				return err
-			}
-		}
-	}
-	return nil
+func modTTLSQL(mt *TableModTTL) string {
+	// ALTER TABLE vtap_acl."1m_local"  MODIFY TTL time + toIntervalHour(168);
+	return fmt.Sprintf("ALTER TABLE %s.`%s` MODIFY TTL time + toIntervalHour(%d)",
+		mt.Db, mt.Table, mt.NewTTL)
 }
 
 func (i *Issu) modTTL(connect *sql.DB, mt *TableModTTL) error {
-	// ALTER TABLE vtap_acl."1m_local"  MODIFY TTL time + toIntervalHour(168);
-	sql := fmt.Sprintf("ALTER TABLE %s.`%s` MODIFY TTL time + toIntervalHour(%d)",
-		mt.Db, mt.Table, mt.NewTTL)
+	sql := modTTLSQL(mt)
 	log.Info("modify TTL: ", sql)
 	_, err := Exec(connect, sql)
 	if err != nil {
@@ -1215,42 +1249,6 @@ func getColumnDatasourceAdds(columnDatasourceAddss []*ColumnDatasourceAdds) []*C
 	return adds
 }
 
-func (i *Issu) addColumns(index int, orgIDPrefix string, connect *sql.DB) ([]*ColumnAdd, error) {
-	dones := []*ColumnAdd{}
-	for _, add := range i.columnAdds {
-		add.Db = getOrgDatabase(add.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, add.Db, add.Table)
-		if version == common.CK_VERSION {
-			log.Infof("db (%s) table (%s) already updated", add.Db, add.Table)
-			continue
-		}
-		if err := i.addColumn(connect, add); err != nil {
-			return dones, err
-		}
-		dones = append(dones, add)
-	}
-
-	return dones, nil
-}
-
-func (i *Issu) addIndexs(index int, orgIDPrefix string, connect *sql.DB) ([]*IndexAdd, error) {
-	dones := []*IndexAdd{}
-	for _, add := range i.indexAdds {
-		add.Db = getOrgDatabase(add.Db, orgIDPrefix)
-		version, _ := i.getTableVersion(index, add.Db, add.Table)
-		if version == common.CK_VERSION {
-			log.Infof("db (%s) table (%s) already updated", add.Db, add.Table)
-			continue
-		}
-		if err := i.addIndex(connect, add); err != nil {
-			log.Warningf("db (%s) table (%s) add index failed.err: %s", add.Db, add.Table, err)
-			continue
-		}
-		dones = append(dones, add)
-	}
-	return dones, nil
-}
-
 func isNumeric(s string) bool {
 	for _, ch := range s {
 		if ch < '0' || ch > '9' {
@@ -1289,81 +1287,6 @@ func genKey(db, table string) string {
 	return db + "-" + table
 }
 
-func (i *Issu) startOrg(index int, orgIDPrefix string, connect *sql.DB) error {
-	renames, errRenames := i.renameColumns(index, orgIDPrefix, connect)
-	if errRenames != nil {
-		return errRenames
-	}
-	mods, errMods := i.modColumns(index, orgIDPrefix, connect)
-	if errMods != nil {
-		return errMods
-	}
-
-	adds, errAdds := i.addColumns(index, orgIDPrefix, connect)
-	if errAdds != nil {
-		return errAdds
-	}
-
-	addIndexs, errAddIndexs := i.addIndexs(index, orgIDPrefix, connect)
-	if errAddIndexs != nil {
-		log.Warning(errAddIndexs)
-	}
-
-	drops, errDrops := i.dropColumns(index, orgIDPrefix, connect)
-	if errDrops != nil {
-		return errDrops
-	}
-
-	versionSetted := make(map[string]struct{})
-	for _, cr := range renames {
-		if _, exist := versionSetted[genKey(cr.Db, cr.Table)]; exist {
-			continue
-		}
-		if err := i.setTableVersion(connect, cr.Db, cr.Table); err != nil {
-			return err
-		}
-		versionSetted[genKey(cr.Db, cr.Table)] = struct{}{}
-	}
-	for _, cr := range mods {
-		if _, exist := versionSetted[genKey(cr.Db, cr.Table)]; exist {
-			continue
-		}
-		if err := i.setTableVersion(connect, cr.Db, cr.Table); err != nil {
-			return err
-		}
-		versionSetted[genKey(cr.Db, cr.Table)] = struct{}{}
-	}
-	for _, cr := range adds {
-		if _, exist := versionSetted[genKey(cr.Db, cr.Table)]; exist {
-			continue
-		}
-		if err := i.setTableVersion(connect, cr.Db, cr.Table); err != nil {
-			return err
-		}
-		versionSetted[genKey(cr.Db, cr.Table)] = struct{}{}
-	}
-	for _, cr := range addIndexs {
-		if _, exist := versionSetted[genKey(cr.Db, cr.Table)]; exist {
-			continue
-		}
-		if err := i.setTableVersion(connect, cr.Db, cr.Table); err != nil {
-			return err
-		}
-		versionSetted[genKey(cr.Db, cr.Table)] = struct{}{}
-	}
-	for _, cr := range drops {
-		if _, exist := versionSetted[genKey(cr.Db, cr.Table)]; exist {
-			continue
-		}
-		if err := i.setTableVersion(connect, cr.Db, cr.Table); err != nil {
-			return err
-		}
-		versionSetted[genKey(cr.Db, cr.Table)] = struct{}{}
-	}
-	go i.modTableTTLs(index, orgIDPrefix, connect)
-	return nil
-}
-
 func (i *Issu) getOrgIDPrefixsWithoutDefault(connect *sql.DB) ([]string, error) {
 	checkOrgDatabase := "event"
 	sql := fmt.Sprintf("SELECT name FROM system.databases WHERE name like '%%%s%%'", checkOrgDatabase)
@@ -1403,6 +1326,7 @@ func (i *Issu) Start() error {
 			return err
 		}
 		i.VersionMaps[idx] = m
+		i.doneSteps[idx] = i.loadDoneSteps(connect)
 	}
 
 	var err error
@@ -0,0 +1,552 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ckissu
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/nativetag"
+)
+
+const (
+	PROGRESS_DB    = "deepflow_admin"
+	PROGRESS_TABLE = "ckissu_progress"
+
+	STATUS_DONE   = "done"
+	STATUS_FAILED = "failed"
+
+	DEFAULT_ORG_NAME = "default"
+)
+
+type StepKind string
+
+const (
+	STEP_RENAME_COLUMN  StepKind = "rename_column"
+	STEP_MOD_COLUMN     StepKind = "modify_column"
+	STEP_ADD_COLUMN     StepKind = "add_column"
+	STEP_ADD_INDEX      StepKind = "add_index"
+	STEP_DROP_COLUMN    StepKind = "drop_column"
+	STEP_MOD_TTL        StepKind = "modify_ttl"
+	STEP_RENAME_TABLE   StepKind = "rename_table"
+	STEP_DROP_TABLE     StepKind = "drop_table"
+	STEP_ADD_NATIVE_TAG StepKind = "add_native_tag"
+)
+
+// Step is one schema change of one table. The SQLs are the DDLs run in the normal
+// path, the fallbacks of renameColumn (drop mv tables/index and retry) and the tables
+// recreated by the datasource manager after renaming are not listed.
+type Step struct {
+	Addr        string
+	OrgIDPrefix string
+	Db          string
+	Table       string
+	Column      string
+	// the column type, index type or TTL applied, a step is applied again if it changes
+	ColumnType string
+	Kind       StepKind
+	SQLs       []string
+
+	// estimated from the active parts of the table when planning
+	Parts       uint64
+	Rows        uint64
+	BytesOnDisk uint64
+
+	// already applied by a previous run, recorded in the progress table
+	Done bool
+
+	exec func(connect *sql.DB) error
+}
+
+func (s *Step) Key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", s.Kind, s.Db, s.Table, s.Column, s.ColumnType)
+}
+
+func (s *Step) String() string {
+	return fmt.Sprintf("[%s] %s.%s %s %s", s.Kind, s.Db, s.Table, s.Column, s.ColumnType)
+}
+
+// planOrg lists the steps of an organization in the order they are applied, tables
+// which are already at CK_VERSION or do not exist are skipped.
+func (i *Issu) planOrg(index int, orgIDPrefix string) []*Step {
+	steps := []*Step{}
+	needUpdate := func(db, table string) bool {
+		version, _ := i.getTableVersion(index, db, table)
+		return version != common.CK_VERSION
+	}
+	newStep := func(kind StepKind, db, table, column, columnType string, sqls []string, exec func(*sql.DB) error) {
+		steps = append(steps, &Step{
+			OrgIDPrefix: orgIDPrefix,
+			Db:          db,
+			Table:       table,
+			Column:      column,
+			ColumnType:  columnType,
+			Kind:        kind,
+			SQLs:        sqls,
+			exec:        exec,
+		})
+	}
+
+	for _, c := range i.columnRenames {
+		cr := *c
+		cr.Db = getOrgDatabase(cr.Db, orgIDPrefix)
+		if !needUpdate(cr.Db, cr.Table) {
+			continue
+		}
+		columnType := ""
+		if cr.CheckColumnType {
+			columnType = cr.OldColumnType.String()
+		}
+		newStep(STEP_RENAME_COLUMN, cr.Db, cr.Table, cr.OldColumnName+"->"+cr.NewColumnName, columnType, renameColumnSQLs(&cr),
+			func(connect *sql.DB) error { return i.renameColumn(connect, &cr) })
+	}
+	for _, c := range i.columnMods {
+		cm := *c
+		cm.Db = getOrgDatabase(cm.Db, orgIDPrefix)
+		if !needUpdate(cm.Db, cm.Table) {
+			continue
+		}
+		sqls := []string{modColumnSQL(&cm)}
+		if cm.DropIndex {
+			sqls = append([]string{dropIndexSQL(cm.Db, cm.Table, cm.ColumnName)}, sqls...)
+		}
+		newStep(STEP_MOD_COLUMN, cm.Db, cm.Table, cm.ColumnName, cm.NewColumnType.String(), sqls,
+			func(connect *sql.DB) error { return i.modColumn(connect, &cm) })
+	}
+	for _, c := range i.columnAdds {
+		add := *c
+		add.Db = getOrgDatabase(add.Db, orgIDPrefix)
+		if !needUpdate(add.Db, add.Table) {
+			continue
+		}
+		newStep(STEP_ADD_COLUMN, add.Db, add.Table, add.ColumnName, add.ColumnType.String(), []string{addColumnSQL(&add)},
+			func(connect *sql.DB) error { return i.addColumn(connect, &add) })
+	}
+	for _, c := range i.indexAdds {
+		add := *c
+		add.Db = getOrgDatabase(add.Db, orgIDPrefix)
+		if !needUpdate(add.Db, add.Table) {
+			continue
+		}
+		newStep(STEP_ADD_INDEX, add.Db, add.Table, add.ColumnName, add.IndexType.String(), addIndexSQLs(&add),
+			func(connect *sql.DB) error { return i.addIndex(connect, &add) })
+	}
+	for _, c := range i.columnDrops {
+		cd := *c
+		cd.Db = getOrgDatabase(cd.Db, orgIDPrefix)
+		if !needUpdate(cd.Db, cd.Table) {
+			continue
+		}
+		newStep(STEP_DROP_COLUMN, cd.Db, cd.Table, cd.ColumnName, "", []string{dropIndexSQL(cd.Db, cd.Table, cd.ColumnName), dropColumnSQL(&cd)},
+			func(connect *sql.DB) error { return i.dropColumn(connect, &cd) })
+	}
+	for _, c := range i.modTTLs {
+		mt := *c
+		mt.Db = getOrgDatabase(mt.Db, orgIDPrefix)
+		if !needUpdate(mt.Db, mt.Table) {
+			continue
+		}
+		newStep(STEP_MOD_TTL, mt.Db, mt.Table, "", fmt.Sprintf("%dh", mt.NewTTL), []string{modTTLSQL(&mt)},
+			func(connect *sql.DB) error { return i.modTTL(connect, &mt) })
+	}
+
+	for _, s := range steps {
+		s.Addr = i.Addrs[index]
+		_, s.Done = i.doneSteps[index][s.Key()]
+	}
+	return steps
+}
+
+func (i *Issu) startOrg(index int, orgIDPrefix string, connect *sql.DB) error {
+	return i.applySteps(connect, i.planOrg(index, orgIDPrefix))
+}
+
+// applySteps runs the steps which are not done yet and records each of them in the
+// progress table, so that a failed upgrade continues from the failed step next time.
+// The table version is set only after all steps of the organization succeed.
+func (i *Issu) applySteps(connect *sql.DB, steps []*Step) error {
+	versionSetted := make(map[string]struct{})
+	updatedTables := [][2]string{}
+	ttlSteps := []*Step{}
+	for _, s := range steps {
+		if s.Kind == STEP_MOD_TTL {
+			ttlSteps = append(ttlSteps, s)
+			continue
+		}
+		if !s.Done {
+			if err := s.exec(connect); err != nil {
+				i.recordStep(connect, s, STATUS_FAILED, err)
+				// the failure of adding index does not block the upgrade
+				if s.Kind == STEP_ADD_INDEX {
+					log.Warningf("db (%s) table (%s) add index failed.err: %s", s.Db, s.Table, err)
+					continue
+				}
+				return err
+			}
+			i.recordStep(connect, s, STATUS_DONE, nil)
+		} else {
+			log.Infof("step %s already done, skip it", s)
+		}
+		if _, exist := versionSetted[genKey(s.Db, s.Table)]; exist {
+			continue
+		}
+		versionSetted[genKey(s.Db, s.Table)] = struct{}{}
+		updatedTables = append(updatedTables, [2]string{s.Db, s.Table})
+	}
+
+	for _, t := range updatedTables {
+		if err := i.setTableVersion(connect, t[0], t[1]); err != nil {
+			return err
+		}
+	}
+	go i.applyTTLSteps(connect, ttlSteps)
+	return nil
+}
+
+func (i *Issu) applyTTLSteps(connect *sql.DB, steps []*Step) {
+	for _, s := range steps {
+		if !s.Done {
+			if err := s.exec(connect); err != nil {
+				log.Error(err)
+				i.recordStep(connect, s, STATUS_FAILED, err)
+				return
+			}
+			i.recordStep(connect, s, STATUS_DONE, nil)
+		}
+		if err := i.setTableVersion(connect, s.Db, s.Table); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+}
+
+func progressTableCreateSQL(ckdbType string) string {
+	engine := fmt.Sprintf(ckdb.ReplacingMergeTree.String(), "time")
+	if ckdbType == ckdb.CKDBTypeByconity {
+		engine = fmt.Sprintf(ckdb.CnchReplacingMergeTree.String(), "time")
+	}
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s
+(
+    time DateTime,
+    version LowCardinality(String),
+    step_key String,
+    kind LowCardinality(String),
+    database String,
+    table String,
+    column String,
+    sql String,
+    status LowCardinality(String),
+    error String
+)
+ENGINE = %s
+ORDER BY (version, step_key)`, PROGRESS_DB, PROGRESS_TABLE, engine)
+}
+
+// loadDoneSteps returns the steps of the current CK_VERSION which have been applied.
+// If the progress table is not available, all steps are applied again as before.
+func (i *Issu) loadDoneSteps(connect *sql.DB) map[string]struct{} {
+	for _, sql := range []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", PROGRESS_DB),
+		progressTableCreateSQL(i.ckdbType),
+	} {
+		if _, err := Exec(connect, sql); err != nil {
+			log.Warningf("create ckissu progress table failed, progress will not be recorded. sql: %s, err: %s", sql, err)
+			return map[string]struct{}{}
+		}
+	}
+	dones, err := queryDoneSteps(connect)
+	if err != nil {
+		log.Warningf("query ckissu progress failed: %s", err)
+	}
+	return dones
+}
+
+func queryDoneSteps(connect *sql.DB) (map[string]struct{}, error) {
+	dones := make(map[string]struct{})
+	sql := fmt.Sprintf("SELECT step_key FROM %s.%s FINAL WHERE version='%s' AND status='%s'",
+		PROGRESS_DB, PROGRESS_TABLE, common.CK_VERSION, STATUS_DONE)
+	rows, err := Query(connect, sql)
+	if err != nil {
+		return dones, err
+	}
+	defer rows.Close()
+	var key string
+	for rows.Next() {
+		if err := rows.Scan(&key); err != nil {
+			return dones, err
+		}
+		dones[key] = struct{}{}
+	}
+	return dones, nil
+}
+
+func escapeString(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `'`, `\'`)
+}
+
+func (i *Issu) recordStep(connect *sql.DB, s *Step, status string, stepErr error) {
+	errString := ""
+	if stepErr != nil {
+		errString = stepErr.Error()
+	}
+	sql := fmt.Sprintf("INSERT INTO %s.%s (time, version, step_key, kind, database, table, column, sql, status, error) VALUES (now(), '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s')",
+		PROGRESS_DB, PROGRESS_TABLE,
+		common.CK_VERSION, escapeString(s.Key()), s.Kind, s.Db, escapeString(s.Table), escapeString(s.Column),
+		escapeString(strings.Join(s.SQLs, ";\n")), status, escapeString(errString))
+	if _, err := connect.Exec(sql); err != nil {
+		log.Warningf("record ckissu step %s failed: %s", s, err)
+	}
+}
+
+type tableParts struct {
+	parts, rows, bytesOnDisk uint64
+}
+
+func getAllTableParts(connect *sql.DB) (map[string]*tableParts, error) {
+	sql := "SELECT database, table, count(), sum(rows), sum(bytes_on_disk) FROM system.parts WHERE active GROUP BY database, table"
+	rows, err := Query(connect, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	parts := make(map[string]*tableParts)
+	for rows.Next() {
+		var database, table string
+		p := &tableParts{}
+		if err := rows.Scan(&database, &table, &p.parts, &p.rows, &p.bytesOnDisk); err != nil {
+			return nil, err
+		}
+		parts[genKey(database, table)] = p
+	}
+	return parts, nil
+}
+
+// Plan returns every step Start would apply on all ClickHouse nodes and organizations
+// without changing anything.
+func (i *Issu) Plan() ([]*Step, error) {
+	if len(i.Connections) == 0 {
+		return nil, fmt.Errorf("connections is nil")
+	}
+
+	steps := []*Step{}
+	for index, connect := range i.Connections {
+		m, err := i.getAllTableVersions(connect)
+		if err != nil {
+			return nil, err
+		}
+		i.VersionMaps[index] = m
+		// planning is read only, so the progress table is not created here
+		if i.doneSteps[index], err = queryDoneSteps(connect); err != nil {
+			log.Infof("query ckissu progress failed, all steps are considered not done. err: %s", err)
+		}
+
+		parts, err := getAllTableParts(connect)
+		if err != nil {
+			return nil, err
+		}
+		orgIDPrefixs, err := i.getOrgIDPrefixsWithoutDefault(connect)
+		if err != nil {
+			return nil, fmt.Errorf("get orgIDs failed, err: %s", err)
+		}
+		nodeSteps, err := i.planTables(index, connect)
+		if err != nil {
+			return nil, err
+		}
+		nativeTags := nativetag.GetAllNativeTags()
+		for _, orgIDPrefix := range append([]string{""}, orgIDPrefixs...) {
+			nodeSteps = append(nodeSteps, i.planOrg(index, orgIDPrefix)...)
+			orgId := parseOrgId(orgIDPrefix + "event")
+			nodeSteps = append(nodeSteps, i.planNativeTags(index, orgIDPrefix, orgId, connect, nativeTags[orgId])...)
+			nodeSteps = append(nodeSteps, i.planDropAlertEventTable(index, orgIDPrefix, connect)...)
+		}
+		for _, s := range nodeSteps {
+			if p, ok := parts[genKey(s.Db, s.Table)]; ok {
+				s.Parts, s.Rows, s.BytesOnDisk = p.parts, p.rows, p.bytesOnDisk
+			}
+		}
+		steps = append(steps, nodeSteps...)
+	}
+	return steps, nil
+}
+
+// planTables lists the table renames of RunRenameTable and the table drops of RunRecreateTables,
+// which are run before Start
+func (i *Issu) planTables(index int, connect *sql.DB) ([]*Step, error) {
+	steps := []*Step{}
+	// the tables with the column 'time' are in VersionMaps, the tables not existing are skipped as applying
+	exists := func(db, table string) bool {
+		_, ok := i.VersionMaps[index][genKey(db, table)]
+		return ok
+	}
+	addRenames := func(renames []*TableRename) {
+		for _, r := range renames {
+			for j := range r.OldTables {
+				if !exists(r.OldDb, r.OldTables[j]) {
+					continue
+				}
+				rename := &TableRename{OldDb: r.OldDb, OldTables: r.OldTables[j : j+1], NewDb: r.NewDb, NewTables: r.NewTables[j : j+1]}
+				steps = append(steps, &Step{
+					Db:     r.OldDb,
+					Table:  r.OldTables[j],
+					Column: r.NewDb + "." + r.NewTables[j],
+					Kind:   STEP_RENAME_TABLE,
+					SQLs:   renameTableSQLs(rename),
+				})
+			}
+		}
+	}
+	if i.needRenameTablesV65(index) {
+		addRenames(TableRenames65)
+		renames, err := i.userDefinedTableRenamesV65(connect)
+		if err != nil {
+			return nil, err
+		}
+		addRenames(renames)
+	}
+	if i.needRenameTables(index) {
+		addRenames(AllTableRenames)
+		for _, tableGroup := range []string{"application", "network"} {
+			datasourceInfos, err := i.getUserDefinedDatasourceInfos(connect, "flow_metrics", tableGroup)
+			if err != nil {
+				return nil, err
+			}
+			for _, dsInfo := range datasourceInfos {
+				// the mv table is recreated by the datasource manager
+				steps = append(steps, &Step{
+					Db:    dsInfo.db,
+					Table: dsInfo.name + "_mv",
+					Kind:  STEP_DROP_TABLE,
+					SQLs:  []string{fmt.Sprintf("DROP TABLE IF EXISTS %s.`%s`", dsInfo.db, dsInfo.name+"_mv")},
+				})
+			}
+		}
+	}
+	if i.needRecreateTables(index) {
+		for _, tables := range i.tableRecreates {
+			for _, table := range tables.Tables {
+				if !exists(tables.Db, table) {
+					continue
+				}
+				steps = append(steps, &Step{
+					Db:    tables.Db,
+					Table: table,
+					Kind:  STEP_DROP_TABLE,
+					SQLs:  []string{dropTableSQL(tables.Db, table)},
+				})
+			}
+		}
+	}
+	for _, s := range steps {
+		s.Addr = i.Addrs[index]
+	}
+	return steps, nil
+}
+
+// planNativeTags lists the native tag columns which do not exist in the tables
+func (i *Issu) planNativeTags(index int, orgIDPrefix string, orgId uint16, connect *sql.DB, nativeTags [nativetag.MAX_NATIVE_TAG_TABLE]*nativetag.NativeTag) []*Step {
+	steps := []*Step{}
+	for _, nativeTag := range nativeTags {
+		if nativeTag == nil {
+			continue
+		}
+		ddls, err := nativetag.CKAddNativeTagDDLs(i.ckdbType == ckdb.CKDBTypeByconity, orgId, nativeTag)
+		if err != nil {
+			log.Warningf("get native tag DDLs of org %d failed: %s", orgId, err)
+			continue
+		}
+		for _, ddl := range ddls {
+			if columnType, _ := i.getColumnType(connect, ddl.Database, ddl.Table, ddl.ColumnName); columnType != "" {
+				continue
+			}
+			steps = append(steps, &Step{
+				Addr:        i.Addrs[index],
+				OrgIDPrefix: orgIDPrefix,
+				Db:          ddl.Database,
+				Table:       ddl.Table,
+				Column:      ddl.ColumnName,
+				ColumnType:  ddl.ColumnType,
+				Kind:        STEP_ADD_NATIVE_TAG,
+				SQLs:        ddl.SQLs,
+			})
+		}
+	}
+	return steps
+}
+
+// planDropAlertEventTable lists the drop of the alert_event tables by RunDropAlertEventTableIfNotReplacingMergeTree
+func (i *Issu) planDropAlertEventTable(index int, orgIDPrefix string, connect *sql.DB) []*Step {
+	db := orgIDPrefix + "event"
+	engine, err := getAlertEventEngine(connect, db)
+	if err != nil {
+		log.Warningf("query alert_event engine failed: %s", err)
+		return nil
+	}
+	if engine == "" || strings.Contains(engine, "ReplacingMergeTree") {
+		return nil
+	}
+	return []*Step{{
+		Addr:        i.Addrs[index],
+		OrgIDPrefix: orgIDPrefix,
+		Db:          db,
+		Table:       ALERT_EVENT_GLOBAL_TABLE,
+		ColumnType:  engine,
+		Kind:        STEP_DROP_TABLE,
+		SQLs:        dropAlertEventSQLs(db),
+	}}
+}
+
+func orgName(orgIDPrefix string) string {
+	if orgIDPrefix == "" {
+		return DEFAULT_ORG_NAME
+	}
+	return strings.TrimSuffix(orgIDPrefix, "_")
+}
+
+// PrintPlan writes the steps grouped by ClickHouse node, organization and table.
+func PrintPlan(w io.Writer, steps []*Step) {
+	if len(steps) == 0 {
+		fmt.Fprintf(w, "no schema change, all tables are at version %s\n", common.CK_VERSION)
+		return
+	}
+	var lastNode, lastTable string
+	todo := 0
+	for _, s := range steps {
+		if node := s.Addr + "/" + s.OrgIDPrefix; node != lastNode {
+			fmt.Fprintf(w, "clickhouse: %s organization: %s\n", s.Addr, orgName(s.OrgIDPrefix))
+			lastNode, lastTable = node, ""
+		}
+		if table := genKey(s.Db, s.Table); table != lastTable {
+			fmt.Fprintf(w, "  %s.`%s` parts: %d rows: %d bytes on disk: %d\n", s.Db, s.Table, s.Parts, s.Rows, s.BytesOnDisk)
+			lastTable = table
+		}
+		state := "todo"
+		if s.Done {
+			state = "done"
+		} else {
+			todo++
+		}
+		fmt.Fprintf(w, "    [%s] %s %s\n", state, s.Kind, s.Column)
+		for _, sql := range s.SQLs {
+			fmt.Fprintf(w, "      %s\n", sql)
+		}
+	}
+	fmt.Fprintf(w, "total steps: %d, to apply: %d\n", len(steps), todo)
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ckissu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+func TestPlanOrg(t *testing.T) {
+	i := &Issu{
+		columnAdds: []*ColumnAdd{
+			{Db: "flow_log", Table: "l7_flow_log_local", ColumnName: "biz_type", ColumnType: ckdb.UInt8},
+			{Db: "flow_log", Table: "l7_flow_log", ColumnName: "biz_type", ColumnType: ckdb.UInt8},
+			{Db: "flow_log", Table: "l4_flow_log_local", ColumnName: "biz_type", ColumnType: ckdb.UInt8},
+		},
+		columnRenames: []*ColumnRename{
+			{Db: "flow_log", Table: "l7_flow_log_local", OldColumnName: "a", OldColumnType: ckdb.String, NewColumnName: "b"},
+		},
+		modTTLs: []*TableModTTL{
+			{Db: "flow_log", Table: "l7_flow_log_local", NewTTL: 24},
+		},
+		Addrs: []string{"127.0.0.1:9000"},
+		VersionMaps: []map[string]string{{
+			genKey("0002_flow_log", "l7_flow_log_local"): "v6.6.1.0",
+			genKey("0002_flow_log", "l7_flow_log"):       "v6.6.1.0",
+			genKey("0002_flow_log", "l4_flow_log_local"): common.CK_VERSION,
+		}},
+		doneSteps: []map[string]struct{}{{
+			"add_column|0002_flow_log|l7_flow_log|biz_type|UInt8": {},
+			// the column type is changed after it is added
+			"add_column|0002_flow_log|l7_flow_log_local|biz_type|UInt16": {},
+		}},
+	}
+
+	steps := i.planOrg(0, "0002_")
+	// l4_flow_log_local is already updated
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 steps, got %d: %v", len(steps), steps)
+	}
+	if steps[0].Kind != STEP_RENAME_COLUMN || len(steps[0].SQLs) != 2 || steps[0].SQLs[1] != "ALTER TABLE 0002_flow_log.`l7_flow_log_local` update b=a WHERE 1" {
+		t.Errorf("unexpected rename step %+v", steps[0])
+	}
+	if steps[1].SQLs[0] != "ALTER TABLE 0002_flow_log.`l7_flow_log_local` ADD COLUMN biz_type UInt8 " || steps[1].Done {
+		t.Errorf("unexpected add step %+v", steps[1])
+	}
+	if !steps[2].Done {
+		t.Errorf("step %s should be done", steps[2])
+	}
+	if steps[3].Kind != STEP_MOD_TTL || steps[3].SQLs[0] != "ALTER TABLE 0002_flow_log.`l7_flow_log_local` MODIFY TTL time + toIntervalHour(24)" {
+		t.Errorf("unexpected ttl step %+v", steps[3])
+	}
+	// planning must not change the database of the shared changes
+	if i.columnAdds[0].Db != "flow_log" {
+		t.Errorf("columnAdds modified: %s", i.columnAdds[0].Db)
+	}
+
+	var b strings.Builder
+	PrintPlan(&b, steps)
+	if !strings.Contains(b.String(), "organization: 0002") || !strings.Contains(b.String(), "total steps: 4, to apply: 3") {
+		t.Errorf("unexpected plan output:\n%s", b.String())
+	}
+}
+
+func TestPlanTables(t *testing.T) {
+	i := &Issu{
+		tableRecreates: []*Tables{
+			{Db: "flow_metrics", Tables: []string{"network_map.1m_local", "network_map.1m", "application.1m"}},
+		},
+		Addrs: []string{"127.0.0.1:9000"},
+		VersionMaps: []map[string]string{{
+			genKey("flow_log", "l7_flow_log_local"):        "v7.1.0.0",
+			genKey("flow_metrics", "network_map.1m_local"): "v7.1.3.0",
+			genKey("flow_metrics", "network_map.1m"):       "v7.1.3.0",
+		}},
+	}
+	steps, err := i.planTables(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// application.1m does not exist
+	if len(steps) != 2 || steps[0].Kind != STEP_DROP_TABLE || steps[0].SQLs[0] != `DROP TABLE IF EXISTS flow_metrics."network_map.1m_local"` {
+		t.Fatalf("unexpected steps %v", steps)
+	}
+
+	i.VersionMaps[0][genKey("flow_metrics", "network_map.1m_local")] = "v7.1.4.0"
+	if steps, _ := i.planTables(0, nil); len(steps) != 0 {
+		t.Errorf("expected no steps after v7.1.4.0, got %v", steps)
+	}
+}
+
+func TestCompareColumns(t *testing.T) {
+	expected := []*ckdb.Column{
+		ckdb.NewColumn("time", ckdb.DateTime),
+		ckdb.NewColumn("start_time", ckdb.DateTime64us),
+		ckdb.NewColumn("ip4", ckdb.IPv4),
+		ckdb.NewColumn("l7_protocol", ckdb.UInt8),
+	}
+	actual := map[string]string{
+		"time":        "DateTime('Asia/Tokyo')",
+		"start_time":  "DateTime64(6, 'Asia/Tokyo')",
+		"ip4":         "UInt32",
+		"native_tag1": "String",
+	}
+	diffs := compareColumns("127.0.0.1:9000", "flow_log", "l7_flow_log_local", expected, actual)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs, got %v", diffs)
+	}
+	if diffs[0].Kind != DIFF_TYPE_MISMATCH || diffs[0].Column != "ip4" {
+		t.Errorf("unexpected diff %s", diffs[0])
+	}
+	if diffs[1].Kind != DIFF_MISSING_COLUMN || diffs[1].Column != "l7_protocol" {
+		t.Errorf("unexpected diff %s", diffs[1])
+	}
+	if diffs[2].Kind != DIFF_EXTRA_COLUMN || diffs[2].Column != "native_tag1" {
+		t.Errorf("unexpected diff %s", diffs[2])
+	}
+}
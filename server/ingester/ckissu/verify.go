@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ckissu
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/dbwriter"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
+)
+
+type SchemaDiffKind string
+
+const (
+	DIFF_MISSING_COLUMN SchemaDiffKind = "missing_column"
+	DIFF_TYPE_MISMATCH  SchemaDiffKind = "type_mismatch"
+	// columns added at runtime, such as native tags, are also reported as extra columns
+	DIFF_EXTRA_COLUMN SchemaDiffKind = "extra_column"
+)
+
+type SchemaDiff struct {
+	Addr     string
+	Db       string
+	Table    string
+	Column   string
+	Kind     SchemaDiffKind
+	Expected string
+	Actual   string
+}
+
+func (d *SchemaDiff) String() string {
+	return fmt.Sprintf("%s %s.`%s` [%s] %s expected: '%s' actual: '%s'", d.Addr, d.Db, d.Table, d.Kind, d.Column, d.Expected, d.Actual)
+}
+
+// SchemaTables returns the table definitions which are verified by default: the flow_metrics
+// and flow_log tables, which are changed by most of the upgrades.
+func SchemaTables(cfg *config.Config) []*ckdb.Table {
+	coldStorages := cfg.GetCKDBColdStorages()
+	coldStorage := &ckdb.ColdStorage{}
+	tables := flow_metrics.GetMetricsTables(ckdb.MergeTree, common.CK_VERSION, ckdb.DF_CLUSTER, ckdb.DF_STORAGE_POLICY, cfg.CKDB.Type, 7, 1, 7, 1, coldStorages)
+	tables = append(tables, dbwriter.GetFlowLogTables(ckdb.MergeTree, ckdb.DF_CLUSTER, ckdb.DF_STORAGE_POLICY, cfg.CKDB.Type, 1, 1, 1, coldStorages)...)
+	tables = append(tables,
+		dbwriter.GenSpanWithTraceIDCKTable(ckdb.DF_CLUSTER, ckdb.DF_STORAGE_POLICY, cfg.CKDB.Type, 1, coldStorage),
+		dbwriter.GenTraceTreeCKTable(ckdb.DF_CLUSTER, ckdb.DF_STORAGE_POLICY, cfg.CKDB.Type, 1, coldStorage))
+	return tables
+}
+
+var timeZoneRegexp = regexp.MustCompile(`(DateTime(64)?\((\d+)?)(, )?'[^']*'\)`)
+
+// the time zone of the time columns may be modified by configuration, and ClickHouse
+// rewrites the values of Enum8, so both are ignored when comparing column types
+func normalizeColumnType(columnType string) string {
+	columnType = timeZoneRegexp.ReplaceAllString(columnType, "$1)")
+	columnType = strings.ReplaceAll(columnType, "DateTime()", "DateTime")
+	if strings.HasPrefix(columnType, "Enum8(") {
+		return "Enum8"
+	}
+	return columnType
+}
+
+func expectedColumnType(c *ckdb.Column) string {
+	if c.TypeArgs != "" {
+		return fmt.Sprintf(c.Type.String(), c.TypeArgs)
+	}
+	return c.Type.String()
+}
+
+func getColumnTypes(connect *sql.DB, db, table string) (map[string]string, error) {
+	sql := fmt.Sprintf("SELECT name, type FROM system.columns WHERE database='%s' AND table='%s'", db, table)
+	rows, err := Query(connect, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]string)
+	for rows.Next() {
+		var name, columnType string
+		if err := rows.Scan(&name, &columnType); err != nil {
+			return nil, err
+		}
+		columns[name] = columnType
+	}
+	return columns, nil
+}
+
+func compareColumns(addr, db, table string, expected []*ckdb.Column, actual map[string]string) []*SchemaDiff {
+	diffs := []*SchemaDiff{}
+	defined := make(map[string]struct{}, len(expected))
+	for _, c := range expected {
+		defined[c.Name] = struct{}{}
+		expectedType := expectedColumnType(c)
+		actualType, ok := actual[c.Name]
+		if !ok {
+			diffs = append(diffs, &SchemaDiff{Addr: addr, Db: db, Table: table, Column: c.Name, Kind: DIFF_MISSING_COLUMN, Expected: expectedType})
+		} else if normalizeColumnType(expectedType) != normalizeColumnType(actualType) {
+			diffs = append(diffs, &SchemaDiff{Addr: addr, Db: db, Table: table, Column: c.Name, Kind: DIFF_TYPE_MISMATCH, Expected: expectedType, Actual: actualType})
+		}
+	}
+	extras := []string{}
+	for name := range actual {
+		if _, ok := defined[name]; !ok {
+			extras = append(extras, name)
+		}
+	}
+	sort.Strings(extras)
+	for _, name := range extras {
+		diffs = append(diffs, &SchemaDiff{Addr: addr, Db: db, Table: table, Column: name, Kind: DIFF_EXTRA_COLUMN, Actual: actual[name]})
+	}
+	return diffs
+}
+
+// Verify compares the live schemas of all organizations with the table definitions.
+// Tables which have not been created yet are skipped.
+func (i *Issu) Verify(tables []*ckdb.Table) ([]*SchemaDiff, error) {
+	if len(i.Connections) == 0 {
+		return nil, fmt.Errorf("connections is nil")
+	}
+
+	diffs := []*SchemaDiff{}
+	for index, connect := range i.Connections {
+		orgIDPrefixs, err := i.getOrgIDPrefixsWithoutDefault(connect)
+		if err != nil {
+			return nil, fmt.Errorf("get orgIDs failed, err: %s", err)
+		}
+		for _, orgIDPrefix := range append([]string{""}, orgIDPrefixs...) {
+			for _, t := range tables {
+				db := orgIDPrefix + t.Database
+				names := []string{t.LocalName, t.GlobalName}
+				if i.ckdbType == ckdb.CKDBTypeByconity {
+					names = []string{t.GlobalName}
+				}
+				for _, name := range names {
+					actual, err := getColumnTypes(connect, db, name)
+					if err != nil {
+						return nil, err
+					}
+					if len(actual) == 0 {
+						continue
+					}
+					diffs = append(diffs, compareColumns(i.Addrs[index], db, name, t.Columns, actual)...)
+				}
+			}
+		}
+	}
+	return diffs, nil
+}
+
+func PrintSchemaDiffs(w io.Writer, diffs []*SchemaDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "all verified tables match the table definitions")
+		return
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(w, d)
+	}
+	fmt.Fprintf(w, "total differences: %d\n", len(diffs))
+}
@@ -17,5 +17,5 @@
 package common
 
 const (
-	CK_VERSION = "v7.1.7.3" // 用于表示clickhouse的表版本号
+	CK_VERSION = "v7.1.7.4" // 用于表示clickhouse的表版本号
 )
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	v11 "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// OpenTelemetry semantic convention resource attributes used to fill the universal tags
+const (
+	OTEL_SERVICE_NAME = "service.name"
+	OTEL_K8S_POD_NAME = "k8s.pod.name"
+	OTEL_K8S_POD_IP   = "k8s.pod.ip"
+	OTEL_HOST_IP      = "app.host.ip"
+)
+
+// OTelValueString converts the OTLP AnyValue to string, arrays and kvlists are rendered as JSON-like text
+func OTelValueString(value *v11.AnyValue) string {
+	sb := &strings.Builder{}
+	writeOTelValue(sb, value)
+	return sb.String()
+}
+
+func writeOTelValue(sb *strings.Builder, value *v11.AnyValue) {
+	switch v := value.GetValue().(type) {
+	case *v11.AnyValue_StringValue:
+		sb.WriteString(v.StringValue)
+	case *v11.AnyValue_BoolValue:
+		sb.WriteString(strconv.FormatBool(v.BoolValue))
+	case *v11.AnyValue_IntValue:
+		sb.WriteString(strconv.FormatInt(v.IntValue, 10))
+	case *v11.AnyValue_DoubleValue:
+		sb.WriteString(strconv.FormatFloat(v.DoubleValue, 'g', -1, 64))
+	case *v11.AnyValue_BytesValue:
+		sb.WriteString(base64.StdEncoding.EncodeToString(v.BytesValue))
+	case *v11.AnyValue_ArrayValue:
+		sb.WriteByte('[')
+		for i, e := range v.ArrayValue.GetValues() {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeOTelValue(sb, e)
+		}
+		sb.WriteByte(']')
+	case *v11.AnyValue_KvlistValue:
+		sb.WriteByte('{')
+		for i, kv := range v.KvlistValue.GetValues() {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(kv.GetKey())
+			sb.WriteByte(':')
+			writeOTelValue(sb, kv.GetValue())
+		}
+		sb.WriteByte('}')
+	}
+}
+
+// OTelNumberValue returns the value of int or double AnyValue
+func OTelNumberValue(value *v11.AnyValue) (float64, bool) {
+	switch v := value.GetValue().(type) {
+	case *v11.AnyValue_IntValue:
+		return float64(v.IntValue), true
+	case *v11.AnyValue_DoubleValue:
+		return v.DoubleValue, true
+	}
+	return 0, false
+}
@@ -30,6 +30,8 @@ import (
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 )
 
 var log = logging.MustGetLogger("config")
@@ -53,6 +55,7 @@ const (
 	DefaultCKDBServicePort          = 9000
 	DefaultListenPort               = 20033
 	DefaultGrpcBufferSize           = 104857600
+	DefaultQuotaSyncInterval        = 60 // s
 	DefaultServiceLabelerLruCap     = 1 << 22
 	DefaultCKDBEndpointTCPPortName  = "tcp-port"
 	DefaultStatsInterval            = 10      // s
@@ -69,6 +72,8 @@ const (
 	//   any endpoints beyond this limit will be ignored
 	MaxClickHouseEndpointsPerServer = 128
 	DefaultDatasourceListenPort     = 20106
+	CKIssuModeApply                 = "apply"
+	CKIssuModePlan                  = "plan"
 )
 
 type DatabaseTable struct {
@@ -139,6 +144,11 @@ type CKWriterConfig struct {
 	FlushTimeout int `yaml:"flush-timeout"`
 }
 
+type CKIssu struct {
+	Mode         string `yaml:"mode"`
+	VerifySchema bool   `yaml:"verify-schema"`
+}
+
 type CKDB struct {
 	External            bool     `yaml:"external"`
 	Type                string   `yaml:"type"`
@@ -164,6 +174,73 @@ func (c *CKDB) updateActualAddrs(endpoints []Endpoint) {
 	c.ActualAddrs = &c.actualAddrsValue
 }
 
+// QueueOption overrides the options of the queue with the name shown by `deepflow-ctl ingester queue show`
+type QueueOption struct {
+	Name             string `yaml:"name"`
+	OverflowPolicy   string `yaml:"overflow-policy"` // overwrite, block or drop-newest
+	BlockTimeout     int    `yaml:"block-timeout"`   // millisecond
+	LatencyHistogram bool   `yaml:"latency-histogram"`
+}
+
+func (o *QueueOption) Options() []queue.Option {
+	policy, _ := queue.ParseOverflowPolicy(o.OverflowPolicy)
+	return []queue.Option{
+		queue.OptionOverflow{Policy: policy, BlockTimeout: time.Duration(o.BlockTimeout) * time.Millisecond},
+		queue.OptionLatencyHistogram(o.LatencyHistogram),
+	}
+}
+
+// QuotaConfig limits the data of the orgs and teams, the quotas saved by the controller
+// API '/v1/ingester-quotas/' are synced every SyncInterval and replace the configured quotas
+type QuotaConfig struct {
+	Enabled      bool         `yaml:"enabled"`
+	SyncInterval int          `yaml:"sync-interval"` // second
+	Quotas       []QuotaLimit `yaml:"quotas"`
+}
+
+type QuotaLimit struct {
+	OrgId             uint16           `yaml:"org-id"`
+	TeamId            uint32           `yaml:"team-id"` // 0 means the whole org
+	MessagesPerSecond int64            `yaml:"messages-per-second"`
+	BytesPerSecond    int64            `yaml:"bytes-per-second"`
+	Action            string           `yaml:"action"` // throttle or drop
+	RowsPerDay        map[string]int64 `yaml:"rows-per-day"`
+}
+
+func (l *QuotaLimit) Limit() (*quota.Limit, error) {
+	limit := &quota.Limit{
+		OrgId:             l.OrgId,
+		TeamId:            l.TeamId,
+		MessagesPerSecond: l.MessagesPerSecond,
+		BytesPerSecond:    l.BytesPerSecond,
+	}
+	if l.Action != "" {
+		action, err := quota.ParseAction(l.Action)
+		if err != nil {
+			return nil, err
+		}
+		limit.Action = action
+	}
+	for name, rows := range l.RowsPerDay {
+		ds, err := quota.ParseDatasource(name)
+		if err != nil {
+			return nil, err
+		}
+		limit.RowsPerDay[ds] = rows
+	}
+	return limit, limit.Validate()
+}
+
+func (c *QuotaConfig) Limits() []quota.Limit {
+	limits := make([]quota.Limit, 0, len(c.Quotas))
+	for i := range c.Quotas {
+		if l, err := c.Quotas[i].Limit(); err == nil {
+			limits = append(limits, *l)
+		}
+	}
+	return limits
+}
+
 type Config struct {
 	IsRunningModeStandalone  bool
 	StorageDisabled          bool            `yaml:"storage-disabled"`
@@ -172,12 +249,15 @@ type Config struct {
 	ControllerIPs            []string        `yaml:"controller-ips,flow"`
 	ControllerPort           uint16          `yaml:"controller-port"`
 	CKDBAuth                 Auth            `yaml:"ckdb-auth"`
+	CKIssu                   CKIssu          `yaml:"ckissu"`
 	IngesterEnabled          bool            `yaml:"ingester-enabled"`
 	UDPReadBuffer            int             `yaml:"udp-read-buffer"`
 	TCPReadBuffer            int             `yaml:"tcp-read-buffer"`
 	TCPReaderBuffer          int             `yaml:"tcp-reader-buffer"`
 	CKDiskMonitor            CKDiskMonitor   `yaml:"ck-disk-monitor"`
 	ColdStorage              CKDBColdStorage `yaml:"ckdb-cold-storage"`
+	QueueOptions             []QueueOption   `yaml:"queue-options"`
+	Quota                    QuotaConfig     `yaml:"quota"`
 	ckdbColdStorages         map[string]*ckdb.ColdStorage
 	NodeIP                   string `yaml:"node-ip"`
 	GrpcBufferSize           int    `yaml:"grpc-buffer-size"`
@@ -249,6 +329,32 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for i := range c.QueueOptions {
+		o := &c.QueueOptions[i]
+		if o.Name == "" {
+			return fmt.Errorf("'ingester.queue-options[%d].name' is empty", i)
+		}
+		if o.OverflowPolicy == "" {
+			o.OverflowPolicy = queue.OVERFLOW_OVERWRITE.String()
+		}
+		if _, err := queue.ParseOverflowPolicy(o.OverflowPolicy); err != nil {
+			return fmt.Errorf("'ingester.queue-options[%d].overflow-policy': %s", i, err)
+		}
+	}
+
+	seen := make(map[quota.Limit]bool)
+	for i := range c.Quota.Quotas {
+		l, err := c.Quota.Quotas[i].Limit()
+		if err != nil {
+			return fmt.Errorf("'ingester.quota.quotas[%d]': %s", i, err)
+		}
+		key := quota.Limit{OrgId: l.OrgId, TeamId: l.TeamId}
+		if seen[key] {
+			return fmt.Errorf("'ingester.quota.quotas[%d]': duplicate quota of org %d team %d", i, l.OrgId, l.TeamId)
+		}
+		seen[key] = true
+	}
+
 	if len(c.ControllerIPs) == 0 {
 		log.Warning("controller-ips is empty")
 	} else {
@@ -278,6 +384,10 @@ func (c *Config) Validate() error {
 		c.GrpcBufferSize = DefaultGrpcBufferSize
 	}
 
+	if c.Quota.SyncInterval <= 0 {
+		c.Quota.SyncInterval = DefaultQuotaSyncInterval
+	}
+
 	if c.ServiceLabelerLruCap <= 0 {
 		c.ServiceLabelerLruCap = DefaultServiceLabelerLruCap
 	}
@@ -286,6 +396,11 @@ func (c *Config) Validate() error {
 		c.StatsInterval = DefaultStatsInterval
 	}
 
+	if c.CKIssu.Mode != CKIssuModeApply && c.CKIssu.Mode != CKIssuModePlan {
+		log.Warningf("invalid 'ckissu.mode'(%s), must be '%s' or '%s', set to '%s'", c.CKIssu.Mode, CKIssuModeApply, CKIssuModePlan, CKIssuModeApply)
+		c.CKIssu.Mode = CKIssuModeApply
+	}
+
 	var myNodeName, myPodName, myNamespace string
 	// in standalone mode, no 'EnvK8sNodeName', 'EnvK8sPodName', 'EnvK8sNamespace' environment variables
 	if c.IsRunningModeStandalone {
@@ -536,6 +651,7 @@ func Load(path string) *Config {
 			FlowTagCacheFlushTimeout: DefaultFlowTagCacheFlushTimeout,
 			FlowTagCacheMaxSize:      DefaultFlowTagCacheMaxSize,
 			DatasourceListenPort:     DefaultDatasourceListenPort,
+			CKIssu:                   CKIssu{Mode: CKIssuModeApply},
 		},
 	}
 	if err != nil {
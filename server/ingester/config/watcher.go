@@ -242,6 +242,11 @@ func (w *Watcher) getMyExpectedClickhouseEndpoints() ([]Endpoint, error) {
 	}
 }
 
+// MyPodName returns the pod name of this deepflow-server, which is one of NodePodNamesWatch.GetServerPodNames()
+func (w *Watcher) MyPodName() string {
+	return w.myPodName
+}
+
 func (w *Watcher) GetMyClickhouseEndpoints() ([]Endpoint, error) {
 	if len(w.myClickhouseEndpoints) != 0 {
 		return w.myClickhouseEndpoints, nil
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
@@ -47,7 +48,7 @@ type DatasourceManager struct {
 	readTimeout      int
 	replicaEnabled   bool
 	ckdbColdStorages map[string]*ckdb.ColdStorage
-	isModifyingFlags [ckdb.MAX_ORG_ID + 1][MAX_DATASOURCE_COUNT]bool
+	isModifyingFlags [ckdb.MAX_ORG_ID + 1][MAX_DATASOURCE_COUNT]atomic.Bool // set before the modification starts, so concurrent requests are rejected
 	cks              common.DBs
 
 	ckdbCluster       string
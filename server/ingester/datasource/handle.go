@@ -572,6 +572,9 @@ func (m *DatasourceManager) Handle(orgID int, action ActionEnum, dbGroup, baseTa
 	if len(m.cks) == 0 {
 		return fmt.Errorf("clickhouse connections is empty")
 	}
+	if isRollupDatasource(dbGroup, dstTable) {
+		return m.handleRollup(orgID, action, dbGroup, baseTable, dstTable, aggrUnsummable, interval, duration)
+	}
 	if IsModifiedOnlyDatasource(dbGroup) && action == MOD {
 		datasoureInfo := DatasourceModifiedOnly(dbGroup).DatasourceInfo()
 		datasourceId := datasoureInfo.ID
@@ -580,11 +583,10 @@ func (m *DatasourceManager) Handle(orgID int, action ActionEnum, dbGroup, baseTa
 		flowTagDb := ckdb.OrgDatabasePrefix(uint16(orgID)) + FLOW_TAG_DB
 		flowTagTables := datasoureInfo.FlowTagTables
 
-		if m.isModifyingFlags[orgID][datasourceId] {
+		if !m.isModifyingFlags[orgID][datasourceId].CompareAndSwap(false, true) {
 			return fmt.Errorf(ERR_IS_MODIFYING, dbGroup)
 		}
 		go func(tableNames, flowTagTableNames []string, id int) {
-			m.isModifyingFlags[orgID][id] = true
 			for _, tableName := range tableNames {
 				if err := m.modTableTTL(m.cks, db, tableName, duration); err != nil {
 					log.Info(err)
@@ -595,7 +597,7 @@ func (m *DatasourceManager) Handle(orgID int, action ActionEnum, dbGroup, baseTa
 					log.Info(err)
 				}
 			}
-			m.isModifyingFlags[orgID][id] = false
+			m.isModifyingFlags[orgID][id].Store(false)
 		}(tables, flowTagTables, datasourceId)
 
 		return nil
@@ -647,16 +649,15 @@ func (m *DatasourceManager) Handle(orgID int, action ActionEnum, dbGroup, baseTa
 				return err
 			}
 		case MOD:
-			if m.isModifyingFlags[orgID][tableId] {
+			if !m.isModifyingFlags[orgID][tableId].CompareAndSwap(false, true) {
 				return fmt.Errorf(ERR_IS_MODIFYING, tableId.TableName())
 			}
 			log.Infof("mod rp tableId %d %s, dstTable %s", tableId, tableId.TableName(), dstTable)
 			go func(id flow_metrics.MetricsTableID) {
-				m.isModifyingFlags[orgID][id] = true
 				if err := m.modTableMV(m.cks, id, db, dstTable, duration); err != nil {
 					log.Warning(err)
 				}
-				m.isModifyingFlags[orgID][id] = false
+				m.isModifyingFlags[orgID][id].Store(false)
 			}(tableId)
 		case DEL:
 			if err := delTableMV(m.cks, tableId, db, dstTable); err != nil {
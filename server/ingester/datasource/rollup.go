@@ -0,0 +1,573 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datasource
+
+import (
+	"fmt"
+	"strings"
+
+	basecommon "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+// Rollups downsample the tables whose metrics are not pre-aggregated (prometheus.samples, ext_metrics.metrics).
+// Every series keeps sum/min/max/count/last in the agg table, the local view exposes the metrics
+// columns of the base table, computed with the operator chosen when the rollup was created.
+const (
+	ROLLUP_TABLE_1H = "1h"
+	ROLLUP_TABLE_1D = "1d"
+
+	LAST = "last"
+
+	rollupTimeKey    = "time"
+	rollupRawTimeKey = "__raw_time"
+)
+
+type rollupKind uint8
+
+const (
+	rollupScalar     rollupKind = iota // one Float64 'value' column per row, e.g. prometheus.samples
+	rollupNamedArray                   // metrics stored as names/values arrays, e.g. ext_metrics.metrics
+)
+
+type rollupSpec struct {
+	kind       rollupKind
+	table      string
+	primaryKey []string
+	// columns of the base table which are aggregated, all other columns are grouped by
+	metricsColumns []string
+}
+
+var rollupSpecs = map[string]rollupSpec{
+	PROMETHEUS: {
+		kind:           rollupScalar,
+		table:          "samples",
+		primaryKey:     []string{"metric_id", rollupTimeKey, "target_id"},
+		metricsColumns: []string{"value"},
+	},
+	EXT_METRICS: {
+		kind:           rollupNamedArray,
+		table:          "metrics",
+		primaryKey:     []string{"virtual_table_name", rollupTimeKey},
+		metricsColumns: []string{"metrics_float_names", "metrics_float_values"},
+	},
+}
+
+// the operators which could be used by the metrics columns of rollup local view
+var rollupOperators = []string{aggrStrings[AVG], aggrStrings[MAX], aggrStrings[MIN], aggrStrings[SUM], LAST}
+
+func isRollupDatasource(dbGroup, dstTable string) bool {
+	_, ok := rollupSpecs[dbGroup]
+	return ok && dstTable != dbGroup
+}
+
+func getRollupTableName(db, table, dstTable string, t TableType) string {
+	if t == GLOBAL {
+		return fmt.Sprintf("%s.`%s.%s`", db, table, dstTable)
+	}
+	return fmt.Sprintf("%s.`%s.%s_%s`", db, table, dstTable, t.String())
+}
+
+func getRollupBaseTableName(db, table, ckdbType string) string {
+	if ckdbType == ckdb.CKDBTypeByconity {
+		return fmt.Sprintf("%s.`%s`", db, table)
+	}
+	return fmt.Sprintf("%s.`%s%s`", db, table, ckdb.LOCAL_SUBFFIX)
+}
+
+func rollupTimeFunc(dstTable string) (ckdb.TimeFuncType, ckdb.TimeFuncType, error) {
+	switch dstTable {
+	case ROLLUP_TABLE_1H:
+		return ckdb.TimeFuncHour, ckdb.TimeFuncWeek, nil
+	case ROLLUP_TABLE_1D:
+		return ckdb.TimeFuncDay, ckdb.TimeFuncYYYYMM, nil
+	default:
+		return 0, 0, fmt.Errorf("rollup table name(%s) only support %s or %s", dstTable, ROLLUP_TABLE_1H, ROLLUP_TABLE_1D)
+	}
+}
+
+type rollupColumn struct {
+	name string
+	typ  string
+}
+
+// the group by columns of the rollup, in the order of the base table
+func (s *rollupSpec) groupByColumns(baseColumns []rollupColumn) []rollupColumn {
+	columns := []rollupColumn{}
+	for _, c := range baseColumns {
+		// 跳过_开头的字段，如_tid, _id
+		if strings.HasPrefix(c.name, "_") || stringSliceHas(s.metricsColumns, c.name) {
+			continue
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+// metric aggregate column definitions in agg table, the operator is saved in the comment of the first column
+func (s *rollupSpec) aggColumns(operator string) []string {
+	switch s.kind {
+	case rollupScalar:
+		return []string{
+			fmt.Sprintf("value__sum AggregateFunction(sum, Float64) COMMENT '%s'", operator),
+			"value__min AggregateFunction(min, Float64)",
+			"value__max AggregateFunction(max, Float64)",
+			"value__count AggregateFunction(count, Float64)",
+			"value__last AggregateFunction(argMax, Float64, DateTime)",
+		}
+	default:
+		return []string{
+			fmt.Sprintf("metrics_float__sum AggregateFunction(sumMap, Array(String), Array(Float64)) COMMENT '%s'", operator),
+			"metrics_float__min AggregateFunction(minMap, Array(String), Array(Float64))",
+			"metrics_float__max AggregateFunction(maxMap, Array(String), Array(Float64))",
+			"metrics_float__count AggregateFunction(count)",
+			"metrics_float__last AggregateFunction(argMax, Tuple(Array(String), Array(Float64)), DateTime)",
+		}
+	}
+}
+
+func (s *rollupSpec) mvColumns() []string {
+	switch s.kind {
+	case rollupScalar:
+		return []string{
+			"sumState(value) AS value__sum",
+			"minState(value) AS value__min",
+			"maxState(value) AS value__max",
+			"countState(value) AS value__count",
+			fmt.Sprintf("argMaxState(value, %s) AS value__last", rollupRawTimeKey),
+		}
+	default:
+		names := "CAST(metrics_float_names, 'Array(String)')"
+		return []string{
+			fmt.Sprintf("sumMapState(%s, metrics_float_values) AS metrics_float__sum", names),
+			fmt.Sprintf("minMapState(%s, metrics_float_values) AS metrics_float__min", names),
+			fmt.Sprintf("maxMapState(%s, metrics_float_values) AS metrics_float__max", names),
+			"countState() AS metrics_float__count",
+			fmt.Sprintf("argMaxState((%s, metrics_float_values), %s) AS metrics_float__last", names, rollupRawTimeKey),
+		}
+	}
+}
+
+func (s *rollupSpec) localColumns(operator string) []string {
+	switch s.kind {
+	case rollupScalar:
+		value := fmt.Sprintf("finalizeAggregation(value__%s)", operator)
+		if operator == aggrStrings[AVG] {
+			value = "finalizeAggregation(value__sum) / finalizeAggregation(value__count)"
+		}
+		return []string{
+			fmt.Sprintf("%s AS value", value),
+			"finalizeAggregation(value__sum) AS value_sum",
+			"finalizeAggregation(value__min) AS value_min",
+			"finalizeAggregation(value__max) AS value_max",
+			"finalizeAggregation(value__count) AS value_count",
+			"finalizeAggregation(value__last) AS value_last",
+		}
+	default:
+		// avg divides the sum of each metric by the rows count, the rows of a series usually carry the same metrics
+		state := operator
+		if operator == aggrStrings[AVG] {
+			state = aggrStrings[SUM]
+		}
+		values := fmt.Sprintf("tupleElement(finalizeAggregation(metrics_float__%s), 2)", state)
+		if operator == aggrStrings[AVG] {
+			values = fmt.Sprintf("arrayMap(x -> x / finalizeAggregation(metrics_float__count), %s)", values)
+		}
+		return []string{
+			fmt.Sprintf("tupleElement(finalizeAggregation(metrics_float__%s), 1) AS metrics_float_names", state),
+			fmt.Sprintf("%s AS metrics_float_values", values),
+		}
+	}
+}
+
+func (s *rollupSpec) orderKeys(groupBy []rollupColumn) []string {
+	orderKeys := []string{}
+	for _, key := range s.primaryKey {
+		for _, c := range groupBy {
+			if c.name == key {
+				orderKeys = append(orderKeys, key)
+				break
+			}
+		}
+	}
+	primaryKeyCount := len(orderKeys)
+	for _, c := range groupBy {
+		if !stringSliceHas(orderKeys[:primaryKeyCount], c.name) {
+			orderKeys = append(orderKeys, c.name)
+		}
+	}
+	return orderKeys
+}
+
+func (m *DatasourceManager) makeRollupAggTableCreateSQL(s *rollupSpec, groupBy []rollupColumn, db, dstTable, operator string, partitionTime ckdb.TimeFuncType, duration int) string {
+	columns := []string{}
+	for _, c := range groupBy {
+		columns = append(columns, fmt.Sprintf("%s %s", c.name, c.typ))
+	}
+	columns = append(columns, s.aggColumns(operator)...)
+	orderKeys := s.orderKeys(groupBy)
+	primaryKeyCount := 0
+	for _, key := range s.primaryKey {
+		if stringSliceHas(orderKeys, key) {
+			primaryKeyCount++
+		}
+	}
+
+	engine := ckdb.AggregatingMergeTree.String()
+	if m.ckdbType == ckdb.CKDBTypeByconity {
+		engine = ckdb.CnchAggregatingMergeTree.String()
+	}
+	if m.replicaEnabled {
+		engine = fmt.Sprintf(ckdb.ReplicatedAggregatingMergeTree.String(), db, s.table+"."+dstTable+"_"+AGG.String())
+	}
+
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+				   (%s)
+				   ENGINE=%s
+				   PRIMARY KEY (%s)
+				   ORDER BY (%s)
+				   PARTITION BY %s
+				   TTL %s
+				   SETTINGS storage_policy = '%s'`,
+		getRollupTableName(db, s.table, dstTable, AGG),
+		strings.Join(columns, ",\n"),
+		engine,
+		strings.Join(orderKeys[:primaryKeyCount], ","),
+		strings.Join(orderKeys, ","),
+		partitionTime.String(rollupTimeKey),
+		m.makeTTLString(rollupTimeKey, db, s.table, duration),
+		m.ckdbStoragePolicy)
+}
+
+func makeRollupMVTableCreateSQL(s *rollupSpec, groupBy []rollupColumn, db, dstTable, ckdbType string, aggrTimeFunc ckdb.TimeFuncType) string {
+	columns := []string{}
+	groupKeys := []string{}
+	for _, c := range groupBy {
+		if c.name == rollupTimeKey {
+			// 'last' needs the raw time, the 'time' column is replaced by the aggregated time
+			columns = append(columns, fmt.Sprintf("%s AS %s", aggrTimeFunc.String(rollupRawTimeKey), rollupTimeKey))
+		} else {
+			columns = append(columns, c.name)
+		}
+		groupKeys = append(groupKeys, c.name)
+	}
+	columns = append(columns, s.mvColumns()...)
+
+	return fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s TO %s
+			AS SELECT %s
+	                FROM (SELECT *, %s AS %s FROM %s)
+			GROUP BY %s`,
+		getRollupTableName(db, s.table, dstTable, MV), getRollupTableName(db, s.table, dstTable, AGG),
+		strings.Join(columns, ",\n"),
+		rollupTimeKey, rollupRawTimeKey, getRollupBaseTableName(db, s.table, ckdbType),
+		strings.Join(groupKeys, ","))
+}
+
+func makeRollupLocalCreateSQL(s *rollupSpec, groupBy []rollupColumn, db, dstTable, ckdbType, operator string, replace bool) string {
+	tableLocal := getRollupTableName(db, s.table, dstTable, LOCAL)
+	if ckdbType == ckdb.CKDBTypeByconity {
+		tableLocal = getRollupTableName(db, s.table, dstTable, GLOBAL)
+	}
+	columns := []string{}
+	for _, c := range groupBy {
+		columns = append(columns, c.name)
+	}
+	columns = append(columns, s.localColumns(operator)...)
+
+	create := "CREATE VIEW IF NOT EXISTS"
+	if replace {
+		create = "CREATE OR REPLACE VIEW"
+	}
+	return fmt.Sprintf(`
+%s %s
+AS SELECT
+%s
+FROM %s`,
+		create, tableLocal,
+		strings.Join(columns, ",\n"),
+		getRollupTableName(db, s.table, dstTable, AGG))
+}
+
+func makeRollupGlobalCreateSQL(s *rollupSpec, db, dstTable, ckdbType, cluster string) string {
+	if ckdbType == ckdb.CKDBTypeByconity {
+		return "SELECT VERSION()"
+	}
+	engine := fmt.Sprintf(ckdb.Distributed.String(), cluster, db, s.table+"."+dstTable+"_"+LOCAL.String())
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS %s ENGINE = %s",
+		getRollupTableName(db, s.table, dstTable, GLOBAL), getRollupTableName(db, s.table, dstTable, LOCAL), engine)
+}
+
+func systemColumnsTable(ckdbType string) string {
+	if ckdbType == ckdb.CKDBTypeByconity {
+		return "cnch_columns"
+	}
+	return "columns"
+}
+
+// the columns which could be selected from the table, MATERIALIZED and ALIAS columns are excluded
+func getTableColumns(conn basecommon.DBs, ckdbType, db, table string) ([]rollupColumn, error) {
+	sql := fmt.Sprintf("SELECT name, type FROM system.%s WHERE database='%s' AND table='%s' AND default_kind NOT IN ('MATERIALIZED', 'ALIAS') ORDER BY position",
+		systemColumnsTable(ckdbType), db, table)
+	rows, err := conn.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	columns := []rollupColumn{}
+	// the columns of the first connection are used, the others should be the same
+	for i := range rows {
+		for rows[i].Next() {
+			var c rollupColumn
+			if err := rows[i].Scan(&c.name, &c.typ); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				columns = append(columns, c)
+			}
+		}
+	}
+	return columns, nil
+}
+
+func (m *DatasourceManager) createRollup(cks basecommon.DBs, dbGroup, db, baseTable, dstTable, operator string, duration int) error {
+	s := rollupSpecs[dbGroup]
+	if baseTable != dbGroup {
+		return fmt.Errorf("the base data_source of %s rollup should be %s, not %s", dbGroup, dbGroup, baseTable)
+	}
+	if !stringSliceHas(rollupOperators, operator) {
+		return fmt.Errorf("unknown rollup aggr %s, only support %v", operator, rollupOperators)
+	}
+	aggTime, partitionTime, err := rollupTimeFunc(dstTable)
+	if err != nil {
+		return err
+	}
+
+	baseColumns, err := getTableColumns(cks, m.ckdbType, db, s.table)
+	if err != nil {
+		return err
+	}
+	if len(baseColumns) == 0 {
+		return fmt.Errorf("the table %s.%s has not been created yet, please retry after it receives data", db, s.table)
+	}
+	groupBy := s.groupByColumns(baseColumns)
+
+	commands := []string{
+		m.makeRollupAggTableCreateSQL(&s, groupBy, db, dstTable, operator, partitionTime, duration),
+		makeRollupMVTableCreateSQL(&s, groupBy, db, dstTable, m.ckdbType, aggTime),
+		makeRollupLocalCreateSQL(&s, groupBy, db, dstTable, m.ckdbType, operator, false),
+		makeRollupGlobalCreateSQL(&s, db, dstTable, m.ckdbType, m.ckdbCluster),
+	}
+	for _, cmd := range commands {
+		log.Info(cmd)
+		if _, err := cks.Exec(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func delRollup(cks basecommon.DBs, dbGroup, db, dstTable string) error {
+	s := rollupSpecs[dbGroup]
+	for _, t := range []TableType{GLOBAL, LOCAL, MV, AGG} {
+		if _, err := cks.Exec("DROP TABLE IF EXISTS " + getRollupTableName(db, s.table, dstTable, t)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DatasourceManager) handleRollup(orgID int, action ActionEnum, dbGroup, baseTable, dstTable, aggrUnsummable string, interval, duration int) error {
+	s := rollupSpecs[dbGroup]
+	db := ckdb.OrgDatabasePrefix(uint16(orgID)) + DatasourceModifiedOnly(dbGroup).DatasourceInfo().DB
+	if _, _, err := rollupTimeFunc(dstTable); err != nil {
+		return err
+	}
+
+	switch action {
+	case ADD:
+		if interval != 60 && interval != 1440 {
+			return fmt.Errorf("interval(%d) only support 60 or 1440.", interval)
+		}
+		if duration < 1 {
+			return fmt.Errorf("duration(%d) must bigger than 0.", duration)
+		}
+		return m.createRollup(m.cks, dbGroup, db, baseTable, dstTable, aggrUnsummable, duration)
+	case MOD:
+		// rollups share the modifying flag with the base data_source of the same database
+		id := DatasourceModifiedOnly(dbGroup).DatasourceInfo().ID
+		if !m.isModifyingFlags[orgID][id].CompareAndSwap(false, true) {
+			return fmt.Errorf(ERR_IS_MODIFYING, dbGroup)
+		}
+		go func() {
+			if err := m.modTableTTL(m.cks, db, s.table+"."+dstTable+"_"+AGG.String(), duration); err != nil {
+				log.Warning(err)
+			}
+			m.isModifyingFlags[orgID][id].Store(false)
+		}()
+		return nil
+	case DEL:
+		return delRollup(m.cks, dbGroup, db, dstTable)
+	default:
+		return fmt.Errorf("unsupport action %d", action)
+	}
+}
+
+// AddRollupColumns adds the group by columns which were added to the base table after the rollups were created,
+// such as the 'app_label_value_id_x' columns of prometheus.samples, otherwise the series would be merged in the rollups.
+func AddRollupColumns(conns basecommon.DBs, ckdbType, db, table string, columns []string) error {
+	var dbGroup string
+	var s rollupSpec
+	for group, spec := range rollupSpecs {
+		if spec.table == table && strings.HasSuffix(db, DatasourceModifiedOnly(group).DatasourceInfo().DB) {
+			dbGroup, s = group, spec
+		}
+	}
+	if dbGroup == "" {
+		return fmt.Errorf("table %s.%s does not support rollup", db, table)
+	}
+
+	// the tables of each clickhouse node may be different
+	for _, conn := range conns {
+		if err := addRollupColumns(basecommon.DBs{conn}, &s, ckdbType, db, columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rollupTableInfo struct {
+	dstTable   string
+	sortingKey string
+}
+
+func getRollupTables(conn basecommon.DBs, s *rollupSpec, ckdbType, db string) ([]rollupTableInfo, error) {
+	systemTables := "tables"
+	if ckdbType == ckdb.CKDBTypeByconity {
+		systemTables = "cnch_tables"
+	}
+	rows, err := conn.Query(fmt.Sprintf("SELECT name, sorting_key FROM system.%s WHERE database='%s' AND startsWith(name, '%s.') AND endsWith(name, '_%s')",
+		systemTables, db, s.table, AGG.String()))
+	if err != nil {
+		return nil, err
+	}
+	tables := []rollupTableInfo{}
+	for i := range rows {
+		for rows[i].Next() {
+			var name, sortingKey string
+			if err := rows[i].Scan(&name, &sortingKey); err != nil {
+				return nil, err
+			}
+			dstTable := strings.TrimSuffix(strings.TrimPrefix(name, s.table+"."), "_"+AGG.String())
+			if _, _, err := rollupTimeFunc(dstTable); err != nil {
+				continue
+			}
+			tables = append(tables, rollupTableInfo{dstTable: dstTable, sortingKey: sortingKey})
+		}
+	}
+	return tables, nil
+}
+
+func getRollupOperator(conn basecommon.DBs, s *rollupSpec, ckdbType, db, dstTable string) (string, error) {
+	firstAggColumn := strings.Fields(s.aggColumns("")[0])[0]
+	rows, err := conn.Query(fmt.Sprintf("SELECT comment FROM system.%s WHERE database='%s' AND table='%s' AND name='%s'",
+		systemColumnsTable(ckdbType), db, s.table+"."+dstTable+"_"+AGG.String(), firstAggColumn))
+	if err != nil {
+		return "", err
+	}
+	var operator string
+	for i := range rows {
+		for rows[i].Next() {
+			if err := rows[i].Scan(&operator); err != nil {
+				return "", err
+			}
+		}
+	}
+	if !stringSliceHas(rollupOperators, operator) {
+		return "", fmt.Errorf("get rollup operator of %s.%s.%s failed, comment is '%s'", db, s.table, dstTable, operator)
+	}
+	return operator, nil
+}
+
+func addRollupColumns(conn basecommon.DBs, s *rollupSpec, ckdbType, db string, columns []string) error {
+	rollups, err := getRollupTables(conn, s, ckdbType, db)
+	if err != nil || len(rollups) == 0 {
+		return err
+	}
+	baseColumns, err := getTableColumns(conn, ckdbType, db, s.table)
+	if err != nil {
+		return err
+	}
+	groupBy := s.groupByColumns(baseColumns)
+
+	for _, rollup := range rollups {
+		aggColumns, err := getTableColumns(conn, ckdbType, db, s.table+"."+rollup.dstTable+"_"+AGG.String())
+		if err != nil {
+			return err
+		}
+		newColumns := []rollupColumn{}
+		for _, c := range groupBy {
+			if !stringSliceHas(columns, c.name) {
+				continue
+			}
+			exists := false
+			for _, aggColumn := range aggColumns {
+				if aggColumn.name == c.name {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				newColumns = append(newColumns, c)
+			}
+		}
+		if len(newColumns) == 0 {
+			continue
+		}
+		operator, err := getRollupOperator(conn, s, ckdbType, db, rollup.dstTable)
+		if err != nil {
+			return err
+		}
+		aggTime, _, _ := rollupTimeFunc(rollup.dstTable)
+
+		// new columns must be appended to the sorting key in the same ALTER, otherwise the series would be merged
+		alters, sortingKeys := []string{}, []string{rollup.sortingKey}
+		for _, c := range newColumns {
+			alters = append(alters, fmt.Sprintf("ADD COLUMN IF NOT EXISTS %s %s", c.name, c.typ))
+			sortingKeys = append(sortingKeys, c.name)
+		}
+		alters = append(alters, fmt.Sprintf("MODIFY ORDER BY (%s)", strings.Join(sortingKeys, ",")))
+		commands := []string{
+			fmt.Sprintf("ALTER TABLE %s %s", getRollupTableName(db, s.table, rollup.dstTable, AGG), strings.Join(alters, ", ")),
+			"DROP TABLE IF EXISTS " + getRollupTableName(db, s.table, rollup.dstTable, MV),
+			makeRollupMVTableCreateSQL(s, groupBy, db, rollup.dstTable, ckdbType, aggTime),
+			makeRollupLocalCreateSQL(s, groupBy, db, rollup.dstTable, ckdbType, operator, true),
+		}
+		if ckdbType != ckdb.CKDBTypeByconity {
+			alters = alters[:0]
+			for _, c := range newColumns {
+				alters = append(alters, fmt.Sprintf("ADD COLUMN IF NOT EXISTS %s %s", c.name, c.typ))
+			}
+			commands = append(commands, fmt.Sprintf("ALTER TABLE %s %s", getRollupTableName(db, s.table, rollup.dstTable, GLOBAL), strings.Join(alters, ", ")))
+		}
+		for _, cmd := range commands {
+			log.Info(cmd)
+			if _, err := conn.Exec(cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datasource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+var testPrometheusColumns = []rollupColumn{
+	{"time", "DateTime('Asia/Shanghai')"},
+	{"metric_id", "UInt32"},
+	{"target_id", "UInt32"},
+	{"team_id", "UInt16"},
+	{"app_label_value_id_1", "UInt32"},
+	{"value", "Float64"},
+}
+
+func TestIsRollupDatasource(t *testing.T) {
+	tests := []struct {
+		dbGroup  string
+		dstTable string
+		want     bool
+	}{
+		{PROMETHEUS, ROLLUP_TABLE_1H, true},
+		{EXT_METRICS, ROLLUP_TABLE_1D, true},
+		{PROMETHEUS, PROMETHEUS, false},
+		{NETWORK, ROLLUP_TABLE_1H, false},
+		{DEEPFLOW_TENANT, ROLLUP_TABLE_1H, false},
+	}
+	for _, tt := range tests {
+		if got := isRollupDatasource(tt.dbGroup, tt.dstTable); got != tt.want {
+			t.Errorf("isRollupDatasource(%s, %s) = %v, want %v", tt.dbGroup, tt.dstTable, got, tt.want)
+		}
+	}
+}
+
+func TestRollupGroupByAndOrderKeys(t *testing.T) {
+	s := rollupSpecs[PROMETHEUS]
+	groupBy := s.groupByColumns(testPrometheusColumns)
+	if len(groupBy) != len(testPrometheusColumns)-1 {
+		t.Fatalf("group by columns = %v, the metrics column should be excluded", groupBy)
+	}
+	want := "metric_id,time,target_id,team_id,app_label_value_id_1"
+	if got := strings.Join(s.orderKeys(groupBy), ","); got != want {
+		t.Errorf("order keys = %s, want %s", got, want)
+	}
+}
+
+func TestMakeRollupSQL(t *testing.T) {
+	s := rollupSpecs[PROMETHEUS]
+	groupBy := s.groupByColumns(testPrometheusColumns)
+
+	mv := makeRollupMVTableCreateSQL(&s, groupBy, "prometheus", ROLLUP_TABLE_1H, ckdb.CKDBTypeClickhouse, ckdb.TimeFuncHour)
+	for _, want := range []string{
+		"prometheus.`samples.1h_mv` TO prometheus.`samples.1h_agg`",
+		"toStartOfHour(__raw_time) AS time",
+		"argMaxState(value, __raw_time) AS value__last",
+		"FROM (SELECT *, time AS __raw_time FROM prometheus.`samples_local`)",
+		"GROUP BY time,metric_id,target_id,team_id,app_label_value_id_1",
+	} {
+		if !strings.Contains(mv, want) {
+			t.Errorf("mv sql should contain %q:\n%s", want, mv)
+		}
+	}
+
+	local := makeRollupLocalCreateSQL(&s, groupBy, "prometheus", ROLLUP_TABLE_1H, ckdb.CKDBTypeClickhouse, aggrStrings[AVG], false)
+	if !strings.Contains(local, "finalizeAggregation(value__sum) / finalizeAggregation(value__count) AS value") {
+		t.Errorf("local view should use avg for value:\n%s", local)
+	}
+	local = makeRollupLocalCreateSQL(&s, groupBy, "prometheus", ROLLUP_TABLE_1D, ckdb.CKDBTypeClickhouse, LAST, true)
+	if !strings.Contains(local, "CREATE OR REPLACE VIEW prometheus.`samples.1d_local`") ||
+		!strings.Contains(local, "finalizeAggregation(value__last) AS value,") {
+		t.Errorf("local view should be replaced and use last for value:\n%s", local)
+	}
+
+	ext := rollupSpecs[EXT_METRICS]
+	local = makeRollupLocalCreateSQL(&ext, nil, "ext_metrics", ROLLUP_TABLE_1H, ckdb.CKDBTypeClickhouse, aggrStrings[AVG], false)
+	for _, want := range []string{
+		"tupleElement(finalizeAggregation(metrics_float__sum), 1) AS metrics_float_names",
+		"arrayMap(x -> x / finalizeAggregation(metrics_float__count), tupleElement(finalizeAggregation(metrics_float__sum), 2)) AS metrics_float_values",
+	} {
+		if !strings.Contains(local, want) {
+			t.Errorf("ext_metrics local view should contain %q:\n%s", want, local)
+		}
+	}
+}
@@ -42,6 +42,21 @@ type Manager struct {
 	queues map[string]MonitorOperator
 }
 
+// options of the queues configured by 'ingester.queue-options', applied by the name of the queue
+var queueOptions = make(map[string][]queue.Option)
+
+// SetQueueOptions should be called before the queues are created
+func SetQueueOptions(name string, options ...queue.Option) {
+	queueOptions[name] = options
+}
+
+func withQueueOptions(name string, options []queue.Option) []queue.Option {
+	if extra, ok := queueOptions[name]; ok {
+		return append(append([]queue.Option{}, options...), extra...)
+	}
+	return options
+}
+
 const (
 	QUEUE_CMD_SHOW = iota
 	QUEUE_CMD_MONITOR_ON
@@ -109,29 +124,40 @@ func (m *Manager) RecvCommand(conn *net.UDPConn, remote *net.UDPAddr, operate ui
 }
 
 func (m *Manager) NewQueue(name string, size int, options ...queue.Option) *Queue {
-	q := &Queue{}
-	q.Init(name, size, nil, options...)
-	m.queues[name] = q
-	return q
+	return NewTypedQueueUnmarshal[interface{}](m, name, size, nil, options...)
 }
 
 func (m *Manager) NewQueues(name string, size, count, userCount int, options ...queue.Option) *MultiQueue {
-	q := &MultiQueue{}
-	q.Init(name, size, count, userCount, nil, options...)
-	m.queues[name] = q
-	return q
+	return NewTypedQueuesUnmarshal[interface{}](m, name, size, count, userCount, nil, options...)
 }
 
 func (m *Manager) NewQueueUnmarshal(name string, size int, unmarshaller Unmarshaller, options ...queue.Option) *Queue {
-	q := &Queue{}
-	q.Init(name, size, unmarshaller, options...)
+	return NewTypedQueueUnmarshal[interface{}](m, name, size, unmarshaller, options...)
+}
+
+func (m *Manager) NewQueuesUnmarshal(name string, size, count, userCount int, unmarshaller Unmarshaller, options ...queue.Option) *MultiQueue {
+	return NewTypedQueuesUnmarshal[interface{}](m, name, size, count, userCount, unmarshaller, options...)
+}
+
+// NewTypedQueue creates the queue of items of type T, methods of Manager can not have type parameters
+func NewTypedQueue[T any](m *Manager, name string, size int, options ...queue.Option) *TypedQueue[T] {
+	return NewTypedQueueUnmarshal[T](m, name, size, nil, options...)
+}
+
+func NewTypedQueues[T any](m *Manager, name string, size, count, userCount int, options ...queue.Option) *TypedMultiQueue[T] {
+	return NewTypedQueuesUnmarshal[T](m, name, size, count, userCount, nil, options...)
+}
+
+func NewTypedQueueUnmarshal[T any](m *Manager, name string, size int, unmarshaller Unmarshaller, options ...queue.Option) *TypedQueue[T] {
+	q := &TypedQueue[T]{}
+	q.Init(name, size, unmarshaller, withQueueOptions(name, options)...)
 	m.queues[name] = q
 	return q
 }
 
-func (m *Manager) NewQueuesUnmarshal(name string, size, count, userCount int, unmarshaller Unmarshaller, options ...queue.Option) *MultiQueue {
-	q := &MultiQueue{}
-	q.Init(name, size, count, userCount, unmarshaller, options...)
+func NewTypedQueuesUnmarshal[T any](m *Manager, name string, size, count, userCount int, unmarshaller Unmarshaller, options ...queue.Option) *TypedMultiQueue[T] {
+	q := &TypedMultiQueue[T]{}
+	q.Init(name, size, count, userCount, unmarshaller, withQueueOptions(name, options)...)
 	m.queues[name] = q
 	return q
 }
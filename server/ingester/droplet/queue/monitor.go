@@ -21,6 +21,7 @@ import (
 	"encoding/gob"
 	"fmt"
 	"net"
+	"reflect"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/libs/debug"
@@ -153,6 +154,20 @@ func (m *Monitor) send(items []interface{}) {
 	}
 }
 
+// sendToMonitor converts the items to interface{} only when the monitor is on, the flush indicators are skipped
+func sendToMonitor[T any](m *Monitor, items []T) {
+	if !m.isDebugOn() || len(items) == 0 {
+		return
+	}
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if v := reflect.ValueOf(item); v.IsValid() && (v.Kind() != reflect.Pointer || !v.IsNil()) {
+			values = append(values, item)
+		}
+	}
+	m.send(values)
+}
+
 func (m *Monitor) init(name string, unmarshaller Unmarshaller) {
 	m.Name = name
 	m.unmarshaller = unmarshaller
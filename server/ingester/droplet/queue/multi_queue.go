@@ -23,29 +23,32 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
-type MultiQueue struct {
-	queue.FixedMultiQueue
+// TypedMultiQueue is the hashed queues of items of type T which can be monitored by ingesterctl
+type TypedMultiQueue[T any] struct {
+	queue.TypedMultiQueue[T]
 	*Monitor
 
-	readers []queue.QueueReader
-	writers []queue.QueueWriter
+	readers []queue.TypedQueueReader[T]
+	writers []queue.TypedQueueWriter[T]
 
-	itemBatches [][][]interface{}
+	itemBatches [][][]T
 }
 
-func (q *MultiQueue) Init(name string, size, count, userCount int, unmarshaller Unmarshaller, options ...queue.Option) {
+type MultiQueue = TypedMultiQueue[interface{}]
+
+func (q *TypedMultiQueue[T]) Init(name string, size, count, userCount int, unmarshaller Unmarshaller, options ...queue.Option) {
 	q.Monitor = &Monitor{}
 	q.Monitor.init(name, unmarshaller)
 	options = append(options, common.QUEUE_STATS_MODULE_INGESTER)
-	q.FixedMultiQueue = queue.NewOverwriteQueues(name, uint8(count), size, options...)
+	q.TypedMultiQueue = queue.NewTypedOverwriteQueues[T](name, uint8(count), size, options...)
 
-	q.readers = make([]queue.QueueReader, len(q.FixedMultiQueue))
-	for i := 0; i < len(q.FixedMultiQueue); i++ {
-		q.readers[i] = &Queue{q.FixedMultiQueue[i], q.Monitor}
+	q.readers = make([]queue.TypedQueueReader[T], len(q.TypedMultiQueue))
+	for i := 0; i < len(q.TypedMultiQueue); i++ {
+		q.readers[i] = &TypedQueue[T]{q.TypedMultiQueue[i], q.Monitor}
 	}
-	q.writers = make([]queue.QueueWriter, len(q.FixedMultiQueue))
-	for i := 0; i < len(q.FixedMultiQueue); i++ {
-		q.writers[i] = &Queue{q.FixedMultiQueue[i], q.Monitor}
+	q.writers = make([]queue.TypedQueueWriter[T], len(q.TypedMultiQueue))
+	for i := 0; i < len(q.TypedMultiQueue); i++ {
+		q.writers[i] = &TypedQueue[T]{q.TypedMultiQueue[i], q.Monitor}
 	}
 
 	if count > 1 {
@@ -53,49 +56,49 @@ func (q *MultiQueue) Init(name string, size, count, userCount int, unmarshaller
 		if batchSize > 1024 {
 			batchSize = 1024
 		}
-		q.itemBatches = make([][][]interface{}, userCount)
+		q.itemBatches = make([][][]T, userCount)
 		for userId, _ := range q.itemBatches {
-			q.itemBatches[userId] = make([][]interface{}, count)
+			q.itemBatches[userId] = make([][]T, count)
 			for queueId, _ := range q.itemBatches[userId] {
-				q.itemBatches[userId][queueId] = make([]interface{}, 0, batchSize)
+				q.itemBatches[userId][queueId] = make([]T, 0, batchSize)
 			}
 		}
 	}
 }
 
-func (q *MultiQueue) Readers() []queue.QueueReader {
+func (q *TypedMultiQueue[T]) Readers() []queue.TypedQueueReader[T] {
 	return q.readers
 }
 
-func (q *MultiQueue) Writers() []queue.QueueWriter {
+func (q *TypedMultiQueue[T]) Writers() []queue.TypedQueueWriter[T] {
 	return q.writers
 }
 
-func (q *MultiQueue) Get(key queue.HashKey) interface{} {
-	return q.FixedMultiQueue.Get(key)
+func (q *TypedMultiQueue[T]) Get(key queue.HashKey) T {
+	return q.TypedMultiQueue.Get(key)
 }
 
-func (q *MultiQueue) Gets(key queue.HashKey, output []interface{}) int {
-	return q.FixedMultiQueue.Gets(key, output)
+func (q *TypedMultiQueue[T]) Gets(key queue.HashKey, output []T) int {
+	return q.TypedMultiQueue.Gets(key, output)
 }
 
-func (q *MultiQueue) Put(key queue.HashKey, items ...interface{}) error {
-	q.Monitor.send(items)
-	return q.FixedMultiQueue.Put(key, items...)
+func (q *TypedMultiQueue[T]) Put(key queue.HashKey, items ...T) error {
+	sendToMonitor(q.Monitor, items)
+	return q.TypedMultiQueue.Put(key, items...)
 }
 
 // The userId key must be placed in keys[0] (with item keys)
-func (q *MultiQueue) Puts(keys []queue.HashKey, items []interface{}) error {
+func (q *TypedMultiQueue[T]) Puts(keys []queue.HashKey, items []T) error {
 	if len(keys) <= 1 || len(keys)-1 != len(items) {
 		return errors.New("Requested keys and items are invalid")
 	}
 	userId := keys[0]
 	keys = keys[1:]
 
-	q.Monitor.send(items)
+	sendToMonitor(q.Monitor, items)
 	userCount := uint8(len(q.itemBatches))
 	if userCount == 0 {
-		return q.FixedMultiQueue.Put(keys[0], items...)
+		return q.TypedMultiQueue.Put(keys[0], items...)
 	}
 
 	itemBatches := q.itemBatches[userId%userCount]
@@ -105,7 +108,7 @@ func (q *MultiQueue) Puts(keys []queue.HashKey, items []interface{}) error {
 		itemBatches[index] = append(itemBatches[index], item)
 		itemBatch := itemBatches[index]
 		if len(itemBatch) == cap(itemBatch) {
-			err := q.FixedMultiQueue.Put(queue.HashKey(index), itemBatch...)
+			err := q.TypedMultiQueue.Put(queue.HashKey(index), itemBatch...)
 			itemBatches[index] = itemBatch[:0]
 			if err != nil {
 				return err
@@ -114,7 +117,7 @@ func (q *MultiQueue) Puts(keys []queue.HashKey, items []interface{}) error {
 	}
 	for index, itemBatch := range itemBatches {
 		if len(itemBatch) > 0 {
-			err := q.FixedMultiQueue.Put(queue.HashKey(index), itemBatch...)
+			err := q.TypedMultiQueue.Put(queue.HashKey(index), itemBatch...)
 			itemBatches[index] = itemBatch[:0]
 			if err != nil {
 				return err
@@ -124,6 +127,6 @@ func (q *MultiQueue) Puts(keys []queue.HashKey, items []interface{}) error {
 	return nil
 }
 
-func (q *MultiQueue) Len(key queue.HashKey) int {
-	return q.FixedMultiQueue.Len(key)
+func (q *TypedMultiQueue[T]) Len(key queue.HashKey) int {
+	return q.TypedMultiQueue.Len(key)
 }
@@ -21,32 +21,35 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
-type Queue struct {
-	*queue.OverwriteQueue
+// TypedQueue is the queue of items of type T which can be monitored by ingesterctl
+type TypedQueue[T any] struct {
+	*queue.TypedOverwriteQueue[T]
 	*Monitor
 }
 
-func (q *Queue) Init(name string, size int, unmarshaller Unmarshaller, options ...queue.Option) {
+type Queue = TypedQueue[interface{}]
+
+func (q *TypedQueue[T]) Init(name string, size int, unmarshaller Unmarshaller, options ...queue.Option) {
 	q.Monitor = &Monitor{}
 	q.Monitor.init(name, unmarshaller)
-	q.OverwriteQueue = &queue.OverwriteQueue{}
+	q.TypedOverwriteQueue = &queue.TypedOverwriteQueue[T]{}
 	options = append(options, common.QUEUE_STATS_MODULE_INGESTER)
-	q.OverwriteQueue.Init(name, size, options...)
+	q.TypedOverwriteQueue.Init(name, size, options...)
 }
 
-func (q *Queue) Get() interface{} {
-	return q.OverwriteQueue.Get()
+func (q *TypedQueue[T]) Get() T {
+	return q.TypedOverwriteQueue.Get()
 }
 
-func (q *Queue) Gets(output []interface{}) int {
-	return q.OverwriteQueue.Gets(output)
+func (q *TypedQueue[T]) Gets(output []T) int {
+	return q.TypedOverwriteQueue.Gets(output)
 }
 
-func (q *Queue) Put(items ...interface{}) error {
-	q.Monitor.send(items)
-	return q.OverwriteQueue.Put(items...)
+func (q *TypedQueue[T]) Put(items ...T) error {
+	sendToMonitor(q.Monitor, items)
+	return q.TypedOverwriteQueue.Put(items...)
 }
 
-func (q *Queue) Len() int {
-	return q.OverwriteQueue.Len()
+func (q *TypedQueue[T]) Len() int {
+	return q.TypedOverwriteQueue.Len()
 }
@@ -37,3 +37,18 @@ func TestQueue(t *testing.T) {
 		t.Errorf("Gets expect 2 actual %v", n)
 	}
 }
+
+func TestTypedQueue(t *testing.T) {
+	m := NewManager(1)
+	q := NewTypedQueues[*int](m, "typed", 1024, 2, 1)
+	one, two := 1, 2
+	q.Put(0, &one, nil)
+	q.Put(1, &two)
+	buffer := make([]*int, 10)
+	if n := q.Readers()[0].Gets(buffer); n != 2 || *buffer[0] != 1 || buffer[1] != nil {
+		t.Errorf("Gets expect [1 nil] actual %v", buffer[:n])
+	}
+	if item := q.Get(1); *item != 2 {
+		t.Errorf("Get expect 2 actual %v", *item)
+	}
+}
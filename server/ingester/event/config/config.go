@@ -17,6 +17,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/deepflowio/deepflow/server/ingester/config"
@@ -36,8 +37,74 @@ const (
 	DefaultFileEventTTL               = 168 // hour
 	DefaultAlertEventTTL              = 720 // hour
 	DefaultAlertRecordTTL             = 720 // hour
+
+	DefaultAlertNotifierQueueSize      = 10000
+	DefaultAlertNotifierGroupWait      = 30   // second
+	DefaultAlertNotifierRepeatInterval = 3600 // second
+	DefaultAlertNotifierHistorySize    = 1000
+	DefaultAlertNotifierMailServerURL  = "http://127.0.0.1:20417/v1/mail-server/"
+	DefaultAlertNotifierTimeout        = 10 // second
+	DefaultAlertNotifierSenderCount    = 4
+	DefaultAlertNotifierRetryInterval  = 10  // second
+	DefaultAlertNotifierMaxRetryWait   = 600 // second
+	DefaultAlertNotifierMaxRetries     = 10
+
+	AlertReceiverTypeSMTP         = "smtp"
+	AlertReceiverTypeWebhook      = "webhook"
+	AlertReceiverTypeAlertmanager = "alertmanager"
 )
 
+type AlertReceiverConfig struct {
+	Name string `yaml:"name"`
+	// smtp, webhook or alertmanager
+	Type    string            `yaml:"type"`
+	To      []string          `yaml:"to"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout int               `yaml:"timeout"`
+	// Go templates of the message, the fields of notifier.Notification can be used
+	SubjectTemplate string `yaml:"subject-template"`
+	BodyTemplate    string `yaml:"body-template"`
+}
+
+type AlertRouteConfig struct {
+	Match       map[string]string `yaml:"match"`
+	MatchRegex  map[string]string `yaml:"match-regex"`
+	EventLevels []int             `yaml:"event-levels"`
+	Receivers   []string          `yaml:"receivers"`
+	// continue matching the following routes after this route is matched
+	Continue bool `yaml:"continue"`
+}
+
+type AlertSilenceConfig struct {
+	Match      map[string]string `yaml:"match"`
+	MatchRegex map[string]string `yaml:"match-regex"`
+	// RFC3339 time, empty means no limit
+	StartsAt string `yaml:"starts-at"`
+	EndsAt   string `yaml:"ends-at"`
+	Comment  string `yaml:"comment"`
+}
+
+type AlertNotifierConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	QueueSize      int      `yaml:"queue-size"`
+	GroupWait      int      `yaml:"group-wait"`
+	RepeatInterval int      `yaml:"repeat-interval"`
+	GroupBy        []string `yaml:"group-by"`
+	MailServerURL  string   `yaml:"mail-server-url"`
+	MailFrom       string   `yaml:"mail-from"`
+	HistorySize    int      `yaml:"history-size"`
+	SenderCount    int      `yaml:"sender-count"`
+	// the failed notifications are retried after retry-interval, which doubles on each failure up to max-retry-wait
+	RetryInterval int `yaml:"retry-interval"`
+	MaxRetryWait  int `yaml:"max-retry-wait"`
+	// the notification is abandoned after max-retries failed retries, 0 means no limit
+	MaxRetries int                   `yaml:"max-retries"`
+	Receivers  []AlertReceiverConfig `yaml:"receivers"`
+	Routes     []AlertRouteConfig    `yaml:"routes"`
+	Silences   []AlertSilenceConfig  `yaml:"silences"`
+}
+
 type Config struct {
 	Base                       *config.Config
 	CKWriterConfig             config.CKWriterConfig `yaml:"event-ck-writer"`
@@ -53,6 +120,7 @@ type Config struct {
 	K8sCKWriterConfig          config.CKWriterConfig `yaml:"k8s-event-ck-writer"`
 	K8sDecoderQueueCount       int                   `yaml:"k8s-event-decoder-queue-count"`
 	K8sDecoderQueueSize        int                   `yaml:"k8s-event-decoder-queue-size"`
+	AlertNotifier              AlertNotifierConfig   `yaml:"alert-notifier"`
 }
 
 type EventConfig struct {
@@ -90,7 +158,77 @@ func (c *Config) Validate() error {
 	if c.K8sDecoderQueueSize == 0 {
 		c.K8sDecoderQueueSize = DefaultDecoderQueueSize
 	}
+	if err := c.AlertNotifier.Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
 
+func (c *AlertNotifierConfig) Validate() error {
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultAlertNotifierQueueSize
+	}
+	if c.GroupWait < 0 {
+		c.GroupWait = DefaultAlertNotifierGroupWait
+	}
+	if c.RepeatInterval < 0 {
+		c.RepeatInterval = DefaultAlertNotifierRepeatInterval
+	}
+	if c.HistorySize <= 0 {
+		c.HistorySize = DefaultAlertNotifierHistorySize
+	}
+	if c.MailServerURL == "" {
+		c.MailServerURL = DefaultAlertNotifierMailServerURL
+	}
+	if c.SenderCount <= 0 {
+		c.SenderCount = DefaultAlertNotifierSenderCount
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultAlertNotifierRetryInterval
+	}
+	if c.MaxRetryWait < c.RetryInterval {
+		c.MaxRetryWait = DefaultAlertNotifierMaxRetryWait
+		if c.MaxRetryWait < c.RetryInterval {
+			c.MaxRetryWait = c.RetryInterval
+		}
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = DefaultAlertNotifierMaxRetries
+	}
+	if !c.Enabled {
+		return nil
+	}
+	names := make(map[string]bool, len(c.Receivers))
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("alert-notifier receiver name '%s' is empty or duplicated", r.Name)
+		}
+		names[r.Name] = true
+		switch r.Type {
+		case AlertReceiverTypeSMTP:
+			if len(r.To) == 0 {
+				return fmt.Errorf("alert-notifier receiver %s: 'to' is required by smtp", r.Name)
+			}
+		case AlertReceiverTypeWebhook, AlertReceiverTypeAlertmanager:
+			if r.URL == "" {
+				return fmt.Errorf("alert-notifier receiver %s: 'url' is required by %s", r.Name, r.Type)
+			}
+		default:
+			return fmt.Errorf("alert-notifier receiver %s: invalid type '%s', support: smtp, webhook, alertmanager", r.Name, r.Type)
+		}
+		if r.Timeout <= 0 {
+			r.Timeout = DefaultAlertNotifierTimeout
+		}
+	}
+	for _, route := range c.Routes {
+		for _, name := range route.Receivers {
+			if !names[name] {
+				return fmt.Errorf("alert-notifier route refers to unknown receiver '%s'", name)
+			}
+		}
+	}
 	return nil
 }
 
@@ -112,6 +250,18 @@ func Load(base *config.Config, path string) *Config {
 			K8sCKWriterConfig:          config.CKWriterConfig{QueueCount: 1, QueueSize: 50000, BatchSize: 25600, FlushTimeout: 5},
 			K8sDecoderQueueCount:       DefaultDecoderQueueCount,
 			K8sDecoderQueueSize:        DefaultDecoderQueueSize,
+			AlertNotifier: AlertNotifierConfig{
+				QueueSize:      DefaultAlertNotifierQueueSize,
+				GroupWait:      DefaultAlertNotifierGroupWait,
+				RepeatInterval: DefaultAlertNotifierRepeatInterval,
+				GroupBy:        []string{"alert_policy"},
+				MailServerURL:  DefaultAlertNotifierMailServerURL,
+				HistorySize:    DefaultAlertNotifierHistorySize,
+				SenderCount:    DefaultAlertNotifierSenderCount,
+				RetryInterval:  DefaultAlertNotifierRetryInterval,
+				MaxRetryWait:   DefaultAlertNotifierMaxRetryWait,
+				MaxRetries:     DefaultAlertNotifierMaxRetries,
+			},
 		},
 	}
 	if _, err := os.Stat(path); os.IsNotExist(err) {
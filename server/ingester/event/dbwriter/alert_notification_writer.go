@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"github.com/ClickHouse/ch-go/proto"
+
+	basecommon "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/event/config"
+	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/pool"
+)
+
+const ALERT_NOTIFICATION_TABLE = "alert_notification"
+
+var alertNotificationPool = pool.NewLockFreePool(func() *AlertNotificationStore {
+	return &AlertNotificationStore{}
+})
+
+func AcquireAlertNotificationStore() *AlertNotificationStore {
+	return alertNotificationPool.Get()
+}
+
+func ReleaseAlertNotificationStore(s *AlertNotificationStore) {
+	if s == nil {
+		return
+	}
+	*s = AlertNotificationStore{}
+	alertNotificationPool.Put(s)
+}
+
+// AlertNotificationStore is the delivery status of a notification sent by the alert notifier,
+// each attempt of sending is a row
+type AlertNotificationStore struct {
+	Time         uint32
+	Receiver     string
+	ReceiverType string
+	GroupKey     string
+	Status       string
+	AlertCount   uint32
+	EventIds     []string
+	Attempt      uint16
+	// sent, retrying or abandoned
+	Result string
+	Error  string
+
+	OrgId uint16
+}
+
+func AlertNotificationColumns() []*ckdb.Column {
+	return []*ckdb.Column{
+		ckdb.NewColumn("time", ckdb.DateTime),
+		ckdb.NewColumn("receiver", ckdb.LowCardinalityString),
+		ckdb.NewColumn("receiver_type", ckdb.LowCardinalityString),
+		ckdb.NewColumn("group_key", ckdb.String),
+		ckdb.NewColumn("status", ckdb.LowCardinalityString),
+		ckdb.NewColumn("alert_count", ckdb.UInt32),
+		ckdb.NewColumn("event_ids", ckdb.ArrayString),
+		ckdb.NewColumn("attempt", ckdb.UInt16),
+		ckdb.NewColumn("result", ckdb.LowCardinalityString),
+		ckdb.NewColumn("error", ckdb.String),
+	}
+}
+
+type AlertNotificationBlock struct {
+	ColTime         proto.ColDateTime
+	ColReceiver     *proto.ColLowCardinality[string]
+	ColReceiverType *proto.ColLowCardinality[string]
+	ColGroupKey     proto.ColStr
+	ColStatus       *proto.ColLowCardinality[string]
+	ColAlertCount   proto.ColUInt32
+	ColEventIds     *proto.ColArr[string]
+	ColAttempt      proto.ColUInt16
+	ColResult       *proto.ColLowCardinality[string]
+	ColError        proto.ColStr
+}
+
+func (b *AlertNotificationBlock) Reset() {
+	b.ColTime.Reset()
+	b.ColReceiver.Reset()
+	b.ColReceiverType.Reset()
+	b.ColGroupKey.Reset()
+	b.ColStatus.Reset()
+	b.ColAlertCount.Reset()
+	b.ColEventIds.Reset()
+	b.ColAttempt.Reset()
+	b.ColResult.Reset()
+	b.ColError.Reset()
+}
+
+func (b *AlertNotificationBlock) ToInput(input proto.Input) proto.Input {
+	return append(input,
+		proto.InputColumn{Name: ckdb.COLUMN_TIME, Data: &b.ColTime},
+		proto.InputColumn{Name: "receiver", Data: b.ColReceiver},
+		proto.InputColumn{Name: "receiver_type", Data: b.ColReceiverType},
+		proto.InputColumn{Name: "group_key", Data: &b.ColGroupKey},
+		proto.InputColumn{Name: "status", Data: b.ColStatus},
+		proto.InputColumn{Name: "alert_count", Data: &b.ColAlertCount},
+		proto.InputColumn{Name: "event_ids", Data: b.ColEventIds},
+		proto.InputColumn{Name: "attempt", Data: &b.ColAttempt},
+		proto.InputColumn{Name: "result", Data: b.ColResult},
+		proto.InputColumn{Name: "error", Data: &b.ColError},
+	)
+}
+
+func (s *AlertNotificationStore) NewColumnBlock() ckdb.CKColumnBlock {
+	return &AlertNotificationBlock{
+		ColReceiver:     new(proto.ColStr).LowCardinality(),
+		ColReceiverType: new(proto.ColStr).LowCardinality(),
+		ColStatus:       new(proto.ColStr).LowCardinality(),
+		ColEventIds:     new(proto.ColStr).Array(),
+		ColResult:       new(proto.ColStr).LowCardinality(),
+	}
+}
+
+func (s *AlertNotificationStore) AppendToColumnBlock(b ckdb.CKColumnBlock) {
+	block := b.(*AlertNotificationBlock)
+	ckdb.AppendColDateTime(&block.ColTime, s.Time)
+	block.ColReceiver.Append(s.Receiver)
+	block.ColReceiverType.Append(s.ReceiverType)
+	block.ColGroupKey.Append(s.GroupKey)
+	block.ColStatus.Append(s.Status)
+	block.ColAlertCount.Append(s.AlertCount)
+	block.ColEventIds.Append(s.EventIds)
+	block.ColAttempt.Append(s.Attempt)
+	block.ColResult.Append(s.Result)
+	block.ColError.Append(s.Error)
+}
+
+func (s *AlertNotificationStore) Release() {
+	ReleaseAlertNotificationStore(s)
+}
+
+func (s *AlertNotificationStore) NativeTagVersion() uint32 {
+	return 0
+}
+
+func (s *AlertNotificationStore) OrgID() uint16 {
+	return s.OrgId
+}
+
+func GenAlertNotificationCKTable(cluster, storagePolicy, ckdbType string, ttl int, coldStorage *ckdb.ColdStorage) *ckdb.Table {
+	orderKeys := []string{"time", "receiver"}
+	return &ckdb.Table{
+		Version:         basecommon.CK_VERSION,
+		Database:        EVENT_DB,
+		DBType:          ckdbType,
+		LocalName:       ALERT_NOTIFICATION_TABLE + ckdb.LOCAL_SUBFFIX,
+		GlobalName:      ALERT_NOTIFICATION_TABLE,
+		Columns:         AlertNotificationColumns(),
+		TimeKey:         "time",
+		TTL:             ttl,
+		PartitionFunc:   DefaultAlertEventPartition,
+		Engine:          ckdb.MergeTree,
+		Cluster:         cluster,
+		StoragePolicy:   storagePolicy,
+		ColdStorage:     *coldStorage,
+		OrderKeys:       orderKeys,
+		PrimaryKeyCount: len(orderKeys),
+	}
+}
+
+// NewAlertNotificationWriter writes the delivery status of the alert notifications into event.alert_notification,
+// which is kept as long as event.alert_event
+func NewAlertNotificationWriter(config *config.Config) (*ckwriter.CKWriter, error) {
+	ckTable := GenAlertNotificationCKTable(config.Base.CKDB.ClusterName, config.Base.CKDB.StoragePolicy, config.Base.CKDB.Type, config.AlertEventTTL,
+		ckdb.GetColdStorage(config.Base.GetCKDBColdStorages(), EVENT_DB, ALERT_NOTIFICATION_TABLE))
+	writerConfig := config.CKWriterConfig
+	w, err := ckwriter.NewCKWriter(*config.Base.CKDB.ActualAddrs, config.Base.CKDBAuth.Username, config.Base.CKDBAuth.Password,
+		ALERT_NOTIFICATION_TABLE, config.Base.CKDB.TimeZone, ckTable, 1, writerConfig.QueueSize, writerConfig.BatchSize, writerConfig.FlushTimeout, config.Base.CKDB.Watcher)
+	if err != nil {
+		return nil, err
+	}
+	w.Run()
+	return w, nil
+}
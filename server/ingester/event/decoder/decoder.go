@@ -31,6 +31,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/event/common"
 	"github.com/deepflowio/deepflow/server/ingester/event/config"
 	"github.com/deepflowio/deepflow/server/ingester/event/dbwriter"
+	"github.com/deepflowio/deepflow/server/ingester/event/notifier"
 	"github.com/deepflowio/deepflow/server/ingester/exporters"
 	exporterscommon "github.com/deepflowio/deepflow/server/ingester/exporters/common"
 	"github.com/deepflowio/deepflow/server/libs/codec"
@@ -205,7 +206,8 @@ type Decoder struct {
 	index               int
 	eventType           common.EventType
 	platformData        *grpc.PlatformInfoTable
-	inQueue             queue.QueueReader
+	inQueue             queue.TypedQueueReader[*receiver.RecvBuffer]
+	resourceEventQueue  queue.TypedQueueReader[*eventapi.ResourceEvent]
 	eventWriter         *dbwriter.EventWriter
 	procEventWriters    *ProcEventWriters
 	fileAggReducer      *FileAggReducer
@@ -214,6 +216,7 @@ type Decoder struct {
 	debugEnabled        bool
 	config              *config.Config
 	aiAgentRootPidCache *AiAgentRootPidCache
+	alertNotifier       *notifier.Notifier
 
 	orgId, teamId uint16
 
@@ -232,7 +235,7 @@ type ProcEventWriters struct {
 func NewDecoder(
 	index int,
 	eventType common.EventType,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	eventWriter *dbwriter.EventWriter,
 	procEventWriters *ProcEventWriters,
 	platformData *grpc.PlatformInfoTable,
@@ -264,6 +267,23 @@ func NewDecoder(
 	}
 }
 
+// NewResourceEventDecoder decodes the resource events sent by the controller
+func NewResourceEventDecoder(
+	inQueue queue.TypedQueueReader[*eventapi.ResourceEvent],
+	eventWriter *dbwriter.EventWriter,
+	platformData *grpc.PlatformInfoTable,
+	config *config.Config,
+) *Decoder {
+	d := NewDecoder(0, common.RESOURCE_EVENT, nil, eventWriter, nil, platformData, nil, config, nil)
+	d.resourceEventQueue = inQueue
+	return d
+}
+
+// SetAlertNotifier sends the decoded alert events to the notifier as well
+func (d *Decoder) SetAlertNotifier(n *notifier.Notifier) {
+	d.alertNotifier = n
+}
+
 func (d *Decoder) GetCounter() interface{} {
 	var counter *Counter
 	counter, d.counter = d.counter, &Counter{}
@@ -274,7 +294,11 @@ func (d *Decoder) Run() {
 	log.Infof("event (%s) decoder run", d.eventType)
 	ingestercommon.RegisterCountableForIngester("decoder", d, stats.OptionStatTags{
 		"index": strconv.Itoa(d.index), "event_type": d.eventType.String()})
-	buffer := make([]interface{}, BUFFER_SIZE)
+	if d.eventType == common.RESOURCE_EVENT {
+		d.runResourceEvent()
+		return
+	}
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	decoder := &codec.SimpleDecoder{}
 	for {
 		n := d.inQueue.Gets(buffer)
@@ -288,48 +312,24 @@ func (d *Decoder) Run() {
 			}
 			d.counter.InCount++
 			switch d.eventType {
-			case common.RESOURCE_EVENT:
-				event, ok := buffer[i].(*eventapi.ResourceEvent)
-				if !ok {
-					log.Warning("get resoure event decode queue data type wrong")
-					continue
-				}
-				d.handleResourceEvent(event)
-				event.Release()
 			case common.FILE_EVENT:
-				recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-				if !ok {
-					log.Warning("get file event decode queue data type wrong")
-					continue
-				}
+				recvBytes := buffer[i]
 				decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 				d.orgId, d.teamId = uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
 				d.handleFileEvent(recvBytes.VtapID, decoder)
 				receiver.ReleaseRecvBuffer(recvBytes)
 			case common.ALERT_EVENT:
-				recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-				if !ok {
-					log.Warning("get alert event decode queue data type wrong")
-					continue
-				}
+				recvBytes := buffer[i]
 				decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 				d.handleAlertEvent(decoder)
 				receiver.ReleaseRecvBuffer(recvBytes)
 			case common.ALERT_RECORD:
-				recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-				if !ok {
-					log.Warning("get alert record decode queue data type wrong")
-					continue
-				}
+				recvBytes := buffer[i]
 				decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 				d.handleAlertRecord(decoder)
 				receiver.ReleaseRecvBuffer(recvBytes)
 			case common.K8S_EVENT:
-				recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-				if !ok {
-					log.Warning("get k8s event decode queue data type wrong")
-					continue
-				}
+				recvBytes := buffer[i]
 				decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 				d.orgId, d.teamId = uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
 				d.handleK8sEvent(recvBytes.VtapID, decoder)
@@ -339,6 +339,22 @@ func (d *Decoder) Run() {
 	}
 }
 
+func (d *Decoder) runResourceEvent() {
+	buffer := make([]*eventapi.ResourceEvent, BUFFER_SIZE)
+	for {
+		n := d.resourceEventQueue.Gets(buffer)
+		for i := 0; i < n; i++ {
+			if buffer[i] == nil {
+				d.export(nil)
+				continue
+			}
+			d.counter.InCount++
+			d.handleResourceEvent(buffer[i])
+			buffer[i].Release()
+		}
+	}
+}
+
 func routeProcEventType(e *pb.ProcEvent) common.EventType {
 	if e == nil {
 		return common.FILE_EVENT
@@ -971,6 +987,10 @@ func (d *Decoder) writeAlertEvent(event *alert_event.AlertEvent) {
 	s.State = event.GetState()
 	s.AlertTime = event.GetAlertTime()
 
+	// the store is released after written, so notify before writing
+	if d.alertNotifier != nil {
+		d.alertNotifier.Notify(notifier.NewAlert(s))
+	}
 	d.eventWriter.WriteAlertEvent(s)
 }
 
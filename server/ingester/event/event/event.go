@@ -29,9 +29,11 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/event/config"
 	"github.com/deepflowio/deepflow/server/ingester/event/dbwriter"
 	"github.com/deepflowio/deepflow/server/ingester/event/decoder"
+	"github.com/deepflowio/deepflow/server/ingester/event/notifier"
 	"github.com/deepflowio/deepflow/server/ingester/exporters"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
+	"github.com/deepflowio/deepflow/server/libs/eventapi"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
@@ -52,9 +54,10 @@ type Eventor struct {
 	Decoders      []*decoder.Decoder
 	PlatformDatas []*grpc.PlatformInfoTable
 	RootPidCache  *decoder.AiAgentRootPidCache
+	Notifier      *notifier.Notifier
 }
 
-func NewEvent(config *config.Config, resourceEventQueue *queue.OverwriteQueue, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*Event, error) {
+func NewEvent(config *config.Config, resourceEventQueue *queue.TypedOverwriteQueue[*eventapi.ResourceEvent], recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*Event, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_EVENT_QUEUE)
 	resourceEventor, err := NewResouceEventor(resourceEventQueue, config, platformDataManager.GetMasterPlatformInfoTable())
 	if err != nil {
@@ -91,22 +94,12 @@ func NewEvent(config *config.Config, resourceEventQueue *queue.OverwriteQueue, r
 	}, nil
 }
 
-func NewResouceEventor(eventQueue *queue.OverwriteQueue, config *config.Config, platformTable *grpc.PlatformInfoTable) (*Eventor, error) {
+func NewResouceEventor(eventQueue *queue.TypedOverwriteQueue[*eventapi.ResourceEvent], config *config.Config, platformTable *grpc.PlatformInfoTable) (*Eventor, error) {
 	eventWriter, err := dbwriter.NewEventWriter(common.RESOURCE_EVENT, 0, config)
 	if err != nil {
 		return nil, err
 	}
-	d := decoder.NewDecoder(
-		0,
-		common.RESOURCE_EVENT,
-		queue.QueueReader(eventQueue),
-		eventWriter,
-		nil,
-		platformTable,
-		nil,
-		config,
-		nil,
-	)
+	d := decoder.NewResourceEventDecoder(eventQueue, eventWriter, platformTable, config)
 	return &Eventor{
 		Config:   config,
 		Decoders: []*decoder.Decoder{d},
@@ -115,13 +108,14 @@ func NewResouceEventor(eventQueue *queue.OverwriteQueue, config *config.Config,
 
 func NewAlertEventor(config *config.Config, recv *receiver.Receiver, manager *dropletqueue.Manager, platformTable *grpc.PlatformInfoTable) (*Eventor, error) {
 	eventMsg := datatype.MESSAGE_TYPE_ALERT_EVENT
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+eventMsg.String(),
 		2<<17, // 128k, default alert event queue-size
 		1,     // default alert event queue-count
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(eventMsg, decodeQueues, 1)
 
 	eventWriter, err := dbwriter.NewAlertEventWriter(config)
@@ -131,7 +125,7 @@ func NewAlertEventor(config *config.Config, recv *receiver.Receiver, manager *dr
 	d := decoder.NewDecoder(
 		0,
 		common.ALERT_EVENT,
-		queue.QueueReader(decodeQueues.FixedMultiQueue[0]),
+		decodeQueues.TypedMultiQueue[0],
 		eventWriter,
 		nil,
 		platformTable,
@@ -139,21 +133,34 @@ func NewAlertEventor(config *config.Config, recv *receiver.Receiver, manager *dr
 		config,
 		nil,
 	)
+	var alertNotifier *notifier.Notifier
+	if config.AlertNotifier.Enabled {
+		deliveryWriter, err := dbwriter.NewAlertNotificationWriter(config)
+		if err != nil {
+			return nil, err
+		}
+		if alertNotifier, err = notifier.NewNotifier(&config.AlertNotifier, deliveryWriter); err != nil {
+			return nil, err
+		}
+		d.SetAlertNotifier(alertNotifier)
+	}
 	return &Eventor{
 		Config:   config,
 		Decoders: []*decoder.Decoder{d},
+		Notifier: alertNotifier,
 	}, nil
 }
 
 func NewAlertRecordEventor(config *config.Config, recv *receiver.Receiver, manager *dropletqueue.Manager, platformTable *grpc.PlatformInfoTable) (*Eventor, error) {
 	eventMsg := datatype.MESSAGE_TYPE_ALERT_RECORD
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+eventMsg.String(),
 		2<<17, // 128k, default alert record queue-size
 		1,     // default alert record queue-count
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(eventMsg, decodeQueues, 1)
 
 	eventWriter, err := dbwriter.NewAlertRecordWriter(config)
@@ -163,7 +170,7 @@ func NewAlertRecordEventor(config *config.Config, recv *receiver.Receiver, manag
 	d := decoder.NewDecoder(
 		0,
 		common.ALERT_RECORD,
-		queue.QueueReader(decodeQueues.FixedMultiQueue[0]),
+		decodeQueues.TypedMultiQueue[0],
 		eventWriter,
 		nil,
 		platformTable,
@@ -194,13 +201,14 @@ func NewEventor(eventType common.EventType, config *config.Config, recv *receive
 		return nil, fmt.Errorf("unsupport event %s", eventType)
 	}
 
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+eventType.String(),
 		queueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
 	decoders := make([]*decoder.Decoder, queueCount)
@@ -247,7 +255,7 @@ func NewEventor(eventType common.EventType, config *config.Config, recv *receive
 		decoders[i] = decoder.NewDecoder(
 			i,
 			eventType,
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			eventWriter,
 			procEventWriters,
 			platformDatas[i],
@@ -271,6 +279,9 @@ func (e *Eventor) Start() {
 	for _, platformData := range e.PlatformDatas {
 		platformData.Start()
 	}
+	if e.Notifier != nil {
+		e.Notifier.Start()
+	}
 }
 
 func (e *Eventor) Close() {
@@ -283,6 +294,9 @@ func (e *Eventor) Close() {
 	for _, platformData := range e.PlatformDatas {
 		platformData.ClosePlatformInfoTable()
 	}
+	if e.Notifier != nil {
+		e.Notifier.Close()
+	}
 }
 
 func (e *Event) Start() {
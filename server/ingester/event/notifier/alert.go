@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/event/dbwriter"
+)
+
+const (
+	LABEL_ALERT_POLICY = "alert_policy"
+	LABEL_POLICY_ID    = "policy_id"
+	LABEL_EVENT_LEVEL  = "event_level"
+	LABEL_STATE        = "state"
+	LABEL_METRIC_UNIT  = "metric_unit"
+	LABEL_ORG_ID       = "org_id"
+	LABEL_TEAM_ID      = "team_id"
+)
+
+// values of event.alert_event.event_level
+var eventLevelNames = []string{"", "critical", "error", "warning", "no_data", "recovered", "info"}
+
+func EventLevelName(level uint8) string {
+	if int(level) < len(eventLevelNames) && level > 0 {
+		return eventLevelNames[level]
+	}
+	return strconv.Itoa(int(level))
+}
+
+const (
+	STATE_ONGOING = 0
+	STATE_ENDED   = 1
+)
+
+func StateName(state uint32) string {
+	switch state {
+	case STATE_ONGOING:
+		return "ongoing"
+	case STATE_ENDED:
+		return "ended"
+	default:
+		return strconv.Itoa(int(state))
+	}
+}
+
+// Alert is a copy of an AlertEventStore, the store is released to the pool once written
+type Alert struct {
+	Fingerprint      string            `json:"fingerprint"`
+	EventId          string            `json:"event_id"`
+	PolicyId         uint32            `json:"policy_id"`
+	AlertPolicy      string            `json:"alert_policy"`
+	EventLevel       uint8             `json:"event_level"`
+	State            uint32            `json:"state"`
+	MetricValue      float64           `json:"metric_value"`
+	MetricValueStr   string            `json:"metric_value_str"`
+	MetricUnit       string            `json:"metric_unit"`
+	TriggerThreshold string            `json:"trigger_threshold"`
+	TargetTags       string            `json:"target_tags"`
+	OrgId            uint16            `json:"org_id"`
+	TeamId           uint16            `json:"team_id"`
+	Time             time.Time         `json:"time"`
+	StartTime        time.Time         `json:"start_time"`
+	EndTime          time.Time         `json:"end_time"`
+	Labels           map[string]string `json:"labels"`
+}
+
+func NewAlert(s *dbwriter.AlertEventStore) *Alert {
+	a := &Alert{
+		EventId:          s.EventId,
+		PolicyId:         s.PolicyId,
+		AlertPolicy:      s.AlertPolicy,
+		EventLevel:       s.EventLevel,
+		State:            s.State,
+		MetricValue:      s.MetricValue,
+		MetricValueStr:   s.MetricValueStr,
+		MetricUnit:       s.MetricUnit,
+		TriggerThreshold: s.TriggerThreshold,
+		TargetTags:       s.TargetTags,
+		OrgId:            s.OrgId,
+		TeamId:           s.TeamID,
+		Time:             time.Unix(int64(s.Time), 0),
+		Labels:           make(map[string]string, len(s.TagStrKeys)+len(s.TagIntKeys)+len(s.CustomTagKeys)+7),
+	}
+	if s.StartTime > 0 {
+		a.StartTime = time.Unix(int64(s.StartTime), 0)
+	} else {
+		a.StartTime = a.Time
+	}
+	if s.EndTime > 0 {
+		a.EndTime = time.Unix(int64(s.EndTime), 0)
+	}
+	for i, k := range s.TagStrKeys {
+		if i < len(s.TagStrValues) {
+			a.Labels[k] = s.TagStrValues[i]
+		}
+	}
+	for i, k := range s.TagIntKeys {
+		if i < len(s.TagIntValues) {
+			a.Labels[k] = strconv.FormatInt(s.TagIntValues[i], 10)
+		}
+	}
+	for i, k := range s.CustomTagKeys {
+		if i < len(s.CustomTagValues) {
+			a.Labels[k] = s.CustomTagValues[i]
+		}
+	}
+	a.FillLabels()
+	return a
+}
+
+// FillLabels sets the builtin labels and the fingerprint
+func (a *Alert) FillLabels() {
+	if a.Labels == nil {
+		a.Labels = make(map[string]string, 7)
+	}
+	a.Labels[LABEL_ALERT_POLICY] = a.AlertPolicy
+	a.Labels[LABEL_POLICY_ID] = strconv.Itoa(int(a.PolicyId))
+	a.Labels[LABEL_EVENT_LEVEL] = EventLevelName(a.EventLevel)
+	a.Labels[LABEL_STATE] = StateName(a.State)
+	a.Labels[LABEL_METRIC_UNIT] = a.MetricUnit
+	a.Labels[LABEL_ORG_ID] = strconv.Itoa(int(a.OrgId))
+	a.Labels[LABEL_TEAM_ID] = strconv.Itoa(int(a.TeamId))
+	if a.EventId != "" {
+		a.Fingerprint = a.EventId
+	} else {
+		// the state and level change during the lifetime of an alert, exclude them
+		a.Fingerprint = labelsHash(a.Labels, LABEL_STATE, LABEL_EVENT_LEVEL)
+	}
+}
+
+func (a *Alert) Resolved() bool {
+	return a.State == STATE_ENDED
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("%s[%s] %s=%s", a.AlertPolicy, EventLevelName(a.EventLevel), a.Fingerprint, StateName(a.State))
+}
+
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func labelsHash(labels map[string]string, excludes ...string) string {
+	h := fnv.New64a()
+	for _, k := range sortedKeys(labels) {
+		excluded := false
+		for _, e := range excludes {
+			if k == e {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(labels[k]))
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// the group key is made up of the receiver, the org and the values of the group-by labels,
+// the alerts of different orgs are never merged into one notification
+func groupKey(receiver string, orgId uint16, groupBy []string, labels map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString(receiver)
+	sb.WriteByte('/')
+	sb.WriteString(strconv.Itoa(int(orgId)))
+	for _, k := range groupBy {
+		sb.WriteByte(',')
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+	}
+	return sb.String()
+}
@@ -0,0 +1,573 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	ingestercommon "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/event/config"
+	"github.com/deepflowio/deepflow/server/ingester/event/dbwriter"
+	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/debug"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("event.notifier")
+
+const (
+	FLUSH_INTERVAL       = time.Second
+	DEFAULT_HISTORY_SHOW = 20
+
+	RESULT_SENT      = "sent"
+	RESULT_RETRYING  = "retrying"
+	RESULT_ABANDONED = "abandoned"
+)
+
+type Counter struct {
+	InCount       int64 `statsd:"in-count"`
+	DropCount     int64 `statsd:"drop-count"`
+	UnroutedCount int64 `statsd:"unrouted-count"`
+	SilencedCount int64 `statsd:"silenced-count"`
+	DedupCount    int64 `statsd:"dedup-count"`
+	SentCount     int64 `statsd:"sent-count"`
+	// every failed attempt is counted, the notification is retried until it is abandoned
+	FailedCount    int64 `statsd:"failed-count"`
+	AbandonedCount int64 `statsd:"abandoned-count"`
+}
+
+// DeliveryRecord is the result of sending a notification to a receiver
+type DeliveryRecord struct {
+	Time     time.Time
+	OrgId    uint16
+	Receiver string
+	Type     string
+	GroupKey string
+	Status   string
+	Alerts   int
+	Attempt  int
+	Result   string
+	Error    string
+}
+
+func (r *DeliveryRecord) String() string {
+	result := r.Result
+	if r.Error != "" {
+		result += ": " + r.Error
+	}
+	return fmt.Sprintf("%s %s(%s) org=%d group=%s status=%s alerts=%d attempt=%d %s",
+		r.Time.Format(time.RFC3339), r.Receiver, r.Type, r.OrgId, r.GroupKey, r.Status, r.Alerts, r.Attempt, result)
+}
+
+// DeliveryWriter persists the delivery records, it is the ckwriter of event.alert_notification
+type DeliveryWriter interface {
+	Put(items ...interface{})
+	Close()
+}
+
+type group struct {
+	key      string
+	orgId    uint16
+	receiver Receiver
+	labels   map[string]string
+	alerts   []*Alert
+	flushAt  time.Time
+	// the failed attempts of sending
+	attempts int
+}
+
+// add replaces the pending alert with the same fingerprint, only the latest state is notified
+func (g *group) add(a *Alert) {
+	for i, pending := range g.alerts {
+		if pending.Fingerprint == a.Fingerprint {
+			g.alerts[i] = a
+			return
+		}
+	}
+	g.alerts = append(g.alerts, a)
+}
+
+// merge adds the alerts of a failed or postponed group, the pending alerts are newer and kept
+func (g *group) merge(other *group) {
+	for _, a := range other.alerts {
+		found := false
+		for _, pending := range g.alerts {
+			if pending.Fingerprint == a.Fingerprint {
+				found = true
+				break
+			}
+		}
+		if !found {
+			g.alerts = append(g.alerts, a)
+		}
+	}
+	if other.attempts > g.attempts {
+		g.attempts = other.attempts
+	}
+	if other.flushAt.After(g.flushAt) {
+		g.flushAt = other.flushAt
+	}
+}
+
+type notifiedState struct {
+	eventLevel uint8
+	state      uint32
+	time       time.Time
+	// the alert is being sent, the same alert is not grouped again until it is sent or abandoned
+	inFlight bool
+}
+
+// Notifier routes the written alert events to the receivers, the alerts of the same
+// receiver, org and group-by labels are merged into one notification after group-wait,
+// and an unchanged alert is notified again only after repeat-interval. The notifications
+// are sent by the senders, the failed ones are retried with backoff.
+type Notifier struct {
+	config    *config.AlertNotifierConfig
+	receivers map[string]Receiver
+	routes    []*route
+	silences  []*silence
+	writer    DeliveryWriter
+
+	inQueue   chan *Alert
+	sendQueue chan *group
+
+	// protects groups and notified, which are accessed by run() and the senders
+	lock   sync.Mutex
+	groups map[string]*group
+	// key: receiver name + fingerprint
+	notified map[string]*notifiedState
+
+	historyLock  sync.Mutex
+	history      []DeliveryRecord
+	historyIndex int
+
+	counter *Counter
+	done    chan struct{}
+	wg      sync.WaitGroup
+	utils.Closable
+}
+
+// NewNotifier creates the notifier, the delivery records are persisted by the writer if it is not nil
+func NewNotifier(cfg *config.AlertNotifierConfig, writer DeliveryWriter) (*Notifier, error) {
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	n.writer = writer
+	ingestercommon.RegisterCountableForIngester("alert_notifier", n, stats.OptionStatTags{})
+	debug.ServerRegisterSimple(ingesterctl.CMD_ALERT_NOTIFIER, n)
+	return n, nil
+}
+
+func newNotifier(cfg *config.AlertNotifierConfig) (*Notifier, error) {
+	n := &Notifier{
+		config:    cfg,
+		receivers: make(map[string]Receiver, len(cfg.Receivers)),
+		inQueue:   make(chan *Alert, cfg.QueueSize),
+		sendQueue: make(chan *group, cfg.SenderCount),
+		groups:    make(map[string]*group),
+		notified:  make(map[string]*notifiedState),
+		history:   make([]DeliveryRecord, 0, cfg.HistorySize),
+		counter:   &Counter{},
+		done:      make(chan struct{}),
+	}
+	mailServers := newMailServerCache(cfg.MailServerURL)
+	for i := range cfg.Receivers {
+		r, err := newReceiver(&cfg.Receivers[i], mailServers, cfg.MailFrom)
+		if err != nil {
+			return nil, err
+		}
+		n.receivers[r.Name()] = r
+	}
+	var err error
+	if n.routes, err = newRoutes(cfg.Routes); err != nil {
+		return nil, err
+	}
+	if n.silences, err = newSilences(cfg.Silences); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Notify never blocks the decoder, the alert is dropped if the queue is full
+func (n *Notifier) Notify(a *Alert) {
+	atomic.AddInt64(&n.counter.InCount, 1)
+	select {
+	case n.inQueue <- a:
+	default:
+		if atomic.AddInt64(&n.counter.DropCount, 1) == 1 {
+			log.Warningf("alert notifier queue is full, drop alert %s", a)
+		}
+	}
+}
+
+func (n *Notifier) Start() {
+	n.wg.Add(1 + n.config.SenderCount)
+	go n.run()
+	for i := 0; i < n.config.SenderCount; i++ {
+		go n.sender()
+	}
+	log.Infof("alert notifier started with %d receivers, %d routes and %d senders", len(n.receivers), len(n.routes), n.config.SenderCount)
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(FLUSH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case a := <-n.inQueue:
+			n.process(a, time.Now())
+		case now := <-ticker.C:
+			n.dispatch(n.flush(now))
+		case <-n.done:
+			// the queued alerts are grouped to be sent by Close after the senders exit
+			for len(n.inQueue) > 0 {
+				n.process(<-n.inQueue, time.Now())
+			}
+			close(n.sendQueue)
+			return
+		}
+	}
+}
+
+// dispatch hands the groups to the senders without blocking run(), the groups are
+// put back and sent by the next flush if all senders are busy
+func (n *Notifier) dispatch(groups []*group) {
+	for i, g := range groups {
+		select {
+		case n.sendQueue <- g:
+		default:
+			n.lock.Lock()
+			for _, g := range groups[i:] {
+				n.requeue(g)
+			}
+			n.lock.Unlock()
+			return
+		}
+	}
+}
+
+func (n *Notifier) sender() {
+	defer n.wg.Done()
+	for g := range n.sendQueue {
+		n.send(g, time.Now())
+	}
+}
+
+// requeue puts back the group, it is merged into the pending group of the same key. Called with lock held.
+func (n *Notifier) requeue(g *group) {
+	if pending, ok := n.groups[g.key]; ok {
+		pending.merge(g)
+		return
+	}
+	n.groups[g.key] = g
+}
+
+// retryWait returns the wait before the next attempt, it doubles on each failure up to max-retry-wait
+func (n *Notifier) retryWait(attempts int) time.Duration {
+	wait := time.Duration(n.config.RetryInterval) * time.Second
+	maxWait := time.Duration(n.config.MaxRetryWait) * time.Second
+	for i := 1; i < attempts && wait < maxWait; i++ {
+		wait *= 2
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait
+}
+
+func (n *Notifier) process(a *Alert, now time.Time) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	receivers := routeAlert(n.routes, a)
+	if len(receivers) == 0 {
+		atomic.AddInt64(&n.counter.UnroutedCount, 1)
+		return
+	}
+	if silenced(n.silences, a, now) {
+		atomic.AddInt64(&n.counter.SilencedCount, 1)
+		return
+	}
+	for _, name := range receivers {
+		if n.isDuplicate(name, a, now) {
+			atomic.AddInt64(&n.counter.DedupCount, 1)
+			continue
+		}
+		key := groupKey(name, a.OrgId, n.config.GroupBy, a.Labels)
+		g, ok := n.groups[key]
+		if !ok {
+			g = &group{
+				key:      key,
+				orgId:    a.OrgId,
+				receiver: n.receivers[name],
+				labels:   make(map[string]string, len(n.config.GroupBy)),
+				flushAt:  now.Add(time.Duration(n.config.GroupWait) * time.Second),
+			}
+			for _, k := range n.config.GroupBy {
+				g.labels[k] = a.Labels[k]
+			}
+			n.groups[key] = g
+		}
+		g.add(a)
+	}
+}
+
+func (n *Notifier) isDuplicate(receiver string, a *Alert, now time.Time) bool {
+	last, ok := n.notified[receiver+"/"+a.Fingerprint]
+	if !ok || last.state != a.State || last.eventLevel != a.EventLevel {
+		return false
+	}
+	if last.inFlight {
+		return true
+	}
+	// an ended alert is notified only once
+	if a.Resolved() {
+		return true
+	}
+	return now.Sub(last.time) < time.Duration(n.config.RepeatInterval)*time.Second
+}
+
+// flush removes and returns the groups whose group-wait or retry wait is expired to be sent,
+// all groups are returned if now is zero. The alerts of the groups are marked in flight, so
+// that they are deduplicated while being sent.
+func (n *Notifier) flush(now time.Time) []*group {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var groups []*group
+	for key, g := range n.groups {
+		if !now.IsZero() && now.Before(g.flushAt) {
+			continue
+		}
+		delete(n.groups, key)
+		groups = append(groups, g)
+		for _, a := range g.alerts {
+			n.notified[g.receiver.Name()+"/"+a.Fingerprint] = &notifiedState{eventLevel: a.EventLevel, state: a.State, time: now, inFlight: true}
+		}
+	}
+	if now.IsZero() {
+		return groups
+	}
+	expire := time.Duration(n.config.RepeatInterval) * time.Second
+	for key, s := range n.notified {
+		if s.inFlight {
+			continue
+		}
+		if now.Sub(s.time) >= expire && (s.state == STATE_ENDED || now.Sub(s.time) >= 2*expire) {
+			delete(n.notified, key)
+		}
+	}
+	return groups
+}
+
+// send sends the group to its receiver, a failed group is put back to be retried after
+// the retry wait until it fails more than max-retries times or the notifier is closed
+func (n *Notifier) send(g *group, now time.Time) {
+	notification := newNotification(g.orgId, g.receiver.Name(), g.key, g.labels, g.alerts)
+	record := DeliveryRecord{
+		Time:     now,
+		OrgId:    g.orgId,
+		Receiver: g.receiver.Name(),
+		Type:     g.receiver.Type(),
+		GroupKey: g.key,
+		Status:   notification.Status,
+		Alerts:   len(g.alerts),
+		Attempt:  g.attempts + 1,
+		Result:   RESULT_SENT,
+	}
+	err := g.receiver.Send(notification)
+
+	n.lock.Lock()
+	if err == nil {
+		atomic.AddInt64(&n.counter.SentCount, 1)
+		for _, a := range g.alerts {
+			key := g.receiver.Name() + "/" + a.Fingerprint
+			// a newer state of the alert may be in flight
+			if last, ok := n.notified[key]; ok && (last.state != a.State || last.eventLevel != a.EventLevel) {
+				continue
+			}
+			n.notified[key] = &notifiedState{
+				eventLevel: a.EventLevel,
+				state:      a.State,
+				time:       now,
+			}
+		}
+	} else {
+		atomic.AddInt64(&n.counter.FailedCount, 1)
+		record.Error = err.Error()
+		g.attempts++
+		if n.Closed() || (n.config.MaxRetries > 0 && g.attempts > n.config.MaxRetries) {
+			atomic.AddInt64(&n.counter.AbandonedCount, 1)
+			record.Result = RESULT_ABANDONED
+			// the abandoned alerts are notified again if they are written again
+			for _, a := range g.alerts {
+				key := g.receiver.Name() + "/" + a.Fingerprint
+				if last, ok := n.notified[key]; ok && last.inFlight && last.state == a.State && last.eventLevel == a.EventLevel {
+					delete(n.notified, key)
+				}
+			}
+			log.Warningf("send alert notification to %s failed %d times, abandon %d alerts: %s", g.receiver.Name(), g.attempts, len(g.alerts), err)
+		} else {
+			record.Result = RESULT_RETRYING
+			wait := n.retryWait(g.attempts)
+			g.flushAt = now.Add(wait)
+			n.requeue(g)
+			log.Warningf("send alert notification to %s failed, retry in %s: %s", g.receiver.Name(), wait, err)
+		}
+	}
+	n.lock.Unlock()
+
+	n.addHistory(record)
+	n.writeRecord(&record, g.alerts)
+}
+
+func (n *Notifier) writeRecord(r *DeliveryRecord, alerts []*Alert) {
+	if n.writer == nil {
+		return
+	}
+	s := dbwriter.AcquireAlertNotificationStore()
+	s.Time = uint32(r.Time.Unix())
+	s.OrgId = r.OrgId
+	s.Receiver = r.Receiver
+	s.ReceiverType = r.Type
+	s.GroupKey = r.GroupKey
+	s.Status = r.Status
+	s.AlertCount = uint32(r.Alerts)
+	s.EventIds = make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		s.EventIds = append(s.EventIds, a.Fingerprint)
+	}
+	s.Attempt = uint16(r.Attempt)
+	s.Result = r.Result
+	s.Error = r.Error
+	n.writer.Put(s)
+}
+
+func (n *Notifier) addHistory(r DeliveryRecord) {
+	n.historyLock.Lock()
+	defer n.historyLock.Unlock()
+	if len(n.history) < cap(n.history) {
+		n.history = append(n.history, r)
+		return
+	}
+	n.history[n.historyIndex] = r
+	n.historyIndex = (n.historyIndex + 1) % len(n.history)
+}
+
+// History returns the latest delivery records, the newest first
+func (n *Notifier) History(count int) []DeliveryRecord {
+	n.historyLock.Lock()
+	defer n.historyLock.Unlock()
+	size := len(n.history)
+	if count <= 0 || count > size {
+		count = size
+	}
+	records := make([]DeliveryRecord, 0, count)
+	// historyIndex points to the oldest record once the ring is full
+	for i := 1; i <= count; i++ {
+		records = append(records, n.history[(n.historyIndex-i+size)%size])
+	}
+	return records
+}
+
+func (n *Notifier) loadCounter(reset bool) *Counter {
+	load := func(v *int64) int64 {
+		if reset {
+			return atomic.SwapInt64(v, 0)
+		}
+		return atomic.LoadInt64(v)
+	}
+	return &Counter{
+		InCount:        load(&n.counter.InCount),
+		DropCount:      load(&n.counter.DropCount),
+		UnroutedCount:  load(&n.counter.UnroutedCount),
+		SilencedCount:  load(&n.counter.SilencedCount),
+		DedupCount:     load(&n.counter.DedupCount),
+		SentCount:      load(&n.counter.SentCount),
+		FailedCount:    load(&n.counter.FailedCount),
+		AbandonedCount: load(&n.counter.AbandonedCount),
+	}
+}
+
+func (n *Notifier) GetCounter() interface{} {
+	return n.loadCounter(true)
+}
+
+const (
+	CMD_ALERT_NOTIFIER_STATUS uint16 = iota
+	CMD_ALERT_NOTIFIER_HISTORY
+)
+
+func (n *Notifier) HandleSimpleCommand(operate uint16, arg string) string {
+	switch operate {
+	case CMD_ALERT_NOTIFIER_STATUS:
+		return fmt.Sprintf("receivers: %d, routes: %d, silences: %d, queue: %d/%d, counter: %+v",
+			len(n.receivers), len(n.routes), len(n.silences), len(n.inQueue), cap(n.inQueue), *n.loadCounter(false))
+	case CMD_ALERT_NOTIFIER_HISTORY:
+		count, err := strconv.Atoi(arg)
+		if err != nil || count <= 0 {
+			count = DEFAULT_HISTORY_SHOW
+		}
+		var sb strings.Builder
+		for _, r := range n.History(count) {
+			sb.WriteString(r.String())
+			sb.WriteByte('\n')
+		}
+		return sb.String()
+	}
+	return "unknown command"
+}
+
+// Close waits for the senders to finish the notifications in flight, then sends the pending and retrying
+// notifications once, the failed ones are abandoned and recorded.
+func (n *Notifier) Close() {
+	if n.Closed() {
+		return
+	}
+	n.Closable.Close()
+	close(n.done)
+	n.wg.Wait()
+
+	groups := n.flush(time.Time{})
+	queue := make(chan *group, len(groups))
+	for _, g := range groups {
+		queue <- g
+	}
+	close(queue)
+	var wg sync.WaitGroup
+	wg.Add(n.config.SenderCount)
+	for i := 0; i < n.config.SenderCount; i++ {
+		go func() {
+			defer wg.Done()
+			for g := range queue {
+				n.send(g, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+	if n.writer != nil {
+		n.writer.Close()
+	}
+}
@@ -0,0 +1,479 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/event/config"
+	"github.com/deepflowio/deepflow/server/ingester/event/dbwriter"
+)
+
+func newTestAlert(policy, eventId string, level uint8, state uint32, labels map[string]string) *Alert {
+	a := &Alert{
+		EventId:     eventId,
+		PolicyId:    1,
+		AlertPolicy: policy,
+		EventLevel:  level,
+		State:       state,
+		MetricValue: 99,
+		Time:        time.Unix(1700000000, 0),
+		StartTime:   time.Unix(1700000000, 0),
+		Labels:      labels,
+	}
+	a.FillLabels()
+	return a
+}
+
+func TestRouteAndSilence(t *testing.T) {
+	routes, err := newRoutes([]config.AlertRouteConfig{
+		{Match: map[string]string{"pod_ns": "prod"}, EventLevels: []int{1, 2}, Receivers: []string{"oncall"}, Continue: true},
+		{MatchRegex: map[string]string{"alert_policy": "cpu.*"}, Receivers: []string{"ops", "oncall"}},
+		{Receivers: []string{"default"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		alert *Alert
+		want  []string
+	}{
+		{newTestAlert("cpu_usage", "1", 1, 0, map[string]string{"pod_ns": "prod"}), []string{"oncall", "ops"}},
+		{newTestAlert("cpu_usage", "2", 3, 0, map[string]string{"pod_ns": "prod"}), []string{"ops", "oncall"}},
+		{newTestAlert("mem_usage", "3", 1, 0, map[string]string{"pod_ns": "prod"}), []string{"oncall", "default"}},
+		{newTestAlert("xcpu_usage", "4", 3, 0, nil), []string{"default"}},
+	}
+	for i, c := range cases {
+		if got := routeAlert(routes, c.alert); strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("case %d: routes %v, want %v", i, got, c.want)
+		}
+	}
+
+	silences, err := newSilences([]config.AlertSilenceConfig{
+		{Match: map[string]string{"pod_ns": "test"}},
+		{MatchRegex: map[string]string{"alert_policy": "mem.*"}, StartsAt: "2023-11-14T00:00:00Z", EndsAt: "2023-11-15T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 11, 14, 12, 0, 0, 0, time.UTC)
+	if !silenced(silences, newTestAlert("cpu", "1", 1, 0, map[string]string{"pod_ns": "test"}), now) {
+		t.Error("alert of pod_ns=test should be silenced")
+	}
+	if !silenced(silences, newTestAlert("mem_usage", "1", 1, 0, nil), now) {
+		t.Error("alert of mem_usage should be silenced in the time range")
+	}
+	if silenced(silences, newTestAlert("mem_usage", "1", 1, 0, nil), now.Add(24*time.Hour)) {
+		t.Error("alert of mem_usage should not be silenced after the silence ends")
+	}
+	if _, err := newSilences([]config.AlertSilenceConfig{{Comment: "all"}}); err == nil {
+		t.Error("silence without matchers should be rejected")
+	}
+}
+
+type webhookStandIn struct {
+	sync.Mutex
+	bodies [][]byte
+	server *httptest.Server
+}
+
+func newWebhookStandIn() *webhookStandIn {
+	w := &webhookStandIn{}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Lock()
+		w.bodies = append(w.bodies, body)
+		w.Unlock()
+		if r.Header.Get("X-Fail") != "" {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	return w
+}
+
+func (w *webhookStandIn) received() [][]byte {
+	w.Lock()
+	defer w.Unlock()
+	return w.bodies
+}
+
+func newTestNotifier(t *testing.T, cfg *config.AlertNotifierConfig) *Notifier {
+	cfg.Enabled = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := newNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// flushAndSend sends the expired groups in the caller like the senders
+func flushAndSend(n *Notifier, now time.Time) {
+	for _, g := range n.flush(now) {
+		n.send(g, now)
+	}
+}
+
+type deliveryStandIn struct {
+	records []*dbwriter.AlertNotificationStore
+}
+
+func (w *deliveryStandIn) Put(items ...interface{}) {
+	for _, item := range items {
+		w.records = append(w.records, item.(*dbwriter.AlertNotificationStore))
+	}
+}
+
+func (w *deliveryStandIn) Close() {}
+
+func TestGroupAndDedup(t *testing.T) {
+	hook := newWebhookStandIn()
+	defer hook.server.Close()
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		GroupWait:      30,
+		RepeatInterval: 3600,
+		GroupBy:        []string{"alert_policy"},
+		Receivers:      []config.AlertReceiverConfig{{Name: "hook", Type: "webhook", URL: hook.server.URL}},
+		Routes:         []config.AlertRouteConfig{{Receivers: []string{"hook"}}},
+		Silences:       []config.AlertSilenceConfig{{Match: map[string]string{"host": "silenced"}}},
+	})
+
+	now := time.Unix(1700000000, 0)
+	n.process(newTestAlert("cpu", "1", 1, 0, map[string]string{"host": "a"}), now)
+	n.process(newTestAlert("cpu", "2", 1, 0, map[string]string{"host": "b"}), now)
+	n.process(newTestAlert("cpu", "3", 1, 0, map[string]string{"host": "silenced"}), now)
+	// the same alert is merged into the pending one
+	n.process(newTestAlert("cpu", "1", 2, 0, map[string]string{"host": "a"}), now.Add(time.Second))
+	n.process(newTestAlert("mem", "4", 1, 0, nil), now.Add(10*time.Second))
+
+	flushAndSend(n, now.Add(29*time.Second))
+	if len(hook.received()) != 0 {
+		t.Fatalf("notifications are sent before group-wait")
+	}
+	flushAndSend(n, now.Add(30*time.Second))
+	bodies := hook.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(bodies))
+	}
+	var notification Notification
+	if err := json.Unmarshal(bodies[0], &notification); err != nil {
+		t.Fatal(err)
+	}
+	if notification.Status != STATUS_FIRING || len(notification.Alerts) != 2 || notification.GroupLabels["alert_policy"] != "cpu" {
+		t.Errorf("unexpected notification: %s", bodies[0])
+	}
+	if notification.Alerts[0].EventLevel != 2 || !strings.Contains(notification.Subject, "alert_policy=cpu") {
+		t.Errorf("unexpected notification: %s", bodies[0])
+	}
+	flushAndSend(n, now.Add(40*time.Second))
+	if len(hook.received()) != 2 {
+		t.Fatalf("group of mem is not sent")
+	}
+
+	// unchanged alerts are not notified again within repeat-interval
+	n.process(newTestAlert("cpu", "2", 1, 0, map[string]string{"host": "b"}), now.Add(60*time.Second))
+	flushAndSend(n, now.Add(120*time.Second))
+	if len(hook.received()) != 2 {
+		t.Fatalf("duplicated alert is notified")
+	}
+	// the state changes
+	n.process(newTestAlert("cpu", "2", 1, 1, map[string]string{"host": "b"}), now.Add(130*time.Second))
+	// repeat-interval is expired
+	n.process(newTestAlert("mem", "4", 1, 0, nil), now.Add(3700*time.Second))
+	flushAndSend(n, now.Add(3800*time.Second))
+	if len(hook.received()) != 4 {
+		t.Fatalf("got %d notifications, want 4", len(hook.received()))
+	}
+	if c := n.loadCounter(false); c.SilencedCount != 1 || c.DedupCount != 1 || c.SentCount != 4 {
+		t.Errorf("unexpected counter: %+v", *c)
+	}
+	history := n.History(0)
+	if len(history) != 4 || history[0].Error != "" || history[0].Time != now.Add(3800*time.Second) {
+		t.Errorf("unexpected history: %+v", history)
+	}
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	hook := newWebhookStandIn()
+	defer hook.server.Close()
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		HistorySize:   3,
+		RetryInterval: 10,
+		MaxRetryWait:  15,
+		MaxRetries:    2,
+		Receivers: []config.AlertReceiverConfig{
+			{Name: "hook", Type: "webhook", URL: hook.server.URL, Headers: map[string]string{"X-Fail": "1"}},
+		},
+		Routes: []config.AlertRouteConfig{{Receivers: []string{"hook"}}},
+	})
+	writer := &deliveryStandIn{}
+	n.writer = writer
+	now := time.Unix(1700000000, 0)
+	n.process(newTestAlert("cpu", "0", 1, 0, nil), now)
+	flushAndSend(n, now.Add(time.Minute))
+	if len(hook.received()) != 1 {
+		t.Fatalf("got %d requests, want 1", len(hook.received()))
+	}
+	// the failed group is retried after the retry wait, a newer state of the alert replaces the failed one
+	n.process(newTestAlert("cpu", "0", 2, 0, nil), now.Add(time.Minute))
+	flushAndSend(n, now.Add(time.Minute+9*time.Second))
+	if len(hook.received()) != 1 {
+		t.Fatalf("failed notification is retried before the retry wait")
+	}
+	flushAndSend(n, now.Add(time.Minute+10*time.Second))
+	var notification Notification
+	if bodies := hook.received(); len(bodies) != 2 || json.Unmarshal(bodies[1], &notification) != nil ||
+		len(notification.Alerts) != 1 || notification.Alerts[0].EventLevel != 2 {
+		t.Fatalf("unexpected retried notifications: %s", bodies)
+	}
+	// the retry wait doubles up to max-retry-wait, the group is abandoned after max-retries retries
+	flushAndSend(n, now.Add(time.Minute+24*time.Second))
+	if len(hook.received()) != 2 {
+		t.Fatalf("failed notification is retried before the retry wait")
+	}
+	flushAndSend(n, now.Add(time.Minute+25*time.Second))
+	flushAndSend(n, now.Add(time.Hour))
+	if len(hook.received()) != 3 || len(n.groups) != 0 {
+		t.Fatalf("got %d requests and %d groups, want 3 and 0", len(hook.received()), len(n.groups))
+	}
+
+	history := n.History(10)
+	if len(history) != 3 || history[0].Result != RESULT_ABANDONED || history[0].Attempt != 3 ||
+		history[2].Result != RESULT_RETRYING || !strings.Contains(history[0].Error, "500") {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if len(writer.records) != 3 || writer.records[2].Result != RESULT_ABANDONED || writer.records[2].EventIds[0] != "0" {
+		t.Errorf("unexpected delivery records: %+v", writer.records)
+	}
+	if c := n.loadCounter(false); c.FailedCount != 3 || c.AbandonedCount != 1 || c.SentCount != 0 {
+		t.Errorf("unexpected counter: %+v", *c)
+	}
+}
+
+func TestInFlightDedup(t *testing.T) {
+	hook := newWebhookStandIn()
+	defer hook.server.Close()
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		RepeatInterval: 3600,
+		Receivers: []config.AlertReceiverConfig{
+			{Name: "hook", Type: "webhook", URL: hook.server.URL, Headers: map[string]string{"X-Fail": "1"}},
+		},
+		Routes: []config.AlertRouteConfig{{Receivers: []string{"hook"}}},
+	})
+	writer := &deliveryStandIn{}
+	n.writer = writer
+	now := time.Unix(1700000000, 0)
+	n.process(newTestAlert("cpu", "0", 1, 0, nil), now)
+	groups := n.flush(now.Add(time.Minute))
+	// the same alert written while the group is being sent is not grouped again
+	n.process(newTestAlert("cpu", "0", 1, 0, nil), now.Add(time.Minute))
+	if len(groups) != 1 || len(n.groups) != 0 || n.loadCounter(false).DedupCount != 1 {
+		t.Fatalf("got %d groups in flight and %d pending groups, counter: %+v", len(groups), len(n.groups), *n.loadCounter(false))
+	}
+	n.send(groups[0], now.Add(time.Minute))
+
+	// the retrying group is sent once on closing, and recorded as abandoned if it fails
+	n.Close()
+	if len(hook.received()) != 2 || len(n.groups) != 0 {
+		t.Fatalf("got %d requests and %d groups, want 2 and 0", len(hook.received()), len(n.groups))
+	}
+	if len(writer.records) != 2 || writer.records[0].Result != RESULT_RETRYING || writer.records[1].Result != RESULT_ABANDONED {
+		t.Errorf("unexpected delivery records: %+v", writer.records)
+	}
+	if len(n.notified) != 0 {
+		t.Errorf("abandoned alerts are still in flight: %+v", n.notified)
+	}
+}
+
+func TestSenders(t *testing.T) {
+	hook := newWebhookStandIn()
+	defer hook.server.Close()
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		GroupBy:     []string{"alert_policy"},
+		SenderCount: 2,
+		Receivers:   []config.AlertReceiverConfig{{Name: "hook", Type: "webhook", URL: hook.server.URL}},
+		Routes:      []config.AlertRouteConfig{{Receivers: []string{"hook"}}},
+	})
+	n.Start()
+	for i := 0; i < 5; i++ {
+		n.Notify(newTestAlert(fmt.Sprintf("policy%d", i), strconv.Itoa(i), 1, 0, nil))
+	}
+	// the alerts of different orgs are not grouped together
+	a := newTestAlert("policy0", "5", 1, 0, nil)
+	a.OrgId = 2
+	a.FillLabels()
+	n.Notify(a)
+	for len(n.inQueue) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the pending groups are sent by the senders on closing
+	n.Close()
+	if len(hook.received()) != 6 {
+		t.Fatalf("got %d notifications, want 6", len(hook.received()))
+	}
+	if c := n.loadCounter(false); c.SentCount != 6 {
+		t.Errorf("unexpected counter: %+v", *c)
+	}
+}
+
+func TestAlertmanagerReceiver(t *testing.T) {
+	hook := newWebhookStandIn()
+	defer hook.server.Close()
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		Receivers: []config.AlertReceiverConfig{{Name: "am", Type: "alertmanager", URL: hook.server.URL}},
+		Routes:    []config.AlertRouteConfig{{Receivers: []string{"am"}}},
+	})
+	a := newTestAlert("cpu", "1", 5, 1, map[string]string{"host": "a", "empty": ""})
+	a.EndTime = time.Unix(1700000600, 0)
+	n.process(a, a.Time)
+	flushAndSend(n, a.Time.Add(time.Minute))
+
+	bodies := hook.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(bodies))
+	}
+	var alerts []alertmanagerAlert
+	if err := json.Unmarshal(bodies[0], &alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("unexpected payload: %s", bodies[0])
+	}
+	am := alerts[0]
+	if am.Labels["alertname"] != "cpu" || am.Labels["event_level"] != "recovered" || am.Labels["host"] != "a" {
+		t.Errorf("unexpected labels: %v", am.Labels)
+	}
+	if _, ok := am.Labels["empty"]; ok {
+		t.Errorf("empty label should be removed: %v", am.Labels)
+	}
+	if am.EndsAt == nil || !am.EndsAt.Equal(a.EndTime) || !am.StartsAt.Equal(a.StartTime) {
+		t.Errorf("unexpected time range: %v - %v", am.StartsAt, am.EndsAt)
+	}
+}
+
+// smtpStandIn accepts one mail without authentication
+type smtpStandIn struct {
+	listener net.Listener
+	mail     chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: l, mail: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 localhost ESMTP")
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 end with <CRLF>.<CRLF>")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mail <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPReceiver(t *testing.T) {
+	smtpServer := newSMTPStandIn(t)
+	defer smtpServer.listener.Close()
+	host, port, _ := net.SplitHostPort(smtpServer.listener.Addr().String())
+	controller := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// the mail servers of the org of the alert
+		if r.Header.Get(HEADER_KEY_X_ORG_ID) != "3" {
+			fmt.Fprint(rw, `{"OPT_STATUS":"SUCCESS","DATA":[]}`)
+			return
+		}
+		fmt.Fprintf(rw, `{"OPT_STATUS":"SUCCESS","DATA":[{"STATUS":0,"HOST":"disabled"},{"STATUS":1,"HOST":"%s","PORT":%s,"SECURITY":"none"}]}`, host, port)
+	}))
+	defer controller.Close()
+
+	n := newTestNotifier(t, &config.AlertNotifierConfig{
+		MailServerURL: controller.URL,
+		MailFrom:      "deepflow@example.com",
+		Receivers: []config.AlertReceiverConfig{{
+			Name:            "mail",
+			Type:            "smtp",
+			To:              []string{"ops@example.com"},
+			SubjectTemplate: `{{.Status}}: {{range .Alerts}}{{.AlertPolicy}}{{end}}`,
+		}},
+		Routes: []config.AlertRouteConfig{{Receivers: []string{"mail"}}},
+	})
+	a := newTestAlert("cpu", "1", 1, 0, nil)
+	a.OrgId = 3
+	n.process(a, a.Time)
+	flushAndSend(n, a.Time.Add(time.Minute))
+	if history := n.History(1); len(history) != 1 || history[0].Error != "" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	select {
+	case mail := <-smtpServer.mail:
+		if !strings.Contains(mail, "Subject: firing: cpu\r\n") || !strings.Contains(mail, "[critical][ongoing] cpu") {
+			t.Errorf("unexpected mail: %s", mail)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail is received")
+	}
+}
@@ -0,0 +1,423 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/event/config"
+)
+
+const (
+	STATUS_FIRING   = "firing"
+	STATUS_RESOLVED = "resolved"
+
+	DEFAULT_SUBJECT_TEMPLATE = `[DeepFlow][{{.Status}}] {{len .Alerts}} alert(s){{range $k, $v := .GroupLabels}} {{$k}}={{$v}}{{end}}`
+	DEFAULT_BODY_TEMPLATE    = `{{range .Alerts}}[{{levelName .EventLevel}}][{{stateName .State}}] {{.AlertPolicy}}
+  value: {{if .MetricValueStr}}{{.MetricValueStr}}{{else}}{{.MetricValue}}{{end}}{{.MetricUnit}}, threshold: {{.TriggerThreshold}}
+  target: {{.TargetTags}}
+  start: {{formatTime .StartTime}}{{if .Resolved}}, end: {{formatTime .EndTime}}{{end}}
+{{end}}`
+
+	mailServerCacheTTL = time.Minute
+	// the org of the mail servers requested from the controller
+	HEADER_KEY_X_ORG_ID = "X-Org-Id"
+)
+
+// Notification is the data of the message templates and the payload of the generic webhook
+type Notification struct {
+	OrgId       uint16            `json:"org_id"`
+	Receiver    string            `json:"receiver"`
+	Status      string            `json:"status"`
+	GroupKey    string            `json:"group_key"`
+	GroupLabels map[string]string `json:"group_labels"`
+	Alerts      []*Alert          `json:"alerts"`
+	Subject     string            `json:"subject"`
+	Message     string            `json:"message"`
+}
+
+func newNotification(orgId uint16, receiver, groupKey string, groupLabels map[string]string, alerts []*Alert) *Notification {
+	n := &Notification{
+		OrgId:       orgId,
+		Receiver:    receiver,
+		Status:      STATUS_RESOLVED,
+		GroupKey:    groupKey,
+		GroupLabels: groupLabels,
+		Alerts:      alerts,
+	}
+	for _, a := range alerts {
+		if !a.Resolved() {
+			n.Status = STATUS_FIRING
+			break
+		}
+	}
+	return n
+}
+
+var templateFuncs = template.FuncMap{
+	"levelName": EventLevelName,
+	"stateName": StateName,
+	"formatTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	},
+	"join": strings.Join,
+}
+
+type templates struct {
+	subject, body *template.Template
+}
+
+func newTemplates(name, subject, body string) (*templates, error) {
+	if subject == "" {
+		subject = DEFAULT_SUBJECT_TEMPLATE
+	}
+	if body == "" {
+		body = DEFAULT_BODY_TEMPLATE
+	}
+	t := &templates{}
+	var err error
+	if t.subject, err = template.New(name + "-subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return nil, fmt.Errorf("receiver %s: invalid subject-template: %s", name, err)
+	}
+	if t.body, err = template.New(name + "-body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, fmt.Errorf("receiver %s: invalid body-template: %s", name, err)
+	}
+	return t, nil
+}
+
+func (t *templates) render(n *Notification) error {
+	var buf bytes.Buffer
+	if err := t.subject.Execute(&buf, n); err != nil {
+		return fmt.Errorf("render subject failed: %s", err)
+	}
+	// header injection is not allowed in the subject of a mail
+	n.Subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(buf.String())
+	buf.Reset()
+	if err := t.body.Execute(&buf, n); err != nil {
+		return fmt.Errorf("render body failed: %s", err)
+	}
+	n.Message = buf.String()
+	return nil
+}
+
+type Receiver interface {
+	Name() string
+	Type() string
+	Send(n *Notification) error
+}
+
+func newReceiver(cfg *config.AlertReceiverConfig, mailServers *mailServerCache, mailFrom string) (Receiver, error) {
+	tmpl, err := newTemplates(cfg.Name, cfg.SubjectTemplate, cfg.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	switch cfg.Type {
+	case config.AlertReceiverTypeSMTP:
+		return &smtpReceiver{
+			cfg:         cfg,
+			templates:   tmpl,
+			mailServers: mailServers,
+			from:        mailFrom,
+			timeout:     timeout,
+		}, nil
+	case config.AlertReceiverTypeWebhook, config.AlertReceiverTypeAlertmanager:
+		return &webhookReceiver{
+			cfg:       cfg,
+			templates: tmpl,
+			client:    &http.Client{Timeout: timeout},
+		}, nil
+	}
+	return nil, fmt.Errorf("receiver %s: invalid type %s", cfg.Name, cfg.Type)
+}
+
+type webhookReceiver struct {
+	cfg       *config.AlertReceiverConfig
+	templates *templates
+	client    *http.Client
+}
+
+func (r *webhookReceiver) Name() string { return r.cfg.Name }
+func (r *webhookReceiver) Type() string { return r.cfg.Type }
+
+// alertmanagerAlert is the payload of 'POST /api/v2/alerts' of Alertmanager
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+func toAlertmanagerAlerts(n *Notification) []alertmanagerAlert {
+	alerts := make([]alertmanagerAlert, 0, len(n.Alerts))
+	for _, a := range n.Alerts {
+		am := alertmanagerAlert{
+			Labels: make(map[string]string, len(a.Labels)+1),
+			Annotations: map[string]string{
+				"summary":           n.Subject,
+				"description":       n.Message,
+				"metric_value":      strconv.FormatFloat(a.MetricValue, 'f', -1, 64),
+				"trigger_threshold": a.TriggerThreshold,
+				"target_tags":       a.TargetTags,
+			},
+			StartsAt: a.StartTime,
+		}
+		// an empty label value is equal to an absent label in Alertmanager
+		for k, v := range a.Labels {
+			if v != "" {
+				am.Labels[k] = v
+			}
+		}
+		am.Labels["alertname"] = a.AlertPolicy
+		if a.Resolved() {
+			endsAt := a.EndTime
+			if endsAt.IsZero() {
+				endsAt = a.Time
+			}
+			am.EndsAt = &endsAt
+		}
+		alerts = append(alerts, am)
+	}
+	return alerts
+}
+
+func (r *webhookReceiver) Send(n *Notification) error {
+	if err := r.templates.render(n); err != nil {
+		return err
+	}
+	var payload interface{} = n
+	if r.cfg.Type == config.AlertReceiverTypeAlertmanager {
+		payload = toAlertmanagerAlerts(n)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s returned %s: %s", r.cfg.URL, resp.Status, msg)
+	}
+	return nil
+}
+
+// MailServer is the mail server configured by the controller API '/v1/mail-server/'
+type MailServer struct {
+	Status      int    `json:"STATUS"`
+	Host        string `json:"HOST"`
+	Port        int    `json:"PORT"`
+	User        string `json:"USER"`
+	Password    string `json:"PASSWORD"`
+	Security    string `json:"SECURITY"`
+	NtlmEnabled int    `json:"NTLM_ENABLED"`
+}
+
+type cachedMailServer struct {
+	server    *MailServer
+	updatedAt time.Time
+}
+
+// mailServerCache caches the enabled mail server of each org
+type mailServerCache struct {
+	url    string
+	client *http.Client
+
+	sync.Mutex
+	servers map[uint16]*cachedMailServer
+}
+
+func newMailServerCache(url string) *mailServerCache {
+	return &mailServerCache{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		servers: make(map[uint16]*cachedMailServer),
+	}
+}
+
+func (c *mailServerCache) get(orgId uint16) (*MailServer, error) {
+	c.Lock()
+	defer c.Unlock()
+	cached, ok := c.servers[orgId]
+	if ok && time.Since(cached.updatedAt) < mailServerCacheTTL {
+		return cached.server, nil
+	}
+	server, err := c.fetch(orgId)
+	if err != nil {
+		// keep using the last mail server if the controller is unavailable
+		if ok {
+			log.Warningf("get mail servers of org %d from %s failed, use the cached one: %s", orgId, c.url, err)
+			return cached.server, nil
+		}
+		return nil, err
+	}
+	c.servers[orgId] = &cachedMailServer{server: server, updatedAt: time.Now()}
+	return server, nil
+}
+
+func (c *mailServerCache) fetch(orgId uint16) (*MailServer, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HEADER_KEY_X_ORG_ID, strconv.Itoa(int(orgId)))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s of org %d returned %s", c.url, orgId, resp.Status)
+	}
+	var result struct {
+		Data []MailServer `json:"DATA"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode mail servers failed: %s", err)
+	}
+	for i := range result.Data {
+		if result.Data[i].Status == 1 {
+			return &result.Data[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no enabled mail server of org %d in %s", orgId, c.url)
+}
+
+type smtpReceiver struct {
+	cfg         *config.AlertReceiverConfig
+	templates   *templates
+	mailServers *mailServerCache
+	from        string
+	timeout     time.Duration
+}
+
+func (r *smtpReceiver) Name() string { return r.cfg.Name }
+func (r *smtpReceiver) Type() string { return r.cfg.Type }
+
+func (r *smtpReceiver) Send(n *Notification) error {
+	if err := r.templates.render(n); err != nil {
+		return err
+	}
+	server, err := r.mailServers.get(n.OrgId)
+	if err != nil {
+		return err
+	}
+	from := r.from
+	if from == "" {
+		from = server.User
+	}
+	if from == "" {
+		return fmt.Errorf("mail-from is not configured and the mail server has no user")
+	}
+	return sendMail(server, from, r.cfg.To, buildMail(from, r.cfg.To, n.Subject, n.Message), r.timeout)
+}
+
+func buildMail(from string, to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+func sendMail(server *MailServer, from string, to []string, msg []byte, timeout time.Duration) error {
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	tlsConfig := &tls.Config{ServerName: server.Host}
+	security := strings.ToLower(server.Security)
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if security == "ssl" || security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if security == "starttls" {
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if server.NtlmEnabled != 0 {
+		log.Warningf("NTLM authentication of mail server %s is not supported, use PLAIN instead", addr)
+	}
+	if server.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", server.User, server.Password, server.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
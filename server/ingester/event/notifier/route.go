@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/event/config"
+)
+
+type matcher struct {
+	equals  map[string]string
+	regexps map[string]*regexp.Regexp
+}
+
+func newMatcher(equals, regexps map[string]string) (*matcher, error) {
+	m := &matcher{
+		equals:  equals,
+		regexps: make(map[string]*regexp.Regexp, len(regexps)),
+	}
+	for k, v := range regexps {
+		// anchored like the matchers of Prometheus
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex '%s' of label %s: %s", v, k, err)
+		}
+		m.regexps[k] = re
+	}
+	return m, nil
+}
+
+func (m *matcher) match(labels map[string]string) bool {
+	for k, v := range m.equals {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for k, re := range m.regexps {
+		if !re.MatchString(labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+type route struct {
+	*matcher
+	eventLevels map[uint8]bool
+	receivers   []string
+	continues   bool
+}
+
+func newRoutes(cfgs []config.AlertRouteConfig) ([]*route, error) {
+	routes := make([]*route, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		m, err := newMatcher(cfg.Match, cfg.MatchRegex)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %s", i, err)
+		}
+		r := &route{
+			matcher:   m,
+			receivers: cfg.Receivers,
+			continues: cfg.Continue,
+		}
+		if len(cfg.EventLevels) > 0 {
+			r.eventLevels = make(map[uint8]bool, len(cfg.EventLevels))
+			for _, l := range cfg.EventLevels {
+				r.eventLevels[uint8(l)] = true
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (r *route) matchAlert(a *Alert) bool {
+	if r.eventLevels != nil && !r.eventLevels[a.EventLevel] {
+		return false
+	}
+	return r.match(a.Labels)
+}
+
+// routeAlert returns the names of the receivers the alert should be sent to, routes are
+// matched in order and the first matched route stops the matching unless it continues
+func routeAlert(routes []*route, a *Alert) []string {
+	var receivers []string
+	for _, r := range routes {
+		if !r.matchAlert(a) {
+			continue
+		}
+		for _, name := range r.receivers {
+			if !contains(receivers, name) {
+				receivers = append(receivers, name)
+			}
+		}
+		if !r.continues {
+			break
+		}
+	}
+	return receivers
+}
+
+type silence struct {
+	*matcher
+	startsAt, endsAt time.Time
+	comment          string
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func newSilences(cfgs []config.AlertSilenceConfig) ([]*silence, error) {
+	silences := make([]*silence, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if len(cfg.Match) == 0 && len(cfg.MatchRegex) == 0 {
+			return nil, fmt.Errorf("silence %d: at least one matcher is required", i)
+		}
+		m, err := newMatcher(cfg.Match, cfg.MatchRegex)
+		if err != nil {
+			return nil, fmt.Errorf("silence %d: %s", i, err)
+		}
+		s := &silence{matcher: m, comment: cfg.Comment}
+		if s.startsAt, err = parseTime(cfg.StartsAt); err != nil {
+			return nil, fmt.Errorf("silence %d: invalid starts-at: %s", i, err)
+		}
+		if s.endsAt, err = parseTime(cfg.EndsAt); err != nil {
+			return nil, fmt.Errorf("silence %d: invalid ends-at: %s", i, err)
+		}
+		silences = append(silences, s)
+	}
+	return silences, nil
+}
+
+func (s *silence) active(now time.Time) bool {
+	if !s.startsAt.IsZero() && now.Before(s.startsAt) {
+		return false
+	}
+	if !s.endsAt.IsZero() && !now.Before(s.endsAt) {
+		return false
+	}
+	return true
+}
+
+func silenced(silences []*silence, a *Alert, now time.Time) bool {
+	for _, s := range silences {
+		if s.active(now) && s.match(a.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/influxdata/influxdb/models"
 	logging "github.com/op/go-logging"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
 	"github.com/deepflowio/deepflow/server/ingester/ext_metrics/config"
@@ -33,6 +34,7 @@ import (
 	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/stats/pb"
@@ -53,13 +55,14 @@ type Counter struct {
 	ErrorCount             int64 `statsd:"err-count"`
 	ErrMetrics             int64 `statsd:"err-metrics"`
 	DropUnsupportedMetrics int64 `statsd:"drop-unsupported-metrics"`
+	QuotaDropCount         int64 `statsd:"quota-drop-count"` // messages dropped by the rows-per-day quotas
 }
 
 type Decoder struct {
 	index             int
 	msgType           datatype.MessageType
 	platformData      *grpc.PlatformInfoTable
-	inQueue           queue.QueueReader
+	inQueue           queue.TypedQueueReader[*receiver.RecvBuffer]
 	extMetricsWriters [dbwriter.MAX_DB_ID]*dbwriter.ExtMetricsWriter
 	debugEnabled      bool
 	config            *config.Config
@@ -71,6 +74,7 @@ type Decoder struct {
 	platformDataVersion      [grpc.MAX_ORG_COUNT]uint64
 
 	orgId, teamId uint16
+	quotaRows     *quota.RowCounter
 
 	counter *Counter
 	utils.Closable
@@ -79,7 +83,7 @@ type Decoder struct {
 func NewDecoder(
 	index int, msgType datatype.MessageType,
 	platformData *grpc.PlatformInfoTable,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	extMetricsWriters [dbwriter.MAX_DB_ID]*dbwriter.ExtMetricsWriter,
 	config *config.Config,
 ) *Decoder {
@@ -101,6 +105,14 @@ func NewDecoder(
 	return d
 }
 
+// SetQuota enables the rows-per-day quotas of ext_metrics, the deepflow stats
+// are not limited since they are written by deepflow itself
+func (d *Decoder) SetQuota(m *quota.Manager) {
+	if d.msgType == datatype.MESSAGE_TYPE_TELEGRAF || d.msgType == datatype.MESSAGE_TYPE_OPENTELEMETRY_METRICS {
+		d.quotaRows = m.NewRowCounter(quota.EXT_METRICS)
+	}
+}
+
 func (d *Decoder) GetCounter() interface{} {
 	var counter *Counter
 	counter, d.counter = d.counter, &Counter{}
@@ -113,8 +125,9 @@ func (d *Decoder) Run() {
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": d.msgType.String()})
 
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	decoder := &codec.SimpleDecoder{}
+	metricsData := &metricsv1.MetricsData{}
 	for {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
@@ -122,9 +135,10 @@ func (d *Decoder) Run() {
 				continue
 			}
 			d.counter.InCount++
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("get decode queue data type wrong")
+			recvBytes := buffer[i]
+			if !d.quotaRows.Begin(recvBytes.OrgID, recvBytes.TeamID) {
+				d.counter.QuotaDropCount++
+				receiver.ReleaseRecvBuffer(recvBytes)
 				continue
 			}
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
@@ -133,7 +147,10 @@ func (d *Decoder) Run() {
 				d.handleTelegraf(recvBytes.VtapID, decoder)
 			} else if d.msgType == datatype.MESSAGE_TYPE_DFSTATS || d.msgType == datatype.MESSAGE_TYPE_SERVER_DFSTATS {
 				d.handleDeepflowStats(recvBytes.VtapID, decoder)
+			} else if d.msgType == datatype.MESSAGE_TYPE_OPENTELEMETRY_METRICS {
+				d.handleOTelMetrics(recvBytes.VtapID, decoder, metricsData)
 			}
+			d.quotaRows.End()
 			receiver.ReleaseRecvBuffer(recvBytes)
 		}
 	}
@@ -177,6 +194,7 @@ func (d *Decoder) sendTelegraf(vtapID uint16, point models.Point) {
 	}
 	d.extMetricsWriters[int(dbwriter.EXT_METRICS_DB_ID)].Write(extMetrics)
 	d.counter.OutCount++
+	d.quotaRows.Add(1)
 }
 
 func (d *Decoder) handleDeepflowStats(vtapID uint16, decoder *codec.SimpleDecoder) {
@@ -0,0 +1,322 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	v11 "go.opentelemetry.io/proto/otlp/common/v1"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/ext_metrics/dbwriter"
+	"github.com/deepflowio/deepflow/server/libs/codec"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+const (
+	VTABLE_PREFIX_OTEL = "otel."
+
+	OTEL_TAG_TEMPORALITY = "temporality"
+	OTEL_TAG_MONOTONIC   = "monotonic"
+	OTEL_TAG_LE          = "le"
+	OTEL_TAG_QUANTILE    = "quantile"
+
+	OTEL_FIELD_VALUE      = "value"
+	OTEL_FIELD_COUNT      = "count"
+	OTEL_FIELD_SUM        = "sum"
+	OTEL_FIELD_MIN        = "min"
+	OTEL_FIELD_MAX        = "max"
+	OTEL_FIELD_BUCKET     = "bucket"
+	OTEL_FIELD_ZERO_COUNT = "zero_count"
+)
+
+func (d *Decoder) handleOTelMetrics(vtapID uint16, decoder *codec.SimpleDecoder, metricsData *metricsv1.MetricsData) {
+	for !decoder.IsEnd() {
+		metricsData.Reset()
+		bytes := decoder.ReadBytes()
+		var err error
+		if len(bytes) > 0 {
+			err = proto.Unmarshal(bytes, metricsData)
+		}
+		if decoder.Failed() || err != nil {
+			if d.counter.ErrorCount == 0 {
+				log.Errorf("OpenTelemetry metrics decode failed, offset=%d len=%d err: %v", decoder.Offset(), len(decoder.Bytes()), err)
+			}
+			d.counter.ErrorCount++
+			return
+		}
+		if d.debugEnabled {
+			log.Debugf("decoder %d vtap %d recv otel metrics: %s", d.index, vtapID, metricsData)
+		}
+		for _, m := range d.OTelMetricsToExtMetrics(vtapID, metricsData) {
+			if !m.IsValid() {
+				if d.counter.ErrMetrics == 0 {
+					log.Warningf("ext metrics is invalid. %+v", m)
+				}
+				d.counter.ErrMetrics++
+				dbwriter.ReleaseExtMetrics(m)
+				continue
+			}
+			d.extMetricsWriters[int(dbwriter.EXT_METRICS_DB_ID)].Write(m)
+			d.counter.OutCount++
+			d.quotaRows.Add(1)
+		}
+	}
+}
+
+// otelPoint collects the tags shared by the rows generated from one data point
+type otelPoint struct {
+	vtableName string
+	timestamp  uint32
+	podName    string
+	tagNames   []string
+	tagValues  []string
+}
+
+func (d *Decoder) newOTelExtMetrics(vtapID uint16, p *otelPoint, extraTags ...string) *dbwriter.ExtMetrics {
+	m := dbwriter.AcquireExtMetrics()
+	m.Timestamp = p.timestamp
+	m.MsgType = datatype.MESSAGE_TYPE_OPENTELEMETRY_METRICS
+	m.VTableName = p.vtableName
+	m.OrgId, m.TeamID = d.orgId, d.teamId
+	m.TagNames = append(m.TagNames, p.tagNames...)
+	m.TagValues = append(m.TagValues, p.tagValues...)
+	for i := 0; i+1 < len(extraTags); i += 2 {
+		m.TagNames = append(m.TagNames, extraTags[i])
+		m.TagValues = append(m.TagValues, extraTags[i+1])
+	}
+	d.fillExtMetricsBase(m, vtapID, p.podName, vtapID != 0)
+	return m
+}
+
+func addField(m *dbwriter.ExtMetrics, name string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	m.MetricsFloatNames = append(m.MetricsFloatNames, name)
+	m.MetricsFloatValues = append(m.MetricsFloatValues, value)
+}
+
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+func otelTimestamp(timeUnixNano uint64) uint32 {
+	if timeUnixNano == 0 {
+		return uint32(time.Now().Unix())
+	}
+	return uint32(timeUnixNano / uint64(time.Second))
+}
+
+func numberValue(p *metricsv1.NumberDataPoint) float64 {
+	if v, ok := p.GetValue().(*metricsv1.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return p.GetAsDouble()
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricsv1.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func temporalityString(t metricsv1.AggregationTemporality) string {
+	switch t {
+	case metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return "delta"
+	case metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return "cumulative"
+	}
+	return "unspecified"
+}
+
+// OTelMetricsToExtMetrics converts each data point to rows of the virtual table 'otel.<metric name>',
+//   - gauge and sum: field 'value', sum has tags 'temporality' and 'monotonic'
+//   - histogram and exponential histogram: fields 'count', 'sum', 'min', 'max' (and 'zero_count'),
+//     and the cumulative count of each bucket in field 'bucket' with tag 'le' as prometheus does
+//   - summary: fields 'count', 'sum', and each quantile in field 'value' with tag 'quantile'
+//
+// Resource attributes and data point attributes are stored as tags, 'k8s.pod.name' is used to fill the universal tags.
+func (d *Decoder) OTelMetricsToExtMetrics(vtapID uint16, metricsData *metricsv1.MetricsData) []*dbwriter.ExtMetrics {
+	var ret []*dbwriter.ExtMetrics
+	for _, resourceMetrics := range metricsData.GetResourceMetrics() {
+		resTagNames, resTagValues := []string{}, []string{}
+		podName := ""
+		for _, attr := range resourceMetrics.GetResource().GetAttributes() {
+			value := common.OTelValueString(attr.GetValue())
+			if attr.GetKey() == common.OTEL_K8S_POD_NAME {
+				podName = value
+			}
+			resTagNames = append(resTagNames, attr.GetKey())
+			resTagValues = append(resTagValues, value)
+		}
+
+		newPoint := func(vtableName string, timeUnixNano uint64, attrs []*v11.KeyValue) *otelPoint {
+			p := &otelPoint{
+				vtableName: vtableName,
+				timestamp:  otelTimestamp(timeUnixNano),
+				podName:    podName,
+				tagNames:   make([]string, 0, len(resTagNames)+len(attrs)),
+				tagValues:  make([]string, 0, len(resTagNames)+len(attrs)),
+			}
+			p.tagNames = append(p.tagNames, resTagNames...)
+			p.tagValues = append(p.tagValues, resTagValues...)
+			for _, attr := range attrs {
+				p.tagNames = append(p.tagNames, attr.GetKey())
+				p.tagValues = append(p.tagValues, common.OTelValueString(attr.GetValue()))
+			}
+			return p
+		}
+
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				name := strings.TrimSpace(metric.GetName())
+				if name == "" {
+					d.counter.ErrMetrics++
+					continue
+				}
+				vtableName := VTABLE_PREFIX_OTEL + name
+
+				switch data := metric.GetData().(type) {
+				case *metricsv1.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						m := d.newOTelExtMetrics(vtapID, newPoint(vtableName, dp.GetTimeUnixNano(), dp.GetAttributes()))
+						addField(m, OTEL_FIELD_VALUE, numberValue(dp))
+						ret = append(ret, m)
+					}
+				case *metricsv1.Metric_Sum:
+					temporality := temporalityString(data.Sum.GetAggregationTemporality())
+					monotonic := strconv.FormatBool(data.Sum.GetIsMonotonic())
+					for _, dp := range data.Sum.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						m := d.newOTelExtMetrics(vtapID, newPoint(vtableName, dp.GetTimeUnixNano(), dp.GetAttributes()),
+							OTEL_TAG_TEMPORALITY, temporality, OTEL_TAG_MONOTONIC, monotonic)
+						addField(m, OTEL_FIELD_VALUE, numberValue(dp))
+						ret = append(ret, m)
+					}
+				case *metricsv1.Metric_Histogram:
+					temporality := temporalityString(data.Histogram.GetAggregationTemporality())
+					for _, dp := range data.Histogram.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						p := newPoint(vtableName, dp.GetTimeUnixNano(), dp.GetAttributes())
+						m := d.newOTelExtMetrics(vtapID, p, OTEL_TAG_TEMPORALITY, temporality)
+						addField(m, OTEL_FIELD_COUNT, float64(dp.GetCount()))
+						if dp.Sum != nil {
+							addField(m, OTEL_FIELD_SUM, dp.GetSum())
+						}
+						if dp.Min != nil {
+							addField(m, OTEL_FIELD_MIN, dp.GetMin())
+						}
+						if dp.Max != nil {
+							addField(m, OTEL_FIELD_MAX, dp.GetMax())
+						}
+						ret = append(ret, m)
+
+						bounds, counts := dp.GetExplicitBounds(), dp.GetBucketCounts()
+						cumulative := uint64(0)
+						for i, count := range counts {
+							cumulative += count
+							bound := math.Inf(1)
+							if i < len(bounds) {
+								bound = bounds[i]
+							}
+							m := d.newOTelExtMetrics(vtapID, p, OTEL_TAG_TEMPORALITY, temporality, OTEL_TAG_LE, formatBound(bound))
+							addField(m, OTEL_FIELD_BUCKET, float64(cumulative))
+							ret = append(ret, m)
+						}
+					}
+				case *metricsv1.Metric_ExponentialHistogram:
+					temporality := temporalityString(data.ExponentialHistogram.GetAggregationTemporality())
+					for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						p := newPoint(vtableName, dp.GetTimeUnixNano(), dp.GetAttributes())
+						m := d.newOTelExtMetrics(vtapID, p, OTEL_TAG_TEMPORALITY, temporality)
+						addField(m, OTEL_FIELD_COUNT, float64(dp.GetCount()))
+						addField(m, OTEL_FIELD_ZERO_COUNT, float64(dp.GetZeroCount()))
+						if dp.Sum != nil {
+							addField(m, OTEL_FIELD_SUM, dp.GetSum())
+						}
+						if dp.Min != nil {
+							addField(m, OTEL_FIELD_MIN, dp.GetMin())
+						}
+						if dp.Max != nil {
+							addField(m, OTEL_FIELD_MAX, dp.GetMax())
+						}
+						ret = append(ret, m)
+
+						// the upper bound of the positive bucket at index i is base^(offset+i+1), base = 2^(2^-scale),
+						// the negative buckets and the zero bucket are all below the first positive bucket
+						cumulative := dp.GetZeroCount()
+						for _, count := range dp.GetNegative().GetBucketCounts() {
+							cumulative += count
+						}
+						base := math.Exp2(math.Exp2(-float64(dp.GetScale())))
+						positive := dp.GetPositive()
+						for i, count := range positive.GetBucketCounts() {
+							cumulative += count
+							bound := math.Pow(base, float64(int(positive.GetOffset())+i+1))
+							m := d.newOTelExtMetrics(vtapID, p, OTEL_TAG_TEMPORALITY, temporality, OTEL_TAG_LE, formatBound(bound))
+							addField(m, OTEL_FIELD_BUCKET, float64(cumulative))
+							ret = append(ret, m)
+						}
+						m = d.newOTelExtMetrics(vtapID, p, OTEL_TAG_TEMPORALITY, temporality, OTEL_TAG_LE, formatBound(math.Inf(1)))
+						addField(m, OTEL_FIELD_BUCKET, float64(dp.GetCount()))
+						ret = append(ret, m)
+					}
+				case *metricsv1.Metric_Summary:
+					for _, dp := range data.Summary.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						p := newPoint(vtableName, dp.GetTimeUnixNano(), dp.GetAttributes())
+						m := d.newOTelExtMetrics(vtapID, p)
+						addField(m, OTEL_FIELD_COUNT, float64(dp.GetCount()))
+						addField(m, OTEL_FIELD_SUM, dp.GetSum())
+						ret = append(ret, m)
+						for _, q := range dp.GetQuantileValues() {
+							m := d.newOTelExtMetrics(vtapID, p, OTEL_TAG_QUANTILE, strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+							addField(m, OTEL_FIELD_VALUE, q.GetValue())
+							ret = append(ret, m)
+						}
+					}
+				default:
+					if d.counter.DropUnsupportedMetrics&0xff == 0 {
+						log.Warningf("drop unsupported otel metrics %s type %T. total drop %d", name, data, d.counter.DropUnsupportedMetrics)
+					}
+					d.counter.DropUnsupportedMetrics++
+				}
+			}
+		}
+	}
+	return ret
+}
@@ -31,7 +31,6 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
-	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 )
@@ -45,10 +44,12 @@ type ExtMetrics struct {
 	Telegraf           *Metricsor
 	DeepflowAgentStats *Metricsor
 	DeepflowStats      *Metricsor
+	OTelMetrics        *Metricsor
 }
 
 type Metricsor struct {
 	Config              *config.Config
+	DecodeQueues        *dropletqueue.TypedMultiQueue[*receiver.RecvBuffer]
 	Decoders            []*decoder.Decoder
 	PlatformDataEnabled bool
 	PlatformDatas       []*grpc.PlatformInfoTable
@@ -70,23 +71,29 @@ func NewExtMetrics(config *config.Config, recv *receiver.Receiver, platformDataM
 	if err != nil {
 		return nil, err
 	}
+	otelMetrics, err := NewMetricsor(datatype.MESSAGE_TYPE_OPENTELEMETRY_METRICS, []dbwriter.WriterDBID{dbwriter.EXT_METRICS_DB_ID}, config, platformDataManager, manager, recv, true)
+	if err != nil {
+		return nil, err
+	}
 	return &ExtMetrics{
 		Config:             config,
 		Telegraf:           telegraf,
 		DeepflowAgentStats: deepflowAgentStats,
 		DeepflowStats:      deepflowStats,
+		OTelMetrics:        otelMetrics,
 	}, nil
 }
 
 func NewMetricsor(msgType datatype.MessageType, flowTagTablePrefixs []dbwriter.WriterDBID, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, platformDataEnabled bool) (*Metricsor, error) {
 	queueCount := config.DecoderQueueCount
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+msgType.String(),
 		config.DecoderQueueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
 	decoders := make([]*decoder.Decoder, queueCount)
@@ -114,13 +121,15 @@ func NewMetricsor(msgType datatype.MessageType, flowTagTablePrefixs []dbwriter.W
 			i,
 			msgType,
 			platformDatas[i],
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			metricsWriters,
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 	}
 	return &Metricsor{
 		Config:              config,
+		DecodeQueues:        decodeQueues,
 		Decoders:            decoders,
 		PlatformDataEnabled: platformDataEnabled,
 		PlatformDatas:       platformDatas,
@@ -151,11 +160,13 @@ func (s *ExtMetrics) Start() {
 	s.Telegraf.Start()
 	s.DeepflowAgentStats.Start()
 	s.DeepflowStats.Start()
+	s.OTelMetrics.Start()
 }
 
 func (s *ExtMetrics) Close() error {
 	s.Telegraf.Close()
 	s.DeepflowAgentStats.Close()
 	s.DeepflowStats.Close()
+	s.OTelMetrics.Close()
 	return nil
 }
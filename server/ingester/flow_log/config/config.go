@@ -17,6 +17,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
 	logging "github.com/op/go-logging"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/deepflowio/deepflow/server/ingester/config"
 	"github.com/deepflowio/deepflow/server/ingester/config/configdefaults"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
 )
 
 var log = logging.MustGetLogger("flow_log.config")
@@ -35,6 +37,21 @@ const (
 	DefaultDecoderQueueSize  = 4096
 	DefaultBrokerQueueSize   = 1 << 14
 	DefaultFlowLogTTL        = 72 // hour
+	DefaultGeoReloadInterval = 60 // second
+
+	DefaultOTLPGRPCPort       = 4317
+	DefaultOTLPHTTPPort       = 4318
+	DefaultOTLPMaxRequestSize = 16 << 20 // byte
+	DefaultOTLPQueueHighWater = 90       // percent
+
+	DefaultLuaHookTimeLimit    = 10 // millisecond
+	DefaultLuaHookMemoryLimit  = 16 // MB
+	DefaultLuaHookSyncInterval = 60 // second
+
+	RedactionDetectorEmail = "email"
+	RedactionDetectorJWT   = "jwt"
+	RedactionDetectorPAN   = "pan"
+	RedactionDetectorPhone = "phone"
 )
 
 type FlowLogTTL struct {
@@ -43,6 +60,65 @@ type FlowLogTTL struct {
 	L4Packet  int `yaml:"l4-packet"`
 }
 
+type GeoConfig struct {
+	MMDBCityFile   string `yaml:"mmdb-city-file"`
+	MMDBASNFile    string `yaml:"mmdb-asn-file"`
+	Language       string `yaml:"language"`
+	ReloadInterval int    `yaml:"reload-interval"`
+}
+
+type OTLPToken struct {
+	Token  string `yaml:"token"`
+	OrgID  uint16 `yaml:"org-id"`
+	TeamID uint32 `yaml:"team-id"`
+}
+
+type OTLPReceiverConfig struct {
+	Enabled        bool        `yaml:"enabled"`
+	GRPCPort       int         `yaml:"grpc-port"`
+	HTTPPort       int         `yaml:"http-port"`
+	MaxRequestSize int         `yaml:"max-request-size"`
+	QueueHighWater int         `yaml:"queue-high-water"` // percent of flow-log-decoder-queue-size, reject requests above it
+	Tokens         []OTLPToken `yaml:"tokens"`
+}
+
+// LuaHookConfig runs the Lua plugins of the org (uploaded by '/v1/plugin/' with TYPE=3 and USER=2)
+// on each l7_flow_log before it is stored
+type LuaHookConfig struct {
+	Enabled      bool                   `yaml:"enabled"`
+	TimeLimit    int                    `yaml:"time-limit"`    // millisecond, max running time of a script for one flow log
+	MemoryLimit  int                    `yaml:"memory-limit"`  // MB, max memory held by a script
+	SyncInterval int                    `yaml:"sync-interval"` // second, interval of syncing plugins from the controller
+	ScriptLimits []LuaScriptLimitConfig `yaml:"script-limits"`
+}
+
+// LuaScriptLimitConfig overrides the limits of a script, 0 means the default limit
+type LuaScriptLimitConfig struct {
+	OrgID       uint16 `yaml:"org-id"`
+	Name        string `yaml:"name"`
+	TimeLimit   int    `yaml:"time-limit"`   // millisecond
+	MemoryLimit int    `yaml:"memory-limit"` // MB
+}
+
+// RedactionRuleConfig masks the sensitive data of l7_flow_log, exactly one of
+// regex, detector, query-keys and sql-literals should be set
+type RedactionRuleConfig struct {
+	Name        string   `yaml:"name"`
+	OrgIDs      []uint16 `yaml:"org-ids"` // empty means all orgs
+	Fields      []string `yaml:"fields"`  // empty means the default fields of the rule type
+	Regex       string   `yaml:"regex"`
+	Detector    string   `yaml:"detector"`   // email, jwt, pan or phone
+	QueryKeys   []string `yaml:"query-keys"` // also matches the attribute names
+	SQLLiterals bool     `yaml:"sql-literals"`
+	Replacement string   `yaml:"replacement"`
+}
+
+// RedactionConfig is applied on each l7_flow_log before it is stored or exported
+type RedactionConfig struct {
+	Enabled bool                  `yaml:"enabled"`
+	Rules   []RedactionRuleConfig `yaml:"rules"`
+}
+
 type Config struct {
 	Base              *config.Config
 	CKWriterConfig    config.CKWriterConfig `yaml:"flowlog-ck-writer"`
@@ -54,6 +130,10 @@ type Config struct {
 	DecoderQueueCount int                   `yaml:"flow-log-decoder-queue-count"`
 	DecoderQueueSize  int                   `yaml:"flow-log-decoder-queue-size"`
 	TraceTreeEnabled  *bool                 `yaml:"flow-log-trace-tree-enabled"`
+	Geo               GeoConfig             `yaml:"flow-log-geo"`
+	OTLPReceiver      OTLPReceiverConfig    `yaml:"otlp-receiver"`
+	LuaHook           LuaHookConfig         `yaml:"flow-log-lua-hook"`
+	Redaction         RedactionConfig       `yaml:"flow-log-redaction"`
 }
 
 type FlowLogConfig struct {
@@ -78,6 +158,50 @@ func (c *Config) Validate() error {
 		c.FlowLogTTL.L4Packet = DefaultFlowLogTTL
 	}
 
+	if c.Geo.ReloadInterval < 0 {
+		c.Geo.ReloadInterval = DefaultGeoReloadInterval
+	}
+
+	if c.OTLPReceiver.GRPCPort == 0 {
+		c.OTLPReceiver.GRPCPort = DefaultOTLPGRPCPort
+	}
+	if c.OTLPReceiver.HTTPPort == 0 {
+		c.OTLPReceiver.HTTPPort = DefaultOTLPHTTPPort
+	}
+	if c.OTLPReceiver.MaxRequestSize <= 0 {
+		c.OTLPReceiver.MaxRequestSize = DefaultOTLPMaxRequestSize
+	}
+	if c.OTLPReceiver.QueueHighWater <= 0 || c.OTLPReceiver.QueueHighWater > 100 {
+		c.OTLPReceiver.QueueHighWater = DefaultOTLPQueueHighWater
+	}
+	for _, t := range c.OTLPReceiver.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("otlp-receiver token of org-id %d is empty", t.OrgID)
+		}
+		if t.OrgID > ckdb.MAX_ORG_ID {
+			return fmt.Errorf("otlp-receiver org-id %d is larger than %d", t.OrgID, ckdb.MAX_ORG_ID)
+		}
+	}
+
+	if c.LuaHook.TimeLimit <= 0 {
+		c.LuaHook.TimeLimit = DefaultLuaHookTimeLimit
+	}
+	if c.LuaHook.MemoryLimit <= 0 {
+		c.LuaHook.MemoryLimit = DefaultLuaHookMemoryLimit
+	}
+	if c.LuaHook.SyncInterval <= 0 {
+		c.LuaHook.SyncInterval = DefaultLuaHookSyncInterval
+	}
+	for _, l := range c.LuaHook.ScriptLimits {
+		if l.Name == "" || l.TimeLimit < 0 || l.MemoryLimit < 0 {
+			return fmt.Errorf("flow-log-lua-hook script-limits of org-id %d: name is empty or limits are negative", l.OrgID)
+		}
+	}
+
+	if err := c.Redaction.Validate(); err != nil {
+		return err
+	}
+
 	if c.TraceTreeEnabled == nil {
 		value := configdefaults.FLOG_LOG_TRACE_TREE_ENABLED_DEFAULT
 		c.TraceTreeEnabled = &value
@@ -86,6 +210,46 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func (c *RedactionConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	names := make(map[string]bool, len(c.Rules))
+	for _, r := range c.Rules {
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("flow-log-redaction rule name '%s' is empty or duplicated", r.Name)
+		}
+		names[r.Name] = true
+		kinds := 0
+		if r.Regex != "" {
+			kinds++
+		}
+		if r.Detector != "" {
+			kinds++
+			switch r.Detector {
+			case RedactionDetectorEmail, RedactionDetectorJWT, RedactionDetectorPAN, RedactionDetectorPhone:
+			default:
+				return fmt.Errorf("flow-log-redaction rule %s: invalid detector '%s', support: email, jwt, pan, phone", r.Name, r.Detector)
+			}
+		}
+		if len(r.QueryKeys) > 0 {
+			kinds++
+		}
+		if r.SQLLiterals {
+			kinds++
+		}
+		if kinds != 1 {
+			return fmt.Errorf("flow-log-redaction rule %s: exactly one of regex, detector, query-keys and sql-literals should be set", r.Name)
+		}
+		for _, orgId := range r.OrgIDs {
+			if orgId > ckdb.MAX_ORG_ID {
+				return fmt.Errorf("flow-log-redaction rule %s: org-id %d is larger than %d", r.Name, orgId, ckdb.MAX_ORG_ID)
+			}
+		}
+	}
+	return nil
+}
+
 func Load(base *config.Config, path string) *Config {
 	config := &FlowLogConfig{
 		FlowLog: Config{
@@ -96,6 +260,18 @@ func Load(base *config.Config, path string) *Config {
 			DecoderQueueSize:  DefaultDecoderQueueSize,
 			CKWriterConfig:    config.CKWriterConfig{QueueCount: 2, QueueSize: 256000, BatchSize: 128000, FlushTimeout: 10},
 			FlowLogTTL:        FlowLogTTL{DefaultFlowLogTTL, DefaultFlowLogTTL, DefaultFlowLogTTL},
+			Geo:               GeoConfig{ReloadInterval: DefaultGeoReloadInterval},
+			OTLPReceiver: OTLPReceiverConfig{
+				GRPCPort:       DefaultOTLPGRPCPort,
+				HTTPPort:       DefaultOTLPHTTPPort,
+				MaxRequestSize: DefaultOTLPMaxRequestSize,
+				QueueHighWater: DefaultOTLPQueueHighWater,
+			},
+			LuaHook: LuaHookConfig{
+				TimeLimit:    DefaultLuaHookTimeLimit,
+				MemoryLimit:  DefaultLuaHookMemoryLimit,
+				SyncInterval: DefaultLuaHookSyncInterval,
+			},
 		},
 	}
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -68,10 +68,10 @@ type TraceTreeWriter struct {
 	writerConfig      baseconfig.CKWriterConfig
 
 	traceWriter    *ckwriter.CKWriter
-	traceTreeQueue queue.QueueReader
+	traceTreeQueue queue.TypedQueueReader[*tracetree.TraceTree]
 }
 
-func NewTraceTreeWriter(config *config.Config, traceTreeQueue queue.QueueReader) (*TraceTreeWriter, error) {
+func NewTraceTreeWriter(config *config.Config, traceTreeQueue queue.TypedQueueReader[*tracetree.TraceTree]) (*TraceTreeWriter, error) {
 	if !*config.TraceTreeEnabled {
 		return nil, nil
 	}
@@ -111,19 +111,14 @@ func (s *TraceTreeWriter) Start() {
 func (s *TraceTreeWriter) run() {
 	log.Infof("flow log trace tree writer starting")
 	s.traceWriter.Run()
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*tracetree.TraceTree, BUFFER_SIZE)
 	for {
 		n := s.traceTreeQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
 			if buffer[i] == nil {
 				continue
 			}
-			traceTree, ok := buffer[i].(*tracetree.TraceTree)
-			if !ok {
-				log.Warning("trace tree wrong type")
-				continue
-			}
-			s.traceWriter.Put(traceTree)
+			s.traceWriter.Put(buffer[i])
 		}
 	}
 }
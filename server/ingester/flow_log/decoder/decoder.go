@@ -21,6 +21,7 @@ import (
 	"compress/zlib"
 	"io"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -37,14 +38,18 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data/dd_import"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data/sw_import"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/lua_hook"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/redaction"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/throttler"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
 	"github.com/deepflowio/deepflow/server/libs/codec"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/datatype/pb"
 	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -74,23 +79,43 @@ type Counter struct {
 	ErrorCount       int64 `statsd:"err-count"`
 	Count            int64 `statsd:"count"`
 	DropCount        int64 `statsd:"drop-count"`
+	OutCount         int64 `statsd:"out-count"`
+	QuotaDropCount   int64 `statsd:"quota-drop-count"` // messages dropped by the rows-per-day quotas
 
 	TotalTime int64 `statsd:"total-time"`
 	AvgTime   int64 `statsd:"avg-time"`
 }
 
+// OrgDropCounter counts the flow logs dropped by the throttler of each org, the trace completeness
+// api of querier reads the drops of its own org by the org_id tag
+type OrgDropCounter struct {
+	DropCount int64 `statsd:"drop-count"`
+}
+
+type orgDrops struct {
+	counter *OrgDropCounter
+	utils.Closable
+}
+
+func (o *orgDrops) GetCounter() interface{} {
+	return &OrgDropCounter{DropCount: atomic.SwapInt64(&o.counter.DropCount, 0)}
+}
+
 type Decoder struct {
 	index               int
 	msgType             datatype.MessageType
 	dataSourceID        uint32
 	platformData        *grpc.PlatformInfoTable
-	inQueue             queue.QueueReader
+	inQueue             queue.TypedQueueReader[*receiver.RecvBuffer]
 	throttler           *throttler.ThrottlingQueue
 	flowTagWriter       *flow_tag.FlowTagWriter
 	appServiceTagWriter *flow_tag.AppServiceTagWriter
 	spanWriter          *dbwriter.SpanWriter
 	spanBuf             []interface{}
 	exporters           *exporters.Exporters
+	luaHook             *lua_hook.Hook
+	redactor            *redaction.Redactor
+	quotaRows           *quota.RowCounter
 	cfg                 *config.Config
 	debugEnabled        bool
 
@@ -100,13 +125,14 @@ type Decoder struct {
 	fieldValuesBuf []interface{}
 	counter        *Counter
 	lastCounter    Counter // for OTLP debug
+	orgDrops       [ckdb.MAX_ORG_ID + 1]*orgDrops
 	utils.Closable
 }
 
 func NewDecoder(
 	index int, msgType datatype.MessageType,
 	platformData *grpc.PlatformInfoTable,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	throttler *throttler.ThrottlingQueue,
 	flowTagWriter *flow_tag.FlowTagWriter,
 	appServiceTagWriter *flow_tag.AppServiceTagWriter,
@@ -134,6 +160,33 @@ func NewDecoder(
 	}
 }
 
+// SetLuaHook runs the Lua scripts on each l7_flow_log before it is sent to the throttler
+func (d *Decoder) SetLuaHook(hook *lua_hook.Hook) {
+	d.luaHook = hook
+}
+
+// SetRedactor masks the sensitive data of each l7_flow_log before it is stored or exported
+func (d *Decoder) SetRedactor(redactor *redaction.Redactor) {
+	d.redactor = redactor
+}
+
+// SetQuota enables the rows-per-day quotas of flow_log
+func (d *Decoder) SetQuota(m *quota.Manager) {
+	d.quotaRows = m.NewRowCounter(quota.FLOW_LOG)
+}
+
+// transform returns false if the flow log is dropped by the Lua scripts, otherwise the
+// flow log is redacted after the scripts, so the exporters only see the redacted values
+func (d *Decoder) transform(l *log_data.L7FlowLog) bool {
+	if d.luaHook != nil && !d.luaHook.Process(l) {
+		return false
+	}
+	if d.redactor != nil {
+		d.redactor.Redact(l)
+	}
+	return true
+}
+
 func (d *Decoder) GetCounter() interface{} {
 	var counter *Counter
 	counter, d.counter = d.counter, &Counter{}
@@ -152,7 +205,7 @@ func (d *Decoder) Run() {
 	common.RegisterCountableForIngester("decoder", d, stats.OptionStatTags{
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": d.msgType.String()})
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	decoder := &codec.SimpleDecoder{}
 	pbTaggedFlow := pb.NewTaggedFlow()
 	pbTracesData := &v1.TracesData{}
@@ -166,14 +219,15 @@ func (d *Decoder) Run() {
 				continue
 			}
 			d.counter.RawCount++
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("get decode queue data type wrong")
-				continue
-			}
+			recvBytes := buffer[i]
 
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 			d.agentId, d.orgId, d.teamId = recvBytes.VtapID, uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
+			if !d.quotaRows.Begin(d.orgId, recvBytes.TeamID) {
+				d.counter.QuotaDropCount++
+				receiver.ReleaseRecvBuffer(recvBytes)
+				continue
+			}
 			switch d.msgType {
 			case datatype.MESSAGE_TYPE_PROTOCOLLOG:
 				d.handleProtoLog(decoder)
@@ -193,6 +247,7 @@ func (d *Decoder) Run() {
 				log.Warningf("unknown msg type: %d", d.msgType)
 
 			}
+			d.quotaRows.End()
 			receiver.ReleaseRecvBuffer(recvBytes)
 		}
 		d.counter.TotalTime += int64(time.Since(start))
@@ -273,10 +328,15 @@ func (d *Decoder) sendOpenMetetry(tracesData *v1.TracesData) {
 	d.counter.Count++
 	ls := log_data.OTelTracesDataToL7FlowLogs(d.agentId, d.orgId, d.teamId, tracesData, d.platformData, d.cfg)
 	for _, l := range ls {
+		if !d.transform(l) {
+			l.Release()
+			continue
+		}
 		l.AddReferenceCount()
 		if !d.throttler.SendWithThrottling(l) {
-			d.counter.DropCount++
+			d.addDropCount()
 		} else {
+			d.addOutCount()
 			d.fieldsBuf, d.fieldValuesBuf = d.fieldsBuf[:0], d.fieldValuesBuf[:0]
 			l.GenerateNewFlowTags(d.flowTagWriter.Cache)
 			d.flowTagWriter.WriteFieldsAndFieldValuesInCache()
@@ -322,10 +382,15 @@ func (d *Decoder) sendSkyWalking(segmentData, peerIP []byte, uri string) {
 	d.counter.Count++
 	ls := sw_import.SkyWalkingDataToL7FlowLogs(d.agentId, d.orgId, d.teamId, segmentData, peerIP, uri, d.platformData, d.cfg)
 	for _, l := range ls {
+		if !d.transform(l) {
+			l.Release()
+			continue
+		}
 		l.AddReferenceCount()
 		if !d.throttler.SendWithThrottling(l) {
-			d.counter.DropCount++
+			d.addDropCount()
 		} else {
+			d.addOutCount()
 			d.fieldsBuf, d.fieldValuesBuf = d.fieldsBuf[:0], d.fieldValuesBuf[:0]
 			l.GenerateNewFlowTags(d.flowTagWriter.Cache)
 			d.flowTagWriter.WriteFieldsAndFieldValuesInCache()
@@ -371,10 +436,15 @@ func (d *Decoder) sendDatadog(ddogData *pb.ThirdPartyTrace) {
 	d.counter.Count++
 	ls := dd_import.DDogDataToL7FlowLogs(d.agentId, d.orgId, d.teamId, ddogData, d.platformData, d.cfg)
 	for _, l := range ls {
+		if !d.transform(l) {
+			l.Release()
+			continue
+		}
 		l.AddReferenceCount()
 		if !d.throttler.SendWithThrottling(l) {
-			d.counter.DropCount++
+			d.addDropCount()
 		} else {
+			d.addOutCount()
 			d.fieldsBuf, d.fieldValuesBuf = d.fieldsBuf[:0], d.fieldValuesBuf[:0]
 			l.GenerateNewFlowTags(d.flowTagWriter.Cache)
 			d.flowTagWriter.WriteFieldsAndFieldValuesInCache()
@@ -401,6 +471,7 @@ func (d *Decoder) handleL4Packet(decoder *codec.SimpleDecoder) {
 			log.Debugf("decoder %d vtap %d recv l4 packet: %s", d.index, d.agentId, l4Packet)
 		}
 		d.counter.Count++
+		d.addOutCount()
 		d.throttler.SendWithoutThrottling(l4Packet)
 	}
 }
@@ -413,19 +484,45 @@ func (d *Decoder) sendFlow(flow *pb.TaggedFlow) {
 	l := log_data.TaggedFlowToL4FlowLog(d.orgId, d.teamId, flow, d.platformData)
 
 	if l.HitPcapPolicy() {
+		d.addOutCount()
 		d.export(l)
 		d.throttler.SendWithoutThrottling(l)
 	} else {
 		l.AddReferenceCount()
 		if !d.throttler.SendWithThrottling(l) {
-			d.counter.DropCount++
+			d.addDropCount()
 		} else {
+			d.addOutCount()
 			d.export(l)
 		}
 		l.Release()
 	}
 }
 
+// addDropCount counts a flow log dropped by the throttler, in total and by org
+func (d *Decoder) addDropCount() {
+	d.counter.DropCount++
+	if int(d.orgId) > ckdb.MAX_ORG_ID {
+		return
+	}
+	drops := d.orgDrops[d.orgId]
+	if drops == nil {
+		drops = &orgDrops{counter: &OrgDropCounter{}}
+		d.orgDrops[d.orgId] = drops
+		common.RegisterCountableForIngester("decoder_throttler", drops, stats.OptionStatTags{
+			"thread":   strconv.Itoa(d.index),
+			"msg_type": d.msgType.String(),
+			"org_id":   strconv.Itoa(int(d.orgId))})
+	}
+	atomic.AddInt64(&drops.counter.DropCount, 1)
+}
+
+// addOutCount counts a flow log sent to the writer
+func (d *Decoder) addOutCount() {
+	d.counter.OutCount++
+	d.quotaRows.Add(1)
+}
+
 func (d *Decoder) export(l exportcommon.ExportItem) {
 	if d.exporters != nil {
 		d.exporters.Put(d.dataSourceID, d.index, l)
@@ -477,9 +574,15 @@ func (d *Decoder) sendProto(proto *pb.AppProtoLogsData) {
 	}
 
 	l := log_data.ProtoLogToL7FlowLog(d.orgId, d.teamId, proto, d.platformData, d.cfg)
+	if !d.transform(l) {
+		l.Release()
+		proto.Release()
+		return
+	}
 	l.AddReferenceCount()
 	sent := d.throttler.SendWithThrottling(l)
 	if sent {
+		d.addOutCount()
 		if d.flowTagWriter != nil {
 			d.fieldsBuf, d.fieldValuesBuf = d.fieldsBuf[:0], d.fieldValuesBuf[:0]
 			l.GenerateNewFlowTags(d.flowTagWriter.Cache)
@@ -499,7 +602,7 @@ func (d *Decoder) updateCounter(l7Protocol datatype.L7Protocol, dropped bool) {
 	d.counter.Count++
 	drop := int64(0)
 	if dropped {
-		d.counter.DropCount++
+		d.addDropCount()
 		drop = 1
 	}
 	switch l7Protocol {
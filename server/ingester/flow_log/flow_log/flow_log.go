@@ -33,6 +33,9 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/dbwriter"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/decoder"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/geo"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/lua_hook"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/otlp_receiver"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/redaction"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/throttler"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
@@ -43,10 +46,14 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
+	"github.com/deepflowio/deepflow/server/libs/tracetree"
 )
 
 var log = logging.MustGetLogger("flow_log")
 
+// the decoders flush the throttlers at the interval even if there is no data
+const DECODE_QUEUE_FLUSH_INTERVAL = 3 * time.Second
+
 type FlowLog struct {
 	FlowLogConfig        *config.Config
 	L4FlowLogger         *Logger
@@ -56,19 +63,23 @@ type FlowLog struct {
 	L4PacketLogger       *Logger
 	SkyWalkingLogger     *Logger
 	DdogLogger           *Logger
+	OTLPReceiver         *otlp_receiver.Receiver
 	Exporters            *exporters.Exporters
 	SpanWriter           *dbwriter.SpanWriter
 	TraceTreeWriter      *dbwriter.TraceTreeWriter
+	LuaHookManager       *lua_hook.Manager
+	Redactor             *redaction.Redactor
 }
 
 type Logger struct {
 	Config        *config.Config
+	DecodeQueues  *dropletqueue.TypedMultiQueue[*receiver.RecvBuffer]
 	Decoders      []*decoder.Decoder
 	PlatformDatas []*grpc.PlatformInfoTable
 	FlowLogWriter *dbwriter.FlowLogWriter
 }
 
-func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*FlowLog, error) {
+func NewFlowLog(config *config.Config, traceTreeQueue queue.TypedQueueReader[*tracetree.TraceTree], recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*FlowLog, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_FLOW_LOG_QUEUE)
 
 	if config.Base.StorageDisabled {
@@ -76,13 +87,22 @@ func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, rec
 		if err != nil {
 			return nil, err
 		}
+		redactor, err := newRedactor(config, []*Logger{l7FlowLogger})
+		if err != nil {
+			return nil, err
+		}
 		return &FlowLog{
-			L7FlowLogger: l7FlowLogger,
-			Exporters:    exporters,
+			L7FlowLogger:   l7FlowLogger,
+			Exporters:      exporters,
+			LuaHookManager: newLuaHookManager(config, map[string]*Logger{"l7_flow_log": l7FlowLogger}),
+			Redactor:       redactor,
 		}, nil
 	}
 
 	geo.NewGeoTree()
+	if err := geo.NewGeoProvider(&config.Geo); err != nil {
+		log.Errorf("load geo mmdb failed, geo location of flow logs is disabled: %s", err)
+	}
 
 	flowLogWriter, err := dbwriter.NewFlowLogWriter(
 		*config.Base.CKDB.ActualAddrs, config.Base.CKDBAuth.Username, config.Base.CKDBAuth.Password,
@@ -128,6 +148,14 @@ func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, rec
 	if err != nil {
 		return nil, err
 	}
+	redactor, err := newRedactor(config, []*Logger{l7FlowLogger, otelLogger, otelCompressedLogger, skywalkingLogger, ddogLogger})
+	if err != nil {
+		return nil, err
+	}
+	var otlpReceiver *otlp_receiver.Receiver
+	if config.OTLPReceiver.Enabled {
+		otlpReceiver = otlp_receiver.NewReceiver(config, otelLogger.DecodeQueues)
+	}
 	return &FlowLog{
 		FlowLogConfig:        config,
 		L4FlowLogger:         l4FlowLogger,
@@ -137,21 +165,62 @@ func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, rec
 		L4PacketLogger:       l4PacketLogger,
 		SkyWalkingLogger:     skywalkingLogger,
 		DdogLogger:           ddogLogger,
+		OTLPReceiver:         otlpReceiver,
 		Exporters:            exporters,
 		SpanWriter:           spanWriter,
 		TraceTreeWriter:      traceTreeWriter,
+		LuaHookManager: newLuaHookManager(config, map[string]*Logger{
+			"l7_flow_log":              l7FlowLogger,
+			"opentelemetry":            otelLogger,
+			"opentelemetry_compressed": otelCompressedLogger,
+			"skywalking":               skywalkingLogger,
+			"datadog":                  ddogLogger,
+		}),
+		Redactor: redactor,
 	}, nil
 }
 
+// newLuaHookManager sets a Lua hook to each decoder of the loggers of l7_flow_log
+func newLuaHookManager(config *config.Config, loggers map[string]*Logger) *lua_hook.Manager {
+	if !config.LuaHook.Enabled {
+		return nil
+	}
+	manager := lua_hook.NewManager(config)
+	for name, logger := range loggers {
+		for i, d := range logger.Decoders {
+			d.SetLuaHook(manager.NewHook(name + "-" + strconv.Itoa(i)))
+		}
+	}
+	return manager
+}
+
+// newRedactor sets the shared redactor to each decoder of the loggers of l7_flow_log
+func newRedactor(config *config.Config, loggers []*Logger) (*redaction.Redactor, error) {
+	if !config.Redaction.Enabled || len(config.Redaction.Rules) == 0 {
+		return nil, nil
+	}
+	redactor, err := redaction.NewRedactor(&config.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	for _, logger := range loggers {
+		for _, d := range logger.Decoders {
+			d.SetRedactor(redactor)
+		}
+	}
+	return redactor, nil
+}
+
 func NewLogger(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, flowLogWriter *dbwriter.FlowLogWriter, flowLogId common.FlowLogID, exporters *exporters.Exporters, spanWriter *dbwriter.SpanWriter) (*Logger, error) {
 	queueCount := config.DecoderQueueCount
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+datatype.MessageTypeString[msgType],
 		config.DecoderQueueSize,
 		queueCount,
 		1,
-		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		libqueue.OptionFlushIndicator(DECODE_QUEUE_FLUSH_INTERVAL),
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 	throttle := config.Throttle / queueCount
 
@@ -183,7 +252,7 @@ func NewLogger(msgType datatype.MessageType, config *config.Config, platformData
 			i,
 			msgType,
 			platformDatas[i],
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			throttlers[i],
 			flowTagWriter,
 			appServiceTagWriter,
@@ -191,9 +260,11 @@ func NewLogger(msgType datatype.MessageType, config *config.Config, platformData
 			exporters,
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 	}
 	return &Logger{
 		Config:        config,
+		DecodeQueues:  decodeQueues,
 		Decoders:      decoders,
 		PlatformDatas: platformDatas,
 		FlowLogWriter: flowLogWriter,
@@ -204,13 +275,14 @@ func NewL4FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 	msgType := datatype.MESSAGE_TYPE_TAGGEDFLOW
 	queueCount := config.DecoderQueueCount
 	queueSuffix := "-l4"
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode"+queueSuffix,
 		config.DecoderQueueSize,
 		queueCount,
 		1,
-		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		libqueue.OptionFlushIndicator(DECODE_QUEUE_FLUSH_INTERVAL),
+		receiver.ReleaseRecvBuffer)
 
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
@@ -238,12 +310,13 @@ func NewL4FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 			i,
 			msgType,
 			platformDatas[i],
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			throttlers[i],
 			nil, nil, nil,
 			exporters,
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 	}
 	return &Logger{
 		Config:        config,
@@ -258,13 +331,14 @@ func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 	queueCount := config.DecoderQueueCount
 	msgType := datatype.MESSAGE_TYPE_PROTOCOLLOG
 
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode"+queueSuffix,
 		config.DecoderQueueSize,
 		queueCount,
 		1,
-		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		libqueue.OptionFlushIndicator(DECODE_QUEUE_FLUSH_INTERVAL),
+		receiver.ReleaseRecvBuffer)
 
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
@@ -305,7 +379,7 @@ func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 			i,
 			msgType,
 			platformDatas[i],
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			throttlers[i],
 			flowTagWriter,
 			appServiceTagWriter,
@@ -313,6 +387,7 @@ func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 			exporters,
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 	}
 
 	l := &Logger{
@@ -374,15 +449,24 @@ func (s *FlowLog) Start() {
 	if s.DdogLogger != nil {
 		s.DdogLogger.Start()
 	}
+	if s.OTLPReceiver != nil {
+		s.OTLPReceiver.Start()
+	}
 	if s.SpanWriter != nil {
 		s.SpanWriter.Start()
 	}
 	if s.TraceTreeWriter != nil {
 		s.TraceTreeWriter.Start()
 	}
+	if s.LuaHookManager != nil {
+		s.LuaHookManager.Start()
+	}
 }
 
 func (s *FlowLog) Close() error {
+	if s.OTLPReceiver != nil {
+		s.OTLPReceiver.Close()
+	}
 	if s.L4FlowLogger != nil {
 		s.L4FlowLogger.Close()
 	}
@@ -410,5 +494,11 @@ func (s *FlowLog) Close() error {
 	if s.TraceTreeWriter != nil {
 		s.TraceTreeWriter.Close()
 	}
+	if s.LuaHookManager != nil {
+		s.LuaHookManager.Close()
+	}
+	if s.Redactor != nil {
+		s.Redactor.Close()
+	}
 	return nil
 }
@@ -17,15 +17,59 @@
 package geo
 
 import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
 	"github.com/deepflowio/deepflow/server/libs/geo"
 )
 
 var geoTree geo.GeoTree
+var geoProvider geo.GeoProvider
 
 func NewGeoTree() {
 	geoTree = geo.NewNetmaskGeoTree()
 }
 
+// NewGeoProvider loads the MaxMind DB files if configured, otherwise geo location lookups always miss.
+func NewGeoProvider(cfg *config.GeoConfig) error {
+	if cfg.MMDBCityFile == "" && cfg.MMDBASNFile == "" {
+		return nil
+	}
+	provider, err := geo.NewMMDBProvider(geo.MMDBConfig{
+		CityFile:       cfg.MMDBCityFile,
+		ASNFile:        cfg.MMDBASNFile,
+		Language:       cfg.Language,
+		ReloadInterval: time.Duration(cfg.ReloadInterval) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	SetGeoProvider(provider)
+	return nil
+}
+
+func SetGeoProvider(provider geo.GeoProvider) {
+	geoProvider = provider
+}
+
+func GeoProviderEnabled() bool {
+	return geoProvider != nil
+}
+
+func QueryLocation(isIPv4 bool, ip4 uint32, ip6 net.IP, loc *geo.Location) bool {
+	if geoProvider == nil {
+		return false
+	}
+	if isIPv4 {
+		var ip [net.IPv4len]byte
+		binary.BigEndian.PutUint32(ip[:], ip4)
+		return geoProvider.Lookup(ip[:], loc)
+	}
+	return geoProvider.Lookup(ip6, loc)
+}
+
 func QueryProvince(ip uint32) string {
 	region, _ := geoTree.Query(ip)
 	return geo.DecodeRegion(region)
@@ -275,6 +275,74 @@ func (n *Internet) AppendToColumnBlock(b ckdb.CKColumnBlock) {
 	block.ColProvince1.Append(n.Province1)
 }
 
+type GeoLocationBlock struct {
+	ColGeoCountry0 *proto.ColLowCardinality[string]
+	ColGeoCountry1 *proto.ColLowCardinality[string]
+	ColGeoRegion0  *proto.ColLowCardinality[string]
+	ColGeoRegion1  *proto.ColLowCardinality[string]
+	ColGeoCity0    *proto.ColLowCardinality[string]
+	ColGeoCity1    *proto.ColLowCardinality[string]
+	ColGeoAsn0     proto.ColUInt32
+	ColGeoAsn1     proto.ColUInt32
+	ColGeoAsOrg0   *proto.ColLowCardinality[string]
+	ColGeoAsOrg1   *proto.ColLowCardinality[string]
+}
+
+func (b *GeoLocationBlock) Reset() {
+	b.ColGeoCountry0.Reset()
+	b.ColGeoCountry1.Reset()
+	b.ColGeoRegion0.Reset()
+	b.ColGeoRegion1.Reset()
+	b.ColGeoCity0.Reset()
+	b.ColGeoCity1.Reset()
+	b.ColGeoAsn0.Reset()
+	b.ColGeoAsn1.Reset()
+	b.ColGeoAsOrg0.Reset()
+	b.ColGeoAsOrg1.Reset()
+}
+
+func (b *GeoLocationBlock) ToInput(input proto.Input) proto.Input {
+	return append(input,
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_COUNTRY_0, Data: b.ColGeoCountry0},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_COUNTRY_1, Data: b.ColGeoCountry1},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_REGION_0, Data: b.ColGeoRegion0},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_REGION_1, Data: b.ColGeoRegion1},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_CITY_0, Data: b.ColGeoCity0},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_CITY_1, Data: b.ColGeoCity1},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_ASN_0, Data: &b.ColGeoAsn0},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_ASN_1, Data: &b.ColGeoAsn1},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_AS_ORG_0, Data: b.ColGeoAsOrg0},
+		proto.InputColumn{Name: ckdb.COLUMN_GEO_AS_ORG_1, Data: b.ColGeoAsOrg1},
+	)
+}
+
+func (n *GeoLocation) NewColumnBlock() ckdb.CKColumnBlock {
+	return &GeoLocationBlock{
+		ColGeoCountry0: new(proto.ColStr).LowCardinality(),
+		ColGeoCountry1: new(proto.ColStr).LowCardinality(),
+		ColGeoRegion0:  new(proto.ColStr).LowCardinality(),
+		ColGeoRegion1:  new(proto.ColStr).LowCardinality(),
+		ColGeoCity0:    new(proto.ColStr).LowCardinality(),
+		ColGeoCity1:    new(proto.ColStr).LowCardinality(),
+		ColGeoAsOrg0:   new(proto.ColStr).LowCardinality(),
+		ColGeoAsOrg1:   new(proto.ColStr).LowCardinality(),
+	}
+}
+
+func (n *GeoLocation) AppendToColumnBlock(b ckdb.CKColumnBlock) {
+	block := b.(*GeoLocationBlock)
+	block.ColGeoCountry0.Append(n.GeoCountry0)
+	block.ColGeoCountry1.Append(n.GeoCountry1)
+	block.ColGeoRegion0.Append(n.GeoRegion0)
+	block.ColGeoRegion1.Append(n.GeoRegion1)
+	block.ColGeoCity0.Append(n.GeoCity0)
+	block.ColGeoCity1.Append(n.GeoCity1)
+	block.ColGeoAsn0.Append(n.GeoASN0)
+	block.ColGeoAsn1.Append(n.GeoASN1)
+	block.ColGeoAsOrg0.Append(n.GeoASOrg0)
+	block.ColGeoAsOrg1.Append(n.GeoASOrg1)
+}
+
 type KnowledgeGraphBlock struct {
 	ColRegionId0         proto.ColUInt16
 	ColRegionId1         proto.ColUInt16
@@ -802,6 +870,7 @@ type L4FlowLogBlock struct {
 	*TransportLayerBlock
 	*ApplicationLayerBlock
 	*InternetBlock
+	*GeoLocationBlock
 	*KnowledgeGraphBlock
 	*FlowInfoBlock
 	*MetricsBlock
@@ -814,6 +883,7 @@ func (b *L4FlowLogBlock) Reset() {
 	b.TransportLayerBlock.Reset()
 	b.ApplicationLayerBlock.Reset()
 	b.InternetBlock.Reset()
+	b.GeoLocationBlock.Reset()
 	b.KnowledgeGraphBlock.Reset()
 	b.FlowInfoBlock.Reset()
 	b.MetricsBlock.Reset()
@@ -826,6 +896,7 @@ func (b *L4FlowLogBlock) ToInput(input proto.Input) proto.Input {
 	input = b.TransportLayerBlock.ToInput(input)
 	input = b.ApplicationLayerBlock.ToInput(input)
 	input = b.InternetBlock.ToInput(input)
+	input = b.GeoLocationBlock.ToInput(input)
 	input = b.KnowledgeGraphBlock.ToInput(input)
 	input = b.FlowInfoBlock.ToInput(input)
 	input = b.MetricsBlock.ToInput(input)
@@ -839,6 +910,7 @@ func (n *L4FlowLog) NewColumnBlock() ckdb.CKColumnBlock {
 		TransportLayerBlock:   n.TransportLayer.NewColumnBlock().(*TransportLayerBlock),
 		ApplicationLayerBlock: n.ApplicationLayer.NewColumnBlock().(*ApplicationLayerBlock),
 		InternetBlock:         n.Internet.NewColumnBlock().(*InternetBlock),
+		GeoLocationBlock:      n.GeoLocation.NewColumnBlock().(*GeoLocationBlock),
 		KnowledgeGraphBlock:   n.KnowledgeGraph.NewColumnBlock().(*KnowledgeGraphBlock),
 		FlowInfoBlock:         n.FlowInfo.NewColumnBlock().(*FlowInfoBlock),
 		MetricsBlock:          n.Metrics.NewColumnBlock().(*MetricsBlock),
@@ -853,6 +925,7 @@ func (f *L4FlowLog) AppendToColumnBlock(b ckdb.CKColumnBlock) {
 	f.TransportLayer.AppendToColumnBlock(block.TransportLayerBlock)
 	f.ApplicationLayer.AppendToColumnBlock(block.ApplicationLayerBlock)
 	f.Internet.AppendToColumnBlock(block.InternetBlock)
+	f.GeoLocation.AppendToColumnBlock(block.GeoLocationBlock)
 	f.KnowledgeGraph.AppendToColumnBlock(block.KnowledgeGraphBlock)
 	f.FlowInfo.AppendToColumnBlock(block.FlowInfoBlock)
 	f.Metrics.AppendToColumnBlock(block.MetricsBlock)
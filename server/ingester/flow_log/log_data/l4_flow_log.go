@@ -33,6 +33,7 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/datatype/pb"
 	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
+	libgeo "github.com/deepflowio/deepflow/server/libs/geo"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/pool"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -51,6 +52,7 @@ type L4FlowLog struct {
 	TransportLayer
 	ApplicationLayer
 	Internet
+	GeoLocation
 	KnowledgeGraph
 	FlowInfo
 	Metrics
@@ -174,6 +176,33 @@ var InternetColumns = []*ckdb.Column{
 	ckdb.NewColumn("province_1", ckdb.LowCardinalityString),
 }
 
+// GeoLocation is looked up from the geo mmdb files, only for Internet IPs
+type GeoLocation struct {
+	GeoCountry0 string `json:"geo_country_0" category:"$tag" sub:"network_layer"`
+	GeoCountry1 string `json:"geo_country_1" category:"$tag" sub:"network_layer"`
+	GeoRegion0  string `json:"geo_region_0" category:"$tag" sub:"network_layer"`
+	GeoRegion1  string `json:"geo_region_1" category:"$tag" sub:"network_layer"`
+	GeoCity0    string `json:"geo_city_0" category:"$tag" sub:"network_layer"`
+	GeoCity1    string `json:"geo_city_1" category:"$tag" sub:"network_layer"`
+	GeoASN0     uint32 `json:"geo_asn_0" category:"$tag" sub:"network_layer"`
+	GeoASN1     uint32 `json:"geo_asn_1" category:"$tag" sub:"network_layer"`
+	GeoASOrg0   string `json:"geo_as_org_0" category:"$tag" sub:"network_layer"`
+	GeoASOrg1   string `json:"geo_as_org_1" category:"$tag" sub:"network_layer"`
+}
+
+var GeoLocationColumns = []*ckdb.Column{
+	ckdb.NewColumn("geo_country_0", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_country_1", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_region_0", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_region_1", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_city_0", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_city_1", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_asn_0", ckdb.UInt32).SetIndex(ckdb.IndexNone),
+	ckdb.NewColumn("geo_asn_1", ckdb.UInt32).SetIndex(ckdb.IndexNone),
+	ckdb.NewColumn("geo_as_org_0", ckdb.LowCardinalityString),
+	ckdb.NewColumn("geo_as_org_1", ckdb.LowCardinalityString),
+}
+
 type KnowledgeGraph struct {
 	RegionID0     uint16 `json:"region_id_0" category:"$tag" sub:"universal_tag"`
 	RegionID1     uint16 `json:"region_id_1" category:"$tag" sub:"universal_tag"`
@@ -533,6 +562,21 @@ func (i *Internet) Fill(f *pb.Flow) {
 	i.Province1 = geo.QueryProvince(f.FlowKey.IpDst)
 }
 
+// Fill should be called after KnowledgeGraph is filled, only Internet IPs are looked up.
+func (i *GeoLocation) Fill(isIPv4 bool, ip40, ip41 uint32, ip60, ip61 net.IP, l3EpcID0, l3EpcID1 int32) {
+	if !geo.GeoProviderEnabled() {
+		return
+	}
+	var loc libgeo.Location
+	if l3EpcID0 == datatype.EPC_FROM_INTERNET && geo.QueryLocation(isIPv4, ip40, ip60, &loc) {
+		i.GeoCountry0, i.GeoRegion0, i.GeoCity0, i.GeoASN0, i.GeoASOrg0 = loc.Country, loc.Region, loc.City, loc.ASN, loc.ASOrg
+	}
+	loc = libgeo.Location{}
+	if l3EpcID1 == datatype.EPC_FROM_INTERNET && geo.QueryLocation(isIPv4, ip41, ip61, &loc) {
+		i.GeoCountry1, i.GeoRegion1, i.GeoCity1, i.GeoASN1, i.GeoASOrg1 = loc.Country, loc.Region, loc.City, loc.ASN, loc.ASOrg
+	}
+}
+
 func (k *KnowledgeGraph) fill(
 	platformData *grpc.PlatformInfoTable,
 	isIPv6, isVipInterface0, isVipInterface1 bool,
@@ -896,6 +940,7 @@ func L4FlowLogColumns() []*ckdb.Column {
 	columns = append(columns, TransportLayerColumns...)
 	columns = append(columns, ApplicationLayerColumns...)
 	columns = append(columns, InternetColumns...)
+	columns = append(columns, GeoLocationColumns...)
 	columns = append(columns, FlowInfoColumns...)
 	columns = append(columns, MetricsColumns...)
 	return columns
@@ -964,6 +1009,7 @@ func TaggedFlowToL4FlowLog(orgId, teamId uint16, f *pb.TaggedFlow, platformData
 	s.ApplicationLayer.Fill(f.Flow)
 	s.Internet.Fill(f.Flow)
 	s.KnowledgeGraph.FillL4(f.Flow, isIPV6, platformData)
+	s.GeoLocation.Fill(s.IsIPv4, s.IP40, s.IP41, s.IP60, s.IP61, s.L3EpcID0, s.L3EpcID1)
 	s.FlowInfo.Fill(f.Flow)
 	s.Metrics.Fill(f.Flow)
 
@@ -211,6 +211,7 @@ func (n *L7Base) AppendToColumnBlock(b ckdb.CKColumnBlock) {
 
 type L7FlowLogBlock struct {
 	*L7BaseBlock
+	*GeoLocationBlock
 	ColId                   proto.ColUInt64
 	ColL7Protocol           proto.ColUInt8
 	ColBizProtocol          *proto.ColLowCardinality[string]
@@ -256,6 +257,7 @@ type L7FlowLogBlock struct {
 
 func (b *L7FlowLogBlock) Reset() {
 	b.L7BaseBlock.Reset()
+	b.GeoLocationBlock.Reset()
 	b.ColId.Reset()
 	b.ColL7Protocol.Reset()
 	b.ColBizProtocol.Reset()
@@ -303,6 +305,7 @@ func (b *L7FlowLogBlock) Reset() {
 
 func (b *L7FlowLogBlock) ToInput(input proto.Input) proto.Input {
 	input = b.L7BaseBlock.ToInput(input)
+	input = b.GeoLocationBlock.ToInput(input)
 	input = append(input,
 		proto.InputColumn{Name: ckdb.COLUMN__ID, Data: &b.ColId},
 		proto.InputColumn{Name: ckdb.COLUMN_L7_PROTOCOL, Data: &b.ColL7Protocol},
@@ -354,6 +357,7 @@ func (b *L7FlowLogBlock) ToInput(input proto.Input) proto.Input {
 func (n *L7FlowLog) NewColumnBlock() ckdb.CKColumnBlock {
 	return &L7FlowLogBlock{
 		L7BaseBlock:        n.L7Base.NewColumnBlock().(*L7BaseBlock),
+		GeoLocationBlock:   n.GeoLocation.NewColumnBlock().(*GeoLocationBlock),
 		ColBizProtocol:     new(proto.ColStr).LowCardinality(),
 		ColVersion:         new(proto.ColStr).LowCardinality(),
 		ColRequestType:     new(proto.ColStr).LowCardinality(),
@@ -376,6 +380,7 @@ func (n *L7FlowLog) NewColumnBlock() ckdb.CKColumnBlock {
 func (n *L7FlowLog) AppendToColumnBlock(b ckdb.CKColumnBlock) {
 	block := b.(*L7FlowLogBlock)
 	n.L7Base.AppendToColumnBlock(block.L7BaseBlock)
+	n.GeoLocation.AppendToColumnBlock(block.GeoLocationBlock)
 	block.ColId.Append(n._id)
 	block.ColL7Protocol.Append(n.L7Protocol)
 	block.ColBizProtocol.Append(n.BizProtocol)
@@ -159,6 +159,7 @@ type L7FlowLog struct {
 	_id uint64 `json:"_id" category:"$tag" sub:"flow_info"`
 
 	L7Base
+	GeoLocation
 
 	L7Protocol  uint8  `json:"l7_protocol" category:"$tag" sub:"application_layer" enumfile:"l7_protocol"`
 	BizProtocol string `json:"biz_protocol" category:"$tag" sub:"application_layer"`
@@ -222,6 +223,7 @@ func L7FlowLogColumns() []*ckdb.Column {
 	l7Columns := []*ckdb.Column{}
 	l7Columns = append(l7Columns, ckdb.NewColumn("_id", ckdb.UInt64))
 	l7Columns = append(l7Columns, L7BaseColumns()...)
+	l7Columns = append(l7Columns, GeoLocationColumns...)
 	l7Columns = append(l7Columns,
 		ckdb.NewColumn("l7_protocol", ckdb.UInt8).SetIndex(ckdb.IndexNone).SetComment("0:未知 1:其他, 20:http1, 21:http2, 40:dubbo, 60:mysql, 80:redis, 100:kafka, 101:mqtt, 120:dns"),
 		ckdb.NewColumn("biz_protocol", ckdb.LowCardinalityString).SetIndex(ckdb.IndexNone).SetComment("应用协议"),
@@ -312,6 +314,7 @@ func ParseTraceIdIndex(traceId string, traceIdIndexCfg *config.TraceIdWithIndex)
 
 func (h *L7FlowLog) Fill(l *pb.AppProtoLogsData, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) {
 	h.L7Base.Fill(l, platformData)
+	h.GeoLocation.Fill(h.IsIPv4, h.IP40, h.IP41, h.IP60, h.IP61, h.L3EpcID0, h.L3EpcID1)
 
 	h.Type = uint8(l.Base.Head.MsgType)
 	if l.Flags&uint32(pb.FlagBits_FLAG_TLS) != 0 {
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lua_hook
+
+import (
+	"sort"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+const (
+	FIELD_ATTRIBUTES = "attributes"
+)
+
+// the fields which can be modified by the scripts, named by the columns of flow_log.l7_flow_log
+var writableFields = []struct {
+	name string
+	ptr  func(l *log_data.L7FlowLog) *string
+}{
+	{"request_type", func(l *log_data.L7FlowLog) *string { return &l.RequestType }},
+	{"request_domain", func(l *log_data.L7FlowLog) *string { return &l.RequestDomain }},
+	{"request_resource", func(l *log_data.L7FlowLog) *string { return &l.RequestResource }},
+	{"endpoint", func(l *log_data.L7FlowLog) *string { return &l.Endpoint }},
+	{"response_exception", func(l *log_data.L7FlowLog) *string { return &l.ResponseException }},
+	{"response_result", func(l *log_data.L7FlowLog) *string { return &l.ResponseResult }},
+	{"app_service", func(l *log_data.L7FlowLog) *string { return &l.AppService }},
+	{"app_instance", func(l *log_data.L7FlowLog) *string { return &l.AppInstance }},
+	{"biz_protocol", func(l *log_data.L7FlowLog) *string { return &l.BizProtocol }},
+	{"http_proxy_client", func(l *log_data.L7FlowLog) *string { return &l.HttpProxyClient }},
+	{"x_request_id_0", func(l *log_data.L7FlowLog) *string { return &l.XRequestId0 }},
+	{"x_request_id_1", func(l *log_data.L7FlowLog) *string { return &l.XRequestId1 }},
+}
+
+// toTable converts the flow log to the argument of the script, the read-only fields
+// are copied as well but the changes on them are ignored
+func toTable(L *lua.LState, l *log_data.L7FlowLog) *lua.LTable {
+	t := L.CreateTable(0, len(writableFields)+16)
+	for _, f := range writableFields {
+		t.RawSetString(f.name, lua.LString(*f.ptr(l)))
+	}
+	t.RawSetString("time", lua.LNumber(l.Time))
+	t.RawSetString("org_id", lua.LNumber(l.OrgId))
+	t.RawSetString("team_id", lua.LNumber(l.TeamID))
+	t.RawSetString("agent_id", lua.LNumber(l.VtapID))
+	t.RawSetString("signal_source", lua.LNumber(l.SignalSource))
+	t.RawSetString("observation_point", lua.LString(l.TapSide))
+	t.RawSetString("server_port", lua.LNumber(l.ServerPort))
+	t.RawSetString("l7_protocol", lua.LNumber(l.L7Protocol))
+	t.RawSetString("l7_protocol_str", lua.LString(datatype.L7Protocol(l.L7Protocol).String(l.IsTLS == 1)))
+	t.RawSetString("version", lua.LString(l.Version))
+	t.RawSetString("type", lua.LNumber(l.Type))
+	t.RawSetString("response_status", lua.LNumber(l.ResponseStatus))
+	if l.ResponseCode != nil {
+		t.RawSetString("response_code", lua.LNumber(*l.ResponseCode))
+	}
+	t.RawSetString("response_duration", lua.LNumber(l.ResponseDuration))
+	t.RawSetString("trace_id", lua.LString(l.TraceId))
+	t.RawSetString("span_id", lua.LString(l.SpanId))
+
+	attributes := L.CreateTable(0, len(l.AttributeNames))
+	for i, name := range l.AttributeNames {
+		if i < len(l.AttributeValues) {
+			attributes.RawSetString(name, lua.LString(l.AttributeValues[i]))
+		}
+	}
+	t.RawSetString(FIELD_ATTRIBUTES, attributes)
+	return t
+}
+
+// applyTable writes back the changes of the writable fields and the attributes
+func applyTable(t *lua.LTable, l *log_data.L7FlowLog) {
+	for _, f := range writableFields {
+		// the value is set to empty if the field is removed by the script
+		v := lua.LVAsString(t.RawGetString(f.name))
+		if p := f.ptr(l); *p != v {
+			*p = v
+		}
+	}
+
+	attributes, ok := t.RawGetString(FIELD_ATTRIBUTES).(*lua.LTable)
+	if !ok {
+		return
+	}
+	changed := false
+	values := make(map[string]string, len(l.AttributeNames)+4)
+	attributes.ForEach(func(k, v lua.LValue) {
+		name, ok := k.(lua.LString)
+		if !ok || v == lua.LNil {
+			return
+		}
+		values[string(name)] = lua.LVAsString(v)
+	})
+	if len(values) != len(l.AttributeNames) {
+		changed = true
+	} else {
+		for i, name := range l.AttributeNames {
+			if v, ok := values[name]; !ok || i >= len(l.AttributeValues) || v != l.AttributeValues[i] {
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// keep the order of the existing attributes, and append the new ones in the order of names
+	names := make([]string, 0, len(values))
+	newValues := make([]string, 0, len(values))
+	for _, name := range l.AttributeNames {
+		if v, ok := values[name]; ok {
+			names = append(names, name)
+			newValues = append(newValues, v)
+			delete(values, name)
+		}
+	}
+	added := make([]string, 0, len(values))
+	for name := range values {
+		added = append(added, name)
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		names = append(names, name)
+		newValues = append(newValues, values[name])
+	}
+	l.AttributeNames, l.AttributeValues = names, newValues
+}
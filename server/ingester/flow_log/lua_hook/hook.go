@@ -0,0 +1,498 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lua_hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+const (
+	// the function called for each l7_flow_log, return false to drop it
+	HOOK_FUNCTION = "TransformL7FlowLog"
+
+	// a script is disabled for a while after failing consecutively
+	MAX_CONSECUTIVE_FAILURES = 100
+	DISABLE_DURATION         = time.Minute
+
+	// interval of updating the script stats for the debug command
+	STATS_INTERVAL = 10 * time.Second
+
+	CALL_STACK_SIZE   = 64
+	REGISTRY_SIZE     = 1024
+	REGISTRY_MAX_SIZE = 64 * 1024
+
+	// the memory held by a script is estimated after loading and every MEMORY_CHECK_INTERVAL executions
+	MEMORY_CHECK_INTERVAL = 1000
+	// approximate sizes of the values for estimating the memory
+	VALUE_SIZE    = 16
+	TABLE_SIZE    = 64
+	FUNCTION_SIZE = 64
+)
+
+type Counter struct {
+	ExecCount    int64 `statsd:"exec-count"`
+	DropCount    int64 `statsd:"drop-count"`
+	ErrorCount   int64 `statsd:"err-count"`
+	TimeoutCount int64 `statsd:"timeout-count"`
+	MemoryCount  int64 `statsd:"memory-exceeded-count"`
+	PanicCount   int64 `statsd:"panic-count"`
+	SkipCount    int64 `statsd:"skip-count"` // skipped because of being disabled or failing to load
+	TotalTime    int64 `statsd:"total-time"`
+	AvgTime      int64 `statsd:"avg-time"`
+}
+
+// ScriptStats is the accumulated statistics of a script in a decoder
+type ScriptStats struct {
+	Exec, Drop, Error, Timeout, MemoryExceeded, Panic, Skip int64
+	MemoryUsage                                             int
+	LastError                                               string
+	LastErrorTime                                           time.Time
+}
+
+type scriptLimit struct {
+	timeLimit   time.Duration
+	memoryLimit int // bytes
+}
+
+type script struct {
+	orgId      uint16
+	name       string
+	updateTime uint32
+	content    []byte
+	scriptLimit
+
+	L  *lua.LState
+	fn *lua.LFunction
+
+	consecutiveFailures int
+	disabledUntil       time.Time
+	stats               ScriptStats
+}
+
+func newLuaState(memoryLimit int) *lua.LState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   CALL_STACK_SIZE,
+		RegistrySize:    REGISTRY_SIZE,
+		RegistryMaxSize: REGISTRY_MAX_SIZE,
+	})
+	// no io, os or package for the scripts
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "collectgarbage"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// string.rep may allocate a huge string in one instruction, which is not stopped by the time limit
+	L.SetField(L.GetGlobal(lua.StringLibName), "rep", L.NewFunction(func(L *lua.LState) int {
+		str := L.CheckString(1)
+		n := L.CheckInt(2)
+		if n <= 0 || len(str) == 0 {
+			L.Push(lua.LString(""))
+			return 1
+		}
+		if n > memoryLimit/len(str) {
+			L.RaiseError("string.rep exceeds the memory limit of %d bytes", memoryLimit)
+			return 0
+		}
+		L.Push(lua.LString(strings.Repeat(str, n)))
+		return 1
+	}))
+	return L
+}
+
+// memoryUsage estimates the memory held by the script, which is the values reachable from
+// the globals and the upvalues of the functions. It stops walking once the limit is exceeded.
+func memoryUsage(L *lua.LState, limit int) int {
+	size := 0
+	visited := make(map[lua.LValue]struct{})
+	var walk func(v lua.LValue)
+	walk = func(v lua.LValue) {
+		if size > limit {
+			return
+		}
+		switch v := v.(type) {
+		case lua.LString:
+			size += len(v)
+		case *lua.LTable:
+			if _, ok := visited[v]; ok {
+				return
+			}
+			visited[v] = struct{}{}
+			size += TABLE_SIZE
+			v.ForEach(func(key, value lua.LValue) {
+				size += 2 * VALUE_SIZE
+				walk(key)
+				walk(value)
+			})
+			walk(v.Metatable)
+		case *lua.LFunction:
+			if _, ok := visited[v]; ok {
+				return
+			}
+			visited[v] = struct{}{}
+			size += FUNCTION_SIZE
+			for _, upvalue := range v.Upvalues {
+				walk(upvalue.Value())
+			}
+		}
+	}
+	walk(L.G.Global)
+	return size
+}
+
+// checkMemory closes the state if the memory held by the script exceeds the limit
+func (s *script) checkMemory() error {
+	s.stats.MemoryUsage = memoryUsage(s.L, s.memoryLimit)
+	if s.stats.MemoryUsage > s.memoryLimit {
+		s.close()
+		return fmt.Errorf("memory exceeds the limit of %d bytes", s.memoryLimit)
+	}
+	return nil
+}
+
+func (s *script) load(w *watchdog) (err error) {
+	s.close()
+	L := newLuaState(s.memoryLimit)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			L.Close()
+		}
+	}()
+	// the top level code of the script is limited as well
+	ctx := w.start(time.Now(), s.timeLimit)
+	L.SetContext(ctx)
+	err = L.DoString(string(s.content))
+	L.RemoveContext()
+	w.stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timeout after %s", s.timeLimit)
+		}
+		return luaError(err)
+	}
+	fn, ok := L.GetGlobal(HOOK_FUNCTION).(*lua.LFunction)
+	if !ok {
+		return fmt.Errorf("function %s is not defined", HOOK_FUNCTION)
+	}
+	if s.stats.MemoryUsage = memoryUsage(L, s.memoryLimit); s.stats.MemoryUsage > s.memoryLimit {
+		return fmt.Errorf("memory exceeds the limit of %d bytes", s.memoryLimit)
+	}
+	s.L, s.fn = L, fn
+	return nil
+}
+
+func (s *script) close() {
+	if s.L != nil {
+		s.L.Close()
+		s.L, s.fn = nil, nil
+	}
+}
+
+// luaError removes the stack traceback from the error of the script
+func luaError(err error) error {
+	if apiErr, ok := err.(*lua.ApiError); ok && apiErr.Object != nil {
+		return errors.New(apiErr.Object.String())
+	}
+	return err
+}
+
+func (s *script) fail(stat *int64, err error, now time.Time) {
+	*stat++
+	s.stats.LastError, s.stats.LastErrorTime = err.Error(), now
+	s.consecutiveFailures++
+	if s.consecutiveFailures >= MAX_CONSECUTIVE_FAILURES {
+		log.Warningf("lua script %s of org %d failed %d times consecutively and is disabled for %s, last error: %s",
+			s.name, s.orgId, s.consecutiveFailures, DISABLE_DURATION, err)
+		s.disabledUntil = now.Add(DISABLE_DURATION)
+		s.consecutiveFailures = 0
+	}
+}
+
+// watchdog cancels the running script once its time limit is exceeded. The context and
+// the timer are reused by all calls of a hook, a new context is created only after timeout.
+type watchdog struct {
+	sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	timer    *time.Timer
+	deadline time.Time // zero if no script is running
+}
+
+func newWatchdog() *watchdog {
+	w := &watchdog{}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.timer = time.AfterFunc(time.Hour, w.expire)
+	w.timer.Stop()
+	return w
+}
+
+// expire cancels the context only if the running call is over its deadline, the timer
+// may fire late for a call which is already stopped
+func (w *watchdog) expire() {
+	w.Lock()
+	if !w.deadline.IsZero() && !time.Now().Before(w.deadline) {
+		w.cancel()
+	}
+	w.Unlock()
+}
+
+// start returns the context of a call which is canceled after timeLimit
+func (w *watchdog) start(now time.Time, timeLimit time.Duration) context.Context {
+	w.Lock()
+	if w.ctx.Err() != nil {
+		w.ctx, w.cancel = context.WithCancel(context.Background())
+	}
+	w.deadline = now.Add(timeLimit)
+	ctx := w.ctx
+	w.Unlock()
+	w.timer.Reset(timeLimit)
+	return ctx
+}
+
+func (w *watchdog) stop() {
+	w.timer.Stop()
+	w.Lock()
+	w.deadline = time.Time{}
+	w.Unlock()
+}
+
+type orgRuntime struct {
+	generation uint64
+	scripts    []*script
+}
+
+// Hook runs the Lua scripts in one decoder, LState is not goroutine-safe, so every
+// decoder has its own hook
+type Hook struct {
+	name     string
+	manager  *Manager
+	watchdog *watchdog
+
+	orgs    [grpc.MAX_ORG_COUNT]*orgRuntime
+	counter *Counter
+	// snapshot of the script stats for the debug command, only updated in the decoder goroutine
+	stats     atomic.Pointer[[]ScriptInfo]
+	statsTime time.Time
+	utils.Closable
+}
+
+// ScriptInfo is the debug information of a script in a hook
+type ScriptInfo struct {
+	Hook        string
+	OrgId       uint16
+	Name        string
+	UpdateTime  uint32
+	Loaded      bool
+	Disabled    bool
+	TimeLimit   time.Duration
+	MemoryLimit int
+	ScriptStats
+}
+
+func (h *Hook) GetCounter() interface{} {
+	var counter *Counter
+	counter, h.counter = h.counter, &Counter{}
+	if counter.ExecCount > 0 {
+		counter.AvgTime = counter.TotalTime / counter.ExecCount
+	}
+	return counter
+}
+
+func (h *Hook) updateStats() {
+	infos := []ScriptInfo{}
+	now := time.Now()
+	for orgId, rt := range h.orgs {
+		if rt == nil {
+			continue
+		}
+		for _, s := range rt.scripts {
+			infos = append(infos, ScriptInfo{
+				Hook:        h.name,
+				OrgId:       uint16(orgId),
+				Name:        s.name,
+				UpdateTime:  s.updateTime,
+				Loaded:      s.L != nil,
+				Disabled:    now.Before(s.disabledUntil),
+				TimeLimit:   s.timeLimit,
+				MemoryLimit: s.memoryLimit,
+				ScriptStats: s.stats,
+			})
+		}
+	}
+	h.stats.Store(&infos)
+}
+
+func (h *Hook) runtime(orgId uint16) *orgRuntime {
+	source := h.manager.scripts(orgId)
+	rt := h.orgs[orgId]
+	if source == nil {
+		if rt != nil {
+			h.release(rt)
+			h.orgs[orgId] = nil
+		}
+		return nil
+	}
+	if rt != nil && rt.generation == source.generation {
+		return rt
+	}
+	newRt := &orgRuntime{generation: source.generation}
+	reused := make(map[*script]bool)
+	for _, p := range source.plugins {
+		s := &script{orgId: orgId, name: p.Name, updateTime: p.UpdateTime, content: p.Content, scriptLimit: h.manager.limits(orgId, p.Name)}
+		// keep the state and stats of the unchanged scripts
+		if rt != nil {
+			for _, old := range rt.scripts {
+				if old.name == s.name && old.updateTime == s.updateTime {
+					s = old
+					reused[old] = true
+					break
+				}
+			}
+		}
+		newRt.scripts = append(newRt.scripts, s)
+	}
+	if rt != nil {
+		for _, old := range rt.scripts {
+			if !reused[old] {
+				old.close()
+			}
+		}
+	}
+	h.orgs[orgId] = newRt
+	return newRt
+}
+
+func (h *Hook) release(rt *orgRuntime) {
+	for _, s := range rt.scripts {
+		s.close()
+	}
+}
+
+// Process runs the scripts of the org of the flow log in order, returns false if the
+// flow log is dropped by a script. If a script fails, its changes are discarded and
+// the flow log is passed on to the next script unchanged
+func (h *Hook) Process(l *log_data.L7FlowLog) bool {
+	if l == nil || int(l.OrgId) >= len(h.orgs) {
+		return true
+	}
+	rt := h.runtime(l.OrgId)
+	if rt == nil {
+		return true
+	}
+	for _, s := range rt.scripts {
+		if !h.run(s, l) {
+			h.counter.DropCount++
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Hook) run(s *script, l *log_data.L7FlowLog) (keep bool) {
+	start := time.Now()
+	if start.Sub(h.statsTime) >= STATS_INTERVAL {
+		h.updateStats()
+		h.statsTime = start
+	}
+	if start.Before(s.disabledUntil) {
+		s.stats.Skip++
+		h.counter.SkipCount++
+		return true
+	}
+	if s.L == nil {
+		if err := s.load(h.watchdog); err != nil {
+			s.fail(&s.stats.Error, fmt.Errorf("load failed: %s", err), start)
+			h.counter.ErrorCount++
+			h.counter.SkipCount++
+			return true
+		}
+	}
+	s.stats.Exec++
+	h.counter.ExecCount++
+
+	ctx := h.watchdog.start(start, s.timeLimit)
+	defer func() {
+		h.watchdog.stop()
+		h.counter.TotalTime += int64(time.Since(start))
+		if r := recover(); r != nil {
+			// the state may be broken, load it again for the next flow log
+			s.close()
+			s.fail(&s.stats.Panic, fmt.Errorf("panic: %v", r), start)
+			h.counter.PanicCount++
+			keep = true
+		}
+	}()
+	L := s.L
+	L.SetContext(ctx)
+	table := toTable(L, l)
+	err := L.CallByParam(lua.P{Fn: s.fn, NRet: 1, Protect: true}, table)
+	L.RemoveContext()
+	if err != nil {
+		// the context is only canceled by the watchdog
+		if ctx.Err() != nil {
+			s.close()
+			s.fail(&s.stats.Timeout, fmt.Errorf("timeout after %s", s.timeLimit), start)
+			h.counter.TimeoutCount++
+		} else {
+			s.fail(&s.stats.Error, luaError(err), start)
+			h.counter.ErrorCount++
+		}
+		return true
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	if s.stats.Exec%MEMORY_CHECK_INTERVAL == 0 {
+		if err := s.checkMemory(); err != nil {
+			s.fail(&s.stats.MemoryExceeded, err, start)
+			h.counter.MemoryCount++
+			return true
+		}
+	}
+	s.consecutiveFailures = 0
+	if ret == lua.LFalse {
+		s.stats.Drop++
+		return false
+	}
+	applyTable(table, l)
+	return true
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lua_hook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+)
+
+func newTestHook(timeLimit int) (*Manager, *Hook) {
+	m := newManager(&config.LuaHookConfig{TimeLimit: timeLimit})
+	return m, m.newHook("test")
+}
+
+func newTestFlowLog(orgId uint16, resource string) *log_data.L7FlowLog {
+	l := &log_data.L7FlowLog{}
+	l.OrgId = orgId
+	l.RequestResource = resource
+	l.Endpoint = "/api"
+	l.AttributeNames = []string{"user", "env"}
+	l.AttributeValues = []string{"alice", "prod"}
+	return l
+}
+
+const transformScript = `
+function TransformL7FlowLog(log)
+  if log.request_resource == "/healthz" then
+    return false
+  end
+  local biz = string.match(log.request_resource, "^/api/(%w+)")
+  if biz then
+    log.attributes["biz"] = biz
+    log.endpoint = "/api/" .. biz
+  end
+  log.attributes["env"] = nil
+  log.org_id = 100 -- read-only, ignored
+  return true
+end
+`
+
+func TestTransformAndDrop(t *testing.T) {
+	m, h := newTestHook(100)
+	m.SetPlugins(1, []Plugin{{Name: "biz", UpdateTime: 1, Content: []byte(transformScript)}})
+
+	l := newTestFlowLog(1, "/api/order/123")
+	if !h.Process(l) {
+		t.Fatal("flow log should not be dropped")
+	}
+	if l.Endpoint != "/api/order" || l.OrgId != 1 {
+		t.Errorf("unexpected fields: endpoint=%s org_id=%d", l.Endpoint, l.OrgId)
+	}
+	if strings.Join(l.AttributeNames, ",") != "user,biz" || strings.Join(l.AttributeValues, ",") != "alice,order" {
+		t.Errorf("unexpected attributes: %v %v", l.AttributeNames, l.AttributeValues)
+	}
+
+	if h.Process(newTestFlowLog(1, "/healthz")) {
+		t.Error("health check should be dropped")
+	}
+	// no scripts for org 2
+	l = newTestFlowLog(2, "/healthz")
+	if !h.Process(l) || len(l.AttributeNames) != 2 {
+		t.Error("flow log of org 2 should not be changed")
+	}
+	if h.counter.ExecCount != 2 || h.counter.DropCount != 1 {
+		t.Errorf("unexpected counter: %+v", *h.counter)
+	}
+
+	// scripts are reloaded after updated, and removed
+	m.SetPlugins(1, []Plugin{{Name: "biz", UpdateTime: 2, Content: []byte(`function TransformL7FlowLog(log) log.app_service = "svc" end`)}})
+	l = newTestFlowLog(1, "/healthz")
+	if !h.Process(l) || l.AppService != "svc" {
+		t.Errorf("updated script is not loaded: %s", l.AppService)
+	}
+	m.SetPlugins(1, nil)
+	l = newTestFlowLog(1, "/healthz")
+	if !h.Process(l) || l.AppService != "" {
+		t.Error("removed script is still running")
+	}
+}
+
+func TestScriptFailures(t *testing.T) {
+	m, h := newTestHook(20)
+	m.SetPlugins(1, []Plugin{
+		{Name: "a-error", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) log.endpoint = "changed"; error("oops") end`)},
+		{Name: "b-timeout", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) log.endpoint = "changed"; while true do end end`)},
+		{Name: "c-sandbox", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) os.exit(1) end`)},
+		{Name: "d-invalid", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log)`)},
+		{Name: "e-ok", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) log.app_instance = log.endpoint end`)},
+	})
+
+	l := newTestFlowLog(1, "/api/order")
+	if !h.Process(l) {
+		t.Fatal("flow log should not be dropped by failed scripts")
+	}
+	// the changes of the failed scripts are discarded
+	if l.Endpoint != "/api" || l.AppInstance != "/api" {
+		t.Errorf("unexpected fields: endpoint=%s app_instance=%s", l.Endpoint, l.AppInstance)
+	}
+	if h.counter.ErrorCount != 3 || h.counter.TimeoutCount != 1 || h.counter.ExecCount != 4 {
+		t.Errorf("unexpected counter: %+v", *h.counter)
+	}
+	h.updateStats()
+	infos := *h.stats.Load()
+	if len(infos) != 5 || !strings.Contains(infos[0].LastError, "oops") || infos[1].Timeout != 1 || infos[1].Loaded {
+		t.Errorf("unexpected stats: %+v", infos)
+	}
+	if !strings.Contains(infos[3].LastError, "load failed") {
+		t.Errorf("unexpected stats of invalid script: %+v", infos[3])
+	}
+
+	// the failing script is disabled after failing consecutively
+	m.SetPlugins(1, []Plugin{{Name: "a-error", UpdateTime: 2, Content: []byte(`function TransformL7FlowLog(log) error("oops") end`)}})
+	for i := 0; i < MAX_CONSECUTIVE_FAILURES+10; i++ {
+		h.Process(newTestFlowLog(1, "/"))
+	}
+	h.updateStats()
+	infos = *h.stats.Load()
+	if len(infos) != 1 || !infos[0].Disabled || infos[0].Skip != 10 {
+		t.Errorf("unexpected stats: %+v", infos)
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	m := newManager(&config.LuaHookConfig{
+		TimeLimit:    20,
+		MemoryLimit:  1,
+		ScriptLimits: []config.LuaScriptLimitConfig{{OrgID: 1, Name: "slow", TimeLimit: 2000}},
+	})
+	h := m.newHook("test")
+	m.SetPlugins(1, []Plugin{
+		{Name: "slow", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) if log.request_resource == "/slow" then for i = 1, 2e6 do end end end`)},
+		{Name: "rep", UpdateTime: 1, Content: []byte(`function TransformL7FlowLog(log) local s = string.rep("x", 1e9) end`)},
+		{Name: "leak", UpdateTime: 1, Content: []byte(`cache = {} function TransformL7FlowLog(log) cache[#cache + 1] = string.rep("x", 2048) end`)},
+	})
+
+	h.Process(newTestFlowLog(1, "/slow"))
+	for i := 1; i < MEMORY_CHECK_INTERVAL; i++ {
+		h.Process(newTestFlowLog(1, "/"))
+	}
+	h.updateStats()
+	infos := *h.stats.Load()
+	if len(infos) != 3 {
+		t.Fatalf("unexpected stats: %+v", infos)
+	}
+	// the slow script runs with its own time limit
+	if infos[0].Timeout != 0 || infos[0].Exec != MEMORY_CHECK_INTERVAL || infos[0].TimeLimit != 2*time.Second {
+		t.Errorf("unexpected stats of slow script: %+v", infos[0])
+	}
+	if !strings.Contains(infos[1].LastError, "memory limit") {
+		t.Errorf("unexpected stats of rep script: %+v", infos[1])
+	}
+	// the leaking script is reset once its memory exceeds the limit
+	if infos[2].MemoryExceeded != 1 || infos[2].Loaded || h.counter.MemoryCount != 1 {
+		t.Errorf("unexpected stats of leak script: %+v", infos[2])
+	}
+}
+
+func TestWatchdogReuse(t *testing.T) {
+	m, h := newTestHook(20)
+	m.SetPlugins(1, []Plugin{{Name: "loop", UpdateTime: 1, Content: []byte(`
+function TransformL7FlowLog(log)
+  if log.request_resource == "/loop" then
+    while true do end
+  end
+  log.app_service = "svc"
+end`)}})
+
+	for i := 0; i < 3; i++ {
+		h.Process(newTestFlowLog(1, "/loop"))
+		l := newTestFlowLog(1, "/")
+		if !h.Process(l) || l.AppService != "svc" {
+			t.Fatalf("script is not run after timeout %d", i)
+		}
+	}
+	if h.counter.TimeoutCount != 3 {
+		t.Errorf("unexpected counter: %+v", *h.counter)
+	}
+}
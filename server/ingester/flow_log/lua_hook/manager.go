@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lua_hook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/trident"
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/debug"
+	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+)
+
+var log = logger.MustGetLogger("flow_log.lua_hook")
+
+const (
+	PLUGIN_TYPE_LUA = 3
+)
+
+type Plugin struct {
+	Name       string
+	UpdateTime uint32
+	Content    []byte
+}
+
+type orgPlugins struct {
+	generation uint64
+	key        string
+	plugins    []Plugin
+}
+
+// Manager syncs the Lua plugins of each org from the controller, the scripts are
+// compiled and run by the Hook of each decoder
+type Manager struct {
+	limit        scriptLimit
+	scriptLimits map[string]scriptLimit
+	grpcSession  *grpc.GrpcSession
+
+	orgs       [grpc.MAX_ORG_COUNT]atomic.Pointer[orgPlugins]
+	generation atomic.Uint64
+
+	hooksLock sync.Mutex
+	hooks     []*Hook
+}
+
+func NewManager(cfg *config.Config) *Manager {
+	m := newManager(&cfg.LuaHook)
+	m.grpcSession = &grpc.GrpcSession{}
+	runOnce := func() {
+		orgIds := grpc.QueryAllOrgIDs()
+		exists := make(map[uint16]bool, len(orgIds))
+		for _, orgId := range orgIds {
+			exists[orgId] = true
+			if err := m.reload(orgId); err != nil {
+				log.Warning(err, logger.NewORGPrefix(int(orgId)))
+			}
+		}
+		for orgId := range m.orgs {
+			if !exists[uint16(orgId)] {
+				m.SetPlugins(uint16(orgId), nil)
+			}
+		}
+	}
+	controllers := make([]net.IP, len(cfg.Base.ControllerIPs))
+	for i, ipString := range cfg.Base.ControllerIPs {
+		controllers[i] = net.ParseIP(ipString)
+		if controllers[i].To4() != nil {
+			controllers[i] = controllers[i].To4()
+		}
+	}
+	m.grpcSession.Init(controllers, cfg.Base.ControllerPort, time.Duration(cfg.LuaHook.SyncInterval)*time.Second, cfg.Base.GrpcBufferSize, runOnce)
+	debug.ServerRegisterSimple(ingesterctl.CMD_LUA_HOOK, m)
+	return m
+}
+
+func newManager(cfg *config.LuaHookConfig) *Manager {
+	memoryLimit := cfg.MemoryLimit
+	if memoryLimit <= 0 {
+		memoryLimit = config.DefaultLuaHookMemoryLimit
+	}
+	m := &Manager{
+		limit: scriptLimit{
+			timeLimit:   time.Duration(cfg.TimeLimit) * time.Millisecond,
+			memoryLimit: memoryLimit << 20,
+		},
+		scriptLimits: make(map[string]scriptLimit, len(cfg.ScriptLimits)),
+	}
+	for _, l := range cfg.ScriptLimits {
+		limit := m.limit
+		if l.TimeLimit > 0 {
+			limit.timeLimit = time.Duration(l.TimeLimit) * time.Millisecond
+		}
+		if l.MemoryLimit > 0 {
+			limit.memoryLimit = l.MemoryLimit << 20
+		}
+		m.scriptLimits[scriptLimitKey(l.OrgID, l.Name)] = limit
+	}
+	return m
+}
+
+func scriptLimitKey(orgId uint16, name string) string {
+	return strconv.Itoa(int(orgId)) + "/" + name
+}
+
+// limits returns the limits of the script configured by script-limits, or the default limits
+func (m *Manager) limits(orgId uint16, name string) scriptLimit {
+	if limit, ok := m.scriptLimits[scriptLimitKey(orgId, name)]; ok {
+		return limit
+	}
+	return m.limit
+}
+
+func (m *Manager) reload(orgId uint16) error {
+	var response *trident.ServerPluginsResponse
+	err := m.grpcSession.Request(func(ctx context.Context, remote net.IP) error {
+		var err error
+		c := m.grpcSession.GetClient()
+		if c == nil {
+			return fmt.Errorf("can't get grpc client to %s", remote)
+		}
+		client := trident.NewSynchronizerClient(c)
+		response, err = client.GetServerPlugins(ctx, &trident.ServerPluginsRequest{
+			OrgId:      proto.Uint32(uint32(orgId)),
+			PluginType: proto.Uint32(PLUGIN_TYPE_LUA),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	plugins := make([]Plugin, 0, len(response.GetPlugins()))
+	for _, p := range response.GetPlugins() {
+		plugins = append(plugins, Plugin{
+			Name:       p.GetName(),
+			UpdateTime: p.GetUpdateTime(),
+			Content:    p.GetContent(),
+		})
+	}
+	m.SetPlugins(orgId, plugins)
+	return nil
+}
+
+// SetPlugins replaces the plugins of the org, the hooks reload the scripts on their next flow log
+func (m *Manager) SetPlugins(orgId uint16, plugins []Plugin) {
+	if int(orgId) >= len(m.orgs) {
+		return
+	}
+	var sb strings.Builder
+	for _, p := range plugins {
+		fmt.Fprintf(&sb, "%s:%d,", p.Name, p.UpdateTime)
+	}
+	key := sb.String()
+	current := m.orgs[orgId].Load()
+	if len(plugins) == 0 {
+		if current != nil {
+			log.Infof("lua plugins are removed", logger.NewORGPrefix(int(orgId)))
+			m.orgs[orgId].Store(nil)
+		}
+		return
+	}
+	if current != nil && current.key == key {
+		return
+	}
+	log.Infof("lua plugins are updated: %s", key, logger.NewORGPrefix(int(orgId)))
+	m.orgs[orgId].Store(&orgPlugins{
+		generation: m.generation.Add(1),
+		key:        key,
+		plugins:    plugins,
+	})
+}
+
+func (m *Manager) scripts(orgId uint16) *orgPlugins {
+	return m.orgs[orgId].Load()
+}
+
+// NewHook creates the hook of a decoder
+func (m *Manager) NewHook(name string) *Hook {
+	h := m.newHook(name)
+	common.RegisterCountableForIngester("lua_hook", h, stats.OptionStatTags{"decoder": name})
+	return h
+}
+
+func (m *Manager) newHook(name string) *Hook {
+	h := &Hook{
+		name:     name,
+		manager:  m,
+		watchdog: newWatchdog(),
+		counter:  &Counter{},
+	}
+	m.hooksLock.Lock()
+	m.hooks = append(m.hooks, h)
+	m.hooksLock.Unlock()
+	return h
+}
+
+func (m *Manager) Start() {
+	if m.grpcSession != nil {
+		m.grpcSession.Start()
+	}
+}
+
+func (m *Manager) Close() {
+	if m.grpcSession != nil {
+		m.grpcSession.Close()
+	}
+	m.hooksLock.Lock()
+	for _, h := range m.hooks {
+		h.Closable.Close()
+	}
+	m.hooksLock.Unlock()
+}
+
+// HandleSimpleCommand shows the statistics of the scripts, updated every stats interval
+func (m *Manager) HandleSimpleCommand(operate uint16, arg string) string {
+	orgFilter := -1
+	if arg != "" {
+		if orgId, err := strconv.Atoi(arg); err == nil {
+			orgFilter = orgId
+		}
+	}
+	var sb strings.Builder
+	for orgId := range m.orgs {
+		p := m.orgs[orgId].Load()
+		if p == nil || (orgFilter >= 0 && orgFilter != orgId) {
+			continue
+		}
+		fmt.Fprintf(&sb, "org %d plugins: %s\n", orgId, p.key)
+	}
+	m.hooksLock.Lock()
+	hooks := append([]*Hook{}, m.hooks...)
+	m.hooksLock.Unlock()
+	for _, h := range hooks {
+		infos := h.stats.Load()
+		if infos == nil {
+			continue
+		}
+		for _, info := range *infos {
+			if orgFilter >= 0 && orgFilter != int(info.OrgId) {
+				continue
+			}
+			fmt.Fprintf(&sb, "%s org=%d script=%s update_time=%d loaded=%t disabled=%t time_limit=%s memory_limit=%dMB memory=%dKB exec=%d drop=%d error=%d timeout=%d memory_exceeded=%d panic=%d skip=%d",
+				info.Hook, info.OrgId, info.Name, info.UpdateTime, info.Loaded, info.Disabled, info.TimeLimit, info.MemoryLimit>>20, info.MemoryUsage>>10,
+				info.Exec, info.Drop, info.Error, info.Timeout, info.MemoryExceeded, info.Panic, info.Skip)
+			if info.LastError != "" {
+				fmt.Fprintf(&sb, " last_error(%s)=%s", info.LastErrorTime.Format(time.RFC3339), info.LastError)
+			}
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
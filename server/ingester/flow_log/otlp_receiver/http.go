@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp_receiver
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	OTLP_HTTP_TRACES_PATH  = "/v1/traces"
+	OTLP_HTTP_LOGS_PATH    = "/v1/logs"
+	OTLP_HTTP_METRICS_PATH = "/v1/metrics"
+
+	CONTENT_TYPE_PROTOBUF = "application/x-protobuf"
+	CONTENT_TYPE_JSON     = "application/json"
+)
+
+// writeStatus responds the error as google.rpc.Status encoded in the content type of the request
+func writeStatus(w http.ResponseWriter, contentType string, httpCode int, code codes.Code, msg string) {
+	var body []byte
+	s := status.New(code, msg).Proto()
+	if contentType == CONTENT_TYPE_JSON {
+		body, _ = protojson.Marshal(s)
+	} else {
+		body, _ = proto.Marshal(s)
+	}
+	if httpCode == http.StatusTooManyRequests || httpCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(RETRY_AFTER_SECOND))
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(httpCode)
+	w.Write(body)
+}
+
+func (r *Receiver) readBody(w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	body := http.MaxBytesReader(w, req.Body, int64(r.cfg.MaxRequestSize))
+	defer body.Close()
+	var reader io.Reader = body
+	switch req.Header.Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		// limit the decompressed size as well
+		reader = io.LimitReader(gr, int64(r.cfg.MaxRequestSize)+1)
+	case "", "identity":
+	default:
+		return nil, errors.New("unsupported Content-Encoding " + req.Header.Get("Content-Encoding"))
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > r.cfg.MaxRequestSize {
+		return nil, &http.MaxBytesError{Limit: int64(r.cfg.MaxRequestSize)}
+	}
+	return data, nil
+}
+
+// otlpCodec decodes the request body of one signal to protobuf, and encodes the empty response
+type otlpCodec interface {
+	// decode returns the protobuf encoded request and the count of spans, log records or data points
+	decode(data []byte, isJSON bool) ([]byte, int, error)
+	response(isJSON bool) []byte
+}
+
+type tracesCodec struct{}
+
+func (tracesCodec) decode(data []byte, isJSON bool) ([]byte, int, error) {
+	exportRequest := ptraceotlp.NewExportRequest()
+	var err error
+	if isJSON {
+		err = exportRequest.UnmarshalJSON(data)
+		if err == nil {
+			// the decoder reads protobuf only
+			data, err = exportRequest.MarshalProto()
+		}
+	} else {
+		err = exportRequest.UnmarshalProto(data)
+	}
+	return data, exportRequest.Traces().SpanCount(), err
+}
+
+func (tracesCodec) response(isJSON bool) []byte {
+	exportResponse := ptraceotlp.NewExportResponse()
+	if isJSON {
+		body, _ := exportResponse.MarshalJSON()
+		return body
+	}
+	body, _ := exportResponse.MarshalProto()
+	return body
+}
+
+type logsCodec struct{}
+
+func (logsCodec) decode(data []byte, isJSON bool) ([]byte, int, error) {
+	exportRequest := plogotlp.NewExportRequest()
+	var err error
+	if isJSON {
+		err = exportRequest.UnmarshalJSON(data)
+		if err == nil {
+			data, err = exportRequest.MarshalProto()
+		}
+	} else {
+		err = exportRequest.UnmarshalProto(data)
+	}
+	return data, exportRequest.Logs().LogRecordCount(), err
+}
+
+func (logsCodec) response(isJSON bool) []byte {
+	exportResponse := plogotlp.NewExportResponse()
+	if isJSON {
+		body, _ := exportResponse.MarshalJSON()
+		return body
+	}
+	body, _ := exportResponse.MarshalProto()
+	return body
+}
+
+type metricsCodec struct{}
+
+func (metricsCodec) decode(data []byte, isJSON bool) ([]byte, int, error) {
+	exportRequest := pmetricotlp.NewExportRequest()
+	var err error
+	if isJSON {
+		err = exportRequest.UnmarshalJSON(data)
+		if err == nil {
+			data, err = exportRequest.MarshalProto()
+		}
+	} else {
+		err = exportRequest.UnmarshalProto(data)
+	}
+	return data, exportRequest.Metrics().DataPointCount(), err
+}
+
+func (metricsCodec) response(isJSON bool) []byte {
+	exportResponse := pmetricotlp.NewExportResponse()
+	if isJSON {
+		body, _ := exportResponse.MarshalJSON()
+		return body
+	}
+	body, _ := exportResponse.MarshalProto()
+	return body
+}
+
+func (r *Receiver) handleHTTPTraces(w http.ResponseWriter, req *http.Request) {
+	r.handleHTTP(w, req, SIGNAL_TRACES, tracesCodec{})
+}
+
+func (r *Receiver) handleHTTPLogs(w http.ResponseWriter, req *http.Request) {
+	r.handleHTTP(w, req, SIGNAL_LOGS, logsCodec{})
+}
+
+func (r *Receiver) handleHTTPMetrics(w http.ResponseWriter, req *http.Request) {
+	r.handleHTTP(w, req, SIGNAL_METRICS, metricsCodec{})
+}
+
+func (r *Receiver) handleHTTP(w http.ResponseWriter, req *http.Request, signal Signal, c otlpCodec) {
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType != CONTENT_TYPE_JSON {
+		contentType = CONTENT_TYPE_PROTOBUF
+	}
+	if req.Method != http.MethodPost {
+		writeStatus(w, contentType, http.StatusMethodNotAllowed, codes.Unimplemented, "only POST is supported")
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); ct != CONTENT_TYPE_JSON && ct != CONTENT_TYPE_PROTOBUF {
+		writeStatus(w, contentType, http.StatusUnsupportedMediaType, codes.InvalidArgument, "unsupported Content-Type "+ct)
+		return
+	}
+
+	t, err := r.authenticate(req.Header.Get(AUTHORIZATION_HEADER))
+	if err != nil {
+		writeStatus(w, contentType, http.StatusUnauthorized, codes.Unauthenticated, err.Error())
+		return
+	}
+	if r.signals[signal].Load() == nil {
+		writeStatus(w, contentType, http.StatusNotFound, codes.Unimplemented, errNotRegistered.Error())
+		return
+	}
+
+	data, err := r.readBody(w, req)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			atomic.AddInt64(&t.counter.TooLarge, 1)
+			writeStatus(w, contentType, http.StatusRequestEntityTooLarge, codes.ResourceExhausted, err.Error())
+			return
+		}
+		atomic.AddInt64(&t.counter.InvalidCount, 1)
+		writeStatus(w, contentType, http.StatusBadRequest, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	isJSON := contentType == CONTENT_TYPE_JSON
+	data, items, err := c.decode(data, isJSON)
+	if err != nil {
+		atomic.AddInt64(&t.counter.InvalidCount, 1)
+		writeStatus(w, contentType, http.StatusBadRequest, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	if items > 0 {
+		if _, err := r.put(t, signal, data, items); err != nil {
+			if err == ErrQueueFull {
+				writeStatus(w, contentType, http.StatusTooManyRequests, codes.ResourceExhausted, err.Error())
+			} else {
+				writeStatus(w, contentType, http.StatusServiceUnavailable, codes.Unavailable, err.Error())
+			}
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.response(isJSON))
+}
@@ -0,0 +1,461 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp_receiver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/receiver"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("flow_log.otlp_receiver")
+
+const (
+	AUTHORIZATION_HEADER = "authorization"
+	BEARER_PREFIX        = "bearer "
+	RETRY_AFTER_SECOND   = 1
+)
+
+type Signal uint8
+
+const (
+	SIGNAL_TRACES Signal = iota
+	SIGNAL_LOGS
+	SIGNAL_METRICS
+	SIGNAL_MAX
+)
+
+var signalNames = [SIGNAL_MAX]string{
+	SIGNAL_TRACES:  "traces",
+	SIGNAL_LOGS:    "logs",
+	SIGNAL_METRICS: "metrics",
+}
+
+func (s Signal) String() string {
+	if s < SIGNAL_MAX {
+		return signalNames[s]
+	}
+	return "unknown"
+}
+
+var (
+	errUnauthenticated = errors.New("invalid or missing org token")
+	ErrQueueFull       = errors.New("ingester decode queue is full, retry later")
+	errNotRegistered   = errors.New("the signal is not enabled in the ingester")
+)
+
+type Counter struct {
+	Requests     int64 `statsd:"requests"`
+	Spans        int64 `statsd:"spans"`
+	Logs         int64 `statsd:"logs"`
+	Points       int64 `statsd:"points"`
+	Bytes        int64 `statsd:"bytes"`
+	AuthFailed   int64 `statsd:"auth-failed"`
+	TooLarge     int64 `statsd:"too-large"`
+	InvalidCount int64 `statsd:"invalid"`
+	Throttled    int64 `statsd:"throttled"`
+}
+
+type tenant struct {
+	orgId   uint16
+	teamId  uint32
+	counter *Counter
+	utils.Closable
+}
+
+func (t *tenant) GetCounter() interface{} {
+	counter := &Counter{}
+	counter.Requests = atomic.SwapInt64(&t.counter.Requests, 0)
+	counter.Spans = atomic.SwapInt64(&t.counter.Spans, 0)
+	counter.Logs = atomic.SwapInt64(&t.counter.Logs, 0)
+	counter.Points = atomic.SwapInt64(&t.counter.Points, 0)
+	counter.Bytes = atomic.SwapInt64(&t.counter.Bytes, 0)
+	counter.AuthFailed = atomic.SwapInt64(&t.counter.AuthFailed, 0)
+	counter.TooLarge = atomic.SwapInt64(&t.counter.TooLarge, 0)
+	counter.InvalidCount = atomic.SwapInt64(&t.counter.InvalidCount, 0)
+	counter.Throttled = atomic.SwapInt64(&t.counter.Throttled, 0)
+	return counter
+}
+
+// signalQueues are the decode queues which one signal is put into
+type signalQueues struct {
+	queues lenMultiQueueWriter
+	count  int
+	limit  int
+	cursor uint32
+}
+
+// Receiver hosts the OTLP/gRPC and OTLP/HTTP endpoints, the received traces are put into the decode queues
+// of MESSAGE_TYPE_OPENTELEMETRY, the same as those sent by the agents. Logs and metrics are put into the
+// decode queues registered by app_log and ext_metrics, and are rejected before the registration.
+type Receiver struct {
+	cfg     *config.OTLPReceiverConfig
+	signals [SIGNAL_MAX]atomic.Pointer[signalQueues]
+
+	authEnabled bool
+	tokens      map[string]*tenant
+	// when the authentication is disabled, all data belongs to the default org
+	anonymous *tenant
+	// counts the authentication failures whose org is unknown
+	unknown *tenant
+
+	tenantsLock sync.Mutex
+	tenants     map[string]*tenant
+
+	grpcServer *grpc.Server
+	httpServer *http.Server
+
+	coltracepb.UnimplementedTraceServiceServer
+}
+
+// the gRPC services of logs and metrics also have the method Export, so they are implemented by other types
+type logsService struct {
+	r *Receiver
+	collogspb.UnimplementedLogsServiceServer
+}
+
+type metricsService struct {
+	r *Receiver
+	colmetricspb.UnimplementedMetricsServiceServer
+}
+
+type lenMultiQueueWriter interface {
+	queue.TypedMultiQueueWriter[*receiver.RecvBuffer]
+	Len(queue.HashKey) int
+}
+
+func NewReceiver(cfg *config.Config, decodeQueues lenMultiQueueWriter) *Receiver {
+	rcfg := &cfg.OTLPReceiver
+	r := &Receiver{
+		cfg:         rcfg,
+		authEnabled: len(rcfg.Tokens) > 0,
+		tokens:      make(map[string]*tenant),
+		tenants:     make(map[string]*tenant),
+	}
+	for _, t := range rcfg.Tokens {
+		orgId, teamId := t.OrgID, t.TeamID
+		if orgId == ckdb.INVALID_ORG_ID {
+			orgId = ckdb.DEFAULT_ORG_ID
+		}
+		if teamId == ckdb.INVALID_TEAM_ID {
+			teamId = ckdb.DEFAULT_TEAM_ID
+		}
+		r.tokens[t.Token] = r.getTenant(orgId, teamId)
+	}
+	if r.authEnabled {
+		r.unknown = r.getTenant(ckdb.INVALID_ORG_ID, ckdb.INVALID_TEAM_ID)
+	} else {
+		log.Warning("otlp-receiver tokens are not configured, authentication is disabled and all data belongs to the default org")
+		r.anonymous = r.getTenant(ckdb.DEFAULT_ORG_ID, ckdb.DEFAULT_TEAM_ID)
+	}
+	r.RegistQueues(SIGNAL_TRACES, decodeQueues, cfg.DecoderQueueCount, cfg.DecoderQueueSize)
+	return r
+}
+
+// RegistQueues sets the decode queues of the signal, it can be called after Start
+func (r *Receiver) RegistQueues(signal Signal, decodeQueues lenMultiQueueWriter, queueCount, queueSize int) {
+	if signal >= SIGNAL_MAX || decodeQueues == nil || queueCount <= 0 {
+		return
+	}
+	r.signals[signal].Store(&signalQueues{
+		queues: decodeQueues,
+		count:  queueCount,
+		limit:  queueSize * r.cfg.QueueHighWater / 100,
+	})
+	log.Infof("otlp receiver %s enabled", signal)
+}
+
+func (r *Receiver) getTenant(orgId uint16, teamId uint32) *tenant {
+	key := fmt.Sprintf("%d-%d", orgId, teamId)
+	r.tenantsLock.Lock()
+	defer r.tenantsLock.Unlock()
+	if t, ok := r.tenants[key]; ok {
+		return t
+	}
+	t := &tenant{orgId: orgId, teamId: teamId, counter: &Counter{}}
+	r.tenants[key] = t
+	common.RegisterCountableForIngester("otlp_receiver", t, stats.OptionStatTags{
+		"org_id":  strconv.Itoa(int(orgId)),
+		"team_id": strconv.Itoa(int(teamId))})
+	return t
+}
+
+// authenticate accepts "Bearer <token>" or the bare token
+func (r *Receiver) authenticate(authorization string) (*tenant, error) {
+	if !r.authEnabled {
+		return r.anonymous, nil
+	}
+	token := strings.TrimSpace(authorization)
+	if len(token) >= len(BEARER_PREFIX) && strings.EqualFold(token[:len(BEARER_PREFIX)], BEARER_PREFIX) {
+		token = strings.TrimSpace(token[len(BEARER_PREFIX):])
+	}
+	if t, ok := r.tokens[token]; ok && token != "" {
+		return t, nil
+	}
+	atomic.AddInt64(&r.unknown.counter.AuthFailed, 1)
+	return nil, errUnauthenticated
+}
+
+// put encodes the serialized TracesData/LogsData/MetricsData as the decoder reads it, rejects it when the decode queue is above the high water
+func (r *Receiver) put(t *tenant, signal Signal, data []byte, items int) (*queue.Position, error) {
+	q := r.signals[signal].Load()
+	if q == nil {
+		return nil, errNotRegistered
+	}
+	hashKey := queue.HashKey(atomic.AddUint32(&q.cursor, 1) % uint32(q.count))
+	if q.queues.Len(hashKey) >= q.limit {
+		atomic.AddInt64(&t.counter.Throttled, 1)
+		return nil, ErrQueueFull
+	}
+
+	size := len(data) + 4
+	buffer, _ := receiver.AcquireRecvBuffer(size, receiver.TCP)
+	binary.LittleEndian.PutUint32(buffer.Buffer, uint32(len(data)))
+	copy(buffer.Buffer[4:], data)
+	buffer.Begin, buffer.End = 0, size
+	buffer.OrgID, buffer.TeamID = t.orgId, t.teamId
+	position, err := queue.PutWithPosition(q.queues, hashKey, buffer)
+	if err != nil {
+		receiver.ReleaseRecvBuffer(buffer)
+		return nil, err
+	}
+
+	atomic.AddInt64(&t.counter.Requests, 1)
+	switch signal {
+	case SIGNAL_TRACES:
+		atomic.AddInt64(&t.counter.Spans, int64(items))
+	case SIGNAL_LOGS:
+		atomic.AddInt64(&t.counter.Logs, int64(items))
+	case SIGNAL_METRICS:
+		atomic.AddInt64(&t.counter.Points, int64(items))
+	}
+	atomic.AddInt64(&t.counter.Bytes, int64(len(data)))
+	return position, nil
+}
+
+// PutRaw puts the OTLP request which is not received from the OTLP endpoints, e.g. consumed from kafka, data is
+// the ExportXxxServiceRequest encoded in protobuf or JSON, ErrQueueFull is returned if the decode queue is above the high water.
+// The position in the decode queue is returned to check if the request is decoded, it is nil if the request has no items.
+func (r *Receiver) PutRaw(signal Signal, data []byte, isJSON bool, orgId uint16, teamId uint32) (*queue.Position, error) {
+	var c otlpCodec
+	switch signal {
+	case SIGNAL_TRACES:
+		c = tracesCodec{}
+	case SIGNAL_LOGS:
+		c = logsCodec{}
+	case SIGNAL_METRICS:
+		c = metricsCodec{}
+	default:
+		return nil, fmt.Errorf("unknown signal %d", signal)
+	}
+	if orgId == ckdb.INVALID_ORG_ID {
+		orgId = ckdb.DEFAULT_ORG_ID
+	}
+	if teamId == ckdb.INVALID_TEAM_ID {
+		teamId = ckdb.DEFAULT_TEAM_ID
+	}
+	t := r.getTenant(orgId, teamId)
+	data, items, err := c.decode(data, isJSON)
+	if err != nil {
+		atomic.AddInt64(&t.counter.InvalidCount, 1)
+		return nil, err
+	}
+	if items == 0 {
+		return nil, nil
+	}
+	return r.put(t, signal, data, items)
+}
+
+func spanCount(req *coltracepb.ExportTraceServiceRequest) int {
+	count := 0
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			count += len(ss.GetSpans())
+		}
+	}
+	return count
+}
+
+func logCount(req *collogspb.ExportLogsServiceRequest) int {
+	count := 0
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			count += len(sl.GetLogRecords())
+		}
+	}
+	return count
+}
+
+func pointCount(req *colmetricspb.ExportMetricsServiceRequest) int {
+	count := 0
+	for _, rm := range req.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					count += len(data.Gauge.GetDataPoints())
+				case *metricspb.Metric_Sum:
+					count += len(data.Sum.GetDataPoints())
+				case *metricspb.Metric_Histogram:
+					count += len(data.Histogram.GetDataPoints())
+				case *metricspb.Metric_ExponentialHistogram:
+					count += len(data.ExponentialHistogram.GetDataPoints())
+				case *metricspb.Metric_Summary:
+					count += len(data.Summary.GetDataPoints())
+				}
+			}
+		}
+	}
+	return count
+}
+
+// export handles the gRPC request of all signals, the ExportXxxServiceRequest and XxxData have the same wire format
+func (r *Receiver) export(ctx context.Context, signal Signal, req proto.Message, items int) error {
+	authorization := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(AUTHORIZATION_HEADER); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	t, err := r.authenticate(authorization)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if r.signals[signal].Load() == nil {
+		return status.Error(codes.Unimplemented, errNotRegistered.Error())
+	}
+
+	if items == 0 {
+		return nil
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		atomic.AddInt64(&t.counter.InvalidCount, 1)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := r.put(t, signal, data, items); err != nil {
+		if err == ErrQueueFull {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return nil
+}
+
+// Export implements the OTLP/gRPC TraceService
+func (r *Receiver) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	if err := r.export(ctx, SIGNAL_TRACES, req, spanCount(req)); err != nil {
+		return nil, err
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// Export implements the OTLP/gRPC LogsService
+func (s *logsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if err := s.r.export(ctx, SIGNAL_LOGS, req, logCount(req)); err != nil {
+		return nil, err
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// Export implements the OTLP/gRPC MetricsService
+func (s *metricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	if err := s.r.export(ctx, SIGNAL_METRICS, req, pointCount(req)); err != nil {
+		return nil, err
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *Receiver) Start() {
+	r.grpcServer = grpc.NewServer(grpc.MaxRecvMsgSize(r.cfg.MaxRequestSize))
+	coltracepb.RegisterTraceServiceServer(r.grpcServer, r)
+	collogspb.RegisterLogsServiceServer(r.grpcServer, &logsService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(r.grpcServer, &metricsService{r: r})
+	grpcAddr := ":" + strconv.Itoa(r.cfg.GRPCPort)
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Errorf("otlp grpc receiver listen on %s failed: %s", grpcAddr, err)
+	} else {
+		go func() {
+			if err := r.grpcServer.Serve(listener); err != nil {
+				log.Errorf("otlp grpc receiver serve failed: %s", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(OTLP_HTTP_TRACES_PATH, r.handleHTTPTraces)
+	mux.HandleFunc(OTLP_HTTP_LOGS_PATH, r.handleHTTPLogs)
+	mux.HandleFunc(OTLP_HTTP_METRICS_PATH, r.handleHTTPMetrics)
+	r.httpServer = &http.Server{
+		Addr:    ":" + strconv.Itoa(r.cfg.HTTPPort),
+		Handler: mux,
+	}
+	go func() {
+		if err := r.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Errorf("otlp http receiver listen on %s failed: %s", r.httpServer.Addr, err)
+		}
+	}()
+	log.Infof("otlp receiver started, grpc port: %d, http port: %d", r.cfg.GRPCPort, r.cfg.HTTPPort)
+}
+
+func (r *Receiver) Close() error {
+	if r.grpcServer != nil {
+		r.grpcServer.Stop()
+	}
+	if r.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+		defer cancel()
+		if err := r.httpServer.Shutdown(ctx); err != nil {
+			log.Warningf("otlp http receiver shutdown failed: %s", err)
+		}
+	}
+	r.tenantsLock.Lock()
+	for _, t := range r.tenants {
+		t.Close()
+	}
+	r.tenantsLock.Unlock()
+	return nil
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otlp_receiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/receiver"
+)
+
+type mockQueues struct {
+	items [][]*receiver.RecvBuffer
+	full  bool
+}
+
+func (q *mockQueues) Put(key queue.HashKey, items ...*receiver.RecvBuffer) error {
+	q.items[key] = append(q.items[key], items...)
+	return nil
+}
+
+func (q *mockQueues) Puts(keys []queue.HashKey, items []*receiver.RecvBuffer) error {
+	return nil
+}
+
+func (q *mockQueues) Close() error {
+	return nil
+}
+
+func (q *mockQueues) Len(key queue.HashKey) int {
+	if q.full {
+		return 1 << 20
+	}
+	return len(q.items[key])
+}
+
+func (q *mockQueues) all() []*receiver.RecvBuffer {
+	var ret []*receiver.RecvBuffer
+	for _, items := range q.items {
+		ret = append(ret, items...)
+	}
+	return ret
+}
+
+func newTestReceiver(tokens []config.OTLPToken) (*Receiver, *mockQueues) {
+	cfg := &config.Config{
+		DecoderQueueCount: 2,
+		DecoderQueueSize:  100,
+		OTLPReceiver: config.OTLPReceiverConfig{
+			MaxRequestSize: 1 << 10,
+			QueueHighWater: 90,
+			Tokens:         tokens,
+		},
+	}
+	q := &mockQueues{items: make([][]*receiver.RecvBuffer, 2)}
+	return NewReceiver(cfg, q), q
+}
+
+func testRequest() *coltracepb.ExportTraceServiceRequest {
+	return &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{Name: "a", TraceId: bytes.Repeat([]byte{1}, 16), SpanId: bytes.Repeat([]byte{2}, 8)}, {Name: "b"}},
+			}},
+		}},
+	}
+}
+
+// the queued buffer must be readable as codec.SimpleDecoder.ReadBytes + TracesData
+func decodeQueued(t *testing.T, b *receiver.RecvBuffer) *tracepb.TracesData {
+	data := b.Buffer[b.Begin:b.End]
+	l := binary.LittleEndian.Uint32(data)
+	if int(l) != len(data)-4 {
+		t.Fatalf("queued length %d, want %d", l, len(data)-4)
+	}
+	tracesData := &tracepb.TracesData{}
+	if err := proto.Unmarshal(data[4:], tracesData); err != nil {
+		t.Fatalf("unmarshal queued TracesData failed: %s", err)
+	}
+	return tracesData
+}
+
+func TestHTTPTraces(t *testing.T) {
+	r, q := newTestReceiver([]config.OTLPToken{{Token: "t1", OrgID: 3, TeamID: 5}})
+	body, _ := proto.Marshal(testRequest())
+	jsonBody := []byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0102030405060708","name":"j"}]}]}]}`)
+
+	tests := []struct {
+		name          string
+		method        string
+		contentType   string
+		authorization string
+		body          []byte
+		full          bool
+		wantCode      int
+	}{
+		{"protobuf", "POST", CONTENT_TYPE_PROTOBUF, "Bearer t1", body, false, http.StatusOK},
+		{"json", "POST", CONTENT_TYPE_JSON + "; charset=utf-8", "t1", jsonBody, false, http.StatusOK},
+		{"bad token", "POST", CONTENT_TYPE_PROTOBUF, "Bearer t2", body, false, http.StatusUnauthorized},
+		{"no token", "POST", CONTENT_TYPE_PROTOBUF, "", body, false, http.StatusUnauthorized},
+		{"bad body", "POST", CONTENT_TYPE_PROTOBUF, "Bearer t1", []byte{0xff, 0xff}, false, http.StatusBadRequest},
+		{"too large", "POST", CONTENT_TYPE_PROTOBUF, "Bearer t1", make([]byte, 2<<10), false, http.StatusRequestEntityTooLarge},
+		{"queue full", "POST", CONTENT_TYPE_PROTOBUF, "Bearer t1", body, true, http.StatusTooManyRequests},
+		{"content type", "POST", "text/plain", "Bearer t1", body, false, http.StatusUnsupportedMediaType},
+		{"method", "GET", CONTENT_TYPE_PROTOBUF, "Bearer t1", nil, false, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		q.full = tt.full
+		req := httptest.NewRequest(tt.method, OTLP_HTTP_TRACES_PATH, bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		r.handleHTTPTraces(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: code = %d, want %d, body: %s", tt.name, rec.Code, tt.wantCode, rec.Body.String())
+		}
+	}
+
+	queued := q.all()
+	if len(queued) != 2 {
+		t.Fatalf("queued %d buffers, want 2", len(queued))
+	}
+	spans := 0
+	for _, b := range queued {
+		if b.OrgID != 3 || b.TeamID != 5 {
+			t.Errorf("queued org/team = %d/%d, want 3/5", b.OrgID, b.TeamID)
+		}
+		spans += len(decodeQueued(t, b).ResourceSpans[0].ScopeSpans[0].Spans)
+	}
+	if spans != 3 {
+		t.Errorf("queued %d spans, want 3", spans)
+	}
+
+	counter := r.tokens["t1"].GetCounter().(*Counter)
+	if counter.Requests != 2 || counter.Spans != 3 || counter.Throttled != 1 || counter.TooLarge != 1 || counter.InvalidCount != 1 {
+		t.Errorf("tenant counter = %+v", counter)
+	}
+	if failed := r.unknown.GetCounter().(*Counter).AuthFailed; failed != 2 {
+		t.Errorf("auth failed = %d, want 2", failed)
+	}
+}
+
+func TestGRPCExport(t *testing.T) {
+	r, q := newTestReceiver(nil)
+	if _, err := r.Export(context.Background(), testRequest()); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	queued := q.all()
+	if len(queued) != 1 || queued[0].OrgID != 1 || queued[0].TeamID != 1 {
+		t.Fatalf("queued %+v, want 1 buffer of the default org", queued)
+	}
+	if spans := decodeQueued(t, queued[0]).ResourceSpans[0].ScopeSpans[0].Spans; len(spans) != 2 || spans[0].Name != "a" {
+		t.Errorf("queued spans = %v", spans)
+	}
+
+	q.full = true
+	if _, err := r.Export(context.Background(), testRequest()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("export to a full queue: %v, want ResourceExhausted", err)
+	}
+
+	r, _ = newTestReceiver([]config.OTLPToken{{Token: "t1"}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AUTHORIZATION_HEADER, "Bearer t0"))
+	if _, err := r.Export(ctx, testRequest()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("export with a bad token: %v, want Unauthenticated", err)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(AUTHORIZATION_HEADER, "Bearer t1"))
+	if _, err := r.Export(ctx, testRequest()); err != nil {
+		t.Errorf("export with token failed: %s", err)
+	}
+}
+
+func TestLogsAndMetrics(t *testing.T) {
+	r, _ := newTestReceiver(nil)
+	jsonBody := []byte(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"l1"}},{"body":{"stringValue":"l2"}}]}]}]}`)
+	metricsRequest := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{{
+					Name: "m",
+					Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+						{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+						{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 2}},
+					}}},
+				}},
+			}},
+		}},
+	}
+
+	// not registered
+	req := httptest.NewRequest("POST", OTLP_HTTP_LOGS_PATH, bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	rec := httptest.NewRecorder()
+	r.handleHTTPLogs(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("logs before registration: code = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if _, err := (&metricsService{r: r}).Export(context.Background(), metricsRequest); status.Code(err) != codes.Unimplemented {
+		t.Errorf("metrics before registration: %v, want Unimplemented", err)
+	}
+
+	logsQueues := &mockQueues{items: make([][]*receiver.RecvBuffer, 1)}
+	metricsQueues := &mockQueues{items: make([][]*receiver.RecvBuffer, 1)}
+	r.RegistQueues(SIGNAL_LOGS, logsQueues, 1, 100)
+	r.RegistQueues(SIGNAL_METRICS, metricsQueues, 1, 100)
+
+	req = httptest.NewRequest("POST", OTLP_HTTP_LOGS_PATH, bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	rec = httptest.NewRecorder()
+	r.handleHTTPLogs(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logs: code = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	queued := logsQueues.all()
+	if len(queued) != 1 {
+		t.Fatalf("queued %d logs buffers, want 1", len(queued))
+	}
+	data := queued[0].Buffer[queued[0].Begin+4 : queued[0].End]
+	logsData := &logspb.LogsData{}
+	if err := proto.Unmarshal(data, logsData); err != nil {
+		t.Fatalf("unmarshal queued LogsData failed: %s", err)
+	}
+	if records := logsData.ResourceLogs[0].ScopeLogs[0].LogRecords; len(records) != 2 || records[1].Body.GetStringValue() != "l2" {
+		t.Errorf("queued log records = %v", records)
+	}
+
+	if _, err := (&metricsService{r: r}).Export(context.Background(), metricsRequest); err != nil {
+		t.Fatalf("export metrics failed: %s", err)
+	}
+	queued = metricsQueues.all()
+	if len(queued) != 1 {
+		t.Fatalf("queued %d metrics buffers, want 1", len(queued))
+	}
+	metricsData := &metricspb.MetricsData{}
+	if err := proto.Unmarshal(queued[0].Buffer[queued[0].Begin+4:queued[0].End], metricsData); err != nil {
+		t.Fatalf("unmarshal queued MetricsData failed: %s", err)
+	}
+
+	if _, err := (&logsService{r: r}).Export(context.Background(), &collogspb.ExportLogsServiceRequest{}); err != nil {
+		t.Errorf("export empty logs failed: %s", err)
+	}
+
+	counter := r.anonymous.GetCounter().(*Counter)
+	if counter.Requests != 2 || counter.Logs != 2 || counter.Points != 2 || counter.Spans != 0 {
+		t.Errorf("tenant counter = %+v", counter)
+	}
+}
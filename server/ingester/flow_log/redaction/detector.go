@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redaction
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+)
+
+var detectors = map[string]*regexp.Regexp{
+	// '%40' is the url-encoded '@'
+	config.RedactionDetectorEmail: regexp.MustCompile(`[A-Za-z0-9._+-]+(?:@|%40)[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	// the header of a JWT always starts with '{"' which is 'eyJ' in base64
+	config.RedactionDetectorJWT: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	// 13 to 19 digits, separated by spaces or dashes, checked by luhnValid
+	config.RedactionDetectorPAN: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	// international numbers with '+', (xxx) xxx-xxxx, xxx-xxx-xxxx and mobile numbers of China,
+	// plain digits are not matched since they are more likely to be ids or timestamps
+	config.RedactionDetectorPhone: regexp.MustCompile(`\+\d{1,3}[ -]?\d{1,4}(?:[ -]?\d{2,4}){2,3}\b|\(\d{3}\) ?\d{3}-\d{4}\b|\b\d{3}-\d{3}-\d{4}\b|\b1[3-9]\d{9}\b`),
+}
+
+// luhnValid checks the digits of a card number with the Luhn algorithm
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// maskQueryValues replaces the values of the keys in the query string of the url
+func maskQueryValues(s string, keys map[string]bool, replacement string) (string, int) {
+	start := strings.IndexByte(s, '?')
+	if start < 0 {
+		return s, 0
+	}
+	end := len(s)
+	if i := strings.IndexByte(s[start:], '#'); i >= 0 {
+		end = start + i
+	}
+
+	var b strings.Builder
+	masked := 0
+	last := start + 1 // start of the current key=value pair
+	for i := start + 1; i <= end; i++ {
+		if i < end && s[i] != '&' && s[i] != ';' {
+			continue
+		}
+		pair := s[last:i]
+		if eq := strings.IndexByte(pair, '='); eq >= 0 && eq+1 < len(pair) && keys[strings.ToLower(pair[:eq])] {
+			if masked == 0 {
+				b.Grow(len(s))
+				b.WriteString(s[:last])
+			}
+			b.WriteString(pair[:eq+1])
+			b.WriteString(replacement)
+			masked++
+		} else if masked > 0 {
+			b.WriteString(pair)
+		}
+		if masked > 0 && i < end {
+			b.WriteByte(s[i])
+		}
+		last = i + 1
+	}
+	if masked == 0 {
+		return s, 0
+	}
+	b.WriteString(s[end:])
+	return b.String(), masked
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == ':' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isNumberChar(c byte) bool {
+	return c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// maskSQLLiterals replaces the string and number literals of the sql statement,
+// the double quoted strings are identifiers if ansiQuotes is true (PostgreSQL, Oracle),
+// and an unterminated string of a truncated statement is masked to the end
+func maskSQLLiterals(s string, ansiQuotes bool, replacement string) (string, int) {
+	if strings.IndexAny(s, "'\"0123456789") < 0 {
+		return s, 0
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	masked := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' && !ansiQuotes:
+			j := i + 1
+			for j < len(s) {
+				if s[j] == '\\' {
+					j += 2
+					continue
+				}
+				if s[j] == c {
+					// doubled quote is an escaped quote
+					if j+1 < len(s) && s[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			b.WriteString(replacement)
+			masked++
+			i = j + 1
+		case c == '`' || c == '"':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				b.WriteString(s[i:])
+				i = len(s)
+			} else {
+				b.WriteString(s[i : i+j+2])
+				i += j + 2
+			}
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentChar(s[i-1])):
+			j := i + 1
+			for j < len(s) {
+				if isNumberChar(s[j]) {
+					j++
+				} else if (s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E') {
+					// exponent of a float
+					j++
+				} else {
+					break
+				}
+			}
+			b.WriteString(replacement)
+			masked++
+			i = j
+		case c == '-' && i+1 < len(s) && s[i+1] == '-':
+			// comment to the end of the line
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = len(s) - i
+			}
+			b.WriteString(s[i : i+j])
+			i += j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	if masked == 0 {
+		return s, 0
+	}
+	return b.String(), masked
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redaction
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+const (
+	DEFAULT_REPLACEMENT     = "***"
+	DEFAULT_SQL_REPLACEMENT = "?"
+
+	FIELD_ATTRIBUTES = "attributes"
+)
+
+type ruleType uint8
+
+const (
+	RULE_REGEX ruleType = iota
+	RULE_DETECTOR
+	RULE_QUERY_KEYS
+	RULE_SQL_LITERALS
+)
+
+// the fields which can be redacted, named by the columns of flow_log.l7_flow_log
+var stringFields = map[string]func(l *log_data.L7FlowLog) *string{
+	"request_domain":     func(l *log_data.L7FlowLog) *string { return &l.RequestDomain },
+	"request_resource":   func(l *log_data.L7FlowLog) *string { return &l.RequestResource },
+	"endpoint":           func(l *log_data.L7FlowLog) *string { return &l.Endpoint },
+	"response_exception": func(l *log_data.L7FlowLog) *string { return &l.ResponseException },
+	"response_result":    func(l *log_data.L7FlowLog) *string { return &l.ResponseResult },
+	"events":             func(l *log_data.L7FlowLog) *string { return &l.Events },
+}
+
+var defaultFields = map[ruleType][]string{
+	RULE_REGEX:        {"request_domain", "request_resource", "endpoint", "response_exception", "response_result", "events", FIELD_ATTRIBUTES},
+	RULE_DETECTOR:     {"request_domain", "request_resource", "endpoint", "response_exception", "response_result", "events", FIELD_ATTRIBUTES},
+	RULE_QUERY_KEYS:   {"request_resource", "endpoint", FIELD_ATTRIBUTES},
+	RULE_SQL_LITERALS: {"request_resource"},
+}
+
+type Counter struct {
+	HitCount  int64 `statsd:"hit-count"`  // number of flow logs changed by the rule
+	MaskCount int64 `statsd:"mask-count"` // number of values replaced by the rule
+}
+
+type Rule struct {
+	name        string
+	typ         ruleType
+	orgIds      map[uint16]bool // nil means all orgs
+	fields      []func(l *log_data.L7FlowLog) *string
+	attributes  bool
+	re          *regexp.Regexp
+	isPAN       bool
+	queryKeys   map[string]bool
+	replacement string
+
+	hitCount, maskCount int64
+	utils.Closable
+}
+
+func newRule(cfg *config.RedactionRuleConfig) (*Rule, error) {
+	r := &Rule{
+		name:        cfg.Name,
+		replacement: cfg.Replacement,
+	}
+	switch {
+	case cfg.Regex != "":
+		r.typ = RULE_REGEX
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("flow-log-redaction rule %s: invalid regex: %s", cfg.Name, err)
+		}
+		r.re = re
+	case cfg.Detector != "":
+		r.typ = RULE_DETECTOR
+		re, ok := detectors[cfg.Detector]
+		if !ok {
+			return nil, fmt.Errorf("flow-log-redaction rule %s: invalid detector '%s'", cfg.Name, cfg.Detector)
+		}
+		r.re = re
+		r.isPAN = cfg.Detector == config.RedactionDetectorPAN
+	case len(cfg.QueryKeys) > 0:
+		r.typ = RULE_QUERY_KEYS
+		r.queryKeys = make(map[string]bool, len(cfg.QueryKeys))
+		for _, key := range cfg.QueryKeys {
+			r.queryKeys[strings.ToLower(key)] = true
+		}
+	case cfg.SQLLiterals:
+		r.typ = RULE_SQL_LITERALS
+	default:
+		return nil, fmt.Errorf("flow-log-redaction rule %s: one of regex, detector, query-keys and sql-literals should be set", cfg.Name)
+	}
+	if r.replacement == "" {
+		if r.typ == RULE_SQL_LITERALS {
+			r.replacement = DEFAULT_SQL_REPLACEMENT
+		} else {
+			r.replacement = DEFAULT_REPLACEMENT
+		}
+	}
+
+	if len(cfg.OrgIDs) > 0 {
+		r.orgIds = make(map[uint16]bool, len(cfg.OrgIDs))
+		for _, orgId := range cfg.OrgIDs {
+			r.orgIds[orgId] = true
+		}
+	}
+
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = defaultFields[r.typ]
+	}
+	for _, name := range fields {
+		if name == FIELD_ATTRIBUTES {
+			if r.typ == RULE_SQL_LITERALS {
+				return nil, fmt.Errorf("flow-log-redaction rule %s: sql-literals only supports request_resource", cfg.Name)
+			}
+			r.attributes = true
+			continue
+		}
+		ptr, ok := stringFields[name]
+		if !ok {
+			return nil, fmt.Errorf("flow-log-redaction rule %s: unsupported field '%s'", cfg.Name, name)
+		}
+		if r.typ == RULE_SQL_LITERALS && name != "request_resource" {
+			return nil, fmt.Errorf("flow-log-redaction rule %s: sql-literals only supports request_resource", cfg.Name)
+		}
+		r.fields = append(r.fields, ptr)
+	}
+	return r, nil
+}
+
+func (r *Rule) GetCounter() interface{} {
+	return &Counter{
+		HitCount:  atomic.SwapInt64(&r.hitCount, 0),
+		MaskCount: atomic.SwapInt64(&r.maskCount, 0),
+	}
+}
+
+func (r *Rule) matchOrg(orgId uint16) bool {
+	return r.orgIds == nil || r.orgIds[orgId]
+}
+
+func (r *Rule) replace(s string) (string, int) {
+	if s == "" {
+		return s, 0
+	}
+	masked := 0
+	result := r.re.ReplaceAllStringFunc(s, func(m string) string {
+		if r.isPAN && !luhnValid(m) {
+			return m
+		}
+		masked++
+		return r.replacement
+	})
+	if masked == 0 {
+		return s, 0
+	}
+	return result, masked
+}
+
+// redactString returns the redacted value and the number of replaced parts
+func (r *Rule) redactString(s string, l7Protocol datatype.L7Protocol) (string, int) {
+	switch r.typ {
+	case RULE_REGEX, RULE_DETECTOR:
+		return r.replace(s)
+	case RULE_QUERY_KEYS:
+		return maskQueryValues(s, r.queryKeys, r.replacement)
+	case RULE_SQL_LITERALS:
+		switch l7Protocol {
+		case datatype.L7_PROTOCOL_MYSQL:
+			return maskSQLLiterals(s, false, r.replacement)
+		case datatype.L7_PROTOCOL_POSTGRE, datatype.L7_PROTOCOL_ORACLE, datatype.L7_PROTOCOL_DAMENG:
+			return maskSQLLiterals(s, true, r.replacement)
+		}
+	}
+	return s, 0
+}
+
+func (r *Rule) redact(l *log_data.L7FlowLog) {
+	masked := 0
+	l7Protocol := datatype.L7Protocol(l.L7Protocol)
+	for _, ptr := range r.fields {
+		v, n := r.redactString(*ptr(l), l7Protocol)
+		if n > 0 {
+			*ptr(l) = v
+			masked += n
+		}
+	}
+	if r.attributes {
+		for i := range l.AttributeValues {
+			if r.typ == RULE_QUERY_KEYS && i < len(l.AttributeNames) && r.queryKeys[strings.ToLower(l.AttributeNames[i])] {
+				if l.AttributeValues[i] != "" && l.AttributeValues[i] != r.replacement {
+					l.AttributeValues[i] = r.replacement
+					masked++
+				}
+				continue
+			}
+			v, n := r.redactString(l.AttributeValues[i], l7Protocol)
+			if n > 0 {
+				l.AttributeValues[i] = v
+				masked += n
+			}
+		}
+	}
+	if masked > 0 {
+		atomic.AddInt64(&r.hitCount, 1)
+		atomic.AddInt64(&r.maskCount, int64(masked))
+	}
+}
+
+// Redactor masks the sensitive data of l7_flow_log by the rules in order,
+// it is shared by the decoders since the rules are immutable
+type Redactor struct {
+	rules []*Rule
+}
+
+func newRedactor(cfg *config.RedactionConfig) (*Redactor, error) {
+	rules := make([]*Rule, 0, len(cfg.Rules))
+	for i := range cfg.Rules {
+		r, err := newRule(&cfg.Rules[i])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// NewRedactor compiles the rules and registers the hit counters of each rule
+func NewRedactor(cfg *config.RedactionConfig) (*Redactor, error) {
+	r, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range r.rules {
+		common.RegisterCountableForIngester("flow_log_redaction", rule, stats.OptionStatTags{"rule": rule.name})
+	}
+	return r, nil
+}
+
+// Redact is called before the flow log is written or exported
+func (r *Redactor) Redact(l *log_data.L7FlowLog) {
+	for _, rule := range r.rules {
+		if rule.matchOrg(l.OrgId) {
+			rule.redact(l)
+		}
+	}
+}
+
+func (r *Redactor) Close() {
+	for _, rule := range r.rules {
+		rule.Closable.Close()
+	}
+}
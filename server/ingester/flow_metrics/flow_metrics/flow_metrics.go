@@ -52,11 +52,12 @@ func NewFlowMetrics(cfg *config.Config, recv *receiver.Receiver, platformDataMan
 
 	manager := queue.NewManager(ingesterctl.INGESTERCTL_FLOW_METRICS_QUEUE)
 	unmarshallQueueCount := int(cfg.UnmarshallQueueCount)
-	unmarshallQueues := manager.NewQueuesUnmarshal(
+	unmarshallQueues := queue.NewTypedQueuesUnmarshal[*receiver.RecvBuffer](
+		manager,
 		"1-recv-unmarshall", int(cfg.UnmarshallQueueSize), unmarshallQueueCount, 1,
 		unmarshaller.DecodeForQueueMonitor,
 		libqueue.OptionFlushIndicator(unmarshaller.FLUSH_INTERVAL*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 
 	recv.RegistHandler(datatype.MESSAGE_TYPE_METRICS, unmarshallQueues, unmarshallQueueCount)
 
@@ -85,7 +86,8 @@ func NewFlowMetrics(cfg *config.Config, recv *receiver.Receiver, platformDataMan
 			return nil, err
 		}
 
-		flowMetrics.unmarshallers[i] = unmarshaller.NewUnmarshaller(i, flowMetrics.platformDatas[i], cfg.DisableSecondWrite, libqueue.QueueReader(unmarshallQueues.FixedMultiQueue[i]), flowMetrics.dbwriter, exporters, appServiceTagWriter)
+		flowMetrics.unmarshallers[i] = unmarshaller.NewUnmarshaller(i, flowMetrics.platformDatas[i], cfg.DisableSecondWrite, unmarshallQueues.TypedMultiQueue[i], flowMetrics.dbwriter, exporters, appServiceTagWriter)
+		flowMetrics.unmarshallers[i].SetQuota(recv.QuotaManager())
 	}
 
 	return &flowMetrics, nil
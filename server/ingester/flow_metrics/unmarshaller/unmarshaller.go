@@ -36,6 +36,7 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/flow-metrics/pb"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -67,6 +68,7 @@ type Counter struct {
 	ExpiredDocCount int64 `statsd:"expired-doc-count"`
 	FutureDocCount  int64 `statsd:"future-doc-count"`
 	DropDocCount    int64 `statsd:"drop-doc-count"`
+	QuotaDropCount  int64 `statsd:"quota-drop-count"` // messages dropped by the rows-per-day quotas
 	TotalTime       int64 `statsd:"total-time"`
 	AvgTime         int64 `statsd:"avg-time"`
 
@@ -82,17 +84,18 @@ type Unmarshaller struct {
 	index               int
 	platformData        *grpc.PlatformInfoTable
 	disableSecondWrite  bool
-	unmarshallQueue     queue.QueueReader
+	unmarshallQueue     queue.TypedQueueReader[*receiver.RecvBuffer]
 	dbwriter            dbwriter.DbWriter
 	queueBatchCache     QueueCache
 	counter             *Counter
 	tableCounter        [flow_metrics.METRICS_TABLE_ID_MAX + 1]int64
 	exporters           *exporters.Exporters
 	appServiceTagWriter *flow_tag.AppServiceTagWriter
+	quotaRows           *quota.RowCounter
 	utils.Closable
 }
 
-func NewUnmarshaller(index int, platformData *grpc.PlatformInfoTable, disableSecondWrite bool, unmarshallQueue queue.QueueReader, dbwriter dbwriter.DbWriter, exporters *exporters.Exporters, appServiceTagWriter *flow_tag.AppServiceTagWriter) *Unmarshaller {
+func NewUnmarshaller(index int, platformData *grpc.PlatformInfoTable, disableSecondWrite bool, unmarshallQueue queue.TypedQueueReader[*receiver.RecvBuffer], dbwriter dbwriter.DbWriter, exporters *exporters.Exporters, appServiceTagWriter *flow_tag.AppServiceTagWriter) *Unmarshaller {
 	return &Unmarshaller{
 		index:               index,
 		platformData:        platformData,
@@ -105,6 +108,11 @@ func NewUnmarshaller(index int, platformData *grpc.PlatformInfoTable, disableSec
 	}
 }
 
+// SetQuota enables the rows-per-day quotas of flow_metrics
+func (u *Unmarshaller) SetQuota(m *quota.Manager) {
+	u.quotaRows = m.NewRowCounter(quota.FLOW_METRICS)
+}
+
 func max(a, b int64) int64 {
 	if a > b {
 		return a
@@ -219,63 +227,68 @@ func decodeForDebug(b []byte) (BatchDocument, error) {
 
 func (u *Unmarshaller) QueueProcess() {
 	common.RegisterCountableForIngester("unmarshaller", u, stats.OptionStatTags{"thread": strconv.Itoa(u.index)})
-	rawDocs := make([]interface{}, GET_MAX_SIZE)
+	rawDocs := make([]*receiver.RecvBuffer, GET_MAX_SIZE)
 	decoder := &codec.SimpleDecoder{}
 	pbDoc := pb.NewDocument()
 	for !u.Closed() {
 		n := u.unmarshallQueue.Gets(rawDocs)
 		start := time.Now()
 		for i := 0; i < n; i++ {
-			value := rawDocs[i]
-			if recvBytes, ok := value.(*receiver.RecvBuffer); ok {
-				bytes := recvBytes.Buffer[recvBytes.Begin:recvBytes.End]
-				decoder.Init(bytes)
-				for !decoder.Failed() && !decoder.IsEnd() {
-					pbDoc.ResetAll()
-					doc, err := app.DecodePB(decoder, pbDoc)
-					if err != nil {
-						u.counter.ErrDocCount++
-						log.Warningf("Decode failed, bytes len=%d err=%s", len([]byte(bytes)), err)
-						break
-					}
-					doc.Tags().TeamID = uint16(recvBytes.TeamID)
-					doc.Tags().OrgId = uint16(recvBytes.OrgID)
-					u.isGoodDocument(int64(doc.Time()))
-
-					// 秒级数据是否写入
-					if u.disableSecondWrite &&
-						doc.Flag()&app.FLAG_PER_SECOND_METRICS != 0 {
-						doc.Release()
-						continue
-					}
-
-					if err := DocumentExpand(doc, u.platformData); err != nil {
-						log.Debug(err)
-						u.counter.DropDocCount++
-						doc.Release()
-						continue
-					}
-
-					tableID, err := doc.TableID()
-					if err != nil {
-						log.Debug(err)
-						u.counter.DropDocCount++
-						doc.Release()
-						continue
-					}
-					u.tableCounter[tableID]++
-
-					u.appServiceTagWrite(tableID, doc)
-					u.export(doc)
-					u.putStoreQueue(doc)
-				}
-				receiver.ReleaseRecvBuffer(recvBytes)
-			} else if value == nil { // flush ticker
+			recvBytes := rawDocs[i]
+			if recvBytes == nil { // flush ticker
 				u.flushStoreQueue()
 				u.export(nil)
-			} else {
-				log.Warning("get unmarshall queue data type wrong")
+				continue
+			}
+			if !u.quotaRows.Begin(recvBytes.OrgID, recvBytes.TeamID) {
+				u.counter.QuotaDropCount++
+				receiver.ReleaseRecvBuffer(recvBytes)
+				continue
+			}
+			bytes := recvBytes.Buffer[recvBytes.Begin:recvBytes.End]
+			decoder.Init(bytes)
+			for !decoder.Failed() && !decoder.IsEnd() {
+				pbDoc.ResetAll()
+				doc, err := app.DecodePB(decoder, pbDoc)
+				if err != nil {
+					u.counter.ErrDocCount++
+					log.Warningf("Decode failed, bytes len=%d err=%s", len([]byte(bytes)), err)
+					break
+				}
+				doc.Tags().TeamID = uint16(recvBytes.TeamID)
+				doc.Tags().OrgId = uint16(recvBytes.OrgID)
+				u.isGoodDocument(int64(doc.Time()))
+
+				// 秒级数据是否写入
+				if u.disableSecondWrite &&
+					doc.Flag()&app.FLAG_PER_SECOND_METRICS != 0 {
+					doc.Release()
+					continue
+				}
+
+				if err := DocumentExpand(doc, u.platformData); err != nil {
+					log.Debug(err)
+					u.counter.DropDocCount++
+					doc.Release()
+					continue
+				}
+
+				tableID, err := doc.TableID()
+				if err != nil {
+					log.Debug(err)
+					u.counter.DropDocCount++
+					doc.Release()
+					continue
+				}
+				u.tableCounter[tableID]++
+
+				u.appServiceTagWrite(tableID, doc)
+				u.export(doc)
+				u.putStoreQueue(doc)
+				u.quotaRows.Add(1)
 			}
+			u.quotaRows.End()
+			receiver.ReleaseRecvBuffer(recvBytes)
 		}
 		u.counter.TotalTime += int64(time.Since(start))
 	}
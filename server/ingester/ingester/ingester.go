@@ -22,15 +22,18 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/ingester/app_log"
 	"github.com/deepflowio/deepflow/server/ingester/ckmonitor"
 	"github.com/deepflowio/deepflow/server/ingester/datasource"
 	"github.com/deepflowio/deepflow/server/ingester/exporters"
+	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/logger"
 	"github.com/deepflowio/deepflow/server/libs/pool"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 
@@ -42,6 +45,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/ckissu"
 	"github.com/deepflowio/deepflow/server/ingester/common"
 	"github.com/deepflowio/deepflow/server/ingester/config"
+	dropletqueue "github.com/deepflowio/deepflow/server/ingester/droplet/queue"
 	eventcfg "github.com/deepflowio/deepflow/server/ingester/event/config"
 	"github.com/deepflowio/deepflow/server/ingester/event/event"
 	exporterscfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
@@ -49,14 +53,19 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/ext_metrics/ext_metrics"
 	flowlogcfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
 	flowlog "github.com/deepflowio/deepflow/server/ingester/flow_log/flow_log"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/otlp_receiver"
 	flowmetricscfg "github.com/deepflowio/deepflow/server/ingester/flow_metrics/config"
 	flowmetrics "github.com/deepflowio/deepflow/server/ingester/flow_metrics/flow_metrics"
+	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/ingester/kafka_consumer"
+	kafkaconsumercfg "github.com/deepflowio/deepflow/server/ingester/kafka_consumer/config"
 	pcapcfg "github.com/deepflowio/deepflow/server/ingester/pcap/config"
 	"github.com/deepflowio/deepflow/server/ingester/pcap/pcap"
 	profilecfg "github.com/deepflowio/deepflow/server/ingester/profile/config"
 	"github.com/deepflowio/deepflow/server/ingester/profile/profile"
 	prometheuscfg "github.com/deepflowio/deepflow/server/ingester/prometheus/config"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/prometheus"
+	"github.com/deepflowio/deepflow/server/ingester/prometheus/scrape"
 )
 
 var log = logging.MustGetLogger("ingester")
@@ -93,10 +102,28 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 	stats.SetRemoteType(stats.REMOTE_TYPE_DFSTATSD)
 	stats.SetDFRemote(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(cfg.ListenPort))))
 
+	for _, o := range cfg.QueueOptions {
+		dropletqueue.SetQueueOptions(o.Name, o.Options()...)
+	}
+
 	receiver := receiver.NewReceiver(int(cfg.ListenPort), cfg.UDPReadBuffer, cfg.TCPReadBuffer, cfg.TCPReaderBuffer)
+	var quotaSyncer *QuotaSyncer
+	if cfg.Quota.Enabled {
+		// the decoders get the quotas from the receiver, so it is set before the modules are created
+		quotaManager, err := quota.NewManager(cfg.Quota.Limits())
+		checkError(err)
+		receiver.SetQuotaManager(quotaManager)
+		common.RegisterCountableForIngester("quota", quotaManager)
+		debug.ServerRegisterSimple(ingesterctl.CMD_QUOTA, quotaManager)
+		quotaSyncer = NewQuotaSyncer(cfg, quotaManager)
+	}
 
 	ingesterOrgHandler := NewOrgHandler(cfg)
 	closers := []io.Closer{}
+	if quotaSyncer != nil {
+		quotaSyncer.Start()
+		closers = append(closers, quotaSyncer)
+	}
 
 	if cfg.IngesterEnabled {
 		flowLogConfig := flowlogcfg.Load(cfg, configPath)
@@ -135,6 +162,12 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 		bytes, _ = yaml.Marshal(exportersConfig)
 		log.Infof("exporters config:\n%s", string(bytes))
 
+		kafkaConsumerConfig := kafkaconsumercfg.Load(cfg, configPath)
+		// the throttlers of flow_log keep the data for throttle-bucket, and emit it at the next flush of the decoders
+		kafkaConsumerConfig.DecoderDelay = flowLogConfig.ThrottleBucket + int(flowlog.DECODE_QUEUE_FLUSH_INTERVAL/time.Second)
+		bytes, _ = yaml.Marshal(kafkaConsumerConfig)
+		log.Infof("kafka consumer config:\n%s", string(bytes))
+
 		var issu *ckissu.Issu
 		if !cfg.StorageDisabled {
 			var err error
@@ -146,6 +179,22 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 			// clickhouse表结构变更处理
 			issu, err = ckissu.NewCKIssu(cfg)
 			checkError(err)
+			if cfg.CKIssu.Mode == config.CKIssuModePlan {
+				// the ingester runs in the same process as the controller and querier, so only the
+				// ingester is not started on the tables which are not upgraded, the plan is logged
+				steps, err := issu.Plan()
+				issu.Close()
+				if err != nil {
+					log.Errorf("ckissu plan failed: %s", err)
+				} else {
+					var plan strings.Builder
+					ckissu.PrintPlan(&plan, steps)
+					log.Infof("ckissu plan:\n%s", plan.String())
+				}
+				log.Warning("ckissu plan mode, the schema changes are not applied and the ingester is not started")
+				servercommon.SetOrgHandler(ingesterOrgHandler)
+				return closers
+			}
 			// If there is a table name change, do the table name update first
 			err = issu.RunRenameTable(ds)
 			checkError(err)
@@ -154,6 +203,16 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 
 			err = issu.Start()
 			checkError(err)
+			if cfg.CKIssu.VerifySchema {
+				diffs, err := issu.Verify(ckissu.SchemaTables(cfg))
+				if err != nil {
+					log.Warningf("ckissu verify schema failed: %s", err)
+				} else {
+					var result strings.Builder
+					ckissu.PrintSchemaDiffs(&result, diffs)
+					log.Infof("ckissu verify schema:\n%s", result.String())
+				}
+			}
 			// after issu execution is completed, should close it to prevent the connection from occupying memory.
 			issu.Close()
 			issu = nil
@@ -219,18 +278,42 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 			closers = append(closers, profile)
 
 			// write prometheus data
-			prometheus, err := prometheus.NewPrometheusHandler(prometheusConfig, receiver, platformDataManager)
+			prometheus, err := prometheus.NewPrometheusHandler(prometheusConfig, shared.PrometheusQueue, receiver, platformDataManager)
 			checkError(err)
 			prometheus.Start()
 			closers = append(closers, prometheus)
 			ingesterOrgHandler.SetPromHandler(prometheus)
 
+			// scrape the prometheus targets, and write the samples through the prometheus handler
+			if prometheusConfig.Scrape.Enabled {
+				scraper := newPrometheusScraper(cfg, &prometheusConfig.Scrape, shared)
+				scraper.Start()
+				closers = append(closers, scraper)
+				common.RegisterCountableForIngester("prometheus_scrape", scraper)
+				debug.ServerRegisterSimple(ingesterctl.CMD_PROMETHEUS_SCRAPE, scraper)
+			}
+
 			// write application log data
 			applicationLog, err := app_log.NewApplicationLogger(applicationLogConfig, receiver, platformDataManager)
 			checkError(err)
 			applicationLog.Start()
 			closers = append(closers, applicationLog)
 
+			// route the OTLP logs and metrics to application_log and ext_metrics
+			if flowLog.OTLPReceiver != nil {
+				flowLog.OTLPReceiver.RegistQueues(otlp_receiver.SIGNAL_LOGS, applicationLog.OTelLogger.DecodeQueues,
+					applicationLogConfig.DecoderQueueCount, applicationLogConfig.DecoderQueueSize)
+				flowLog.OTLPReceiver.RegistQueues(otlp_receiver.SIGNAL_METRICS, extMetrics.OTelMetrics.DecodeQueues,
+					extMetricsConfig.DecoderQueueCount, extMetricsConfig.DecoderQueueSize)
+			}
+
+			// consume the agent messages and OTLP requests from kafka, after all decoders are registered
+			if kafkaConsumerConfig.Enabled {
+				kafkaConsumer := kafka_consumer.NewKafkaConsumer(kafkaConsumerConfig, receiver, flowLog.OTLPReceiver)
+				checkError(kafkaConsumer.Start())
+				closers = append(closers, kafkaConsumer)
+			}
+
 			// 检查clickhouse的磁盘空间占用，达到阈值时，自动删除老数据
 			cm, err := ckmonitor.NewCKMonitor(cfg)
 			checkError(err)
@@ -252,3 +335,18 @@ func checkError(err error) {
 		os.Exit(1)
 	}
 }
+
+// newPrometheusScraper distributes the targets across the deepflow-servers known by the watcher,
+// in standalone mode there is no watcher and all the targets are scraped by this server
+func newPrometheusScraper(cfg *config.Config, scrapeConfig *scrape.Config, shared *servercommon.ControllerIngesterShared) *scrape.Manager {
+	var members scrape.Members
+	self := ""
+	if watcher := cfg.CKDB.Watcher; watcher != nil {
+		members = watcher.NodePodNamesWatch.GetServerPodNames
+		self = watcher.MyPodName()
+	}
+	write := func(orgId uint16, compressed []byte) error {
+		return shared.PrometheusQueue.Put(&servercommon.PrometheusWriteRequest{OrgID: orgId, Compressed: compressed})
+	}
+	return scrape.NewManager(scrapeConfig, shared.DiscoverPrometheusTargets, members, self, write)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/trident"
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/quota"
+)
+
+// QuotaSyncer syncs the quotas saved by the controller API of each org to the quota manager
+type QuotaSyncer struct {
+	manager     *quota.Manager
+	grpcSession *grpc.GrpcSession
+}
+
+func NewQuotaSyncer(cfg *config.Config, manager *quota.Manager) *QuotaSyncer {
+	s := &QuotaSyncer{
+		manager:     manager,
+		grpcSession: &grpc.GrpcSession{},
+	}
+	runOnce := func() {
+		orgIds := grpc.QueryAllOrgIDs()
+		exists := make(map[uint16]bool, len(orgIds))
+		for _, orgId := range orgIds {
+			exists[orgId] = true
+			// the current quotas are kept if the controller is not available
+			if err := s.sync(orgId); err != nil {
+				log.Warningf("sync quotas of org %d failed: %s", orgId, err)
+			}
+		}
+		for orgId := 0; orgId < quota.MAX_ORG_COUNT; orgId++ {
+			if !exists[uint16(orgId)] {
+				s.manager.Sync(uint16(orgId), nil)
+			}
+		}
+	}
+	controllers := make([]net.IP, len(cfg.ControllerIPs))
+	for i, ipString := range cfg.ControllerIPs {
+		controllers[i] = net.ParseIP(ipString)
+		if controllers[i].To4() != nil {
+			controllers[i] = controllers[i].To4()
+		}
+	}
+	s.grpcSession.Init(controllers, cfg.ControllerPort, time.Duration(cfg.Quota.SyncInterval)*time.Second, cfg.GrpcBufferSize, runOnce)
+	return s
+}
+
+func (s *QuotaSyncer) sync(orgId uint16) error {
+	var response *trident.IngesterQuotasResponse
+	err := s.grpcSession.Request(func(ctx context.Context, remote net.IP) error {
+		var err error
+		c := s.grpcSession.GetClient()
+		if c == nil {
+			return fmt.Errorf("can't get grpc client to %s", remote)
+		}
+		client := trident.NewSynchronizerClient(c)
+		response, err = client.GetIngesterQuotas(ctx, &trident.IngesterQuotasRequest{
+			OrgId: proto.Uint32(uint32(orgId)),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	limits := make([]quota.Limit, 0, len(response.GetQuotas()))
+	for _, q := range response.GetQuotas() {
+		l := quota.Limit{
+			OrgId:             orgId,
+			TeamId:            q.GetTeamId(),
+			MessagesPerSecond: q.GetMessagesPerSecond(),
+			BytesPerSecond:    q.GetBytesPerSecond(),
+		}
+		if q.GetAction() != "" {
+			action, err := quota.ParseAction(q.GetAction())
+			if err != nil {
+				log.Warningf("ignore quota of org %d team %d: %s", orgId, l.TeamId, err)
+				continue
+			}
+			l.Action = action
+		}
+		valid := true
+		for _, r := range q.GetRowsPerDay() {
+			ds, err := quota.ParseDatasource(r.GetDatasource())
+			if err != nil {
+				log.Warningf("ignore quota of org %d team %d: %s", orgId, l.TeamId, err)
+				valid = false
+				break
+			}
+			l.RowsPerDay[ds] = r.GetRows()
+		}
+		if valid {
+			limits = append(limits, l)
+		}
+	}
+	s.manager.Sync(orgId, limits)
+	return nil
+}
+
+func (s *QuotaSyncer) Start() {
+	s.grpcSession.Start()
+}
+
+func (s *QuotaSyncer) Close() error {
+	s.grpcSession.Close()
+	return nil
+}
@@ -19,20 +19,26 @@ package cmd
 import (
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"time"
 	"unicode"
 
 	"github.com/spf13/cobra"
 
+	"github.com/deepflowio/deepflow/server/ingester/ckissu"
 	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/ingester/datasource"
 	"github.com/deepflowio/deepflow/server/ingester/droplet/profiler"
 	"github.com/deepflowio/deepflow/server/ingester/droplet/queue"
+	flowmetricscfg "github.com/deepflowio/deepflow/server/ingester/flow_metrics/config"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/decoder"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
 	"github.com/deepflowio/deepflow/server/libs/codec"
 	"github.com/deepflowio/deepflow/server/libs/debug"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/tracetree"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -99,12 +105,31 @@ func RegisterIngesterCommand(root *cobra.Command) {
 			{Cmd: "set-interval [second]", Helper: "set free os memory interval"},
 		},
 	))
+	ingesterCmd.AddCommand(debug.ClientRegisterSimple(
+		ingesterctl.CMD_ALERT_NOTIFIER,
+		debug.CmdHelper{Cmd: "alert-notifier", Helper: "alert event notifier commands"},
+		[]debug.CmdHelper{
+			{Cmd: "status", Helper: "show receivers, routes and counters of the alert notifier"},
+			{Cmd: "history [count]", Helper: "show the latest delivery records, default count: 20"},
+		},
+	))
+	ingesterCmd.AddCommand(debug.ClientRegisterSimple(
+		ingesterctl.CMD_QUOTA,
+		debug.CmdHelper{Cmd: "quota", Helper: "ingestion quotas of the orgs and teams, available if ingester.quota.enabled is true"},
+		quota.CmdHelpers,
+	))
+	ingesterCmd.AddCommand(debug.ClientRegisterSimple(
+		ingesterctl.CMD_PROMETHEUS_SCRAPE,
+		debug.CmdHelper{Cmd: "prometheus-scrape", Helper: "targets scraped by this ingester, available if ingester.prometheus-scrape.enabled is true"},
+		[]debug.CmdHelper{{Cmd: "show [job]", Helper: "show the targets scraped by this ingester and the status of the last scrape"}},
+	))
 	ingesterCmd.AddCommand(debug.ClientRegisterSimple(
 		ingesterctl.CMD_ORG_SWITCH,
 		debug.CmdHelper{Cmd: "switch-to-debug-org [org-id]", Helper: "the debugging command switches to the specified organization"},
 		nil,
 	))
 	ingesterCmd.AddCommand(RegisterDecodeTraceCommand(ip, uint16(orgId)))
+	ingesterCmd.AddCommand(RegisterCKIssuCommand(ip))
 
 	dropletCmd.AddCommand(queue.RegisterCommand(ingesterctl.INGESTERCTL_QUEUE, []string{
 		"1-receiver-to-statsd",
@@ -121,6 +146,7 @@ func RegisterIngesterCommand(root *cobra.Command) {
 	}))
 	flowLogCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_PLATFORMDATA_FLOW_LOG, debug.CmdHelper{"platformData [filter]", "show flow log platform data statistics"}, nil))
 	flowLogCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_L7_FLOW_LOG, debug.CmdHelper{"l7", "show l7 flow log counter"}, nil))
+	flowLogCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_LUA_HOOK, debug.CmdHelper{Cmd: "lua-hook [org-id]", Helper: "show lua hook plugins and script statistics"}, nil))
 
 	prometheusCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_PLATFORMDATA_PROMETHEUS, debug.CmdHelper{"platformData [filter]", "show prometheus platform data statistics"}, nil))
 	prometheusCmd.AddCommand(decoder.RegisterClientPrometheusLabelCommand())
@@ -335,3 +361,103 @@ func RegisterDecodeTraceCommand(ip string, orgId uint16) *cobra.Command {
 
 	return cmd
 }
+
+func newCKConfig(ip, username, password, ckdbType string, port uint16) *config.Config {
+	addrs := []string{net.JoinHostPort(ip, strconv.Itoa(int(port)))}
+	return &config.Config{
+		CKDB:     config.CKDB{Type: ckdbType, ActualAddrs: &addrs},
+		CKDBAuth: config.Auth{Username: username, Password: password},
+	}
+}
+
+func newCKIssu(ip, username, password, ckdbType string, port uint16) (*ckissu.Issu, error) {
+	cfg := newCKConfig(ip, username, password, ckdbType, port)
+	issu, err := ckissu.NewCKIssu(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ck(%s) failed. %s", (*cfg.CKDB.ActualAddrs)[0], err)
+	}
+	return issu, nil
+}
+
+func RegisterCKIssuCommand(ip string) *cobra.Command {
+	var username, password, ckdbType string
+	var port uint16
+	cmd := &cobra.Command{
+		Use:   "ckissu",
+		Short: "plan, apply or verify the ClickHouse table schema upgrade",
+	}
+	cmd.PersistentFlags().Uint16Var(&port, "ck-port", 9000, "ClickHouse tcp port")
+	cmd.PersistentFlags().StringVar(&username, "ck-username", "default", "ClickHouse username")
+	cmd.PersistentFlags().StringVar(&password, "ck-password", "", "ClickHouse password")
+	cmd.PersistentFlags().StringVar(&ckdbType, "ck-type", ckdb.CKDBTypeClickhouse, "database type, 'clickhouse' or 'byconity'")
+
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "print the DDLs to run per organization/database/table with the affected parts, without applying them",
+		Run: func(cmd *cobra.Command, args []string) {
+			issu, err := newCKIssu(ip, username, password, ckdbType, port)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer issu.Close()
+			steps, err := issu.Plan()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			ckissu.PrintPlan(os.Stdout, steps)
+		},
+	}
+
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "apply the table renames, table recreations, column and index changes, the steps done are recorded and skipped when applying again",
+		Run: func(cmd *cobra.Command, args []string) {
+			issu, err := newCKIssu(ip, username, password, ckdbType, port)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer issu.Close()
+			// the same order as the ingester, the datasource manager is only used to recreate the renamed datasources
+			ds := datasource.NewDatasourceManager(newCKConfig(ip, username, password, ckdbType, port), flowmetricscfg.DefaultCKReadTimeout)
+			defer ds.Close()
+			if err := issu.RunRenameTable(ds); err != nil {
+				fmt.Printf("rename tables failed. %s\n", err)
+				return
+			}
+			if err := issu.RunRecreateTables(); err != nil {
+				fmt.Printf("recreate tables failed. %s\n", err)
+				return
+			}
+			if err := issu.Start(); err != nil {
+				fmt.Printf("apply failed, run 'apply' again to continue from the failed step. %s\n", err)
+				return
+			}
+			fmt.Println("apply success. the TTL changes run asynchronously and may be interrupted when exiting, check them with 'plan'")
+		},
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "compare the flow_metrics/flow_log table schemas with the table definitions",
+		Run: func(cmd *cobra.Command, args []string) {
+			issu, err := newCKIssu(ip, username, password, ckdbType, port)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer issu.Close()
+			diffs, err := issu.Verify(ckissu.SchemaTables(&config.Config{CKDB: config.CKDB{Type: ckdbType}}))
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			ckissu.PrintSchemaDiffs(os.Stdout, diffs)
+		},
+	}
+
+	cmd.AddCommand(planCmd, applyCmd, verifyCmd)
+	return cmd
+}
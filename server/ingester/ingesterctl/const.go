@@ -59,6 +59,10 @@ const (
 	CMD_CONTINUOUS_PROFILER
 	CMD_ORG_SWITCH
 	CMD_FREE_OS_MEMORY
+	CMD_ALERT_NOTIFIER
+	CMD_LUA_HOOK
+	CMD_QUOTA
+	CMD_PROMETHEUS_SCRAPE
 )
 
 const (
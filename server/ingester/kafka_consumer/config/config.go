@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	logging "github.com/op/go-logging"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+var log = logging.MustGetLogger("kafka_consumer.config")
+
+const (
+	FORMAT_AGENT        = "agent"
+	FORMAT_OTLP_TRACES  = "otlp-traces"
+	FORMAT_OTLP_LOGS    = "otlp-logs"
+	FORMAT_OTLP_METRICS = "otlp-metrics"
+
+	ENCODING_PROTOBUF = "protobuf"
+	ENCODING_JSON     = "json"
+
+	OFFSET_NEWEST = "newest"
+	OFFSET_OLDEST = "oldest"
+
+	DefaultGroupID          = "deepflow-ingester"
+	DefaultCommitInterval   = 5 // second
+	DefaultQueueLimit       = 2048
+	DefaultRetryInterval    = 100 // millisecond
+	DefaultSessionTimeout   = 30  // second
+	DefaultRewindBackoff    = 10  // second
+	DefaultMaxRewindBackoff = 300 // second
+	DefaultMaxRewinds       = 10
+	DefaultInitialOffset    = OFFSET_NEWEST
+	DefaultMaxMessageBytes  = 16 << 20
+)
+
+// the databases which the otlp formats are written into by default, the agent format is written into all databases
+var defaultDatabases = map[string][]string{
+	FORMAT_OTLP_TRACES:  {"flow_log"},
+	FORMAT_OTLP_LOGS:    {"application_log"},
+	FORMAT_OTLP_METRICS: {"ext_metrics"},
+}
+
+type Sasl struct {
+	Enabled  bool   `yaml:"enabled"` // SASL/PLAIN
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type Topic struct {
+	Name   string `yaml:"name"`
+	Format string `yaml:"format"`
+	// the encoding of otlp formats, protobuf or json, it can be overridden by the content-type header of messages
+	Encoding string `yaml:"encoding"`
+	// the org and team of otlp formats, the agent messages have them in the headers
+	OrgID  uint16 `yaml:"org-id"`
+	TeamID uint32 `yaml:"team-id"`
+	// only the drops of the ckwriters of these databases rewind the topic, and only their flushes are waited
+	// before committing, all databases if empty
+	Databases []string `yaml:"databases"`
+}
+
+// Replay consumes the messages between the start and end time (unix seconds, by message timestamp) once, without
+// joining the consumer group or committing offsets, it is used to import the data again after fixing a bug.
+type Replay struct {
+	StartTime int64 `yaml:"start-time"`
+	EndTime   int64 `yaml:"end-time"`
+}
+
+func (r *Replay) Enabled() bool {
+	return r.StartTime > 0 || r.EndTime > 0
+}
+
+type Config struct {
+	Base          *config.Config
+	Enabled       bool     `yaml:"enabled"`
+	Brokers       []string `yaml:"brokers"`
+	Version       string   `yaml:"version"` // kafka version, e.g. "2.8.0", the default of sarama is used if empty
+	GroupID       string   `yaml:"group-id"`
+	ClientID      string   `yaml:"client-id"`
+	Sasl          Sasl     `yaml:"sasl"`
+	TLSEnabled    bool     `yaml:"tls-enabled"`
+	Topics        []Topic  `yaml:"topics"`
+	InitialOffset string   `yaml:"initial-offset"` // newest or oldest, used when the group has no committed offset
+	// offsets are committed when the data consumed before them is written into clickhouse, at the interval
+	CommitInterval int `yaml:"commit-interval"`
+	// the max time (second) the decoders keep the decoded data before putting it into ckwriters, it is set by the
+	// throttlers of flow_log which emit the data at the end of throttle-bucket
+	DecoderDelay int `yaml:"-"`
+	// stop consuming when the length of decode queue reaches it, and retry at retry-interval (millisecond)
+	QueueLimit     int `yaml:"queue-limit"`
+	RetryInterval  int `yaml:"retry-interval"`
+	SessionTimeout int `yaml:"session-timeout"`
+	// second, wait before consuming again from the committed offsets after data dropped, it doubles for each
+	// rewind in a row up to max-rewind-backoff
+	RewindBackoff    int `yaml:"rewind-backoff"`
+	MaxRewindBackoff int `yaml:"max-rewind-backoff"`
+	// after rewinding max-rewinds times in a row without committing, the dropped data is ignored until the next
+	// commit without drops, so that a table which keeps failing does not replay the topics endlessly, 0 means no limit
+	MaxRewinds      int    `yaml:"max-rewinds"`
+	MaxMessageBytes int    `yaml:"max-message-bytes"`
+	Replay          Replay `yaml:"replay"`
+}
+
+type KafkaConsumerConfig struct {
+	KafkaConsumer Config `yaml:"kafka-consumer"`
+}
+
+type IngesterConfig struct {
+	Ingester KafkaConsumerConfig `yaml:"ingester"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("kafka-consumer brokers are empty")
+	}
+	if len(c.Topics) == 0 {
+		return fmt.Errorf("kafka-consumer topics are empty")
+	}
+	for i := range c.Topics {
+		t := &c.Topics[i]
+		if t.Name == "" {
+			return fmt.Errorf("kafka-consumer topic name is empty")
+		}
+		switch t.Format {
+		case "":
+			t.Format = FORMAT_AGENT
+		case FORMAT_AGENT, FORMAT_OTLP_TRACES, FORMAT_OTLP_LOGS, FORMAT_OTLP_METRICS:
+		default:
+			return fmt.Errorf("kafka-consumer topic %s format %s is invalid", t.Name, t.Format)
+		}
+		switch t.Encoding {
+		case "":
+			t.Encoding = ENCODING_PROTOBUF
+		case ENCODING_PROTOBUF, ENCODING_JSON:
+		default:
+			return fmt.Errorf("kafka-consumer topic %s encoding %s is invalid", t.Name, t.Encoding)
+		}
+		if t.OrgID > ckdb.MAX_ORG_ID {
+			return fmt.Errorf("kafka-consumer topic %s org-id %d is larger than %d", t.Name, t.OrgID, ckdb.MAX_ORG_ID)
+		}
+		if len(t.Databases) == 0 {
+			t.Databases = defaultDatabases[t.Format]
+		}
+	}
+	if c.GroupID == "" {
+		c.GroupID = DefaultGroupID
+	}
+	if c.InitialOffset != OFFSET_OLDEST {
+		c.InitialOffset = OFFSET_NEWEST
+	}
+	if c.CommitInterval <= 0 {
+		c.CommitInterval = DefaultCommitInterval
+	}
+	if c.QueueLimit <= 0 {
+		c.QueueLimit = DefaultQueueLimit
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+	if c.SessionTimeout <= 0 {
+		c.SessionTimeout = DefaultSessionTimeout
+	}
+	if c.RewindBackoff <= 0 {
+		c.RewindBackoff = DefaultRewindBackoff
+	}
+	if c.MaxRewindBackoff < c.RewindBackoff {
+		c.MaxRewindBackoff = c.RewindBackoff
+	}
+	if c.MaxRewinds < 0 {
+		c.MaxRewinds = DefaultMaxRewinds
+	}
+	if c.MaxMessageBytes <= 0 {
+		c.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if c.Replay.Enabled() {
+		if c.Replay.EndTime == 0 || c.Replay.StartTime >= c.Replay.EndTime {
+			return fmt.Errorf("kafka-consumer replay start-time %d should be less than end-time %d", c.Replay.StartTime, c.Replay.EndTime)
+		}
+	}
+	return nil
+}
+
+func Load(base *config.Config, path string) *Config {
+	config := &IngesterConfig{
+		Ingester: KafkaConsumerConfig{
+			KafkaConsumer: Config{
+				Base:             base,
+				GroupID:          DefaultGroupID,
+				InitialOffset:    DefaultInitialOffset,
+				CommitInterval:   DefaultCommitInterval,
+				QueueLimit:       DefaultQueueLimit,
+				RetryInterval:    DefaultRetryInterval,
+				SessionTimeout:   DefaultSessionTimeout,
+				RewindBackoff:    DefaultRewindBackoff,
+				MaxRewindBackoff: DefaultMaxRewindBackoff,
+				MaxRewinds:       DefaultMaxRewinds,
+				MaxMessageBytes:  DefaultMaxMessageBytes,
+			},
+		},
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Info("no config file, use defaults")
+		return &config.Ingester.KafkaConsumer
+	}
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		log.Warning("Read config file error:", err)
+		return &config.Ingester.KafkaConsumer
+	}
+	if err = yaml.Unmarshal(configBytes, &config); err != nil {
+		log.Error("Unmarshal yaml error:", err)
+		os.Exit(1)
+	}
+
+	if err = config.Ingester.KafkaConsumer.Validate(); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	return &config.Ingester.KafkaConsumer
+}
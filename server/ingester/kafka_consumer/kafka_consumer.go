@@ -0,0 +1,586 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka_consumer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/otlp_receiver"
+	"github.com/deepflowio/deepflow/server/ingester/kafka_consumer/config"
+	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/receiver"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("kafka_consumer")
+
+const (
+	// the header of agent messages which carries the agent ip
+	HEADER_AGENT_IP     = "agent-ip"
+	HEADER_CONTENT_TYPE = "content-type"
+
+	CONTENT_TYPE_JSON = "application/json"
+
+	// the messages put in the same bucket share one pending offset
+	PENDING_BUCKET = 100 * time.Millisecond
+)
+
+type Counter struct {
+	Messages       int64 `statsd:"messages"`
+	Bytes          int64 `statsd:"bytes"`
+	Invalid        int64 `statsd:"invalid"`
+	Throttled      int64 `statsd:"throttled"`
+	Committed      int64 `statsd:"committed"`
+	Rewinds        int64 `statsd:"rewinds"`
+	DropsIgnored   int64 `statsd:"drops-ignored"` // times of the drops ignored after max-rewinds
+	Pending        int64 `statsd:"pending,gauge"`
+	WatermarkDelay int64 `statsd:"watermark-delay,gauge"` // second
+}
+
+type topicConsumer struct {
+	cfg     *config.Topic
+	counter *Counter
+	utils.Closable
+}
+
+func (t *topicConsumer) GetCounter() interface{} {
+	counter := &Counter{}
+	counter.Messages = atomic.SwapInt64(&t.counter.Messages, 0)
+	counter.Bytes = atomic.SwapInt64(&t.counter.Bytes, 0)
+	counter.Invalid = atomic.SwapInt64(&t.counter.Invalid, 0)
+	counter.Throttled = atomic.SwapInt64(&t.counter.Throttled, 0)
+	counter.Committed = atomic.SwapInt64(&t.counter.Committed, 0)
+	counter.Rewinds = atomic.SwapInt64(&t.counter.Rewinds, 0)
+	counter.DropsIgnored = atomic.SwapInt64(&t.counter.DropsIgnored, 0)
+	counter.Pending = atomic.LoadInt64(&t.counter.Pending)
+	counter.WatermarkDelay = atomic.LoadInt64(&t.counter.WatermarkDelay)
+	return counter
+}
+
+// KafkaConsumer consumes the agent messages and OTLP requests from kafka, and puts them into the decode queues
+// as the receivers do. The offset of a message is committed only after the decoders have processed it and the
+// flush watermark of ckwriters passes the decoded data, and it is consumed again from the committed offset if
+// the decode queues or the ckwriters of the topic databases drop data, so that the data is not lost when
+// clickhouse is unavailable.
+type KafkaConsumer struct {
+	cfg          *config.Config
+	receiver     *receiver.Receiver
+	otlpReceiver *otlp_receiver.Receiver
+	topics       map[string]*topicConsumer
+
+	// the rewinds in a row without committing, accessed atomically
+	rewinds int32
+
+	group  sarama.ConsumerGroup
+	client sarama.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewKafkaConsumer(cfg *config.Config, recv *receiver.Receiver, otlpReceiver *otlp_receiver.Receiver) *KafkaConsumer {
+	c := &KafkaConsumer{
+		cfg:          cfg,
+		receiver:     recv,
+		otlpReceiver: otlpReceiver,
+		topics:       make(map[string]*topicConsumer),
+	}
+	for i := range cfg.Topics {
+		t := &cfg.Topics[i]
+		if t.Format != config.FORMAT_AGENT && otlpReceiver == nil {
+			log.Warningf("kafka consumer topic %s is ignored, the format %s requires the otlp-receiver enabled", t.Name, t.Format)
+			continue
+		}
+		tc := &topicConsumer{cfg: t, counter: &Counter{}}
+		c.topics[t.Name] = tc
+		common.RegisterCountableForIngester("kafka_consumer", tc, stats.OptionStatTags{"topic": t.Name, "format": t.Format})
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+func (c *KafkaConsumer) saramaConfig() (*sarama.Config, error) {
+	sc := sarama.NewConfig()
+	if c.cfg.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.cfg.Version)
+		if err != nil {
+			return nil, err
+		}
+		sc.Version = version
+	}
+	if c.cfg.ClientID != "" {
+		sc.ClientID = c.cfg.ClientID
+	}
+	sc.Net.SASL.Enable = c.cfg.Sasl.Enabled
+	sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	sc.Net.SASL.User = c.cfg.Sasl.Username
+	sc.Net.SASL.Password = c.cfg.Sasl.Password
+	if c.cfg.TLSEnabled {
+		sc.Net.TLS.Enable = true
+		sc.Net.TLS.Config = &tls.Config{}
+	}
+
+	sc.Consumer.Return.Errors = true
+	sc.Consumer.Fetch.Max = int32(c.cfg.MaxMessageBytes)
+	sc.Consumer.Group.Session.Timeout = time.Duration(c.cfg.SessionTimeout) * time.Second
+	// offsets are marked and committed by the consumer after the data is written
+	sc.Consumer.Offsets.AutoCommit.Enable = false
+	if c.cfg.InitialOffset == config.OFFSET_OLDEST {
+		sc.Consumer.Offsets.Initial = sarama.OffsetOldest
+	} else {
+		sc.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+	return sc, nil
+}
+
+func (c *KafkaConsumer) Start() error {
+	if len(c.topics) == 0 {
+		log.Warning("kafka consumer has no valid topics")
+		return nil
+	}
+	saramaConfig, err := c.saramaConfig()
+	if err != nil {
+		return err
+	}
+	if c.cfg.Replay.Enabled() {
+		c.client, err = sarama.NewClient(c.cfg.Brokers, saramaConfig)
+		if err != nil {
+			return err
+		}
+		c.wg.Add(1)
+		go c.replay()
+		log.Infof("kafka consumer replays topics %v from %d to %d", c.topicNames(), c.cfg.Replay.StartTime, c.cfg.Replay.EndTime)
+		return nil
+	}
+
+	c.group, err = sarama.NewConsumerGroup(c.cfg.Brokers, c.cfg.GroupID, saramaConfig)
+	if err != nil {
+		return err
+	}
+	c.wg.Add(2)
+	go c.consume()
+	go func() {
+		defer c.wg.Done()
+		for err := range c.group.Errors() {
+			log.Warningf("kafka consumer error: %s", err)
+		}
+	}()
+	log.Infof("kafka consumer started, group: %s, topics: %v", c.cfg.GroupID, c.topicNames())
+	return nil
+}
+
+func (c *KafkaConsumer) topicNames() []string {
+	names := make([]string, 0, len(c.topics))
+	for name := range c.topics {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (c *KafkaConsumer) consume() {
+	defer c.wg.Done()
+	topics := c.topicNames()
+	for c.ctx.Err() == nil {
+		handler := &groupHandler{c: c, drops: make(map[string]uint64, len(c.topics))}
+		for name, t := range c.topics {
+			_, handler.drops[name] = ckwriter.FlushState(t.cfg.Databases)
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		handler.cancel = cancel
+		// Consume returns when the session ends, e.g. rebalancing or rewinding, and joins the group again
+		err := c.group.Consume(ctx, topics, handler)
+		cancel()
+		if err != nil {
+			log.Warningf("kafka consumer consume failed: %s", err)
+			c.sleep(time.Duration(c.cfg.RetryInterval) * time.Millisecond)
+		} else if handler.rewinding {
+			c.sleep(c.rewindBackoff())
+		}
+	}
+}
+
+// rewindBackoff doubles for each rewind in a row, up to max-rewind-backoff
+func (c *KafkaConsumer) rewindBackoff() time.Duration {
+	backoff := time.Duration(c.cfg.RewindBackoff) * time.Second
+	maxBackoff := time.Duration(c.cfg.MaxRewindBackoff) * time.Second
+	for i := int32(1); i < atomic.LoadInt32(&c.rewinds) && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (c *KafkaConsumer) sleep(d time.Duration) {
+	select {
+	case <-c.ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// put puts the message into the decode queues, and retries until it is put or ctx is done,
+// the positions of the message in the decode queues are returned
+func (c *KafkaConsumer) put(ctx context.Context, t *topicConsumer, msg *sarama.ConsumerMessage) ([]*queue.Position, bool) {
+	for {
+		positions, err := c.putOnce(t, msg)
+		if err == nil {
+			atomic.AddInt64(&t.counter.Messages, 1)
+			atomic.AddInt64(&t.counter.Bytes, int64(len(msg.Value)))
+			return positions, true
+		}
+		if err != receiver.ErrQueueFull && err != otlp_receiver.ErrQueueFull {
+			// invalid messages are skipped, they will not be valid when consumed again
+			// only the first one in each stats interval is logged
+			if atomic.AddInt64(&t.counter.Invalid, 1) == 1 {
+				log.Warningf("kafka consumer topic %s partition %d offset %d is invalid: %s", msg.Topic, msg.Partition, msg.Offset, err)
+			}
+			return nil, true
+		}
+		atomic.AddInt64(&t.counter.Throttled, 1)
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(time.Duration(c.cfg.RetryInterval) * time.Millisecond):
+		}
+	}
+}
+
+func (c *KafkaConsumer) putOnce(t *topicConsumer, msg *sarama.ConsumerMessage) ([]*queue.Position, error) {
+	var signal otlp_receiver.Signal
+	switch t.cfg.Format {
+	case config.FORMAT_AGENT:
+		var ip net.IP
+		if v := header(msg, HEADER_AGENT_IP); v != "" {
+			ip = net.ParseIP(v)
+		}
+		return c.receiver.PutFrames(msg.Value, ip, c.cfg.QueueLimit)
+	case config.FORMAT_OTLP_TRACES:
+		signal = otlp_receiver.SIGNAL_TRACES
+	case config.FORMAT_OTLP_LOGS:
+		signal = otlp_receiver.SIGNAL_LOGS
+	case config.FORMAT_OTLP_METRICS:
+		signal = otlp_receiver.SIGNAL_METRICS
+	}
+	isJSON := t.cfg.Encoding == config.ENCODING_JSON
+	if contentType := header(msg, HEADER_CONTENT_TYPE); contentType != "" {
+		isJSON = contentType == CONTENT_TYPE_JSON
+	}
+	position, err := c.otlpReceiver.PutRaw(signal, msg.Value, isJSON, t.cfg.OrgID, t.cfg.TeamID)
+	if position == nil {
+		return nil, err
+	}
+	return []*queue.Position{position}, err
+}
+
+func header(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+type pendingOffset struct {
+	offset    int64 // the next offset to consume
+	firstTime time.Time
+	// the positions of the messages in the decode queues, only the last one of each queue is kept
+	positions []*queue.Position
+	// when all the positions are processed by the decoders, zero if not yet
+	decoded time.Time
+}
+
+func (o *pendingOffset) merge(position *queue.Position) {
+	for i, p := range o.positions {
+		if p.Queue == position.Queue {
+			// the lost count is kept from the earlier messages
+			o.positions[i] = &queue.Position{Queue: p.Queue, Written: position.Written, Lost: p.Lost}
+			return
+		}
+	}
+	o.positions = append(o.positions, position)
+}
+
+// pendingOffsets are the offsets of a partition which are put but not committed
+type pendingOffsets struct {
+	offsets []pendingOffset
+}
+
+func (p *pendingOffsets) add(offset int64, positions []*queue.Position, now time.Time) {
+	n := len(p.offsets)
+	if n == 0 || now.Sub(p.offsets[n-1].firstTime) >= PENDING_BUCKET {
+		p.offsets = append(p.offsets, pendingOffset{firstTime: now})
+		n++
+	}
+	last := &p.offsets[n-1]
+	last.offset = offset
+	for _, position := range positions {
+		last.merge(position)
+	}
+}
+
+// ack sets the decoded time of the offsets whose messages are processed by the decoders, and returns
+// true if any message which is not decoded before may be lost by the decode queues
+func (p *pendingOffsets) ack(now time.Time) bool {
+	lost := false
+	for i := range p.offsets {
+		o := &p.offsets[i]
+		if !o.decoded.IsZero() {
+			continue
+		}
+		decoded := true
+		for _, position := range o.positions {
+			if position.MayBeLost() {
+				lost = true
+			}
+			if !position.Processed() {
+				decoded = false
+			}
+		}
+		if decoded {
+			o.decoded = now
+			o.positions = nil
+		}
+	}
+	return lost
+}
+
+// ignoreLost accepts the messages lost by the decode queues before
+func (p *pendingOffsets) ignoreLost() {
+	for i := range p.offsets {
+		for _, position := range p.offsets[i].positions {
+			position.Lost = position.Queue.Lost()
+		}
+	}
+}
+
+// pop returns the largest offset whose messages are decoded and the decoded data (put into ckwriters in
+// decoderDelay after decoding) is flushed before watermark, or -1 if there is none
+func (p *pendingOffsets) pop(watermark time.Time, decoderDelay time.Duration) int64 {
+	offset := int64(-1)
+	i := 0
+	for ; i < len(p.offsets); i++ {
+		if p.offsets[i].decoded.IsZero() || p.offsets[i].decoded.Add(decoderDelay).After(watermark) {
+			break
+		}
+		offset = p.offsets[i].offset
+	}
+	p.offsets = p.offsets[:copy(p.offsets, p.offsets[i:])]
+	return offset
+}
+
+type groupHandler struct {
+	c *KafkaConsumer
+	// the drops of the ckwriters of each topic when the session starts
+	drops map[string]uint64
+
+	sync.Mutex
+	cancel    context.CancelFunc
+	rewinding bool
+}
+
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	log.Infof("kafka consumer session %s started, claims: %v", session.MemberID(), session.Claims())
+	return nil
+}
+
+func (h *groupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	return nil
+}
+
+// rewind ends the session to consume again from the committed offsets, it returns false
+// if the consumer has rewinded max-rewinds times in a row, and the data dropped should be ignored
+func (h *groupHandler) rewind() bool {
+	h.Lock()
+	defer h.Unlock()
+	if h.rewinding {
+		return true
+	}
+	if maxRewinds := h.c.cfg.MaxRewinds; maxRewinds > 0 && atomic.LoadInt32(&h.c.rewinds) >= int32(maxRewinds) {
+		return false
+	}
+	atomic.AddInt32(&h.c.rewinds, 1)
+	h.rewinding = true
+	h.cancel()
+	return true
+}
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	t := h.c.topics[claim.Topic()]
+	drops := h.drops[claim.Topic()]
+	pending := &pendingOffsets{}
+	ctx := session.Context()
+	ticker := time.NewTicker(time.Duration(h.c.cfg.CommitInterval) * time.Second)
+	defer ticker.Stop()
+	defer func() {
+		atomic.AddInt64(&t.counter.Pending, -int64(len(pending.offsets)))
+	}()
+	decoderDelay := time.Duration(h.c.cfg.DecoderDelay) * time.Second
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			positions, ok := h.c.put(ctx, t, msg)
+			if !ok {
+				return nil
+			}
+			n := len(pending.offsets)
+			pending.add(msg.Offset+1, positions, time.Now())
+			atomic.AddInt64(&t.counter.Pending, int64(len(pending.offsets)-n))
+		case <-ticker.C:
+			lost := pending.ack(time.Now())
+			watermark, newDrops := ckwriter.FlushState(t.cfg.Databases)
+			dropped := lost || newDrops != drops
+			if dropped {
+				if h.rewind() {
+					// the data after the committed offset may be dropped, consume it again
+					log.Warningf("kafka consumer rewinds topic %s partition %d to the committed offset, since the decode queues or ckwriters dropped data", claim.Topic(), claim.Partition())
+					atomic.AddInt64(&t.counter.Rewinds, 1)
+					return nil
+				}
+				if atomic.AddInt64(&t.counter.DropsIgnored, 1) == 1 {
+					log.Errorf("kafka consumer topic %s partition %d has rewinded %d times in a row, the data dropped by the decode queues or ckwriters is lost", claim.Topic(), claim.Partition(), h.c.cfg.MaxRewinds)
+				}
+				drops = newDrops
+				pending.ignoreLost()
+			}
+			atomic.StoreInt64(&t.counter.WatermarkDelay, int64(time.Since(watermark)/time.Second))
+			n := len(pending.offsets)
+			if offset := pending.pop(watermark, decoderDelay); offset >= 0 {
+				session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+				session.Commit()
+				atomic.AddInt64(&t.counter.Committed, 1)
+				if !dropped {
+					atomic.StoreInt32(&h.c.rewinds, 0)
+				}
+			}
+			atomic.AddInt64(&t.counter.Pending, int64(len(pending.offsets)-n))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// replay consumes the messages in the replay time range of all partitions, the offsets are not committed
+func (c *KafkaConsumer) replay() {
+	defer c.wg.Done()
+	consumer, err := sarama.NewConsumerFromClient(c.client)
+	if err != nil {
+		log.Errorf("kafka consumer create replay consumer failed: %s", err)
+		return
+	}
+	defer consumer.Close()
+
+	var wg sync.WaitGroup
+	for name, t := range c.topics {
+		partitions, err := c.client.Partitions(name)
+		if err != nil {
+			log.Errorf("kafka consumer get partitions of topic %s failed: %s", name, err)
+			continue
+		}
+		for _, partition := range partitions {
+			start, end, err := c.replayRange(name, partition)
+			if err != nil {
+				log.Errorf("kafka consumer get replay offsets of topic %s partition %d failed: %s", name, partition, err)
+				continue
+			}
+			if start >= end {
+				continue
+			}
+			pc, err := consumer.ConsumePartition(name, partition, start)
+			if err != nil {
+				log.Errorf("kafka consumer consume topic %s partition %d failed: %s", name, partition, err)
+				continue
+			}
+			wg.Add(1)
+			go func(t *topicConsumer, pc sarama.PartitionConsumer, partition int32, end int64) {
+				defer wg.Done()
+				defer pc.Close()
+				for {
+					select {
+					case msg := <-pc.Messages():
+						if _, ok := c.put(c.ctx, t, msg); !ok || msg.Offset+1 >= end {
+							log.Infof("kafka consumer replayed topic %s partition %d to offset %d", t.cfg.Name, partition, msg.Offset)
+							return
+						}
+					case err := <-pc.Errors():
+						log.Warningf("kafka consumer replay topic %s partition %d error: %s", t.cfg.Name, partition, err)
+					case <-c.ctx.Done():
+						return
+					}
+				}
+			}(t, pc, partition, end)
+		}
+	}
+	wg.Wait()
+	log.Info("kafka consumer replay finished")
+}
+
+// replayRange returns the offsets [start, end) of the messages in the replay time range
+func (c *KafkaConsumer) replayRange(topic string, partition int32) (int64, int64, error) {
+	newest, err := c.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+	// GetOffset returns the first offset whose timestamp is not earlier than the time, or OffsetNewest if none
+	start, err := c.client.GetOffset(topic, partition, c.cfg.Replay.StartTime*1000)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := c.client.GetOffset(topic, partition, c.cfg.Replay.EndTime*1000)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 0 {
+		start = newest
+	}
+	if end < 0 {
+		end = newest
+	}
+	return start, end, nil
+}
+
+func (c *KafkaConsumer) Close() error {
+	c.cancel()
+	if c.group != nil {
+		c.group.Close()
+	}
+	c.wg.Wait()
+	if c.client != nil {
+		c.client.Close()
+	}
+	for _, t := range c.topics {
+		t.Close()
+	}
+	log.Info("kafka consumer closed")
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka_consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/libs/queue"
+)
+
+type fakeProgress struct {
+	written, processed, lost uint64
+}
+
+func (p *fakeProgress) Written() uint64   { return p.written }
+func (p *fakeProgress) Processed() uint64 { return p.processed }
+func (p *fakeProgress) Lost() uint64      { return p.lost }
+
+func (p *fakeProgress) put(n uint64) []*queue.Position {
+	p.written += n
+	return []*queue.Position{{Queue: p, Written: p.written, Lost: p.lost}}
+}
+
+func TestPendingOffsets(t *testing.T) {
+	base := time.Unix(1000, 0)
+	q := &fakeProgress{}
+	p := &pendingOffsets{}
+	// offsets in the same bucket are merged
+	p.add(1, q.put(1), base)
+	p.add(2, q.put(1), base.Add(50*time.Millisecond))
+	p.add(3, q.put(1), base.Add(time.Second))
+	p.add(4, q.put(1), base.Add(2*time.Second))
+	if len(p.offsets) != 3 || len(p.offsets[0].positions) != 1 || p.offsets[0].positions[0].Written != 2 {
+		t.Fatalf("unexpected pending offsets %+v", p.offsets)
+	}
+
+	delay := 5 * time.Second
+	if offset := p.pop(base.Add(time.Hour), delay); offset != -1 {
+		t.Errorf("pop before decoded got %d, want -1", offset)
+	}
+	q.processed = 3
+	if p.ack(base.Add(10 * time.Second)) {
+		t.Error("no message is lost")
+	}
+	if offset := p.pop(base.Add(12*time.Second), delay); offset != -1 {
+		t.Errorf("pop before the decoded data is flushed got %d, want -1", offset)
+	}
+	if offset := p.pop(base.Add(15*time.Second), delay); offset != 3 {
+		t.Errorf("got offset %d, want 3", offset)
+	}
+	if len(p.offsets) != 1 || p.offsets[0].offset != 4 {
+		t.Errorf("unexpected pending offsets %+v", p.offsets)
+	}
+
+	q.lost = 1
+	if !p.ack(base.Add(20 * time.Second)) {
+		t.Error("the message not decoded may be lost")
+	}
+	p.ignoreLost()
+	q.processed = 4
+	if p.ack(base.Add(30 * time.Second)) {
+		t.Error("the lost messages are ignored")
+	}
+	if offset := p.pop(base.Add(time.Hour), delay); offset != 4 || len(p.offsets) != 0 {
+		t.Errorf("got offset %d and %d pending offsets", offset, len(p.offsets))
+	}
+}
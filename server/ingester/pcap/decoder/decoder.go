@@ -74,7 +74,7 @@ type Counter struct {
 
 type Decoder struct {
 	index      int
-	inQueue    queue.QueueReader
+	inQueue    queue.TypedQueueReader[*receiver.RecvBuffer]
 	pcapWriter *dbwriter.PcapWriter
 	config     *config.Config
 
@@ -86,7 +86,7 @@ type Decoder struct {
 
 func NewDecoder(
 	index int,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	pcapWriter *dbwriter.PcapWriter,
 	config *config.Config,
 ) *Decoder {
@@ -122,7 +122,7 @@ func (d *Decoder) Run() {
 		SnapLen:  65535,
 		LinkType: 1, // Ethernet
 	}
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	for {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
@@ -130,11 +130,7 @@ func (d *Decoder) Run() {
 				continue
 			}
 			d.counter.InCount++
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("pcap get decode queue data type wrong")
-				continue
-			}
+			recvBytes := buffer[i]
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 			d.orgId, d.teamId = uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
 			d.handlePcap(recvBytes.VtapID, decoder, encoder, pcapHeader, pcapBatch)
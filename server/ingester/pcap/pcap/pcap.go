@@ -25,7 +25,6 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/pcap/dbwriter"
 	"github.com/deepflowio/deepflow/server/ingester/pcap/decoder"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
-	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 )
@@ -40,13 +39,14 @@ func NewPcaper(recv *receiver.Receiver, config *config.Config) (*Pcaper, error)
 	msgType := datatype.MESSAGE_TYPE_RAW_PCAP
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_PCAP_QUEUE)
 	queueCount := config.PcapQueueCount
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+datatype.MessageTypeString[int(msgType)],
 		config.PcapQueueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
 	pcapWriter, err := dbwriter.NewPcapWriter(config)
@@ -58,7 +58,7 @@ func NewPcaper(recv *receiver.Receiver, config *config.Config) (*Pcaper, error)
 	for i := 0; i < queueCount; i++ {
 		decoders[i] = decoder.NewDecoder(
 			i,
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			pcapWriter,
 			config,
 		)
@@ -21,9 +21,11 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	server_common "github.com/deepflowio/deepflow/server/common"
@@ -68,6 +70,28 @@ func RegisterToCkwriterManager(w *CKWriter) {
 	ckwriterManager.Unlock()
 }
 
+// FlushState returns the flush progress of the ckwriters of the databases (all ckwriters if databases is empty):
+// all the items put into them before watermark have been written or dropped, and drops is the sum of the items
+// dropped by them, the callers which need at-least-once delivery should send the data again if drops changes
+// before watermark passes the data.
+func FlushState(databases []string) (watermark time.Time, drops uint64) {
+	w := time.Now().UnixNano()
+	ckwriterManager.Lock()
+	for _, ckwriter := range ckwriterManager.ckwriters {
+		if len(databases) > 0 && !slices.Contains(databases, ckwriter.table.Database) {
+			continue
+		}
+		drops += atomic.LoadUint64(&ckwriter.drops)
+		for _, qc := range ckwriter.queueContexts {
+			if qw := atomic.LoadInt64(&qc.watermark); qw < w {
+				w = qw
+			}
+		}
+	}
+	ckwriterManager.Unlock()
+	return time.Unix(0, w), drops
+}
+
 func (m *CKWriterManager) DropOrg(orgId uint16) error {
 	log.Infof("call ckwriters drop org %d", orgId)
 	ckwriterManager.Lock()
@@ -111,6 +135,9 @@ type CKWriter struct {
 	ckdbwatcher   *config.Watcher
 	queueContexts []*QueueContext
 
+	// the count of items dropped for write failures or queue overwriting, accessed atomically
+	drops uint64
+
 	wg   sync.WaitGroup
 	exit bool
 }
@@ -123,6 +150,11 @@ type QueueContext struct {
 	conns           []*ch.Client
 	connCount       int
 	counter         Counter
+
+	// all items put into the queue before candidate have been added to caches
+	candidate time.Time
+	// all items put into the queue before watermark (unix nano) have been written or dropped
+	watermark int64
 }
 
 func (qc *QueueContext) EndpointsChange(addrs []string) {
@@ -466,13 +498,17 @@ func NewCKWriter(addrs []string, user, password, counterName, timeZone string, t
 		}
 	}
 	name := fmt.Sprintf("%s-%s-%s", table.Database, table.LocalName, counterName)
+	w := &CKWriter{}
 	dataQueues := queue.NewOverwriteQueues(
 		name, queue.HashKey(queueCount), queueSize,
 		queue.OptionFlushIndicator(time.Second),
-		queue.OptionRelease(func(p interface{}) { p.(CKItem).Release() }),
+		queue.OptionRelease(func(p interface{}) {
+			atomic.AddUint64(&w.drops, 1)
+			p.(CKItem).Release()
+		}),
 		common.QUEUE_STATS_MODULE_INGESTER)
 
-	w := &CKWriter{
+	*w = CKWriter{
 		addrs:         utils.CloneStringSlice(addrs),
 		user:          user,
 		password:      password,
@@ -555,6 +591,8 @@ type Cache struct {
 	lastWriteTime time.Time
 	tableCreated  bool
 	dropTime      uint32
+	// the candidate of the queue context when the first item is added after written
+	since time.Time
 }
 
 func (c *Cache) Release() {
@@ -588,6 +626,9 @@ func (w *CKWriter) queueProcess(queueID int) {
 
 	for !w.exit {
 		n := w.dataQueues.Gets(queue.HashKey(queueID), rawItems)
+		// if the queue is empty, all items put before checkTime are in rawItems or caches
+		checkTime := time.Now()
+		drained := w.dataQueues.Len(queue.HashKey(queueID)) == 0
 		for i := 0; i < n; i++ {
 			item := rawItems[i]
 			if ckItem, ok := item.(CKItem); ok {
@@ -600,21 +641,32 @@ func (w *CKWriter) queueProcess(queueID int) {
 					continue
 				}
 				cache := orgCaches[orgID]
+				if cache.size == 0 {
+					cache.since = qc.candidate
+				}
 				cache.Add(ckItem)
 				if cache.size >= w.batchSize {
 					w.Write(queueID, cache)
 				}
 			} else if IsNil(item) { // flush ticker
 				now := time.Now()
+				watermark := qc.candidate
 				for _, cache := range orgCaches {
 					if cache.size > 0 && now.Sub(cache.lastWriteTime) > w.flushDuration {
 						w.Write(queueID, cache)
 					}
+					if cache.size > 0 && cache.since.Before(watermark) {
+						watermark = cache.since
+					}
 				}
+				atomic.StoreInt64(&qc.watermark, watermark.UnixNano())
 			} else {
 				log.Warningf("get writer queue data type wrong %T", item)
 			}
 		}
+		if drained {
+			qc.candidate = checkTime
+		}
 	}
 }
 
@@ -706,6 +758,7 @@ func (w *CKWriter) Write(queueID int, cache *Cache) {
 				log.Warningf("create table (%s.%s) failed, drop (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, itemsLen, err)
 			}
 			qc.counter.WriteFailedCount += int64(itemsLen)
+			atomic.AddUint64(&w.drops, uint64(itemsLen))
 			cache.Release()
 			return
 		}
@@ -716,6 +769,7 @@ func (w *CKWriter) Write(queueID int, cache *Cache) {
 			log.Warningf("write table (%s.%s) failed, drop (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, itemsLen, err)
 		}
 		qc.counter.WriteFailedCount += int64(itemsLen)
+		atomic.AddUint64(&w.drops, uint64(itemsLen))
 	} else {
 		qc.counter.WriteSuccessCount += int64(itemsLen)
 	}
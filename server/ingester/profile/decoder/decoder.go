@@ -103,7 +103,7 @@ type Decoder struct {
 	index               int
 	msgType             datatype.MessageType
 	platformData        *grpc.PlatformInfoTable
-	inQueue             queue.QueueReader
+	inQueue             queue.TypedQueueReader[*receiver.RecvBuffer]
 	profileWriter       *dbwriter.ProfileWriter
 	appServiceTagWriter *flow_tag.AppServiceTagWriter
 	compressionAlgo     string
@@ -120,7 +120,7 @@ type Decoder struct {
 func NewDecoder(index int, msgType datatype.MessageType, compressionAlgo string,
 	offCpuSplittingGranularity int,
 	platformData *grpc.PlatformInfoTable,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
 	profileWriter *dbwriter.ProfileWriter,
 	appServiceTagWriter *flow_tag.AppServiceTagWriter) *Decoder {
 	return &Decoder{
@@ -149,7 +149,7 @@ func (d *Decoder) Run() {
 	common.RegisterCountableForIngester("decoder", d, stats.OptionStatTags{
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": datatype.MESSAGE_TYPE_PROFILE.String()})
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	decoder := &codec.SimpleDecoder{}
 	for {
 		n := d.inQueue.Gets(buffer)
@@ -159,11 +159,7 @@ func (d *Decoder) Run() {
 				continue
 			}
 			atomic.AddInt64(&d.counter.RawCount, 1)
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("get decode queue data type wrong")
-				continue
-			}
+			recvBytes := buffer[i]
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 			d.orgId, d.teamId = uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
 			if d.msgType == datatype.MESSAGE_TYPE_PROFILE {
@@ -30,7 +30,6 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
-	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 )
@@ -56,13 +55,14 @@ func NewProfile(config *config.Config, recv *receiver.Receiver, platformDataMana
 }
 
 func NewProfiler(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver) (*Profiler, error) {
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+msgType.String(),
 		config.DecoderQueueSize,
 		config.DecoderQueueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
+		receiver.ReleaseRecvBuffer)
 
 	recv.RegistHandler(msgType, decodeQueues, config.DecoderQueueCount)
 	decoders := make([]*decoder.Decoder, config.DecoderQueueCount)
@@ -90,7 +90,7 @@ func NewProfiler(msgType datatype.MessageType, config *config.Config, platformDa
 			*config.CompressionAlgorithm,
 			config.OffCpuSplittingGranularity,
 			platformDatas[i],
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
 			profileWriter,
 			appServiceTagWriter,
 		)
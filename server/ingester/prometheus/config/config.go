@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/ingester/prometheus/scrape"
 
 	logging "github.com/op/go-logging"
 	yaml "gopkg.in/yaml.v2"
@@ -50,6 +51,7 @@ type Config struct {
 	AppLabelColumnMinCount       int                   `yaml:"prometheus-app-label-column-min-count"`
 	IgnoreUniversalTag           bool                  `yaml:"prometheus-sample-ignore-universal-tag"`
 	LabelCacheExpiration         int                   `yaml:"prometheus-label-cache-expiration"`
+	Scrape                       scrape.Config         `yaml:"prometheus-scrape"`
 }
 
 type PrometheusConfig struct {
@@ -79,7 +81,7 @@ func (c *Config) Validate() error {
 		c.LabelCacheExpiration = DefaultLabelCacheExpiration
 	}
 
-	return nil
+	return c.Scrape.Validate()
 }
 
 func Load(base *config.Config, path string) *Config {
@@ -30,6 +30,7 @@ import (
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
 	baseconfig "github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/ingester/datasource"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
 	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/config"
@@ -271,6 +272,15 @@ func (w *PrometheusWriter) addAppLabelColumns(conn common.DBs, startIndex, endIn
 			}
 		}
 	}
+
+	// the rollups of prometheus.samples also need the new columns
+	columns := []string{}
+	for i := startIndex; i <= endIndex; i++ {
+		columns = append(columns, fmt.Sprintf("app_label_value_id_%d", i))
+	}
+	if err := datasource.AddRollupColumns(conn, w.ckdbType, orgDatabase, PROMETHEUS_TABLE, columns); err != nil {
+		log.Warningf("add app_label_value_id columns to the rollups of %s.%s failed: %s", orgDatabase, PROMETHEUS_TABLE, err)
+	}
 	return nil
 }
 
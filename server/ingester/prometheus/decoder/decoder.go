@@ -38,6 +38,7 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/flow-metrics/pb"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
@@ -48,6 +49,8 @@ var log = logging.MustGetLogger("prometheus.decoder")
 const (
 	BUFFER_SIZE    = 128 // An prometheus message is usually very large, so use a smaller value than usual
 	PROMETHEUS_POD = "pod"
+	// vtap id of the samples generated by the server itself, such as the results of recording rules
+	SERVER_VTAP_ID = 0
 )
 
 var appLableValueIDsMaxBuffer []uint32 = make([]uint32, ckdb.MAX_APP_LABEL_COLUMN_INDEX+1)
@@ -59,7 +62,8 @@ type Counter struct {
 	TimeSeriesIn   int64 `statsd:"time-series-in"`
 	TimeSeriesErr  int64 `statsd:"time-series-err"`
 	TimeSeriesSlow int64 `statsd:"time-series-slow"`
-	TimeSeriesOut  int64 `statsd:"time-series-out"` // count the number of TimeSeries (not Samples)
+	TimeSeriesOut  int64 `statsd:"time-series-out"`  // count the number of TimeSeries (not Samples)
+	QuotaDropCount int64 `statsd:"quota-drop-count"` // messages dropped by the rows-per-day quotas
 }
 
 type BuilderCounter struct {
@@ -135,13 +139,14 @@ func NewPrometheusSamplesBuilder(name string, index int, platformData *grpc.Plat
 
 type Decoder struct {
 	index            int
-	inQueue          queue.QueueReader
-	slowDecodeQueue  queue.QueueWriter
+	inQueue          queue.TypedQueueReader[*receiver.RecvBuffer]
+	slowDecodeQueue  queue.TypedQueueWriter[*SlowItem]
 	prometheusWriter *dbwriter.PrometheusWriter
 	debugEnabled     bool
 	config           *config.Config
 
 	orgId, teamId uint16
+	quotaRows     *quota.RowCounter
 
 	samplesBuilder *PrometheusSamplesBuilder
 
@@ -153,8 +158,8 @@ func NewDecoder(
 	index int,
 	platformData *grpc.PlatformInfoTable,
 	prometheusLabelTable *PrometheusLabelTable,
-	inQueue queue.QueueReader,
-	slowDecodeQueue queue.QueueWriter,
+	inQueue queue.TypedQueueReader[*receiver.RecvBuffer],
+	slowDecodeQueue queue.TypedQueueWriter[*SlowItem],
 	prometheusWriter *dbwriter.PrometheusWriter,
 	config *config.Config,
 ) *Decoder {
@@ -170,6 +175,12 @@ func NewDecoder(
 	}
 }
 
+// SetQuota enables the rows-per-day quotas of prometheus, the samples of the
+// slow decoder are not counted
+func (d *Decoder) SetQuota(m *quota.Manager) {
+	d.quotaRows = m.NewRowCounter(quota.PROMETHEUS)
+}
+
 func (d *Decoder) GetCounter() interface{} {
 	var counter *Counter
 	counter, d.counter = d.counter, &Counter{}
@@ -180,7 +191,7 @@ func (d *Decoder) Run() {
 	common.RegisterCountableForIngester("decoder", d, stats.OptionStatTags{
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": datatype.MESSAGE_TYPE_PROMETHEUS.String()})
-	buffer := make([]interface{}, BUFFER_SIZE)
+	buffer := make([]*receiver.RecvBuffer, BUFFER_SIZE)
 	promWriteRequest := &prompb.WriteRequest{}
 	decodeBuffer := []byte{}
 	decoder := &codec.SimpleDecoder{}
@@ -193,14 +204,16 @@ func (d *Decoder) Run() {
 				continue
 			}
 			d.counter.InCount++
-			recvBytes, ok := buffer[i].(*receiver.RecvBuffer)
-			if !ok {
-				log.Warning("get decode queue data type wrong")
+			recvBytes := buffer[i]
+			if !d.quotaRows.Begin(recvBytes.OrgID, recvBytes.TeamID) {
+				d.counter.QuotaDropCount++
+				receiver.ReleaseRecvBuffer(recvBytes)
 				continue
 			}
 			decoder.Init(recvBytes.Buffer[recvBytes.Begin:recvBytes.End])
 			d.orgId, d.teamId = uint16(recvBytes.OrgID), uint16(recvBytes.TeamID)
 			d.handlePrometheusData(recvBytes.VtapID, decoder, &decodeBuffer, promWriteRequest, prometheusMetric, extraLabels)
+			d.quotaRows.End()
 			receiver.ReleaseRecvBuffer(recvBytes)
 		}
 	}
@@ -279,13 +292,18 @@ func (d *Decoder) sendPrometheus(vtapID uint16, ts *prompb.TimeSeries, extraLabe
 		log.Debugf("decoder %d vtap %d recv promtheus timeseries: %v", d.index, vtapID, ts)
 	}
 
-	epcId, podClusterId, err := d.samplesBuilder.GetEpcPodClusterId(d.orgId, vtapID)
-	if err != nil {
-		if d.counter.TimeSeriesErr == 0 {
-			log.Warning(err)
+	var epcId, podClusterId uint16
+	var err error
+	// the samples generated by the server itself are not bound to any agent
+	if vtapID != SERVER_VTAP_ID {
+		epcId, podClusterId, err = d.samplesBuilder.GetEpcPodClusterId(d.orgId, vtapID)
+		if err != nil {
+			if d.counter.TimeSeriesErr == 0 {
+				log.Warning(err)
+			}
+			d.counter.TimeSeriesErr++
+			return
 		}
-		d.counter.TimeSeriesErr++
-		return
 	}
 
 	isSlowItem, err := d.samplesBuilder.TimeSeriesToStore(vtapID, epcId, podClusterId, d.orgId, d.teamId, ts, extraLabels)
@@ -305,6 +323,7 @@ func (d *Decoder) sendPrometheus(vtapID uint16, ts *prompb.TimeSeries, extraLabe
 	}
 	d.prometheusWriter.WriteBatch(builder.samplesBuffer, builder.metricName, builder.timeSeriesBuffer, extraLabels, builder.tsLabelNameIDsBuffer, builder.tsLabelValueIDsBuffer)
 	d.counter.OutCount += int64(len(builder.samplesBuffer))
+	d.quotaRows.Add(len(builder.samplesBuffer))
 	d.counter.TimeSeriesOut++
 }
 
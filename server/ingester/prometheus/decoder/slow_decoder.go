@@ -92,7 +92,7 @@ func ReleaseSlowItem(s *SlowItem) {
 
 type SlowDecoder struct {
 	index            int
-	inQueue          queue.QueueReader
+	inQueue          queue.TypedQueueReader[*SlowItem]
 	debugEnabled     bool
 	config           *config.Config
 	prometheusWriter *dbwriter.PrometheusWriter
@@ -108,7 +108,7 @@ func NewSlowDecoder(
 	index int,
 	platformData *grpc.PlatformInfoTable,
 	prometheusLabelTable *PrometheusLabelTable,
-	inQueue queue.QueueReader,
+	inQueue queue.TypedQueueReader[*SlowItem],
 	prometheusWriter *dbwriter.PrometheusWriter,
 	config *config.Config,
 ) *SlowDecoder {
@@ -135,7 +135,7 @@ func (d *SlowDecoder) Run() {
 		"thread":   strconv.Itoa(d.index),
 		"msg_type": "slow_prometheus"})
 	batchSize := d.config.LabelRequestMetricBatchCount
-	buffer := make([]interface{}, batchSize)
+	buffer := make([]*SlowItem, batchSize)
 	req := &trident.PrometheusLabelRequest{}
 	slowItems := make([]*SlowItem, 0, batchSize)
 	queueTicker := 0
@@ -147,10 +147,7 @@ func (d *SlowDecoder) Run() {
 				continue
 			}
 			d.counter.TimeSeriesIn++
-			slowItem, ok := buffer[i].(*SlowItem)
-			if !ok {
-				continue
-			}
+			slowItem := buffer[i]
 			slowItems = append(slowItems, slowItem)
 			metricLabelReq := d.TimeSeriesToLableIDRequest(&slowItem.ts, slowItem.epcId, slowItem.podClusterId, slowItem.orgId)
 			addMetricLabelRequest(req, metricLabelReq)
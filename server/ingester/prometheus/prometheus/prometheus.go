@@ -20,22 +20,29 @@ import (
 	"strconv"
 	"time"
 
+	logging "github.com/op/go-logging"
 	_ "golang.org/x/net/context"
 	_ "google.golang.org/grpc"
 
+	servercommon "github.com/deepflowio/deepflow/server/common"
 	dropletqueue "github.com/deepflowio/deepflow/server/ingester/droplet/queue"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/config"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/dbwriter"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/decoder"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/codec"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/debug"
+	"github.com/deepflowio/deepflow/server/libs/flow-metrics/pb"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 	libqueue "github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
 )
 
+var log = logging.MustGetLogger("prometheus")
+
 type PrometheusHandler struct {
 	Config               *config.Config
 	LabelTable           *decoder.PrometheusLabelTable
@@ -44,26 +51,31 @@ type PrometheusHandler struct {
 	PlatformDatas        []*grpc.PlatformInfoTable
 	SlowPlatformDatas    []*grpc.PlatformInfoTable
 	prometheusLabelTable *decoder.PrometheusLabelTable
+
+	decodeQueues       *dropletqueue.TypedMultiQueue[*receiver.RecvBuffer]
+	serverWriteRequest queue.TypedQueueReader[*servercommon.PrometheusWriteRequest]
 }
 
-func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager) (*PrometheusHandler, error) {
+func NewPrometheusHandler(config *config.Config, serverWriteRequest queue.TypedQueueReader[*servercommon.PrometheusWriteRequest], recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager) (*PrometheusHandler, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_PROMETHEUS_QUEUE)
 	queueCount := config.DecoderQueueCount
 	msgType := datatype.MESSAGE_TYPE_PROMETHEUS
-	decodeQueues := manager.NewQueues(
+	decodeQueues := dropletqueue.NewTypedQueues[*receiver.RecvBuffer](
+		manager,
 		"1-receive-to-decode-"+msgType.String(),
 		config.DecoderQueueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { receiver.ReleaseRecvBuffer(p.(*receiver.RecvBuffer)) }))
-	slowDecodeQueues := manager.NewQueues(
+		receiver.ReleaseRecvBuffer)
+	slowDecodeQueues := dropletqueue.NewTypedQueues[*decoder.SlowItem](
+		manager,
 		"2-decode-to-slow-decode-"+msgType.String(),
 		config.DecoderQueueSize,
 		queueCount,
 		1,
 		libqueue.OptionFlushIndicator(3*time.Second),
-		libqueue.OptionRelease(func(p interface{}) { decoder.ReleaseSlowItem(p.(*decoder.SlowItem)) }))
+		decoder.ReleaseSlowItem)
 
 	recv.RegistHandler(msgType, decodeQueues, queueCount)
 
@@ -97,11 +109,12 @@ func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platfo
 			i,
 			platformDatas[i],
 			prometheusLabelTable,
-			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
-			queue.QueueWriter(slowDecodeQueues.FixedMultiQueue[i]),
+			decodeQueues.TypedMultiQueue[i],
+			slowDecodeQueues.TypedMultiQueue[i],
 			metricsWriter,
 			config,
 		)
+		decoders[i].SetQuota(recv.QuotaManager())
 		slowMetricsWriter, err := dbwriter.NewPrometheusWriter(i, initAppLabelColumnCount, "slow-prometheus", dbwriter.PROMETHEUS_DB, config)
 		if err != nil {
 			return nil, err
@@ -111,7 +124,7 @@ func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platfo
 			i,
 			slowPlatformDatas[i],
 			prometheusLabelTable,
-			queue.QueueReader(slowDecodeQueues.FixedMultiQueue[i]),
+			slowDecodeQueues.TypedMultiQueue[i],
 			slowMetricsWriter,
 			config,
 		)
@@ -123,6 +136,8 @@ func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platfo
 		SlowPlatformDatas:    slowPlatformDatas,
 		prometheusLabelTable: prometheusLabelTable,
 		SlowDecoders:         slowDecoders,
+		decodeQueues:         decodeQueues,
+		serverWriteRequest:   serverWriteRequest,
 	}, nil
 }
 
@@ -136,6 +151,43 @@ func (m *PrometheusHandler) Start() {
 		go decoder.Run()
 		go m.SlowDecoders[i].Run()
 	}
+	go m.receiveServerWriteRequest()
+}
+
+// receiveServerWriteRequest puts the samples generated by the server itself into the decode queues,
+// encoded as the messages from agents with vtap id decoder.SERVER_VTAP_ID
+func (m *PrometheusHandler) receiveServerWriteRequest() {
+	buffer := make([]*servercommon.PrometheusWriteRequest, decoder.BUFFER_SIZE)
+	encoder := &codec.SimpleEncoder{}
+	prometheusMetric := &pb.PrometheusMetric{}
+	queueCount := m.Config.DecoderQueueCount
+	index := 0
+	for {
+		n := m.serverWriteRequest.Gets(buffer)
+		for i := 0; i < n; i++ {
+			req := buffer[i]
+			if req == nil {
+				continue
+			}
+			prometheusMetric.Metrics = req.Compressed
+			data, err := prometheusMetric.Marshal()
+			if err != nil {
+				log.Warningf("marshal prometheus write request of org %d failed: %s", req.OrgID, err)
+				continue
+			}
+			encoder.Reset()
+			encoder.WriteBytes(data)
+
+			recvBuffer, _ := receiver.AcquireRecvBuffer(len(encoder.Bytes()), receiver.TCP)
+			recvBuffer.Begin = 0
+			recvBuffer.End = copy(recvBuffer.Buffer, encoder.Bytes())
+			recvBuffer.VtapID = decoder.SERVER_VTAP_ID
+			recvBuffer.OrgID = req.OrgID
+			recvBuffer.TeamID = ckdb.DEFAULT_TEAM_ID
+			m.decodeQueues.Put(queue.HashKey(index%queueCount), recvBuffer)
+			index++
+		}
+	}
 }
 
 func (m *PrometheusHandler) Close() error {
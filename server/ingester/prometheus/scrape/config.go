@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/prometheus/prometheus/model/relabel"
+
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+const (
+	DefaultScrapeInterval  = 60 // unit: s
+	DefaultScrapeTimeout   = 10 // unit: s
+	DefaultRefreshInterval = 60 // unit: s
+	DefaultMetricsPath     = "/metrics"
+	DefaultScheme          = "http"
+
+	ROLE_POD     = "pod"
+	ROLE_SERVICE = "service"
+)
+
+type Config struct {
+	Enabled         bool           `yaml:"enabled"`
+	ScrapeInterval  int            `yaml:"scrape-interval"`  // default of the scrape configs, unit: s
+	ScrapeTimeout   int            `yaml:"scrape-timeout"`   // default of the scrape configs, unit: s
+	RefreshInterval int            `yaml:"refresh-interval"` // interval to refresh the targets, unit: s
+	ScrapeConfigs   []ScrapeConfig `yaml:"scrape-configs"`
+}
+
+// ScrapeConfig is a subset of the scrape_config of prometheus, the relabel configs are in the format of prometheus
+type ScrapeConfig struct {
+	JobName              string               `yaml:"job-name"`
+	OrgId                uint16               `yaml:"org-id"`
+	ScrapeInterval       int                  `yaml:"scrape-interval"`
+	ScrapeTimeout        int                  `yaml:"scrape-timeout"`
+	MetricsPath          string               `yaml:"metrics-path"`
+	Scheme               string               `yaml:"scheme"`
+	Params               url.Values           `yaml:"params"`
+	HonorLabels          bool                 `yaml:"honor-labels"`
+	SampleLimit          int                  `yaml:"sample-limit"` // 0 means no limit
+	StaticConfigs        []StaticConfig       `yaml:"static-configs"`
+	KubernetesSDConfigs  []KubernetesSDConfig `yaml:"kubernetes-sd-configs"`
+	RelabelConfigs       []*relabel.Config    `yaml:"relabel-configs"`
+	MetricRelabelConfigs []*relabel.Config    `yaml:"metric-relabel-configs"`
+}
+
+type StaticConfig struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// KubernetesSDConfig discovers the targets from the pod/service inventory of the controller
+type KubernetesSDConfig struct {
+	Role string `yaml:"role"` // pod or service
+}
+
+func (c *Config) Validate() error {
+	if c.ScrapeInterval <= 0 {
+		c.ScrapeInterval = DefaultScrapeInterval
+	}
+	if c.ScrapeTimeout <= 0 {
+		c.ScrapeTimeout = DefaultScrapeTimeout
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	jobs := make(map[string]bool)
+	for i := range c.ScrapeConfigs {
+		sc := &c.ScrapeConfigs[i]
+		if sc.JobName == "" {
+			return fmt.Errorf("'scrape-configs[%d].job-name' is empty", i)
+		}
+		if jobs[sc.JobName] {
+			return fmt.Errorf("'scrape-configs[%d].job-name' %s is duplicated", i, sc.JobName)
+		}
+		jobs[sc.JobName] = true
+
+		if sc.OrgId == 0 {
+			sc.OrgId = ckdb.DEFAULT_ORG_ID
+		} else if sc.OrgId > ckdb.MAX_ORG_ID {
+			return fmt.Errorf("'scrape-configs[%d].org-id' %d is invalid", i, sc.OrgId)
+		}
+		if sc.ScrapeInterval <= 0 {
+			sc.ScrapeInterval = c.ScrapeInterval
+		}
+		if sc.ScrapeTimeout <= 0 {
+			sc.ScrapeTimeout = c.ScrapeTimeout
+		}
+		if sc.ScrapeTimeout > sc.ScrapeInterval {
+			sc.ScrapeTimeout = sc.ScrapeInterval
+		}
+		if sc.MetricsPath == "" {
+			sc.MetricsPath = DefaultMetricsPath
+		}
+		if sc.Scheme == "" {
+			sc.Scheme = DefaultScheme
+		} else if sc.Scheme != "http" && sc.Scheme != "https" {
+			return fmt.Errorf("'scrape-configs[%d].scheme' %s is invalid, should be http or https", i, sc.Scheme)
+		}
+		for _, sd := range sc.KubernetesSDConfigs {
+			if sd.Role != ROLE_POD && sd.Role != ROLE_SERVICE {
+				return fmt.Errorf("'scrape-configs[%d].kubernetes-sd-configs.role' %s is invalid, should be %s or %s", i, sd.Role, ROLE_POD, ROLE_SERVICE)
+			}
+		}
+		for j, rc := range append(sc.RelabelConfigs, sc.MetricRelabelConfigs...) {
+			if rc == nil {
+				return fmt.Errorf("'scrape-configs[%d]' relabel config %d is empty", i, j)
+			}
+		}
+	}
+	return nil
+}
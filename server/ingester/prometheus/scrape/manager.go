@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+	"github.com/prometheus/common/model"
+)
+
+var log = logging.MustGetLogger("prometheus.scrape")
+
+// Writer writes the snappy compressed prompb.WriteRequest of an org
+type Writer func(orgId uint16, compressed []byte) error
+
+// Discovery returns the targets of an org discovered by the controller, see servercommon.PrometheusTargetDiscovery
+type Discovery func(orgId uint16, role string) ([]model.LabelSet, error)
+
+// Members returns the names of all the deepflow-servers sharing the targets
+type Members func() []string
+
+type Counter struct {
+	Targets       int64 `statsd:"targets"`        // targets scraped by this ingester
+	AllTargets    int64 `statsd:"all-targets"`    // targets of all the ingesters
+	DropTargets   int64 `statsd:"drop-targets"`   // targets dropped by the relabel configs or invalid
+	DiscoverError int64 `statsd:"discover-error"` // the targets of the job are not updated
+	Scrapes       int64 `statsd:"scrapes"`
+	ScrapeErrors  int64 `statsd:"scrape-errors"`
+	Samples       int64 `statsd:"samples"`
+	WriteErrors   int64 `statsd:"write-errors"`
+}
+
+// Manager scrapes the targets of the static configs and the ones discovered by the controller,
+// the targets are distributed across the deepflow-servers by consistent hashing
+type Manager struct {
+	config    *Config
+	discovery Discovery
+	members   Members
+	self      string
+	write     Writer
+	client    *http.Client
+
+	lock  sync.Mutex
+	loops map[string]*scrapeLoop
+
+	counter *Counter
+	stop    chan struct{}
+	closed  int32
+}
+
+// NewManager creates the manager, if members is nil, all the targets are scraped by this ingester
+func NewManager(config *Config, discovery Discovery, members Members, self string, write Writer) *Manager {
+	return &Manager{
+		config:    config,
+		discovery: discovery,
+		members:   members,
+		self:      self,
+		write:     write,
+		client:    &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		loops:     make(map[string]*scrapeLoop),
+		counter:   &Counter{},
+		stop:      make(chan struct{}),
+	}
+}
+
+func (m *Manager) Start() {
+	go m.run()
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(time.Duration(m.config.RefreshInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		m.refresh()
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Manager) Close() error {
+	if !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+		return nil
+	}
+	close(m.stop)
+	m.lock.Lock()
+	loops := m.loops
+	m.loops = make(map[string]*scrapeLoop)
+	m.lock.Unlock()
+	for _, loop := range loops {
+		loop.close()
+	}
+	return nil
+}
+
+func (m *Manager) Closed() bool {
+	return atomic.LoadInt32(&m.closed) == 1
+}
+
+func (m *Manager) GetCounter() interface{} {
+	counter := &Counter{}
+	m.lock.Lock()
+	counter.Targets = int64(len(m.loops))
+	m.lock.Unlock()
+	counter.AllTargets = atomic.LoadInt64(&m.counter.AllTargets)
+	counter.DropTargets = atomic.LoadInt64(&m.counter.DropTargets)
+	counter.DiscoverError = atomic.SwapInt64(&m.counter.DiscoverError, 0)
+	counter.Scrapes = atomic.SwapInt64(&m.counter.Scrapes, 0)
+	counter.ScrapeErrors = atomic.SwapInt64(&m.counter.ScrapeErrors, 0)
+	counter.Samples = atomic.SwapInt64(&m.counter.Samples, 0)
+	counter.WriteErrors = atomic.SwapInt64(&m.counter.WriteErrors, 0)
+	return counter
+}
+
+// refresh updates the targets, and starts or stops the scrape loops of the targets owned by this ingester
+func (m *Manager) refresh() {
+	var r *ring
+	if m.members != nil {
+		members := m.members()
+		found := false
+		for _, member := range members {
+			if member == m.self {
+				found = true
+				break
+			}
+		}
+		// keep the current targets until this ingester is in the members, otherwise the targets may be scraped twice
+		if !found {
+			log.Warningf("'%s' is not in the deepflow-servers %v, the scrape targets are not updated", m.self, members)
+			return
+		}
+		r = newRing(members)
+	}
+
+	targets, failedJobs := m.targets()
+	allTargets, dropTargets := len(targets), 0
+	owned := make(map[string]*Target, len(targets))
+	for _, t := range targets {
+		if t == nil {
+			dropTargets++
+			continue
+		}
+		if r != nil && r.owner(t.key()) != m.self {
+			continue
+		}
+		owned[t.key()] = t
+	}
+	atomic.StoreInt64(&m.counter.AllTargets, int64(allTargets-dropTargets))
+	atomic.StoreInt64(&m.counter.DropTargets, int64(dropTargets))
+
+	stopped := []*scrapeLoop{}
+	m.lock.Lock()
+	if m.Closed() {
+		m.lock.Unlock()
+		return
+	}
+	for key, loop := range m.loops {
+		if failedJobs[loop.target.Job] {
+			continue
+		}
+		if t, ok := owned[key]; !ok || !t.equal(loop.target) {
+			stopped = append(stopped, loop)
+			delete(m.loops, key)
+		}
+	}
+	for key, t := range owned {
+		if _, ok := m.loops[key]; ok {
+			continue
+		}
+		loop := newScrapeLoop(t, m.client, m.write, m.counter)
+		m.loops[key] = loop
+		go loop.run(t.offset())
+	}
+	m.lock.Unlock()
+
+	// a stopped loop may be scraping, wait for it without the lock
+	for _, loop := range stopped {
+		loop.close()
+	}
+}
+
+// targets returns the targets of all the scrape configs, the dropped targets are nil,
+// and the jobs failed to discover the targets are returned to keep their current targets
+func (m *Manager) targets() ([]*Target, map[string]bool) {
+	targets := []*Target{}
+	failedJobs := make(map[string]bool)
+	for i := range m.config.ScrapeConfigs {
+		config := &m.config.ScrapeConfigs[i]
+		lsets := staticTargets(config.StaticConfigs)
+		for _, sd := range config.KubernetesSDConfigs {
+			if m.discovery == nil {
+				break
+			}
+			discovered, err := m.discovery(config.OrgId, sd.Role)
+			if err != nil {
+				log.Warningf("discover the %s targets of job %s failed: %s", sd.Role, config.JobName, err)
+				atomic.AddInt64(&m.counter.DiscoverError, 1)
+				failedJobs[config.JobName] = true
+				continue
+			}
+			for _, ls := range discovered {
+				lsets = append(lsets, labelSetToLabels(ls))
+			}
+		}
+		for _, lset := range lsets {
+			t, err := newTarget(lset, config)
+			if err != nil {
+				log.Debugf("target %s of job %s is invalid: %s", lset, config.JobName, err)
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, failedJobs
+}
+
+func (m *Manager) HandleSimpleCommand(op uint16, arg string) string {
+	m.lock.Lock()
+	loops := make([]*scrapeLoop, 0, len(m.loops))
+	for _, loop := range m.loops {
+		if arg == "" || loop.target.Job == arg {
+			loops = append(loops, loop)
+		}
+	}
+	m.lock.Unlock()
+	sort.Slice(loops, func(i, j int) bool {
+		if loops[i].target.Job != loops[j].target.Job {
+			return loops[i].target.Job < loops[j].target.Job
+		}
+		return loops[i].target.URL < loops[j].target.URL
+	})
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%-20s %-6s %-8s %-20s %-10s %-8s %s\n", "Job", "OrgId", "Health", "LastScrape", "Duration", "Samples", "URL/Labels/Error")
+	for _, loop := range loops {
+		s := loop.getStatus()
+		health, lastScrape := "unknown", "-"
+		if !s.lastScrape.IsZero() {
+			health, lastScrape = "up", s.lastScrape.Format(time.DateTime)
+			if s.lastError != "" {
+				health = "down"
+			}
+		}
+		fmt.Fprintf(sb, "%-20s %-6d %-8s %-20s %-10s %-8d %s %s %s\n", loop.target.Job, loop.target.OrgId, health, lastScrape,
+			s.lastDuration.Truncate(time.Millisecond), s.lastSamples, loop.target.URL, loop.target.Labels, s.lastError)
+	}
+	fmt.Fprintf(sb, "targets shown: %d, targets of all ingesters: %d\n", len(loops), atomic.LoadInt64(&m.counter.AllTargets))
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/OneOfOne/xxhash"
+)
+
+// virtual nodes of each member, so that the targets are evenly distributed and
+// only the targets of the changed member move when the members change
+const RING_VIRTUAL_NODES = 128
+
+// ring is a consistent hash ring of the deepflow-servers, every server builds the same
+// ring from the same members, so each target is scraped by exactly one of them
+type ring struct {
+	hashes  []uint64
+	members []string // member of hashes[i]
+}
+
+func newRing(members []string) *ring {
+	r := &ring{
+		hashes:  make([]uint64, 0, len(members)*RING_VIRTUAL_NODES),
+		members: make([]string, 0, len(members)*RING_VIRTUAL_NODES),
+	}
+	type node struct {
+		hash   uint64
+		member string
+	}
+	nodes := make([]node, 0, len(members)*RING_VIRTUAL_NODES)
+	for _, m := range members {
+		for i := 0; i < RING_VIRTUAL_NODES; i++ {
+			nodes = append(nodes, node{xxhash.ChecksumString64(m + "#" + strconv.Itoa(i)), m})
+		}
+	}
+	// the member is compared when the hashes conflict, so the order is the same on all servers
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].hash != nodes[j].hash {
+			return nodes[i].hash < nodes[j].hash
+		}
+		return nodes[i].member < nodes[j].member
+	})
+	for _, n := range nodes {
+		r.hashes = append(r.hashes, n.hash)
+		r.members = append(r.members, n.member)
+	}
+	return r
+}
+
+// owner returns the member which the key belongs to, or "" if the ring is empty
+func (r *ring) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := xxhash.ChecksumString64(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.members[i]
+}
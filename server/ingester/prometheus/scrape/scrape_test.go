@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRing(t *testing.T) {
+	members := []string{"server-0", "server-1", "server-2"}
+	r := newRing(members)
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("1/http://10.0.0.%d:9100/metrics", i)
+		owners[key] = r.owner(key)
+		counts[owners[key]]++
+	}
+	for _, m := range members {
+		if counts[m] < 500 {
+			t.Errorf("member %s owns too few keys: %v", m, counts)
+		}
+	}
+
+	// the same ring is built regardless of the order of the members
+	if other := newRing([]string{"server-2", "server-0", "server-1"}); other.owner("a") != r.owner("a") {
+		t.Error("the owner depends on the order of the members")
+	}
+
+	// only the keys of the removed member move
+	r = newRing(members[:2])
+	for key, owner := range owners {
+		if owner != "server-2" && r.owner(key) != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, r.owner(key))
+		}
+	}
+
+	if newRing(nil).owner("a") != "" {
+		t.Error("owner of an empty ring should be empty")
+	}
+}
+
+func testScrapeConfig(t *testing.T, s string) *ScrapeConfig {
+	c := &Config{}
+	if err := yaml.Unmarshal([]byte(s), c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &c.ScrapeConfigs[0]
+}
+
+func TestNewTarget(t *testing.T) {
+	config := testScrapeConfig(t, `
+scrape-configs:
+- job-name: node
+  scrape-interval: 30
+  params:
+    module: [http_2xx]
+  relabel-configs:
+  - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_scrape]
+    regex: "true"
+    action: keep
+  - source_labels: [__meta_kubernetes_pod_label_app]
+    target_label: app
+  - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_path]
+    regex: (.+)
+    target_label: __metrics_path__
+`)
+	target, err := newTarget(labels.FromStrings(
+		model.AddressLabel, "10.0.0.1",
+		"__meta_kubernetes_pod_annotation_prometheus_io_scrape", "true",
+		"__meta_kubernetes_pod_annotation_prometheus_io_path", "/stats",
+		"__meta_kubernetes_pod_label_app", "nginx",
+	), config)
+	if err != nil || target == nil {
+		t.Fatalf("new target failed: %v %v", target, err)
+	}
+	if target.URL != "http://10.0.0.1:80/stats?module=http_2xx" {
+		t.Errorf("unexpected url %s", target.URL)
+	}
+	expected := labels.FromStrings("app", "nginx", model.InstanceLabel, "10.0.0.1:80", model.JobLabel, "node")
+	if !labels.Equal(target.Labels, expected) {
+		t.Errorf("expected labels %s, got %s", expected, target.Labels)
+	}
+	if target.Interval != 30*time.Second || target.Timeout != 10*time.Second || target.OrgId != 1 {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if offset := target.offset(); offset < 0 || offset >= target.Interval {
+		t.Errorf("invalid offset %s", offset)
+	}
+
+	// dropped by the keep action
+	target, err = newTarget(labels.FromStrings(model.AddressLabel, "10.0.0.2:9100"), config)
+	if err != nil || target != nil {
+		t.Errorf("target should be dropped: %v %v", target, err)
+	}
+}
+
+func TestMergeTargetLabels(t *testing.T) {
+	scraped := labels.FromStrings(model.MetricNameLabel, "m", model.JobLabel, "app", "exported_job", "x")
+	target := labels.FromStrings(model.JobLabel, "node", model.InstanceLabel, "a:80")
+
+	merged := mergeTargetLabels(scraped, target, false)
+	expected := labels.FromStrings(model.MetricNameLabel, "m", model.JobLabel, "node", model.InstanceLabel, "a:80",
+		"exported_job", "x", "exported_exported_job", "app")
+	if !labels.Equal(merged, expected) {
+		t.Errorf("expected %s, got %s", expected, merged)
+	}
+
+	merged = mergeTargetLabels(scraped, target, true)
+	expected = labels.FromStrings(model.MetricNameLabel, "m", model.JobLabel, "app", model.InstanceLabel, "a:80", "exported_job", "x")
+	if !labels.Equal(merged, expected) {
+		t.Errorf("expected %s, got %s", expected, merged)
+	}
+}
+
+type testWriter struct {
+	sync.Mutex
+	series map[string]float64
+}
+
+func (w *testWriter) write(orgId uint16, compressed []byte) error {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return err
+	}
+	req := &prompb.WriteRequest{}
+	if err := req.Unmarshal(data); err != nil {
+		return err
+	}
+	w.Lock()
+	defer w.Unlock()
+	for _, ts := range req.Timeseries {
+		lb := labels.NewBuilder(nil)
+		for _, l := range ts.Labels {
+			lb.Set(l.Name, l.Value)
+		}
+		w.series[fmt.Sprintf("%d%s", orgId, lb.Labels())] = ts.Samples[0].Value
+	}
+	return nil
+}
+
+func TestScrapeLoop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "# TYPE requests counter")
+		fmt.Fprintln(w, `requests{code="200"} 10`)
+		fmt.Fprintln(w, `requests{code="500"} 2`)
+		fmt.Fprintln(w, `go_goroutines 5`)
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	config := testScrapeConfig(t, fmt.Sprintf(`
+scrape-configs:
+- job-name: app
+  org-id: 2
+  static-configs:
+  - targets: [%s]
+    labels:
+      env: test
+  metric-relabel-configs:
+  - source_labels: [__name__]
+    regex: go_.*
+    action: drop
+`, addr))
+	target, err := newTarget(staticTargets(config.StaticConfigs)[0], config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWriter{series: make(map[string]float64)}
+	loop := newScrapeLoop(target, http.DefaultClient, w.write, &Counter{})
+	loop.scrapeOnce(time.Now())
+
+	instance := fmt.Sprintf(`env="test", instance="%s", job="app"`, addr)
+	for series, value := range map[string]float64{
+		`2{__name__="requests", code="200", ` + instance + `}`:                  10,
+		`2{__name__="requests", code="500", ` + instance + `}`:                  2,
+		`2{__name__="up", ` + instance + `}`:                                    1,
+		`2{__name__="scrape_samples_scraped", ` + instance + `}`:                3,
+		`2{__name__="scrape_samples_post_metric_relabeling", ` + instance + `}`: 2,
+	} {
+		if v, ok := w.series[series]; !ok || v != value {
+			t.Errorf("expected %s %v, got %v %v", series, value, v, ok)
+		}
+	}
+	if len(w.series) != 6 {
+		t.Errorf("unexpected series %v", w.series)
+	}
+	if s := loop.getStatus(); s.lastError != "" || s.lastSamples != 2 {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	// the target is down
+	server.Close()
+	loop.scrapeOnce(time.Now())
+	if v := w.series[`2{__name__="up", `+instance+`}`]; v != 0 {
+		t.Errorf("target should be down, got up %v", v)
+	}
+}
+
+func TestManagerOwnership(t *testing.T) {
+	config := &Config{
+		ScrapeConfigs: []ScrapeConfig{{
+			JobName:             "pods",
+			KubernetesSDConfigs: []KubernetesSDConfig{{Role: ROLE_POD}},
+			RelabelConfigs:      []*relabel.Config{},
+		}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	discovery := func(orgId uint16, role string) ([]model.LabelSet, error) {
+		lsets := []model.LabelSet{}
+		for i := 0; i < 100; i++ {
+			lsets = append(lsets, model.LabelSet{model.AddressLabel: model.LabelValue(fmt.Sprintf("10.0.0.%d:9100", i))})
+		}
+		return lsets, nil
+	}
+	members := func() []string { return []string{"server-0", "server-1"} }
+	write := func(uint16, []byte) error { return nil }
+
+	owned := make(map[string]int)
+	for _, self := range []string{"server-0", "server-1", "server-2"} {
+		m := NewManager(config, discovery, members, self, write)
+		m.refresh()
+		for key := range m.loops {
+			owned[key]++
+		}
+		counter := m.GetCounter().(*Counter)
+		if self == "server-2" && counter.Targets != 0 {
+			t.Errorf("%s is not a member but scrapes %d targets", self, counter.Targets)
+		}
+		m.Close()
+	}
+	if len(owned) != 100 {
+		t.Errorf("expected 100 targets scraped, got %d", len(owned))
+	}
+	for key, n := range owned {
+		if n != 1 {
+			t.Errorf("target %s is scraped %d times", key, n)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	// max time series in one write request
+	WRITE_BATCH_SIZE = 1024
+	// max size of a scrape response
+	MAX_BODY_SIZE = 64 << 20
+
+	ACCEPT_HEADER = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+	USER_AGENT    = "deepflow-server"
+)
+
+var errSampleLimit = errors.New("sample limit exceeded")
+
+// status of the last scrape, shown by the debug command
+type status struct {
+	lastScrape   time.Time
+	lastDuration time.Duration
+	lastSamples  int
+	lastError    string
+}
+
+type scrapeLoop struct {
+	target  *Target
+	client  *http.Client
+	write   Writer
+	counter *Counter
+
+	statusLock sync.Mutex
+	status     status
+
+	buffer     []byte
+	timeSeries []prompb.TimeSeries
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newScrapeLoop(target *Target, client *http.Client, write Writer, counter *Counter) *scrapeLoop {
+	return &scrapeLoop{
+		target:  target,
+		client:  client,
+		write:   write,
+		counter: counter,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// run scrapes the target every interval after the offset, the offset spreads the scrapes of the targets over the interval
+func (l *scrapeLoop) run(offset time.Duration) {
+	defer close(l.done)
+	select {
+	case <-time.After(offset):
+	case <-l.stop:
+		return
+	}
+	ticker := time.NewTicker(l.target.Interval)
+	defer ticker.Stop()
+	for {
+		l.scrapeOnce(time.Now())
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *scrapeLoop) close() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *scrapeLoop) getStatus() status {
+	l.statusLock.Lock()
+	defer l.statusLock.Unlock()
+	return l.status
+}
+
+func (l *scrapeLoop) scrapeOnce(start time.Time) {
+	atomic.AddInt64(&l.counter.Scrapes, 1)
+	l.timeSeries = l.timeSeries[:0]
+	scraped, samples, err := l.scrape(start)
+	duration := time.Since(start)
+	if err != nil {
+		atomic.AddInt64(&l.counter.ScrapeErrors, 1)
+		l.timeSeries = l.timeSeries[:0]
+		samples = 0
+	}
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+	// the report series of prometheus
+	timestamp := start.UnixMilli()
+	l.appendReport("up", up, timestamp)
+	l.appendReport("scrape_duration_seconds", duration.Seconds(), timestamp)
+	l.appendReport("scrape_samples_scraped", float64(scraped), timestamp)
+	l.appendReport("scrape_samples_post_metric_relabeling", float64(samples), timestamp)
+	atomic.AddInt64(&l.counter.Samples, int64(samples))
+	if werr := l.flush(); werr != nil {
+		atomic.AddInt64(&l.counter.WriteErrors, 1)
+		if err == nil {
+			err = werr
+		}
+	}
+
+	l.statusLock.Lock()
+	l.status = status{lastScrape: start, lastDuration: duration, lastSamples: samples}
+	if err != nil {
+		l.status.lastError = err.Error()
+	}
+	l.statusLock.Unlock()
+}
+
+// scrape returns the count of the scraped samples and the samples after metric relabeling
+func (l *scrapeLoop) scrape(start time.Time) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.target.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.target.URL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Accept", ACCEPT_HEADER)
+	req.Header.Set("User-Agent", USER_AGENT)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(l.target.Timeout.Seconds(), 'f', -1, 64))
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	l.buffer = l.buffer[:0]
+	buffer := bytesBuffer{l.buffer}
+	if _, err := io.Copy(&buffer, io.LimitReader(resp.Body, MAX_BODY_SIZE+1)); err != nil {
+		return 0, 0, err
+	}
+	l.buffer = buffer.b
+	if len(l.buffer) > MAX_BODY_SIZE {
+		return 0, 0, fmt.Errorf("response is larger than %d bytes", MAX_BODY_SIZE)
+	}
+	return l.parse(l.buffer, resp.Header.Get("Content-Type"), start.UnixMilli())
+}
+
+func (l *scrapeLoop) parse(body []byte, contentType string, defaultTimestamp int64) (int, int, error) {
+	// the parser of the text format is used if the content type is invalid
+	parser, _ := textparse.New(body, contentType)
+	config := l.target.config
+	scraped, samples := 0, 0
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return scraped, samples, err
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+		_, ts, v := parser.Series()
+		if value.IsStaleNaN(v) {
+			continue
+		}
+		scraped++
+		timestamp := defaultTimestamp
+		if ts != nil {
+			timestamp = *ts
+		}
+		// the parser appends the labels to lset, it cannot be reused by the next sample
+		var lset labels.Labels
+		parser.Metric(&lset)
+		lset = mergeTargetLabels(lset, l.target.Labels, config.HonorLabels)
+		if len(config.MetricRelabelConfigs) > 0 {
+			if lset = relabel.Process(lset, config.MetricRelabelConfigs...); lset == nil {
+				continue
+			}
+		}
+		samples++
+		if config.SampleLimit > 0 && samples > config.SampleLimit {
+			return scraped, samples, errSampleLimit
+		}
+		l.appendSample(lset, v, timestamp)
+	}
+	return scraped, samples, nil
+}
+
+// mergeTargetLabels adds the target labels to the scraped labels like prometheus, if honorLabels is false,
+// the conflicting scraped labels are renamed to 'exported_<name>'
+func mergeTargetLabels(lset, targetLabels labels.Labels, honorLabels bool) labels.Labels {
+	lb := labels.NewBuilder(lset)
+	for _, l := range targetLabels {
+		existing := lset.Get(l.Name)
+		if existing == "" {
+			lb.Set(l.Name, l.Value)
+		} else if !honorLabels {
+			name := model.ExportedLabelPrefix + l.Name
+			for lset.Has(name) {
+				name = model.ExportedLabelPrefix + name
+			}
+			lb.Set(name, existing)
+			lb.Set(l.Name, l.Value)
+		}
+	}
+	return lb.Labels()
+}
+
+func (l *scrapeLoop) appendReport(name string, v float64, timestamp int64) {
+	lb := labels.NewBuilder(l.target.Labels)
+	lb.Set(model.MetricNameLabel, name)
+	l.appendSample(lb.Labels(), v, timestamp)
+}
+
+func (l *scrapeLoop) appendSample(lset labels.Labels, v float64, timestamp int64) {
+	ts := prompb.TimeSeries{
+		Labels:  make([]prompb.Label, 0, len(lset)),
+		Samples: []prompb.Sample{{Timestamp: timestamp, Value: v}},
+	}
+	for _, label := range lset {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: label.Name, Value: label.Value})
+	}
+	l.timeSeries = append(l.timeSeries, ts)
+}
+
+// flush writes the time series in batches
+func (l *scrapeLoop) flush() error {
+	defer func() { l.timeSeries = l.timeSeries[:0] }()
+	for start := 0; start < len(l.timeSeries); start += WRITE_BATCH_SIZE {
+		end := start + WRITE_BATCH_SIZE
+		if end > len(l.timeSeries) {
+			end = len(l.timeSeries)
+		}
+		req := &prompb.WriteRequest{Timeseries: l.timeSeries[start:end]}
+		data, err := req.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := l.write(l.target.OrgId, snappy.Encode(nil, data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bytesBuffer reuses the buffer of the last scrape
+type bytesBuffer struct {
+	b []byte
+}
+
+func (b *bytesBuffer) Write(p []byte) (int, error) {
+	b.b = append(b.b, p...)
+	return len(p), nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scrape
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// Target is a scrape target after relabeling
+type Target struct {
+	Job      string
+	OrgId    uint16
+	URL      string
+	Labels   labels.Labels // the labels added to the scraped samples, e.g. job and instance
+	Interval time.Duration
+	Timeout  time.Duration
+
+	config *ScrapeConfig
+}
+
+// key identifies the target on the hash ring and among the running scrape loops
+func (t *Target) key() string {
+	return strconv.Itoa(int(t.OrgId)) + "/" + t.URL + "/" + t.Labels.String()
+}
+
+// equal returns true if the running scrape loop of t can be kept for o
+func (t *Target) equal(o *Target) bool {
+	return t.key() == o.key() && t.Interval == o.Interval && t.Timeout == o.Timeout && t.config == o.config
+}
+
+// offset spreads the scrapes of the targets evenly over the interval, and keeps the same for a target
+func (t *Target) offset() time.Duration {
+	return time.Duration(xxhash.ChecksumString64(t.key()) % uint64(t.Interval))
+}
+
+// newTarget populates the labels of a discovered target and relabels it like prometheus,
+// it returns nil without error if the target is dropped by the relabel configs
+func newTarget(lset labels.Labels, config *ScrapeConfig) (*Target, error) {
+	lb := labels.NewBuilder(lset)
+	for _, l := range []labels.Label{
+		{Name: model.JobLabel, Value: config.JobName},
+		{Name: model.ScrapeIntervalLabel, Value: model.Duration(time.Duration(config.ScrapeInterval) * time.Second).String()},
+		{Name: model.ScrapeTimeoutLabel, Value: model.Duration(time.Duration(config.ScrapeTimeout) * time.Second).String()},
+		{Name: model.MetricsPathLabel, Value: config.MetricsPath},
+		{Name: model.SchemeLabel, Value: config.Scheme},
+	} {
+		if lset.Get(l.Name) == "" {
+			lb.Set(l.Name, l.Value)
+		}
+	}
+	for k, v := range config.Params {
+		if len(v) > 0 {
+			lb.Set(model.ParamLabelPrefix+k, v[0])
+		}
+	}
+
+	lset = relabel.Process(lb.Labels(), config.RelabelConfigs...)
+	if lset == nil {
+		return nil, nil
+	}
+	addr := lset.Get(model.AddressLabel)
+	if addr == "" {
+		return nil, errors.New("no address")
+	}
+	scheme := lset.Get(model.SchemeLabel)
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid scheme '%s'", scheme)
+	}
+	// add the default port of the scheme if the address has no port
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if _, _, err := net.SplitHostPort(addr + ":1234"); err != nil {
+			return nil, fmt.Errorf("invalid address '%s'", addr)
+		}
+		if scheme == "https" {
+			addr += ":443"
+		} else {
+			addr += ":80"
+		}
+	}
+	if strings.Contains(addr, "/") {
+		return nil, fmt.Errorf("invalid address '%s'", addr)
+	}
+
+	interval, err := model.ParseDuration(lset.Get(model.ScrapeIntervalLabel))
+	if err != nil || interval == 0 {
+		return nil, fmt.Errorf("invalid scrape interval '%s'", lset.Get(model.ScrapeIntervalLabel))
+	}
+	timeout, err := model.ParseDuration(lset.Get(model.ScrapeTimeoutLabel))
+	if err != nil || timeout == 0 || timeout > interval {
+		return nil, fmt.Errorf("invalid scrape timeout '%s'", lset.Get(model.ScrapeTimeoutLabel))
+	}
+
+	params := url.Values{}
+	for k, v := range config.Params {
+		params[k] = append([]string{}, v...)
+	}
+	lb = labels.NewBuilder(nil)
+	for _, l := range lset {
+		if strings.HasPrefix(l.Name, model.ParamLabelPrefix) {
+			name := l.Name[len(model.ParamLabelPrefix):]
+			if len(params[name]) > 0 {
+				params[name][0] = l.Value
+			} else {
+				params.Set(name, l.Value)
+			}
+		}
+		// the labels starting with '__' are not added to the samples
+		if !strings.HasPrefix(l.Name, model.ReservedLabelPrefix) && l.Value != "" {
+			lb.Set(l.Name, l.Value)
+		}
+	}
+	if lset.Get(model.InstanceLabel) == "" {
+		lb.Set(model.InstanceLabel, addr)
+	}
+
+	u := &url.URL{
+		Scheme:   scheme,
+		Host:     addr,
+		Path:     lset.Get(model.MetricsPathLabel),
+		RawQuery: params.Encode(),
+	}
+	return &Target{
+		Job:      config.JobName,
+		OrgId:    config.OrgId,
+		URL:      u.String(),
+		Labels:   lb.Labels(),
+		Interval: time.Duration(interval),
+		Timeout:  time.Duration(timeout),
+		config:   config,
+	}, nil
+}
+
+// staticTargets returns the label sets of the static configs
+func staticTargets(configs []StaticConfig) []labels.Labels {
+	lsets := []labels.Labels{}
+	for _, sc := range configs {
+		for _, addr := range sc.Targets {
+			lb := labels.NewBuilder(labels.FromMap(sc.Labels))
+			lb.Set(model.AddressLabel, addr)
+			lsets = append(lsets, lb.Labels())
+		}
+	}
+	return lsets
+}
+
+func labelSetToLabels(ls model.LabelSet) labels.Labels {
+	lset := make(labels.Labels, 0, len(ls))
+	for name, value := range ls {
+		lset = append(lset, labels.Label{Name: string(name), Value: string(value)})
+	}
+	return labels.New(lset...)
+}
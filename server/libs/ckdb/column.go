@@ -115,6 +115,16 @@ const (
 	COLUMN_FLOW_ID                    = "flow_id"
 	COLUMN_AGGREGATED_FLOW_IDS        = "aggregated_flow_ids"
 	COLUMN_FLOW_LOAD                  = "flow_load"
+	COLUMN_GEO_AS_ORG_0               = "geo_as_org_0"
+	COLUMN_GEO_AS_ORG_1               = "geo_as_org_1"
+	COLUMN_GEO_ASN_0                  = "geo_asn_0"
+	COLUMN_GEO_ASN_1                  = "geo_asn_1"
+	COLUMN_GEO_CITY_0                 = "geo_city_0"
+	COLUMN_GEO_CITY_1                 = "geo_city_1"
+	COLUMN_GEO_COUNTRY_0              = "geo_country_0"
+	COLUMN_GEO_COUNTRY_1              = "geo_country_1"
+	COLUMN_GEO_REGION_0               = "geo_region_0"
+	COLUMN_GEO_REGION_1               = "geo_region_1"
 	COLUMN_GPROCESS_ID                = "gprocess_id"
 	COLUMN_GPROCESS_ID_0              = "gprocess_id_0"
 	COLUMN_GPROCESS_ID_1              = "gprocess_id_1"
@@ -466,6 +476,16 @@ var ColumnNames = []string{
 	COLUMN_FLOW_ID,
 	COLUMN_AGGREGATED_FLOW_IDS,
 	COLUMN_FLOW_LOAD,
+	COLUMN_GEO_AS_ORG_0,
+	COLUMN_GEO_AS_ORG_1,
+	COLUMN_GEO_ASN_0,
+	COLUMN_GEO_ASN_1,
+	COLUMN_GEO_CITY_0,
+	COLUMN_GEO_CITY_1,
+	COLUMN_GEO_COUNTRY_0,
+	COLUMN_GEO_COUNTRY_1,
+	COLUMN_GEO_REGION_0,
+	COLUMN_GEO_REGION_1,
 	COLUMN_GPROCESS_ID,
 	COLUMN_GPROCESS_ID_0,
 	COLUMN_GPROCESS_ID_1,
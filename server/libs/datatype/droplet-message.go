@@ -58,6 +58,8 @@ const (
 	MESSAGE_TYPE_SKYWALKING
 	MESSAGE_TYPE_DATADOG // 20
 	MESSAGE_TYPE_ALERT_EVENT
+	MESSAGE_TYPE_OPENTELEMETRY_LOG
+	MESSAGE_TYPE_OPENTELEMETRY_METRICS
 	MESSAGE_TYPE_MAX
 )
 
@@ -86,6 +88,8 @@ var MessageTypeString = [MESSAGE_TYPE_MAX]string{
 	MESSAGE_TYPE_SKYWALKING:               "skywalking",
 	MESSAGE_TYPE_DATADOG:                  "datadog",
 	MESSAGE_TYPE_ALERT_EVENT:              "alert_event",
+	MESSAGE_TYPE_OPENTELEMETRY_LOG:        "open_telemetry_log",
+	MESSAGE_TYPE_OPENTELEMETRY_METRICS:    "open_telemetry_metrics",
 }
 
 func (m MessageType) String() string {
@@ -132,6 +136,8 @@ var MessageHeaderTypes = [MESSAGE_TYPE_MAX]MessageHeaderType{
 	MESSAGE_TYPE_SKYWALKING:               HEADER_TYPE_LT_VTAP,
 	MESSAGE_TYPE_DATADOG:                  HEADER_TYPE_LT_VTAP,
 	MESSAGE_TYPE_ALERT_EVENT:              HEADER_TYPE_LT_VTAP,
+	MESSAGE_TYPE_OPENTELEMETRY_LOG:        HEADER_TYPE_LT_VTAP,
+	MESSAGE_TYPE_OPENTELEMETRY_METRICS:    HEADER_TYPE_LT_VTAP,
 }
 
 func (m MessageType) HeaderType() MessageHeaderType {
@@ -16,6 +16,10 @@
 
 package geo
 
+import (
+	"net"
+)
+
 type GeoInfo struct {
 	IPStart uint32
 	IPEnd   uint32
@@ -27,3 +31,16 @@ type GeoInfo struct {
 type GeoTree interface {
 	Query(ip uint32) (uint8, uint8)
 }
+
+type Location struct {
+	Country string
+	Region  string
+	City    string
+	ASN     uint32
+	ASOrg   string
+}
+
+// GeoProvider supports both IPv4 and IPv6, loc is filled only when found is true
+type GeoProvider interface {
+	Lookup(ip net.IP, loc *Location) (found bool)
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// MaxMind DB file format, see https://maxmind.github.io/MaxMind-DB/
+const (
+	mmdbDataSectionSeparatorSize = 16
+	mmdbMetadataMaxSize          = 128 * 1024
+)
+
+var mmdbMetadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	mmdbTypeExtended = iota
+	mmdbTypePointer
+	mmdbTypeString
+	mmdbTypeDouble
+	mmdbTypeBytes
+	mmdbTypeUint16
+	mmdbTypeUint32
+	mmdbTypeMap
+	mmdbTypeInt32
+	mmdbTypeUint64
+	mmdbTypeUint128
+	mmdbTypeArray
+	mmdbTypeContainer
+	mmdbTypeEndMarker
+	mmdbTypeBool
+	mmdbTypeFloat
+)
+
+var (
+	ErrMMDBInvalid     = errors.New("invalid mmdb file")
+	ErrMMDBUnsupported = errors.New("unsupported mmdb file")
+)
+
+type MMDBMetadata struct {
+	NodeCount    uint32
+	RecordSize   uint32
+	IPVersion    uint32
+	DatabaseType string
+	BuildEpoch   uint64
+}
+
+// MMDBReader is a read-only in-memory MaxMind DB reader, it is safe for concurrent use.
+type MMDBReader struct {
+	Metadata MMDBMetadata
+
+	tree      []byte
+	data      []byte
+	nodeBytes uint32
+	ipv4Start uint32
+}
+
+func OpenMMDB(path string) (*MMDBReader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDBReader(buffer)
+}
+
+func NewMMDBReader(buffer []byte) (*MMDBReader, error) {
+	searchStart := 0
+	if len(buffer) > mmdbMetadataMaxSize {
+		searchStart = len(buffer) - mmdbMetadataMaxSize
+	}
+	index := bytes.LastIndex(buffer[searchStart:], mmdbMetadataStartMarker)
+	if index < 0 {
+		return nil, fmt.Errorf("%w: metadata marker not found", ErrMMDBInvalid)
+	}
+	metadataStart := searchStart + index + len(mmdbMetadataStartMarker)
+	d := &mmdbDecoder{buffer: buffer[metadataStart:]}
+	value, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode metadata failed: %s", ErrMMDBInvalid, err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrMMDBInvalid)
+	}
+
+	r := &MMDBReader{}
+	r.Metadata.NodeCount = uint32(toUint64(metadata["node_count"]))
+	r.Metadata.RecordSize = uint32(toUint64(metadata["record_size"]))
+	r.Metadata.IPVersion = uint32(toUint64(metadata["ip_version"]))
+	r.Metadata.BuildEpoch = toUint64(metadata["build_epoch"])
+	r.Metadata.DatabaseType, _ = metadata["database_type"].(string)
+
+	switch r.Metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: record size %d", ErrMMDBUnsupported, r.Metadata.RecordSize)
+	}
+	if r.Metadata.IPVersion != 4 && r.Metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: ip version %d", ErrMMDBUnsupported, r.Metadata.IPVersion)
+	}
+	r.nodeBytes = r.Metadata.RecordSize / 4
+	treeSize := uint64(r.nodeBytes) * uint64(r.Metadata.NodeCount)
+	if treeSize+mmdbDataSectionSeparatorSize > uint64(searchStart+index) {
+		return nil, fmt.Errorf("%w: search tree size %d exceeds file size", ErrMMDBInvalid, treeSize)
+	}
+	r.tree = buffer[:treeSize]
+	r.data = buffer[treeSize+mmdbDataSectionSeparatorSize : searchStart+index]
+
+	// IPv4 addresses are stored under ::/96 in IPv6 databases
+	if r.Metadata.IPVersion == 6 {
+		node := uint32(0)
+		for i := 0; i < 96 && node < r.Metadata.NodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func (r *MMDBReader) readNode(node, bit uint32) uint32 {
+	b := r.tree[node*r.nodeBytes : (node+1)*r.nodeBytes]
+	switch r.Metadata.RecordSize {
+	case 24:
+		if bit == 0 {
+			return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3])<<16 | uint32(b[4])<<8 | uint32(b[5])
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xF0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0F)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		if bit == 0 {
+			return binary.BigEndian.Uint32(b[:4])
+		}
+		return binary.BigEndian.Uint32(b[4:])
+	}
+}
+
+// LookupOffset returns the data section offset of the record matching ip, ok is false if there is none.
+func (r *MMDBReader) LookupOffset(ip net.IP) (uint32, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) != net.IPv6len {
+		return 0, false
+	} else if r.Metadata.IPVersion == 4 {
+		return 0, false
+	}
+
+	node := uint32(0)
+	if len(ip) == net.IPv4len && r.Metadata.IPVersion == 6 {
+		node = r.ipv4Start
+	}
+	nodeCount := r.Metadata.NodeCount
+	for depth, bits := 0, len(ip)*8; depth < bits && node < nodeCount; depth++ {
+		bit := uint32(ip[depth>>3]>>(7-uint(depth&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	if node <= nodeCount {
+		return 0, false
+	}
+	offset := node - nodeCount - mmdbDataSectionSeparatorSize
+	if offset >= uint32(len(r.data)) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// Decode returns the record at data section offset as generic go values:
+// map[string]interface{}, []interface{}, string, []byte, bool, uint64, int32, float32 or float64
+func (r *MMDBReader) Decode(offset uint32) (interface{}, error) {
+	d := &mmdbDecoder{buffer: r.data}
+	value, _, err := d.decode(offset, 0)
+	return value, err
+}
+
+func (r *MMDBReader) Lookup(ip net.IP) (interface{}, error) {
+	offset, ok := r.LookupOffset(ip)
+	if !ok {
+		return nil, nil
+	}
+	return r.Decode(offset)
+}
+
+const mmdbMaxDecodeDepth = 32
+
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+func (d *mmdbDecoder) decodeCtrl(offset uint32) (int, uint32, uint32, error) {
+	buffer := d.buffer
+	if offset >= uint32(len(buffer)) {
+		return 0, 0, 0, ErrMMDBInvalid
+	}
+	ctrl := buffer[offset]
+	offset++
+	typeNum := int(ctrl >> 5)
+	if typeNum == mmdbTypeExtended {
+		if offset >= uint32(len(buffer)) {
+			return 0, 0, 0, ErrMMDBInvalid
+		}
+		typeNum = 7 + int(buffer[offset])
+		offset++
+	}
+	if typeNum == mmdbTypePointer {
+		size := uint32(ctrl>>3) & 0x3
+		if offset+size+1 > uint32(len(buffer)) {
+			return 0, 0, 0, ErrMMDBInvalid
+		}
+		b := buffer[offset : offset+size+1]
+		var pointer uint32
+		switch size {
+		case 0:
+			pointer = uint32(ctrl&0x7)<<8 | uint32(b[0])
+		case 1:
+			pointer = (uint32(ctrl&0x7)<<16 | uint32(b[0])<<8 | uint32(b[1])) + 2048
+		case 2:
+			pointer = (uint32(ctrl&0x7)<<24 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) + 526336
+		default:
+			pointer = binary.BigEndian.Uint32(b)
+		}
+		return typeNum, pointer, offset + size + 1, nil
+	}
+
+	size := uint32(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint32(len(buffer)) {
+			return 0, 0, 0, ErrMMDBInvalid
+		}
+		b := buffer[offset : offset+n]
+		switch n {
+		case 1:
+			size = 29 + uint32(b[0])
+		case 2:
+			size = 285 + (uint32(b[0])<<8 | uint32(b[1]))
+		default:
+			size = 65821 + (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]))
+		}
+		offset += n
+	}
+	return typeNum, size, offset, nil
+}
+
+// decode returns the value at offset and the offset of the next value
+func (d *mmdbDecoder) decode(offset uint32, depth int) (interface{}, uint32, error) {
+	if depth > mmdbMaxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: exceed max decode depth", ErrMMDBInvalid)
+	}
+	typeNum, size, offset, err := d.decodeCtrl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typeNum == mmdbTypePointer {
+		// a pointer never points to another pointer
+		value, _, err := d.decode(size, depth+1)
+		return value, offset, err
+	}
+
+	switch typeNum {
+	case mmdbTypeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint32(0); i < size; i++ {
+			var key, value interface{}
+			key, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrMMDBInvalid)
+			}
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case mmdbTypeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint32(0); i < size; i++ {
+			var value interface{}
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	case mmdbTypeEndMarker, mmdbTypeContainer:
+		return nil, offset, nil
+	}
+
+	end := offset + size
+	if end > uint32(len(d.buffer)) || end < offset {
+		return nil, 0, ErrMMDBInvalid
+	}
+	b := d.buffer[offset:end]
+	switch typeNum {
+	case mmdbTypeString:
+		return string(b), end, nil
+	case mmdbTypeBytes:
+		return append([]byte(nil), b...), end, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, ErrMMDBInvalid
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, ErrMMDBInvalid
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), end, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, ErrMMDBInvalid
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, end, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, ErrMMDBInvalid
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), end, nil
+	case mmdbTypeUint128:
+		// not used by geo databases, keep the raw big-endian bytes
+		return append([]byte(nil), b...), end, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrMMDBInvalid, typeNum)
+}
+
+func toUint64(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int32:
+		return uint64(n)
+	case float64:
+		return uint64(n)
+	}
+	return 0
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_MMDB_LANGUAGE        = "en"
+	DEFAULT_MMDB_RELOAD_INTERVAL = time.Minute
+
+	mmdbLocationCacheSize = 1 << 16
+)
+
+type MMDBConfig struct {
+	CityFile       string // GeoLite2-City/GeoIP2-City or compatible
+	ASNFile        string // GeoLite2-ASN/GeoIP2-ISP or compatible
+	Language       string
+	ReloadInterval time.Duration // check file changes periodically, 0 means never reload
+}
+
+type mmdbSource struct {
+	path    string
+	modTime time.Time
+	size    int64
+	reader  *MMDBReader
+
+	// many networks share the same data record, cache the decoded location by data offset
+	sync.RWMutex
+	cache map[uint32]*Location
+}
+
+// MMDBProvider looks up locations from MaxMind DB files, the files are reloaded when they are modified.
+type MMDBProvider struct {
+	config MMDBConfig
+	city   atomic.Pointer[mmdbSource]
+	asn    atomic.Pointer[mmdbSource]
+
+	exit chan struct{}
+}
+
+func NewMMDBProvider(config MMDBConfig) (*MMDBProvider, error) {
+	if config.Language == "" {
+		config.Language = DEFAULT_MMDB_LANGUAGE
+	}
+	p := &MMDBProvider{
+		config: config,
+		exit:   make(chan struct{}),
+	}
+	if config.CityFile != "" {
+		s, err := loadMMDBSource(config.CityFile)
+		if err != nil {
+			return nil, err
+		}
+		p.city.Store(s)
+		log.Infof("load geo city mmdb %s, type %s, build at %s", config.CityFile, s.reader.Metadata.DatabaseType, time.Unix(int64(s.reader.Metadata.BuildEpoch), 0))
+	}
+	if config.ASNFile != "" {
+		s, err := loadMMDBSource(config.ASNFile)
+		if err != nil {
+			return nil, err
+		}
+		p.asn.Store(s)
+		log.Infof("load geo asn mmdb %s, type %s, build at %s", config.ASNFile, s.reader.Metadata.DatabaseType, time.Unix(int64(s.reader.Metadata.BuildEpoch), 0))
+	}
+	if config.ReloadInterval > 0 && (config.CityFile != "" || config.ASNFile != "") {
+		go p.run()
+	}
+	return p, nil
+}
+
+func loadMMDBSource(path string) (*mmdbSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := OpenMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdbSource{
+		path:    path,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		reader:  reader,
+		cache:   make(map[uint32]*Location),
+	}, nil
+}
+
+func (p *MMDBProvider) run() {
+	ticker := time.NewTicker(p.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.exit:
+			return
+		case <-ticker.C:
+			p.reload(&p.city)
+			p.reload(&p.asn)
+		}
+	}
+}
+
+func (p *MMDBProvider) reload(current *atomic.Pointer[mmdbSource]) {
+	old := current.Load()
+	if old == nil {
+		return
+	}
+	info, err := os.Stat(old.path)
+	if err != nil {
+		log.Warningf("stat geo mmdb %s failed: %s", old.path, err)
+		return
+	}
+	if info.ModTime().Equal(old.modTime) && info.Size() == old.size {
+		return
+	}
+	s, err := loadMMDBSource(old.path)
+	if err != nil {
+		// keep using the old one, the file may be being written
+		log.Warningf("reload geo mmdb %s failed: %s", old.path, err)
+		return
+	}
+	current.Store(s)
+	log.Infof("reload geo mmdb %s, type %s, build at %s", s.path, s.reader.Metadata.DatabaseType, time.Unix(int64(s.reader.Metadata.BuildEpoch), 0))
+}
+
+func (p *MMDBProvider) Close() {
+	close(p.exit)
+}
+
+func (p *MMDBProvider) Lookup(ip net.IP, loc *Location) bool {
+	found := false
+	if s := p.city.Load(); s != nil {
+		if l := s.lookup(ip, p.config.Language, decodeCityLocation); l != nil {
+			loc.Country, loc.Region, loc.City = l.Country, l.Region, l.City
+			found = true
+		}
+	}
+	if s := p.asn.Load(); s != nil {
+		if l := s.lookup(ip, p.config.Language, decodeASNLocation); l != nil {
+			loc.ASN, loc.ASOrg = l.ASN, l.ASOrg
+			found = true
+		}
+	}
+	return found
+}
+
+func (s *mmdbSource) lookup(ip net.IP, language string, decodeFunc func(map[string]interface{}, string) *Location) *Location {
+	offset, ok := s.reader.LookupOffset(ip)
+	if !ok {
+		return nil
+	}
+	s.RLock()
+	l, ok := s.cache[offset]
+	s.RUnlock()
+	if ok {
+		return l
+	}
+
+	value, err := s.reader.Decode(offset)
+	if err != nil {
+		log.Debugf("decode geo mmdb %s at %d failed: %s", s.path, offset, err)
+		return nil
+	}
+	if record, ok := value.(map[string]interface{}); ok {
+		l = decodeFunc(record, language)
+	}
+	s.Lock()
+	if len(s.cache) >= mmdbLocationCacheSize {
+		s.cache = make(map[uint32]*Location)
+	}
+	s.cache[offset] = l
+	s.Unlock()
+	return l
+}
+
+func decodeCityLocation(record map[string]interface{}, language string) *Location {
+	l := &Location{}
+	if country, ok := record["country"].(map[string]interface{}); ok {
+		l.Country = localizedName(country, language)
+	} else if country, ok := record["registered_country"].(map[string]interface{}); ok {
+		l.Country = localizedName(country, language)
+	}
+	if subdivisions, ok := record["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		if subdivision, ok := subdivisions[0].(map[string]interface{}); ok {
+			l.Region = localizedName(subdivision, language)
+		}
+	}
+	if city, ok := record["city"].(map[string]interface{}); ok {
+		l.City = localizedName(city, language)
+	}
+	return l
+}
+
+func decodeASNLocation(record map[string]interface{}, language string) *Location {
+	l := &Location{}
+	l.ASN = uint32(toUint64(record["autonomous_system_number"]))
+	l.ASOrg, _ = record["autonomous_system_organization"].(string)
+	if l.ASOrg == "" {
+		// GeoIP2-ISP
+		l.ASOrg, _ = record["isp"].(string)
+	}
+	return l
+}
+
+func localizedName(item map[string]interface{}, language string) string {
+	if names, ok := item["names"].(map[string]interface{}); ok {
+		if name, ok := names[language].(string); ok {
+			return name
+		}
+		if name, ok := names[DEFAULT_MMDB_LANGUAGE].(string); ok {
+			return name
+		}
+	}
+	name, _ := item["iso_code"].(string)
+	return name
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// a minimal MaxMind DB writer for tests
+
+func mmdbEncodeCtrl(buf *bytes.Buffer, typeNum int, size int) {
+	var ctrl byte
+	if typeNum <= 7 {
+		ctrl = byte(typeNum) << 5
+	}
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		ctrl |= 31
+		sizeBytes = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+	}
+	buf.WriteByte(ctrl)
+	if typeNum > 7 {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(sizeBytes)
+}
+
+func mmdbEncode(buf *bytes.Buffer, v interface{}) {
+	switch value := v.(type) {
+	case string:
+		mmdbEncodeCtrl(buf, mmdbTypeString, len(value))
+		buf.WriteString(value)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, value)
+		b = bytes.TrimLeft(b, "\x00")
+		mmdbEncodeCtrl(buf, mmdbTypeUint32, len(b))
+		buf.Write(b)
+	case uint64:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, value)
+		b = bytes.TrimLeft(b, "\x00")
+		mmdbEncodeCtrl(buf, mmdbTypeUint64, len(b))
+		buf.Write(b)
+	case []interface{}:
+		mmdbEncodeCtrl(buf, mmdbTypeArray, len(value))
+		for _, item := range value {
+			mmdbEncode(buf, item)
+		}
+	case map[string]interface{}:
+		mmdbEncodeCtrl(buf, mmdbTypeMap, len(value))
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			mmdbEncode(buf, k)
+			mmdbEncode(buf, value[k])
+		}
+	}
+}
+
+type testMMDBNode struct {
+	children [2]*testMMDBNode
+	data     [2]int
+}
+
+func newTestMMDBNode() *testMMDBNode {
+	return &testMMDBNode{data: [2]int{-1, -1}}
+}
+
+type testMMDBNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+func buildTestMMDB(ipVersion, recordSize int, networks []testMMDBNetwork) []byte {
+	data := &bytes.Buffer{}
+	root := newTestMMDBNode()
+	for _, network := range networks {
+		offset := data.Len()
+		mmdbEncode(data, network.record)
+
+		_, ipNet, _ := net.ParseCIDR(network.cidr)
+		ip := ipNet.IP
+		ones, _ := ipNet.Mask.Size()
+		if ipVersion == 6 {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, ones = ip.To16(), ones+96
+				copy(ip[10:12], []byte{0, 0})
+			}
+		}
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				n.data[bit] = offset
+				break
+			}
+			if n.children[bit] == nil {
+				n.children[bit] = newTestMMDBNode()
+			}
+			n = n.children[bit]
+		}
+	}
+
+	nodes := []*testMMDBNode{root}
+	for i := 0; i < len(nodes); i++ {
+		for _, c := range nodes[i].children {
+			if c != nil {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	index := make(map[*testMMDBNode]int)
+	for i, n := range nodes {
+		index[n] = i
+	}
+	nodeCount := len(nodes)
+	tree := &bytes.Buffer{}
+	for _, n := range nodes {
+		var records [2]uint32
+		for bit := 0; bit < 2; bit++ {
+			if n.children[bit] != nil {
+				records[bit] = uint32(index[n.children[bit]])
+			} else if n.data[bit] >= 0 {
+				records[bit] = uint32(nodeCount + mmdbDataSectionSeparatorSize + n.data[bit])
+			} else {
+				records[bit] = uint32(nodeCount)
+			}
+		}
+		l, r := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			tree.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0xf, byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint32(b, l)
+			binary.BigEndian.PutUint32(b[4:], r)
+			tree.Write(b)
+		}
+	}
+
+	file := &bytes.Buffer{}
+	file.Write(tree.Bytes())
+	file.Write(make([]byte, mmdbDataSectionSeparatorSize))
+	file.Write(data.Bytes())
+	file.Write(mmdbMetadataStartMarker)
+	mmdbEncode(file, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint32(recordSize),
+		"ip_version":                  uint32(ipVersion),
+		"database_type":               "Test",
+		"binary_format_major_version": uint32(2),
+		"build_epoch":                 uint64(1700000000),
+	})
+	return file.Bytes()
+}
+
+func testCityRecord(country, region, city string) map[string]interface{} {
+	return map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": country[:2], "names": map[string]interface{}{"en": country}},
+		"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": region, "zh-CN": region + "-zh"}}},
+		"city":         map[string]interface{}{"names": map[string]interface{}{"en": city}},
+	}
+}
+
+var testCityNetworks = []testMMDBNetwork{
+	{"1.2.3.0/24", testCityRecord("Australia", "Queensland", "Brisbane")},
+	{"2001:db8::/32", testCityRecord("Japan", "Tokyo", "Tokyo")},
+	{"2001:db9::/48", testCityRecord("Germany", "Hesse", "Frankfurt")},
+}
+
+func TestMMDBReader(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		r, err := NewMMDBReader(buildTestMMDB(6, recordSize, testCityNetworks))
+		if err != nil {
+			t.Fatalf("record size %d: %s", recordSize, err)
+		}
+		if r.Metadata.IPVersion != 6 || r.Metadata.DatabaseType != "Test" || r.Metadata.BuildEpoch != 1700000000 {
+			t.Errorf("record size %d: unexpected metadata %+v", recordSize, r.Metadata)
+		}
+		cases := map[string]string{
+			"1.2.3.4":         "Brisbane",
+			"2001:db8:1::1":   "Tokyo",
+			"2001:db9:0:ff::": "Frankfurt",
+			"1.2.4.1":         "",
+			"2001:db9:1::1":   "",
+			"::1":             "",
+		}
+		for ip, expected := range cases {
+			value, err := r.Lookup(net.ParseIP(ip))
+			if err != nil {
+				t.Errorf("record size %d: lookup %s failed: %s", recordSize, ip, err)
+				continue
+			}
+			city := ""
+			if value != nil {
+				city = decodeCityLocation(value.(map[string]interface{}), DEFAULT_MMDB_LANGUAGE).City
+			}
+			if city != expected {
+				t.Errorf("record size %d: lookup %s got %q, expected %q", recordSize, ip, city, expected)
+			}
+		}
+	}
+
+	r, err := NewMMDBReader(buildTestMMDB(4, 24, testCityNetworks[:1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.LookupOffset(net.ParseIP("1.2.3.255")); !ok {
+		t.Error("ipv4 database lookup failed")
+	}
+	if _, ok := r.LookupOffset(net.ParseIP("2001:db8::1")); ok {
+		t.Error("ipv6 address should not be found in ipv4 database")
+	}
+
+	if _, err := NewMMDBReader([]byte("not a mmdb file")); err == nil {
+		t.Error("invalid file should fail")
+	}
+}
+
+func TestMMDBProvider(t *testing.T) {
+	dir := t.TempDir()
+	cityFile, asnFile := filepath.Join(dir, "city.mmdb"), filepath.Join(dir, "asn.mmdb")
+	if err := os.WriteFile(cityFile, buildTestMMDB(6, 24, testCityNetworks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	asnNetworks := []testMMDBNetwork{
+		{"1.2.0.0/16", map[string]interface{}{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"}},
+	}
+	if err := os.WriteFile(asnFile, buildTestMMDB(6, 28, asnNetworks), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewMMDBProvider(MMDBConfig{CityFile: cityFile, ASNFile: asnFile, Language: "zh-CN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	loc := Location{}
+	if !p.Lookup(net.ParseIP("1.2.3.4"), &loc) {
+		t.Fatal("1.2.3.4 not found")
+	}
+	expected := Location{Country: "Australia", Region: "Queensland-zh", City: "Brisbane", ASN: 13335, ASOrg: "CLOUDFLARENET"}
+	if loc != expected {
+		t.Errorf("got %+v, expected %+v", loc, expected)
+	}
+	loc = Location{}
+	if !p.Lookup(net.ParseIP("1.2.200.1"), &loc) || loc.ASN != 13335 || loc.City != "" {
+		t.Errorf("1.2.200.1 got %+v", loc)
+	}
+	if p.Lookup(net.ParseIP("10.0.0.1"), &loc) {
+		t.Error("10.0.0.1 should not be found")
+	}
+
+	// hot reload
+	newNetworks := []testMMDBNetwork{{"1.2.3.0/24", testCityRecord("Canada", "Ontario", "Toronto")}}
+	if err := os.WriteFile(cityFile, buildTestMMDB(6, 24, newNetworks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(cityFile, future, future)
+	p.reload(&p.city)
+	loc = Location{}
+	if !p.Lookup(net.ParseIP("1.2.3.4"), &loc) || loc.City != "Toronto" {
+		t.Errorf("after reload got %+v", loc)
+	}
+
+	// a broken file keeps the old database
+	os.WriteFile(cityFile, []byte("broken"), 0644)
+	os.Chtimes(cityFile, future.Add(time.Hour), future.Add(time.Hour))
+	p.reload(&p.city)
+	loc = Location{}
+	if !p.Lookup(net.ParseIP("1.2.3.4"), &loc) || loc.City != "Toronto" {
+		t.Errorf("after broken reload got %+v", loc)
+	}
+}
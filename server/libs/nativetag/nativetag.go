@@ -238,28 +238,37 @@ func UpdateNativeTag(op NativeTagOP, orgId uint16, nativeTag *NativeTag) {
 	log.Infof("after %s orgid %d, table %s, native tag: %+v", op, orgId, tableId.Table(), oldNativeTag)
 }
 
-func CKAddNativeTag(isByConity, ignoreColumnExisted bool, conn *sql.DB, orgId uint16, nativeTag *NativeTag) error {
+// NativeTagDDL is the DDLs to add one column of a native tag
+type NativeTagDDL struct {
+	Database   string
+	Table      string
+	ColumnName string
+	ColumnType string
+	SQLs       []string
+}
+
+// CKAddNativeTagDDLs returns the DDLs which CKAddNativeTag runs for each column of the native tag
+func CKAddNativeTagDDLs(isByConity bool, orgId uint16, nativeTag *NativeTag) ([]*NativeTagDDL, error) {
 	tableId, err := ToNativeTagTable(nativeTag.Db, nativeTag.Table)
 	if err != nil {
-		log.Error(err)
-		return err
+		return nil, err
 	}
 
+	ddls := make([]*NativeTagDDL, 0, len(nativeTag.ColumnNames))
+	database := ckdb.OrgDatabasePrefix(orgId) + tableId.Database()
 	for i, columnName := range nativeTag.ColumnNames {
 		if IndexOf(ckdb.ColumnNames, columnName) > 0 {
-			err := fmt.Errorf("'%s' is a reserved word and is not allowed as a native tag name.", columnName)
-			log.Error(err)
-			return err
+			return nil, fmt.Errorf("'%s' is a reserved word and is not allowed as a native tag name.", columnName)
 		}
 		tableGlobal := fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s",
-			ckdb.OrgDatabasePrefix(orgId)+tableId.Database(), tableId.Table(), columnName, nativeTag.ColumnTypes[i])
+			database, tableId.Table(), columnName, nativeTag.ColumnTypes[i])
 		tableLocal := fmt.Sprintf("ALTER TABLE %s.`%s` ADD COLUMN %s %s",
-			ckdb.OrgDatabasePrefix(orgId)+tableId.Database(), tableId.LocalTable(), columnName, nativeTag.ColumnTypes[i])
+			database, tableId.LocalTable(), columnName, nativeTag.ColumnTypes[i])
 
 		indexGlobal := fmt.Sprintf("ALTER TABLE %s.`%s` ADD INDEX IF NOT EXISTS idx_%s %s TYPE %s GRANULARITY 2",
-			ckdb.OrgDatabasePrefix(orgId)+tableId.Database(), tableId.Table(), columnName, columnName, nativeTag.ColumnTypes[i].IndexString())
+			database, tableId.Table(), columnName, columnName, nativeTag.ColumnTypes[i].IndexString())
 		indexLocal := fmt.Sprintf("ALTER TABLE %s.`%s` ADD INDEX IF NOT EXISTS idx_%s %s TYPE %s GRANULARITY 2",
-			ckdb.OrgDatabasePrefix(orgId)+tableId.Database(), tableId.LocalTable(), columnName, columnName, nativeTag.ColumnTypes[i].IndexString())
+			database, tableId.LocalTable(), columnName, columnName, nativeTag.ColumnTypes[i].IndexString())
 
 		sqls := []string{tableGlobal}
 		if isByConity {
@@ -267,14 +276,32 @@ func CKAddNativeTag(isByConity, ignoreColumnExisted bool, conn *sql.DB, orgId ui
 		} else {
 			sqls = append(sqls, tableLocal, indexLocal)
 		}
+		ddls = append(ddls, &NativeTagDDL{
+			Database:   database,
+			Table:      tableId.Table(),
+			ColumnName: columnName,
+			ColumnType: nativeTag.ColumnTypes[i].String(),
+			SQLs:       sqls,
+		})
+	}
+	return ddls, nil
+}
 
-		for _, sql := range sqls {
+func CKAddNativeTag(isByConity, ignoreColumnExisted bool, conn *sql.DB, orgId uint16, nativeTag *NativeTag) error {
+	ddls, err := CKAddNativeTagDDLs(isByConity, orgId, nativeTag)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, ddl := range ddls {
+		for _, sql := range ddl.SQLs {
 			log.Infof("add native tag: %s", sql)
 			_, err := conn.Exec(sql)
 			if err != nil {
 				// if it has already been added, you need to skip the error
 				if strings.Contains(err.Error(), "column with this name already exists") && ignoreColumnExisted {
-					log.Infof("db: %s, table: %s error: %s", tableId.Database(), tableId.Table(), err)
+					log.Infof("db: %s, table: %s error: %s", ddl.Database, ddl.Table, err)
 					continue
 				}
 				return err
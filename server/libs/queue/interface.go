@@ -17,6 +17,7 @@
 package queue
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/libs/stats"
@@ -32,30 +33,116 @@ type OptionRelease = func(x interface{})
 type OptionStatsOption = stats.Option
 type OptionFlushIndicator = time.Duration // scheduled put nil into queue
 type OptionModule = string
+type OptionLatencyHistogram bool // record the time in queue of the items
 
-type QueueReader interface {
-	Get() interface{}
-	Gets([]interface{}) int
+type OverflowPolicy uint8
+
+const (
+	OVERFLOW_OVERWRITE   OverflowPolicy = iota // overwrite the oldest items, default
+	OVERFLOW_BLOCK                             // wait for the readers, drop the newest items on timeout
+	OVERFLOW_DROP_NEWEST                       // drop the newest items which can not be put
+)
+
+const DEFAULT_BLOCK_TIMEOUT = time.Second
+
+var overflowPolicyNames = [...]string{
+	OVERFLOW_OVERWRITE:   "overwrite",
+	OVERFLOW_BLOCK:       "block",
+	OVERFLOW_DROP_NEWEST: "drop-newest",
+}
+
+func (p OverflowPolicy) String() string {
+	if int(p) < len(overflowPolicyNames) {
+		return overflowPolicyNames[p]
+	}
+	return fmt.Sprintf("unknown(%d)", p)
+}
+
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for p, n := range overflowPolicyNames {
+		if n == name {
+			return OverflowPolicy(p), nil
+		}
+	}
+	return OVERFLOW_OVERWRITE, fmt.Errorf("invalid overflow policy '%s', support: overwrite, block, drop-newest", name)
+}
+
+// OptionOverflow sets the overflow policy, BlockTimeout is only used by OVERFLOW_BLOCK
+// and defaults to DEFAULT_BLOCK_TIMEOUT
+type OptionOverflow struct {
+	Policy       OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+type TypedQueueReader[T any] interface {
+	Get() T
+	Gets([]T) int
 	Len() int
 	Close() error
 }
 
-type QueueWriter interface {
-	Put(...interface{}) error
+type TypedQueueWriter[T any] interface {
+	Put(...T) error
 	Len() int
 	Close() error
 }
 
-type MultiQueueReader interface {
-	Get(HashKey) interface{}
-	Gets(HashKey, []interface{}) int
+type QueueReader = TypedQueueReader[interface{}]
+type QueueWriter = TypedQueueWriter[interface{}]
+
+type TypedMultiQueueReader[T any] interface {
+	Get(HashKey) T
+	Gets(HashKey, []T) int
 	Len(HashKey) int
 	Close() error
 }
 
-type MultiQueueWriter interface {
-	Put(HashKey, ...interface{}) error
-	Puts([]HashKey, []interface{}) error
+type TypedMultiQueueWriter[T any] interface {
+	Put(HashKey, ...T) error
+	Puts([]HashKey, []T) error
 	Len(HashKey) int
 	Close() error
 }
+
+type MultiQueueReader = TypedMultiQueueReader[interface{}]
+type MultiQueueWriter = TypedMultiQueueWriter[interface{}]
+
+// Progress reports how far the reader of a queue has processed the items
+type Progress interface {
+	Written() uint64
+	Processed() uint64
+	Lost() uint64
+}
+
+type MultiQueueProgress interface {
+	Progress(HashKey) Progress
+}
+
+// Position marks the items put into a queue before it is taken, they are processed when Processed()
+// of the queue reaches Written, and may be lost if Lost() of the queue changes before that.
+type Position struct {
+	Queue   Progress
+	Written uint64
+	Lost    uint64
+}
+
+// PutWithPosition puts the items into the queue of key, and returns the position of them if the queue reports progress
+func PutWithPosition[T any](q TypedMultiQueueWriter[T], key HashKey, items ...T) (*Position, error) {
+	mp, ok := q.(MultiQueueProgress)
+	if !ok {
+		return nil, q.Put(key, items...)
+	}
+	progress := mp.Progress(key)
+	// load lost before putting, so that the items lost right after putting are not missed
+	lost := progress.Lost()
+	err := q.Put(key, items...)
+	return &Position{Queue: progress, Written: progress.Written(), Lost: lost}, err
+}
+
+func (p *Position) Processed() bool {
+	return p.Queue.Processed() >= p.Written
+}
+
+func (p *Position) MayBeLost() bool {
+	return p.Queue.Lost() != p.Lost
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package queue
+
+import (
+	"time"
+
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+// upper bounds of the buckets of the time in queue
+var latencyBounds = [...]int64{
+	int64(100 * time.Microsecond),
+	int64(time.Millisecond),
+	int64(10 * time.Millisecond),
+	int64(100 * time.Millisecond),
+	int64(time.Second),
+}
+
+// LatencyCounter is the histogram of the time in queue, the buckets are cumulative
+type LatencyCounter struct {
+	Le100us uint64 `statsd:"le-100us,count"`
+	Le1ms   uint64 `statsd:"le-1ms,count"`
+	Le10ms  uint64 `statsd:"le-10ms,count"`
+	Le100ms uint64 `statsd:"le-100ms,count"`
+	Le1s    uint64 `statsd:"le-1s,count"`
+	LeInf   uint64 `statsd:"le-inf,count"`
+	SumUs   uint64 `statsd:"sum-us,count"`
+	MaxUs   uint64 `statsd:"max-us,gauge"`
+}
+
+type latencyBuckets struct {
+	counts [len(latencyBounds) + 1]uint64
+	sum    int64
+	max    int64
+}
+
+// latencyHistogram is updated by the readers with the queue locked
+type latencyHistogram struct {
+	buckets *latencyBuckets
+	closed  *utils.Closable // closed with the queue
+}
+
+func newLatencyHistogram(closed *utils.Closable) *latencyHistogram {
+	return &latencyHistogram{buckets: &latencyBuckets{}, closed: closed}
+}
+
+func (h *latencyHistogram) observe(latency int64) {
+	b := h.buckets
+	i := 0
+	for i < len(latencyBounds) && latency > latencyBounds[i] {
+		i++
+	}
+	b.counts[i]++
+	b.sum += latency
+	if latency > b.max {
+		b.max = latency
+	}
+}
+
+func (h *latencyHistogram) GetCounter() interface{} {
+	var b *latencyBuckets
+	b, h.buckets = h.buckets, &latencyBuckets{}
+	var cumulative [len(b.counts)]uint64
+	total := uint64(0)
+	for i, count := range b.counts {
+		total += count
+		cumulative[i] = total
+	}
+	return &LatencyCounter{
+		Le100us: cumulative[0],
+		Le1ms:   cumulative[1],
+		Le10ms:  cumulative[2],
+		Le100ms: cumulative[3],
+		Le1s:    cumulative[4],
+		LeInf:   cumulative[5],
+		SumUs:   uint64(b.sum / int64(time.Microsecond)),
+		MaxUs:   uint64(b.max / int64(time.Microsecond)),
+	}
+}
+
+func (h *latencyHistogram) Closed() bool {
+	return h.closed.Closed()
+}
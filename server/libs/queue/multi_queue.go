@@ -27,33 +27,39 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/stats"
 )
 
-type FixedMultiQueue []*OverwriteQueue
+type TypedMultiQueue[T any] []*TypedOverwriteQueue[T]
 
-func (q FixedMultiQueue) entry(key HashKey) *OverwriteQueue {
+type FixedMultiQueue = TypedMultiQueue[interface{}]
+
+func (q TypedMultiQueue[T]) entry(key HashKey) *TypedOverwriteQueue[T] {
 	return q[key&(uint8(len(q)-1))]
 }
 
-func (q FixedMultiQueue) Get(key HashKey) interface{} {
+func (q TypedMultiQueue[T]) Get(key HashKey) T {
 	return q.entry(key).Get()
 }
 
-func (q FixedMultiQueue) Gets(key HashKey, output []interface{}) int {
+func (q TypedMultiQueue[T]) Gets(key HashKey, output []T) int {
 	return q.entry(key).Gets(output)
 }
 
-func (q FixedMultiQueue) Put(key HashKey, items ...interface{}) error {
+func (q TypedMultiQueue[T]) Put(key HashKey, items ...T) error {
 	return q.entry(key).Put(items...)
 }
 
-func (q FixedMultiQueue) Puts(keys []HashKey, items []interface{}) error {
+func (q TypedMultiQueue[T]) Puts(keys []HashKey, items []T) error {
 	return errors.New("Not implemented")
 }
 
-func (q FixedMultiQueue) Len(key HashKey) int {
+func (q TypedMultiQueue[T]) Len(key HashKey) int {
 	return q.entry(key).Len()
 }
 
-func (q FixedMultiQueue) Close() error {
+func (q TypedMultiQueue[T]) Progress(key HashKey) Progress {
+	return q.entry(key)
+}
+
+func (q TypedMultiQueue[T]) Close() error {
 	for _, e := range q {
 		e.Close()
 	}
@@ -63,15 +69,19 @@ func (q FixedMultiQueue) Close() error {
 // count和queueSize要求是2的幂以避免求余计算，如果不是2的幂将会隐式转换为2的幂来构造
 // HashKey要求映射到count范围内，否则MultiQueue只会取低比特位
 func NewOverwriteQueues(module string, count uint8, queueSize int, options ...Option) FixedMultiQueue {
+	return NewTypedOverwriteQueues[interface{}](module, count, queueSize, options...)
+}
+
+func NewTypedOverwriteQueues[T any](module string, count uint8, queueSize int, options ...Option) TypedMultiQueue[T] {
 	if count > MAX_QUEUE_COUNT {
 		panic(fmt.Sprintf("queueCount超出最大限制%d", MAX_QUEUE_COUNT))
 	}
 
 	size := int(count)
-	queues := make([]*OverwriteQueue, size)
+	queues := make([]*TypedOverwriteQueue[T], size)
 	for i := 0; i < size; i++ {
 		opts := append(options, stats.OptionStatTags{"index": strconv.Itoa(i)})
-		queue := new(OverwriteQueue)
+		queue := new(TypedOverwriteQueue[T])
 		queue.Init(module, queueSize, opts...)
 		queues[i] = queue
 	}
@@ -79,7 +89,7 @@ func NewOverwriteQueues(module string, count uint8, queueSize int, options ...Op
 	for tableSize < size {
 		tableSize <<= 1
 	}
-	table := make(FixedMultiQueue, tableSize)
+	table := make(TypedMultiQueue[T], tableSize)
 	for i := 0; i < tableSize; i++ {
 		table[i] = queues[i%size]
 	}
@@ -24,70 +24,110 @@ package queue
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
 )
 
-var OverflowError = errors.New("Requested size is larger than capacity")
+var (
+	OverflowError  = errors.New("Requested size is larger than capacity")
+	QueueFullError = errors.New("Queue is full, the newest items are dropped")
+)
 
 type Counter struct {
 	In          uint64 `statsd:"in,count"`
 	Out         uint64 `statsd:"out,count"`
 	Overwritten uint64 `statsd:"overwritten,count"`
+	Dropped     uint64 `statsd:"dropped,count"` // dropped by OVERFLOW_BLOCK or OVERFLOW_DROP_NEWEST
+	Blocked     uint64 `statsd:"blocked,count"` // times of the writer waiting for space
 	Pending     uint64 `statsd:"pending,gauge"`
 }
 
-type OverwriteQueue struct {
+// TypedOverwriteQueue is the queue of items of type T, the overflow policy is
+// OVERFLOW_OVERWRITE unless OptionOverflow is set
+type TypedOverwriteQueue[T any] struct {
 	utils.Closable
 	sync.Mutex
 
 	writeLock     sync.Mutex
 	readerWaiting int
 	reader        sync.WaitGroup
-	items         []interface{}
+	items         []T
 	size          uint // power of 2
 	writeCursor   uint
 	pending       uint
-	release       func(x interface{})
+	release       func(x T)
+	isNil         func(x T) bool
+
+	overflow     OptionOverflow
+	spaceWaiting bool
+	spaceReady   chan struct{} // closed when the readers get items and spaceWaiting is set
+
+	enqueueTimes []int64 // nanoseconds, only used by OptionLatencyHistogram
+	latency      *latencyHistogram
+
+	// the cumulative counts of Progress, accessed atomically
+	written   uint64
+	processed uint64
+	lost      uint64
 
 	counter *Counter
 }
 
-const MAX_BATCH_GET_SIZE = 1 << 16
+// OverwriteQueue is the queue of untyped items
+type OverwriteQueue = TypedOverwriteQueue[interface{}]
 
-var nilArrayForInit [MAX_BATCH_GET_SIZE]interface{}
+const MAX_BATCH_GET_SIZE = 1 << 16
 
 func NewOverwriteQueue(name string, size int, options ...Option) *OverwriteQueue {
-	queue := &OverwriteQueue{}
+	return NewTypedOverwriteQueue[interface{}](name, size, options...)
+}
+
+// NewTypedOverwriteQueue accepts func(T) as the release option besides OptionRelease,
+// the flush indicator puts nil into the queue, which requires T to be a pointer or an interface
+func NewTypedOverwriteQueue[T any](name string, size int, options ...Option) *TypedOverwriteQueue[T] {
+	queue := &TypedOverwriteQueue[T]{}
 	queue.Init(name, size, options...)
 	return queue
 }
 
-func (q *OverwriteQueue) Init(name string, size int, options ...Option) {
+func (q *TypedOverwriteQueue[T]) Init(name string, size int, options ...Option) {
 	if q.size != 0 {
 		return
 	}
 
 	var flushIndicator time.Duration
+	var latencyEnabled bool
 	statOptions := []stats.Option{stats.OptionStatTags{"module": name}}
 	var module string
 	for _, option := range options {
-		switch option.(type) {
+		switch o := option.(type) {
+		case func(T):
+			q.release = o
 		case OptionRelease:
-			q.release = option.(OptionRelease)
+			q.release = func(x T) { o(x) }
 		case OptionFlushIndicator:
-			flushIndicator = option.(OptionFlushIndicator)
+			flushIndicator = o
 		case OptionModule:
-			module = option.(OptionModule)
+			module = o
+		case OptionOverflow:
+			q.overflow = o
+		case OptionLatencyHistogram:
+			latencyEnabled = bool(o)
 		case OptionStatsOption: // XXX: interface{}类型，必须放在最后
-			statOptions = append(statOptions, option.(OptionStatsOption))
+			statOptions = append(statOptions, o)
 		default:
 			panic(fmt.Sprintf("Unknown option %v", option))
 		}
 	}
+	if q.overflow.Policy == OVERFLOW_BLOCK && q.overflow.BlockTimeout <= 0 {
+		q.overflow.BlockTimeout = DEFAULT_BLOCK_TIMEOUT
+	}
 
 	for i := 0; i < 32; i++ {
 		if 1<<uint(i) >= size {
@@ -95,15 +135,27 @@ func (q *OverwriteQueue) Init(name string, size int, options ...Option) {
 			break
 		}
 	}
-	q.items = make([]interface{}, size)
+	q.items = make([]T, size)
 	q.size = uint(size)
+	q.isNil = nilChecker[T]()
+	if flushIndicator > 0 && q.isNil == nil {
+		// the zero values of other types can not be told from the items
+		panic(fmt.Sprintf("queue %s: flush indicator requires the items to be pointers or interfaces, not %s", name, reflect.TypeFor[T]()))
+	}
+	q.spaceReady = make(chan struct{})
 	q.counter = &Counter{}
 	stats.RegisterCountableWithModulePrefix(module, "queue", q, statOptions...)
+	if latencyEnabled {
+		q.enqueueTimes = make([]int64, size)
+		q.latency = newLatencyHistogram(&q.Closable)
+		stats.RegisterCountableWithModulePrefix(module, "queue_latency", q.latency, statOptions...)
+	}
 
 	if flushIndicator > 0 {
 		go func() {
+			var flush T
 			for range time.NewTicker(flushIndicator).C {
-				q.Put(nil)
+				q.Put(flush)
 				if q.Closed() {
 					break
 				}
@@ -112,31 +164,96 @@ func (q *OverwriteQueue) Init(name string, size int, options ...Option) {
 	}
 }
 
-func (q *OverwriteQueue) GetCounter() interface{} {
+func (q *TypedOverwriteQueue[T]) GetCounter() interface{} {
 	var counter *Counter
 	counter, q.counter = q.counter, &Counter{}
 	return counter
 }
 
-func (q *OverwriteQueue) firstIndex() uint {
+func (q *TypedOverwriteQueue[T]) firstIndex() uint {
 	return (q.writeCursor + q.size - q.pending) & (q.size - 1)
 }
 
 // 获取队列等待处理的元素数量
-func (q *OverwriteQueue) Len() int {
+func (q *TypedOverwriteQueue[T]) Len() int {
 	return int(q.pending)
 }
 
-func (q *OverwriteQueue) releaseOverwritten(overwritten []interface{}) {
-	for _, toRelease := range overwritten {
-		if toRelease != nil { // when flush indicator enabled
+// nilChecker returns the check of the flush indicators, which are the nil pointers or interfaces,
+// or nil if T is of other kinds. The kind of T is only inspected once when the queue is created.
+func nilChecker[T any]() func(x T) bool {
+	switch reflect.TypeFor[T]().Kind() {
+	case reflect.Interface:
+		return func(x T) bool { return any(x) == nil }
+	case reflect.Pointer:
+		return func(x T) bool { return *(*unsafe.Pointer)(unsafe.Pointer(&x)) == nil }
+	}
+	return nil
+}
+
+func (q *TypedOverwriteQueue[T]) releaseItems(items []T) {
+	for _, toRelease := range items {
+		if q.isNil == nil || !q.isNil(toRelease) { // when flush indicator enabled
 			q.release(toRelease)
 		}
 	}
 }
 
+// reserve waits or drops the newest items by the overflow policy with writeLock held,
+// and returns the items which can be put without overwriting
+func (q *TypedOverwriteQueue[T]) reserve(items []T) ([]T, error) {
+	q.Lock()
+	freeSize := q.size - q.pending
+	if uint(len(items)) <= freeSize {
+		q.Unlock()
+		return items, nil
+	}
+	if q.overflow.Policy == OVERFLOW_BLOCK {
+		// other writers are blocked by writeLock as well
+		q.counter.Blocked++
+		timer := time.NewTimer(q.overflow.BlockTimeout)
+		defer timer.Stop()
+	WAIT:
+		for uint(len(items)) > freeSize {
+			q.spaceWaiting = true
+			spaceReady := q.spaceReady
+			q.Unlock()
+			select {
+			case <-spaceReady:
+				q.Lock()
+				freeSize = q.size - q.pending
+			case <-timer.C:
+				q.Lock()
+				freeSize = q.size - q.pending
+				break WAIT
+			}
+		}
+	}
+	if uint(len(items)) <= freeSize {
+		q.Unlock()
+		return items, nil
+	}
+	dropped := items[freeSize:]
+	q.counter.Dropped += uint64(len(dropped))
+	q.Unlock()
+	atomic.AddUint64(&q.lost, uint64(len(dropped)))
+	if q.release != nil {
+		q.releaseItems(dropped)
+	}
+	return items[:freeSize], QueueFullError
+}
+
+// notifyWriters is called with the lock held after the items are got
+func (q *TypedOverwriteQueue[T]) notifyWriters() {
+	if q.spaceWaiting {
+		q.spaceWaiting = false
+		close(q.spaceReady)
+		q.spaceReady = make(chan struct{})
+	}
+}
+
 // 放置单个/多个元素，注意不要超过Size、不能放置空列表
-func (q *OverwriteQueue) Put(items ...interface{}) error {
+func (q *TypedOverwriteQueue[T]) Put(items ...T) error {
 	itemSize := uint(len(items))
 	if itemSize > q.size {
 		return OverflowError
@@ -144,6 +261,17 @@ func (q *OverwriteQueue) Put(items ...interface{}) error {
 
 	q.writeLock.Lock()
 
+	var err error
+	if q.overflow.Policy != OVERFLOW_OVERWRITE {
+		// q.pending只会被读者减少，reserve之后的空间是足够的
+		items, err = q.reserve(items)
+		itemSize = uint(len(items))
+		if itemSize == 0 {
+			q.writeLock.Unlock()
+			return err
+		}
+	}
+
 	freeSize := q.size - q.pending
 	locked := false
 	// q.pending的增长由writeLock保护，q.pending的减少虽然非线程安全，
@@ -158,10 +286,10 @@ func (q *OverwriteQueue) Put(items ...interface{}) error {
 				releaseTo = releaseTo & (q.size - 1)
 			}
 			if releaseFrom <= releaseTo {
-				q.releaseOverwritten(q.items[releaseFrom:releaseTo])
+				q.releaseItems(q.items[releaseFrom:releaseTo])
 			} else {
-				q.releaseOverwritten(q.items[releaseFrom:q.size])
-				q.releaseOverwritten(q.items[:releaseTo])
+				q.releaseItems(q.items[releaseFrom:q.size])
+				q.releaseItems(q.items[:releaseTo])
 			}
 		}
 	}
@@ -169,15 +297,23 @@ func (q *OverwriteQueue) Put(items ...interface{}) error {
 	if copied := copy(q.items[q.writeCursor:], items); uint(copied) != itemSize {
 		copy(q.items, items[copied:])
 	}
+	if q.enqueueTimes != nil {
+		now := time.Now().UnixNano()
+		for i := uint(0); i < itemSize; i++ {
+			q.enqueueTimes[(q.writeCursor+i)&(q.size-1)] = now
+		}
+	}
 
 	q.counter.In += uint64(itemSize)
 	if itemSize > freeSize {
 		q.counter.Overwritten += uint64(itemSize - freeSize)
+		atomic.AddUint64(&q.lost, uint64(itemSize-freeSize))
 	}
 
 	if !locked {
 		q.Lock()
 	}
+	atomic.AddUint64(&q.written, uint64(itemSize))
 	q.pending = utils.UintMin(q.pending+itemSize, q.size)
 	q.writeCursor = (q.writeCursor + itemSize) & (q.size - 1)
 	if q.readerWaiting > 0 {
@@ -193,21 +329,48 @@ func (q *OverwriteQueue) Put(items ...interface{}) error {
 	}
 
 	q.writeLock.Unlock()
-	return nil
+	return err
+}
+
+// updateProcessed is called with the lock held when the reader comes back, the items got before have been processed
+func (q *TypedOverwriteQueue[T]) updateProcessed() {
+	atomic.StoreUint64(&q.processed, atomic.LoadUint64(&q.written)-uint64(q.pending))
 }
 
-func (q *OverwriteQueue) get() interface{} {
+// Written returns the count of items put into the queue
+func (q *TypedOverwriteQueue[T]) Written() uint64 {
+	return atomic.LoadUint64(&q.written)
+}
+
+// Processed returns the count of items which are overwritten, or got by the reader which has called
+// Get/Gets again after them. It is only meaningful when the queue has a single reader.
+func (q *TypedOverwriteQueue[T]) Processed() uint64 {
+	return atomic.LoadUint64(&q.processed)
+}
+
+// Lost returns the count of items which are overwritten or dropped by the overflow policy
+func (q *TypedOverwriteQueue[T]) Lost() uint64 {
+	return atomic.LoadUint64(&q.lost)
+}
+
+func (q *TypedOverwriteQueue[T]) get() T {
+	var zero T
 	first := q.firstIndex()
 	item := q.items[first]
-	q.items[first] = nil
+	q.items[first] = zero
+	if q.latency != nil {
+		q.latency.observe(time.Now().UnixNano() - q.enqueueTimes[first])
+	}
 	q.pending--
 	q.counter.Out++
+	q.notifyWriters()
 	return item
 }
 
 // 获取单个队列中的元素。当队列为空时将会阻塞等待
-func (q *OverwriteQueue) Get() interface{} { // will block
+func (q *TypedOverwriteQueue[T]) Get() T { // will block
 	q.Lock()
+	q.updateProcessed()
 	if q.pending == 0 {
 		q.reader.Add(1)
 		q.readerWaiting++
@@ -223,28 +386,43 @@ func (q *OverwriteQueue) Get() interface{} { // will block
 	return item
 }
 
-func (q *OverwriteQueue) gets(output []interface{}) int {
+func (q *TypedOverwriteQueue[T]) observeLatency(from, to uint) {
+	now := time.Now().UnixNano()
+	for _, t := range q.enqueueTimes[from:to] {
+		q.latency.observe(now - t)
+	}
+}
+
+func (q *TypedOverwriteQueue[T]) gets(output []T) int {
 	size := utils.UintMin(uint(len(output)), q.pending)
 	output = output[:size]
 	first := q.firstIndex()
 	copied := copy(output, q.items[first:])
-	copy(q.items[first:], nilArrayForInit[:copied])
+	clear(q.items[first : first+uint(copied)])
+	if q.latency != nil {
+		q.observeLatency(first, first+uint(copied))
+	}
 	if uint(copied) != size {
 		copied = copy(output[copied:], q.items)
-		copy(q.items, nilArrayForInit[:copied])
+		clear(q.items[:copied])
+		if q.latency != nil {
+			q.observeLatency(0, uint(copied))
+		}
 	}
 	q.pending -= size
 	q.counter.Out += uint64(size)
+	q.notifyWriters()
 	return int(size)
 }
 
 // 获取多个队列中的元素，传入的slice会被覆盖写入，队列为空时阻塞等待
 // 写入的数量是slice的length而不是capacity
-func (q *OverwriteQueue) Gets(output []interface{}) int { // will block
+func (q *TypedOverwriteQueue[T]) Gets(output []T) int { // will block
 	if len(output) > MAX_BATCH_GET_SIZE {
 		panic("一次获取的数量太多")
 	}
 	q.Lock()
+	q.updateProcessed()
 	if q.pending == 0 {
 		q.reader.Add(1)
 		q.readerWaiting++
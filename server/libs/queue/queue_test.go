@@ -223,3 +223,198 @@ func BenchmarkQueueGets(b *testing.B) {
 	for i := 0; i < b.N; i += int(queue.Gets(buffer)) {
 	}
 }
+
+type testItem struct {
+	id int
+}
+
+func TestTypedQueue(t *testing.T) {
+	released := []int{}
+	queue := NewTypedOverwriteQueue[*testItem]("whatever", 2, func(x *testItem) { released = append(released, x.id) })
+	queue.Put(&testItem{1}, &testItem{2})
+	queue.Put(&testItem{3})
+	if item := queue.Get(); item.id != 2 {
+		t.Errorf("Expected 2, actually %d", item.id)
+	}
+	if len(released) != 1 || released[0] != 1 {
+		t.Errorf("Expected [1] released, actually %v", released)
+	}
+	buffer := make([]*testItem, 2)
+	queue.Put(nil) // flush indicator is not released
+	queue.Put(&testItem{4})
+	if size := queue.Gets(buffer); size != 2 || buffer[0] != nil || buffer[1].id != 4 {
+		t.Errorf("Expected [nil, 4], actually %v", buffer)
+	}
+	if len(released) != 2 || released[1] != 3 {
+		t.Errorf("Expected [1 3] released, actually %v", released)
+	}
+}
+
+func TestNilChecker(t *testing.T) {
+	if isNil := nilChecker[*testItem](); !isNil(nil) || isNil(&testItem{}) {
+		t.Error("wrong nil check of pointer")
+	}
+	if isNil := nilChecker[interface{}](); !isNil(nil) || isNil(0) {
+		t.Error("wrong nil check of interface")
+	}
+	if nilChecker[[]byte]() != nil || nilChecker[testItem]() != nil {
+		t.Error("nil check of slice or struct")
+	}
+
+	// the flush indicator of non-pointer items can not be told from the zero values
+	defer func() {
+		if recover() == nil {
+			t.Error("flush indicator of struct items should panic")
+		}
+	}()
+	NewTypedOverwriteQueue[testItem]("whatever", 4, OptionFlushIndicator(time.Second))
+}
+
+func TestDropNewest(t *testing.T) {
+	released := []int{}
+	queue := NewTypedOverwriteQueue[int]("whatever", 4, func(x int) { released = append(released, x) },
+		OptionOverflow{Policy: OVERFLOW_DROP_NEWEST})
+	queue.Put(1, 2, 3)
+	if err := queue.Put(4, 5, 6); err != QueueFullError {
+		t.Errorf("Expected QueueFullError, actually %v", err)
+	}
+	buffer := make([]int, 4)
+	if size := queue.Gets(buffer); size != 4 || buffer[0] != 1 || buffer[3] != 4 {
+		t.Errorf("Expected [1 2 3 4], actually %v", buffer[:size])
+	}
+	if len(released) != 2 || released[0] != 5 || released[1] != 6 {
+		t.Errorf("Expected [5 6] released, actually %v", released)
+	}
+	if counter := queue.GetCounter().(*Counter); counter.Dropped != 2 || counter.Overwritten != 0 {
+		t.Errorf("Unexpected counter %+v", counter)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	queue := NewOverwriteQueue("whatever", 4)
+	position, _ := PutWithPosition(FixedMultiQueue{queue}, 0, 1, 2, 3)
+	buffer := make([]interface{}, 2)
+	queue.Gets(buffer)
+	if position.Processed() || queue.Processed() != 0 {
+		t.Errorf("Expected not processed before the reader comes back, actually %d", queue.Processed())
+	}
+	queue.Gets(buffer)
+	if position.Processed() || queue.Processed() != 2 {
+		t.Errorf("Expected 2 processed, actually %d", queue.Processed())
+	}
+	queue.Put(4, 5, 6)
+	queue.Put(7, 8)
+	if !position.MayBeLost() || queue.Lost() != 1 {
+		t.Errorf("Expected 1 lost, actually %d", queue.Lost())
+	}
+	queue.Gets(buffer)
+	if !position.Processed() || queue.Written() != 8 || queue.Processed() != 4 {
+		t.Errorf("Expected 4 processed, actually %d", queue.Processed())
+	}
+}
+
+func TestBlock(t *testing.T) {
+	queue := NewTypedOverwriteQueue[int]("whatever", 2, OptionOverflow{Policy: OVERFLOW_BLOCK, BlockTimeout: 10 * time.Second})
+	queue.Put(1, 2)
+	done := make(chan error)
+	go func() {
+		done <- queue.Put(3)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Put should be blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if item := queue.Get(); item != 1 {
+		t.Errorf("Expected 1, actually %d", item)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected nil, actually %v", err)
+	}
+	if item := queue.Get(); item != 2 {
+		t.Errorf("Expected 2, actually %d", item)
+	}
+	if item := queue.Get(); item != 3 {
+		t.Errorf("Expected 3, actually %d", item)
+	}
+
+	queue = NewTypedOverwriteQueue[int]("whatever", 2, OptionOverflow{Policy: OVERFLOW_BLOCK, BlockTimeout: time.Millisecond})
+	queue.Put(1, 2)
+	if err := queue.Put(3); err != QueueFullError {
+		t.Errorf("Expected QueueFullError, actually %v", err)
+	}
+	if counter := queue.GetCounter().(*Counter); counter.Blocked != 1 || counter.Dropped != 1 {
+		t.Errorf("Unexpected counter %+v", counter)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	queue := NewTypedOverwriteQueue[int]("whatever", 4, OptionLatencyHistogram(true))
+	queue.Put(1, 2, 3)
+	time.Sleep(2 * time.Millisecond)
+	queue.Get()
+	queue.Gets(make([]int, 2))
+	counter := queue.latency.GetCounter().(*LatencyCounter)
+	if counter.LeInf != 3 || counter.Le1ms != 0 || counter.MaxUs < 2000 || counter.SumUs < 6000 {
+		t.Errorf("Unexpected latency counter %+v", counter)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{OVERFLOW_OVERWRITE, OVERFLOW_BLOCK, OVERFLOW_DROP_NEWEST} {
+		if parsed, err := ParseOverflowPolicy(p.String()); err != nil || parsed != p {
+			t.Errorf("Expected %s, actually %s %v", p, parsed, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("unknown"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+// the typed queue avoids boxing the items into interface{} and the type assertions of the readers
+func BenchmarkQueuePutGetsUntyped(b *testing.B) {
+	queue := NewOverwriteQueue("whatever", 1024)
+	buffer := make([]interface{}, 16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	sum := 0
+	for i := 0; i < b.N; i += 16 {
+		for j := 0; j < 16; j++ {
+			queue.Put(testItem{i + j})
+		}
+		n := queue.Gets(buffer)
+		for _, item := range buffer[:n] {
+			sum += item.(testItem).id
+		}
+	}
+}
+
+func BenchmarkQueuePutGetsTyped(b *testing.B) {
+	queue := NewTypedOverwriteQueue[testItem]("whatever", 1024)
+	buffer := make([]testItem, 16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	sum := 0
+	for i := 0; i < b.N; i += 16 {
+		for j := 0; j < 16; j++ {
+			queue.Put(testItem{i + j})
+		}
+		n := queue.Gets(buffer)
+		for _, item := range buffer[:n] {
+			sum += item.id
+		}
+	}
+}
+
+func BenchmarkQueuePutGetsTypedLatency(b *testing.B) {
+	queue := NewTypedOverwriteQueue[testItem]("whatever", 1024, OptionLatencyHistogram(true))
+	buffer := make([]testItem, 16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 16 {
+		for j := 0; j < 16; j++ {
+			queue.Put(testItem{i + j})
+		}
+		queue.Gets(buffer)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/libs/debug"
+)
+
+const (
+	CMD_QUOTA_SHOW uint16 = iota
+)
+
+// CmdHelpers is in the order of the CMD_QUOTA_* operations, the quotas are changed by the
+// config or the controller API '/v1/ingester-quotas/'
+var CmdHelpers = []debug.CmdHelper{
+	{Cmd: "show [org-id]", Helper: "show the quotas and their usage"},
+}
+
+func (m *Manager) HandleSimpleCommand(operate uint16, arg string) string {
+	switch operate {
+	case CMD_QUOTA_SHOW:
+		orgId := -1
+		if arg != "" {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Sprintf("invalid org id '%s'", arg)
+			}
+			orgId = id
+		}
+		return m.show(orgId)
+	}
+	return "unknown command"
+}
+
+func (m *Manager) show(orgId int) string {
+	var sb strings.Builder
+	now := time.Now()
+	fmt.Fprintf(&sb, "%-6s %-6s %-8s %-20s %-20s %s\n", "OrgId", "TeamId", "Action", "Messages/s(Tokens)", "Bytes/s(Tokens)", "RowsToday/RowsPerDay")
+	for _, q := range m.all() {
+		q.Lock()
+		if orgId >= 0 && int(q.limit.OrgId) != orgId {
+			q.Unlock()
+			continue
+		}
+		q.refill(now)
+		q.resetDay(now)
+		rows := []string{}
+		for i := range q.rows {
+			if q.limit.RowsPerDay[i] > 0 || q.rows[i] > 0 {
+				rows = append(rows, fmt.Sprintf("%s:%d/%d", Datasource(i), q.rows[i], q.limit.RowsPerDay[i]))
+			}
+		}
+		fmt.Fprintf(&sb, "%-6d %-6d %-8s %-20s %-20s %s\n", q.limit.OrgId, q.limit.TeamId, q.limit.Action,
+			fmt.Sprintf("%d(%.0f)", q.limit.MessagesPerSecond, q.messages.tokens),
+			fmt.Sprintf("%d(%.0f)", q.limit.BytesPerSecond, q.bytes.tokens),
+			strings.Join(rows, " "))
+		q.Unlock()
+	}
+	return sb.String()
+}
@@ -0,0 +1,740 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("quota")
+
+const (
+	// a throttled message waits at most MAX_THROTTLE_WAIT, otherwise it is dropped
+	MAX_THROTTLE_WAIT = 10 * time.Second
+
+	MAX_ORG_COUNT = ckdb.MAX_ORG_ID + 1
+)
+
+type Action uint8
+
+const (
+	ACTION_THROTTLE Action = iota
+	ACTION_DROP
+)
+
+var actionNames = []string{
+	ACTION_THROTTLE: "throttle",
+	ACTION_DROP:     "drop",
+}
+
+func (a Action) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return "unknown"
+}
+
+func ParseAction(s string) (Action, error) {
+	for i, name := range actionNames {
+		if s == name {
+			return Action(i), nil
+		}
+	}
+	return ACTION_THROTTLE, fmt.Errorf("invalid action '%s', should be one of %v", s, actionNames)
+}
+
+// Datasource is the data whose rows are limited per day by the decoders
+type Datasource uint8
+
+const (
+	FLOW_LOG Datasource = iota
+	FLOW_METRICS
+	APPLICATION_LOG
+	EXT_METRICS
+	PROMETHEUS
+
+	DATASOURCE_MAX
+)
+
+var datasourceNames = [DATASOURCE_MAX]string{
+	FLOW_LOG:        "flow_log",
+	FLOW_METRICS:    "flow_metrics",
+	APPLICATION_LOG: "application_log",
+	EXT_METRICS:     "ext_metrics",
+	PROMETHEUS:      "prometheus",
+}
+
+func (d Datasource) String() string {
+	if d < DATASOURCE_MAX {
+		return datasourceNames[d]
+	}
+	return "unknown"
+}
+
+func ParseDatasource(s string) (Datasource, error) {
+	for i, name := range datasourceNames {
+		if s == name {
+			return Datasource(i), nil
+		}
+	}
+	return DATASOURCE_MAX, fmt.Errorf("invalid datasource '%s', should be one of %v", s, datasourceNames)
+}
+
+// Limit is the quota of an org, or a team of the org if TeamId is not 0. The zero
+// values mean no limit
+type Limit struct {
+	OrgId             uint16
+	TeamId            uint32
+	MessagesPerSecond int64
+	BytesPerSecond    int64
+	Action            Action // for MessagesPerSecond and BytesPerSecond, the rows exceeding RowsPerDay are always dropped
+	RowsPerDay        [DATASOURCE_MAX]int64
+}
+
+func (l *Limit) Validate() error {
+	if l.OrgId == ckdb.INVALID_ORG_ID || l.OrgId > ckdb.MAX_ORG_ID {
+		return fmt.Errorf("invalid org-id %d, should be in [1, %d]", l.OrgId, ckdb.MAX_ORG_ID)
+	}
+	if l.MessagesPerSecond < 0 || l.BytesPerSecond < 0 {
+		return fmt.Errorf("quota of org %d team %d: messages-per-second and bytes-per-second should not be negative", l.OrgId, l.TeamId)
+	}
+	for i, rows := range l.RowsPerDay {
+		if rows < 0 {
+			return fmt.Errorf("quota of org %d team %d: rows-per-day of %s should not be negative", l.OrgId, l.TeamId, Datasource(i))
+		}
+	}
+	if l.Action > ACTION_DROP {
+		return fmt.Errorf("quota of org %d team %d: invalid action %d", l.OrgId, l.TeamId, l.Action)
+	}
+	return nil
+}
+
+// String returns the limit in the format of ParseLimit
+func (l *Limit) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "org-id=%d,team-id=%d,messages-per-second=%d,bytes-per-second=%d,action=%s",
+		l.OrgId, l.TeamId, l.MessagesPerSecond, l.BytesPerSecond, l.Action)
+	for i, rows := range l.RowsPerDay {
+		if rows > 0 {
+			fmt.Fprintf(&sb, ",rows-per-day.%s=%d", Datasource(i), rows)
+		}
+	}
+	return sb.String()
+}
+
+// ParseLimit parses the limit like 'org-id=2,team-id=3,bytes-per-second=1048576,action=drop,rows-per-day.flow_log=100000000',
+// the absent items are not limited
+func ParseLimit(s string) (*Limit, error) {
+	l := &Limit{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid item '%s', should be key=value", item)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if key == "action" {
+			action, err := ParseAction(value)
+			if err != nil {
+				return nil, err
+			}
+			l.Action = action
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of '%s': %s", key, err)
+		}
+		switch key {
+		case "org-id":
+			if n < 0 || n > ckdb.MAX_ORG_ID {
+				return nil, fmt.Errorf("invalid org-id %d", n)
+			}
+			l.OrgId = uint16(n)
+		case "team-id":
+			if n < 0 || n > 0xffffffff {
+				return nil, fmt.Errorf("invalid team-id %d", n)
+			}
+			l.TeamId = uint32(n)
+		case "messages-per-second":
+			l.MessagesPerSecond = n
+		case "bytes-per-second":
+			l.BytesPerSecond = n
+		default:
+			if !strings.HasPrefix(key, "rows-per-day.") {
+				return nil, fmt.Errorf("unknown key '%s'", key)
+			}
+			ds, err := ParseDatasource(strings.TrimPrefix(key, "rows-per-day."))
+			if err != nil {
+				return nil, err
+			}
+			l.RowsPerDay[ds] = n
+		}
+	}
+	return l, l.Validate()
+}
+
+// bucket is a token bucket which allows a burst of one second
+type bucket struct {
+	rate   float64 // 0 means no limit
+	tokens float64
+}
+
+func (b *bucket) setRate(rate int64) {
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+func (b *bucket) refill(seconds float64) {
+	if b.rate == 0 {
+		return
+	}
+	b.tokens += b.rate * seconds
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+// available returns true if n tokens can be taken without waiting, a full bucket
+// allows a message larger than the burst
+func (b *bucket) available(n float64) bool {
+	return b.rate == 0 || b.tokens >= n || b.tokens >= b.rate
+}
+
+func (b *bucket) take(n float64) {
+	if b.rate != 0 {
+		b.tokens -= n
+	}
+}
+
+// wait returns the time until the tokens are no longer owed
+func (b *bucket) wait() time.Duration {
+	if b.rate == 0 || b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type Counter struct {
+	OrgId      string `statsd:"tenant_org_id"`
+	TeamId     string `statsd:"tenant_team_id"`
+	Datasource string `statsd:"datasource"`
+
+	Messages          int64 `statsd:"messages"`
+	Bytes             int64 `statsd:"bytes"`
+	ThrottledMessages int64 `statsd:"throttled-messages"`
+	ThrottleTime      int64 `statsd:"throttle-time"` // microseconds
+	DroppedMessages   int64 `statsd:"dropped-messages"`
+	DroppedBytes      int64 `statsd:"dropped-bytes"`
+	MessagesLimit     int64 `statsd:"messages-limit"`
+	BytesLimit        int64 `statsd:"bytes-limit"`
+
+	// the rows of the datasource written today, and the messages dropped by the decoders
+	Rows                int64 `statsd:"rows"`
+	RowsLimit           int64 `statsd:"rows-limit"`
+	RowsDroppedMessages int64 `statsd:"rows-dropped-messages"`
+}
+
+type quota struct {
+	sync.Mutex
+	limit      Limit
+	messages   bucket
+	bytes      bucket
+	lastRefill time.Time
+
+	day         int // yyyymmdd of the local time
+	rows        [DATASOURCE_MAX]int64
+	droppedRows [DATASOURCE_MAX]int64
+	counter     Counter
+}
+
+func newQuota(l *Limit) *quota {
+	q := &quota{lastRefill: time.Now()}
+	q.setLimit(l)
+	// start with full buckets
+	q.messages.tokens, q.bytes.tokens = q.messages.rate, q.bytes.rate
+	return q
+}
+
+// setLimit changes the limit and keeps the usage
+func (q *quota) setLimit(l *Limit) {
+	q.limit = *l
+	q.messages.setRate(l.MessagesPerSecond)
+	q.bytes.setRate(l.BytesPerSecond)
+}
+
+func (q *quota) refill(now time.Time) {
+	if seconds := now.Sub(q.lastRefill).Seconds(); seconds > 0 {
+		q.messages.refill(seconds)
+		q.bytes.refill(seconds)
+		q.lastRefill = now
+	}
+}
+
+func (q *quota) reserve(now time.Time, size int64, maxWait time.Duration) (time.Duration, bool) {
+	q.Lock()
+	defer q.Unlock()
+	q.refill(now)
+	if q.limit.Action == ACTION_DROP {
+		if !q.messages.available(1) || !q.bytes.available(float64(size)) {
+			q.counter.DroppedMessages++
+			q.counter.DroppedBytes += size
+			return 0, false
+		}
+		q.messages.take(1)
+		q.bytes.take(float64(size))
+		q.counter.Messages++
+		q.counter.Bytes += size
+		return 0, true
+	}
+
+	q.messages.take(1)
+	q.bytes.take(float64(size))
+	wait := q.messages.wait()
+	if w := q.bytes.wait(); w > wait {
+		wait = w
+	}
+	if wait > maxWait {
+		q.messages.take(-1)
+		q.bytes.take(-float64(size))
+		q.counter.DroppedMessages++
+		q.counter.DroppedBytes += size
+		return 0, false
+	}
+	if wait > 0 {
+		q.counter.ThrottledMessages++
+		q.counter.ThrottleTime += int64(wait / time.Microsecond)
+	}
+	q.counter.Messages++
+	q.counter.Bytes += size
+	return wait, true
+}
+
+// cancel returns the tokens of a message which is dropped by the quota of its team
+func (q *quota) cancel(size int64) {
+	q.Lock()
+	q.messages.take(-1)
+	q.bytes.take(-float64(size))
+	q.counter.Messages--
+	q.counter.Bytes -= size
+	q.Unlock()
+}
+
+func localDay(now time.Time) int {
+	y, m, d := now.Date()
+	return y*10000 + int(m)*100 + d
+}
+
+func (q *quota) resetDay(now time.Time) {
+	if day := localDay(now); day != q.day {
+		q.day = day
+		q.rows = [DATASOURCE_MAX]int64{}
+	}
+}
+
+func (q *quota) allowRows(now time.Time, ds Datasource) bool {
+	q.Lock()
+	defer q.Unlock()
+	q.resetDay(now)
+	if limit := q.limit.RowsPerDay[ds]; limit > 0 && q.rows[ds] >= limit {
+		q.droppedRows[ds]++
+		return false
+	}
+	return true
+}
+
+func (q *quota) addRows(now time.Time, ds Datasource, rows int64) {
+	q.Lock()
+	q.resetDay(now)
+	q.rows[ds] += rows
+	q.Unlock()
+}
+
+func (q *quota) collect(counters []*Counter) []*Counter {
+	q.Lock()
+	defer q.Unlock()
+	q.resetDay(time.Now())
+	orgId := strconv.Itoa(int(q.limit.OrgId))
+	teamId := ""
+	if q.limit.TeamId != 0 {
+		teamId = strconv.Itoa(int(q.limit.TeamId))
+	}
+	c := q.counter
+	q.counter = Counter{}
+	c.OrgId, c.TeamId = orgId, teamId
+	c.MessagesLimit, c.BytesLimit = q.limit.MessagesPerSecond, q.limit.BytesPerSecond
+	counters = append(counters, &c)
+	for i := range q.rows {
+		if q.limit.RowsPerDay[i] == 0 && q.rows[i] == 0 {
+			continue
+		}
+		counters = append(counters, &Counter{
+			OrgId:               orgId,
+			TeamId:              teamId,
+			Datasource:          Datasource(i).String(),
+			Rows:                q.rows[i],
+			RowsLimit:           q.limit.RowsPerDay[i],
+			RowsDroppedMessages: q.droppedRows[i],
+		})
+		q.droppedRows[i] = 0
+	}
+	return counters
+}
+
+type orgQuotas struct {
+	org   *quota
+	teams map[uint32]*quota
+}
+
+type table [MAX_ORG_COUNT]*orgQuotas
+
+type quotaKey struct {
+	orgId  uint16
+	teamId uint32
+}
+
+// Manager enforces the quotas of the orgs and teams, a message is accepted only if
+// both the quota of its org and the quota of its team accept it
+type Manager struct {
+	mu     sync.Mutex // for updating the quotas
+	quotas atomic.Pointer[table]
+
+	// the quotas of the config, a quota synced from the controller replaces the
+	// configured quota of the same org and team until it is deleted from the controller
+	configured map[quotaKey]Limit
+	synced     [MAX_ORG_COUNT]map[uint32]bool // team ids of the quotas synced from the controller
+
+	utils.Closable
+}
+
+func NewManager(limits []Limit) (*Manager, error) {
+	m := &Manager{configured: make(map[quotaKey]Limit, len(limits))}
+	m.quotas.Store(&table{})
+	for i := range limits {
+		if err := m.Set(&limits[i]); err != nil {
+			return nil, err
+		}
+		m.configured[quotaKey{limits[i].OrgId, limits[i].TeamId}] = limits[i]
+	}
+	return m, nil
+}
+
+// Set adds or replaces the quota of the org or the team, the usage of a replaced
+// quota is kept
+func (m *Manager) Set(l *Limit) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.set(l)
+	m.mu.Unlock()
+	return nil
+}
+
+// Sync replaces the quotas of the org synced from the controller, the synced quotas
+// absent from limits are deleted, or restored to the configured quotas
+func (m *Manager) Sync(orgId uint16, limits []Limit) {
+	if int(orgId) >= MAX_ORG_COUNT {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	synced := make(map[uint32]bool, len(limits))
+	for i := range limits {
+		l := &limits[i]
+		if l.OrgId != orgId {
+			log.Warningf("ignore quota of org %d synced for org %d", l.OrgId, orgId)
+			continue
+		}
+		if err := l.Validate(); err != nil {
+			log.Warningf("ignore invalid quota synced from the controller: %s", err)
+			continue
+		}
+		synced[l.TeamId] = true
+		if q := m.quotas.Load().get(l.OrgId, l.TeamId); q != nil {
+			q.Lock()
+			unchanged := q.limit == *l
+			q.Unlock()
+			if unchanged {
+				continue
+			}
+		}
+		m.set(l)
+	}
+	for teamId := range m.synced[orgId] {
+		if synced[teamId] {
+			continue
+		}
+		if l, ok := m.configured[quotaKey{orgId, teamId}]; ok {
+			m.set(&l)
+		} else {
+			m.delete(orgId, teamId)
+		}
+	}
+	m.synced[orgId] = synced
+}
+
+func (m *Manager) set(l *Limit) {
+	t := m.quotas.Load()
+	if q := t.get(l.OrgId, l.TeamId); q != nil {
+		q.Lock()
+		q.setLimit(l)
+		q.Unlock()
+		log.Infof("set quota: %s", l)
+		return
+	}
+
+	newTable := *t
+	o := &orgQuotas{}
+	if old := t[l.OrgId]; old != nil {
+		*o = *old
+	}
+	if l.TeamId == 0 {
+		o.org = newQuota(l)
+	} else {
+		teams := make(map[uint32]*quota, len(o.teams)+1)
+		for id, q := range o.teams {
+			teams[id] = q
+		}
+		teams[l.TeamId] = newQuota(l)
+		o.teams = teams
+	}
+	newTable[l.OrgId] = o
+	m.quotas.Store(&newTable)
+	log.Infof("set quota: %s", l)
+}
+
+// Delete removes the quota of the org or the team, the quotas of the teams are kept
+// when the quota of the org is removed
+func (m *Manager) Delete(orgId uint16, teamId uint32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.delete(orgId, teamId)
+}
+
+func (m *Manager) delete(orgId uint16, teamId uint32) bool {
+	t := m.quotas.Load()
+	if t.get(orgId, teamId) == nil {
+		return false
+	}
+	newTable := *t
+	o := &orgQuotas{}
+	*o = *t[orgId]
+	if teamId == 0 {
+		o.org = nil
+	} else {
+		teams := make(map[uint32]*quota, len(o.teams))
+		for id, q := range o.teams {
+			if id != teamId {
+				teams[id] = q
+			}
+		}
+		o.teams = teams
+	}
+	if o.org == nil && len(o.teams) == 0 {
+		o = nil
+	}
+	newTable[orgId] = o
+	m.quotas.Store(&newTable)
+	log.Infof("delete quota of org %d team %d", orgId, teamId)
+	return true
+}
+
+func (t *table) get(orgId uint16, teamId uint32) *quota {
+	if int(orgId) >= len(t) || t[orgId] == nil {
+		return nil
+	}
+	if teamId == 0 {
+		return t[orgId].org
+	}
+	return t[orgId].teams[teamId]
+}
+
+// Limits returns the quotas ordered by org and team
+func (m *Manager) Limits() []Limit {
+	limits := []Limit{}
+	for _, q := range m.all() {
+		q.Lock()
+		limits = append(limits, q.limit)
+		q.Unlock()
+	}
+	return limits
+}
+
+func (m *Manager) all() []*quota {
+	quotas := []*quota{}
+	for _, o := range m.quotas.Load() {
+		if o == nil {
+			continue
+		}
+		if o.org != nil {
+			quotas = append(quotas, o.org)
+		}
+		teamIds := make([]uint32, 0, len(o.teams))
+		for id := range o.teams {
+			teamIds = append(teamIds, id)
+		}
+		sort.Slice(teamIds, func(i, j int) bool { return teamIds[i] < teamIds[j] })
+		for _, id := range teamIds {
+			quotas = append(quotas, o.teams[id])
+		}
+	}
+	return quotas
+}
+
+// Reserve is called by the receiver for each message. It returns false if the message
+// should be dropped, otherwise the time the message should wait before being processed.
+// A message which needs to wait longer than maxWait is dropped, so 0 should be used if
+// the receiver can not wait, e.g. for UDP
+func (m *Manager) Reserve(orgId uint16, teamId uint32, size int, maxWait time.Duration) (time.Duration, bool) {
+	if int(orgId) >= MAX_ORG_COUNT {
+		return 0, true
+	}
+	o := m.quotas.Load()[orgId]
+	if o == nil {
+		return 0, true
+	}
+	now := time.Now()
+	var wait time.Duration
+	if o.org != nil {
+		w, ok := o.org.reserve(now, int64(size), maxWait)
+		if !ok {
+			return 0, false
+		}
+		wait = w
+	}
+	if q := o.teams[teamId]; q != nil {
+		w, ok := q.reserve(now, int64(size), maxWait)
+		if !ok {
+			if o.org != nil {
+				o.org.cancel(int64(size))
+			}
+			return 0, false
+		}
+		if w > wait {
+			wait = w
+		}
+	}
+	return wait, true
+}
+
+func (m *Manager) allowRows(ds Datasource, orgId uint16, teamId uint32) bool {
+	if int(orgId) >= MAX_ORG_COUNT {
+		return true
+	}
+	o := m.quotas.Load()[orgId]
+	if o == nil {
+		return true
+	}
+	now := time.Now()
+	if o.org != nil && !o.org.allowRows(now, ds) {
+		return false
+	}
+	if q := o.teams[teamId]; q != nil && !q.allowRows(now, ds) {
+		return false
+	}
+	return true
+}
+
+func (m *Manager) addRows(ds Datasource, orgId uint16, teamId uint32, rows int64) {
+	if int(orgId) >= MAX_ORG_COUNT {
+		return
+	}
+	o := m.quotas.Load()[orgId]
+	if o == nil {
+		return
+	}
+	now := time.Now()
+	if o.org != nil {
+		o.org.addRows(now, ds, rows)
+	}
+	if q := o.teams[teamId]; q != nil {
+		q.addRows(now, ds, rows)
+	}
+}
+
+// GetCounter returns the usage of each quota, which is written to deepflow_tenant
+// with the org id and team id of the quota
+func (m *Manager) GetCounter() interface{} {
+	counters := []*Counter{}
+	for _, q := range m.all() {
+		counters = q.collect(counters)
+	}
+	return counters
+}
+
+// NewRowCounter returns the row counter of the datasource for a decoder, it returns nil
+// if m is nil
+func (m *Manager) NewRowCounter(ds Datasource) *RowCounter {
+	if m == nil {
+		return nil
+	}
+	return &RowCounter{manager: m, datasource: ds}
+}
+
+// RowCounter counts the rows decoded from a message for the rows-per-day quotas, it is
+// used in the goroutine of a decoder. The rows of a message are counted after the message
+// is decoded, so the quota may be exceeded by the rows of the last message. All the methods
+// of a nil RowCounter are no-ops.
+type RowCounter struct {
+	manager    *Manager
+	datasource Datasource
+	orgId      uint16
+	teamId     uint32
+	rows       int64
+}
+
+// Begin returns false if the rows-per-day quota of the org or team of the message is used
+// up today, then the message should be dropped
+func (c *RowCounter) Begin(orgId uint16, teamId uint32) bool {
+	if c == nil {
+		return true
+	}
+	c.orgId, c.teamId, c.rows = orgId, teamId, 0
+	return c.manager.allowRows(c.datasource, orgId, teamId)
+}
+
+func (c *RowCounter) Add(rows int) {
+	if c != nil {
+		c.rows += int64(rows)
+	}
+}
+
+// End counts the rows of the message into the quotas
+func (c *RowCounter) End() {
+	if c == nil || c.rows == 0 {
+		return
+	}
+	c.manager.addRows(c.datasource, c.orgId, c.teamId, c.rows)
+	c.rows = 0
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("org-id=2, team-id=3,bytes-per-second=1024,action=drop,rows-per-day.flow_log=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Limit{OrgId: 2, TeamId: 3, BytesPerSecond: 1024, Action: ACTION_DROP}
+	expected.RowsPerDay[FLOW_LOG] = 100
+	if *l != expected {
+		t.Errorf("expected %+v, got %+v", expected, *l)
+	}
+	if again, err := ParseLimit(l.String()); err != nil || *again != *l {
+		t.Errorf("parse '%s' failed: %v %+v", l.String(), err, again)
+	}
+
+	for _, s := range []string{
+		"team-id=3",
+		"org-id=1025",
+		"org-id=1,action=wait",
+		"org-id=1,rows-per-day.pcap=1",
+		"org-id=1,messages-per-second=-1",
+		"org-id=1,unknown=1",
+	} {
+		if _, err := ParseLimit(s); err == nil {
+			t.Errorf("'%s' should be invalid", s)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	m, err := NewManager([]Limit{
+		{OrgId: 2, MessagesPerSecond: 10, Action: ACTION_DROP},
+		{OrgId: 3, BytesPerSecond: 100},
+		{OrgId: 4, TeamId: 5, MessagesPerSecond: 1, Action: ACTION_DROP},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no quota
+	if _, ok := m.Reserve(1, 0, 1<<20, 0); !ok {
+		t.Error("org 1 has no quota")
+	}
+
+	// drop after the burst
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		if _, ok := m.Reserve(2, 0, 10, MAX_THROTTLE_WAIT); ok {
+			accepted++
+		}
+	}
+	if accepted != 10 {
+		t.Errorf("expected 10 messages accepted, got %d", accepted)
+	}
+
+	// throttle, a message can be larger than the burst
+	if wait, ok := m.Reserve(3, 0, 300, MAX_THROTTLE_WAIT); !ok || wait < 1900*time.Millisecond || wait > 2*time.Second {
+		t.Errorf("expected to wait 2s, got %s %v", wait, ok)
+	}
+	// the receiver which can not wait drops the message, and the tokens are returned
+	if _, ok := m.Reserve(3, 0, 100, 0); ok {
+		t.Error("message should be dropped without waiting")
+	}
+	if wait, _ := m.Reserve(3, 0, 100, MAX_THROTTLE_WAIT); wait < 2900*time.Millisecond {
+		t.Errorf("expected to wait 3s, got %s", wait)
+	}
+
+	// quota of the team only
+	if _, ok := m.Reserve(4, 1, 10, 0); !ok {
+		t.Error("team 1 has no quota")
+	}
+	if _, ok := m.Reserve(4, 5, 10, 0); !ok {
+		t.Error("the first message of team 5 should be accepted")
+	}
+	if _, ok := m.Reserve(4, 5, 10, 0); ok {
+		t.Error("the second message of team 5 should be dropped")
+	}
+
+	counters := m.GetCounter().([]*Counter)
+	if len(counters) != 3 {
+		t.Fatalf("expected 3 counters, got %d", len(counters))
+	}
+	if c := counters[0]; c.OrgId != "2" || c.TeamId != "" || c.Messages != 10 || c.DroppedMessages != 10 || c.Bytes != 100 {
+		t.Errorf("unexpected counter of org 2: %+v", c)
+	}
+	if c := counters[1]; c.Messages != 2 || c.ThrottledMessages != 2 || c.DroppedMessages != 1 || c.Bytes != 400 {
+		t.Errorf("unexpected counter of org 3: %+v", c)
+	}
+	if c := counters[2]; c.OrgId != "4" || c.TeamId != "5" || c.Messages != 1 || c.DroppedMessages != 1 {
+		t.Errorf("unexpected counter of org 4 team 5: %+v", c)
+	}
+}
+
+func TestRowsPerDay(t *testing.T) {
+	org := Limit{OrgId: 2}
+	org.RowsPerDay[FLOW_LOG] = 100
+	team := Limit{OrgId: 2, TeamId: 3}
+	team.RowsPerDay[FLOW_METRICS] = 10
+	m, err := NewManager([]Limit{org, team})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flowLog, flowMetrics := m.NewRowCounter(FLOW_LOG), m.NewRowCounter(FLOW_METRICS)
+	for i := 0; i < 3; i++ {
+		if !flowLog.Begin(2, 3) {
+			t.Fatalf("message %d should be accepted", i)
+		}
+		flowLog.Add(40)
+		flowLog.End()
+	}
+	// the quota is exceeded by the last message
+	if flowLog.Begin(2, 1) {
+		t.Error("flow_log quota of org 2 should be used up")
+	}
+	if !flowMetrics.Begin(2, 1) {
+		t.Error("team 1 has no flow_metrics quota")
+	}
+	flowMetrics.Add(20)
+	flowMetrics.End()
+	if !flowMetrics.Begin(2, 3) {
+		t.Error("flow_metrics quota of team 3 should not be used by team 1")
+	}
+	flowMetrics.Add(20)
+	flowMetrics.End()
+	if flowMetrics.Begin(2, 3) {
+		t.Error("flow_metrics quota of team 3 should be used up")
+	}
+
+	// the usage is kept when the quota is changed
+	org.RowsPerDay[FLOW_LOG] = 200
+	if err := m.Set(&org); err != nil {
+		t.Fatal(err)
+	}
+	if !flowLog.Begin(2, 1) {
+		t.Error("flow_log quota of org 2 should be available after being increased")
+	}
+	flowLog.End()
+
+	if !m.Delete(2, 3) || m.Delete(2, 3) {
+		t.Error("quota of team 3 should be deleted once")
+	}
+	if !flowMetrics.Begin(2, 3) {
+		t.Error("quota of team 3 is deleted")
+	}
+	if limits := m.Limits(); len(limits) != 1 || limits[0] != org {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+
+	var nilCounter *RowCounter
+	if !nilCounter.Begin(2, 3) {
+		t.Error("nil row counter should accept everything")
+	}
+	nilCounter.Add(1)
+	nilCounter.End()
+}
+
+func TestSync(t *testing.T) {
+	configured := Limit{OrgId: 2, MessagesPerSecond: 10}
+	m, err := NewManager([]Limit{configured})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	org := Limit{OrgId: 2, MessagesPerSecond: 100}
+	team := Limit{OrgId: 2, TeamId: 3, BytesPerSecond: 1000, Action: ACTION_DROP}
+	m.Sync(2, []Limit{org, team, {OrgId: 3, MessagesPerSecond: 1}})
+	if limits := m.Limits(); len(limits) != 2 || limits[0] != org || limits[1] != team {
+		t.Errorf("synced quotas should replace the configured quota, got %+v", limits)
+	}
+
+	// the deleted quotas are restored to the configured quota or removed
+	m.Sync(2, nil)
+	if limits := m.Limits(); len(limits) != 1 || limits[0] != configured {
+		t.Errorf("configured quota should be restored, got %+v", limits)
+	}
+
+	m.Sync(4, []Limit{{OrgId: 4, TeamId: 5, MessagesPerSecond: 1}})
+	m.Sync(4, nil)
+	if limits := m.Limits(); len(limits) != 1 {
+		t.Errorf("quota of org 4 should be deleted, got %+v", limits)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -42,6 +43,7 @@ import (
 	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/pool"
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/quota"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	. "github.com/deepflowio/deepflow/server/libs/utils"
 )
@@ -159,7 +161,7 @@ func ReleaseRecvBuffer(b *RecvBuffer) {
 
 type QueueCache struct {
 	sync.Mutex
-	values    []interface{}
+	values    []*RecvBuffer
 	timestamp int64
 }
 
@@ -375,7 +377,7 @@ func (s *AdapterStatus) GetStatus(msgType datatype.MessageType) string {
 
 type Handler struct {
 	msgType        datatype.MessageType // 在datatype/droplet-message.go中定义
-	queues         queue.MultiQueueWriter
+	queues         queue.TypedMultiQueueWriter[*RecvBuffer]
 	nQueues        int
 	queueUDPCaches []QueueCache // UDP单线程处理，免锁
 	queueTCPCaches []QueueCache // TCP多线程处理，需加锁
@@ -405,6 +407,7 @@ type Receiver struct {
 	closed bool
 
 	counter *ReceiverCounter
+	quota   *quota.Manager
 
 	status *AdapterStatus
 }
@@ -419,6 +422,8 @@ type ReceiverCounter struct {
 	UDPDisorder     uint64 `statsd:"udp_disorder"`      // 乱序个数
 	UDPDisorderSize uint64 `statsd:"udp_disorder_size"` // 乱序最大范围
 	NewBufferCount  uint64 `statsd:"new_buffer_count"`  // If the received data is large, you need to alloc memory, record the times.
+	QuotaDropped    uint64 `statsd:"quota_dropped"`     // dropped by the quotas of the orgs or teams
+	QuotaThrottled  uint64 `statsd:"quota_throttled"`   // delayed by the quotas of the orgs or teams
 }
 
 func NewReceiver(
@@ -445,12 +450,12 @@ func NewReceiver(
 }
 
 // 注册处理函数，收到msgType的数据，放到outQueues中
-func (r *Receiver) RegistHandler(msgType datatype.MessageType, outQueues queue.MultiQueueWriter, nQueues int) error {
+func (r *Receiver) RegistHandler(msgType datatype.MessageType, outQueues queue.TypedMultiQueueWriter[*RecvBuffer], nQueues int) error {
 	queueUDPCaches := make([]QueueCache, nQueues)
 	queueTCPCaches := make([]QueueCache, nQueues)
 	for i := 0; i < nQueues; i++ {
-		queueUDPCaches[i].values = make([]interface{}, 0, QUEUE_BATCH_NUM)
-		queueTCPCaches[i].values = make([]interface{}, 0, QUEUE_BATCH_NUM)
+		queueUDPCaches[i].values = make([]*RecvBuffer, 0, QUEUE_BATCH_NUM)
+		queueTCPCaches[i].values = make([]*RecvBuffer, 0, QUEUE_BATCH_NUM)
 	}
 	r.handlers[msgType] = &Handler{
 		msgType:        msgType,
@@ -482,6 +487,34 @@ func (r *Receiver) SetServerType(serverType ServerType) {
 	r.serverType = serverType
 }
 
+// SetQuotaManager enables the quotas of the orgs and teams, it should be called before Start
+func (r *Receiver) SetQuotaManager(m *quota.Manager) {
+	r.quota = m
+}
+
+// QuotaManager returns nil if the quotas are not enabled
+func (r *Receiver) QuotaManager() *quota.Manager {
+	return r.quota
+}
+
+// checkQuota returns false if the message should be dropped by the quota of its org or team,
+// if the message is throttled, it waits at most maxWait here
+func (r *Receiver) checkQuota(orgID uint16, teamID uint32, size int, maxWait time.Duration) bool {
+	if r.quota == nil {
+		return true
+	}
+	wait, ok := r.quota.Reserve(orgID, teamID, size, maxWait)
+	if !ok {
+		atomic.AddUint64(&r.counter.QuotaDropped, 1)
+		return false
+	}
+	if wait > 0 {
+		atomic.AddUint64(&r.counter.QuotaThrottled, 1)
+		time.Sleep(wait)
+	}
+	return true
+}
+
 func (r *Receiver) GetCounter() interface{} {
 	counter := &ReceiverCounter{MaxDelay: -ONE_HOUR, MinDelay: ONE_HOUR}
 	counter, r.counter = r.counter, counter
@@ -761,6 +794,8 @@ func (r *Receiver) ProcessUDPServer() {
 		if r.handlers[baseHeader.Type] == nil {
 			atomic.AddUint64(&r.counter.Unregistered, 1)
 			ReleaseRecvBuffer(recvBuffer)
+		} else if !r.checkQuota(orgID, teamID, size, 0) { // UDP messages can not wait
+			ReleaseRecvBuffer(recvBuffer)
 		} else {
 			recvBuffer.Begin = headerLen
 			recvBuffer.End = size // syslog,statsd数据的FrameSize长度是0,需要以实际长度为准
@@ -977,6 +1012,9 @@ func (r *Receiver) handleTCPConnection(conn net.Conn) {
 		if r.handlers[baseHeader.Type] == nil {
 			atomic.AddUint64(&r.counter.Unregistered, 1)
 			ReleaseRecvBuffer(recvBuffer)
+		} else if !r.checkQuota(orgID, teamID, int(baseHeader.FrameSize), quota.MAX_THROTTLE_WAIT) {
+			// throttling delays reading the connection, so the agent slows down as well
+			ReleaseRecvBuffer(recvBuffer)
 		} else {
 			recvBuffer.Begin = 0
 			recvBuffer.End = int(baseHeader.FrameSize) - headerLen
@@ -995,6 +1033,107 @@ func (r *Receiver) handleTCPConnection(conn net.Conn) {
 	}
 }
 
+// ErrQueueFull is returned by PutFrames when the handler queue reaches the limit, the frames should be put again later
+var ErrQueueFull = errors.New("receiver handler queue is full")
+
+type frame struct {
+	handler       *Handler
+	hasFlowHeader bool
+	flowHeader    datatype.FlowHeader
+	data          []byte
+}
+
+// PutFrames puts the agent messages which are not received from the sockets, e.g. consumed from kafka,
+// data may contain several frames in the same format as TCP. None of the frames is put if any of them is invalid,
+// or any handler queue is longer than queueLimit (0 means no limit). The frames exceeding the quotas
+// of their orgs or teams are dropped or delayed like TCP. The returned positions tell when the frames are decoded.
+func (r *Receiver) PutFrames(data []byte, ip net.IP, queueLimit int) ([]*queue.Position, error) {
+	baseHeader := &datatype.BaseHeader{}
+	frames := []frame{}
+	for len(data) > 0 {
+		if len(data) < datatype.MESSAGE_HEADER_LEN {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			return nil, fmt.Errorf("frame length %d is smaller than header length %d", len(data), datatype.MESSAGE_HEADER_LEN)
+		}
+		if err := baseHeader.Decode(data); err != nil {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			return nil, err
+		}
+		if baseHeader.Type >= datatype.MESSAGE_TYPE_MAX {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			return nil, fmt.Errorf("unknown message type %d", baseHeader.Type)
+		}
+		frameSize := int(baseHeader.FrameSize)
+		// the frame size of syslog and statsd may be 0, the frame ends at the end of data
+		if frameSize == 0 || baseHeader.Type.HeaderType() == datatype.HEADER_TYPE_LT_NOCHECK {
+			frameSize = len(data)
+		}
+		if frameSize > len(data) {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			return nil, fmt.Errorf("frame size %d is larger than data length %d", frameSize, len(data))
+		}
+		f := frame{handler: r.handlers[baseHeader.Type]}
+		headerLen := datatype.MESSAGE_HEADER_LEN
+		if baseHeader.Type.HeaderType() == datatype.HEADER_TYPE_LT_VTAP {
+			f.hasFlowHeader = true
+			f.flowHeader.Decode(data[headerLen:])
+			headerLen += datatype.FLOW_HEADER_LEN
+		}
+		f.data = data[headerLen:frameSize]
+		data = data[frameSize:]
+		if f.handler == nil {
+			atomic.AddUint64(&r.counter.Unregistered, 1)
+			continue
+		}
+		if len(f.data) > RECV_BUFSIZE_MAX {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			return nil, fmt.Errorf("wrong frame size %d", frameSize)
+		}
+		frames = append(frames, f)
+	}
+
+	hash := int(atomic.AddUint64(&r.counter.RxPackets, uint64(len(frames))))
+	if queueLimit > 0 {
+		for i, f := range frames {
+			if f.handler.queues.Len(queue.HashKey((hash+i)%f.handler.nQueues)) >= queueLimit {
+				return nil, ErrQueueFull
+			}
+		}
+	}
+	positions := make([]*queue.Position, 0, len(frames))
+	for i := range frames {
+		f := &frames[i]
+		orgID, teamID := uint16(0), uint32(0)
+		if f.hasFlowHeader {
+			orgID, teamID = r.parseOrgIdTeamId(&f.flowHeader)
+		}
+		if !r.checkQuota(orgID, teamID, len(f.data), quota.MAX_THROTTLE_WAIT) {
+			continue
+		}
+		decodeBuffer, err := r.decompressBuffer(f.flowHeader.Encoder, f.data, 0, len(f.data))
+		if err != nil {
+			atomic.AddUint64(&r.counter.Invalid, 1)
+			continue
+		}
+		recvBuffer, isNew := AcquireRecvBuffer(len(decodeBuffer), TCP)
+		if isNew {
+			atomic.AddUint64(&r.counter.NewBufferCount, 1)
+		}
+		copy(recvBuffer.Buffer, decodeBuffer)
+		recvBuffer.Begin = 0
+		recvBuffer.End = len(decodeBuffer)
+		recvBuffer.IP = ip
+		recvBuffer.VtapID = f.flowHeader.AgentID
+		recvBuffer.TeamID = teamID
+		recvBuffer.OrgID = orgID
+		position, _ := queue.PutWithPosition(f.handler.queues, queue.HashKey((hash+i)%f.handler.nQueues), recvBuffer)
+		if position != nil {
+			positions = append(positions, position)
+		}
+	}
+	return positions, nil
+}
+
 func (r *Receiver) Start() {
 	var err error
 	if r.serverType == UDP || r.serverType == BOTH {
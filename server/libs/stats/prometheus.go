@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const PROMETHEUS_METRICS_PATH = "/metrics"
+
+var (
+	prometheusEnabled  atomic.Bool
+	prometheusRegistry *prometheus.Registry
+	prometheusOnce     sync.Once
+)
+
+// The counters of Countable are cleared after being read, so they are read only once per stats interval,
+// the exporter renders the values of the latest interval as gauges.
+type countableCollector struct{}
+
+// Describe sends nothing, the metrics are different on every collection
+func (c countableCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c countableCollector) Collect(ch chan<- prometheus.Metric) {
+	lock.Lock()
+	points := make([]metricPoint, 0, statSources.Len())
+	for it := statSources.Iterator(); !it.Empty(); it.Next() {
+		source := it.Value().(*StatSource)
+		if source.countable.Closed() || source.lastFields == nil {
+			continue
+		}
+		points = append(points, metricPoint{name: source.name, tags: source.tags, fields: source.lastFields})
+	}
+	lock.Unlock()
+
+	// all metrics of a family must have the same label names, the labels missing in a metric are rendered
+	// with empty values which are the same as absent labels in prometheus
+	var samples []promSample
+	families := make(map[string]*promFamily)
+	for _, p := range points {
+		for _, fm := range p.fields {
+			labelNames, labelValues := promLabels(p.tags, fm)
+			for k, v := range fm {
+				value, ok := toFloat64(v)
+				if !ok {
+					continue
+				}
+				name := promMetricName(p.name + "_" + k)
+				family, ok := families[name]
+				if !ok {
+					family = &promFamily{
+						help:   "DeepFlow self-monitoring counter " + p.name + "." + k + " of the latest stats interval",
+						labels: make(map[string]struct{}),
+					}
+					families[name] = family
+				}
+				for _, l := range labelNames {
+					family.labels[l] = struct{}{}
+				}
+				samples = append(samples, promSample{name: name, labelNames: labelNames, labelValues: labelValues, value: value})
+			}
+		}
+	}
+
+	collected := make(map[string]struct{})
+	for _, s := range samples {
+		family := families[s.name]
+		if family.desc == nil {
+			family.labelNames = make([]string, 0, len(family.labels))
+			for l := range family.labels {
+				family.labelNames = append(family.labelNames, l)
+			}
+			sort.Strings(family.labelNames)
+			family.desc = prometheus.NewDesc(s.name, family.help, family.labelNames, nil)
+		}
+		labelValues := make([]string, len(family.labelNames))
+		for i, j := 0, 0; i < len(family.labelNames) && j < len(s.labelNames); i++ {
+			if family.labelNames[i] == s.labelNames[j] {
+				labelValues[i] = s.labelValues[j]
+				j++
+			}
+		}
+		key := s.name + "{" + strings.Join(labelValues, ",") + "}"
+		if _, ok := collected[key]; ok {
+			continue
+		}
+		collected[key] = struct{}{}
+		metric, err := prometheus.NewConstMetric(family.desc, prometheus.GaugeValue, s.value, labelValues...)
+		if err != nil {
+			log.Debugf("render metric %s failed: %s", s.name, err)
+			continue
+		}
+		ch <- metric
+	}
+}
+
+type promSample struct {
+	name        string
+	labelNames  []string // sorted
+	labelValues []string
+	value       float64
+}
+
+type promFamily struct {
+	help       string
+	labels     map[string]struct{}
+	labelNames []string // sorted
+	desc       *prometheus.Desc
+}
+
+// tags and the string fields are used as labels
+func promLabels(tags map[string]string, fields map[string]interface{}) ([]string, []string) {
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			labels[promLabelName(k)] = v
+		}
+	}
+	for k, v := range fields {
+		if s, ok := v.(string); ok && s != "" {
+			labels[promLabelName(k)] = s
+		}
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	values := make([]string, 0, len(names))
+	for _, k := range names {
+		values = append(values, labels[k])
+	}
+	return names, values
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch vt := v.(type) {
+	case float64:
+		return vt, true
+	case float32:
+		return float64(vt), true
+	case int:
+		return float64(vt), true
+	case int8:
+		return float64(vt), true
+	case int16:
+		return float64(vt), true
+	case int32:
+		return float64(vt), true
+	case int64:
+		return float64(vt), true
+	case uint:
+		return float64(vt), true
+	case uint8:
+		return float64(vt), true
+	case uint16:
+		return float64(vt), true
+	case uint32:
+		return float64(vt), true
+	case uint64:
+		return float64(vt), true
+	case bool:
+		if vt {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sanitizePromName(name string, allowColon bool) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (allowColon && r == ':')
+		if !valid && r >= '0' && r <= '9' {
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			valid = true
+		}
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func promMetricName(name string) string {
+	return sanitizePromName(name, true)
+}
+
+func promLabelName(name string) string {
+	name = sanitizePromName(name, false)
+	// names beginning with '__' are reserved by prometheus
+	if strings.HasPrefix(name, "__") {
+		name = "x" + name
+	}
+	return name
+}
+
+func getPrometheusRegistry() *prometheus.Registry {
+	prometheusOnce.Do(func() {
+		prometheusRegistry = prometheus.NewRegistry()
+		prometheusRegistry.MustRegister(
+			countableCollector{},
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	})
+	return prometheusRegistry
+}
+
+// PrometheusHandler returns the handler rendering the counters of all Countables, Go runtime and process
+// metrics in Prometheus text or OpenMetrics format, the counters are kept since the first call.
+func PrometheusHandler() http.Handler {
+	prometheusEnabled.Store(true)
+	return promhttp.HandlerFor(getPrometheusRegistry(), promhttp.HandlerOpts{
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: true,
+	})
+}
+
+// StartPrometheusExporter serves PROMETHEUS_METRICS_PATH on addr, such as ":9527"
+func StartPrometheusExporter(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle(PROMETHEUS_METRICS_PATH, PrometheusHandler())
+	go func() {
+		log.Infof("prometheus exporter listen on %s%s", addr, PROMETHEUS_METRICS_PATH)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("prometheus exporter listen on %s failed: %s", addr, err)
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromNames(t *testing.T) {
+	tests := []struct {
+		in, metric, label string
+	}{
+		{"deepflow_server_queue-1.in", "deepflow_server_queue_1_in", "deepflow_server_queue_1_in"},
+		{"1m", "_1m", "_1m"},
+		{"a:b", "a:b", "a_b"},
+		{"__name", "__name", "x__name"},
+	}
+	for _, tt := range tests {
+		if got := promMetricName(tt.in); got != tt.metric {
+			t.Errorf("promMetricName(%q) = %q, want %q", tt.in, got, tt.metric)
+		}
+		if got := promLabelName(tt.in); got != tt.label {
+			t.Errorf("promLabelName(%q) = %q, want %q", tt.in, got, tt.label)
+		}
+	}
+}
+
+func TestPromLabels_StringFieldsBecomeLabels(t *testing.T) {
+	names, values := promLabels(
+		map[string]string{"host": "node1", "empty": ""},
+		map[string]interface{}{"type": "tcp", "rx": int64(1)},
+	)
+	if strings.Join(names, ",") != "host,type" || strings.Join(values, ",") != "node1,tcp" {
+		t.Errorf("labels = %v %v, want [host type] [node1 tcp]", names, values)
+	}
+}
+
+func TestPrometheusHandler_RendersCountables(t *testing.T) {
+	freshSources(t)
+	handler := PrometheusHandler()
+
+	RegisterCountable("queue", &mockCountable{
+		counter: []structCounter{{Recv: 10, Label: "a"}, {Recv: 20, Label: "b"}},
+	}, OptionStatTags{"index": "0"})
+	RegisterCountable("gc", &mockCountable{counter: []StatItem{{"duration", uint64(5)}}})
+	resetSkip()
+	collectPoints(time.Now())
+
+	req := httptest.NewRequest("GET", PROMETHEUS_METRICS_PATH, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+
+	for _, want := range []string{
+		`index="0",label="a"} 10`,
+		`index="0",label="b"} 20`,
+		"# TYPE testproc_gc_duration gauge",
+		"go_goroutines",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics should contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestPrometheusHandler_FamilyLabelsAreConsistent(t *testing.T) {
+	freshSources(t)
+	handler := PrometheusHandler()
+
+	RegisterCountable("queue", &mockCountable{
+		counter: []structCounter{{Recv: 10, Label: "a"}},
+	}, OptionStatTags{"index": "0"})
+	RegisterCountable("queue", &mockCountable{
+		counter: []structCounter{{Recv: 30}},
+	}, OptionStatTags{"module": "decoder"})
+	resetSkip()
+	collectPoints(time.Now())
+
+	req := httptest.NewRequest("GET", PROMETHEUS_METRICS_PATH, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+
+	if rec.Code != 200 {
+		t.Fatalf("status = %d, body:\n%s", rec.Code, text)
+	}
+	for _, want := range []string{
+		`index="0",label="a",module=""} 10`,
+		`index="",label="",module="decoder"} 30`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics should contain %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "error") {
+		t.Errorf("metrics should be gathered without errors, got:\n%s", text)
+	}
+}
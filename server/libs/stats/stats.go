@@ -53,6 +53,8 @@ type StatSource struct {
 	tags         OptionStatTags
 	skip         int
 	name         string
+
+	lastFields []map[string]interface{} // the counter of the latest interval, kept for the prometheus exporter
 }
 
 func (s *StatSource) Equal(other *StatSource) bool {
@@ -253,10 +255,14 @@ func collectPoints(timestamp time.Time) []metricPoint {
 		if utils.IsNil(counter) {
 			continue
 		}
+		fields := counterToFields(counter)
+		if prometheusEnabled.Load() {
+			statSource.lastFields = fields
+		}
 		points = append(points, metricPoint{
 			name:      statSource.name,
 			tags:      statSource.tags,
-			fields:    counterToFields(counter),
+			fields:    fields,
 			timestamp: timestamp,
 		})
 	}
@@ -429,6 +435,9 @@ func sendStatsd(points []metricPoint) {
 
 func runOnce(timestamp time.Time) {
 	if len(remotes) == 0 && len(dfRemote) == 0 {
+		if prometheusEnabled.Load() {
+			collectPoints(timestamp)
+		}
 		return
 	}
 	sendStatsd(collectPoints(timestamp))
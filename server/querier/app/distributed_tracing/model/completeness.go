@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "context"
+
+type TraceCompleteness struct {
+	TraceID   string `json:"trace_id" binding:"required"`
+	TimeStart int    `json:"time_start" binding:"required"`
+	TimeEnd   int    `json:"time_end" binding:"required"`
+	Context   context.Context
+	OrgID     string
+}
+
+type TraceCompletenessResult struct {
+	TraceID    string         `json:"trace_id"`
+	SpanCount  int            `json:"span_count"`
+	SpanSource map[string]int `json:"span_source"`
+	// spans whose parent_span_id could not be found in the trace
+	MissingParents []*MissingParent `json:"missing_parents"`
+	// server side network spans whose requests are not continued by any app span
+	UninstrumentedHops []*SpanBrief `json:"uninstrumented_hops"`
+	ClockSkews         []*ClockSkew `json:"clock_skews"`
+	// spans of the org dropped by the throttlers of ingesters in the time range, grouped by message type
+	ThrottlerDrops map[string]int64 `json:"throttler_drops"`
+}
+
+type SpanBrief struct {
+	Source           string `json:"source"`
+	AgentID          int    `json:"agent_id"`
+	ObservationPoint string `json:"observation_point"`
+	SpanID           string `json:"span_id"`
+	ParentSpanID     string `json:"parent_span_id"`
+	AppService       string `json:"app_service"`
+	Endpoint         string `json:"endpoint"`
+	StartTimeUs      int64  `json:"start_time_us"`
+	EndTimeUs        int64  `json:"end_time_us"`
+}
+
+type MissingParent struct {
+	ParentSpanID string `json:"parent_span_id"`
+	// Reason can be "out_of_time_range", "id_mismatch" or "not_found"
+	Reason string `json:"reason"`
+	// the span found by a case-insensitive or out of time range search
+	Candidate *SpanBrief   `json:"candidate,omitempty"`
+	Children  []*SpanBrief `json:"children"`
+}
+
+// ClockSkew is the estimated clock offset of ChildAgentID relative to ParentAgentID, it is estimated by
+// the parent-child span pairs across the two agents, assuming that a child span is contained by its parent.
+type ClockSkew struct {
+	ParentAgentID int `json:"parent_agent_id"`
+	ChildAgentID  int `json:"child_agent_id"`
+	SpanPairs     int `json:"span_pairs"`
+	// pairs in which the child span is not contained by the parent span
+	Violations int `json:"violations"`
+	// the offset is in [MinOffsetUs, MaxOffsetUs] if Consistent, unit: us
+	MinOffsetUs       int64 `json:"min_offset_us"`
+	MaxOffsetUs       int64 `json:"max_offset_us"`
+	EstimatedOffsetUs int64 `json:"estimated_offset_us"`
+	Consistent        bool  `json:"consistent"`
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "context"
+
+type ServiceGraph struct {
+	TimeStart int `json:"time_start" binding:"required"`
+	TimeEnd   int `json:"time_end" binding:"required"`
+	// only the edges whose client or server is in the namespaces/clusters are returned if not empty
+	PodNSs      []string `json:"pod_ns"`
+	PodClusters []string `json:"pod_cluster"`
+	// max trace trees to be aggregated, use 10000 if not set. The traces are sampled by the hash of
+	// trace_id if there are more trees in the time range
+	Limit int `json:"limit"`
+	// Format can be "json" or "dot", default is "json"
+	Format  string `json:"format"`
+	Context context.Context
+	OrgID   string
+}
+
+type ServiceGraphResult struct {
+	// the number of aggregated trace trees
+	TraceCount int `json:"trace_count"`
+	// one of SampleRate traces is aggregated if there are more trace trees than the limit in the time range,
+	// the request rates are extrapolated by SampleRate and the other stats are only of the sampled traces
+	SampleRate      int          `json:"sample_rate"`
+	TotalTraceCount int          `json:"total_trace_count"`
+	Nodes           []*GraphNode `json:"nodes"`
+	Edges           []*GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID string `json:"id"`
+	// Kind can be "service", "database", "message_queue" or "ip"
+	Kind            string                   `json:"kind"`
+	Name            string                   `json:"name"`
+	AppService      string                   `json:"app_service,omitempty"`
+	AutoServiceType uint8                    `json:"auto_service_type"`
+	AutoServiceID   uint32                   `json:"auto_service_id"`
+	PodNS           string                   `json:"pod_ns,omitempty"`
+	PodCluster      string                   `json:"pod_cluster,omitempty"`
+	Topic           string                   `json:"topic,omitempty"`
+	Endpoints       map[string]*GraphTraffic `json:"endpoints"`
+}
+
+type GraphEdge struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+	GraphTraffic
+	// requests per second in the time range
+	RequestRate float64 `json:"request_rate"`
+	ErrorRate   float64 `json:"error_rate"`
+	// latency percentiles are calculated from the durations of the spans of the edge, unit: us
+	LatencyAvg float64 `json:"latency_avg"`
+	LatencyP50 float64 `json:"latency_p50"`
+	LatencyP90 float64 `json:"latency_p90"`
+	LatencyP99 float64 `json:"latency_p99"`
+}
+
+type GraphTraffic struct {
+	Request     uint64 `json:"request"`
+	Response    uint64 `json:"response"`
+	ServerError uint64 `json:"server_error"`
+	ClientError uint64 `json:"client_error"`
+}
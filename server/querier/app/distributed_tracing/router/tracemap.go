@@ -17,12 +17,16 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/op/go-logging"
 
 	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/common"
 	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/service/completeness"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/service/servicegraph"
 	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/service/tracemap"
 	"github.com/deepflowio/deepflow/server/querier/config"
 	"github.com/deepflowio/deepflow/server/querier/router"
@@ -34,6 +38,8 @@ func TraceMapRouter(e *gin.Engine, cfg *config.QuerierConfig, generator *tracema
 	e.POST("/v1/trace_map", traceMap(cfg, generator, false))
 	e.POST("/v1/trace_map/sync", traceMap(cfg, generator, true))
 	e.POST("/v1/flow_map", flowMap(cfg, generator))
+	e.POST("/v1/trace_completeness", traceCompleteness())
+	e.POST("/v1/service_graph", serviceGraph())
 }
 
 func traceMap(cfg *config.QuerierConfig, generator *tracemap.TraceMapGenerator, synchronous bool) gin.HandlerFunc {
@@ -77,3 +83,41 @@ func flowMap(cfg *config.QuerierConfig, generator *tracemap.TraceMapGenerator) g
 		tracemap.FlowMap(args, cfg, c, generator)
 	})
 }
+
+func traceCompleteness() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var args model.TraceCompleteness
+
+		// 参数校验
+		err := c.ShouldBindBodyWith(&args, binding.JSON)
+		if err != nil {
+			router.BadRequestResponse(c, common.INVALID_POST_DATA, err.Error())
+			return
+		}
+		args.Context = c.Request.Context()
+		args.OrgID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+		result, err := completeness.TraceCompleteness(&args)
+		router.JsonResponse(c, result, nil, err)
+	})
+}
+
+func serviceGraph() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var args model.ServiceGraph
+
+		// 参数校验
+		err := c.ShouldBindBodyWith(&args, binding.JSON)
+		if err != nil {
+			router.BadRequestResponse(c, common.INVALID_POST_DATA, err.Error())
+			return
+		}
+		args.Context = c.Request.Context()
+		args.OrgID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+		result, err := servicegraph.ServiceGraph(&args)
+		if err == nil && args.Format == servicegraph.FORMAT_DOT {
+			c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(servicegraph.ToDot(result)))
+			return
+		}
+		router.JsonResponse(c, result, nil, err)
+	})
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package completeness
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/common"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+	querierCommon "github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+)
+
+var log = logging.MustGetLogger("distributed_tracing.completeness")
+
+const (
+	SIGNAL_SOURCE_PACKET = 0
+	SIGNAL_SOURCE_EBPF   = 3
+	SIGNAL_SOURCE_OTEL   = 4
+
+	SOURCE_PACKET     = "packet"
+	SOURCE_EBPF       = "ebpf"
+	SOURCE_OTEL       = "otel"
+	SOURCE_SKYWALKING = "skywalking"
+	SOURCE_DATADOG    = "datadog"
+	SOURCE_UNKNOWN    = "unknown"
+
+	REASON_OUT_OF_TIME_RANGE = "out_of_time_range"
+	REASON_ID_MISMATCH       = "id_mismatch"
+	REASON_NOT_FOUND         = "not_found"
+
+	// max spans of a trace to be analyzed
+	SPAN_LIMIT = 10000
+	// missing parents are searched again in the extended time range, to find out the spans arrived late
+	// or recorded by agents with skewed clocks, unit: second
+	OUT_OF_TIME_RANGE_SEARCH = 600
+
+	DATABASE_DEEPFLOW_ADMIN = "deepflow_admin"
+	// the counters of the logs dropped by the throttlers of ingester decoders, by org
+	TABLE_INGESTER_DECODER_THROTTLER = "deepflow_server.ingester_decoder_throttler"
+)
+
+// TraceCompleteness reports why the spans of a trace may be broken, it works on the raw spans in l7_flow_log,
+// not the trace_tree built by the ingester, so that the spans which are not linked into the tree are included.
+func TraceCompleteness(args *model.TraceCompleteness) (*model.TraceCompletenessResult, error) {
+	if strings.ContainsAny(args.TraceID, "'\\") {
+		return nil, querierCommon.NewError(querierCommon.INVALID_POST_DATA, fmt.Sprintf("invalid trace_id %s", args.TraceID))
+	}
+	if args.TimeStart > args.TimeEnd {
+		return nil, querierCommon.NewError(querierCommon.INVALID_POST_DATA, "time_start is later than time_end")
+	}
+	spans, err := querySpans(args, args.TimeStart, args.TimeEnd, "")
+	if err != nil {
+		return nil, err
+	}
+	result := analyze(args.TraceID, spans)
+
+	// search the not found parents in the extended time range
+	notFound := make([]string, 0, len(result.MissingParents))
+	for _, p := range result.MissingParents {
+		if p.Reason == REASON_NOT_FOUND {
+			notFound = append(notFound, fmt.Sprintf("'%s'", strings.ReplaceAll(p.ParentSpanID, "'", "")))
+		}
+	}
+	if len(notFound) > 0 {
+		filter := fmt.Sprintf("span_id IN (%s) AND (time<%d OR time>%d)", strings.Join(notFound, ","), args.TimeStart, args.TimeEnd)
+		outOfRangeSpans, err := querySpans(args, args.TimeStart-OUT_OF_TIME_RANGE_SEARCH, args.TimeEnd+OUT_OF_TIME_RANGE_SEARCH, filter)
+		if err != nil {
+			log.Warningf("search missing parents of trace %s failed: %s", args.TraceID, err)
+		}
+		found := make(map[string]*model.SpanBrief, len(outOfRangeSpans))
+		for _, s := range outOfRangeSpans {
+			found[s.SpanID] = s
+		}
+		for _, p := range result.MissingParents {
+			if s, ok := found[p.ParentSpanID]; ok && p.Reason == REASON_NOT_FOUND {
+				p.Reason = REASON_OUT_OF_TIME_RANGE
+				p.Candidate = s
+			}
+		}
+	}
+
+	// throttler drops are not fatal to the report, the trace may be queried by a server without the counters
+	result.ThrottlerDrops, err = queryThrottlerDrops(args)
+	if err != nil {
+		log.Warningf("query throttler drops failed: %s", err)
+		result.ThrottlerDrops = map[string]int64{}
+	}
+	return result, nil
+}
+
+func execute(args *model.TraceCompleteness, db, sql string) (*querierCommon.Result, error) {
+	querierArgs := querierCommon.QuerierParams{
+		DB:        db,
+		Sql:       sql,
+		Debug:     "false",
+		QueryUUID: uuid.New().String(),
+		Context:   args.Context,
+		ORGID:     args.OrgID,
+	}
+	ckEngine := &clickhouse.CHEngine{DB: querierArgs.DB, DataSource: querierArgs.DataSource}
+	ckEngine.Init()
+	result, debug, err := ckEngine.ExecuteQuery(&querierArgs)
+	if err != nil {
+		log.Errorf("%v %v", debug, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func querySpans(args *model.TraceCompleteness, timeStart, timeEnd int, filter string) ([]*model.SpanBrief, error) {
+	sql := fmt.Sprintf(
+		"SELECT toUnixTimestamp64Micro(start_time) AS start_time_us, toUnixTimestamp64Micro(end_time) AS end_time_us, "+
+			"signal_source, observation_point, agent_id, span_id, parent_span_id, app_service, endpoint, "+
+			"`attribute.telemetry.sdk.name` AS sdk_name FROM %s WHERE time>=%d AND time<=%d AND %s='%s'",
+		common.TABLE_L7_FLOW_LOG, timeStart, timeEnd, common.TAG_TRACE_ID, args.TraceID,
+	)
+	if filter != "" {
+		sql += " AND " + filter
+	}
+	sql += fmt.Sprintf(" ORDER BY start_time_us LIMIT %d", SPAN_LIMIT)
+	result, err := execute(args, common.DATABASE_FLOW_LOG, sql)
+	if err != nil {
+		return nil, err
+	}
+	spans := make([]*model.SpanBrief, 0, len(result.Values))
+	for _, v := range result.Values {
+		row := v.([]interface{})
+		spans = append(spans, &model.SpanBrief{
+			StartTimeUs:      toInt64(row[0]),
+			EndTimeUs:        toInt64(row[1]),
+			Source:           spanSource(toInt64(row[2]), toString(row[9])),
+			ObservationPoint: toString(row[3]),
+			AgentID:          int(toInt64(row[4])),
+			SpanID:           toString(row[5]),
+			ParentSpanID:     toString(row[6]),
+			AppService:       toString(row[7]),
+			Endpoint:         toString(row[8]),
+		})
+	}
+	return spans, nil
+}
+
+func queryThrottlerDrops(args *model.TraceCompleteness) (map[string]int64, error) {
+	orgID := querierCommon.DEFAULT_ORG_ID
+	if args.OrgID != "" {
+		id, err := strconv.Atoi(args.OrgID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid org id %s", args.OrgID)
+		}
+		orgID = strconv.Itoa(id)
+	}
+	sql := fmt.Sprintf(
+		"SELECT `tag.msg_type` AS msg_type, Sum(`metrics.drop_count`) AS drop_count FROM `%s` "+
+			"WHERE time>=%d AND time<=%d AND `tag.org_id`='%s' GROUP BY msg_type",
+		TABLE_INGESTER_DECODER_THROTTLER, args.TimeStart, args.TimeEnd, orgID,
+	)
+	result, err := execute(args, DATABASE_DEEPFLOW_ADMIN, sql)
+	if err != nil {
+		return nil, err
+	}
+	drops := map[string]int64{}
+	for _, v := range result.Values {
+		row := v.([]interface{})
+		drops[toString(row[0])] += toInt64(row[1])
+	}
+	return drops, nil
+}
+
+// spanSource distinguishes the third-party tracing spans by the sdk name, since they are all imported as OTel spans
+func spanSource(signalSource int64, sdkName string) string {
+	switch signalSource {
+	case SIGNAL_SOURCE_PACKET:
+		return SOURCE_PACKET
+	case SIGNAL_SOURCE_EBPF:
+		return SOURCE_EBPF
+	case SIGNAL_SOURCE_OTEL:
+		sdkName = strings.ToLower(sdkName)
+		if strings.Contains(sdkName, SOURCE_SKYWALKING) {
+			return SOURCE_SKYWALKING
+		} else if strings.Contains(sdkName, SOURCE_DATADOG) || strings.Contains(sdkName, "ddtrace") {
+			return SOURCE_DATADOG
+		}
+		return SOURCE_OTEL
+	}
+	return SOURCE_UNKNOWN
+}
+
+func isAppSpan(s *model.SpanBrief) bool {
+	return s.Source == SOURCE_OTEL || s.Source == SOURCE_SKYWALKING || s.Source == SOURCE_DATADOG
+}
+
+func isServerSide(s *model.SpanBrief) bool {
+	return strings.HasPrefix(s.ObservationPoint, "s")
+}
+
+// normalizeSpanID is used to find out the ids which are different only in the formats, such as
+// the letter case and the leading zeros
+func normalizeSpanID(id string) string {
+	return strings.TrimLeft(strings.ToLower(strings.ReplaceAll(id, "-", "")), "0")
+}
+
+func analyze(traceID string, spans []*model.SpanBrief) *model.TraceCompletenessResult {
+	result := &model.TraceCompletenessResult{
+		TraceID:            traceID,
+		SpanCount:          len(spans),
+		SpanSource:         map[string]int{},
+		MissingParents:     []*model.MissingParent{},
+		UninstrumentedHops: []*model.SpanBrief{},
+		ClockSkews:         []*model.ClockSkew{},
+	}
+	spansByID := map[string][]*model.SpanBrief{}
+	normalizedIDs := map[string]*model.SpanBrief{}
+	continued := map[string]bool{}
+	for _, s := range spans {
+		result.SpanSource[s.Source]++
+		if s.SpanID != "" {
+			spansByID[s.SpanID] = append(spansByID[s.SpanID], s)
+			normalizedIDs[normalizeSpanID(s.SpanID)] = s
+		}
+		if isAppSpan(s) && s.ParentSpanID != "" {
+			continued[s.ParentSpanID] = true
+		}
+	}
+
+	missing := map[string]*model.MissingParent{}
+	skews := map[[2]int]*model.ClockSkew{}
+	reported := map[string]bool{}
+	for _, s := range spans {
+		// the network spans of an uninstrumented server carry the span id of the caller, but no app span continues it
+		if !isAppSpan(s) && isServerSide(s) && s.SpanID != "" && !continued[s.SpanID] && !reported[s.SpanID] {
+			reported[s.SpanID] = true
+			result.UninstrumentedHops = append(result.UninstrumentedHops, s)
+		}
+		if s.ParentSpanID == "" {
+			continue
+		}
+		parents, ok := spansByID[s.ParentSpanID]
+		if !ok {
+			p, ok := missing[s.ParentSpanID]
+			if !ok {
+				p = &model.MissingParent{ParentSpanID: s.ParentSpanID, Reason: REASON_NOT_FOUND}
+				if candidate, ok := normalizedIDs[normalizeSpanID(s.ParentSpanID)]; ok {
+					p.Reason = REASON_ID_MISMATCH
+					p.Candidate = candidate
+				}
+				missing[s.ParentSpanID] = p
+				result.MissingParents = append(result.MissingParents, p)
+			}
+			p.Children = append(p.Children, s)
+			continue
+		}
+		for _, parent := range parents {
+			if parent.AgentID == s.AgentID || parent == s {
+				continue
+			}
+			addSpanPair(skews, parent, s)
+		}
+	}
+
+	for _, skew := range skews {
+		skew.Consistent = skew.MinOffsetUs <= skew.MaxOffsetUs
+		skew.EstimatedOffsetUs = (skew.MinOffsetUs + skew.MaxOffsetUs) / 2
+		result.ClockSkews = append(result.ClockSkews, skew)
+	}
+	sort.Slice(result.ClockSkews, func(i, j int) bool {
+		if result.ClockSkews[i].ParentAgentID != result.ClockSkews[j].ParentAgentID {
+			return result.ClockSkews[i].ParentAgentID < result.ClockSkews[j].ParentAgentID
+		}
+		return result.ClockSkews[i].ChildAgentID < result.ClockSkews[j].ChildAgentID
+	})
+	return result
+}
+
+// addSpanPair narrows the clock offset of the child agent by a parent-child span pair. if the clock of the child
+// agent is ahead by offset, the child span is contained by its parent when
+// `child.end - parent.end <= offset <= child.start - parent.start`
+func addSpanPair(skews map[[2]int]*model.ClockSkew, parent, child *model.SpanBrief) {
+	lower := child.EndTimeUs - parent.EndTimeUs
+	upper := child.StartTimeUs - parent.StartTimeUs
+	key := [2]int{parent.AgentID, child.AgentID}
+	skew, ok := skews[key]
+	if !ok {
+		skew = &model.ClockSkew{ParentAgentID: parent.AgentID, ChildAgentID: child.AgentID, MinOffsetUs: lower, MaxOffsetUs: upper}
+		skews[key] = skew
+	}
+	skew.SpanPairs++
+	if lower > 0 || upper < 0 {
+		skew.Violations++
+	}
+	if lower > skew.MinOffsetUs {
+		skew.MinOffsetUs = lower
+	}
+	if upper < skew.MaxOffsetUs {
+		skew.MaxOffsetUs = upper
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
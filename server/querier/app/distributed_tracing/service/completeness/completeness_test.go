@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package completeness
+
+import (
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+)
+
+func TestAnalyze(t *testing.T) {
+	spans := []*model.SpanBrief{
+		// client app span on agent 1
+		{Source: SOURCE_OTEL, AgentID: 1, ObservationPoint: "c-app", SpanID: "a1", StartTimeUs: 1000, EndTimeUs: 2000},
+		// server app span on agent 2, its clock is 300us ahead
+		{Source: SOURCE_OTEL, AgentID: 2, ObservationPoint: "s-app", SpanID: "b1", ParentSpanID: "a1", StartTimeUs: 1400, EndTimeUs: 2100},
+		// the server process on agent 3 is not instrumented
+		{Source: SOURCE_EBPF, AgentID: 3, ObservationPoint: "s-p", SpanID: "b1", StartTimeUs: 1500, EndTimeUs: 1600},
+		// parent id in different letter case
+		{Source: SOURCE_SKYWALKING, AgentID: 2, ObservationPoint: "s-app", SpanID: "c1", ParentSpanID: "A1", StartTimeUs: 1100, EndTimeUs: 1200},
+		// parent is lost
+		{Source: SOURCE_OTEL, AgentID: 2, ObservationPoint: "s-app", SpanID: "d1", ParentSpanID: "x1", StartTimeUs: 1100, EndTimeUs: 1200},
+	}
+	result := analyze("trace", spans)
+
+	if result.SpanCount != 5 || result.SpanSource[SOURCE_OTEL] != 3 || result.SpanSource[SOURCE_EBPF] != 1 || result.SpanSource[SOURCE_SKYWALKING] != 1 {
+		t.Errorf("unexpected span sources %v", result.SpanSource)
+	}
+	if len(result.MissingParents) != 2 {
+		t.Fatalf("got %d missing parents, want 2", len(result.MissingParents))
+	}
+	if p := result.MissingParents[0]; p.ParentSpanID != "A1" || p.Reason != REASON_ID_MISMATCH || p.Candidate.SpanID != "a1" {
+		t.Errorf("unexpected missing parent %+v", p)
+	}
+	if p := result.MissingParents[1]; p.ParentSpanID != "x1" || p.Reason != REASON_NOT_FOUND || len(p.Children) != 1 {
+		t.Errorf("unexpected missing parent %+v", p)
+	}
+	if len(result.UninstrumentedHops) != 1 || result.UninstrumentedHops[0].AgentID != 3 {
+		t.Errorf("unexpected uninstrumented hops %+v", result.UninstrumentedHops)
+	}
+	if len(result.ClockSkews) != 1 {
+		t.Fatalf("got %d clock skews, want 1", len(result.ClockSkews))
+	}
+	skew := result.ClockSkews[0]
+	if skew.ParentAgentID != 1 || skew.ChildAgentID != 2 || !skew.Consistent || skew.MinOffsetUs != 100 || skew.MaxOffsetUs != 400 || skew.Violations != 1 {
+		t.Errorf("unexpected clock skew %+v", skew)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicegraph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+)
+
+var nodeShapes = map[string]string{
+	KIND_SERVICE:       "box",
+	KIND_DATABASE:      "cylinder",
+	KIND_MESSAGE_QUEUE: "cds",
+	KIND_IP:            "ellipse",
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// ToDot renders the service graph in Graphviz DOT, edges are labeled with the request rate, error rate and p99 latency
+func ToDot(result *model.ServiceGraphResult) string {
+	var sb strings.Builder
+	sb.WriteString("digraph service_graph {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	if result.SampleRate > 1 {
+		fmt.Fprintf(&sb, "  label=%s;\n", quote(fmt.Sprintf("%d of %d traces are sampled at 1/%d, request rates are extrapolated", result.TraceCount, result.TotalTraceCount, result.SampleRate)))
+	}
+	for _, node := range result.Nodes {
+		shape, ok := nodeShapes[node.Kind]
+		if !ok {
+			shape = "box"
+		}
+		label := node.Name
+		if node.PodNS != "" {
+			label += "\n" + node.PodNS
+		}
+		fmt.Fprintf(&sb, "  %s [label=%s, shape=%s];\n", quote(node.ID), quote(label), shape)
+	}
+	for _, e := range result.Edges {
+		label := fmt.Sprintf("%.3f req/s\nerr %.2f%%\np99 %.0fus", e.RequestRate, e.ErrorRate*100, e.LatencyP99)
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s];\n", quote(e.Client), quote(e.Server), quote(label))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
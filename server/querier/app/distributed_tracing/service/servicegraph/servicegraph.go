@@ -0,0 +1,573 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicegraph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/libs/codec"
+	"github.com/deepflowio/deepflow/server/libs/tracetree"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/common"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+	querierCommon "github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+)
+
+var log = logging.MustGetLogger("distributed_tracing.servicegraph")
+
+const (
+	KIND_SERVICE       = "service"
+	KIND_DATABASE      = "database"
+	KIND_MESSAGE_QUEUE = "message_queue"
+	KIND_IP            = "ip"
+
+	FORMAT_JSON = "json"
+	FORMAT_DOT  = "dot"
+
+	TABLE_TRACE_TREE  = "trace_tree"
+	TABLE_L7_FLOW_LOG = "l7_flow_log"
+
+	DEFAULT_TRACE_LIMIT = 10000
+
+	// auto_service_type
+	AUTO_SERVICE_TYPE_INTERNET_IP = 0
+	AUTO_SERVICE_TYPE_POD_SERVICE = 11
+	AUTO_SERVICE_TYPE_REDIS       = 12
+	AUTO_SERVICE_TYPE_RDS         = 13
+	AUTO_SERVICE_TYPE_POD_GROUP   = 101
+	AUTO_SERVICE_TYPE_IP          = 255
+	// 130~137 are the pod groups of different workload kinds
+	AUTO_SERVICE_TYPE_WORKLOAD_MIN = 130
+	AUTO_SERVICE_TYPE_WORKLOAD_MAX = 137
+
+	// response_status
+	RESPONSE_STATUS_SUCCESS      = 0
+	RESPONSE_STATUS_SERVER_ERROR = 3
+	RESPONSE_STATUS_CLIENT_ERROR = 4
+)
+
+// ServiceGraph aggregates the trace trees built by the ingester into the dependencies between services,
+// each parent-child link of a trace tree is counted as a request from the parent node to the child node.
+func ServiceGraph(args *model.ServiceGraph) (*model.ServiceGraphResult, error) {
+	if args.TimeStart > args.TimeEnd {
+		return nil, querierCommon.NewError(querierCommon.INVALID_POST_DATA, "time_start is later than time_end")
+	}
+	if args.Format != "" && args.Format != FORMAT_JSON && args.Format != FORMAT_DOT {
+		return nil, querierCommon.NewError(querierCommon.INVALID_POST_DATA, fmt.Sprintf("unsupported format %s", args.Format))
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DEFAULT_TRACE_LIMIT
+	}
+
+	total, err := countTraceTrees(args)
+	if err != nil {
+		return nil, err
+	}
+	// the traces are sampled by the hash of trace_id if there are more trees than the limit, so that the
+	// sampled trees and the spans of them are uniform samples of the same traces with a known rate
+	sampleRate := 1
+	if total > limit {
+		sampleRate = (total + limit - 1) / limit
+	}
+	traceFilter := fmt.Sprintf("time>=%d AND time<=%d", args.TimeStart, args.TimeEnd)
+	if sampleRate > 1 {
+		traceFilter += fmt.Sprintf(" AND cityHash64(trace_id) %% %d = 0", sampleRate)
+	}
+
+	chClient := newClient(args, common.DATABASE_FLOW_LOG)
+	sql := fmt.Sprintf("SELECT encoded_span_list FROM %s.%s WHERE %s", common.DATABASE_FLOW_LOG, TABLE_TRACE_TREE, traceFilter)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: args.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	trees := make([]*tracetree.TraceTree, 0, len(rst.Values))
+	decoder := &codec.SimpleDecoder{}
+	for _, v := range rst.Values {
+		row := v.([]interface{})
+		data, _ := row[0].(string)
+		decoder.Init([]byte(data))
+		tree := &tracetree.TraceTree{}
+		if err := tree.Decode(decoder); err != nil {
+			// trees encoded by other versions are skipped
+			log.Debugf("decode trace tree failed: %s", err)
+			continue
+		}
+		trees = append(trees, tree)
+	}
+
+	result, spanEdges := aggregate(trees, args.TimeEnd-args.TimeStart+1)
+	extrapolate(result, sampleRate, total)
+	if err := fillLatencies(args, traceFilter, spanEdges); err != nil {
+		return nil, err
+	}
+	if err := fillNames(args, result.Nodes); err != nil {
+		return nil, err
+	}
+	filter(result, args.PodNSs, args.PodClusters)
+	return result, nil
+}
+
+func countTraceTrees(args *model.ServiceGraph) (int, error) {
+	chClient := newClient(args, common.DATABASE_FLOW_LOG)
+	sql := fmt.Sprintf(
+		"SELECT count() FROM %s.%s WHERE time>=%d AND time<=%d",
+		common.DATABASE_FLOW_LOG, TABLE_TRACE_TREE, args.TimeStart, args.TimeEnd,
+	)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: args.OrgID})
+	if err != nil {
+		return 0, err
+	}
+	if len(rst.Values) == 0 {
+		return 0, nil
+	}
+	row := rst.Values[0].([]interface{})
+	count, _ := row[0].(uint64)
+	return int(count), nil
+}
+
+// extrapolate scales the request rates of the sampled trees by the sample rate, the other stats are only of
+// the sampled trees
+func extrapolate(result *model.ServiceGraphResult, sampleRate, total int) {
+	result.SampleRate = sampleRate
+	result.TotalTraceCount = total
+	if sampleRate <= 1 {
+		return
+	}
+	for _, e := range result.Edges {
+		e.RequestRate *= float64(sampleRate)
+	}
+}
+
+// latencySQL calculates the latency percentiles of the edges on the durations of the spans in the sampled traces,
+// the spans are mapped to the edges by their client and server services
+func latencySQL(traceFilter string, spanEdges map[spanKey]int) string {
+	keys := make([]spanKey, 0, len(spanEdges))
+	for key := range spanEdges {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	keyValues := make([]string, 0, len(keys))
+	edgeValues := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyValues = append(keyValues, "'"+key.String()+"'")
+		// 0 is for the spans of no edge
+		edgeValues = append(edgeValues, strconv.Itoa(spanEdges[key]+1))
+	}
+	return fmt.Sprintf(
+		"SELECT transform(concat(toString(auto_service_type_0), '-', toString(auto_service_id_0), '-', "+
+			"toString(auto_service_type_1), '-', toString(auto_service_id_1)), [%s], [%s], 0) AS edge, "+
+			"quantiles(0.5, 0.9, 0.99)(response_duration) FROM %s.%s "+
+			"WHERE %s AND trace_id!='' AND response_duration>0 AND edge>0 GROUP BY edge",
+		strings.Join(keyValues, ","), strings.Join(edgeValues, ","), common.DATABASE_FLOW_LOG, TABLE_L7_FLOW_LOG, traceFilter,
+	)
+}
+
+// fillLatencies sets the latency percentiles of the edges, the percentiles of the edges whose spans are not
+// distinguishable from the ones of other edges are left 0
+func fillLatencies(args *model.ServiceGraph, traceFilter string, spanEdges map[*model.GraphEdge][]spanKey) error {
+	edges := []*model.GraphEdge{}
+	keyToEdge := map[spanKey]int{}
+	ambiguous := map[spanKey]bool{}
+	for e, keys := range spanEdges {
+		for _, key := range keys {
+			if _, ok := keyToEdge[key]; ok {
+				ambiguous[key] = true
+				continue
+			}
+			keyToEdge[key] = len(edges)
+		}
+		edges = append(edges, e)
+	}
+	// the spans of different edges between the same services can not be told apart
+	for key := range ambiguous {
+		delete(keyToEdge, key)
+	}
+	if len(keyToEdge) == 0 {
+		return nil
+	}
+
+	chClient := newClient(args, common.DATABASE_FLOW_LOG)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: latencySQL(traceFilter, keyToEdge), ORGID: args.OrgID})
+	if err != nil {
+		return err
+	}
+	for _, v := range rst.Values {
+		row := v.([]interface{})
+		index := int(toUint64(row[0])) - 1
+		quantiles, _ := row[1].([]float64)
+		if index < 0 || index >= len(edges) || len(quantiles) != 3 {
+			continue
+		}
+		e := edges[index]
+		e.LatencyP50, e.LatencyP90, e.LatencyP99 = quantiles[0], quantiles[1], quantiles[2]
+	}
+	return nil
+}
+
+func newClient(args *model.ServiceGraph, db string) *client.Client {
+	return &client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       db,
+		Context:  args.Context,
+	}
+}
+
+// spanKey is the client and server services of a span
+type spanKey struct {
+	autoServiceType0, autoServiceType1 uint8
+	autoServiceID0, autoServiceID1     uint32
+}
+
+func (k spanKey) String() string {
+	return fmt.Sprintf("%d-%d-%d-%d", k.autoServiceType0, k.autoServiceID0, k.autoServiceType1, k.autoServiceID1)
+}
+
+type edgeAggregator struct {
+	edge        *model.GraphEdge
+	durationSum uint64
+	spanKeys    map[spanKey]bool
+}
+
+func nodeKind(n *tracetree.TreeNode) string {
+	switch {
+	case n.Topic != "":
+		return KIND_MESSAGE_QUEUE
+	case n.NodeInfo.AutoServiceType == AUTO_SERVICE_TYPE_REDIS || n.NodeInfo.AutoServiceType == AUTO_SERVICE_TYPE_RDS:
+		return KIND_DATABASE
+	case isIPType(n.NodeInfo.AutoServiceType) && n.NodeInfo.AppService == "":
+		return KIND_IP
+	}
+	return KIND_SERVICE
+}
+
+func isIPType(t uint8) bool {
+	return t == AUTO_SERVICE_TYPE_INTERNET_IP || t == AUTO_SERVICE_TYPE_IP
+}
+
+func nodeIP(info *tracetree.NodeInfo) string {
+	if info.IsIPv4 {
+		return utils.IpFromUint32(info.IP4).String()
+	}
+	return info.IP6.String()
+}
+
+// nodeID identifies a service by auto_service and app_service, the nodes of message queues are split by topics,
+// and the nodes without auto_service are split by ips.
+func nodeID(n *tracetree.TreeNode) string {
+	info := &n.NodeInfo
+	id := fmt.Sprintf("%d-%d-%s", info.AutoServiceType, info.AutoServiceID, info.AppService)
+	if isIPType(info.AutoServiceType) {
+		id += "-" + nodeIP(info)
+	}
+	if n.Topic != "" {
+		id += "-" + n.Topic
+	}
+	return id
+}
+
+// aggregate returns the graph of the trees, and the services of the spans of each edge
+func aggregate(trees []*tracetree.TraceTree, duration int) (*model.ServiceGraphResult, map[*model.GraphEdge][]spanKey) {
+	nodes := map[string]*model.GraphNode{}
+	edges := map[[2]string]*edgeAggregator{}
+	for _, tree := range trees {
+		ids := make([]string, len(tree.TreeNodes))
+		for i := range tree.TreeNodes {
+			n := &tree.TreeNodes[i]
+			id := nodeID(n)
+			ids[i] = id
+			node, ok := nodes[id]
+			if !ok {
+				node = &model.GraphNode{
+					ID:              id,
+					Kind:            nodeKind(n),
+					AppService:      n.NodeInfo.AppService,
+					AutoServiceType: n.NodeInfo.AutoServiceType,
+					AutoServiceID:   n.NodeInfo.AutoServiceID,
+					Topic:           n.Topic,
+					Endpoints:       map[string]*model.GraphTraffic{},
+				}
+				if node.Kind == KIND_IP {
+					node.Name = nodeIP(&n.NodeInfo)
+				}
+				nodes[id] = node
+			}
+			addEndpoints(node, &n.NodeInfo)
+		}
+
+		for i := range tree.TreeNodes {
+			n := &tree.TreeNodes[i]
+			if n.ParentNodeIndex < 0 || int(n.ParentNodeIndex) >= len(ids) || int(n.ParentNodeIndex) == i {
+				continue
+			}
+			key := [2]string{ids[n.ParentNodeIndex], ids[i]}
+			agg, ok := edges[key]
+			if !ok {
+				agg = &edgeAggregator{edge: &model.GraphEdge{Client: key[0], Server: key[1]}, spanKeys: map[spanKey]bool{}}
+				edges[key] = agg
+			}
+			agg.edge.Request += uint64(n.Total)
+			agg.edge.Response += uint64(n.ResponseTotal)
+			agg.edge.ServerError += uint64(n.ResponseStatusServerErrorCount)
+			agg.edge.ClientError += uint64(n.ResponseStatusClientErrorCount)
+			agg.durationSum += n.ResponseDurationSum
+			for j := range n.UniqParentSpanInfos {
+				span := &n.UniqParentSpanInfos[j]
+				agg.spanKeys[spanKey{
+					autoServiceType0: span.AutoServiceType0, autoServiceType1: span.AutoServiceType1,
+					autoServiceID0: span.AutoServiceID0, autoServiceID1: span.AutoServiceID1,
+				}] = true
+			}
+		}
+	}
+
+	result := &model.ServiceGraphResult{
+		TraceCount: len(trees),
+		Nodes:      make([]*model.GraphNode, 0, len(nodes)),
+		Edges:      make([]*model.GraphEdge, 0, len(edges)),
+	}
+	for _, node := range nodes {
+		result.Nodes = append(result.Nodes, node)
+	}
+	spanEdges := make(map[*model.GraphEdge][]spanKey, len(edges))
+	for _, agg := range edges {
+		e := agg.edge
+		if duration > 0 {
+			e.RequestRate = float64(e.Request) / float64(duration)
+		}
+		if e.Request > 0 {
+			e.ErrorRate = float64(e.ServerError+e.ClientError) / float64(e.Request)
+		}
+		if e.Response > 0 {
+			e.LatencyAvg = float64(agg.durationSum) / float64(e.Response)
+		}
+		for key := range agg.spanKeys {
+			spanEdges[e] = append(spanEdges[e], key)
+		}
+		result.Edges = append(result.Edges, e)
+	}
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].ID < result.Nodes[j].ID })
+	sort.Slice(result.Edges, func(i, j int) bool {
+		if result.Edges[i].Client != result.Edges[j].Client {
+			return result.Edges[i].Client < result.Edges[j].Client
+		}
+		return result.Edges[i].Server < result.Edges[j].Server
+	})
+	return result, spanEdges
+}
+
+func addEndpoints(node *model.GraphNode, info *tracetree.NodeInfo) {
+	for i, endpoint := range info.Endpoints1 {
+		if endpoint == "" {
+			continue
+		}
+		traffic, ok := node.Endpoints[endpoint]
+		if !ok {
+			traffic = &model.GraphTraffic{}
+			node.Endpoints[endpoint] = traffic
+		}
+		// the stats are in the same order as the endpoints
+		if i >= len(info.EndpointStat1) {
+			continue
+		}
+		stat := &info.EndpointStat1[i]
+		traffic.Request += uint64(stat.Total)
+		switch stat.ResponseStatus {
+		case RESPONSE_STATUS_SUCCESS:
+			traffic.Response += uint64(stat.Total)
+		case RESPONSE_STATUS_SERVER_ERROR:
+			traffic.Response += uint64(stat.Total)
+			traffic.ServerError += uint64(stat.Total)
+		case RESPONSE_STATUS_CLIENT_ERROR:
+			traffic.Response += uint64(stat.Total)
+			traffic.ClientError += uint64(stat.Total)
+		}
+	}
+}
+
+func isPodGroupType(t uint8) bool {
+	return t == AUTO_SERVICE_TYPE_POD_GROUP || (t >= AUTO_SERVICE_TYPE_WORKLOAD_MIN && t <= AUTO_SERVICE_TYPE_WORKLOAD_MAX)
+}
+
+type deviceKey struct {
+	deviceType uint64
+	deviceID   uint64
+}
+
+type podInfo struct {
+	podNS, podCluster string
+}
+
+// fillNames translates the auto_services into names, and the k8s services into namespaces and clusters
+func fillNames(args *model.ServiceGraph, nodes []*model.GraphNode) error {
+	devices := []string{}
+	podServiceIDs := []string{}
+	podGroupIDs := []string{}
+	for _, node := range nodes {
+		if isIPType(node.AutoServiceType) {
+			continue
+		}
+		devices = append(devices, fmt.Sprintf("(%d,%d)", node.AutoServiceType, node.AutoServiceID))
+		if node.AutoServiceType == AUTO_SERVICE_TYPE_POD_SERVICE {
+			podServiceIDs = append(podServiceIDs, fmt.Sprint(node.AutoServiceID))
+		} else if isPodGroupType(node.AutoServiceType) {
+			podGroupIDs = append(podGroupIDs, fmt.Sprint(node.AutoServiceID))
+		}
+	}
+
+	chClient := newClient(args, "flow_tag")
+	names := map[deviceKey]string{}
+	if len(devices) > 0 {
+		sql := fmt.Sprintf(
+			"SELECT devicetype, deviceid, name FROM flow_tag.device_map WHERE (devicetype, deviceid) IN (%s)",
+			strings.Join(devices, ","),
+		)
+		rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: args.OrgID})
+		if err != nil {
+			return err
+		}
+		for _, v := range rst.Values {
+			row := v.([]interface{})
+			names[deviceKey{toUint64(row[0]), toUint64(row[1])}], _ = row[2].(string)
+		}
+	}
+	podServices, err := queryPodInfos(chClient, args.OrgID, "pod_service_map", podServiceIDs)
+	if err != nil {
+		return err
+	}
+	podGroups, err := queryPodInfos(chClient, args.OrgID, "pod_group_map", podGroupIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		var info podInfo
+		if node.AutoServiceType == AUTO_SERVICE_TYPE_POD_SERVICE {
+			info = podServices[uint64(node.AutoServiceID)]
+		} else if isPodGroupType(node.AutoServiceType) {
+			info = podGroups[uint64(node.AutoServiceID)]
+		}
+		node.PodNS, node.PodCluster = info.podNS, info.podCluster
+		if node.Name != "" {
+			continue
+		}
+		name := names[deviceKey{uint64(node.AutoServiceType), uint64(node.AutoServiceID)}]
+		if node.AppService != "" {
+			name = node.AppService
+		}
+		if node.Topic != "" {
+			name = node.Topic
+		}
+		if name == "" {
+			name = node.ID
+		}
+		node.Name = name
+	}
+	return nil
+}
+
+func queryPodInfos(chClient *client.Client, orgID, table string, ids []string) (map[uint64]podInfo, error) {
+	infos := map[uint64]podInfo{}
+	if len(ids) == 0 {
+		return infos, nil
+	}
+	sql := fmt.Sprintf(
+		"SELECT id, dictGet('flow_tag.pod_ns_map', 'name', (toUInt64(pod_ns_id))) AS pod_ns, "+
+			"dictGet('flow_tag.pod_cluster_map', 'name', (toUInt64(pod_cluster_id))) AS pod_cluster "+
+			"FROM flow_tag.%s WHERE id IN (%s)",
+		table, strings.Join(ids, ","),
+	)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: orgID})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rst.Values {
+		row := v.([]interface{})
+		podNS, _ := row[1].(string)
+		podCluster, _ := row[2].(string)
+		infos[toUint64(row[0])] = podInfo{podNS: podNS, podCluster: podCluster}
+	}
+	return infos, nil
+}
+
+// filter keeps the edges whose client or server is in the namespaces and clusters, and the nodes of these edges
+func filter(result *model.ServiceGraphResult, podNSs, podClusters []string) {
+	if len(podNSs) == 0 && len(podClusters) == 0 {
+		return
+	}
+	contains := func(values []string, v string) bool {
+		if len(values) == 0 {
+			return true
+		}
+		for _, value := range values {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	}
+	matched := map[string]bool{}
+	for _, node := range result.Nodes {
+		matched[node.ID] = contains(podNSs, node.PodNS) && contains(podClusters, node.PodCluster)
+	}
+
+	kept := map[string]bool{}
+	edges := result.Edges[:0]
+	for _, e := range result.Edges {
+		if matched[e.Client] || matched[e.Server] {
+			edges = append(edges, e)
+			kept[e.Client] = true
+			kept[e.Server] = true
+		}
+	}
+	result.Edges = edges
+	nodes := result.Nodes[:0]
+	for _, node := range result.Nodes {
+		if kept[node.ID] || matched[node.ID] {
+			nodes = append(nodes, node)
+		}
+	}
+	result.Nodes = nodes
+}
+
+func toUint64(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case uint32:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	case uint8:
+		return uint64(n)
+	case int64:
+		return uint64(n)
+	case int:
+		return uint64(n)
+	}
+	return 0
+}
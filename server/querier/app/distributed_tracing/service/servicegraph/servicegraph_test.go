@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicegraph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/libs/tracetree"
+	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/model"
+)
+
+func newTree(latencyUs uint64) *tracetree.TraceTree {
+	return &tracetree.TraceTree{
+		TreeNodes: []tracetree.TreeNode{
+			{
+				ParentNodeIndex: -1,
+				NodeInfo:        tracetree.NodeInfo{AutoServiceType: AUTO_SERVICE_TYPE_POD_SERVICE, AutoServiceID: 1},
+				Total:           1, ResponseTotal: 1,
+			},
+			{
+				ParentNodeIndex: 0,
+				UniqParentSpanInfos: []tracetree.SpanInfo{
+					{AutoServiceType0: AUTO_SERVICE_TYPE_POD_SERVICE, AutoServiceID0: 1, AutoServiceType1: AUTO_SERVICE_TYPE_POD_SERVICE, AutoServiceID1: 2},
+				},
+				NodeInfo: tracetree.NodeInfo{
+					AutoServiceType: AUTO_SERVICE_TYPE_POD_SERVICE, AutoServiceID: 2, AppService: "order",
+					Endpoints1:    []string{"/order"},
+					EndpointStat1: []tracetree.EndpointStats{{Total: 2, ResponseStatus: RESPONSE_STATUS_SERVER_ERROR}},
+				},
+				Total: 2, ResponseTotal: 2, ResponseStatusServerErrorCount: 1, ResponseDurationSum: 2 * latencyUs,
+			},
+			{
+				ParentNodeIndex: 1,
+				NodeInfo:        tracetree.NodeInfo{AutoServiceType: AUTO_SERVICE_TYPE_RDS, AutoServiceID: 3},
+				Total:           1, ResponseTotal: 1, ResponseDurationSum: 100,
+			},
+			{
+				ParentNodeIndex: 1,
+				NodeInfo:        tracetree.NodeInfo{AutoServiceType: AUTO_SERVICE_TYPE_IP, IsIPv4: true, IP4: 0x0a000001},
+				Topic:           "orders",
+				Total:           1, ResponseTotal: 1, ResponseDurationSum: 50,
+			},
+		},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	trees := []*tracetree.TraceTree{}
+	for i := uint64(1); i <= 100; i++ {
+		trees = append(trees, newTree(i*1000))
+	}
+	result, spanEdges := aggregate(trees, 100)
+
+	if result.TraceCount != 100 || len(result.Nodes) != 4 || len(result.Edges) != 3 {
+		t.Fatalf("got %d traces, %d nodes and %d edges", result.TraceCount, len(result.Nodes), len(result.Edges))
+	}
+	kinds := map[string]string{}
+	for _, n := range result.Nodes {
+		kinds[n.ID] = n.Kind
+	}
+	if kinds["13-3-"] != KIND_DATABASE || kinds["255-0--10.0.0.1-orders"] != KIND_MESSAGE_QUEUE || kinds["11-2-order"] != KIND_SERVICE {
+		t.Errorf("unexpected node kinds %v", kinds)
+	}
+
+	e := result.Edges[0]
+	if e.Client != "11-1-" || e.Server != "11-2-order" {
+		t.Fatalf("unexpected edge %s -> %s", e.Client, e.Server)
+	}
+	if e.Request != 200 || e.RequestRate != 2 || e.ServerError != 100 || e.ErrorRate != 0.5 {
+		t.Errorf("unexpected traffic %+v", e)
+	}
+	if e.LatencyAvg != 50500 {
+		t.Errorf("unexpected latency %+v", e)
+	}
+	if keys := spanEdges[e]; len(keys) != 1 || keys[0].String() != "11-1-11-2" {
+		t.Errorf("unexpected span keys %v", keys)
+	}
+	for _, n := range result.Nodes {
+		if n.ID == "11-2-order" {
+			if ep := n.Endpoints["/order"]; ep == nil || ep.Request != 200 || ep.ServerError != 200 {
+				t.Errorf("unexpected endpoints %+v", n.Endpoints)
+			}
+		}
+	}
+}
+
+func TestExtrapolate(t *testing.T) {
+	result := &model.ServiceGraphResult{
+		TraceCount: 100,
+		Edges:      []*model.GraphEdge{{RequestRate: 2}, {RequestRate: 0.5}},
+	}
+	extrapolate(result, 3, 250)
+	if result.SampleRate != 3 || result.TotalTraceCount != 250 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.Edges[0].RequestRate != 6 || result.Edges[1].RequestRate != 1.5 {
+		t.Errorf("unexpected request rates %v %v", result.Edges[0].RequestRate, result.Edges[1].RequestRate)
+	}
+}
+
+func TestLatencySQL(t *testing.T) {
+	sql := latencySQL("time>=1 AND time<=2 AND cityHash64(trace_id) % 3 = 0", map[spanKey]int{
+		{autoServiceType0: 11, autoServiceID0: 2, autoServiceType1: 13, autoServiceID1: 3}: 1,
+		{autoServiceType0: 11, autoServiceID0: 1, autoServiceType1: 11, autoServiceID1: 2}: 0,
+	})
+	for _, want := range []string{
+		"['11-1-11-2','11-2-13-3'], [1,2], 0) AS edge",
+		"quantiles(0.5, 0.9, 0.99)(response_duration) FROM flow_log.l7_flow_log",
+		"WHERE time>=1 AND time<=2 AND cityHash64(trace_id) % 3 = 0 AND trace_id!=''",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("%s not found in:\n%s", want, sql)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	result := &model.ServiceGraphResult{
+		Nodes: []*model.GraphNode{{ID: "a", PodNS: "ns1"}, {ID: "b", PodNS: "ns2"}, {ID: "c"}, {ID: "d", PodNS: "ns3"}},
+		Edges: []*model.GraphEdge{{Client: "a", Server: "b"}, {Client: "c", Server: "d"}},
+	}
+	filter(result, []string{"ns1"}, nil)
+	if len(result.Edges) != 1 || len(result.Nodes) != 2 || result.Nodes[1].ID != "b" {
+		t.Errorf("unexpected result %+v %+v", result.Nodes, result.Edges)
+	}
+}
+
+func TestToDot(t *testing.T) {
+	result := &model.ServiceGraphResult{
+		Nodes: []*model.GraphNode{{ID: "a", Name: `svc "a"`, Kind: KIND_SERVICE}, {ID: "b", Name: "mysql", Kind: KIND_DATABASE}},
+		Edges: []*model.GraphEdge{{Client: "a", Server: "b", RequestRate: 1.5, ErrorRate: 0.1, LatencyP99: 200}},
+	}
+	dot := ToDot(result)
+	for _, want := range []string{
+		`"a" [label="svc \"a\"", shape=box];`,
+		`"b" [label="mysql", shape=cylinder];`,
+		`"a" -> "b" [label="1.500 req/s\nerr 10.00%\np99 200us"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("%s not found in:\n%s", want, dot)
+		}
+	}
+}
@@ -17,15 +17,16 @@ package tracemap
 
 import (
 	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/tracetree"
 	"github.com/deepflowio/deepflow/server/querier/config"
 )
 
 type TraceMapGenerator struct {
-	sharedQueue *queue.OverwriteQueue
+	sharedQueue queue.TypedQueueWriter[*tracetree.TraceTree]
 	cfg         *config.QuerierConfig
 }
 
-func NewTraceMapGenerator(sharedQueue *queue.OverwriteQueue, cfg *config.QuerierConfig) *TraceMapGenerator {
+func NewTraceMapGenerator(sharedQueue queue.TypedQueueWriter[*tracetree.TraceTree], cfg *config.QuerierConfig) *TraceMapGenerator {
 	return &TraceMapGenerator{sharedQueue: sharedQueue, cfg: cfg}
 }
 
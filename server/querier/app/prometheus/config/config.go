@@ -28,6 +28,7 @@ type Prometheus struct {
 	ThanosReplicaLabels     []string        `yaml:"thanos-replica-labels"`
 	OperatorOffloading      bool            `default:"false" yaml:"operator-offloading"`
 	Cache                   PrometheusCache `yaml:"cache"`
+	Rules                   PrometheusRules `yaml:"rules"`
 }
 
 type PrometheusCache struct {
@@ -39,3 +40,15 @@ type PrometheusCache struct {
 	CacheCleanInterval int    `default:"3600" yaml:"cache-clean-interval"` // clean interval for cache, unit: s, default: 1h
 	CacheAllowTimeGap  int    `default:"1" yaml:"cache-allow-time-gap"`    // when query end time - cache end time <= allow gap: not update cache, unit: s, default: 1s
 }
+
+type PrometheusRules struct {
+	Enabled            bool     `default:"false" yaml:"enabled"`
+	Files              []string `yaml:"files"`                            // prometheus rule files, glob patterns are supported
+	OrgID              int      `default:"1" yaml:"org-id"`               // org of the rule queries and the recording results
+	EvaluationInterval int      `default:"60" yaml:"evaluation-interval"` // default evaluation interval of the rule groups, unit: s
+	ReloadInterval     int      `default:"60" yaml:"reload-interval"`     // interval for reloading the rule files, unit: s
+	AlertmanagerURLs   []string `yaml:"alertmanager-urls"`                // alerts are posted to these urls, like: http://alertmanager:9093/api/v2/alerts
+	NotifyTimeout      int      `default:"10" yaml:"notify-timeout"`      // timeout of posting alerts, unit: s
+	ResendDelay        int      `default:"60" yaml:"resend-delay"`        // minimum interval of resending firing alerts, unit: s
+	ExternalURL        string   `default:"" yaml:"external-url"`          // used in the generatorURL of alerts
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+type MetricMetadata struct {
+	// Type can be "counter", "gauge", "histogram", "gaugehistogram", "summary", "info", "stateset", "unknown".
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-target-metadata
+type TargetMetricMetadata struct {
+	Target labels.Labels `json:"target"`
+	Metric string        `json:"metric,omitempty"`
+	Type   string        `json:"type"`
+	Help   string        `json:"help"`
+	Unit   string        `json:"unit"`
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#build-information
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
@@ -55,6 +55,10 @@ type PromMetaParams struct {
 	StartTime   string
 	EndTime     string
 	LabelName   string
+	Metric      string
+	MatchTarget string
+	Limit       int
+	Matchers    []string
 	OrgID       string
 	BlockTeamID []string
 	Context     context.Context
@@ -68,6 +72,9 @@ type PromQueryStats struct {
 
 type errorType string
 
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#format-overview
+const ErrorTypeBadData errorType = "bad_data"
+
 type PromQueryWrapper struct {
 	OptStatus   string                     `json:"OPT_STATUS"`
 	Type        string                     `json:"TYPE"` // promql
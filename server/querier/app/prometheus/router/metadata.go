@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/model"
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/service"
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+func badData(c *gin.Context, err error) {
+	c.JSON(400, &model.PromQueryResponse{Error: err.Error(), ErrorType: model.ErrorTypeBadData, Status: _STATUS_FAIL})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#getting-label-names
+func promLabelNamesReader(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.PromMetaParams{
+			StartTime: c.Request.FormValue("start"),
+			EndTime:   c.Request.FormValue("end"),
+			Matchers:  c.Request.Form["match[]"],
+			Context:   c.Request.Context(),
+			OrgID:     c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		}
+		err := setRouterArgs(c.Request.FormValue("block-team-id"), &args.BlockTeamID, nil, splitStrings)
+		if err != nil {
+			badData(c, err)
+			return
+		}
+		// label names of series are got by `Series`, which should show tags
+		ctx := context.WithValue(c.Request.Context(), service.CtxKeyShowTag{}, true)
+		result, err := svc.PromLabelNamesService(&args, ctx)
+		if err != nil {
+			code, obj := handleError(err)
+			c.JSON(code, obj)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func promMetadataReader(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.PromMetaParams{
+			Metric:  c.Request.FormValue("metric"),
+			Context: c.Request.Context(),
+			OrgID:   c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		}
+		if err := setRouterArgs(c.Request.FormValue("limit"), &args.Limit, 0, strconv.Atoi); err != nil {
+			badData(c, err)
+			return
+		}
+		result, err := svc.PromMetadataService(&args, c.Request.Context())
+		if err != nil {
+			code, obj := handleError(err)
+			c.JSON(code, obj)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-target-metadata
+func promTargetsMetadataReader(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.PromMetaParams{
+			Metric:      c.Request.FormValue("metric"),
+			MatchTarget: c.Request.FormValue("match_target"),
+			Context:     c.Request.Context(),
+			OrgID:       c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		}
+		if err := setRouterArgs(c.Request.FormValue("limit"), &args.Limit, 0, strconv.Atoi); err != nil {
+			badData(c, err)
+			return
+		}
+		result, err := svc.PromTargetsMetadataService(&args, c.Request.Context())
+		if err != nil {
+			code, obj := handleError(err)
+			c.JSON(code, obj)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func promExemplarsQuery(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.PromQueryParams{
+			Promql:    c.Request.FormValue("query"),
+			StartTime: c.Request.FormValue("start"),
+			EndTime:   c.Request.FormValue("end"),
+			Context:   c.Request.Context(),
+			OrgID:     c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		}
+		result, err := svc.PromExemplarsQueryService(&args)
+		if err != nil {
+			badData(c, err)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#formatting-query-expressions
+func promFormatQuery(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		result, err := svc.PromFormatQueryService(c.Request.FormValue("query"))
+		if err != nil {
+			badData(c, err)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#build-information
+func promBuildInfo(svc *service.PrometheusService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.JSON(200, svc.PromBuildInfoService())
+	})
+}
@@ -18,18 +18,32 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	logging "github.com/op/go-logging"
 
 	"github.com/deepflowio/deepflow/server/querier/app/prometheus/router/packet_adapter"
 	"github.com/deepflowio/deepflow/server/querier/app/prometheus/service"
 	"github.com/deepflowio/deepflow/server/querier/config"
 )
 
-func PrometheusRouter(e *gin.Engine) {
+var log = logging.MustGetLogger("prometheus.router")
+
+func PrometheusRouter(e *gin.Engine, samplesQueue service.SamplesQueue) {
 	// only one instance during server lifetime
 	prometheusService := service.NewPrometheusService()
 	// Both SetRate and Acquire are expanded by 1000 times, making it suitable for small QPS scenarios.
 	prometheusService.QPSLeakyBucket.Init(uint64(config.Cfg.Prometheus.QPSLimit * 1000))
 
+	// recording and alerting rules, the results of recording rules are written into prometheus tables by samplesQueue
+	var ruleManager *service.RuleManager
+	if config.Cfg.Prometheus.Rules.Enabled {
+		var err error
+		if ruleManager, err = service.NewRuleManager(prometheusService, samplesQueue); err != nil {
+			log.Error(err)
+		} else {
+			ruleManager.Start()
+		}
+	}
+
 	// api router for prometheus
 	e.POST("/api/v1/prom/read", Limiter(prometheusService.QPSLeakyBucket), promReader(prometheusService))
 
@@ -44,6 +58,17 @@ func PrometheusRouter(e *gin.Engine) {
 		promGroup.GET("/api/v1/series", promSeriesReader(prometheusService))
 		promGroup.POST("/api/v1/series", promSeriesReader(prometheusService))
 		promGroup.GET("/api/v1/label/:labelName/values", promTagValuesReader(prometheusService))
+		promGroup.GET("/api/v1/labels", promLabelNamesReader(prometheusService))
+		promGroup.POST("/api/v1/labels", promLabelNamesReader(prometheusService))
+		promGroup.GET("/api/v1/metadata", promMetadataReader(prometheusService))
+		promGroup.GET("/api/v1/targets/metadata", promTargetsMetadataReader(prometheusService))
+		promGroup.GET("/api/v1/query_exemplars", promExemplarsQuery(prometheusService))
+		promGroup.POST("/api/v1/query_exemplars", promExemplarsQuery(prometheusService))
+		promGroup.GET("/api/v1/format_query", promFormatQuery(prometheusService))
+		promGroup.POST("/api/v1/format_query", promFormatQuery(prometheusService))
+		promGroup.GET("/api/v1/status/buildinfo", promBuildInfo(prometheusService))
+		promGroup.GET("/api/v1/rules", promRules(ruleManager))
+		promGroup.GET("/api/v1/alerts", promAlerts(ruleManager))
 
 		// not use "/prom/api/v1/adapter/:name", suitable for map[rouer key]counter in statsd
 		for _, v := range []string{"label", "query_range", "query", "series"} {
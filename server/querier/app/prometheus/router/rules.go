@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/model"
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/service"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+// set in the requests forwarded to the master, to avoid forwarding again during the master switching
+const headerKeyRuleForwarded = "X-Deepflow-Rule-Forwarded"
+
+// forwardToMaster forwards the request to the server which evaluates the rules, returns false if this server is the master
+func forwardToMaster(c *gin.Context, m *service.RuleManager) bool {
+	isMaster, masterIP := m.IsMaster()
+	if isMaster || masterIP == "" || c.Request.Header.Get(headerKeyRuleForwarded) != "" {
+		return false
+	}
+	url := fmt.Sprintf("http://%s:%d%s", masterIP, config.Cfg.ListenPort, c.Request.URL.RequestURI())
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		c.JSON(500, &model.PromQueryResponse{Error: err.Error(), Status: _STATUS_FAIL})
+		return true
+	}
+	req.Header.Set(headerKeyRuleForwarded, "true")
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		c.JSON(500, &model.PromQueryResponse{Error: err.Error(), Status: _STATUS_FAIL})
+		return true
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	return true
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#rules
+func promRules(m *service.RuleManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if m == nil {
+			c.JSON(200, &model.PromQueryResponse{Status: _STATUS_SUCCESS, Data: &model.RuleDiscovery{RuleGroups: []*model.RuleGroup{}}})
+			return
+		}
+		if forwardToMaster(c, m) {
+			return
+		}
+		result, err := m.Rules(c.Request.FormValue("type"))
+		if err != nil {
+			c.JSON(400, &model.PromQueryResponse{Error: err.Error(), Status: _STATUS_FAIL})
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#alerts
+func promAlerts(m *service.RuleManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if m == nil {
+			c.JSON(200, &model.PromQueryResponse{Status: _STATUS_SUCCESS, Data: &model.AlertDiscovery{Alerts: []*model.Alert{}}})
+			return
+		}
+		if forwardToMaster(c, m) {
+			return
+		}
+		result, err := m.Alerts()
+		if err != nil {
+			code, obj := handleError(err)
+			c.JSON(code, obj)
+			return
+		}
+		c.JSON(200, result)
+	})
+}
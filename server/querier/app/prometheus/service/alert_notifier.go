@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+// alerts waiting to be sent, the new alerts are dropped if the alertmanagers are too slow
+const alertQueueSize = 1024
+
+// alertmanagerAlert is the alert format of alertmanager api v2
+// API Spec: https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// alertNotifier posts the firing and resolved alerts to alertmanager compatible webhooks
+type alertNotifier struct {
+	urls   []string
+	client *http.Client
+	queue  chan []alertmanagerAlert
+}
+
+func newAlertNotifier(urls []string, timeout time.Duration) *alertNotifier {
+	return &alertNotifier{
+		urls:   urls,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan []alertmanagerAlert, alertQueueSize),
+	}
+}
+
+func (n *alertNotifier) start() {
+	if len(n.urls) == 0 {
+		return
+	}
+	go func() {
+		for alerts := range n.queue {
+			body, err := json.Marshal(alerts)
+			if err != nil {
+				log.Errorf("marshal alerts failed: %s", err)
+				continue
+			}
+			for _, url := range n.urls {
+				if err := n.post(url, body); err != nil {
+					log.Warningf("send %d alerts to %s failed: %s", len(alerts), url, err)
+				}
+			}
+		}
+	}()
+}
+
+func (n *alertNotifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("bad response status %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyFunc converts the alerts as prometheus does, ref: https://github.com/prometheus/prometheus/blob/main/cmd/prometheus/main.go
+func (n *alertNotifier) notifyFunc(externalURL string) rules.NotifyFunc {
+	return func(ctx context.Context, expr string, alerts ...*rules.Alert) {
+		if len(n.urls) == 0 || len(alerts) == 0 {
+			return
+		}
+		res := make([]alertmanagerAlert, 0, len(alerts))
+		for _, alert := range alerts {
+			a := alertmanagerAlert{
+				Labels:       alert.Labels.Map(),
+				Annotations:  alert.Annotations.Map(),
+				StartsAt:     alert.FiredAt,
+				GeneratorURL: externalURL + strutil.TableLinkForExpression(expr),
+			}
+			if !alert.ResolvedAt.IsZero() {
+				a.EndsAt = alert.ResolvedAt
+			} else {
+				a.EndsAt = alert.ValidUntil
+			}
+			res = append(res, a)
+		}
+		select {
+		case n.queue <- res:
+		default:
+			log.Warningf("alert queue is full, drop %d alerts", len(res))
+		}
+	}
+}
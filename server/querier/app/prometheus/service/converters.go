@@ -405,6 +405,24 @@ func (p *prometheusReader) promReaderTransToSQL(ctx context.Context, req *prompb
 		filters = append(filters, fmt.Sprintf("team_id not in (%s)", strings.Join(p.blockTeamID, ",")))
 	}
 
+	// range query of prometheus/ext_metrics uses the coarsest rollup which still keeps a point in every step and range
+	if dataPrecision == "" && q.Hints != nil && q.Hints.StepMs > 0 && (db == "" || db == chCommon.DB_NAME_PROMETHEUS || db == chCommon.DB_NAME_EXT_METRICS) {
+		maxInterval := q.Hints.StepMs
+		if q.Hints.RangeMs > 0 && q.Hints.RangeMs < maxInterval {
+			maxInterval = q.Hints.RangeMs
+		}
+		rollupDB := db
+		if rollupDB == "" {
+			rollupDB = chCommon.DB_NAME_PROMETHEUS
+		}
+		dataPrecision, err = chCommon.GetRollupDatasource(rollupDB, int(maxInterval/1e3), p.orgID)
+		if err != nil {
+			// fallback to the original data
+			log.Warningf("get rollup datasource of %s failed: %s", rollupDB, err)
+			dataPrecision, err = "", nil
+		}
+	}
+
 	sql := parseToQuerierSQL(ctx, db, table, metricsArray, filters, groupBy, orderBy)
 	return ctx, sql, db, dataPrecision, queryMetric, err
 }
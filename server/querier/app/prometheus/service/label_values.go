@@ -45,6 +45,16 @@ func (p *prometheusExecutor) getTagValues(ctx context.Context, args *model.PromM
 }
 
 func getMetrics(ctx context.Context, args *model.PromMetaParams) (resp []string) {
+	resp = []string{}
+	rangeMetrics(ctx, args, func(metricName string, m *metrics.Metrics) {
+		resp = append(resp, metricName)
+	})
+	return resp
+}
+
+// rangeMetrics calls f with each metric name which could be queried by promql, m is the description
+// of the metric, it is nil for the prometheus metrics.
+func rangeMetrics(ctx context.Context, args *model.PromMetaParams, f func(metricName string, m *metrics.Metrics)) {
 	// We speed up the return of the metrics list by querying the aggregation information in
 	// `flow_tag.ext_metrics_custom_field_value`. Since we do not query the original time series
 	// data, filtering metrics by time is currently not supported.
@@ -60,14 +70,13 @@ func getMetrics(ctx context.Context, args *model.PromMetaParams) (resp []string)
 	//	where = fmt.Sprintf("time<=%s", args.EndTime)
 	//}
 
-	resp = []string{}
 	for db, tables := range chCommon.DB_TABLE_MAP {
 		if db == chCommon.DB_NAME_EXT_METRICS {
 			extMetrics, _ := metrics.GetExtMetrics(chCommon.DB_NAME_EXT_METRICS, "", where, "", args.OrgID, false, args.Context)
 			for _, v := range extMetrics {
 				// append telegraf metrics, e.g.: influxdb_internal_statsd__tcp_current_connections[influxdb_target__metric]
 				metricName := fmt.Sprintf("%s__%s__%s__%s", db, "metrics", strings.Replace(v.Table, ".", "_", 1), strings.TrimPrefix(v.DisplayName, "metrics."))
-				resp = append(resp, metricName)
+				f(metricName, v)
 			}
 		} else if db == chCommon.DB_NAME_PROMETHEUS {
 			// prometheus samples should get all metrcis from `table`
@@ -75,16 +84,16 @@ func getMetrics(ctx context.Context, args *model.PromMetaParams) (resp []string)
 			for _, v := range samples.Values {
 				tableName := v.([]interface{})[0].(string)
 				// append ${metrics_name}
-				resp = append(resp, tableName)
+				f(tableName, nil)
 				// append prometheus__samples__${metrics_name}
 				metricsName := fmt.Sprintf("%s__%s__%s", db, TABLE_NAME_SAMPLES, tableName)
-				resp = append(resp, metricsName)
+				f(metricsName, nil)
 			}
 		} else if db == chCommon.DB_NAME_DEEPFLOW_ADMIN || db == chCommon.DB_NAME_DEEPFLOW_TENANT {
 			deepflowSystem, _ := metrics.GetExtMetrics(db, "", where, "", args.OrgID, false, args.Context)
 			for _, v := range deepflowSystem {
 				metricName := fmt.Sprintf("%s__%s__%s", db, strings.ReplaceAll(v.Table, ".", "_"), strings.TrimPrefix(v.DisplayName, "metrics."))
-				resp = append(resp, metricName)
+				f(metricName, v)
 			}
 		} else {
 			for _, table := range tables {
@@ -96,19 +105,14 @@ func getMetrics(ctx context.Context, args *model.PromMetaParams) (resp []string)
 					if (db == chCommon.DB_NAME_DEEPFLOW_ADMIN || db == chCommon.DB_NAME_DEEPFLOW_TENANT) || (table == TABLE_NAME_L7_FLOW_LOG && strings.Contains(field, "metrics.")) {
 						field = v.DisplayName
 					}
-					metricsName := ""
 					if db == chCommon.DB_NAME_FLOW_METRICS {
-						metricsName = fmt.Sprintf("%s__%s__%s__%s", db, table, field, "1m")
-						resp = append(resp, metricsName)
-						metricsName = fmt.Sprintf("%s__%s__%s__%s", db, table, field, "1s")
-						resp = append(resp, metricsName)
+						f(fmt.Sprintf("%s__%s__%s__%s", db, table, field, "1m"), v)
+						f(fmt.Sprintf("%s__%s__%s__%s", db, table, field, "1s"), v)
 					} else {
-						metricsName = fmt.Sprintf("%s__%s__%s", db, table, field)
-						resp = append(resp, metricsName)
+						f(fmt.Sprintf("%s__%s__%s", db, table, field), v)
 					}
 				}
 			}
 		}
 	}
-	return resp
 }
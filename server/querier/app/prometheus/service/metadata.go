@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/deepflowio/deepflow/server/controller/report"
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/model"
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/metrics"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/trans_prometheus"
+)
+
+const (
+	// the version of prometheus http api which the querier is compatible with, clients like grafana
+	// choose the supported features by this version
+	prometheusCompatibleVersion = "2.36.2"
+
+	METRIC_TYPE_COUNTER = "counter"
+	METRIC_TYPE_GAUGE   = "gauge"
+	METRIC_TYPE_UNKNOWN = "unknown"
+)
+
+// prometheus metrics written by remote write don't carry metadata, guess the type by the naming conventions
+// ref: https://prometheus.io/docs/practices/naming/#metric-names
+var counterMetricSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+func orgPrometheusMap(orgID string) trans_prometheus.PrometheusMap {
+	if orgID == "" {
+		orgID = common.DEFAULT_ORG_ID
+	}
+	return trans_prometheus.ORGPrometheus[orgID]
+}
+
+func prometheusMetricType(metricName string) string {
+	for _, suffix := range counterMetricSuffixes {
+		if strings.HasSuffix(metricName, suffix) {
+			return METRIC_TYPE_COUNTER
+		}
+	}
+	return METRIC_TYPE_UNKNOWN
+}
+
+func metricMetadata(metricName string, m *metrics.Metrics) model.MetricMetadata {
+	if m == nil {
+		return model.MetricMetadata{Type: prometheusMetricType(metricName)}
+	}
+	metadata := model.MetricMetadata{Type: METRIC_TYPE_UNKNOWN, Help: m.Description, Unit: m.Unit}
+	if metadata.Help == "" {
+		metadata.Help = m.DisplayName
+	}
+	switch m.Type {
+	case metrics.METRICS_TYPE_COUNTER:
+		metadata.Type = METRIC_TYPE_COUNTER
+	case metrics.METRICS_TYPE_GAUGE, metrics.METRICS_TYPE_BOUNDED_GAUGE, metrics.METRICS_TYPE_DELAY,
+		metrics.METRICS_TYPE_PERCENTAGE, metrics.METRICS_TYPE_QUOTIENT:
+		metadata.Type = METRIC_TYPE_GAUGE
+	}
+	return metadata
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#getting-label-names
+func (p *prometheusExecutor) labelNames(ctx context.Context, args *model.PromMetaParams) (*model.PromQueryResponse, error) {
+	names := map[string]struct{}{LABEL_NAME_METRICS: {}}
+	if len(args.Matchers) == 0 {
+		// without matchers, get all label names from the cache of `flow_tag.prometheus_label_name_map`
+		for name := range orgPrometheusMap(args.OrgID).LabelNameToID {
+			names[name] = struct{}{}
+		}
+	} else {
+		seriesArgs := &model.PromQueryParams{
+			StartTime:   args.StartTime,
+			EndTime:     args.EndTime,
+			Matchers:    args.Matchers,
+			OrgID:       args.OrgID,
+			BlockTeamID: args.BlockTeamID,
+			Context:     ctx,
+		}
+		if seriesArgs.EndTime == "" {
+			seriesArgs.EndTime = fmt.Sprintf("%d", time.Now().Unix())
+		}
+		if seriesArgs.StartTime == "" {
+			end, err := parseTime(seriesArgs.EndTime)
+			if err != nil {
+				return nil, err
+			}
+			seriesArgs.StartTime = fmt.Sprintf("%d", end.Add(-defaultLookbackDelta).Unix())
+		}
+		result, err := p.series(ctx, seriesArgs)
+		if err != nil {
+			return nil, err
+		}
+		for _, series := range result.Data.([]labels.Labels) {
+			for _, l := range series {
+				names[l.Name] = struct{}{}
+			}
+		}
+	}
+	data := make([]string, 0, len(names))
+	for name := range names {
+		data = append(data, name)
+	}
+	sort.Strings(data)
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: data}, nil
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func (p *prometheusExecutor) metadata(ctx context.Context, args *model.PromMetaParams) (*model.PromQueryResponse, error) {
+	data := map[string][]model.MetricMetadata{}
+	rangeMetrics(ctx, args, func(metricName string, m *metrics.Metrics) {
+		if args.Metric != "" && args.Metric != metricName {
+			return
+		}
+		if args.Limit > 0 && len(data) >= args.Limit {
+			return
+		}
+		data[metricName] = []model.MetricMetadata{metricMetadata(metricName, m)}
+	})
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: data}, nil
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-target-metadata
+func (p *prometheusExecutor) targetsMetadata(ctx context.Context, args *model.PromMetaParams) (*model.PromQueryResponse, error) {
+	var targetMatchers []*labels.Matcher
+	if args.MatchTarget != "" {
+		var err error
+		if targetMatchers, err = parser.ParseMetricSelector(args.MatchTarget); err != nil {
+			return nil, err
+		}
+	}
+	data := []model.TargetMetricMetadata{}
+	prometheusMap := orgPrometheusMap(args.OrgID)
+	metricIDToName := make(map[uint64]string, len(prometheusMap.MetricNameToID))
+	for name, id := range prometheusMap.MetricNameToID {
+		metricIDToName[id] = name
+	}
+
+	chClient := client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       "flow_tag",
+		Context:  ctx,
+	}
+	targetSql := "SELECT target_id, target_label_names, target_label_values FROM flow_tag.prometheus_target_label_layout_map"
+	targetRst, err := chClient.DoQuery(&client.QueryParams{Sql: targetSql, ORGID: args.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[uint64]labels.Labels, len(targetRst.Values))
+	for _, v := range targetRst.Values {
+		row := v.([]interface{})
+		names := strings.Split(row[1].(string), ", ")
+		values := strings.Split(row[2].(string), ", ")
+		if len(names) != len(values) {
+			continue
+		}
+		ls := make([]labels.Label, 0, len(names))
+		for i := range names {
+			ls = append(ls, labels.Label{Name: names[i], Value: values[i]})
+		}
+		target := labels.New(ls...)
+		matched := true
+		for _, m := range targetMatchers {
+			if !m.Matches(target.Get(m.Name)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			targets[row[0].(uint64)] = target
+		}
+	}
+
+	metricTargetSql := "SELECT DISTINCT metric_id, target_id FROM flow_tag.target_label_map"
+	if args.Metric != "" {
+		metricID, ok := prometheusMap.MetricNameToID[args.Metric]
+		if !ok {
+			return &model.PromQueryResponse{Status: _SUCCESS, Data: data}, nil
+		}
+		metricTargetSql += fmt.Sprintf(" WHERE metric_id=%d", metricID)
+	}
+	metricTargetSql += " ORDER BY target_id, metric_id"
+	metricTargetRst, err := chClient.DoQuery(&client.QueryParams{Sql: metricTargetSql, ORGID: args.OrgID})
+	if err != nil {
+		return nil, err
+	}
+	// limit is the max number of targets
+	matchedTargets := map[uint64]struct{}{}
+	for _, v := range metricTargetRst.Values {
+		row := v.([]interface{})
+		metricName, ok := metricIDToName[row[0].(uint64)]
+		if !ok {
+			continue
+		}
+		targetID := row[1].(uint64)
+		target, ok := targets[targetID]
+		if !ok {
+			continue
+		}
+		if _, ok := matchedTargets[targetID]; !ok {
+			if args.Limit > 0 && len(matchedTargets) >= args.Limit {
+				break
+			}
+			matchedTargets[targetID] = struct{}{}
+		}
+		metadata := model.TargetMetricMetadata{Target: target, Type: prometheusMetricType(metricName)}
+		// metric name is omitted when querying with `metric`, same as prometheus
+		if args.Metric == "" {
+			metadata.Metric = metricName
+		}
+		data = append(data, metadata)
+	}
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: data}, nil
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func (p *prometheusExecutor) queryExemplars(args *model.PromQueryParams) (*model.PromQueryResponse, error) {
+	if _, err := parser.ParseExpr(args.Promql); err != nil {
+		return nil, err
+	}
+	// exemplars are dropped by the ingester, so the result is always empty
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: []interface{}{}}, nil
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#formatting-query-expressions
+func (p *prometheusExecutor) formatQuery(query string) (*model.PromQueryResponse, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: expr.String()}, nil
+}
+
+// API Spec: https://prometheus.io/docs/prometheus/latest/querying/api/#build-information
+func (p *prometheusExecutor) buildInfo() *model.PromQueryResponse {
+	branch, _, commitID := report.GetServerInfo()
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: &model.BuildInfo{
+		Version:   prometheusCompatibleVersion,
+		Revision:  commitID,
+		Branch:    branch,
+		BuildUser: "deepflow",
+		GoVersion: runtime.Version(),
+	}}
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/metrics"
+)
+
+func TestMetricMetadata(t *testing.T) {
+	assert.Equal(t, METRIC_TYPE_COUNTER, metricMetadata("http_requests_total", nil).Type)
+	assert.Equal(t, METRIC_TYPE_COUNTER, metricMetadata("http_request_duration_seconds_bucket", nil).Type)
+	assert.Equal(t, METRIC_TYPE_UNKNOWN, metricMetadata("node_memory_MemFree_bytes", nil).Type)
+
+	m := &metrics.Metrics{DisplayName: "Bytes", Unit: "Byte", Type: metrics.METRICS_TYPE_COUNTER}
+	assert.Equal(t, "counter", metricMetadata("flow_metrics__network__byte__1m", m).Type)
+	assert.Equal(t, "Bytes", metricMetadata("flow_metrics__network__byte__1m", m).Help)
+	m = &metrics.Metrics{DisplayName: "RTT", Description: "Round trip time", Unit: "us", Type: metrics.METRICS_TYPE_DELAY}
+	assert.Equal(t, "gauge", metricMetadata("flow_metrics__network__rtt__1m", m).Type)
+	assert.Equal(t, "Round trip time", metricMetadata("flow_metrics__network__rtt__1m", m).Help)
+}
+
+func TestFormatQuery(t *testing.T) {
+	p := &prometheusExecutor{}
+	result, err := p.formatQuery(`sum by(job)(rate(http_requests_total{job="api"}[5m]))`)
+	assert.Nil(t, err)
+	assert.Equal(t, `sum by(job) (rate(http_requests_total{job="api"}[5m]))`, result.Data)
+
+	_, err = p.formatQuery(`sum(`)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/deepflowio/deepflow/server/controller/election"
+	"github.com/deepflowio/deepflow/server/querier/app/prometheus/model"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+const (
+	// same as the defaults in prometheus
+	ruleOutageTolerance = time.Hour
+	ruleForGracePeriod  = 10 * time.Minute
+)
+
+// RuleManager evaluates prometheus recording and alerting rules with the promql engine of PrometheusService,
+// only the server of the master controller evaluates the rules, so that each rule is evaluated once.
+type RuleManager struct {
+	svc         *PrometheusService
+	appendable  *ruleAppendable
+	notifier    *alertNotifier
+	externalURL *url.URL
+
+	// manager is nil when the server is not the master
+	manager *rules.Manager
+	cancel  context.CancelFunc
+	lock    sync.RWMutex
+}
+
+func NewRuleManager(svc *PrometheusService, samplesQueue SamplesQueue) (*RuleManager, error) {
+	cfg := &config.Cfg.Prometheus.Rules
+	externalURL, err := url.Parse(cfg.ExternalURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prometheus rules external-url (%s): %s", cfg.ExternalURL, err)
+	}
+	return &RuleManager{
+		svc:         svc,
+		appendable:  newRuleAppendable(uint16(cfg.OrgID), samplesQueue),
+		notifier:    newAlertNotifier(cfg.AlertmanagerURLs, time.Duration(cfg.NotifyTimeout)*time.Second),
+		externalURL: externalURL,
+	}, nil
+}
+
+func (m *RuleManager) Start() {
+	m.notifier.start()
+	go m.run()
+}
+
+func (m *RuleManager) run() {
+	ticker := time.NewTicker(time.Duration(config.Cfg.Prometheus.Rules.ReloadInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if isMaster, _ := election.IsMasterController(); isMaster {
+			m.startManager()
+			m.reload()
+		} else {
+			m.stopManager()
+		}
+		<-ticker.C
+	}
+}
+
+// IsMaster returns whether the rules are evaluated in this server, and the ip of the master if not
+func (m *RuleManager) IsMaster() (bool, string) {
+	isMaster, masterIP, err := election.IsMasterControllerAndReturnIP()
+	if err != nil {
+		return false, ""
+	}
+	return isMaster, masterIP
+}
+
+func (m *RuleManager) queryFunc(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+	args := &model.PromQueryParams{
+		Promql:    q,
+		StartTime: strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64),
+		EndTime:   strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64),
+		Slimit:    config.Cfg.Prometheus.SeriesLimit,
+		OrgID:     strconv.Itoa(config.Cfg.Prometheus.Rules.OrgID),
+		Context:   ctx,
+	}
+	result, err := m.svc.PromInstantQueryService(args, ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := result.Data.(*model.PromQueryData)
+	if !ok {
+		return nil, fmt.Errorf("rule query (%s) got unexpected result", q)
+	}
+	switch v := data.Result.(type) {
+	case promql.Vector:
+		return v, nil
+	case promql.Scalar:
+		return promql.Vector{promql.Sample{
+			Point:  promql.Point{T: v.T, V: v.V},
+			Metric: labels.Labels{},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("rule result is not a vector or scalar")
+	}
+}
+
+func (m *RuleManager) startManager() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.manager != nil {
+		return
+	}
+	cfg := &config.Cfg.Prometheus.Rules
+	ctx, cancel := context.WithCancel(context.Background())
+	m.manager = rules.NewManager(&rules.ManagerOptions{
+		ExternalURL: m.externalURL,
+		QueryFunc:   m.queryFunc,
+		NotifyFunc:  m.notifier.notifyFunc(m.externalURL.String()),
+		Context:     ctx,
+		Appendable:  m.appendable,
+		// the for state of alerts (ALERTS_FOR_STATE) is not restored from the database
+		Queryable: storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+			return storage.NoopQuerier(), nil
+		}),
+		Logger:          newPrometheusLogger(),
+		OutageTolerance: ruleOutageTolerance,
+		ForGracePeriod:  ruleForGracePeriod,
+		ResendDelay:     time.Duration(cfg.ResendDelay) * time.Second,
+	})
+	m.cancel = cancel
+	go m.manager.Run()
+	log.Info("prometheus rule manager started")
+}
+
+func (m *RuleManager) stopManager() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.manager == nil {
+		return
+	}
+	m.manager.Stop()
+	m.cancel()
+	m.manager = nil
+	log.Info("prometheus rule manager stopped, the server is not master")
+}
+
+func (m *RuleManager) reload() {
+	cfg := &config.Cfg.Prometheus.Rules
+	var files []string
+	for _, pattern := range cfg.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Errorf("invalid prometheus rule file pattern (%s): %s", pattern, err)
+			continue
+		}
+		files = append(files, matches...)
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.manager == nil {
+		return
+	}
+	// unchanged groups keep their states
+	if err := m.manager.Update(time.Duration(cfg.EvaluationInterval)*time.Second, files, nil, m.externalURL.String(), nil); err != nil {
+		log.Errorf("load prometheus rule files failed: %s", err)
+	}
+}
+
+func (m *RuleManager) ruleGroups() []*rules.Group {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.manager == nil {
+		return nil
+	}
+	return m.manager.RuleGroups()
+}
+
+func alertsToModel(activeAlerts []*rules.Alert) []*model.Alert {
+	alerts := make([]*model.Alert, 0, len(activeAlerts))
+	for _, a := range activeAlerts {
+		alerts = append(alerts, &model.Alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State.String(),
+			ActiveAt:    &a.ActiveAt,
+			Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+		})
+	}
+	return alerts
+}
+
+func ruleLastError(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Rules returns the rule groups, ruleType can be "alert", "record" or empty for all rules
+func (m *RuleManager) Rules(ruleType string) (*model.PromQueryResponse, error) {
+	if ruleType != "" && ruleType != "alert" && ruleType != "record" {
+		return nil, fmt.Errorf("invalid rule type (%s)", ruleType)
+	}
+	groups := m.ruleGroups()
+	result := &model.RuleDiscovery{RuleGroups: make([]*model.RuleGroup, 0, len(groups))}
+	for _, g := range groups {
+		group := &model.RuleGroup{
+			Name:           g.Name(),
+			File:           g.File(),
+			Rules:          []interface{}{},
+			Interval:       g.Interval().Seconds(),
+			Limit:          g.Limit(),
+			EvaluationTime: g.GetEvaluationTime().Seconds(),
+			LastEvaluation: g.GetLastEvaluation(),
+		}
+		for _, r := range g.Rules() {
+			switch rule := r.(type) {
+			case *rules.AlertingRule:
+				if ruleType == "record" {
+					continue
+				}
+				group.Rules = append(group.Rules, &model.AlertingRule{
+					State:          rule.State().String(),
+					Name:           rule.Name(),
+					Query:          rule.Query().String(),
+					Duration:       rule.HoldDuration().Seconds(),
+					Labels:         rule.Labels(),
+					Annotations:    rule.Annotations(),
+					Alerts:         alertsToModel(rule.ActiveAlerts()),
+					Health:         string(rule.Health()),
+					LastError:      ruleLastError(rule.LastError()),
+					EvaluationTime: rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation: rule.GetEvaluationTimestamp(),
+					Type:           "alerting",
+				})
+			case *rules.RecordingRule:
+				if ruleType == "alert" {
+					continue
+				}
+				group.Rules = append(group.Rules, &model.RecordingRule{
+					Name:           rule.Name(),
+					Query:          rule.Query().String(),
+					Labels:         rule.Labels(),
+					Health:         string(rule.Health()),
+					LastError:      ruleLastError(rule.LastError()),
+					EvaluationTime: rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation: rule.GetEvaluationTimestamp(),
+					Type:           "recording",
+				})
+			}
+		}
+		result.RuleGroups = append(result.RuleGroups, group)
+	}
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: result}, nil
+}
+
+// Alerts returns the pending and firing alerts
+func (m *RuleManager) Alerts() (*model.PromQueryResponse, error) {
+	result := &model.AlertDiscovery{Alerts: []*model.Alert{}}
+	for _, g := range m.ruleGroups() {
+		for _, r := range g.AlertingRules() {
+			result.Alerts = append(result.Alerts, alertsToModel(r.ActiveAlerts())...)
+		}
+	}
+	return &model.PromQueryResponse{Status: _SUCCESS, Data: result}, nil
+}
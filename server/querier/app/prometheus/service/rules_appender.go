@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+
+	servercommon "github.com/deepflowio/deepflow/server/common"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+)
+
+// max time series in one write request sent to the ingester
+const ruleWriteBatchSize = 1024
+
+// SamplesQueue is the queue of the samples sent to the ingester
+type SamplesQueue = queue.TypedQueueWriter[*servercommon.PrometheusWriteRequest]
+
+// ruleAppendable writes the samples of rule evaluations, such as the results of recording rules and
+// the ALERTS series, into the prometheus tables through the ingester
+type ruleAppendable struct {
+	orgID        uint16
+	samplesQueue SamplesQueue
+}
+
+func newRuleAppendable(orgID uint16, samplesQueue SamplesQueue) *ruleAppendable {
+	return &ruleAppendable{orgID: orgID, samplesQueue: samplesQueue}
+}
+
+func (a *ruleAppendable) Appender(ctx context.Context) storage.Appender {
+	return &ruleAppender{appendable: a}
+}
+
+type ruleAppender struct {
+	appendable *ruleAppendable
+	timeSeries []prompb.TimeSeries
+}
+
+func (a *ruleAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	// stale markers are NaN and dropped by the ingester, skip them here
+	if math.IsNaN(v) {
+		return 0, nil
+	}
+	ts := prompb.TimeSeries{
+		Labels:  make([]prompb.Label, 0, len(l)),
+		Samples: []prompb.Sample{{Timestamp: t, Value: v}},
+	}
+	for _, label := range l {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: label.Name, Value: label.Value})
+	}
+	a.timeSeries = append(a.timeSeries, ts)
+	return 0, nil
+}
+
+func (a *ruleAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *ruleAppender) Commit() error {
+	defer func() { a.timeSeries = a.timeSeries[:0] }()
+	for start := 0; start < len(a.timeSeries); start += ruleWriteBatchSize {
+		end := start + ruleWriteBatchSize
+		if end > len(a.timeSeries) {
+			end = len(a.timeSeries)
+		}
+		req := &prompb.WriteRequest{Timeseries: a.timeSeries[start:end]}
+		data, err := req.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := a.appendable.samplesQueue.Put(&servercommon.PrometheusWriteRequest{
+			OrgID:      a.appendable.orgID,
+			Compressed: snappy.Encode(nil, data),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *ruleAppender) Rollback() error {
+	a.timeSeries = a.timeSeries[:0]
+	return nil
+}
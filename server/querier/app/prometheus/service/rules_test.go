@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/rules"
+
+	servercommon "github.com/deepflowio/deepflow/server/common"
+)
+
+type mockQueue struct {
+	items []*servercommon.PrometheusWriteRequest
+}
+
+func (q *mockQueue) Put(items ...*servercommon.PrometheusWriteRequest) error {
+	q.items = append(q.items, items...)
+	return nil
+}
+
+func (q *mockQueue) Len() int     { return len(q.items) }
+func (q *mockQueue) Close() error { return nil }
+
+func TestRuleAppender(t *testing.T) {
+	q := &mockQueue{}
+	appender := newRuleAppendable(2, q).Appender(context.Background())
+	for i := 0; i < ruleWriteBatchSize+1; i++ {
+		appender.Append(0, labels.FromStrings("__name__", "job:up:sum", "job", "node"), 1000, float64(i))
+	}
+	appender.Append(0, labels.FromStrings("__name__", "job:up:sum", "job", "stale"), 1000, math.NaN())
+	if err := appender.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.items) != 2 {
+		t.Fatalf("got %d write requests, want 2", len(q.items))
+	}
+
+	series := 0
+	for _, req := range q.items {
+		if req.OrgID != 2 {
+			t.Errorf("org id = %d, want 2", req.OrgID)
+		}
+		data, err := snappy.Decode(nil, req.Compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var writeRequest prompb.WriteRequest
+		if err := writeRequest.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		for _, ts := range writeRequest.Timeseries {
+			if len(ts.Labels) != 2 || ts.Labels[1].Value != "node" || ts.Samples[0].Timestamp != 1000 {
+				t.Errorf("unexpected time series %v", ts)
+			}
+		}
+		series += len(writeRequest.Timeseries)
+	}
+	if series != ruleWriteBatchSize+1 {
+		t.Errorf("got %d time series, want %d", series, ruleWriteBatchSize+1)
+	}
+}
+
+func TestAlertNotifier(t *testing.T) {
+	received := make(chan []alertmanagerAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []alertmanagerAlert
+		json.NewDecoder(r.Body).Decode(&alerts)
+		received <- alerts
+	}))
+	defer server.Close()
+
+	n := newAlertNotifier([]string{server.URL}, time.Second)
+	n.start()
+	firedAt := time.Now()
+	n.notifyFunc("http://deepflow")(context.Background(), `up == 0`, &rules.Alert{
+		State:       rules.StateFiring,
+		Labels:      labels.FromStrings("alertname", "InstanceDown", "instance", "a"),
+		Annotations: labels.FromStrings("summary", "instance a is down"),
+		FiredAt:     firedAt,
+		ValidUntil:  firedAt.Add(time.Minute),
+	})
+
+	select {
+	case alerts := <-received:
+		if len(alerts) != 1 {
+			t.Fatalf("got %d alerts, want 1", len(alerts))
+		}
+		a := alerts[0]
+		if a.Labels["alertname"] != "InstanceDown" || a.Annotations["summary"] != "instance a is down" || !a.EndsAt.After(a.StartsAt) {
+			t.Errorf("unexpected alert %+v", a)
+		}
+		if a.GeneratorURL != "http://deepflow/graph?g0.expr=up+%3D%3D+0&g0.tab=1" {
+			t.Errorf("generator url = %s", a.GeneratorURL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alerts are not sent")
+	}
+}
@@ -100,6 +100,30 @@ func (s *PrometheusService) PromSeriesQueryService(args *model.PromQueryParams,
 	return s.executor.series(ctx, args)
 }
 
+func (s *PrometheusService) PromLabelNamesService(args *model.PromMetaParams, ctx context.Context) (*model.PromQueryResponse, error) {
+	return s.executor.labelNames(ctx, args)
+}
+
+func (s *PrometheusService) PromMetadataService(args *model.PromMetaParams, ctx context.Context) (*model.PromQueryResponse, error) {
+	return s.executor.metadata(ctx, args)
+}
+
+func (s *PrometheusService) PromTargetsMetadataService(args *model.PromMetaParams, ctx context.Context) (*model.PromQueryResponse, error) {
+	return s.executor.targetsMetadata(ctx, args)
+}
+
+func (s *PrometheusService) PromExemplarsQueryService(args *model.PromQueryParams) (*model.PromQueryResponse, error) {
+	return s.executor.queryExemplars(args)
+}
+
+func (s *PrometheusService) PromFormatQueryService(query string) (*model.PromQueryResponse, error) {
+	return s.executor.formatQuery(query)
+}
+
+func (s *PrometheusService) PromBuildInfoService() *model.PromQueryResponse {
+	return s.executor.buildInfo()
+}
+
 func (s *PrometheusService) PromQLAnalysis(ctx context.Context, metric string, targetLabels []string, appLabels []string, startTime string, endTime string, orgID string) (*common.Result, error) {
 	return s.executor.promQLAnalysis(ctx, metric, targetLabels, appLabels, startTime, endTime, orgID)
 }
@@ -28,6 +28,7 @@ import (
 	tracemap "github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/config"
 	prometheus "github.com/deepflowio/deepflow/server/querier/app/prometheus/config"
 	tracing_adapter "github.com/deepflowio/deepflow/server/querier/app/tracing-adapter/config"
+	pcap "github.com/deepflowio/deepflow/server/querier/pcap/config"
 	profile "github.com/deepflowio/deepflow/server/querier/profile/config"
 )
 
@@ -48,6 +49,7 @@ type QuerierConfig struct {
 	ListenPort                      int                           `default:"20416" yaml:"listen-port"`
 	Clickhouse                      Clickhouse                    `yaml:"clickhouse"`
 	Profile                         profile.ProfileConfig         `yaml:"profile"`
+	Pcap                            pcap.PcapConfig               `yaml:"pcap"`
 	Tracemap                        tracemap.TraceMapConfig       `yaml:"trace-map"`
 	DeepflowApp                     DeepflowApp                   `yaml:"deepflow-app"`
 	Prometheus                      prometheus.Prometheus         `yaml:"prometheus"`
@@ -56,6 +58,7 @@ type QuerierConfig struct {
 	OtelEndpoint                    string                        `default:"http://deepflow-agent/api/v1/otel/trace" yaml:"otel-endpoint"`
 	Limit                           string                        `default:"10000" yaml:"limit"`
 	TimeFillLimit                   int                           `default:"20" yaml:"time-fill-limit"`
+	JoinMaxScanRows                 int                           `default:"1000000000" yaml:"join-max-scan-rows"`
 	PrometheusCacheUpdateInterval   int                           `default:"60" yaml:"prometheus-cache-update-interval"`
 	MaxCacheableEntrySize           int                           `default:"1000" yaml:"max-cacheable-entry-size"`
 	MaxPrometheusIdSubqueryLruEntry int                           `default:"8000" yaml:"max-prometheus-id-subquery-lru-entry"`
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
 	"slices"
 	"strconv"
@@ -230,6 +231,30 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 		debug_info.Debug = append(debug_info.Debug, *slimitDebug)
 		return slimitResult, debug_info.Get(), err
 	}
+	// Parse joinSql
+	joinResult, joinDebug, err := e.QueryJoinSql(sql, args)
+	if err != nil {
+		if joinDebug != nil {
+			debug_info.Debug = append(debug_info.Debug, *joinDebug)
+		}
+		return nil, debug_info.Get(), err
+	}
+	if joinResult != nil {
+		debug_info.Debug = append(debug_info.Debug, *joinDebug)
+		return joinResult, debug_info.Get(), err
+	}
+	// Parse timeShiftSql
+	timeShiftResult, timeShiftDebug, err := e.QueryTimeShiftSql(sql, args)
+	if err != nil {
+		if timeShiftDebug != nil {
+			debug_info.Debug = append(debug_info.Debug, *timeShiftDebug)
+		}
+		return nil, debug_info.Get(), err
+	}
+	if timeShiftResult != nil {
+		debug_info.Debug = append(debug_info.Debug, *timeShiftDebug)
+		return timeShiftResult, debug_info.Get(), err
+	}
 	// Parse showSql
 	debug := &client.Debug{
 		IP:        config.Cfg.Clickhouse.Host,
@@ -248,6 +273,7 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 	} else {
 		// Normal query, added to sqllist
 		sqlList = append(sqlList, sql)
+		e.setRollupDatasource(sql)
 	}
 	results := &common.Result{}
 	chClient := client.Client{
@@ -1091,6 +1117,57 @@ func (e *CHEngine) Init() {
 	}
 }
 
+// setRollupDatasource queries the coarsest prometheus/ext_metrics rollup whose interval is not greater than the
+// interval of time(), as promql range queries do, when no data_precision is specified
+func (e *CHEngine) setRollupDatasource(sql string) {
+	if e.DataSource != "" || (e.DB != chCommon.DB_NAME_PROMETHEUS && e.DB != chCommon.DB_NAME_EXT_METRICS) {
+		return
+	}
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return
+	}
+	interval := getTimeInterval(stmt)
+	if interval <= 0 {
+		return
+	}
+	dataSource, err := chCommon.GetRollupDatasource(e.DB, interval, e.ORGID)
+	if err != nil {
+		// fallback to the original data
+		log.Warningf("get rollup datasource of %s failed: %s", e.DB, err)
+		return
+	}
+	e.DataSource = dataSource
+}
+
+// getTimeInterval returns the interval of time(time, interval) in the select, 0 if the query is not grouped by time
+func getTimeInterval(stmt sqlparser.Statement) int {
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return 0
+	}
+	for _, expr := range selectStmt.SelectExprs {
+		aliasedExpr, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		function, ok := aliasedExpr.Expr.(*sqlparser.FuncExpr)
+		if !ok || !strings.EqualFold(function.Name.String(), "time") || len(function.Exprs) < 2 {
+			continue
+		}
+		arg, ok := function.Exprs[1].(*sqlparser.AliasedExpr)
+		if !ok {
+			return 0
+		}
+		interval, err := strconv.ParseFloat(sqlparser.String(arg.Expr), 64)
+		if err != nil {
+			return 0
+		}
+		return int(math.Ceil(interval))
+	}
+	return 0
+}
+
 func (e *CHEngine) TransSelect(tags sqlparser.SelectExprs) error {
 	tagSlice := []string{}
 	for _, tag := range tags {
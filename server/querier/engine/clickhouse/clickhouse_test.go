@@ -28,6 +28,7 @@ import (
 
 	"bou.ke/monkey"
 	"github.com/jarcoal/httpmock"
+	"github.com/xwb1989/sqlparser"
 
 	//"github.com/k0kubun/pp"
 
@@ -1147,3 +1148,23 @@ func TestReplaceCustomBizServiceFilterIDPatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTimeInterval(t *testing.T) {
+	for _, c := range []struct {
+		sql      string
+		interval int
+	}{
+		{"SELECT time(time, 3600) AS time_3600, Sum(`value`) FROM `metrics` GROUP BY time_3600", 3600},
+		{"SELECT time(time, 7200.5, 1, 0) AS time_7200 FROM `metrics` GROUP BY time_7200", 7201},
+		{"SELECT Sum(`value`) FROM `metrics`", 0},
+		{"SELECT `time` FROM `metrics`", 0},
+	} {
+		stmt, err := sqlparser.Parse(c.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interval := getTimeInterval(stmt); interval != c.interval {
+			t.Errorf("getTimeInterval(%s) = %d, expected %d", c.sql, interval, c.interval)
+		}
+	}
+}
@@ -270,3 +270,37 @@ func (c *Client) GetVersion() (version string, err error) {
 	}
 	return
 }
+
+// EstimateRows returns the rows to read of the sql estimated by ClickHouse 'EXPLAIN ESTIMATE'
+func (c *Client) EstimateRows(sql string, orgID string) (uint64, error) {
+	result, err := c.DoQuery(&QueryParams{Sql: "EXPLAIN ESTIMATE " + sql, ORGID: orgID})
+	if err != nil {
+		return 0, err
+	}
+	rowsIndex := -1
+	for i, column := range result.Columns {
+		if column == "rows" {
+			rowsIndex = i
+			break
+		}
+	}
+	if rowsIndex < 0 {
+		return 0, fmt.Errorf("column rows not found in the result of EXPLAIN ESTIMATE")
+	}
+	var total uint64
+	for _, value := range result.Values {
+		record, ok := value.([]interface{})
+		if !ok || len(record) <= rowsIndex {
+			continue
+		}
+		switch rows := record[rowsIndex].(type) {
+		case uint64:
+			total += rows
+		case int64:
+			total += uint64(rows)
+		case uint32:
+			total += uint64(rows)
+		}
+	}
+	return total, nil
+}
@@ -27,8 +27,10 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitly/go-simplejson"
+	"github.com/patrickmn/go-cache"
 	"github.com/xwb1989/sqlparser"
 
 	ctlcommon "github.com/deepflowio/deepflow/server/controller/common"
@@ -211,6 +213,81 @@ func GetDatasourceInterval(db string, table string, name string, orgID string) (
 	return int(body["DATA"].([]interface{})[0].(map[string]interface{})["INTERVAL"].(float64)), nil
 }
 
+// rollupDatasourceCache caches the rollup data_sources of each org and db, data_sources are rarely changed but
+// looked up by every prometheus/ext_metrics query
+var rollupDatasourceCache = cache.New(time.Minute, 2*time.Minute)
+
+type rollupDatasource struct {
+	name     string
+	interval int
+}
+
+// GetRollupDatasource returns the name of the coarsest prometheus/ext_metrics rollup whose interval is not
+// greater than maxInterval (in seconds), returns "" when the original data should be queried.
+func GetRollupDatasource(db string, maxInterval int, orgID string) (string, error) {
+	if (db != DB_NAME_PROMETHEUS && db != DB_NAME_EXT_METRICS) || maxInterval < ctlcommon.INTERVAL_1HOUR || config.ControllerCfg == nil {
+		return "", nil
+	}
+	rollups, err := getRollupDatasources(db, orgID)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	var maxRollupInterval int
+	for _, rollup := range rollups {
+		if rollup.interval <= maxInterval && rollup.interval > maxRollupInterval {
+			maxRollupInterval = rollup.interval
+			name = rollup.name
+		}
+	}
+	return name, nil
+}
+
+func getRollupDatasources(db string, orgID string) ([]rollupDatasource, error) {
+	key := orgID + "-" + db
+	if rollups, ok := rollupDatasourceCache.Get(key); ok {
+		return rollups.([]rollupDatasource), nil
+	}
+	client := &http.Client{}
+	url := fmt.Sprintf("http://localhost:%d/v1/data-sources/?type=%s", config.ControllerCfg.ListenPort, db)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Org-Id", orgID)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, errors.New(fmt.Sprintf("get rollup datasource error, url: %s, code '%d'", url, response.StatusCode))
+	}
+	body, err := ParseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	datasources, _ := body["DATA"].([]interface{})
+
+	rollups := []rollupDatasource{}
+	for _, datasource := range datasources {
+		info, ok := datasource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		interval, _ := info["INTERVAL"].(float64)
+		state, _ := info["STATE"].(float64)
+		// the original data_source is always queried when no rollup matches
+		if int(state) != ctlcommon.DATA_SOURCE_STATE_NORMAL || int(interval) < ctlcommon.INTERVAL_1HOUR {
+			continue
+		}
+		name, _ := info["NAME"].(string)
+		rollups = append(rollups, rollupDatasource{name: name, interval: int(interval)})
+	}
+	rollupDatasourceCache.SetDefault(key, rollups)
+	return rollups, nil
+}
+
 func GetExtTables(db, where, queryCacheTTL, orgID string, useQueryCache bool, ctx context.Context, DebugInfo *client.DebugInfo) (values []interface{}) {
 	chClient := client.Client{
 		Host:     config.Cfg.Clickhouse.Host,
@@ -0,0 +1,580 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	chCommon "github.com/deepflowio/deepflow/server/querier/engine/clickhouse/common"
+)
+
+var checkJoinSqlRegexp = regexp.MustCompile(`(?i)\sJOIN\s`)
+
+const (
+	JOIN_SIDE_PLACEHOLDER = "__deepflow_join_side_%d"
+	// TimeWindow(a.time, b.time, 60) matches the rows whose time differs by no more than 60 seconds
+	JOIN_FUNCTION_TIME_WINDOW = "timewindow"
+)
+
+// joinSide is a table of the JOIN, it is translated by its own CHEngine into a sub-query
+// which only selects the columns referenced by the outer query.
+type joinSide struct {
+	Alias string
+	DB    string
+	Table string
+	// the side supplies NULL rows, such as the right side of a LEFT JOIN, so the filters
+	// of the outer query can not be pushed down into it
+	Nullable bool
+	Columns  map[string]struct{}
+	Filters  []sqlparser.Expr
+	expr     *sqlparser.AliasedTableExpr
+}
+
+func (s *joinSide) Sql() string {
+	columns := make([]string, 0, len(s.Columns))
+	for column := range s.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for i := range columns {
+		columns[i] = sqlparser.String(sqlparser.NewColIdent(columns[i]))
+	}
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), sqlparser.String(sqlparser.NewTableIdent(s.Table)))
+	if len(s.Filters) > 0 {
+		filters := make([]string, 0, len(s.Filters))
+		for _, filter := range s.Filters {
+			if _, ok := filter.(*sqlparser.OrExpr); ok {
+				filter = &sqlparser.ParenExpr{Expr: filter}
+			}
+			filters = append(filters, sqlparser.String(filter))
+		}
+		sql += " WHERE " + strings.Join(filters, " AND ")
+	}
+	return sql
+}
+
+type timeWindow struct {
+	Left   *sqlparser.ColName
+	Right  *sqlparser.ColName
+	Window int64
+}
+
+func (w *timeWindow) Expr() sqlparser.Expr {
+	toInt64 := func(col *sqlparser.ColName) sqlparser.Expr {
+		return &sqlparser.FuncExpr{Name: sqlparser.NewColIdent("toInt64"), Exprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: col}}}
+	}
+	diff := &sqlparser.BinaryExpr{Operator: sqlparser.MinusStr, Left: toInt64(w.Left), Right: toInt64(w.Right)}
+	return &sqlparser.ComparisonExpr{
+		Operator: sqlparser.LessEqualStr,
+		Left:     &sqlparser.FuncExpr{Name: sqlparser.NewColIdent("abs"), Exprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: diff}}},
+		Right:    sqlparser.NewIntVal([]byte(strconv.FormatInt(w.Window, 10))),
+	}
+}
+
+// joinPlan splits a JOIN statement into the sides translated by DeepFlow and the outer
+// query executed by ClickHouse as it is.
+type joinPlan struct {
+	Sides         []*joinSide
+	stmt          *sqlparser.Select
+	sideMap       map[string]*joinSide
+	joins         []*sqlparser.JoinTableExpr
+	selectAliases map[string]struct{}
+	timeWindows   []*timeWindow
+}
+
+func newJoinPlan(stmt *sqlparser.Select, defaultDB string) (*joinPlan, error) {
+	p := &joinPlan{
+		stmt:          stmt,
+		sideMap:       map[string]*joinSide{},
+		selectAliases: map[string]struct{}{},
+	}
+	for _, selectExpr := range stmt.SelectExprs {
+		switch selectExpr := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			return nil, fmt.Errorf("select * is not supported in JOIN, please select the columns explicitly")
+		case *sqlparser.AliasedExpr:
+			if !selectExpr.As.IsEmpty() {
+				p.selectAliases[selectExpr.As.String()] = struct{}{}
+			}
+		}
+	}
+	for _, from := range stmt.From {
+		if err := p.collectSides(from, false, defaultDB); err != nil {
+			return nil, err
+		}
+	}
+	var outerFilters []sqlparser.Expr
+	for _, join := range p.joins {
+		filters, err := p.transJoinCondition(join)
+		if err != nil {
+			return nil, err
+		}
+		outerFilters = append(outerFilters, filters...)
+	}
+	if err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if function, ok := node.(*sqlparser.FuncExpr); ok && function.Name.Lowered() == JOIN_FUNCTION_TIME_WINDOW {
+			return false, fmt.Errorf("%s is only supported as a condition of JOIN ON", sqlparser.String(function))
+		}
+		return true, nil
+	}, stmt); err != nil {
+		return nil, err
+	}
+	p.pushDownFilters(outerFilters)
+	if err := p.collectColumns(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *joinPlan) collectSides(node sqlparser.TableExpr, nullable bool, defaultDB string) error {
+	switch node := node.(type) {
+	case *sqlparser.JoinTableExpr:
+		leftNullable, rightNullable := nullable, nullable
+		switch node.Join {
+		case sqlparser.JoinStr:
+		case sqlparser.LeftJoinStr:
+			rightNullable = true
+		case sqlparser.RightJoinStr:
+			leftNullable = true
+		default:
+			return fmt.Errorf("%s is not supported, only join, left join and right join are supported", node.Join)
+		}
+		if err := p.collectSides(node.LeftExpr, leftNullable, defaultDB); err != nil {
+			return err
+		}
+		if err := p.collectSides(node.RightExpr, rightNullable, defaultDB); err != nil {
+			return err
+		}
+		p.joins = append(p.joins, node)
+	case *sqlparser.ParenTableExpr:
+		for _, expr := range node.Exprs {
+			if err := p.collectSides(expr, nullable, defaultDB); err != nil {
+				return err
+			}
+		}
+	case *sqlparser.AliasedTableExpr:
+		tableName, ok := node.Expr.(sqlparser.TableName)
+		if !ok {
+			return fmt.Errorf("sub-query %s is not supported in JOIN", sqlparser.String(node))
+		}
+		if node.As.IsEmpty() {
+			return fmt.Errorf("table %s in JOIN must have an alias", sqlparser.String(tableName))
+		}
+		alias := node.As.String()
+		if _, ok := p.sideMap[alias]; ok {
+			return fmt.Errorf("duplicate table alias %s in JOIN", alias)
+		}
+		side := &joinSide{Alias: alias, Nullable: nullable, Columns: map[string]struct{}{}, expr: node}
+		// flow_log.l7_flow_log or l7_flow_log of the database in the request
+		if _, ok := chCommon.DB_TABLE_MAP[tableName.Qualifier.String()]; ok {
+			side.DB = tableName.Qualifier.String()
+			side.Table = tableName.Name.String()
+		} else {
+			side.DB = defaultDB
+			side.Table = strings.Trim(sqlparser.String(tableName), "`")
+		}
+		p.sideMap[alias] = side
+		p.Sides = append(p.Sides, side)
+	}
+	return nil
+}
+
+// transJoinCondition expands the TimeWindow conditions, which are not supported by ON of
+// ClickHouse, and returns them to be added to the outer WHERE
+func (p *joinPlan) transJoinCondition(join *sqlparser.JoinTableExpr) ([]sqlparser.Expr, error) {
+	if len(join.Condition.Using) > 0 {
+		left, leftOk := join.LeftExpr.(*sqlparser.AliasedTableExpr)
+		right, rightOk := join.RightExpr.(*sqlparser.AliasedTableExpr)
+		if !leftOk || !rightOk {
+			return nil, fmt.Errorf("USING is only supported when joining two tables, please use ON instead")
+		}
+		for _, column := range join.Condition.Using {
+			p.sideMap[left.As.String()].Columns[column.String()] = struct{}{}
+			p.sideMap[right.As.String()].Columns[column.String()] = struct{}{}
+		}
+		return nil, nil
+	}
+	if join.Condition.On == nil {
+		return nil, fmt.Errorf("JOIN without ON or USING is not supported")
+	}
+	var conditions, outerFilters []sqlparser.Expr
+	hasEqual := false
+	for _, condition := range splitAndExpr(join.Condition.On) {
+		if function, ok := condition.(*sqlparser.FuncExpr); ok && function.Name.Lowered() == JOIN_FUNCTION_TIME_WINDOW {
+			if join.Join != sqlparser.JoinStr {
+				return nil, fmt.Errorf("%s is only supported in inner JOIN", sqlparser.String(function))
+			}
+			window, err := parseTimeWindow(function)
+			if err != nil {
+				return nil, err
+			}
+			p.timeWindows = append(p.timeWindows, window)
+			outerFilters = append(outerFilters, window.Expr())
+			continue
+		}
+		if comparison, ok := condition.(*sqlparser.ComparisonExpr); ok && comparison.Operator == sqlparser.EqualStr {
+			left, leftOk := comparison.Left.(*sqlparser.ColName)
+			right, rightOk := comparison.Right.(*sqlparser.ColName)
+			if leftOk && rightOk && left.Qualifier.Name.String() != right.Qualifier.Name.String() {
+				hasEqual = true
+			}
+		}
+		conditions = append(conditions, condition)
+	}
+	if !hasEqual {
+		return nil, fmt.Errorf("JOIN ON requires at least one equality condition between the columns of both tables: %s", sqlparser.String(join.Condition.On))
+	}
+	join.Condition.On = joinAndExpr(conditions)
+	return outerFilters, nil
+}
+
+func parseTimeWindow(function *sqlparser.FuncExpr) (*timeWindow, error) {
+	invalid := fmt.Errorf("invalid %s, usage: TimeWindow(a.time, b.time, <seconds>)", sqlparser.String(function))
+	if len(function.Exprs) != 3 {
+		return nil, invalid
+	}
+	args := make([]sqlparser.Expr, 0, 3)
+	for _, arg := range function.Exprs {
+		aliasedExpr, ok := arg.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, invalid
+		}
+		args = append(args, aliasedExpr.Expr)
+	}
+	left, leftOk := args[0].(*sqlparser.ColName)
+	right, rightOk := args[1].(*sqlparser.ColName)
+	value, valueOk := args[2].(*sqlparser.SQLVal)
+	if !leftOk || !rightOk || !valueOk || value.Type != sqlparser.IntVal {
+		return nil, invalid
+	}
+	window, err := strconv.ParseInt(string(value.Val), 10, 64)
+	if err != nil || window < 0 {
+		return nil, invalid
+	}
+	return &timeWindow{Left: left, Right: right, Window: window}, nil
+}
+
+// pushDownFilters moves the conditions of the outer WHERE which only reference one table into
+// the sub-query of the table, so that they are translated by DeepFlow and reduce the rows to join.
+// The time filters are also widened by the time windows and pushed down into the other table.
+func (p *joinPlan) pushDownFilters(outerFilters []sqlparser.Expr) {
+	var filters []sqlparser.Expr
+	if p.stmt.Where != nil {
+		filters = splitAndExpr(p.stmt.Where.Expr)
+	}
+	var remains []sqlparser.Expr
+	for _, filter := range filters {
+		side := p.filterSide(filter)
+		if side == nil || side.Nullable {
+			remains = append(remains, filter)
+			continue
+		}
+		sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			if col, ok := node.(*sqlparser.ColName); ok {
+				col.Qualifier = sqlparser.TableName{}
+			}
+			return true, nil
+		}, filter)
+		side.Filters = append(side.Filters, filter)
+	}
+	// only the filters given by the user are widened
+	pushed := make(map[*joinSide][]sqlparser.Expr, len(p.Sides))
+	for _, side := range p.Sides {
+		pushed[side] = side.Filters
+	}
+	for _, window := range p.timeWindows {
+		p.widenTimeFilters(pushed, window.Left, window.Right, window.Window)
+		p.widenTimeFilters(pushed, window.Right, window.Left, window.Window)
+	}
+	remains = append(remains, outerFilters...)
+	if len(remains) == 0 {
+		p.stmt.Where = nil
+		return
+	}
+	p.stmt.Where = sqlparser.NewWhere(sqlparser.WhereStr, joinAndExpr(remains))
+}
+
+// filterSide returns the only table referenced by the filter, or nil
+func (p *joinPlan) filterSide(filter sqlparser.Expr) *joinSide {
+	var side *joinSide
+	pushable := true
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			pushable = false
+		case *sqlparser.ColName:
+			current, ok := p.sideMap[node.Qualifier.Name.String()]
+			if !ok || (side != nil && side != current) {
+				pushable = false
+			}
+			side = current
+		}
+		return pushable, nil
+	}, filter)
+	if !pushable {
+		return nil
+	}
+	return side
+}
+
+func (p *joinPlan) widenTimeFilters(pushed map[*joinSide][]sqlparser.Expr, from, to *sqlparser.ColName, window int64) {
+	fromSide, ok := p.sideMap[from.Qualifier.Name.String()]
+	if !ok {
+		return
+	}
+	toSide, ok := p.sideMap[to.Qualifier.Name.String()]
+	if !ok || toSide.Nullable || toSide == fromSide {
+		return
+	}
+	for _, filter := range pushed[fromSide] {
+		comparison, ok := filter.(*sqlparser.ComparisonExpr)
+		if !ok {
+			continue
+		}
+		col, ok := comparison.Left.(*sqlparser.ColName)
+		if !ok || col.Name.String() != from.Name.String() {
+			continue
+		}
+		value, ok := comparison.Right.(*sqlparser.SQLVal)
+		if !ok || value.Type != sqlparser.IntVal {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(string(value.Val), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch comparison.Operator {
+		case sqlparser.GreaterEqualStr, sqlparser.GreaterThanStr:
+			timestamp -= window
+		case sqlparser.LessEqualStr, sqlparser.LessThanStr:
+			timestamp += window
+		default:
+			continue
+		}
+		toSide.Filters = append(toSide.Filters, &sqlparser.ComparisonExpr{
+			Operator: comparison.Operator,
+			Left:     &sqlparser.ColName{Name: to.Name},
+			Right:    sqlparser.NewIntVal([]byte(strconv.FormatInt(timestamp, 10))),
+		})
+	}
+}
+
+// collectColumns adds the columns referenced by the outer query to the sub-queries.
+// All columns of the outer query except the aliases of SELECT must be qualified by the table aliases.
+func (p *joinPlan) collectColumns() error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.ColName:
+			if node.Qualifier.IsEmpty() {
+				if _, ok := p.selectAliases[node.Name.String()]; ok {
+					return true, nil
+				}
+				return false, fmt.Errorf("column %s must be qualified by the table alias in JOIN", sqlparser.String(node))
+			}
+			side, ok := p.sideMap[node.Qualifier.Name.String()]
+			if !ok {
+				return false, fmt.Errorf("unknown table alias of column %s", sqlparser.String(node))
+			}
+			side.Columns[node.Name.String()] = struct{}{}
+		}
+		return true, nil
+	}, p.stmt.SelectExprs, p.stmt.From, p.stmt.Where, p.stmt.GroupBy, p.stmt.Having, p.stmt.OrderBy)
+}
+
+// ColumnSchemas maps the result columns of the outer query to the schemas of the side columns they select.
+// The result columns are named by their aliases or qualified names, such as a.pod, so that the columns of
+// the same name in different tables do not override each other.
+func (p *joinPlan) ColumnSchemas(sideSchemas map[*joinSide]common.ColumnSchemas) map[string]*common.ColumnSchema {
+	columnSchemaMap := make(map[string]*common.ColumnSchema)
+	for _, selectExpr := range p.stmt.SelectExprs {
+		aliasedExpr, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		col, ok := aliasedExpr.Expr.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		side, ok := p.sideMap[col.Qualifier.Name.String()]
+		if !ok {
+			continue
+		}
+		name := side.Alias + "." + col.Name.String()
+		if !aliasedExpr.As.IsEmpty() {
+			name = aliasedExpr.As.String()
+		}
+		for _, columnSchema := range sideSchemas[side] {
+			if columnSchema.Name == col.Name.String() {
+				// the value type is filled in by the client for each result column
+				schema := *columnSchema
+				schema.Name = name
+				columnSchemaMap[name] = &schema
+				break
+			}
+		}
+	}
+	return columnSchemaMap
+}
+
+// OuterSql replaces the tables with the translated sub-queries
+func (p *joinPlan) OuterSql(sideSqls []string, defaultLimit string) string {
+	for i, side := range p.Sides {
+		side.expr.Expr = sqlparser.TableName{Name: sqlparser.NewTableIdent(fmt.Sprintf(JOIN_SIDE_PLACEHOLDER, i))}
+	}
+	if p.stmt.Limit == nil && defaultLimit != "" {
+		p.stmt.Limit = &sqlparser.Limit{Rowcount: sqlparser.NewIntVal([]byte(defaultLimit))}
+	}
+	sql := sqlparser.String(p.stmt)
+	for i, sideSql := range sideSqls {
+		sql = strings.Replace(sql, fmt.Sprintf(JOIN_SIDE_PLACEHOLDER, i), fmt.Sprintf("(%s)", sideSql), 1)
+	}
+	return sql
+}
+
+func splitAndExpr(expr sqlparser.Expr) []sqlparser.Expr {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return append(splitAndExpr(expr.Left), splitAndExpr(expr.Right)...)
+	case *sqlparser.ParenExpr:
+		if _, ok := expr.Expr.(*sqlparser.AndExpr); ok {
+			return splitAndExpr(expr.Expr)
+		}
+	}
+	return []sqlparser.Expr{expr}
+}
+
+func joinAndExpr(exprs []sqlparser.Expr) sqlparser.Expr {
+	var result sqlparser.Expr
+	for _, expr := range exprs {
+		if _, ok := expr.(*sqlparser.OrExpr); ok {
+			expr = &sqlparser.ParenExpr{Expr: expr}
+		}
+		if result == nil {
+			result = expr
+		} else {
+			result = &sqlparser.AndExpr{Left: result, Right: expr}
+		}
+	}
+	return result
+}
+
+func (e *CHEngine) QueryJoinSql(sql string, args *common.QuerierParams) (*common.Result, *client.Debug, error) {
+	sql, columnSchemaMap, err := e.ParseJoinSql(sql)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	if sql == "" {
+		return nil, nil, nil
+	}
+
+	query_uuid := args.QueryUUID
+	debug := &client.Debug{
+		IP:        config.Cfg.Clickhouse.Host,
+		QueryUUID: query_uuid,
+	}
+	debug.Sql = sql
+	chClient := client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       e.DB,
+		Debug:    debug,
+		Context:  e.Context,
+	}
+	if config.Cfg.JoinMaxScanRows > 0 {
+		rows, err := chClient.EstimateRows(sql, args.ORGID)
+		if err != nil {
+			log.Error(err)
+			return nil, debug, err
+		}
+		if rows > uint64(config.Cfg.JoinMaxScanRows) {
+			err = fmt.Errorf("the JOIN is estimated to scan %d rows, exceeding the limit %d, please narrow the time range or add filters", rows, config.Cfg.JoinMaxScanRows)
+			log.Error(err)
+			return nil, debug, err
+		}
+	}
+	params := &client.QueryParams{
+		Sql:             sql,
+		UseQueryCache:   args.UseQueryCache,
+		QueryCacheTTL:   args.QueryCacheTTL,
+		QueryUUID:       query_uuid,
+		ColumnSchemaMap: columnSchemaMap,
+		ORGID:           args.ORGID,
+	}
+	rst, err := chClient.DoQuery(params)
+	if err != nil {
+		log.Error(err)
+		return nil, debug, err
+	}
+	return rst, debug, err
+}
+
+// ParseJoinSql translates each table of the JOIN by its own CHEngine, so the tags and the
+// universal tags of both sides are resolved as in a single table query.
+func (e *CHEngine) ParseJoinSql(sql string) (string, map[string]*common.ColumnSchema, error) {
+	if !checkJoinSqlRegexp.MatchString(sql) {
+		return "", nil, nil
+	}
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", nil, err
+	}
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok || len(selectStmt.From) != 1 {
+		return "", nil, nil
+	}
+	if _, ok := selectStmt.From[0].(*sqlparser.JoinTableExpr); !ok {
+		return "", nil, nil
+	}
+	plan, err := newJoinPlan(selectStmt, e.DB)
+	if err != nil {
+		return "", nil, err
+	}
+	sideSqls := []string{}
+	sideSchemas := make(map[*joinSide]common.ColumnSchemas, len(plan.Sides))
+	for _, side := range plan.Sides {
+		dataSource := ""
+		if side.DB == e.DB {
+			dataSource = e.DataSource
+		}
+		sideEngine, err := e.parseSubSql(side.DB, dataSource, side.Sql())
+		if err != nil {
+			return "", nil, fmt.Errorf("parse table %s of JOIN failed: %s", side.Alias, err)
+		}
+		sideSqls = append(sideSqls, sideEngine.ToSQLString())
+		sideSchemas[side] = sideEngine.ColumnSchemas
+	}
+	columnSchemaMap := plan.ColumnSchemas(sideSchemas)
+	defaultLimit := DEFAULT_LIMIT
+	if config.Cfg != nil {
+		defaultLimit = config.Cfg.Limit
+	}
+	return plan.OuterSql(sideSqls, defaultLimit), columnSchemaMap, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xwb1989/sqlparser"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+func TestJoinPlan(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		sides    []string
+		sideDBs  []string
+		outerSql string
+		wantErr  string
+	}{{
+		name:    "time_window",
+		input:   "SELECT a.pod, b.event_type, a.response_code FROM l7_flow_log AS a JOIN event.event AS b ON a.pod_id_1 = b.pod_id AND TimeWindow(a.time, b.time, 300) WHERE a.time >= 1000 AND a.time <= 2000 AND a.response_status = 3 AND (b.event_type = 'pod-restart' OR b.event_type = 'oom')",
+		sides:   []string{"SELECT pod, pod_id_1, response_code, `time` FROM l7_flow_log WHERE `time` >= 1000 AND `time` <= 2000 AND response_status = 3", "SELECT event_type, pod_id, `time` FROM event WHERE (event_type = 'pod-restart' or event_type = 'oom') AND `time` >= 700 AND `time` <= 2300"},
+		sideDBs: []string{"flow_log", "event"},
+		// the time window condition is moved from ON to WHERE
+		outerSql: "select a.pod, b.event_type, a.response_code from (side0) as a join (side1) as b on a.pod_id_1 = b.pod_id where abs(toInt64(a.`time`) - toInt64(b.`time`)) <= 300 limit 10000",
+	}, {
+		name:    "left_join_using",
+		input:   "SELECT a.trace_id, count(b.span_id) AS cnt FROM flow_log.l7_flow_log AS a LEFT JOIN profile.in_process AS b USING (trace_id) WHERE a.time >= 1000 AND b.time >= 1000 GROUP BY a.trace_id ORDER BY cnt LIMIT 10",
+		sides:   []string{"SELECT trace_id FROM l7_flow_log WHERE `time` >= 1000", "SELECT span_id, `time`, trace_id FROM in_process"},
+		sideDBs: []string{"flow_log", "profile"},
+		// filters of the right table of LEFT JOIN are not pushed down
+		outerSql: "select a.trace_id, count(b.span_id) as cnt from (side0) as a left join (side1) as b using (trace_id) where b.`time` >= 1000 group by a.trace_id order by cnt asc limit 10",
+	}, {
+		name:    "no_alias",
+		input:   "SELECT l7_flow_log.pod FROM l7_flow_log JOIN event.event AS b ON l7_flow_log.pod_id_1 = b.pod_id",
+		wantErr: "table l7_flow_log in JOIN must have an alias",
+	}, {
+		name:    "no_equality",
+		input:   "SELECT a.pod FROM l7_flow_log AS a JOIN event.event AS b ON TimeWindow(a.time, b.time, 60)",
+		wantErr: "JOIN ON requires at least one equality condition between the columns of both tables: TimeWindow(a.`time`, b.`time`, 60)",
+	}, {
+		name:    "outer_time_window",
+		input:   "SELECT a.pod FROM l7_flow_log AS a LEFT JOIN event.event AS b ON a.pod_id_1 = b.pod_id AND TimeWindow(a.time, b.time, 60)",
+		wantErr: "TimeWindow(a.`time`, b.`time`, 60) is only supported in inner JOIN",
+	}, {
+		name:    "unqualified_column",
+		input:   "SELECT pod FROM l7_flow_log AS a JOIN event.event AS b ON a.pod_id_1 = b.pod_id",
+		wantErr: "column pod must be qualified by the table alias in JOIN",
+	}}
+	for _, c := range cases {
+		stmt, err := sqlparser.Parse(c.input)
+		if err != nil {
+			t.Fatalf("[%s] parse failed: %s", c.name, err)
+		}
+		plan, err := newJoinPlan(stmt.(*sqlparser.Select), "flow_log")
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("[%s] want error %q, get %v", c.name, c.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %s", c.name, err)
+			continue
+		}
+		sideSqls := []string{}
+		for i, side := range plan.Sides {
+			if side.Sql() != c.sides[i] || side.DB != c.sideDBs[i] {
+				t.Errorf("[%s] side %d:\n get: %s %s\nwant: %s %s", c.name, i, side.DB, side.Sql(), c.sideDBs[i], c.sides[i])
+			}
+			sideSqls = append(sideSqls, fmt.Sprintf("side%d", i))
+		}
+		if outerSql := plan.OuterSql(sideSqls, "10000"); outerSql != c.outerSql {
+			t.Errorf("[%s] outer sql:\n get: %s\nwant: %s", c.name, outerSql, c.outerSql)
+		}
+	}
+}
+
+func TestJoinColumnSchemas(t *testing.T) {
+	stmt, err := sqlparser.Parse("SELECT a.pod, b.pod AS event_pod, count(b.pod) AS cnt FROM l7_flow_log AS a JOIN event.event AS b ON a.pod_id_1 = b.pod_id GROUP BY a.pod, b.pod")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	plan, err := newJoinPlan(stmt.(*sqlparser.Select), "flow_log")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sideSchemas := map[*joinSide]common.ColumnSchemas{
+		plan.Sides[0]: {common.NewColumnSchema("pod", "", "flow_log")},
+		plan.Sides[1]: {common.NewColumnSchema("pod", "", "event")},
+	}
+	columnSchemaMap := plan.ColumnSchemas(sideSchemas)
+	// the columns of the same name in both tables are kept apart, the aggregation has no schema
+	want := map[string]string{"a.pod": "flow_log", "event_pod": "event"}
+	if len(columnSchemaMap) != len(want) {
+		t.Fatalf("get %d column schemas, want %d", len(columnSchemaMap), len(want))
+	}
+	for name, labelType := range want {
+		schema, ok := columnSchemaMap[name]
+		if !ok || schema.Name != name || schema.LabelType != labelType {
+			t.Errorf("column %s: get %+v, want label type %s", name, schema, labelType)
+		}
+	}
+}
@@ -41,6 +41,8 @@ const (
 	VIF_DEVICE_TYPE_POD_GROUP_DAEMON_SET            = 133
 	VIF_DEVICE_TYPE_POD_GROUP_REPLICASET_CONTROLLER = 134
 	VIF_DEVICE_TYPE_POD_GROUP_CLONESET              = 135
+	VIF_DEVICE_TYPE_POD_GROUP_JOB                   = 136
+	VIF_DEVICE_TYPE_POD_GROUP_CRON_JOB              = 137
 	VIF_DEVICE_TYPE_IP                              = 255
 )
 
@@ -87,10 +89,12 @@ var AutoServiceMap = map[string]int{
 	"daemon_set":             VIF_DEVICE_TYPE_POD_GROUP_DAEMON_SET,
 	"replica_set_controller": VIF_DEVICE_TYPE_POD_GROUP_REPLICASET_CONTROLLER,
 	"clone_set":              VIF_DEVICE_TYPE_POD_GROUP_CLONESET,
+	"job":                    VIF_DEVICE_TYPE_POD_GROUP_JOB,
+	"cron_job":               VIF_DEVICE_TYPE_POD_GROUP_CRON_JOB,
 	"biz_service":            VIF_DEVICE_TYPE_CUSTOM_SERVICE,
 }
 
 var PodGroupTypeSlice = []string{
 	"deployment", "stateful_set", "replication_controller", "daemon_set",
-	"replica_set_controller", "clone_set",
+	"replica_set_controller", "clone_set", "job", "cron_job",
 }
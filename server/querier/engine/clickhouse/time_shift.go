@@ -0,0 +1,468 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/view"
+	"github.com/deepflowio/deepflow/server/querier/parse"
+)
+
+var checkTimeShiftSqlRegexp = regexp.MustCompile(`(?i)(TimeShift|Delta_Vs|Ratio_Vs)\s*\(`)
+
+const (
+	TIME_SHIFT_CURRENT_TABLE = "__time_shift_current"
+	TIME_SHIFT_SHIFTED_TABLE = "__time_shift_%d"
+	TIME_SHIFT_COLUMN        = "__time_shift_column_%d"
+)
+
+// timeShiftPlan splits a query with the time-shift functions into the sub-query of the current
+// time range and one sub-query for each offset, which are joined by the time and the tags grouped by.
+// The metrics of the shifted time ranges without data are 0 as the default values of LEFT JOIN.
+type timeShiftPlan struct {
+	sql       string
+	names     []string
+	functions map[int]*view.TimeShiftFunction
+	metrics   map[int]sqlparser.Expr
+	offsets   []int
+	keys      []string
+	timeKey   string
+	orderBy   sqlparser.OrderBy
+	limit     *sqlparser.Limit
+}
+
+// newTimeShiftPlan returns nil if there is no time-shift function in the sql
+func newTimeShiftPlan(sql string) (*timeShiftPlan, error) {
+	parsed, err := sqlparser.Parse(sql)
+	if err != nil {
+		// the sql is not a time-shift query, the error is returned by the normal parsing
+		return nil, nil
+	}
+	functionCount := countTimeShiftFunctions(parsed)
+	if functionCount == 0 {
+		return nil, nil
+	}
+	stmt, ok := parsed.(*sqlparser.Select)
+	if !ok {
+		return nil, fmt.Errorf("time-shift functions only support select statements")
+	}
+	if len(stmt.From) != 1 {
+		return nil, fmt.Errorf("time-shift functions only support querying a single table")
+	}
+	if _, ok := stmt.From[0].(*sqlparser.AliasedTableExpr); !ok {
+		return nil, fmt.Errorf("time-shift functions only support querying a single table")
+	}
+	p := &timeShiftPlan{
+		sql:       sql,
+		functions: map[int]*view.TimeShiftFunction{},
+		metrics:   map[int]sqlparser.Expr{},
+		orderBy:   stmt.OrderBy,
+		limit:     stmt.Limit,
+	}
+	for i, selectExpr := range stmt.SelectExprs {
+		item, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, fmt.Errorf("select * is not supported by time-shift functions")
+		}
+		name := strings.Trim(sqlparser.String(item.Expr), "`")
+		if !item.As.IsEmpty() {
+			name = item.As.String()
+		}
+		p.names = append(p.names, name)
+		function, ok := item.Expr.(*sqlparser.FuncExpr)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(function.Name.String(), TAG_FUNCTION_TIME) {
+			p.timeKey = name
+			continue
+		}
+		functionName := timeShiftFunctionName(function)
+		if functionName == "" {
+			continue
+		}
+		metric, offset, err := parseTimeShiftArgs(function)
+		if err != nil {
+			return nil, err
+		}
+		p.metrics[i] = metric
+		p.functions[i] = &view.TimeShiftFunction{
+			Name:    functionName,
+			Offset:  offset,
+			Current: fmt.Sprintf("%s.`%s`", TIME_SHIFT_CURRENT_TABLE, fmt.Sprintf(TIME_SHIFT_COLUMN, i)),
+			Shifted: fmt.Sprintf("%s.`%s`", fmt.Sprintf(TIME_SHIFT_SHIFTED_TABLE, offset), fmt.Sprintf(TIME_SHIFT_COLUMN, i)),
+			Alias:   name,
+		}
+		if !slices.Contains(p.offsets, offset) {
+			p.offsets = append(p.offsets, offset)
+		}
+	}
+	if len(p.functions) != functionCount {
+		return nil, fmt.Errorf("time-shift functions can only be selected directly, such as TimeShift(Sum(byte), '1d') AS sum_byte_1d")
+	}
+	for _, group := range stmt.GroupBy {
+		key := strings.Trim(sqlparser.String(group), "`")
+		if !slices.Contains(p.names, key) {
+			return nil, fmt.Errorf("%s in GROUP BY must be selected when using time-shift functions", key)
+		}
+		if key != p.timeKey {
+			p.keys = append(p.keys, key)
+		}
+	}
+	for _, order := range stmt.OrderBy {
+		if !slices.Contains(p.names, strings.Trim(sqlparser.String(order.Expr), "`")) {
+			return nil, fmt.Errorf("%s in ORDER BY must be selected when using time-shift functions", sqlparser.String(order.Expr))
+		}
+	}
+	return p, nil
+}
+
+// timeShiftFunctionName returns the name of the time-shift function, or "" if it is not a time-shift function
+func timeShiftFunctionName(function *sqlparser.FuncExpr) string {
+	for _, name := range view.TIME_SHIFT_FUNCTIONS {
+		if strings.EqualFold(function.Name.String(), name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func countTimeShiftFunctions(node sqlparser.SQLNode) int {
+	count := 0
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if function, ok := node.(*sqlparser.FuncExpr); ok && timeShiftFunctionName(function) != "" {
+			count++
+		}
+		return true, nil
+	}, node)
+	return count
+}
+
+func parseSelect(sql string) (*sqlparser.Select, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	selectStmt, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, fmt.Errorf("sql: %s is not a select statement", sql)
+	}
+	return selectStmt, nil
+}
+
+func parseTimeShiftArgs(function *sqlparser.FuncExpr) (sqlparser.Expr, int, error) {
+	invalid := fmt.Errorf("invalid %s, usage: %s(<metric>, '<offset>'), such as '1d'", sqlparser.String(function), function.Name.String())
+	if len(function.Exprs) != 2 {
+		return nil, 0, invalid
+	}
+	metric, ok := function.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, 0, invalid
+	}
+	arg, ok := function.Exprs[1].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, 0, invalid
+	}
+	value, ok := arg.Expr.(*sqlparser.SQLVal)
+	if !ok || value.Type != sqlparser.StrVal {
+		return nil, 0, invalid
+	}
+	offset, err := view.ParseTimeShiftOffset(string(value.Val))
+	if err != nil {
+		return nil, 0, err
+	}
+	return metric.Expr, offset, nil
+}
+
+// CurrentSql replaces the time-shift functions with their metrics, the order and the limit
+// are applied to the outer query
+func (p *timeShiftPlan) CurrentSql() (string, error) {
+	stmt, err := parseSelect(p.sql)
+	if err != nil {
+		return "", err
+	}
+	selectExprs := sqlparser.SelectExprs{}
+	for i, selectExpr := range stmt.SelectExprs {
+		function, ok := p.functions[i]
+		if !ok {
+			selectExprs = append(selectExprs, selectExpr)
+		} else if function.Name != view.FUNCTION_TIME_SHIFT {
+			selectExprs = append(selectExprs, &sqlparser.AliasedExpr{Expr: p.metrics[i], As: sqlparser.NewColIdent(fmt.Sprintf(TIME_SHIFT_COLUMN, i))})
+		}
+	}
+	stmt.SelectExprs = selectExprs
+	stmt.OrderBy = nil
+	stmt.Limit = nil
+	return sqlparser.String(stmt), nil
+}
+
+// ShiftedSql selects the grouped tags and the metrics of the offset in the time range shifted back by the offset
+func (p *timeShiftPlan) ShiftedSql(offset int) (string, error) {
+	stmt, err := parseSelect(p.sql)
+	if err != nil {
+		return "", err
+	}
+	selectExprs := sqlparser.SelectExprs{}
+	for i, selectExpr := range stmt.SelectExprs {
+		if function, ok := p.functions[i]; ok {
+			if function.Offset == offset {
+				selectExprs = append(selectExprs, &sqlparser.AliasedExpr{Expr: p.metrics[i], As: sqlparser.NewColIdent(fmt.Sprintf(TIME_SHIFT_COLUMN, i))})
+			}
+		} else if p.names[i] == p.timeKey || slices.Contains(p.keys, p.names[i]) {
+			selectExprs = append(selectExprs, selectExpr)
+		}
+	}
+	stmt.SelectExprs = selectExprs
+	if stmt.Where == nil {
+		return "", errTimeShiftTimeRange
+	}
+	shifted, err := shiftTimeFilters(stmt.Where.Expr, offset)
+	if err != nil {
+		return "", err
+	}
+	if !shifted {
+		return "", errTimeShiftTimeRange
+	}
+	stmt.Having = nil
+	stmt.OrderBy = nil
+	stmt.Limit = nil
+	return sqlparser.String(stmt), nil
+}
+
+var errTimeShiftTimeRange = fmt.Errorf("time-shift functions require the time range in WHERE, such as time >= 1700000000 AND time <= 1700003600")
+
+// shiftTimeFilters moves the time filters back by the offset, the filters are unix timestamps or arithmetic
+// expressions of them, the same as the time filters supported by the where translation
+func shiftTimeFilters(expr sqlparser.Expr, offset int) (bool, error) {
+	shifted := false
+	shift := func(expr sqlparser.Expr) (sqlparser.Expr, error) {
+		if value, ok := expr.(*sqlparser.SQLVal); ok && value.Type == sqlparser.IntVal {
+			timestamp, err := strconv.ParseInt(string(value.Val), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			value.Val = []byte(strconv.FormatInt(timestamp-int64(offset), 10))
+			shifted = true
+			return value, nil
+		}
+		if !isTimestampArithmetic(expr) {
+			return nil, fmt.Errorf("time filter %s is not supported by time-shift functions, use unix timestamps such as time >= 1700000000", sqlparser.String(expr))
+		}
+		shifted = true
+		return &sqlparser.BinaryExpr{
+			Left:     &sqlparser.ParenExpr{Expr: expr},
+			Operator: sqlparser.MinusStr,
+			Right:    sqlparser.NewIntVal([]byte(strconv.Itoa(offset))),
+		}, nil
+	}
+	isTime := func(expr sqlparser.Expr) bool {
+		if paren, ok := expr.(*sqlparser.ParenExpr); ok {
+			expr = paren.Expr
+		}
+		col, ok := expr.(*sqlparser.ColName)
+		return ok && col.Name.EqualString("time")
+	}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		var err error
+		switch node := node.(type) {
+		case *sqlparser.ComparisonExpr:
+			if isTime(node.Left) {
+				node.Right, err = shift(node.Right)
+			}
+		case *sqlparser.RangeCond:
+			if isTime(node.Left) {
+				if node.From, err = shift(node.From); err == nil {
+					node.To, err = shift(node.To)
+				}
+			}
+		}
+		return err == nil, err
+	}, expr)
+	return shifted, err
+}
+
+// isTimestampArithmetic returns true if the expr is an arithmetic expression of integers, such as 1700000000 - 3600
+func isTimestampArithmetic(expr sqlparser.Expr) bool {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		return expr.Type == sqlparser.IntVal
+	case *sqlparser.ParenExpr:
+		return isTimestampArithmetic(expr.Expr)
+	case *sqlparser.BinaryExpr:
+		switch expr.Operator {
+		case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr:
+			return isTimestampArithmetic(expr.Left) && isTimestampArithmetic(expr.Right)
+		}
+	}
+	return false
+}
+
+// OuterSql joins the translated sub-queries, the time of the shifted sub-query plus the offset
+// is aligned with the time of the current sub-query
+func (p *timeShiftPlan) OuterSql(currentSql string, shiftedSqls []string, defaultLimit string) string {
+	selectItems := make([]string, 0, len(p.names))
+	for i, name := range p.names {
+		if function, ok := p.functions[i]; ok {
+			selectItems = append(selectItems, function.ToString())
+		} else {
+			selectItems = append(selectItems, fmt.Sprintf("%s.`%s` AS `%s`", TIME_SHIFT_CURRENT_TABLE, name, name))
+		}
+	}
+	sql := fmt.Sprintf("SELECT %s FROM (%s) AS %s", strings.Join(selectItems, ", "), currentSql, TIME_SHIFT_CURRENT_TABLE)
+	for i, offset := range p.offsets {
+		table := fmt.Sprintf(TIME_SHIFT_SHIFTED_TABLE, offset)
+		conditions := []string{}
+		if p.timeKey != "" {
+			conditions = append(conditions, fmt.Sprintf("%s.`%s` = %s.`%s` + %d", TIME_SHIFT_CURRENT_TABLE, p.timeKey, table, p.timeKey, offset))
+		}
+		for _, key := range p.keys {
+			conditions = append(conditions, fmt.Sprintf("%s.`%s` = %s.`%s`", TIME_SHIFT_CURRENT_TABLE, key, table, key))
+		}
+		if len(conditions) == 0 {
+			// both sub-queries return a single row without GROUP BY
+			sql += fmt.Sprintf(" CROSS JOIN (%s) AS %s", shiftedSqls[i], table)
+		} else {
+			sql += fmt.Sprintf(" LEFT JOIN (%s) AS %s ON %s", shiftedSqls[i], table, strings.Join(conditions, " AND "))
+		}
+	}
+	if len(p.orderBy) > 0 {
+		orders := make([]string, 0, len(p.orderBy))
+		for _, order := range p.orderBy {
+			orders = append(orders, fmt.Sprintf("`%s` %s", strings.Trim(sqlparser.String(order.Expr), "`"), order.Direction))
+		}
+		sql += " ORDER BY " + strings.Join(orders, ", ")
+	}
+	if p.limit != nil {
+		if p.limit.Offset != nil {
+			sql += fmt.Sprintf(" LIMIT %s, %s", sqlparser.String(p.limit.Offset), sqlparser.String(p.limit.Rowcount))
+		} else {
+			sql += " LIMIT " + sqlparser.String(p.limit.Rowcount)
+		}
+	} else if defaultLimit != "" {
+		sql += " LIMIT " + defaultLimit
+	}
+	return sql
+}
+
+func (e *CHEngine) QueryTimeShiftSql(sql string, args *common.QuerierParams) (*common.Result, *client.Debug, error) {
+	sql, callbacks, columnSchemaMap, err := e.ParseTimeShiftSql(sql)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	if sql == "" {
+		return nil, nil, nil
+	}
+
+	query_uuid := args.QueryUUID
+	debug := &client.Debug{
+		IP:        config.Cfg.Clickhouse.Host,
+		QueryUUID: query_uuid,
+	}
+	debug.Sql = sql
+	chClient := client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       e.DB,
+		Debug:    debug,
+		Context:  e.Context,
+	}
+	params := &client.QueryParams{
+		Sql:             sql,
+		UseQueryCache:   args.UseQueryCache,
+		QueryCacheTTL:   args.QueryCacheTTL,
+		Callbacks:       callbacks,
+		QueryUUID:       query_uuid,
+		ColumnSchemaMap: columnSchemaMap,
+		ORGID:           args.ORGID,
+	}
+	rst, err := chClient.DoQuery(params)
+	if err != nil {
+		log.Error(err)
+		return nil, debug, err
+	}
+	return rst, debug, err
+}
+
+func (e *CHEngine) ParseTimeShiftSql(sql string) (string, map[string]func(*common.Result) error, map[string]*common.ColumnSchema, error) {
+	// a quick check to skip parsing most of the queries, the functions are detected in the parsed sql
+	if !checkTimeShiftSqlRegexp.MatchString(sql) {
+		return "", nil, nil, nil
+	}
+	plan, err := newTimeShiftPlan(sql)
+	if err != nil || plan == nil {
+		return "", nil, nil, err
+	}
+	currentSql, err := plan.CurrentSql()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	currentEngine, err := e.parseSubSql(e.DB, e.DataSource, currentSql)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	shiftedSqls := []string{}
+	for _, offset := range plan.offsets {
+		shiftedSql, err := plan.ShiftedSql(offset)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		shiftedEngine, err := e.parseSubSql(e.DB, e.DataSource, shiftedSql)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		shiftedSqls = append(shiftedSqls, shiftedEngine.ToSQLString())
+	}
+	columnSchemaMap := make(map[string]*common.ColumnSchema)
+	for _, columnSchema := range currentEngine.ColumnSchemas {
+		columnSchemaMap[columnSchema.Name] = columnSchema
+	}
+	defaultLimit := DEFAULT_LIMIT
+	if config.Cfg != nil {
+		defaultLimit = config.Cfg.Limit
+	}
+	return plan.OuterSql(currentEngine.ToSQLString(), shiftedSqls, defaultLimit), currentEngine.View.GetCallbacks(), columnSchemaMap, nil
+}
+
+// parseSubSql translates a sub-query without the default limit, which is applied to the outer query
+func (e *CHEngine) parseSubSql(db, dataSource, sql string) (*CHEngine, error) {
+	subEngine := &CHEngine{DB: db, DataSource: dataSource, Context: e.Context, ORGID: e.ORGID, NoPreWhere: e.NoPreWhere, Language: e.Language}
+	subEngine.Init()
+	subParser := parse.Parser{Engine: subEngine}
+	err := subParser.ParseSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %s; parse error: %s", sql, err.Error())
+	}
+	for _, stmt := range subEngine.Statements {
+		stmt.Format(subEngine.Model)
+	}
+	FormatInnerTime(subEngine.Model)
+	subEngine.View = view.NewView(subEngine.Model)
+	return subEngine, nil
+}
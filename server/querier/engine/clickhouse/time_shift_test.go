@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"testing"
+)
+
+func TestTimeShiftPlan(t *testing.T) {
+	input := "select time(time, 60) as toi, pod_ns, Sum(byte) as sum_byte, TimeShift(Sum(byte), '1d') as sum_byte_1d, Ratio_Vs(Sum(byte), '7d') as ratio_byte_7d from l4_flow_log where `time` >= 1700000000 and `time` <= 1700003600 and pod_ns = 'default' group by toi, pod_ns having Sum(byte) > 0 order by toi limit 10"
+	plan, err := newTimeShiftPlan(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentSql, err := plan.CurrentSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "select time(`time`, 60) as toi, pod_ns, Sum(byte) as sum_byte, Sum(byte) as __time_shift_column_4 from l4_flow_log where `time` >= 1700000000 and `time` <= 1700003600 and pod_ns = 'default' group by toi, pod_ns having Sum(byte) > 0"; currentSql != want {
+		t.Errorf("current sql:\n get: %s\nwant: %s", currentSql, want)
+	}
+	shiftedSql, err := plan.ShiftedSql(86400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "select time(`time`, 60) as toi, pod_ns, Sum(byte) as __time_shift_column_3 from l4_flow_log where `time` >= 1699913600 and `time` <= 1699917200 and pod_ns = 'default' group by toi, pod_ns"; shiftedSql != want {
+		t.Errorf("shifted sql:\n get: %s\nwant: %s", shiftedSql, want)
+	}
+	outerSql := plan.OuterSql("current", []string{"shifted_1d", "shifted_7d"}, "10000")
+	want := "SELECT __time_shift_current.`toi` AS `toi`, __time_shift_current.`pod_ns` AS `pod_ns`, __time_shift_current.`sum_byte` AS `sum_byte`, " +
+		"__time_shift_86400.`__time_shift_column_3` AS `sum_byte_1d`, " +
+		"if(__time_shift_604800.`__time_shift_column_4` = 0, NULL, divide(__time_shift_current.`__time_shift_column_4`, __time_shift_604800.`__time_shift_column_4`)) AS `ratio_byte_7d` " +
+		"FROM (current) AS __time_shift_current " +
+		"LEFT JOIN (shifted_1d) AS __time_shift_86400 ON __time_shift_current.`toi` = __time_shift_86400.`toi` + 86400 AND __time_shift_current.`pod_ns` = __time_shift_86400.`pod_ns` " +
+		"LEFT JOIN (shifted_7d) AS __time_shift_604800 ON __time_shift_current.`toi` = __time_shift_604800.`toi` + 604800 AND __time_shift_current.`pod_ns` = __time_shift_604800.`pod_ns` " +
+		"ORDER BY `toi` asc LIMIT 10"
+	if outerSql != want {
+		t.Errorf("outer sql:\n get: %s\nwant: %s", outerSql, want)
+	}
+
+	for _, input := range []string{
+		"select Delta_Vs(Sum(byte), '1d') as delta from l4_flow_log",
+		"select Delta_Vs(Sum(byte), '1d') / 2 as delta from l4_flow_log where `time` >= 1700000000",
+		"select Delta_Vs(Sum(byte), '1d') as delta from l4_flow_log where `time` >= now() - 3600",
+		"select Delta_Vs(Sum(byte), '1d') as delta from l4_flow_log where `time` >= toDateTime('2023-11-14 22:13:20')",
+		"select Delta_Vs(Sum(byte), 1) as delta from l4_flow_log where `time` >= 1700000000",
+		"select Delta_Vs(Sum(byte), '1d') as delta from l4_flow_log where `time` >= 1700000000 group by pod_ns",
+	} {
+		plan, err := newTimeShiftPlan(input)
+		if err == nil {
+			_, err = plan.ShiftedSql(86400)
+		}
+		if err == nil {
+			t.Errorf("%s: error expected", input)
+		}
+	}
+}
+
+func TestTimeShiftPlanDetection(t *testing.T) {
+	// the function names in string literals are not time-shift functions
+	for _, input := range []string{
+		"select Sum(byte) as sum_byte from l4_flow_log where pod_ns = 'TimeShift(' group by pod_ns",
+		"select pod_ns, Sum(byte) from l4_flow_log, l7_flow_log where pod_ns = 'Ratio_Vs(x)'",
+	} {
+		plan, err := newTimeShiftPlan(input)
+		if plan != nil || err != nil {
+			t.Errorf("%s: unexpected plan %v, error %v", input, plan, err)
+		}
+	}
+
+	plan, err := newTimeShiftPlan("select TimeShift(Sum(byte), '1h') as sum_byte_1h from l4_flow_log where `time` >= 1700003600 - 3600 and `time` <= 1700003600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shiftedSql, err := plan.ShiftedSql(3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "select Sum(byte) as __time_shift_column_0 from l4_flow_log where `time` >= (1700003600 - 3600) - 3600 and `time` <= 1700000000"; shiftedSql != want {
+		t.Errorf("shifted sql:\n get: %s\nwant: %s", shiftedSql, want)
+	}
+}
@@ -1021,3 +1021,74 @@ func (f *NonNegativeDerivativeFunction) WriteTo(buf *bytes.Buffer) {
 		buf.WriteString("`")
 	}
 }
+
+const (
+	FUNCTION_TIME_SHIFT = "TimeShift"
+	FUNCTION_DELTA_VS   = "Delta_Vs"
+	FUNCTION_RATIO_VS   = "Ratio_Vs"
+)
+
+// The time-shift functions compare a metric with the same metric of the time range shifted
+// by an offset, such as TimeShift(Sum(byte), '1d') and Delta_Vs(Sum(byte), '7d')
+var TIME_SHIFT_FUNCTIONS = []string{FUNCTION_TIME_SHIFT, FUNCTION_DELTA_VS, FUNCTION_RATIO_VS}
+
+var TIME_SHIFT_OFFSET_UNITS = map[byte]int{
+	's': 1,
+	'm': 60,
+	'h': 3600,
+	'd': 86400,
+	'w': 604800,
+}
+
+// ParseTimeShiftOffset parses the offset of the time-shift functions into seconds, such as '30m', '1d' and '1w'
+func ParseTimeShiftOffset(offset string) (int, error) {
+	offset = strings.Trim(offset, "'")
+	if len(offset) < 2 {
+		return 0, fmt.Errorf("invalid time shift offset '%s'", offset)
+	}
+	unit, ok := TIME_SHIFT_OFFSET_UNITS[offset[len(offset)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid time shift offset '%s', unit must be one of s, m, h, d and w", offset)
+	}
+	value, err := strconv.Atoi(offset[:len(offset)-1])
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid time shift offset '%s'", offset)
+	}
+	return value * unit, nil
+}
+
+// TimeShiftFunction is written into the outer query which joins the sub-query of the current
+// time range and the sub-query of the shifted time range, Current and Shifted are the columns
+// of the metric in the two sub-queries.
+type TimeShiftFunction struct {
+	Name    string
+	Offset  int
+	Current string
+	Shifted string
+	Alias   string
+	NodeBase
+}
+
+func (f *TimeShiftFunction) ToString() string {
+	buf := bytes.Buffer{}
+	f.WriteTo(&buf)
+	return buf.String()
+}
+
+func (f *TimeShiftFunction) WriteTo(buf *bytes.Buffer) {
+	switch f.Name {
+	case FUNCTION_DELTA_VS:
+		buf.WriteString(fmt.Sprintf("minus(%s, %s)", f.Current, f.Shifted))
+	case FUNCTION_RATIO_VS:
+		// the ratio is null when the shifted metric is 0
+		buf.WriteString(fmt.Sprintf("if(%s = 0, NULL, divide(%s, %s))", f.Shifted, f.Current, f.Shifted))
+	default:
+		buf.WriteString(f.Shifted)
+	}
+	if f.Alias != "" {
+		buf.WriteString(" AS ")
+		buf.WriteString("`")
+		buf.WriteString(strings.Trim(f.Alias, "`"))
+		buf.WriteString("`")
+	}
+}
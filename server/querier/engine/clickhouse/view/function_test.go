@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package view
+
+import (
+	"testing"
+)
+
+func TestParseTimeShiftOffset(t *testing.T) {
+	cases := []struct {
+		input   string
+		output  int
+		wantErr bool
+	}{
+		{input: "'30s'", output: 30},
+		{input: "'5m'", output: 300},
+		{input: "1h", output: 3600},
+		{input: "'1d'", output: 86400},
+		{input: "'7d'", output: 604800},
+		{input: "'2w'", output: 1209600},
+		{input: "'1y'", wantErr: true},
+		{input: "'d'", wantErr: true},
+		{input: "'-1d'", wantErr: true},
+	}
+	for _, c := range cases {
+		output, err := ParseTimeShiftOffset(c.input)
+		if (err != nil) != c.wantErr || output != c.output {
+			t.Errorf("ParseTimeShiftOffset(%s) = %d, %v, want %d, error: %v", c.input, output, err, c.output, c.wantErr)
+		}
+	}
+}
+
+func TestTimeShiftFunction(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+	}{
+		{name: FUNCTION_TIME_SHIFT, output: "s.`v` AS `m`"},
+		{name: FUNCTION_DELTA_VS, output: "minus(c.`v`, s.`v`) AS `m`"},
+		{name: FUNCTION_RATIO_VS, output: "if(s.`v` = 0, NULL, divide(c.`v`, s.`v`)) AS `m`"},
+	}
+	for _, c := range cases {
+		function := &TimeShiftFunction{Name: c.name, Offset: 86400, Current: "c.`v`", Shifted: "s.`v`", Alias: "m"}
+		if output := function.ToString(); output != c.output {
+			t.Errorf("%s: get %s, want %s", c.name, output, c.output)
+		}
+	}
+}
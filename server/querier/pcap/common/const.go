@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+const (
+	DATABASE_FLOW_LOG = "flow_log"
+	TABLE_PACKET      = "l7_packet"
+	TABLE_L4_FLOW_LOG = "l4_flow_log"
+)
+
+const (
+	HEADER_KEY_X_ORG_ID = "X-Org-Id"
+	// set if the packets are cut off by max-batches or max-packets, the value is the reason
+	HEADER_KEY_X_PCAP_TRUNCATED = "X-Pcap-Truncated"
+	CONTENT_TYPE_PCAPNG         = "application/x-pcapng"
+	FILE_NAME_PREFIX            = "deepflow"
+	APPLICATION_NAME            = "deepflow-server"
+)
+
+// magic numbers of the pcap global header written by the agent
+const (
+	PCAP_MAGIC_MICROSECOND = 0xa1b2c3d4
+	PCAP_MAGIC_NANOSECOND  = 0xa1b23c4d
+	PCAP_GLOBAL_HEADER_LEN = 24
+	PCAP_RECORD_HEADER_LEN = 16
+)
+
+var PROTOCOL_NAMES = map[uint8]string{
+	1:  "ICMP",
+	6:  "TCP",
+	17: "UDP",
+	58: "ICMPv6",
+}
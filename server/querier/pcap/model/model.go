@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type PcapDownload struct {
+	FlowIDs    []uint64 `json:"flow_ids"`
+	IP0        string   `json:"ip_0"`
+	IP1        string   `json:"ip_1"`
+	ClientPort uint16   `json:"client_port"`
+	ServerPort uint16   `json:"server_port"`
+	Protocol   uint8    `json:"protocol"`
+	TimeStart  int64    `json:"time_start"`
+	TimeEnd    int64    `json:"time_end"`
+	Context    context.Context
+	OrgID      string
+}
+
+type Flow struct {
+	FlowID     uint64
+	AgentID    uint16
+	IP0        net.IP
+	IP1        net.IP
+	ClientPort uint16
+	ServerPort uint16
+	Protocol   uint8
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+type Packet struct {
+	FlowID         uint64
+	AgentID        uint16
+	LinkType       uint32
+	SnapLen        uint32
+	Timestamp      time.Time
+	OriginalLength int
+	Data           []byte
+}
+
+type PcapResult struct {
+	Flows     map[uint64]*Flow
+	Packets   []*Packet
+	Truncated string // reason if not all the packets are returned
+}
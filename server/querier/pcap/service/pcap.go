@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	querier_common "github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	"github.com/deepflowio/deepflow/server/querier/pcap/common"
+	"github.com/deepflowio/deepflow/server/querier/pcap/model"
+)
+
+var log = logging.MustGetLogger("pcap")
+
+// flows are looked up around the packets' time when only flow_ids are given
+const flowTimeDelta = 60
+
+func Download(args *model.PcapDownload, cfg *config.QuerierConfig) (*model.PcapResult, error) {
+	if err := validate(args, cfg); err != nil {
+		return nil, err
+	}
+	database, err := getDatabase(args.OrgID)
+	if err != nil {
+		return nil, querier_common.NewError(querier_common.INVALID_POST_DATA, err.Error())
+	}
+
+	result := &model.PcapResult{Flows: make(map[uint64]*model.Flow)}
+	flowIDs := args.FlowIDs
+	if len(flowIDs) == 0 {
+		where, err := tupleFilter(args)
+		if err != nil {
+			return nil, querier_common.NewError(querier_common.INVALID_POST_DATA, err.Error())
+		}
+		if err := queryFlows(args, cfg, database, where, result.Flows); err != nil {
+			return nil, err
+		}
+		if len(result.Flows) == 0 {
+			return nil, querier_common.NewError(querier_common.RESOURCE_NOT_FOUND, "no flow matches the 5-tuple")
+		}
+		for id := range result.Flows {
+			flowIDs = append(flowIDs, id)
+		}
+	}
+
+	if err := queryPackets(args, cfg, database, flowIDs, result); err != nil {
+		return nil, err
+	}
+	if len(result.Packets) == 0 {
+		return nil, querier_common.NewError(querier_common.RESOURCE_NOT_FOUND, "no packets stored for the flows")
+	}
+	SortPackets(result.Packets)
+	if len(result.Packets) > cfg.Pcap.MaxPackets {
+		log.Warningf("pcap download truncated from %d to %d packets", len(result.Packets), cfg.Pcap.MaxPackets)
+		result.Packets = result.Packets[:cfg.Pcap.MaxPackets]
+		result.Truncated = fmt.Sprintf("more than %d packets (max-packets)", cfg.Pcap.MaxPackets)
+	}
+
+	if len(args.FlowIDs) > 0 {
+		// metadata only used for comments, ignore the error
+		timeStart := result.Packets[0].Timestamp.Unix() - flowTimeDelta
+		timeEnd := result.Packets[len(result.Packets)-1].Timestamp.Unix() + flowTimeDelta
+		where := fmt.Sprintf("time>=%d AND time<=%d AND flow_id IN (%s)", timeStart, timeEnd, joinFlowIDs(args.FlowIDs))
+		if err := queryFlows(args, cfg, database, where, result.Flows); err != nil {
+			log.Warningf("query flows of pcap download failed: %s", err)
+		}
+	}
+	return result, nil
+}
+
+func FileName(args *model.PcapDownload) string {
+	if len(args.FlowIDs) == 1 {
+		return fmt.Sprintf("%s-%d.pcapng", common.FILE_NAME_PREFIX, args.FlowIDs[0])
+	}
+	return fmt.Sprintf("%s-%s.pcapng", common.FILE_NAME_PREFIX, time.Now().Format("20060102150405"))
+}
+
+func validate(args *model.PcapDownload, cfg *config.QuerierConfig) error {
+	if len(args.FlowIDs) == 0 && args.IP0 == "" && args.IP1 == "" {
+		return querier_common.NewError(querier_common.INVALID_POST_DATA, "flow_ids or ip_0/ip_1 is required")
+	}
+	if len(args.FlowIDs) > cfg.Pcap.MaxFlows {
+		return querier_common.NewError(querier_common.RESOURCE_NUM_EXCEEDED,
+			fmt.Sprintf("too many flow_ids: %d, limit: %d", len(args.FlowIDs), cfg.Pcap.MaxFlows))
+	}
+	// flow ids are not in the primary key of the packet table, a query without the time range scans all the packets
+	if args.TimeStart <= 0 || args.TimeEnd <= 0 {
+		return querier_common.NewError(querier_common.INVALID_POST_DATA, "time_start and time_end are required")
+	}
+	if args.TimeStart > args.TimeEnd {
+		return querier_common.NewError(querier_common.INVALID_POST_DATA, "time_start is greater than time_end")
+	}
+	return nil
+}
+
+func getDatabase(orgID string) (string, error) {
+	if orgID == "" || orgID == querier_common.DEFAULT_ORG_ID {
+		return common.DATABASE_FLOW_LOG, nil
+	}
+	orgIDInt, err := strconv.Atoi(orgID)
+	if err != nil {
+		return "", fmt.Errorf("invalid org id %s", orgID)
+	}
+	return fmt.Sprintf("%04d_%s", orgIDInt, common.DATABASE_FLOW_LOG), nil
+}
+
+func ipFilter(side, ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid ip %s", ip)
+	}
+	if parsed.To4() != nil {
+		return fmt.Sprintf("is_ipv4=1 AND ip4_%s=toIPv4('%s')", side, parsed.String()), nil
+	}
+	return fmt.Sprintf("is_ipv4=0 AND ip6_%s=toIPv6('%s')", side, parsed.String()), nil
+}
+
+// tupleFilter matches the flows in both directions
+func tupleFilter(args *model.PcapDownload) (string, error) {
+	directions := make([]string, 0, 2)
+	for _, reversed := range []bool{false, true} {
+		ip0, ip1, port0, port1 := args.IP0, args.IP1, args.ClientPort, args.ServerPort
+		if reversed {
+			ip0, ip1, port0, port1 = ip1, ip0, port1, port0
+		}
+		conditions := []string{}
+		for i, ip := range []string{ip0, ip1} {
+			if ip == "" {
+				continue
+			}
+			condition, err := ipFilter(strconv.Itoa(i), ip)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		if port0 != 0 {
+			conditions = append(conditions, fmt.Sprintf("client_port=%d", port0))
+		}
+		if port1 != 0 {
+			conditions = append(conditions, fmt.Sprintf("server_port=%d", port1))
+		}
+		directions = append(directions, "("+strings.Join(conditions, " AND ")+")")
+	}
+	where := fmt.Sprintf("time>=%d AND time<=%d AND (%s)", args.TimeStart, args.TimeEnd, strings.Join(directions, " OR "))
+	if args.Protocol != 0 {
+		where += fmt.Sprintf(" AND protocol=%d", args.Protocol)
+	}
+	return where, nil
+}
+
+func joinFlowIDs(flowIDs []uint64) string {
+	ids := make([]string, 0, len(flowIDs))
+	for _, id := range flowIDs {
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+func newClient(args *model.PcapDownload, database string) *client.Client {
+	return &client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       database,
+		Context:  args.Context,
+	}
+}
+
+func queryFlows(args *model.PcapDownload, cfg *config.QuerierConfig, database, where string, flows map[uint64]*model.Flow) error {
+	sql := fmt.Sprintf(
+		"SELECT flow_id, agent_id, is_ipv4, ip4_0, ip4_1, ip6_0, ip6_1, client_port, server_port, protocol, start_time, end_time "+
+			"FROM %s.%s WHERE %s ORDER BY start_time LIMIT %d",
+		database, common.TABLE_L4_FLOW_LOG, where, cfg.Pcap.MaxFlows,
+	)
+	chClient := newClient(args, database)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: args.OrgID, SimpleSql: true})
+	if err != nil {
+		log.Errorf("query flows failed: %s, sql: %s", err, sql)
+		return querier_common.NewError(querier_common.SERVER_ERROR, err.Error())
+	}
+	for _, value := range rst.Values {
+		row := value.([]interface{})
+		flow := &model.Flow{}
+		flow.FlowID, _ = row[0].(uint64)
+		flow.AgentID, _ = row[1].(uint16)
+		if isIPv4, _ := row[2].(uint8); isIPv4 == 1 {
+			flow.IP0, _ = row[3].(net.IP)
+			flow.IP1, _ = row[4].(net.IP)
+		} else {
+			flow.IP0, _ = row[5].(net.IP)
+			flow.IP1, _ = row[6].(net.IP)
+		}
+		flow.ClientPort, _ = row[7].(uint16)
+		flow.ServerPort, _ = row[8].(uint16)
+		flow.Protocol, _ = row[9].(uint8)
+		flow.StartTime, _ = row[10].(time.Time)
+		flow.EndTime, _ = row[11].(time.Time)
+
+		// a long flow is reported several times with the same flow_id
+		if old, ok := flows[flow.FlowID]; ok {
+			if flow.StartTime.Before(old.StartTime) {
+				old.StartTime = flow.StartTime
+			}
+			if flow.EndTime.After(old.EndTime) {
+				old.EndTime = flow.EndTime
+			}
+			continue
+		}
+		flows[flow.FlowID] = flow
+	}
+	return nil
+}
+
+func queryPackets(args *model.PcapDownload, cfg *config.QuerierConfig, database string, flowIDs []uint64, result *model.PcapResult) error {
+	where := fmt.Sprintf("flow_id IN (%s) AND time>=%d AND time<=%d", joinFlowIDs(flowIDs), args.TimeStart, args.TimeEnd)
+	sql := fmt.Sprintf(
+		"SELECT flow_id, agent_id, packet_batch FROM %s.%s WHERE %s ORDER BY start_time LIMIT %d",
+		database, common.TABLE_PACKET, where, cfg.Pcap.MaxBatches+1,
+	)
+	chClient := newClient(args, database)
+	rst, err := chClient.DoQuery(&client.QueryParams{Sql: sql, ORGID: args.OrgID, SimpleSql: true})
+	if err != nil {
+		log.Errorf("query packets failed: %s, sql: %s", err, sql)
+		return querier_common.NewError(querier_common.SERVER_ERROR, err.Error())
+	}
+	// one more batch is queried to know whether the result is cut off by the limit
+	values := rst.Values
+	if len(values) > cfg.Pcap.MaxBatches {
+		log.Warningf("pcap download truncated to %d packet batches", cfg.Pcap.MaxBatches)
+		values = values[:cfg.Pcap.MaxBatches]
+		result.Truncated = fmt.Sprintf("more than %d packet batches (max-batches)", cfg.Pcap.MaxBatches)
+	}
+	for _, value := range values {
+		row := value.([]interface{})
+		flowID, _ := row[0].(uint64)
+		agentID, _ := row[1].(uint16)
+		batch, _ := row[2].(string)
+		packets, err := ParsePacketBatch(flowID, agentID, []byte(batch))
+		if err != nil {
+			// keep the packets before the broken record
+			log.Warning(err)
+		}
+		result.Packets = append(result.Packets, packets...)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/deepflowio/deepflow/server/querier/pcap/common"
+	"github.com/deepflowio/deepflow/server/querier/pcap/model"
+)
+
+// ParsePacketBatch parses the packet_batch column, which is a pcap global header followed by pcap records
+func ParsePacketBatch(flowID uint64, agentID uint16, batch []byte) ([]*model.Packet, error) {
+	if len(batch) < common.PCAP_GLOBAL_HEADER_LEN {
+		return nil, fmt.Errorf("packet batch of flow %d is too short: %d", flowID, len(batch))
+	}
+	var order binary.ByteOrder
+	var nanosecond bool
+	switch {
+	case binary.LittleEndian.Uint32(batch) == common.PCAP_MAGIC_MICROSECOND:
+		order = binary.LittleEndian
+	case binary.LittleEndian.Uint32(batch) == common.PCAP_MAGIC_NANOSECOND:
+		order, nanosecond = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(batch) == common.PCAP_MAGIC_MICROSECOND:
+		order = binary.BigEndian
+	case binary.BigEndian.Uint32(batch) == common.PCAP_MAGIC_NANOSECOND:
+		order, nanosecond = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("packet batch of flow %d has invalid magic 0x%x", flowID, binary.LittleEndian.Uint32(batch))
+	}
+	snapLen := order.Uint32(batch[16:])
+	linkType := order.Uint32(batch[20:]) & 0xffff
+
+	packets := []*model.Packet{}
+	for offset := common.PCAP_GLOBAL_HEADER_LEN; offset < len(batch); {
+		if offset+common.PCAP_RECORD_HEADER_LEN > len(batch) {
+			return packets, fmt.Errorf("packet batch of flow %d has truncated record header at %d", flowID, offset)
+		}
+		header := batch[offset : offset+common.PCAP_RECORD_HEADER_LEN]
+		seconds, fraction := int64(order.Uint32(header)), int64(order.Uint32(header[4:]))
+		captureLength, originalLength := int(order.Uint32(header[8:])), int(order.Uint32(header[12:]))
+		offset += common.PCAP_RECORD_HEADER_LEN
+		if captureLength > len(batch)-offset {
+			return packets, fmt.Errorf("packet batch of flow %d has truncated record data at %d", flowID, offset)
+		}
+		if !nanosecond {
+			fraction *= int64(time.Microsecond)
+		}
+		if originalLength < captureLength {
+			originalLength = captureLength
+		}
+		packets = append(packets, &model.Packet{
+			FlowID:         flowID,
+			AgentID:        agentID,
+			LinkType:       linkType,
+			SnapLen:        snapLen,
+			Timestamp:      time.Unix(seconds, fraction),
+			OriginalLength: originalLength,
+			Data:           batch[offset : offset+captureLength],
+		})
+		offset += captureLength
+	}
+	return packets, nil
+}
+
+func SortPackets(packets []*model.Packet) {
+	sort.SliceStable(packets, func(i, j int) bool {
+		return packets[i].Timestamp.Before(packets[j].Timestamp)
+	})
+}
+
+type interfaceKey struct {
+	agentID  uint16
+	linkType uint32
+}
+
+// WritePcapng writes sorted packets as a pcapng file, packets captured by the same agent with the same link type
+// share an interface, and the flow metadata is written to the comments of the section and interfaces
+func WritePcapng(w io.Writer, result *model.PcapResult) error {
+	if len(result.Packets) == 0 {
+		return errors.New("no packets to write")
+	}
+
+	interfaces := []pcapgo.NgInterface{}
+	interfaceIndexes := make(map[interfaceKey]int)
+	interfaceFlows := [][]uint64{}
+	packetInterfaces := make([]int, len(result.Packets))
+	for i, p := range result.Packets {
+		key := interfaceKey{p.AgentID, p.LinkType}
+		index, ok := interfaceIndexes[key]
+		if !ok {
+			index = len(interfaces)
+			interfaceIndexes[key] = index
+			interfaces = append(interfaces, pcapgo.NgInterface{
+				Name:        fmt.Sprintf("agent-%d", p.AgentID),
+				Description: fmt.Sprintf("packets captured by deepflow-agent %d", p.AgentID),
+				LinkType:    layers.LinkType(p.LinkType),
+			})
+			interfaceFlows = append(interfaceFlows, nil)
+		}
+		if p.SnapLen > interfaces[index].SnapLength {
+			interfaces[index].SnapLength = p.SnapLen
+		}
+		if flows := interfaceFlows[index]; len(flows) == 0 || flows[len(flows)-1] != p.FlowID {
+			interfaceFlows[index] = append(flows, p.FlowID)
+		}
+		packetInterfaces[i] = index
+	}
+	for i := range interfaces {
+		interfaces[i].Comment = flowsComment(interfaceFlows[i], result.Flows)
+	}
+
+	first, last := result.Packets[0], result.Packets[len(result.Packets)-1]
+	options := pcapgo.NgWriterOptions{
+		SectionInfo: pcapgo.NgSectionInfo{
+			Application: common.APPLICATION_NAME,
+			Comment: fmt.Sprintf("flows: %d, packets: %d, time: %s - %s", countFlows(interfaceFlows), len(result.Packets),
+				first.Timestamp.Format(time.RFC3339Nano), last.Timestamp.Format(time.RFC3339Nano)),
+		},
+	}
+	writer, err := pcapgo.NewNgWriterInterface(w, interfaces[0], options)
+	if err != nil {
+		return err
+	}
+	for _, intf := range interfaces[1:] {
+		if _, err := writer.AddInterface(intf); err != nil {
+			return err
+		}
+	}
+	for i, p := range result.Packets {
+		ci := gopacket.CaptureInfo{
+			Timestamp:      p.Timestamp,
+			CaptureLength:  len(p.Data),
+			Length:         p.OriginalLength,
+			InterfaceIndex: packetInterfaces[i],
+		}
+		if err := writer.WritePacket(ci, p.Data); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func countFlows(interfaceFlows [][]uint64) int {
+	flows := make(map[uint64]struct{})
+	for _, ids := range interfaceFlows {
+		for _, id := range ids {
+			flows[id] = struct{}{}
+		}
+	}
+	return len(flows)
+}
+
+func flowsComment(flowIDs []uint64, flows map[uint64]*model.Flow) string {
+	// packets are sorted by time, the same flow may appear several times
+	sorted := make([]uint64, len(flowIDs))
+	copy(sorted, flowIDs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	lines := make([]string, 0, len(sorted))
+	for i, id := range sorted {
+		if i > 0 && sorted[i-1] == id {
+			continue
+		}
+		lines = append(lines, FlowComment(id, flows[id]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func FlowComment(flowID uint64, flow *model.Flow) string {
+	if flow == nil {
+		return fmt.Sprintf("flow_id=%d", flowID)
+	}
+	protocol, ok := common.PROTOCOL_NAMES[flow.Protocol]
+	if !ok {
+		protocol = strconv.Itoa(int(flow.Protocol))
+	}
+	return fmt.Sprintf("flow_id=%d %s -> %s %s start_time=%s end_time=%s", flowID,
+		net.JoinHostPort(flow.IP0.String(), strconv.Itoa(int(flow.ClientPort))),
+		net.JoinHostPort(flow.IP1.String(), strconv.Itoa(int(flow.ServerPort))),
+		protocol, flow.StartTime.Format(time.RFC3339Nano), flow.EndTime.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/deepflowio/deepflow/server/querier/pcap/common"
+	"github.com/deepflowio/deepflow/server/querier/pcap/model"
+)
+
+type testRecord struct {
+	seconds, fraction uint32
+	data              []byte
+	originalLength    uint32
+}
+
+func buildPacketBatch(order binary.ByteOrder, magic, linkType uint32, records []testRecord) []byte {
+	buf := make([]byte, common.PCAP_GLOBAL_HEADER_LEN)
+	order.PutUint32(buf, magic)
+	order.PutUint16(buf[4:], 2)
+	order.PutUint16(buf[6:], 4)
+	order.PutUint32(buf[16:], 65535)
+	order.PutUint32(buf[20:], linkType)
+	for _, r := range records {
+		header := make([]byte, common.PCAP_RECORD_HEADER_LEN)
+		order.PutUint32(header, r.seconds)
+		order.PutUint32(header[4:], r.fraction)
+		order.PutUint32(header[8:], uint32(len(r.data)))
+		order.PutUint32(header[12:], r.originalLength)
+		buf = append(buf, header...)
+		buf = append(buf, r.data...)
+	}
+	return buf
+}
+
+func TestParsePacketBatch(t *testing.T) {
+	records := []testRecord{
+		{100, 5, []byte{1, 2, 3}, 60},
+		{101, 7, []byte{4, 5}, 1},
+	}
+	cases := []struct {
+		order      binary.ByteOrder
+		magic      uint32
+		nanosecond bool
+	}{
+		{binary.LittleEndian, common.PCAP_MAGIC_MICROSECOND, false},
+		{binary.BigEndian, common.PCAP_MAGIC_MICROSECOND, false},
+		{binary.LittleEndian, common.PCAP_MAGIC_NANOSECOND, true},
+	}
+	for _, c := range cases {
+		packets, err := ParsePacketBatch(1, 2, buildPacketBatch(c.order, c.magic, 1, records))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(packets) != 2 {
+			t.Fatalf("expected 2 packets, got %d", len(packets))
+		}
+		expected := time.Unix(100, 5000)
+		if c.nanosecond {
+			expected = time.Unix(100, 5)
+		}
+		p := packets[0]
+		if !p.Timestamp.Equal(expected) || p.LinkType != 1 || p.SnapLen != 65535 || p.OriginalLength != 60 || !bytes.Equal(p.Data, []byte{1, 2, 3}) {
+			t.Errorf("unexpected packet %+v", p)
+		}
+		if packets[1].OriginalLength != 2 {
+			t.Errorf("original length should not be less than capture length, got %d", packets[1].OriginalLength)
+		}
+	}
+
+	batch := buildPacketBatch(binary.LittleEndian, common.PCAP_MAGIC_MICROSECOND, 1, records)
+	packets, err := ParsePacketBatch(1, 2, batch[:len(batch)-1])
+	if err == nil || len(packets) != 1 {
+		t.Errorf("truncated batch should return the complete packets with an error, got %d packets, err %v", len(packets), err)
+	}
+	if _, err := ParsePacketBatch(1, 2, make([]byte, common.PCAP_GLOBAL_HEADER_LEN)); err == nil {
+		t.Error("invalid magic should fail")
+	}
+}
+
+func TestWritePcapng(t *testing.T) {
+	result := &model.PcapResult{
+		Flows: map[uint64]*model.Flow{
+			10: {FlowID: 10, AgentID: 1, IP0: net.ParseIP("10.0.0.1"), IP1: net.ParseIP("10.0.0.2"), ClientPort: 1234, ServerPort: 80, Protocol: 6},
+		},
+	}
+	for _, batch := range []struct {
+		flowID  uint64
+		agentID uint16
+		records []testRecord
+	}{
+		{10, 1, []testRecord{{102, 0, []byte{1}, 1}, {100, 0, []byte{2}, 1}}},
+		{20, 2, []testRecord{{101, 0, []byte{3}, 1}}},
+	} {
+		packets, err := ParsePacketBatch(batch.flowID, batch.agentID, buildPacketBatch(binary.LittleEndian, common.PCAP_MAGIC_MICROSECOND, 1, batch.records))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result.Packets = append(result.Packets, packets...)
+	}
+	SortPackets(result.Packets)
+
+	buf := &bytes.Buffer{}
+	if err := WritePcapng(buf, result); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := pcapgo.NewNgReader(buf, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reader.SectionInfo().Comment, "flows: 2, packets: 3") {
+		t.Errorf("unexpected section comment %q", reader.SectionInfo().Comment)
+	}
+	expected := []struct {
+		data           byte
+		interfaceIndex int
+	}{{2, 0}, {3, 1}, {1, 0}}
+	for i, e := range expected {
+		data, ci, err := reader.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != e.data || ci.InterfaceIndex != e.interfaceIndex {
+			t.Errorf("packet %d: got data %v interface %d", i, data, ci.InterfaceIndex)
+		}
+	}
+	if reader.NInterfaces() != 2 {
+		t.Fatalf("expected 2 interfaces, got %d", reader.NInterfaces())
+	}
+	intf, _ := reader.Interface(0)
+	if intf.Name != "agent-1" || intf.LinkType != layers.LinkTypeEthernet || !strings.Contains(intf.Comment, "10.0.0.1:1234 -> 10.0.0.2:80 TCP") {
+		t.Errorf("unexpected interface %+v", intf)
+	}
+	intf, _ = reader.Interface(1)
+	if intf.Name != "agent-2" || intf.Comment != "flow_id=20" {
+		t.Errorf("unexpected interface %+v", intf)
+	}
+
+	if err := WritePcapng(&bytes.Buffer{}, &model.PcapResult{}); err == nil {
+		t.Error("empty result should fail")
+	}
+}
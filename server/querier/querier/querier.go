@@ -38,6 +38,7 @@ import (
 	"github.com/deepflowio/deepflow/server/querier/config"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/trans_prometheus"
+	pcap_router "github.com/deepflowio/deepflow/server/querier/pcap/router"
 	profile_router "github.com/deepflowio/deepflow/server/querier/profile/router"
 	"github.com/deepflowio/deepflow/server/querier/router"
 	"github.com/deepflowio/deepflow/server/querier/statsd"
@@ -105,7 +106,8 @@ func Start(configPath, serverLogFile string, shared *servercommon.ControllerInge
 	r.Use(ErrHandle())
 	router.QueryRouter(r)
 	profile_router.ProfileRouter(r, &cfg)
-	prometheus_router.PrometheusRouter(r)
+	pcap_router.PcapRouter(r, &cfg)
+	prometheus_router.PrometheusRouter(r, shared.PrometheusQueue)
 	tracing_adapter.TracingAdapterRouter(r)
 	distributed_tracing.TraceMapRouter(r, &cfg, tracemap_generator)
 	registerRouterCounter(r.Routes())